@@ -13,7 +13,7 @@ const ROLE_MAP = {
 // inside a blockquoted body, the regex won't false-match. Combined with
 // `^…$` anchoring this also protects against marker text inside fenced code
 // blocks (which gets blockquoted alongside the surrounding body).
-const TURN_RE = /^(?!>)(?:## ([A-Za-z]+)|\*\*([A-Za-z]+)\*\*)\s*$/;
+const TURN_RE = /^(?!>)(?:## ([A-Za-z]+)|\*\*([A-Za-z]+)(?: · ([^*]+))?\*\*)\s*$/;
 const ELAPSED_RE = /^(?!>)<small>\s*(?:took\s+)?([^<]+?)\s*<\/small><br\s*\/?>?\s*$/i;
 
 function unblockquote(s) {
@@ -80,7 +80,8 @@ function splitTurnsFromTables(body) {
 }
 
 // Heading / bold-line parser. A turn starts on a line matching TURN_RE
-// (`## Role` or `**Role**`). Two pieces of metadata may appear adjacent to
+// (`## Role` or `**Role**`, or `**AGENT · Name**` for a named agent — the
+// name becomes turn.name). Two pieces of metadata may appear adjacent to
 // turn markers and are extracted into structured fields rather than left in
 // the bubble body:
 //   - Pre-marker `<small>took NN.Ns</small><br>` line  → turn.elapsed
@@ -98,7 +99,7 @@ function splitTurnsFromHeadings(body) {
     const role = rawRole && ROLE_MAP[rawRole.toLowerCase()];
     if (role) {
       if (current) turns.push(current);
-      current = { role, lines: [], elapsed: pendingElapsed };
+      current = { role, name: turnMatch[3] || null, lines: [], elapsed: pendingElapsed };
       pendingElapsed = null;
       continue;
     }
@@ -122,7 +123,7 @@ function splitTurnsFromHeadings(body) {
       let bodyText = t.lines.join('\n').trim();
       bodyText = unblockquote(bodyText);
       const { body: stripped, replies } = extractQuickReplies(bodyText);
-      return { role: t.role, body: stripped.trim(), elapsed: t.elapsed, replies };
+      return { role: t.role, name: t.name, body: stripped.trim(), elapsed: t.elapsed, replies };
     }),
   };
 }
@@ -237,6 +238,12 @@ async function loadChat(mdPath, container) {
       const bubble = document.createElement('div');
       bubble.className = 'bubble ' + turn.role;
       bubble.innerHTML = marked.parse(turn.body);
+      if (turn.name) {
+        const who = document.createElement('div');
+        who.className = 'who';
+        who.textContent = turn.name;
+        bubble.insertBefore(who, bubble.firstChild);
+      }
       container.appendChild(bubble);
       if (turn.replies && turn.replies.length) {
         const fr = document.createElement('div');
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/choonkeat/agent-chat/pkg/wire"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// A failure the agent hits is usually buried in an MCP error result that
+// only the agent's model reads, so the person chatting sees the agent go
+// quiet. An "agentError" event puts it in the chat: the agent can report
+// one with report_error, and reportToolErrors turns every failed tool call
+// into one. The page renders it as a red card and, in a hidden tab, a
+// desktop notification.
+
+// AgentError is the Data of an "agentError" event.
+type AgentError struct {
+	Message   string `json:"message"`
+	Tool      string `json:"tool,omitempty"`      // the tool that failed, or the one the agent was using
+	Detail    string `json:"detail,omitempty"`    // e.g. a command's output or a stack trace
+	Automatic bool   `json:"automatic,omitempty"` // a failed tool call, not report_error
+}
+
+func (e AgentError) Summary() string {
+	text := "⚠️ **Error**"
+	if e.Tool != "" {
+		text += " in `" + e.Tool + "`"
+	}
+	return text + ": " + e.Message
+}
+
+func init() {
+	wire.RegisterData[AgentError]("agentError")
+}
+
+// maxErrorDetail caps an agentError's Detail, in bytes.
+const maxErrorDetail = 8 << 10
+
+// ReportError publishes e as an "agentError" event and returns its seq.
+func (eb *EventBus) ReportError(e AgentError, meta *ToolMeta) (int64, error) {
+	e.Message = strings.TrimSpace(e.Message)
+	if len(e.Detail) > maxErrorDetail {
+		e.Detail = truncateUTF8(e.Detail, maxErrorDetail) + "\n…"
+	}
+	ev, err := wire.NewEvent("agentError", e)
+	if err != nil {
+		return 0, err
+	}
+	ev.Meta = meta
+	if e.Automatic {
+		ev.AgentToolName = e.Tool
+	} else {
+		ev.AgentToolName = "report_error"
+	}
+	return eb.Publish(ev), nil
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character.
+func truncateUTF8(s string, n int) string {
+	for n > 0 && n < len(s) && s[n]&0xC0 == 0x80 {
+		n--
+	}
+	return s[:n]
+}
+
+// reportToolErrors is middleware that reports a tool call ending in an
+// error result to the chat as an agentError. A call that ended because it
+// was cancelled (a superseded wait, a client that went away) is not a
+// failure, and report_error's own errors are left to its result.
+func reportToolErrors(eb *EventBus) mcp.Middleware {
+	return func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			res, err := next(ctx, method, req)
+			call, ok := req.(*mcp.CallToolRequest)
+			if !ok || call.Params.Name == "report_error" || ctx.Err() != nil {
+				return res, err
+			}
+			var msg string
+			if err != nil {
+				msg = err.Error()
+			} else if r, ok := res.(*mcp.CallToolResult); ok && r.IsError {
+				msg = resultText(r)
+			}
+			if msg == "" || strings.Contains(msg, context.Canceled.Error()) {
+				return res, err
+			}
+			msg = strings.TrimPrefix(msg, "error: ")
+			eb.ClientSession(mcpClientKey(call)).ReportError(AgentError{Message: msg, Tool: call.Params.Name, Automatic: true}, nil)
+			return res, err
+		}
+	}
+}
+
+// resultText joins the text content of a tool result.
+func resultText(r *mcp.CallToolResult) string {
+	var parts []string
+	for _, c := range r.Content {
+		if t, ok := c.(*mcp.TextContent); ok {
+			parts = append(parts, t.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
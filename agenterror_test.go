@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/choonkeat/agent-chat/pkg/wire"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// agentErrors decodes the agentError events in eb's history.
+func agentErrors(t *testing.T, eb *EventBus) []AgentError {
+	t.Helper()
+	history, _ := eb.History()
+	var out []AgentError
+	for _, e := range history {
+		if e.Type != "agentError" {
+			continue
+		}
+		ae, err := wire.DecodeData[AgentError](e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, ae)
+	}
+	return out
+}
+
+func TestReportError(t *testing.T) {
+	eb := NewEventBus()
+	if _, isErr := callTool(t, eb, "report_error", map[string]any{"message": " "}); !isErr {
+		t.Error("reported an error with no message")
+	}
+	text, isErr := callTool(t, eb, "report_error", map[string]any{"message": "go test failed", "tool": "Bash", "detail": strings.Repeat("x", maxErrorDetail+10)})
+	if isErr || !strings.HasPrefix(text, "Error reported.") {
+		t.Fatalf("report_error = %q", text)
+	}
+	errs := agentErrors(t, eb)
+	if len(errs) != 1 || errs[0].Message != "go test failed" || errs[0].Tool != "Bash" || errs[0].Automatic || len(errs[0].Detail) > maxErrorDetail+8 {
+		t.Fatalf("agentError events = %+v", errs)
+	}
+	history, _ := eb.History()
+	if e := history[len(history)-1]; e.Text != "⚠️ **Error** in `Bash`: go test failed" || e.AgentToolName != "report_error" {
+		t.Errorf("agentError event = %+v", e)
+	}
+}
+
+func TestReportToolErrors(t *testing.T) {
+	eb := NewEventBus()
+	server := mcp.NewServer(&mcp.Implementation{Name: "agent-chat", Version: "test"}, nil)
+	registerTools(server, eb)
+	server.AddReceivingMiddleware(reportToolErrors(eb))
+
+	// highlight fails with nothing drawn yet.
+	if _, isErr := callServerTool(t, server, "highlight", map[string]any{}); !isErr {
+		t.Fatal("highlight succeeded with nothing to highlight")
+	}
+	errs := agentErrors(t, eb)
+	if len(errs) != 1 || errs[0].Tool != "highlight" || !errs[0].Automatic || strings.HasPrefix(errs[0].Message, "error:") {
+		t.Fatalf("agentError events = %+v", errs)
+	}
+
+	callServerTool(t, server, "check_messages", map[string]any{})
+	callServerTool(t, server, "report_error", map[string]any{"message": ""})
+	if errs := agentErrors(t, eb); len(errs) != 1 {
+		t.Errorf("a successful call or report_error's own failure was reported: %+v", errs)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// For instances exposed beyond localhost: -max-conns-per-ip caps how many
+// WebSocket connections one address may hold open at once (0, the default,
+// leaves them unlimited), and -audit-log appends one JSON line per security-
+// relevant request — connects, disconnects, uploads, message posts, auth
+// failures and refused connections — to a file that is only ever appended
+// to. Message text is not logged, only its length.
+
+// maxConnsPerIP is the -max-conns-per-ip serve flag.
+var maxConnsPerIP int
+
+// audit is the -audit-log; nil when off.
+var audit *auditLog
+
+// auditRecord is one line of the audit log.
+type auditRecord struct {
+	Time   string `json:"time"` // RFC 3339, UTC
+	Event  string `json:"event"`
+	IP     string `json:"ip,omitempty"`
+	Client string `json:"client,omitempty"` // the browser's persistent id
+	Path   string `json:"path,omitempty"`
+	Detail string `json:"detail,omitempty"`
+	Bytes  int64  `json:"bytes,omitempty"`
+	Files  int    `json:"files,omitempty"`
+}
+
+// auditLog appends records to a file.
+type auditLog struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// openAuditLog opens path for appending, creating it private to this user.
+func openAuditLog(path string) (*auditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{f: f}, nil
+}
+
+// Record appends rec, stamped now and with r's address and path.
+func (a *auditLog) Record(r *http.Request, rec auditRecord) {
+	if a == nil {
+		return
+	}
+	rec.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	if r != nil {
+		rec.IP = clientIP(r)
+		if rec.Path == "" {
+			rec.Path = r.URL.Path
+		}
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.f.Write(append(line, '\n'))
+}
+
+// auditUpload records the files an upload saved.
+func auditUpload(r *http.Request, refs []FileRef) {
+	if audit == nil {
+		return
+	}
+	var size int64
+	names := make([]string, len(refs))
+	for i, ref := range refs {
+		size += ref.Size
+		names[i] = ref.Name
+	}
+	audit.Record(r, auditRecord{Event: "upload", Bytes: size, Files: len(refs), Detail: strings.Join(names, ", ")})
+}
+
+// clientIP is the address r came from. When r came through a
+// -trusted-proxy or a proxy on this machine (a -tunnel), that is the
+// X-Forwarded-For hop appended by the nearest proxy not to be trusted:
+// hops are read right to left, past loopback and -trusted-proxy addresses,
+// because everything left of that is written by the client itself.
+// Otherwise it is the peer's own address.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "local" // a Unix socket peer
+	}
+	if ip := net.ParseIP(host); ip == nil || !(ip.IsLoopback() || fromTrustedProxy(r)) {
+		return host
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		addr, err := netip.ParseAddr(hop)
+		if err != nil {
+			return host // not an address a proxy would write
+		}
+		if !addr.IsLoopback() && !isTrustedProxy(addr) {
+			return addr.Unmap().String()
+		}
+		host = addr.Unmap().String() // all trusted so far: the leftmost one stands
+	}
+	return host
+}
+
+// connLimiter counts open WebSocket connections per address.
+type connLimiter struct {
+	mu   sync.Mutex
+	open map[string]int
+}
+
+var wsConns = &connLimiter{open: map[string]int{}}
+
+// acquire takes a connection slot for ip, or reports false when ip already
+// holds max (0: no limit).
+func (l *connLimiter) acquire(ip string, max int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if max > 0 && l.open[ip] >= max {
+		return false
+	}
+	l.open[ip]++
+	return true
+}
+
+// release gives back a slot acquire took.
+func (l *connLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.open[ip]--; l.open[ip] <= 0 {
+		delete(l.open, ip)
+	}
+}
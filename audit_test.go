@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	saved := trustedProxies
+	t.Cleanup(func() { trustedProxies = saved })
+	trustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	cases := []struct {
+		remote, forwarded, want string
+	}{
+		{"192.168.1.9:5000", "", "192.168.1.9"},
+		{"192.168.1.9:5000", "203.0.113.7", "192.168.1.9"}, // not a proxy: the header is ignored
+		{"10.1.2.3:5000", "203.0.113.7, 10.1.2.3", "203.0.113.7"},
+		{"127.0.0.1:5000", "198.51.100.4", "198.51.100.4"}, // a tunnel on this machine
+		// The client writes whatever it likes on the left; the proxy appends the real peer.
+		{"10.1.2.3:5000", "1.2.3.4, 203.0.113.7", "203.0.113.7"},
+		{"127.0.0.1:5000", "1.2.3.4, 198.51.100.4", "198.51.100.4"},
+		{"10.1.2.3:5000", "1.2.3.4, 203.0.113.7, 10.9.9.9", "203.0.113.7"}, // two proxies deep
+		{"10.1.2.3:5000", "10.9.9.9", "10.9.9.9"},                          // only proxies
+		{"10.1.2.3:5000", "1.2.3.4, not-an-ip", "10.1.2.3"},
+		{"@", "", "local"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/ws", nil)
+		r.RemoteAddr = c.remote
+		if c.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", c.forwarded)
+		}
+		if got := clientIP(r); got != c.want {
+			t.Errorf("clientIP(%s, %q) = %q, want %q", c.remote, c.forwarded, got, c.want)
+		}
+	}
+}
+
+func TestConnLimiter(t *testing.T) {
+	l := &connLimiter{open: map[string]int{}}
+	if !l.acquire("a", 2) || !l.acquire("a", 2) || l.acquire("a", 2) {
+		t.Fatal("want two slots for a, then a refusal")
+	}
+	if !l.acquire("b", 2) {
+		t.Error("b refused because of a")
+	}
+	l.release("a")
+	if !l.acquire("a", 2) {
+		t.Error("released slot not reusable")
+	}
+	for i := 0; i < 10; i++ {
+		if !l.acquire("c", 0) {
+			t.Fatal("max 0 should be unlimited")
+		}
+	}
+}
+
+func TestWebSocketConnLimitAudited(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	a, err := openAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedAudit, savedMax := audit, maxConnsPerIP
+	t.Cleanup(func() { audit, maxConnsPerIP = savedAudit, savedMax; a.f.Close() })
+	audit, maxConnsPerIP = a, 1
+
+	wsConns.acquire("192.168.1.9", 1)
+	defer wsConns.release("192.168.1.9")
+	r := httptest.NewRequest("GET", "/ws?client=tab-1", nil)
+	r.RemoteAddr, r.Host = "192.168.1.9:5000", "192.168.1.20:4321"
+	w := httptest.NewRecorder()
+	handleWebSocket(w, r)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second connection: %d, want 429", w.Code)
+	}
+	auditUpload(r, []FileRef{{Name: "a.png", Size: 10}, {Name: "b.txt", Size: 5}})
+
+	f, _ := os.Open(path)
+	defer f.Close()
+	var recs []auditRecord
+	for sc := bufio.NewScanner(f); sc.Scan(); {
+		var rec auditRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("bad line %q: %v", sc.Text(), err)
+		}
+		recs = append(recs, rec)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("got %d records, want 2: %+v", len(recs), recs)
+	}
+	if r := recs[0]; r.Event != "connRefused" || r.IP != "192.168.1.9" || r.Client != "tab-1" || r.Path != "/ws" || r.Time == "" {
+		t.Errorf("refusal record: %+v", r)
+	}
+	if r := recs[1]; r.Event != "upload" || r.Bytes != 15 || r.Files != 2 || r.Detail != "a.png, b.txt" {
+		t.Errorf("upload record: %+v", r)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Errorf("audit log mode %v, want 0600", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// branding is the operator's customization of the page (-title,
+// -accent-color, -logo), so a team can embed the chat in its own workflow
+// under its own name and colors. The zero value is the stock look.
+type branding struct {
+	Title  string // page title and header label; "" keeps "Agent Chat"
+	Accent string // CSS color for user bubbles, the send button and highlights
+	Logo   string // image file served at /branding/logo and shown in the header
+}
+
+// pageBranding is set from the serve flags before the HTTP server starts.
+var pageBranding branding
+
+// validate normalizes the flags and fails early on a color that could break
+// out of the injected style rule or a logo that is not a readable file.
+func (b *branding) validate() error {
+	if b.Accent != "" && !agentColorRe.MatchString(b.Accent) {
+		return fmt.Errorf("-accent-color %q is not a hex color (#rrggbb) or CSS color name", b.Accent)
+	}
+	if b.Logo != "" {
+		abs, err := filepath.Abs(b.Logo)
+		if err != nil {
+			return err
+		}
+		fi, err := os.Stat(abs)
+		if err != nil {
+			return fmt.Errorf("-logo: %w", err)
+		}
+		if !fi.Mode().IsRegular() {
+			return fmt.Errorf("-logo %s is not a file", abs)
+		}
+		b.Logo = abs
+	}
+	return nil
+}
+
+// pageTitle is the <title> text.
+func (b branding) pageTitle() string {
+	if b.Title != "" {
+		return b.Title
+	}
+	return "Agent Chat"
+}
+
+// logoURL is where the page loads the logo from ("" without one). Relative,
+// like the page's other assets, so it resolves under a reverse-proxy prefix.
+func (b branding) logoURL() string {
+	if b.Logo == "" {
+		return ""
+	}
+	return "./branding/logo"
+}
+
+// headHTML is injected before </head>: the accent color override and the
+// logo as favicon.
+func (b branding) headHTML() string {
+	out := ""
+	if b.Accent != "" {
+		out += fmt.Sprintf("<style>:root{--accent:%s}</style>\n", b.Accent)
+	}
+	if b.Logo != "" {
+		out += fmt.Sprintf("<link rel=\"icon\" href=\"%s\" />\n", html.EscapeString(b.logoURL()))
+	}
+	return out
+}
+
+// handleLogo serves GET /branding/logo: the -logo file, or 404 without one.
+func handleLogo(w http.ResponseWriter, r *http.Request) {
+	if pageBranding.Logo == "" {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFile(w, r, pageBranding.Logo)
+}
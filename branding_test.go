@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBrandingValidate(t *testing.T) {
+	dir := t.TempDir()
+	logo := filepath.Join(dir, "logo.svg")
+	if err := os.WriteFile(logo, []byte(`<svg xmlns="http://www.w3.org/2000/svg"/>`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range []branding{
+		{Accent: "red;}body{display:none"},
+		{Logo: filepath.Join(dir, "missing.png")},
+		{Logo: dir},
+	} {
+		if err := b.validate(); err == nil {
+			t.Errorf("%+v accepted", b)
+		}
+	}
+
+	b := branding{Title: "Acme Ops", Accent: "#0a7", Logo: logo}
+	if err := b.validate(); err != nil {
+		t.Fatal(err)
+	}
+	head := b.headHTML()
+	if !strings.Contains(head, "<style>:root{--accent:#0a7}</style>") || !strings.Contains(head, `<link rel="icon" href="./branding/logo" />`) {
+		t.Errorf("headHTML = %q", head)
+	}
+	if b.pageTitle() != "Acme Ops" || (branding{}).pageTitle() != "Agent Chat" {
+		t.Error("pageTitle does not default to Agent Chat")
+	}
+	if (branding{}).headHTML() != "" || (branding{}).logoURL() != "" {
+		t.Error("stock branding injects markup")
+	}
+}
+
+func TestHandleLogo(t *testing.T) {
+	old := pageBranding
+	t.Cleanup(func() { pageBranding = old })
+
+	pageBranding = branding{}
+	rec := httptest.NewRecorder()
+	handleLogo(rec, httptest.NewRequest(http.MethodGet, "/branding/logo", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("no logo: status %d", rec.Code)
+	}
+
+	logo := filepath.Join(t.TempDir(), "logo.svg")
+	os.WriteFile(logo, []byte(`<svg xmlns="http://www.w3.org/2000/svg"/>`), 0644)
+	pageBranding = branding{Logo: logo}
+	rec = httptest.NewRecorder()
+	handleLogo(rec, httptest.NewRequest(http.MethodGet, "/branding/logo", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "image/svg+xml") {
+		t.Errorf("logo: status %d, type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// browserCmd is the -browser serve flag: the command that opens the chat,
+// with any arguments it needs before the URL (e.g. `firefox -P work` or
+// `google-chrome --profile-directory=Work`). Empty uses the platform's
+// default browser.
+var browserCmd string
+
+// appWindow is the -app-window serve flag: open the chat as a chromeless
+// app window (Chromium's --app=URL) rather than a tab, when a Chromium-based
+// browser is available.
+var appWindow bool
+
+// chromiumBrowsers are tried, in order, for -app-window without -browser.
+var chromiumBrowsers = []string{"google-chrome", "google-chrome-stable", "chromium", "chromium-browser", "microsoft-edge", "brave-browser"}
+
+// macChromiumApps are the macOS equivalents, opened by application name.
+var macChromiumApps = []string{"Google Chrome", "Chromium", "Microsoft Edge", "Brave Browser"}
+
+// browserEnv is what browserCommand needs to know about the machine.
+type browserEnv struct {
+	goos     string
+	wsl      bool                         // Linux under Windows Subsystem for Linux
+	lookPath func(string) (string, error) // exec.LookPath
+	macApp   func(name string) bool       // a macOS application is installed
+}
+
+func currentBrowserEnv() browserEnv {
+	return browserEnv{goos: runtime.GOOS, wsl: isWSL(), lookPath: exec.LookPath, macApp: macAppInstalled}
+}
+
+// isWSL reports whether this Linux runs under WSL, where xdg-open usually
+// has no browser to hand the URL to but Windows does.
+func isWSL() bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	if os.Getenv("WSL_DISTRO_NAME") != "" {
+		return true
+	}
+	data, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	return err == nil && strings.Contains(strings.ToLower(string(data)), "microsoft")
+}
+
+func macAppInstalled(name string) bool {
+	for _, dir := range []string{"/Applications", os.ExpandEnv("$HOME/Applications")} {
+		if _, err := os.Stat(dir + "/" + name + ".app"); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// browserCommand returns the command line that opens url: -browser's
+// command when set, else a Chromium app window for -app-window when one is
+// found, else the platform's opener — open on macOS, the URL handler on
+// Windows and WSL, xdg-open on Linux and the BSDs.
+func browserCommand(env browserEnv, browser string, app bool, url string) []string {
+	target := url
+	if app {
+		target = "--app=" + url
+	}
+	if fields := strings.Fields(browser); len(fields) > 0 {
+		if env.goos == "darwin" && env.macApp != nil && env.macApp(browser) {
+			return []string{"open", "-na", browser, "--args", target} // e.g. -browser "Google Chrome"
+		}
+		return append(fields, target)
+	}
+	if app {
+		if env.goos == "darwin" {
+			for _, name := range macChromiumApps {
+				if env.macApp != nil && env.macApp(name) {
+					return []string{"open", "-na", name, "--args", target}
+				}
+			}
+		} else if env.goos == "windows" {
+			// Edge ships with Windows; cmd needs the URL's & escaped.
+			return []string{"cmd", "/c", "start", "", "msedge", strings.ReplaceAll(target, "&", "^&")}
+		} else {
+			for _, name := range chromiumBrowsers {
+				if _, err := env.lookPath(name); err == nil {
+					return []string{name, target}
+				}
+			}
+		}
+	}
+	switch {
+	case env.goos == "darwin":
+		return []string{"open", url}
+	case env.goos == "windows":
+		// Not `cmd /c start`: cmd would split the URL at every &.
+		return []string{"rundll32", "url.dll,FileProtocolHandler", url}
+	case env.wsl:
+		if _, err := env.lookPath("wslview"); err == nil {
+			return []string{"wslview", url}
+		}
+		return []string{"cmd.exe", "/c", "start", "", strings.ReplaceAll(url, "&", "^&")}
+	default:
+		return []string{"xdg-open", url}
+	}
+}
+
+// openBrowser opens url per -browser and -app-window, unless -no-browser.
+// A command that is missing or fails is reported on stderr rather than
+// leaving the user waiting for a window that will never appear.
+func openBrowser(url string) {
+	if noBrowser {
+		return
+	}
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return // e.g. a Unix socket: nothing a browser can open
+	}
+	argv := browserCommand(currentBrowserEnv(), browserCmd, appWindow, url)
+	cmd := exec.Command(argv[0], argv[1:]...)
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not open a browser (%v); open %s yourself, or set -browser.\n", err, url)
+		return
+	}
+	started := time.Now()
+	go func() {
+		// Openers exit at once; a browser run directly exits when closed,
+		// which is no failure worth reporting.
+		if err := cmd.Wait(); err != nil && time.Since(started) < 10*time.Second {
+			fmt.Fprintf(os.Stderr, "Opening a browser with %s failed (%v); open %s yourself, or set -browser.\n", argv[0], err, url)
+		}
+	}()
+}
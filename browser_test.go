@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestBrowserCommand(t *testing.T) {
+	const url = "http://localhost:4000/?a=1&b=2"
+	has := func(names ...string) func(string) (string, error) {
+		return func(name string) (string, error) {
+			if slices.Contains(names, name) {
+				return "/usr/bin/" + name, nil
+			}
+			return "", errors.New("not found")
+		}
+	}
+	macApps := func(names ...string) func(string) bool {
+		return func(name string) bool { return slices.Contains(names, name) }
+	}
+	tests := []struct {
+		name    string
+		env     browserEnv
+		browser string
+		app     bool
+		want    string
+	}{
+		{"linux", browserEnv{goos: "linux", lookPath: has()}, "", false, "xdg-open " + url},
+		{"freebsd", browserEnv{goos: "freebsd", lookPath: has()}, "", false, "xdg-open " + url},
+		{"darwin", browserEnv{goos: "darwin", macApp: macApps()}, "", false, "open " + url},
+		{"windows", browserEnv{goos: "windows"}, "", false, "rundll32 url.dll,FileProtocolHandler " + url},
+		{"wsl with wslview", browserEnv{goos: "linux", wsl: true, lookPath: has("wslview")}, "", false, "wslview " + url},
+		{"wsl", browserEnv{goos: "linux", wsl: true, lookPath: has()}, "", false, "cmd.exe /c start  http://localhost:4000/?a=1^&b=2"},
+		{"profile", browserEnv{goos: "linux", lookPath: has()}, "firefox -P work", false, "firefox -P work " + url},
+		{"app window", browserEnv{goos: "linux", lookPath: has("chromium")}, "", true, "chromium --app=" + url},
+		{"app window, no chromium", browserEnv{goos: "linux", lookPath: has()}, "", true, "xdg-open " + url},
+		{"app window with -browser", browserEnv{goos: "linux", lookPath: has()}, "brave-browser --incognito", true, "brave-browser --incognito --app=" + url},
+		{"mac app window", browserEnv{goos: "darwin", macApp: macApps("Microsoft Edge")}, "", true, "open -na Microsoft Edge --args --app=" + url},
+		{"mac app by name", browserEnv{goos: "darwin", macApp: macApps("Google Chrome")}, "Google Chrome", false, "open -na Google Chrome --args " + url},
+		{"windows app window", browserEnv{goos: "windows"}, "", true, "cmd /c start  msedge --app=http://localhost:4000/?a=1^&b=2"},
+	}
+	for _, tt := range tests {
+		got := strings.Join(browserCommand(tt.env, tt.browser, tt.app, url), " ")
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
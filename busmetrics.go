@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Bus diagnostics. Publish never blocks on a slow subscriber: when a
+// subscriber's buffer is full the event is skipped for it. That keeps one
+// stuck tab from stalling the agent, but a tab that misses events used to
+// leave no trace. These counters make it visible on /metrics (Prometheus
+// text) and GET /api/debug/bus (JSON, per subscriber).
+
+// subscriberStats is what Publish has done for one subscriber. Guarded by
+// eventHub.mu.
+type subscriberStats struct {
+	since     time.Time
+	delivered int64
+	dropped   int64
+	resent    int64         // dropped events its reader sent on from the log (see Missed)
+	acked     int64         // highest seq the browser tab confirmed (see Acked)
+	lag       chan struct{} // signalled on a drop (see Lagged)
+	info      *ClientInfo   // what the browser tab reported about itself (see SetClientInfo)
+	features  []string      // what it declared it renders; nil if nothing (see SetFeatures)
+}
+
+func newSubscriberStats() *subscriberStats {
+	return &subscriberStats{since: time.Now(), lag: make(chan struct{}, 1)}
+}
+
+// busCounters totals Publish's work. publishTime covers the locked part of
+// Publish (log append, indexing, fan-out), not the disk write. Guarded by
+// eventHub.mu.
+type busCounters struct {
+	published   int64
+	dropped     int64
+	resent      int64
+	publishTime time.Duration
+	publishMax  time.Duration
+}
+
+func (c *busCounters) observe(d time.Duration) {
+	c.published++
+	c.publishTime += d
+	c.publishMax = max(c.publishMax, d)
+}
+
+// droppedLocked counts an event skipped because ch's buffer was full,
+// logging the first drop per subscriber. Caller holds mu for writing.
+func (h *eventHub) droppedLocked(ch chan Event, st *subscriberStats) {
+	st.dropped++
+	h.metrics.dropped++
+	select {
+	case st.lag <- struct{}{}:
+	default:
+	}
+	if st.dropped == 1 {
+		log.Printf("agent-chat: %s subscriber is not keeping up (%d events buffered); dropping events for it", h.subscriberKindLocked(ch), len(ch))
+	}
+}
+
+func (h *eventHub) subscriberKindLocked(ch chan Event) string {
+	if _, ok := h.observers[ch]; ok {
+		return "observer"
+	}
+	return "viewer"
+}
+
+// busMetrics is GET /api/debug/bus.
+type busMetrics struct {
+	Events           int                 `json:"events"` // events in the in-memory history
+	LastSeq          int64               `json:"last_seq"`
+	Published        int64               `json:"published"`         // events published since start
+	Dropped          int64               `json:"dropped"`           // deliveries skipped on a full subscriber buffer
+	Resent           int64               `json:"resent"`            // skipped deliveries made up from the log
+	TransientDropped int64               `json:"transient_dropped"` // transient payloads (presence, liveness, ...) skipped likewise
+	PublishAvgMicros int64               `json:"publish_avg_us"`
+	PublishMaxMicros int64               `json:"publish_max_us"`
+	Subscribers      []subscriberMetrics `json:"subscribers"` // oldest first
+}
+
+// subscriberMetrics is one subscriber in busMetrics.
+type subscriberMetrics struct {
+	Kind      string `json:"kind"`             // "viewer" (a browser tab) or "observer" (server-side)
+	Device    string `json:"device,omitempty"` // viewer's device hint
+	Since     int64  `json:"since"`            // Unix milliseconds it subscribed
+	Queued    int    `json:"queued"`           // events buffered, not yet read
+	Capacity  int    `json:"capacity"`
+	Delivered int64  `json:"delivered"`
+	Dropped   int64  `json:"dropped"`
+	Resent    int64  `json:"resent"`
+	Acked     int64  `json:"acked,omitempty"` // highest seq a viewer confirmed rendering
+}
+
+// BusMetrics snapshots the bus counters.
+func (eb *EventBus) BusMetrics() busMetrics {
+	eb.mu.RLock()
+	m := busMetrics{
+		Events:           len(eb.eventLog),
+		LastSeq:          eb.nextSeq,
+		Published:        eb.metrics.published,
+		Dropped:          eb.metrics.dropped,
+		Resent:           eb.metrics.resent,
+		PublishMaxMicros: eb.metrics.publishMax.Microseconds(),
+		Subscribers:      []subscriberMetrics{},
+	}
+	if eb.metrics.published > 0 {
+		m.PublishAvgMicros = (eb.metrics.publishTime / time.Duration(eb.metrics.published)).Microseconds()
+	}
+	for ch, st := range eb.subscribers {
+		m.Subscribers = append(m.Subscribers, subscriberMetrics{
+			Kind:      eb.subscriberKindLocked(ch),
+			Device:    eb.viewers[ch],
+			Since:     st.since.UnixMilli(),
+			Queued:    len(ch),
+			Capacity:  cap(ch),
+			Delivered: st.delivered,
+			Dropped:   st.dropped,
+			Resent:    st.resent,
+			Acked:     st.acked,
+		})
+	}
+	eb.mu.RUnlock()
+	m.TransientDropped = eb.transientDropped.Load()
+	sort.Slice(m.Subscribers, func(i, j int) bool { return m.Subscribers[i].Since < m.Subscribers[j].Since })
+	return m
+}
+
+// handleBusDebug serves GET /api/debug/bus.
+func handleBusDebug(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bus.BusMetrics())
+}
+
+// handleMetrics serves GET /metrics in the Prometheus text format.
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	m := bus.BusMetrics()
+	kinds := map[string]int{"viewer": 0, "observer": 0}
+	queued := 0
+	for _, s := range m.Subscribers {
+		kinds[s.Kind]++
+		queued = max(queued, s.Queued)
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metric := func(name, typ, help string, value any) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, typ, name, value)
+	}
+	metric("agentchat_bus_history_events", "gauge", "Events in the in-memory history.", m.Events)
+	metric("agentchat_bus_published_total", "counter", "Events published.", m.Published)
+	metric("agentchat_bus_dropped_total", "counter", "Event deliveries skipped because a subscriber's buffer was full.", m.Dropped)
+	metric("agentchat_bus_resent_total", "counter", "Skipped event deliveries made up from the history.", m.Resent)
+	metric("agentchat_bus_transient_dropped_total", "counter", "Transient payloads skipped because a sink was full.", m.TransientDropped)
+	metric("agentchat_bus_publish_max_seconds", "gauge", "Slowest publish fan-out since start.", float64(m.PublishMaxMicros)/1e6)
+	metric("agentchat_bus_subscriber_queue_max", "gauge", "Deepest subscriber buffer right now.", queued)
+	fmt.Fprintf(w, "# HELP agentchat_bus_subscribers Connected subscribers.\n# TYPE agentchat_bus_subscribers gauge\n")
+	for _, k := range []string{"observer", "viewer"} {
+		fmt.Fprintf(w, "agentchat_bus_subscribers{kind=%q} %d\n", k, kinds[k])
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBusMetricsCountsDrops(t *testing.T) {
+	eb := NewEventBus()
+	stuck := eb.SubscribeViewer("mobile") // never read: its buffer fills up
+	defer eb.Unsubscribe(stuck)
+	reader := eb.Observe()
+	defer eb.Unsubscribe(reader)
+
+	n := cap(stuck) + 6
+	for i := 0; i < n; i++ {
+		eb.Publish(Event{Type: "agentMessage", Text: "hi"})
+		<-reader
+	}
+
+	m := eb.BusMetrics()
+	if m.Events != n || m.Published != int64(n) || m.Dropped != 6 {
+		t.Errorf("events %d, published %d, dropped %d; want %d, %d, 6", m.Events, m.Published, m.Dropped, n, n)
+	}
+	if len(m.Subscribers) != 2 {
+		t.Fatalf("subscribers = %+v", m.Subscribers)
+	}
+	for _, s := range m.Subscribers {
+		switch s.Kind {
+		case "viewer":
+			if s.Device != "mobile" || s.Queued != cap(stuck) || s.Delivered != int64(cap(stuck)) || s.Dropped != 6 {
+				t.Errorf("stuck viewer = %+v", s)
+			}
+		case "observer":
+			if s.Queued != 0 || s.Delivered != int64(n) || s.Dropped != 0 {
+				t.Errorf("observer = %+v", s)
+			}
+		}
+	}
+}
+
+func TestMetricsEndpoints(t *testing.T) {
+	orig := bus
+	bus = NewEventBus()
+	t.Cleanup(func() { bus = orig })
+	bus.Publish(Event{Type: "agentMessage", Text: "hi"})
+
+	rec := httptest.NewRecorder()
+	handleMetrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{"agentchat_bus_published_total 1\n", "agentchat_bus_dropped_total 0\n", `agentchat_bus_subscribers{kind="viewer"} 0`} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("/metrics lacks %q:\n%s", want, rec.Body)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	handleBusDebug(rec, httptest.NewRequest(http.MethodGet, "/api/debug/bus", nil))
+	var m busMetrics
+	if err := json.Unmarshal(rec.Body.Bytes(), &m); err != nil || m.Events != 1 || m.LastSeq != 1 {
+		t.Errorf("/api/debug/bus = %s (%v)", rec.Body, err)
+	}
+}
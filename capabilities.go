@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Browser tabs declare what they can render with ?features= on /ws (a
+// comma-separated list, e.g. "draw,countdown,location"), so tools can tell
+// when a chat is open only in an older page and fall back to something it
+// shows: a drawing becomes an image, a countdown states its deadline in the
+// text. get_status reports how many tabs have each feature.
+
+// legacyFeatures are what a tab that declares nothing is assumed to render:
+// everything pages had before tabs declared features.
+var legacyFeatures = []string{"draw", "files", "quickReplies", "verbalReply"}
+
+const (
+	maxFeatures      = 64
+	maxFeatureLength = 32
+)
+
+// parseFeatures reads a ?features= list: names of letters, digits, '-' and
+// '_', sorted and deduped. An absent list gives nil (nothing declared); a
+// present but empty one gives an empty, non-nil slice.
+func parseFeatures(s string, present bool) []string {
+	if !present {
+		return nil
+	}
+	seen := map[string]bool{}
+	features := []string{}
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" || len(f) > maxFeatureLength || seen[f] || len(features) == maxFeatures {
+			continue
+		}
+		if strings.IndexFunc(f, func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_')
+		}) >= 0 {
+			continue
+		}
+		seen[f] = true
+		features = append(features, f)
+	}
+	sort.Strings(features)
+	return features
+}
+
+// SetFeatures records the features the tab reading subscriber ch declared;
+// nil means it declared none. They are forgotten when the tab disconnects.
+func (eb *EventBus) SetFeatures(ch chan Event, features []string) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	if st, ok := eb.subscribers[ch]; ok {
+		st.features = features
+	}
+}
+
+// featuresLocked is what the tab reading ch renders, and whether it said so
+// itself. Caller holds eb.mu.
+func (eb *EventBus) featuresLocked(ch chan Event) ([]string, bool) {
+	st := eb.subscribers[ch]
+	if st == nil || st.features == nil {
+		return legacyFeatures, false
+	}
+	return st.features, true
+}
+
+// FeatureSupport counts the connected tabs able to render each feature, and
+// the tabs that declared nothing (counted with legacyFeatures).
+func (eb *EventBus) FeatureSupport() (counts map[string]int, legacy int) {
+	eb.mu.RLock()
+	defer eb.mu.RUnlock()
+	counts = map[string]int{}
+	for ch := range eb.viewers {
+		features, declared := eb.featuresLocked(ch)
+		if !declared {
+			legacy++
+		}
+		for _, f := range features {
+			counts[f]++
+		}
+	}
+	return counts, legacy
+}
+
+// ViewersSupport reports whether some connected tab renders feature, or no
+// tab is connected (so there is nobody to fall back for).
+func (eb *EventBus) ViewersSupport(feature string) bool {
+	eb.mu.RLock()
+	defer eb.mu.RUnlock()
+	if len(eb.viewers) == 0 {
+		return true
+	}
+	for ch := range eb.viewers {
+		features, _ := eb.featuresLocked(ch)
+		for _, f := range features {
+			if f == feature {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// drawImage renders a drawing as an SVG upload, for tabs that cannot draw.
+func drawImage(instructions []any) (FileRef, error) {
+	svg := renderDrawSVG(instructions)
+	name := uuid.New().String()[:8] + "-drawing.svg"
+	path := filepath.Join(uploadDir, name)
+	if err := os.WriteFile(path, []byte(svg), 0o644); err != nil {
+		return FileRef{}, err
+	}
+	return FileRef{Name: "drawing.svg", Path: path, URL: "/uploads/" + name, Size: int64(len(svg)), Type: "image/svg+xml"}, nil
+}
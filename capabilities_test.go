@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFeatures(t *testing.T) {
+	if got := parseFeatures("", false); got != nil {
+		t.Errorf("absent: %v, want nil", got)
+	}
+	if got := parseFeatures("", true); got == nil || len(got) != 0 {
+		t.Errorf("empty: %#v, want an empty list", got)
+	}
+	got := parseFeatures(" location,draw,,draw,<script>,"+strings.Repeat("x", 40)+",count_down", true)
+	if want := []string{"count_down", "draw", "location"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFeatureSupport(t *testing.T) {
+	eb := NewEventBus()
+	if !eb.ViewersSupport("location") {
+		t.Error("no tabs: want nothing to fall back for")
+	}
+	modern := eb.SubscribeViewer("desktop")
+	eb.SetFeatures(modern, []string{"countdown", "draw", "location"})
+	legacy := eb.SubscribeViewer("mobile")
+	bot := eb.SubscribeViewer("")
+	eb.SetFeatures(bot, []string{})
+
+	st := eb.Status()
+	if st.LegacyViewers != 1 || st.Features["draw"] != 2 || st.Features["location"] != 1 || st.Features["files"] != 1 {
+		t.Errorf("status features = %v, legacy %d", st.Features, st.LegacyViewers)
+	}
+	if !eb.ViewersSupport("location") || !eb.ViewersSupport("verbalReply") {
+		t.Error("want location and verbalReply supported by some tab")
+	}
+	eb.Unsubscribe(modern)
+	if eb.ViewersSupport("location") || eb.ViewersSupport("countdown") {
+		t.Error("want no location or countdown once the modern tab leaves")
+	}
+	declared := 0
+	for _, info := range eb.ClientInfos() {
+		if info.Features != nil {
+			declared++
+		}
+	}
+	if declared != 1 {
+		t.Errorf("%d tabs report declared features, want 1", declared)
+	}
+	eb.Unsubscribe(legacy)
+	eb.Unsubscribe(bot)
+}
+
+func TestToolsFallBackForOlderPages(t *testing.T) {
+	origDir := uploadDir
+	uploadDir = t.TempDir()
+	httpMu.Lock()
+	origRunning, origURL := httpRunning, uiURL
+	httpRunning, uiURL = true, ""
+	httpMu.Unlock()
+	t.Cleanup(func() {
+		uploadDir = origDir
+		httpMu.Lock()
+		httpRunning, uiURL = origRunning, origURL
+		httpMu.Unlock()
+	})
+
+	eb := NewEventBus()
+	sub := eb.SubscribeViewer("desktop")
+	defer eb.Unsubscribe(sub)
+	eb.SetFeatures(sub, []string{"files", "quickReplies"})
+
+	// A queued message makes draw return without waiting for a click.
+	eb.PushMessage("looks good", nil)
+	got, _ := callTool(t, eb, "draw", map[string]any{
+		"text":              "The flow",
+		"instructions":      []any{map[string]any{"type": "drawRect", "x": 10, "y": 10, "width": 50, "height": 20}},
+		"first_quick_reply": "Continue",
+	})
+	if !strings.Contains(got, "Shown as an image") {
+		t.Errorf("draw result = %q", got)
+	}
+	events, _ := eb.History()
+	var last Event
+	for _, e := range events {
+		if e.Type == "agentMessage" || e.Type == "draw" {
+			last = e
+		}
+	}
+	if last.Type != "agentMessage" || len(last.Instructions) != 0 || len(last.Files) != 1 || last.Files[0].Type != "image/svg+xml" {
+		t.Fatalf("last event = %+v", last)
+	}
+	if data, err := os.ReadFile(last.Files[0].Path); err != nil || !strings.Contains(string(data), "<rect") {
+		t.Errorf("drawing image: %v, %.80s", err, data)
+	}
+
+	got, _ = callTool(t, eb, "request_location", map[string]any{"reason": "Weather"})
+	if !strings.Contains(got, "No open chat tab can share a location") {
+		t.Errorf("request_location result = %q", got)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
 )
 
 // PermissionRequest represents a pending permission prompt from Claude Code.
@@ -32,16 +33,19 @@ type channelInterceptor struct {
 	pendingPermission *PermissionRequest // currently displayed permission prompt
 	savedQuickReplies []string           // agent's quick replies saved before permission override
 
+	policy permissionPolicy // which prompts are relayed, and for how long
+
 	bus *EventBus
 }
 
 // newChannelInterceptor creates an interceptor that reads from real stdin,
 // handles channel notifications, and forwards everything else through a pipe.
-func newChannelInterceptor(bus *EventBus) *channelInterceptor {
+func newChannelInterceptor(bus *EventBus, policy permissionPolicy) *channelInterceptor {
 	pr, pw := io.Pipe()
 	ci := &channelInterceptor{
 		pipeReader: pr,
 		pipeWriter: pw,
+		policy:     policy,
 		bus:        bus,
 	}
 	go ci.readLoop()
@@ -85,18 +89,30 @@ func (ci *channelInterceptor) readLoop() {
 }
 
 // handlePermissionRequest processes an incoming permission_request notification.
+// Requests the policy does not relay are dropped, leaving Claude Code's
+// terminal dialog to answer them.
 func (ci *channelInterceptor) handlePermissionRequest(params json.RawMessage) {
 	var req PermissionRequest
 	if err := json.Unmarshal(params, &req); err != nil {
 		log.Printf("channel: failed to parse permission_request params: %v", err)
 		return
 	}
+	if !ci.policy.relays(req) {
+		return
+	}
 
 	ci.permMu.Lock()
-	// Save the agent's current quick replies so we can restore them later
-	ci.savedQuickReplies = ci.bus.LastQuickReplies()
+	superseded := ci.pendingPermission
+	if superseded == nil {
+		// Save the agent's current quick replies so we can restore them later
+		// (while a prompt is up, the last quick replies are its Allow/Deny).
+		ci.savedQuickReplies = ci.bus.LastQuickReplies()
+	}
 	ci.pendingPermission = &req
 	ci.permMu.Unlock()
+	if superseded != nil {
+		ci.publishAnswered(superseded, "superseded")
+	}
 
 	// Format a user-friendly description
 	text := fmt.Sprintf("**Permission request** — `%s`", req.ToolName)
@@ -108,18 +124,39 @@ func (ci *channelInterceptor) handlePermissionRequest(params json.RawMessage) {
 	}
 	text += "\n\nReply with **Allow** or **Deny**."
 
-	// If the user is currently in voice mode, publish as verbalReply so the
-	// prompt is spoken aloud (regular agentMessage events are not TTS-ed).
-	eventType := "agentMessage"
-	if ci.bus.LastVoice() {
-		eventType = "verbalReply"
+	// If the user is currently in voice mode, mark the prompt so the page
+	// speaks it aloud (agent messages are otherwise not TTS-ed).
+	e := mustEvent("permissionPrompt", PermissionPrompt{RequestID: req.RequestID, Tool: req.ToolName, Voice: ci.bus.LastVoice()})
+	e.Text, e.QuickReplies = text, []string{"Allow", "Deny"}
+	ci.bus.Publish(e)
+
+	if ci.policy.Timeout > 0 {
+		time.AfterFunc(ci.policy.Timeout, func() { ci.expirePermission(req.RequestID) })
+	}
+}
+
+// expirePermission denies the prompt for requestID if it is still waiting
+// for an answer, says so in the chat, and restores the agent's quick
+// replies. No-op once the prompt was answered or replaced by a newer one.
+func (ci *channelInterceptor) expirePermission(requestID string) {
+	ci.permMu.Lock()
+	perm := ci.pendingPermission
+	if perm == nil || perm.RequestID != requestID {
+		ci.permMu.Unlock()
+		return
 	}
+	ci.pendingPermission = nil
+	saved := ci.savedQuickReplies
+	ci.savedQuickReplies = nil
+	ci.permMu.Unlock()
 
+	ci.sendVerdict(perm.RequestID, "deny")
+	ci.publishAnswered(perm, "expired")
 	ci.bus.Publish(Event{
-		Type:         eventType,
-		Text:         text,
-		QuickReplies: []string{"Allow", "Deny"},
+		Type: "agentMessage",
+		Text: fmt.Sprintf("Permission request for `%s` was not answered within %s and has been **denied**.", perm.ToolName, ci.policy.Timeout),
 	})
+	ci.restoreQuickReplies(saved)
 }
 
 // HandleUserResponse checks if a user message is a response to a pending
@@ -148,6 +185,7 @@ func (ci *channelInterceptor) HandleUserResponse(text string) bool {
 		ci.permMu.Unlock()
 
 		ci.sendVerdict(perm.RequestID, "allow")
+		ci.publishAnswered(perm, "allow")
 		ci.restoreQuickReplies(saved)
 		return true
 
@@ -158,6 +196,7 @@ func (ci *channelInterceptor) HandleUserResponse(text string) bool {
 		ci.permMu.Unlock()
 
 		ci.sendVerdict(perm.RequestID, "deny")
+		ci.publishAnswered(perm, "deny")
 		ci.restoreQuickReplies(saved)
 		return true
 
@@ -169,6 +208,7 @@ func (ci *channelInterceptor) HandleUserResponse(text string) bool {
 		ci.permMu.Unlock()
 
 		ci.sendVerdict(perm.RequestID, "deny")
+		ci.publishAnswered(perm, "deny")
 		ci.restoreQuickReplies(saved)
 		return false
 	}
@@ -277,6 +317,12 @@ func (ci *channelInterceptor) sendVerdict(requestID, behavior string) {
 	os.Stdout.Write(data)
 }
 
+// publishAnswered records how a relayed prompt was settled, so every tab
+// (and a later replay) can mark its card answered.
+func (ci *channelInterceptor) publishAnswered(perm *PermissionRequest, verdict string) {
+	ci.bus.Publish(mustEvent("permissionAnswered", PermissionPrompt{RequestID: perm.RequestID, Tool: perm.ToolName, Verdict: verdict}))
+}
+
 // restoreQuickReplies re-publishes the agent's saved quick replies so the UI
 // shows them again after a permission prompt is resolved.
 func (ci *channelInterceptor) restoreQuickReplies(saved []string) {
@@ -4,13 +4,16 @@ import (
 	"encoding/json"
 	"io"
 	"os"
+	"slices"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/choonkeat/agent-chat/pkg/wire"
 )
 
 // TestHandlePermissionRequest verifies that a permission_request notification
-// is intercepted and published as an agentMessage with Allow/Deny quick replies.
+// is intercepted and published as a permissionPrompt with Allow/Deny quick replies.
 func TestHandlePermissionRequest(t *testing.T) {
 	bus := NewEventBus()
 	defer bus.Close()
@@ -30,8 +33,11 @@ func TestHandlePermissionRequest(t *testing.T) {
 
 	select {
 	case evt := <-sub:
-		if evt.Type != "agentMessage" {
-			t.Fatalf("expected agentMessage, got %s", evt.Type)
+		if evt.Type != "permissionPrompt" {
+			t.Fatalf("expected permissionPrompt, got %s", evt.Type)
+		}
+		if perm, err := wire.DecodeData[PermissionPrompt](evt); err != nil || perm.RequestID != "abcde" || perm.Tool != "Bash" {
+			t.Errorf("permission = %+v, %v", perm, err)
 		}
 		if !strings.Contains(evt.Text, "Bash") {
 			t.Errorf("expected text to contain tool name 'Bash', got %q", evt.Text)
@@ -284,8 +290,8 @@ func TestReadLoopInterceptsPermissionRequest(t *testing.T) {
 	// Verify permission request was intercepted (published as event)
 	select {
 	case evt := <-sub:
-		if evt.Type != "agentMessage" {
-			t.Fatalf("expected agentMessage, got %s", evt.Type)
+		if evt.Type != "permissionPrompt" {
+			t.Fatalf("expected permissionPrompt, got %s", evt.Type)
 		}
 		if !strings.Contains(evt.Text, "Bash") {
 			t.Errorf("expected text to mention Bash, got %q", evt.Text)
@@ -314,3 +320,97 @@ func TestReadLoopInterceptsPermissionRequest(t *testing.T) {
 	stdinW.Close()
 	os.Stdin = origStdin
 }
+
+// TestPermissionRequestExcluded verifies that a request the policy does not
+// relay never reaches the chat.
+func TestPermissionRequestExcluded(t *testing.T) {
+	bus := NewEventBus()
+	defer bus.Close()
+
+	ci := &channelInterceptor{bus: bus, policy: permissionPolicy{Exclude: []permissionRule{{tool: "Read"}}}}
+	params, _ := json.Marshal(PermissionRequest{RequestID: "rrrrr", ToolName: "Read"})
+	ci.handlePermissionRequest(params)
+
+	if ci.HasPendingPermission() {
+		t.Error("excluded request should not be pending")
+	}
+	if history, _ := bus.History(); len(history) != 0 {
+		t.Errorf("excluded request published %+v", history)
+	}
+}
+
+// TestPermissionRequestTimeout verifies that an unanswered prompt is denied
+// once the policy timeout passes, and the agent's quick replies come back.
+func TestPermissionRequestTimeout(t *testing.T) {
+	bus := NewEventBus()
+	defer bus.Close()
+
+	origStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	defer func() { os.Stdout = origStdout }()
+
+	bus.Publish(Event{Type: "agentMessage", Text: "Continue?", QuickReplies: []string{"Yes"}})
+	ci := &channelInterceptor{bus: bus, policy: permissionPolicy{Timeout: 20 * time.Millisecond}}
+	params, _ := json.Marshal(PermissionRequest{RequestID: "ttttt", ToolName: "Bash"})
+	ci.handlePermissionRequest(params)
+
+	// Restoring the quick replies is the expiry's last step.
+	deadline := time.Now().Add(2 * time.Second)
+	for !slices.Equal(bus.LastQuickReplies(), []string{"Yes"}) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if ci.HasPendingPermission() {
+		t.Fatal("prompt still pending after timeout")
+	}
+	w.Close()
+	output, _ := io.ReadAll(r)
+	if !strings.Contains(string(output), `"behavior":"deny"`) || !strings.Contains(string(output), "ttttt") {
+		t.Errorf("expected deny verdict for ttttt, got %q", output)
+	}
+
+	history, _ := bus.History()
+	if len(history) < 2 || !strings.Contains(history[len(history)-2].Text, "denied") {
+		t.Errorf("expected a timeout notice, got %+v", history)
+	}
+	if got := bus.LastQuickReplies(); !slices.Equal(got, []string{"Yes"}) {
+		t.Errorf("quick replies = %v, want restored [Yes]", got)
+	}
+}
+
+// TestPermissionAnsweredEvents verifies that a relayed prompt is marked for
+// the card, and that answering or superseding it is recorded in the log.
+func TestPermissionAnsweredEvents(t *testing.T) {
+	bus := NewEventBus()
+	defer bus.Close()
+
+	origStdout := os.Stdout
+	_, w, _ := os.Pipe()
+	os.Stdout = w
+	defer func() { w.Close(); os.Stdout = origStdout }()
+
+	bus.Publish(Event{Type: "agentMessage", Text: "Continue?", QuickReplies: []string{"Yes"}})
+	ci := &channelInterceptor{bus: bus}
+	for _, id := range []string{"first", "second"} {
+		params, _ := json.Marshal(PermissionRequest{RequestID: id, ToolName: "Bash"})
+		ci.handlePermissionRequest(params)
+	}
+	ci.HandleUserResponse("Allow")
+
+	var got []string
+	history, _ := bus.History()
+	for _, e := range history {
+		perm, err := wire.DecodeData[PermissionPrompt](e)
+		if err != nil {
+			continue
+		}
+		got = append(got, e.Type+":"+perm.RequestID+":"+perm.Verdict)
+	}
+	want := []string{"permissionPrompt:first:", "permissionAnswered:first:superseded", "permissionPrompt:second:", "permissionAnswered:second:allow"}
+	if !slices.Equal(got, want) {
+		t.Errorf("permission events = %v, want %v", got, want)
+	}
+	if got := bus.LastQuickReplies(); !slices.Equal(got, []string{"Yes"}) {
+		t.Errorf("quick replies = %v, want the agent's [Yes] back, not the superseded prompt's", got)
+	}
+}
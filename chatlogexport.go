@@ -35,7 +35,8 @@ type chatExportMeta struct {
 }
 
 // renderChatMarkdown produces script-style markdown for a chat export. Each
-// turn is delimited by a `**USER**` or `**AGENT**` marker on its own line; the
+// turn is delimited by a `**USER**` or `**AGENT**` marker on its own line
+// (`**AGENT · {name}**` / `**USER · {name}**` once the speaker is named); the
 // body follows as a `> ` blockquote. Before each agent turn (except the first)
 // a `<small>took NN.Ns</small><br>` line records the elapsed time since the
 // previous bubble. Quick replies sent with an agent turn are listed as a
@@ -72,6 +73,7 @@ func renderChatMarkdown(events []Event, meta chatExportMeta, imageMap map[string
 		bylineBits = append(bylineBits, "agent-chat "+meta.Version)
 	}
 	fmt.Fprintf(&b, "_%s_\n\n", strings.Join(bylineBits, " · "))
+	b.WriteString(pinsMarkdown(events))
 
 	var st renderState
 	for _, e := range events {
@@ -83,9 +85,12 @@ func renderChatMarkdown(events []Event, meta chatExportMeta, imageMap map[string
 
 // renderState carries the fold state renderChatBubble threads between bubbles:
 // lastTs is the timestamp of the previous rendered bubble, used to emit the
-// `<small>took Ns</small>` elapsed line before an agent turn.
+// `<small>took Ns</small>` elapsed line before an agent turn. drawSVG opts in
+// to rendering draw events as inline SVG (`agent-chat export`); the archive
+// exports leave it off and omit drawings.
 type renderState struct {
-	lastTs int64
+	lastTs  int64
+	drawSVG bool
 }
 
 // renderChatBubble renders a single event as markdown, updating st. Events
@@ -95,14 +100,14 @@ type renderState struct {
 // their events, so their outputs are identical by construction.
 func renderChatBubble(e Event, st *renderState, imageMap map[string]string) string {
 	var b strings.Builder
-	switch e.Type {
+	switch eventKind(e) {
 	case "userMessage":
 		body := strings.TrimSpace(e.Text)
 		imgBlock := imageBlock(e.Files, imageMap)
 		if body == "" && imgBlock == "" {
 			return ""
 		}
-		b.WriteString("**USER**\n\n")
+		b.WriteString("**" + userRole(e) + "**\n\n")
 		if body != "" {
 			b.WriteString(blockquoteText(body))
 			b.WriteString("\n")
@@ -129,7 +134,7 @@ func renderChatBubble(e Event, st *renderState, imageMap map[string]string) stri
 		if st.lastTs > 0 && e.Timestamp > st.lastTs {
 			fmt.Fprintf(&b, "<small>took %s</small><br>\n", formatElapsed(e.Timestamp-st.lastTs))
 		}
-		b.WriteString("**AGENT**\n\n")
+		b.WriteString("**" + agentRole(e) + "**\n\n")
 		if body != "" {
 			b.WriteString(blockquoteText(body))
 			b.WriteString("\n")
@@ -142,6 +147,25 @@ func renderChatBubble(e Event, st *renderState, imageMap map[string]string) stri
 			b.WriteString("\n")
 		}
 		b.WriteString("\n")
+		b.WriteString(metaLine(e.Meta))
+		if qr := quickRepliesBlock(e.QuickReplies); qr != "" {
+			b.WriteString(qr)
+		}
+		if e.Timestamp > 0 {
+			st.lastTs = e.Timestamp
+		}
+	case "dateSeparator":
+		b.WriteString("### " + dayLabel(e.Text) + "\n\n")
+	case "draw":
+		if !st.drawSVG || len(e.Instructions) == 0 {
+			return ""
+		}
+		if st.lastTs > 0 && e.Timestamp > st.lastTs {
+			fmt.Fprintf(&b, "<small>took %s</small><br>\n", formatElapsed(e.Timestamp-st.lastTs))
+		}
+		b.WriteString("**" + agentRole(e) + "**\n\n")
+		b.WriteString("> " + renderDrawSVG(e.Instructions) + "\n\n")
+		b.WriteString(metaLine(e.Meta))
 		if qr := quickRepliesBlock(e.QuickReplies); qr != "" {
 			b.WriteString(qr)
 		}
@@ -152,6 +176,16 @@ func renderChatBubble(e Event, st *renderState, imageMap map[string]string) stri
 	return b.String()
 }
 
+// metaLine renders an agent turn's Meta as a small line under it, or ""
+// when it has none.
+func metaLine(m *ToolMeta) string {
+	labels := metaLabels(m)
+	if len(labels) == 0 {
+		return ""
+	}
+	return "<small>" + html.EscapeString(strings.Join(labels, " · ")) + "</small>\n\n"
+}
+
 // blockquoteText prefixes every line of s with `> `, matching CommonMark
 // blockquote semantics. A line that is already `>`-prefixed nests deeper
 // (e.g. `> foo` becomes `> > foo`), preserving the author's intent.
@@ -211,7 +245,7 @@ func imageBlock(files []FileRef, imageMap map[string]string) string {
 			// this the <a> would shrink to its content and stack 1 per row.
 			imgs = append(imgs, fmt.Sprintf(
 				`<a href="%s" style="flex:0 1 calc(33%% - 8px);max-width:calc(33%% - 8px);"><img src="%s" alt="%s" style="width:100%%;height:auto;display:block;border-radius:6px;"></a>`,
-				rel, rel, html.EscapeString(f.Name)))
+				html.EscapeString(rel), html.EscapeString(rel), html.EscapeString(f.Name)))
 		} else {
 			others = append(others, fmt.Sprintf("[%s](%s)", strings.ReplaceAll(f.Name, "]", ""), rel))
 		}
@@ -291,7 +325,7 @@ func writeImageAttachments(events []Event, assetsDir, date, idx string) (map[str
 	var warnings []string
 	n := 0
 	for _, e := range events {
-		switch e.Type {
+		switch eventKind(e) {
 		case "userMessage", "agentMessage", "verbalReply":
 		default:
 			continue
@@ -224,7 +224,7 @@ func resumeChatLogStream(dir, sessionID, agent, version string, history []Event)
 func (s *chatLogStream) recoverFromHistory(history []Event) {
 	assetsDir := filepath.Join(s.dir, "assets")
 	for _, e := range history {
-		switch e.Type {
+		switch eventKind(e) {
 		case "userMessage", "agentMessage", "verbalReply":
 		default:
 			continue
@@ -277,6 +277,7 @@ func (s *chatLogStream) setTitleLocked(title string, history []Event) error {
 	var st renderState
 	var b strings.Builder
 	b.WriteString(renderChatMarkdown(nil, meta, nil))
+	b.WriteString(pinsMarkdown(history)) // only refreshed here: appends do not revisit the header
 	for _, e := range history {
 		b.WriteString(renderChatBubble(e, &st, s.imageMap))
 	}
@@ -318,6 +319,30 @@ func (s *chatLogStream) setTitleLocked(title string, history []Event) error {
 	return nil
 }
 
+// Rerender rewrites the export from history, as SetTitle does but keeping
+// its title and whether it is stopped; after redact_message. Nil-safe, and
+// a no-op once chatlog_optout deleted the file.
+func (s *chatLogStream) Rerender(history []Event) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.optedOut || s.mdPath == "" {
+		return nil
+	}
+	stopped := s.stopped
+	if err := s.setTitleLocked(s.meta.Slug, history); err != nil {
+		return err
+	}
+	if stopped {
+		s.stopped = true
+		s.f.Close()
+		s.f = nil
+	}
+	return nil
+}
+
 // Optout implements chatlog_optout: stop appending, delete this session's .md
 // (assets stay — their content-sha names may be shared with other sessions;
 // orphans are harmless) and regenerate index.html so the archive no longer
@@ -491,7 +516,7 @@ func (s *chatLogStream) HandleEvent(e Event) {
 	if s.stopped || s.f == nil {
 		return
 	}
-	switch e.Type {
+	switch eventKind(e) {
 	case "userMessage", "agentMessage", "verbalReply":
 	default:
 		return
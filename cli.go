@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// subcommand is one `agent-chat <name>` entry point. Offline operations on
+// event logs and running instances live here rather than as more serve flags.
+type subcommand struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+// subcommands lists every subcommand in the order `agent-chat help` prints
+// them. Initialized in init so entries may refer back to runCLI's helpers.
+var subcommands []subcommand
+
+func init() {
+	subcommands = []subcommand{
+		{"serve", "run the MCP server and browser UI (default)", runServe},
+		{"list", "list running instances", func(args []string) int { return runList(args, os.Stdout) }},
+		{"export", "convert an event log into a Markdown or HTML transcript", func(args []string) int { return runExport(args, os.Stdout) }},
+		{"replay", "re-drive an event log into a running or temporary chat UI", func(args []string) int { return runReplay(args, os.Stdout) }},
+		{"send", "leave a message (and files) for the agent in a running instance", func(args []string) int { return runSend(args, os.Stdout) }},
+		{"qr", "print a QR code of a running instance's UI for opening it on a phone", func(args []string) int { return runQR(args, os.Stdout) }},
+		{"install", "register agent-chat as an MCP server in .mcp.json, ~/.claude.json or claude_desktop_config.json", func(args []string) int { return runInstall(args, os.Stdout) }},
+		{"install-service", "write a user systemd unit or LaunchAgent for an always-on HTTP-only instance", func(args []string) int { return runInstallService(args, os.Stdout) }},
+		{"compact", "rewrite an event log without malformed lines or withdrawn messages", func(args []string) int { return runCompact(args, os.Stdout) }},
+		{"verify", "check the hash chain of an event log written with -hash-chain", func(args []string) int { return runVerify(args, os.Stdout) }},
+		{"wipe", "permanently delete an event log, the drawings beside it and the uploads it references", func(args []string) int { return runWipe(args, os.Stdout) }},
+		{"doctor", "check the port, upload dir, event log, browser opener and UI files, and say how to fix problems", func(args []string) int { return runDoctor(args, os.Stdout) }},
+		{"version", "print version and exit", func(args []string) int {
+			fmt.Printf("agent-chat %s (%s)\n", version, commit)
+			return 0
+		}},
+		{"help", "show this help", func(args []string) int { printUsage(os.Stdout); return 0 }},
+	}
+}
+
+// runCLI dispatches args (os.Args[1:]) to a subcommand. With no subcommand —
+// no args, or a leading flag such as `agent-chat -no-stdio-mcp` — it runs
+// serve, so existing MCP configs keep working unchanged.
+func runCLI(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		if len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+			printUsage(os.Stderr)
+		}
+		return runServe(args)
+	}
+	for _, sc := range subcommands {
+		if sc.name == args[0] {
+			return sc.run(args[1:])
+		}
+	}
+	fmt.Fprintf(os.Stderr, "agent-chat: unknown subcommand %q\n\n", args[0])
+	printUsage(os.Stderr)
+	return 2
+}
+
+// printUsage writes the subcommand overview.
+func printUsage(out io.Writer) {
+	fmt.Fprintf(out, "Usage: agent-chat [subcommand] [flags]\n\nSubcommands:\n")
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, sc := range subcommands {
+		fmt.Fprintf(tw, "  %s\t%s\n", sc.name, sc.summary)
+	}
+	tw.Flush()
+	fmt.Fprintf(out, "\nRun `agent-chat <subcommand> -h` for its flags.\n")
+}
+
+// runCompact implements `agent-chat compact`: rewrite an event log in place
+// (or to -o) via compactEventLog. Run it only while no server is writing the
+// log — a live server keeps appending to the file it opened, not the rewrite.
+func runCompact(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("compact", flag.ContinueOnError)
+	output := fs.String("o", "", "write the compacted log here instead of replacing the input")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: agent-chat compact [-o out.jsonl] <events.jsonl>\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	in := fs.Arg(0)
+	dst := *output
+	if dst == "" {
+		dst = in
+	}
+	stats, err := compactEventLog(in, dst)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "agent-chat compact: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(out, "%s: kept %d events, dropped %d malformed lines and %d withdrawn-message events",
+		dst, stats.Kept, stats.Malformed, stats.Withdrawn)
+	if stats.Grouped > 0 {
+		fmt.Fprintf(out, ", and folded %d grouped progress updates", stats.Grouped)
+	}
+	fmt.Fprintln(out)
+	return 0
+}
+
+// runList implements `agent-chat list`: print the live instances from the
+// registry, as a table or (-json) as the same array GET /api/instances serves.
+func runList(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the registry as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	home, err := agentChatHome()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "agent-chat list: %v\n", err)
+		return 1
+	}
+	instances, err := listInstances(home)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "agent-chat list: %v\n", err)
+		return 1
+	}
+	if *asJSON {
+		if instances == nil {
+			instances = []instanceRecord{}
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		enc.Encode(instances)
+		return 0
+	}
+	if len(instances) == 0 {
+		fmt.Fprintln(out, "no running agent-chat instances")
+		return 0
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PID\tURL\tSTARTED\tPROJECT\tNAME")
+	for _, in := range instances {
+		url := in.URL
+		if url == "" {
+			url = "-"
+		}
+		started := time.UnixMilli(in.Started).Format("2006-01-02 15:04")
+		name := in.Name
+		if name == "" {
+			name = in.Title
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", in.PID, url, started, in.Project, name)
+	}
+	tw.Flush()
+	return 0
+}
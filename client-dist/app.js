@@ -13,12 +13,73 @@ function getCookie(name) {
 function applyTheme() {
   var cookieName = (typeof THEME_COOKIE_NAME !== 'undefined') ? THEME_COOKIE_NAME : 'agent-chat-theme';
   var theme = getCookie(cookieName) || 'dark';
+  if (document.documentElement.getAttribute('data-theme') === theme) return;
   document.documentElement.setAttribute('data-theme', theme);
+  reportClientInfo();
 }
 
 applyTheme();
 setInterval(applyTheme, 2000);
 
+// --- Localization ---
+// I18N is the string bundle the server inlines into the page (-locale's, or
+// the Accept-Language pick; the same as /i18n/auto.json): English UI text
+// mapped to its translation ({} for English). tr looks a string up and
+// fills {0}, {1}… with args. Static text in index.html is translated by
+// applyI18n: every title and placeholder, and the text of [data-i18n]
+// elements.
+var i18n = (typeof I18N !== 'undefined' && I18N) || {};
+
+function tr(text) {
+  var out = Object.prototype.hasOwnProperty.call(i18n, text) ? i18n[text] : text;
+  for (var i = 1; i < arguments.length; i++) {
+    out = out.split('{' + (i - 1) + '}').join(arguments[i]);
+  }
+  return out;
+}
+
+function applyI18n(root) {
+  root.querySelectorAll('[title]').forEach(function (el) { el.title = tr(el.title); });
+  root.querySelectorAll('[placeholder]').forEach(function (el) { el.placeholder = tr(el.placeholder); });
+  root.querySelectorAll('[data-i18n]').forEach(function (el) { el.textContent = tr(el.textContent); });
+}
+
+applyI18n(document);
+
+// --- Branding ---
+// -title and -logo put the operator's name and logo in the header; the
+// server has already set the page title and accent color.
+(function () {
+  var title = (typeof BRAND_TITLE !== 'undefined') ? BRAND_TITLE : '';
+  var logo = (typeof BRAND_LOGO !== 'undefined') ? BRAND_LOGO : '';
+  if (!title && !logo) return;
+  var brand = document.getElementById('brand');
+  document.getElementById('brand-title').textContent = title;
+  if (logo) {
+    var img = document.getElementById('brand-logo');
+    img.src = logo;
+    img.hidden = false;
+  }
+  brand.hidden = false;
+})();
+
+// --- Session name ---
+// Every event carries the chat's name (-session-name, else its
+// set_chat_title title). It leads the tab title, which notifications use,
+// and names the HTML export, so concurrent chats are told apart.
+var sessionName = '';
+
+function setSessionName(name) {
+  if (!name || name === sessionName) return;
+  sessionName = name;
+  var base = (typeof BRAND_TITLE !== 'undefined' && BRAND_TITLE) || 'Agent Chat';
+  document.title = name + ' \u00b7 ' + base;
+}
+
+function sessionSlug() {
+  return sessionName.toLowerCase().replace(/[^a-z0-9]+/g, '-').replace(/^-+|-+$/g, '');
+}
+
 // --- Parent URL resolution (relative links when embedded in an iframe) ---
 // When agent-chat runs inside a swe-swe iframe, a relative markdown link like
 // `/foo/bar` or `docs/readme.md` should resolve against the PARENT window's
@@ -57,6 +118,7 @@ function forkUrl(seq) {
 var messages = document.getElementById('messages');
 var chatInput = document.getElementById('chat-input');
 var sendBtn = document.getElementById('btn-send');
+var askBtn = document.getElementById('btn-ask');
 var chatEl = document.getElementById('chat');
 var quickReplies = document.getElementById('quick-replies');
 var btnAttach = document.getElementById('btn-attach');
@@ -129,6 +191,37 @@ function writeFirstMessageSent(value) {
 var firstMessageSent = readFirstMessageSent();
 var stagedFiles = []; // [{file: File, name: string, previewUrl: string|null, ref: FileRef|null, uploading: bool, uploadFailed: bool, abortController: AbortController|null}]
 var lastSeq = 0; // highest event seq received — sent as cursor on reconnect
+var streamLive = false; // history replayed: seqs arrive consecutively from here on
+// A fresh tab on a long chat is sent only its recent end: earliestSeq is
+// the oldest event it has (0 once nothing older remains), and shownEvents
+// every logged event it rendered, so an older page can be replayed in front.
+var earliestSeq = 0;
+var shownEvents = [];
+var loadingEarlier = false;
+var earlierWaiters = []; // called once the requested page has been shown
+// viewerId names this tab in read receipts; kept in sessionStorage so a
+// reload or reconnect is still the same viewer, not a second one.
+var VIEWER_ID_KEY = 'agent-chat-viewer-id';
+var viewerId = (function () {
+  var id = null;
+  try { id = sessionStorage.getItem(VIEWER_ID_KEY); } catch (_) { /* unavailable */ }
+  if (!id) {
+    id = Math.random().toString(36).slice(2) + Date.now().toString(36);
+    try { sessionStorage.setItem(VIEWER_ID_KEY, id); } catch (_) { /* unavailable */ }
+  }
+  return id;
+})();
+var receiptTimer = null;
+// clientId names this browser across tabs and restarts; the server keys the
+// user's display name on it.
+var CLIENT_ID_KEY = 'agent-chat-client-id';
+var DISPLAY_NAME_KEY = 'agent-chat-display-name';
+var clientId = localStorage.getItem(CLIENT_ID_KEY);
+if (!clientId) {
+  clientId = Math.random().toString(36).slice(2) + Date.now().toString(36);
+  localStorage.setItem(CLIENT_ID_KEY, clientId);
+}
+var displayName = localStorage.getItem(DISPLAY_NAME_KEY) || '';
 var interruptPhrases = ['stop', 'wait', 'cancel', 'hold on', 'abort', 'halt', 'pause'];
 var clearContextPhrase = 'clear context';
 var clearConfirmPhrase = 'yes';
@@ -157,6 +250,7 @@ window.addEventListener('scroll', function () {
   var threshold = 40;
   var distFromBottom = document.documentElement.scrollHeight - window.scrollY - window.innerHeight;
   isUserScrolledUp = distFromBottom > threshold;
+  if (window.scrollY < threshold) loadEarlier();
 });
 
 function scrollToBottom(force) {
@@ -170,6 +264,59 @@ function ts() {
   return new Date().toISOString().slice(11, 23);
 }
 
+// --- Server time ---
+// Event timestamps come from the server's clock. serverNow() is Date.now()
+// corrected by the skew measured against /api/time on connect, so countdowns
+// and the busy timer stay right when this device's clock is off. Times and
+// day separators are shown in the server's zone, as the exports are.
+var serverSkew = 0;
+
+function serverNow() {
+  return Date.now() + serverSkew;
+}
+
+function syncServerClock() {
+  var sent = Date.now();
+  fetch('api/time', { cache: 'no-store' })
+    .then(function (r) { return r.json(); })
+    .then(function (t) {
+      if (typeof t.now === 'number') serverSkew = t.now - (sent + Date.now()) / 2;
+    })
+    .catch(function () {});
+}
+
+// inServerZone returns Intl options for formatting ms in the server's zone:
+// its IANA name when known, else its UTC offset applied to a shifted date.
+function inServerZone(ms, opts) {
+  var tz = typeof SERVER_TZ !== 'undefined' ? SERVER_TZ : '';
+  if (tz) {
+    try {
+      new Intl.DateTimeFormat(undefined, { timeZone: tz });
+      return { date: new Date(ms), opts: Object.assign({ timeZone: tz }, opts) };
+    } catch (e) { /* a zone this browser does not know */ }
+  }
+  if (typeof SERVER_TZ_OFFSET === 'number') {
+    return { date: new Date(ms + SERVER_TZ_OFFSET * 60000), opts: Object.assign({ timeZone: 'UTC' }, opts) };
+  }
+  return { date: new Date(ms), opts: opts };
+}
+
+function formatServerTime(ms) {
+  var z = inServerZone(ms, { dateStyle: 'medium', timeStyle: 'short' });
+  return z.date.toLocaleString(document.documentElement.lang || undefined, z.opts);
+}
+
+// addDaySeparator renders a dateSeparator event; its text is the new day
+// (YYYY-MM-DD) in the server's zone.
+function addDaySeparator(ev) {
+  var day = new Date(ev.text + 'T00:00:00Z');
+  var div = document.createElement('div');
+  div.className = 'day-separator';
+  div.textContent = isNaN(day) ? ev.text : day.toLocaleDateString(document.documentElement.lang || undefined,
+    { weekday: 'long', year: 'numeric', month: 'long', day: 'numeric', timeZone: 'UTC' });
+  appendMessage(div);
+}
+
 // --- Canvas constants ---
 
 var CANVAS_W = 900;
@@ -182,6 +329,8 @@ function clearMessages() {
   messages.innerHTML = '';
   messages.appendChild(quickReplies); // keep as last child for appendMessage
   lastBubbleTs = 0;
+  pinnedSeqs = [];
+  renderPinnedBar();
 }
 
 // --- Syntax highlighting ---
@@ -380,7 +529,7 @@ function renderFileAttachments(files) {
 function createTtsButton(bubble) {
   var btn = document.createElement('button');
   btn.className = 'bubble-tts-btn';
-  btn.title = 'Speak aloud';
+  btn.title = tr('Speak aloud');
   btn.innerHTML = '<svg viewBox="0 0 24 24"><polygon points="6,4 20,12 6,20"/></svg>';
   btn.addEventListener('click', function(e) {
     e.stopPropagation();
@@ -431,7 +580,7 @@ function openBubbleMenuFor(btn, bubble, seq) {
   // Clicks inside the menu must not bubble to the document-level dismiss handler.
   menu.addEventListener('click', function (e) { e.stopPropagation(); });
 
-  var speak = makeMenuItem('speak', 'Speak aloud', ICON_SPEAK);
+  var speak = makeMenuItem('speak', tr('Speak aloud'), ICON_SPEAK);
   speak.addEventListener('click', function () {
     closeBubbleMenu();
     // This click is a user gesture — unlocks iOS TTS, same as the play button.
@@ -490,7 +639,7 @@ function openPendingMenuFor(btn, messageId, text) {
   menu.ownerBtn = btn;
   menu.addEventListener('click', function (e) { e.stopPropagation(); });
 
-  var del = makeMenuItem('delete', 'Delete', ICON_TRASH);
+  var del = makeMenuItem('delete', tr('Delete'), ICON_TRASH);
   del.addEventListener('click', function () {
     closeBubbleMenu();
     sendUnsend(messageId);
@@ -502,7 +651,7 @@ function openPendingMenuFor(btn, messageId, text) {
   // so there's no text-presence guard.
   var bubble = btn.closest('.bubble');
   if (bubble && isLastPendingBubble(bubble)) {
-    var interrupt = makeMenuItem('interrupt', 'Send as interrupting', ICON_INTERRUPT);
+    var interrupt = makeMenuItem('interrupt', tr('Send as interrupting'), ICON_INTERRUPT);
     interrupt.addEventListener('click', function () {
       closeBubbleMenu();
       interruptWithPendingMessage();
@@ -521,7 +670,7 @@ function createPendingMenuButton(bubble, messageId, text) {
   var btn = document.createElement('button');
   btn.type = 'button';
   btn.className = 'bubble-pending-menu';
-  btn.title = 'More actions';
+  btn.title = tr('More actions');
   btn.setAttribute('aria-haspopup', 'true');
   btn.innerHTML = '<svg viewBox="0 0 24 24"><circle cx="5" cy="12" r="2"/><circle cx="12" cy="12" r="2"/><circle cx="19" cy="12" r="2"/></svg>';
   btn.addEventListener('click', function (e) {
@@ -562,7 +711,7 @@ function createMenuButton(bubble, seq) {
   var btn = document.createElement('button');
   btn.type = 'button';
   btn.className = 'bubble-menu-btn';
-  btn.title = 'More actions';
+  btn.title = tr('More actions');
   btn.setAttribute('aria-haspopup', 'true');
   btn.innerHTML = '<svg viewBox="0 0 24 24"><circle cx="5" cy="12" r="2"/><circle cx="12" cy="12" r="2"/><circle cx="19" cy="12" r="2"/></svg>';
   btn.addEventListener('click', function (e) {
@@ -663,8 +812,96 @@ function addBubble(text, role, files, extraClass, timestamp, messageId, seq, for
     appendMessage(div);
   }
   scrollToBottom(false);
+  return div;
+}
+
+// showViewerCount updates the "2 viewers" badge from a presence event. A
+// lone tab is the user themself, so the badge only appears for two or more.
+function showViewerCount(data) {
+  var el = document.getElementById('viewer-count');
+  if (!el) return;
+  var n = data.viewers || 0;
+  el.hidden = n < 2;
+  el.textContent = tr('{0} viewers', n);
+  var parts = [];
+  for (var d in (data.devices || {})) parts.push(data.devices[d] + ' ' + d);
+  el.title = parts.join(', ');
+}
+
+// Agent liveness: the server's heartbeat (agentAlive / agentStalled) says
+// how long each agent has gone without a tool call. The header badge shows
+// the primary agent's and ages between beats; a stall is announced once per
+// episode, with a desktop notification when the tab is hidden and
+// notifications are allowed. idle_ms is used rather than last_active so a
+// phone with a skewed clock still reads it right.
+var agentLiveness = {}; // session key ('' = primary) -> {data, since}
+var livenessTimer = null;
+
+function showLiveness(data) {
+  var session = data.session || '';
+  var prev = agentLiveness[session];
+  var wasStalled = !!(prev && prev.data.type === 'agentStalled');
+  agentLiveness[session] = { data: data, since: Date.now() - (data.idle_ms || 0) };
+  agentBack(session);
+  if (data.type === 'agentStalled' && !wasStalled) {
+    var text = tr('{0} has been quiet for {1} and may be stuck', agentLabel(session), formatIdle(data.idle_ms || 0));
+    addSystemBubble(text);
+    notifyHidden(text);
+  } else if (data.type !== 'agentStalled' && wasStalled) {
+    addSystemBubble(tr('{0} is active again', agentLabel(session)));
+  }
+  renderLiveness();
+  if (livenessTimer === null) livenessTimer = setInterval(renderLiveness, 15000);
+}
+
+// notifyHidden shows a desktop notification of text when the tab is hidden
+// and notifications are allowed.
+function notifyHidden(text) {
+  if (document.visibilityState !== 'visible' && window.Notification && Notification.permission === 'granted') {
+    new Notification(document.title || 'agent-chat', { body: text });
+  }
+}
+
+function renderLiveness() {
+  var el = document.getElementById('agent-liveness');
+  var entry = agentLiveness[''];
+  if (!el || !entry) return;
+  el.hidden = false;
+  el.classList.toggle('stalled', entry.data.type === 'agentStalled');
+  el.textContent = entry.data.busy
+    ? tr('agent active now')
+    : tr('agent last active {0} ago', formatIdle(Date.now() - entry.since));
+  el.title = new Date(entry.since).toLocaleString();
+}
+
+// formatIdle renders a duration in ms as "45s", "4m" or "2h".
+function formatIdle(ms) {
+  var s = Math.max(0, Math.round(ms / 1000));
+  if (s < 60) return s + 's';
+  if (s < 3600) return Math.floor(s / 60) + 'm';
+  return Math.floor(s / 3600) + 'h';
 }
 
+// Tell the server everything up to lastSeq is rendered in this tab, and
+// whether anyone can see it. Debounced so a history replay sends one ack.
+function scheduleReceipt() {
+  if (receiptTimer !== null) return;
+  receiptTimer = setTimeout(function () {
+    receiptTimer = null;
+    if (!lastSeq || !activeWs || activeWs.readyState !== WebSocket.OPEN) return;
+    activeWs.send(JSON.stringify({
+      type: 'receipt',
+      id: viewerId,
+      seq: lastSeq,
+      seen: document.visibilityState === 'visible',
+    }));
+  }, 0);
+}
+
+document.addEventListener('visibilitychange', function () {
+  if (document.visibilityState === 'visible') scheduleReceipt();
+});
+
 // Tell the server to drop a pending message from the agent's queue.
 // Optimistically remove the bubble locally so the click feels responsive;
 // the server's userMessageDeleted broadcast will reconcile other tabs.
@@ -679,8 +916,9 @@ function sendUnsend(messageId) {
 
 function addAgentMessage(text, files, extraClass, timestamp, seq, forkable) {
   if (text || (files && files.length > 0)) {
-    addBubble(text, 'agent', files, extraClass, timestamp, undefined, seq, forkable);
+    return addBubble(text, 'agent', files, extraClass, timestamp, undefined, seq, forkable);
   }
+  return null;
 }
 
 function addUserMessage(text, files, extraClass, timestamp) {
@@ -689,61 +927,1052 @@ function addUserMessage(text, files, extraClass, timestamp) {
   }
 }
 
+// --- Agent sessions ---
+
+// Events from a second (third, ...) MCP client carry a `session` key; the
+// primary agent's don't. Those bubbles are labelled with the agent they
+// belong to, and the composer replies to whichever agent spoke last. Clicking
+// a label answers that agent instead (click again to go back). An agent with
+// an identity (-agent-name / set_identity) is labelled with its name and a
+// colored avatar, primary included.
+var replyTarget = ''; // '' = the primary agent
+var agentIdentities = {}; // session key ('' = primary) -> identity from its latest bubble
+
+function agentLabel(session) {
+  var id = agentIdentities[session || ''];
+  if (id && id.name) return id.name;
+  return session ? 'Agent ' + session.slice(0, 6) : 'Agent';
+}
+
+// Stable hue per name so an unconfigured color still tells agents apart.
+function agentColor(id) {
+  if (id.color) return id.color;
+  var h = 0;
+  for (var i = 0; i < id.name.length; i++) {
+    h = (h * 31 + id.name.charCodeAt(i)) % 360;
+  }
+  return 'hsl(' + h + ', 55%, 45%)';
+}
+
+// Record who is speaking: the agent's identity and the reply target.
+function agentSpoke(ev) {
+  var session = ev.session || '';
+  if (ev.agent) agentIdentities[session] = ev.agent;
+  setReplyTarget(session);
+  agentBack(session);
+}
+
+// agentDisconnected: an agent's MCP client has gone. If it was the agent
+// being answered, its quick replies go inert and the thinking indicator
+// stops; either way a banner above the composer says messages will wait.
+// Hearing from that agent again (a bubble or a heartbeat) clears it.
+var disconnectedAgents = {}; // session key ('' = primary) -> true
+
+function showAgentDisconnected(data) {
+  var session = data.session || '';
+  disconnectedAgents[session] = true;
+  if (session === replyTarget) {
+    freezeCurrentReplies('');
+    removeLoading();
+  }
+  renderAgentBanner();
+}
+
+function agentBack(session) {
+  if (!disconnectedAgents[session]) return;
+  delete disconnectedAgents[session];
+  renderAgentBanner();
+}
+
+function renderAgentBanner() {
+  var el = document.getElementById('agent-banner');
+  if (!el) return;
+  var lines = [];
+  for (var session in disconnectedAgents) {
+    lines.push(tr('{0} disconnected — messages will wait until it reconnects', agentLabel(session)));
+  }
+  el.textContent = lines.join('\n');
+  el.hidden = lines.length === 0;
+}
+
+function tagSession(div, ev, isUser) {
+  var session = ev.session || '';
+  var id = isUser ? agentIdentities[session] : ev.agent;
+  if (!div || !(session || (id && !isUser))) return;
+  var label = document.createElement('button');
+  label.type = 'button';
+  label.className = 'agent-label';
+  if (isUser) label.appendChild(document.createTextNode('\u2192 '));
+  if (id && id.name) {
+    var avatar = document.createElement('span');
+    avatar.className = 'agent-avatar';
+    avatar.style.background = agentColor(id);
+    avatar.textContent = id.avatar || Array.from(id.name)[0].toUpperCase();
+    label.appendChild(avatar);
+    label.appendChild(document.createTextNode(id.name));
+  } else {
+    label.appendChild(document.createTextNode(agentLabel(session)));
+  }
+  label.title = tr('Reply to {0}', agentLabel(session));
+  label.addEventListener('click', function () {
+    setReplyTarget(replyTarget === session ? '' : session);
+    chatInput.focus();
+  });
+  div.insertBefore(label, div.firstChild);
+}
+
+function setReplyTarget(session) {
+  replyTarget = session || '';
+  chatInput.placeholder = replyTarget ? tr('Message {0}...', agentLabel(replyTarget)) : tr('Type a message...');
+}
+
+// --- Reply-to ---
+
+// Any agent bubble can be answered specifically: its reply button quotes it
+// above the composer, and the next message carries its seq as reply_to so
+// the agent knows which message a bare "yes" refers to. Bubbles that reply
+// to something (either direction) show a quote of it.
+var replyToSeq = null;
+var replyPreview = document.getElementById('reply-preview');
+
+function quoteSnippet(text) {
+  var t = (text || '').replace(/\s+/g, ' ').trim();
+  return t.length > 100 ? t.slice(0, 100) + '\u2026' : t;
+}
+
+function setReplyTo(div) {
+  replyToSeq = Number(div.dataset.seq);
+  replyPreview.innerHTML = '';
+  var label = document.createElement('span');
+  label.textContent = tr('Replying to: {0}', div.dataset.quote || '#' + replyToSeq);
+  var cancel = document.createElement('button');
+  cancel.type = 'button';
+  cancel.title = tr('Cancel reply');
+  cancel.textContent = '\u00d7';
+  cancel.addEventListener('click', clearReplyTo);
+  replyPreview.appendChild(label);
+  replyPreview.appendChild(cancel);
+  replyPreview.hidden = false;
+  if (div.dataset.session !== undefined) setReplyTarget(div.dataset.session);
+  chatInput.focus();
+}
+
+function clearReplyTo() {
+  replyToSeq = null;
+  replyPreview.hidden = true;
+  replyPreview.innerHTML = '';
+}
+
+// --- Math ---
+
+// An agent message sent with math has its LaTeX in ```math fences. With
+// -katex-dir the server serves KaTeX at /katex/; it is loaded on the first
+// such message and each fence is typeset in place. Without it, or if a
+// formula does not parse, the fence stays as its source.
+var katexLoading = null;
+
+function loadKatex() {
+  if (!katexLoading) {
+    katexLoading = new Promise(function (resolve, reject) {
+      var css = document.createElement('link');
+      css.rel = 'stylesheet';
+      css.href = './katex/katex.min.css';
+      document.head.appendChild(css);
+      var script = document.createElement('script');
+      script.src = './katex/katex.min.js';
+      script.onload = function () { resolve(window.katex); };
+      script.onerror = reject;
+      document.head.appendChild(script);
+    });
+  }
+  return katexLoading;
+}
+
+function typesetMath(div) {
+  if (typeof KATEX === 'undefined' || !KATEX) return;
+  var blocks = div.querySelectorAll('code.language-math');
+  if (blocks.length === 0) return;
+  loadKatex().then(function (katex) {
+    blocks.forEach(function (code) {
+      var pre = code.parentNode;
+      var out = document.createElement('div');
+      out.className = 'math-block';
+      try {
+        katex.render(code.textContent, out, { displayMode: true, throwOnError: true });
+      } catch (err) {
+        return;
+      }
+      out.title = code.textContent;
+      pre.replaceWith(out);
+    });
+  }, function () {});
+}
+
+// decorateBubble adds per-event chrome to a freshly added bubble: the agent
+// label (tagSession), its seq and quote for replies, a quote of the message
+// it answers, and — on agent bubbles — the reply button.
+function decorateBubble(div, ev, isUser) {
+  if (!div) return;
+  if (ev.redacted) div.classList.add('redacted');
+  if (ev.type === 'agentError') div.classList.add('agent-error');
+  tagSession(div, ev, isUser);
+  if (isUser && ev.from) {
+    var from = document.createElement('div');
+    from.className = 'user-name';
+    from.textContent = ev.from;
+    div.insertBefore(from, div.firstChild);
+  }
+  if (!isUser && ev.meta) div.appendChild(metaChips(ev.meta));
+  var view = !isUser && ev.data ? dataView(ev) : null;
+  if (view) div.appendChild(view);
+  if (!isUser && ev.math) typesetMath(div);
+  if (ev.ts && !div.title) div.title = formatServerTime(ev.ts);
+  if (!ev.seq) return;
+  div.dataset.seq = String(ev.seq);
+  div.dataset.session = ev.session || '';
+  div.dataset.quote = quoteSnippet(ev.text);
+  if (!ev.aside) div.appendChild(pinButton(div, ev.seq));
+  if (ev.reply_to) {
+    var target = messages.querySelector('.bubble[data-seq="' + ev.reply_to + '"]');
+    var quote = document.createElement('div');
+    quote.className = 'reply-quote';
+    quote.textContent = '\u21aa ' + (target ? target.dataset.quote : '#' + ev.reply_to);
+    if (target) {
+      quote.addEventListener('click', function () {
+        target.scrollIntoView({ behavior: 'smooth', block: 'center' });
+      });
+    }
+    var label = div.querySelector('.agent-label');
+    div.insertBefore(quote, label ? label.nextSibling : div.firstChild);
+  }
+  if (!isUser && !ev.aside) {
+    var btn = document.createElement('button');
+    btn.type = 'button';
+    btn.className = 'bubble-reply-btn';
+    btn.title = tr('Reply to this message');
+    btn.textContent = '\u21a9';
+    btn.addEventListener('click', function (e) {
+      e.stopPropagation();
+      setReplyTo(div);
+    });
+    div.appendChild(btn);
+    div.appendChild(reactionBar(ev.seq));
+  }
+}
+
+// metaChips renders how an agent bubble was produced (event meta): the
+// tool, how long the agent worked on it, and the files it concerns, each
+// file by its base name with the full path on hover.
+function metaChips(meta) {
+  var row = document.createElement('div');
+  row.className = 'meta-chips';
+  function chip(text, title) {
+    var span = document.createElement('span');
+    span.className = 'meta-chip';
+    span.textContent = text;
+    span.title = title;
+    row.appendChild(span);
+  }
+  if (meta.tool) chip('\ud83d\udd27 ' + meta.tool, tr('Sent with {0}', meta.tool));
+  if (meta.duration_ms > 0) chip('\u23f1 ' + formatElapsed(meta.duration_ms), tr('Took {0}', formatElapsed(meta.duration_ms)));
+  (meta.files || []).forEach(function (f) {
+    chip('\ud83d\udcc4 ' + f.split(/[\\/]/).pop(), f);
+  });
+  return row;
+}
+
+// --- Data events ---
+// Event kinds with content of their own (a prompt card, a table, an error)
+// carry their payload in ev.data and a plain-text rendering of it in
+// ev.text. Every one shows as an agent message of that text; a kind with a
+// function in DATA_RENDERERS (data, ev) -> element also gets its rich
+// rendering under the text. One without text (a countdownEnded, a
+// permissionAnswered) settles a prompt and is handled by its own type.
+var DATA_RENDERERS = {};
+
+// eventKind is the type an event is rendered as. A permission prompt asked
+// while the user was in voice mode is spoken, as a verbalReply.
+function eventKind(ev) {
+  if (ev.data === undefined || ev.data === null || !ev.text) return ev.type;
+  return ev.type === 'permissionPrompt' && ev.data.voice ? 'verbalReply' : 'agentMessage';
+}
+
+function dataView(ev) {
+  var render = DATA_RENDERERS[ev.type];
+  return render ? render(ev.data, ev) : null;
+}
+
+// --- Agent errors ---
+// An "agentError" (report_error, or a tool call that failed) is a red
+// bubble whose text says what went wrong; any detail folds under it.
+DATA_RENDERERS.agentError = function (data) {
+  if (!data.detail) return null;
+  var details = document.createElement('details');
+  details.className = 'agent-error-detail';
+  var summary = document.createElement('summary');
+  summary.textContent = tr('Details');
+  var pre = document.createElement('pre');
+  pre.textContent = data.detail;
+  details.appendChild(summary);
+  details.appendChild(pre);
+  return details;
+};
+
+// --- Countdowns ---
+
+// countdownTimers holds the ticking interval of each running countdown,
+// by the seq of its prompt.
+var countdownTimers = {};
+
+// A "countdownPrompt" (confirm_countdown) shows under its text how long is
+// left before it settles by itself; showCountdownEnded says how it settled.
+DATA_RENDERERS.countdownPrompt = function (data, ev) {
+  var line = document.createElement('div');
+  line.className = 'countdown';
+  var label = data.on_timeout === 'reject' ? 'Rejecting in {0}s' : 'Approving in {0}s';
+  function tick() {
+    var left = Math.ceil((data.deadline - serverNow()) / 1000);
+    line.textContent = '\u23f3 ' + (left > 0 ? tr(label, left) : tr('Time is up'));
+    return left > 0;
+  }
+  if (tick() && ev.seq) {
+    countdownTimers[ev.seq] = setInterval(function () {
+      if (!tick()) stopCountdown(ev.seq);
+    }, 1000);
+  }
+  return line;
+};
+
+function stopCountdown(seq) {
+  if (!countdownTimers[seq]) return;
+  clearInterval(countdownTimers[seq]);
+  delete countdownTimers[seq];
+}
+
+// showCountdownEnded settles a countdown prompt: its buttons go, and the
+// line under it says whether the action was approved or rejected, and by
+// whom. A prompt that timed out in this tab leaves the agent working.
+function showCountdownEnded(ev) {
+  var c = ev.data || {};
+  var session = ev.session || '';
+  stopCountdown(ev.reply_to);
+  if (ev.ack_id && ev.ack_id === pendingAckId) pendingAckId = null;
+  if (ev.reply_to && promptSeqs[session] === ev.reply_to) {
+    delete promptSeqs[session];
+    freezeCurrentReplies();
+    if (c.by !== 'user') showLoading();
+  }
+  var target = ev.reply_to && messages.querySelector('.bubble[data-seq="' + ev.reply_to + '"]');
+  var line = target && target.querySelector('.countdown');
+  if (!line) return;
+  if (c.by === 'cancelled') {
+    line.textContent = '\u2716 ' + tr('Cancelled');
+  } else if (c.by === 'timeout') {
+    line.textContent = c.outcome === 'approved' ? '\u2714 ' + tr('Approved: nobody objected') : '\u2716 ' + tr('Rejected: nobody approved');
+  } else {
+    line.textContent = c.outcome === 'approved' ? '\u2714 ' + tr('Approved') : '\u2716 ' + tr('Rejected');
+  }
+}
+
+// --- Progress groups ---
+
+// replaceProgress lets a progress update sent with replace overwrite the
+// agent's previous progress bubble, when nothing else has been said since:
+// spinner-style "Step 3/10..." updates then take one bubble, not ten.
+function replaceProgress(div, ev) {
+  if (!div) return;
+  if (ev.agent_tool_name === 'send_progress' || ev.agent_tool_name === 'send_verbal_progress') {
+    div.dataset.progress = ev.session || '';
+  }
+  if (!ev.replace) return;
+  var prev = div.previousElementSibling;
+  var elapsed = null;
+  if (prev && prev.classList.contains('elapsed-time')) {
+    elapsed = prev;
+    prev = prev.previousElementSibling;
+  }
+  var target = prev && prev.classList.contains('progress-group') ? prev.lastElementChild : prev;
+  if (!target || target.dataset.progress !== (ev.session || '')) return;
+  if (elapsed) elapsed.remove();
+  target.replaceWith(div);
+}
+
+// groupProgress folds a send_progress bubble with a group_id into the card
+// of its group when that card (or the group's first bubble) is the bubble
+// right before it: the latest update stays in view and the earlier ones
+// collapse into an expandable list above it. A bubble of anything else in
+// between starts a new card.
+function groupProgress(div, ev) {
+  if (!div || !ev.group_id) return;
+  var key = (ev.session || '') + '\n' + ev.group_id;
+  div.dataset.group = key;
+  var prev = div.previousElementSibling;
+  var elapsed = null;
+  if (prev && prev.classList.contains('elapsed-time')) {
+    elapsed = prev;
+    prev = prev.previousElementSibling;
+  }
+  if (!prev || prev.dataset.group !== key) return;
+  var card = prev;
+  if (!card.classList.contains('progress-group')) {
+    card = document.createElement('div');
+    card.className = 'progress-group';
+    card.dataset.group = key;
+    var details = document.createElement('details');
+    details.appendChild(document.createElement('summary'));
+    card.appendChild(details);
+    prev.parentNode.insertBefore(card, prev);
+    card.appendChild(prev);
+  }
+  if (elapsed) elapsed.remove();
+  var earlier = card.firstElementChild;
+  earlier.appendChild(card.lastElementChild);
+  card.appendChild(div);
+  earlier.firstElementChild.textContent = tr('{0} earlier updates', earlier.children.length - 1);
+}
+
+// --- Reactions ---
+
+var REACTIONS = ['\ud83d\udc4d', '\ud83d\udc4e', '\u2753'];
+
+// reactionBar is the row of 👍/👎/❓ buttons on an agent bubble. A click
+// sends the reaction; the server's "reaction" broadcast marks the bubble.
+function reactionBar(seq) {
+  var bar = document.createElement('div');
+  bar.className = 'bubble-react';
+  REACTIONS.forEach(function (emoji) {
+    var b = document.createElement('button');
+    b.type = 'button';
+    b.textContent = emoji;
+    b.title = tr('React {0}', emoji);
+    b.addEventListener('click', function (e) {
+      e.stopPropagation();
+      if (activeWs && activeWs.readyState === WebSocket.OPEN) {
+        activeWs.send(JSON.stringify({ type: 'reaction', reply_to: seq, emoji: emoji }));
+      }
+    });
+    bar.appendChild(b);
+  });
+  return bar;
+}
+
+// showReaction marks the reacted-to bubble with the emoji.
+function showReaction(ev) {
+  var target = messages.querySelector('.bubble[data-seq="' + ev.reply_to + '"]');
+  if (!target) return;
+  var badge = target.querySelector('.reaction-badge');
+  if (!badge) {
+    badge = document.createElement('span');
+    badge.className = 'reaction-badge';
+    target.appendChild(badge);
+  }
+  if (badge.textContent.indexOf(ev.text) === -1) badge.textContent += ev.text;
+}
+
+// --- Permission prompts ---
+
+// A "permissionPrompt" (a relayed Claude Code permission request) gets an
+// Approve/Deny bar. A click answers like the Allow/Deny quick reply; the
+// server's "permissionAnswered" broadcast then settles the card in every
+// tab.
+DATA_RENDERERS.permissionPrompt = function (perm) {
+  var card = document.createElement('div');
+  card.className = 'permission-card';
+  card.dataset.requestId = perm.request_id;
+  [['Allow', 'allow'], ['Deny', 'deny']].forEach(function (choice) {
+    var b = document.createElement('button');
+    b.type = 'button';
+    b.className = 'permission-btn ' + choice[1];
+    b.textContent = tr(choice[0]);
+    b.addEventListener('click', function (e) {
+      e.stopPropagation();
+      if (!activeWs || activeWs.readyState !== WebSocket.OPEN) return;
+      card.querySelectorAll('button').forEach(function (btn) { btn.disabled = true; });
+      pendingNotifyParent = true;
+      freezeCurrentReplies(choice[0]);
+      sendMessage(choice[0]);
+      showLoading();
+    });
+    card.appendChild(b);
+  });
+  return card;
+};
+
+// showPermissionAnswer replaces a prompt's buttons with how it was settled.
+function showPermissionAnswer(ev) {
+  var perm = ev.data;
+  if (!perm) return;
+  var card = messages.querySelector('.permission-card[data-request-id="' + CSS.escape(perm.request_id) + '"]');
+  if (!card) return;
+  var labels = {
+    allow: '\u2705 ' + tr('Allowed'),
+    deny: '\u26d4 ' + tr('Denied'),
+    expired: '\u23f1 ' + tr('Not answered in time \u2014 denied'),
+    superseded: tr('Replaced by a newer request \u2014 answer it in the terminal'),
+  };
+  card.className = 'permission-card answered ' + (perm.verdict || '');
+  card.textContent = labels[perm.verdict] || perm.verdict;
+}
+
+// --- Location requests ---
+
+// A "locationPrompt" (request_location) gets a Share / Don't share bar.
+// Sharing asks the browser's Geolocation API, which shows its own consent
+// dialog; the position goes to the server once and is never shown in the
+// chat. The server's "locationAnswered" broadcast settles the card in every
+// tab.
+DATA_RENDERERS.locationPrompt = function (loc) {
+  var card = document.createElement('div');
+  card.className = 'permission-card location-card';
+  card.dataset.requestId = loc.request_id;
+  function answer(location) {
+    if (!activeWs || activeWs.readyState !== WebSocket.OPEN) return;
+    activeWs.send(JSON.stringify({ type: 'location', id: loc.request_id, location: location }));
+  }
+  function button(label, cls, onClick) {
+    var b = document.createElement('button');
+    b.type = 'button';
+    b.className = 'permission-btn ' + cls;
+    b.textContent = label;
+    b.addEventListener('click', function (e) {
+      e.stopPropagation();
+      card.querySelectorAll('button').forEach(function (btn) { btn.disabled = true; });
+      onClick();
+    });
+    card.appendChild(b);
+  }
+  button('\ud83d\udccd ' + tr('Share my location'), 'allow', function () {
+    if (!navigator.geolocation || !window.isSecureContext) {
+      answer({ error: 'geolocation is unavailable: the chat must be opened over HTTPS or on localhost' });
+      return;
+    }
+    navigator.geolocation.getCurrentPosition(function (pos) {
+      answer({ latitude: pos.coords.latitude, longitude: pos.coords.longitude, accuracy_m: pos.coords.accuracy });
+    }, function (err) {
+      answer(err.code === err.PERMISSION_DENIED ? { declined: true } : { error: err.message || 'position unavailable' });
+    }, { enableHighAccuracy: !!loc.high_accuracy, timeout: 30000, maximumAge: 60000 });
+  });
+  button(tr("Don't share"), 'deny', function () {
+    answer({ declined: true });
+  });
+  return card;
+};
+
+// showLocationAnswer replaces a location request's buttons with how it
+// went: ev is a "locationAnswered" event, or the server's "locationClosed"
+// reply to a request that had already gone.
+function showLocationAnswer(ev) {
+  var id = ev.data ? ev.data.request_id : ev.request_id;
+  var status = ev.data ? ev.data.status : 'cancelled';
+  var card = id && messages.querySelector('.location-card[data-request-id="' + CSS.escape(id) + '"]');
+  if (!card) return;
+  var labels = {
+    shared: '\ud83d\udccd ' + tr('Location shared'),
+    declined: tr('Location not shared'),
+    failed: '\u26a0 ' + tr('Could not get the location'),
+    cancelled: tr('No longer requested'),
+  };
+  card.className = 'permission-card location-card answered ' + status;
+  card.textContent = (labels[status] || status) + (ev.from ? ' \u00b7 ' + ev.from : '');
+}
+
+// --- File requests ---
+
+// pick_file's prompt: a browser over the shared directory. Clicking a file
+// picks it, or with multiple toggles it for Choose. The server's
+// "filePickerAnswered" broadcast settles the card in every tab.
+DATA_RENDERERS.filePicker = function (data) {
+  var card = document.createElement('div');
+  card.className = 'permission-card file-picker';
+  card.dataset.requestId = data.request_id;
+  var where = document.createElement('div');
+  where.className = 'shared-size';
+  var list = document.createElement('div');
+  list.className = 'file-picker-list';
+  var actions = document.createElement('div');
+  card.appendChild(where);
+  card.appendChild(list);
+  card.appendChild(actions);
+  var chosen = [];
+
+  function answer(paths) {
+    if (!activeWs || activeWs.readyState !== WebSocket.OPEN) return;
+    card.querySelectorAll('button').forEach(function (btn) { btn.disabled = true; });
+    activeWs.send(JSON.stringify({ type: 'pickFiles', id: data.request_id, paths: paths }));
+  }
+  function button(label, cls, onClick) {
+    var b = document.createElement('button');
+    b.type = 'button';
+    b.className = 'permission-btn ' + cls;
+    b.textContent = label;
+    b.addEventListener('click', function (e) {
+      e.stopPropagation();
+      onClick();
+    });
+    actions.appendChild(b);
+    return b;
+  }
+  var choose = data.multiple ? button(tr('Choose'), 'allow', function () { answer(chosen); }) : null;
+  if (choose) choose.disabled = true;
+  button(tr('Cancel'), 'deny', function () { answer([]); });
+
+  async function browse(path) {
+    var listing;
+    try {
+      var resp = await fetch('api/files?path=' + encodeURIComponent(path));
+      if (!resp.ok) throw new Error(await resp.text());
+      listing = await resp.json();
+    } catch (e) {
+      list.textContent = String(e.message || e);
+      return;
+    }
+    if (card.classList.contains('answered')) return;
+    where.textContent = '/' + listing.path;
+    list.innerHTML = '';
+    var entries = listing.entries;
+    if (listing.path) {
+      entries = [{ name: '..', path: listing.path.split('/').slice(0, -1).join('/'), dir: true }].concat(entries);
+    }
+    entries.forEach(function (entry) {
+      var row = document.createElement('div');
+      row.className = 'shared-entry' + (entry.dir ? ' dir' : '');
+      if (chosen.indexOf(entry.path) !== -1) row.classList.add('chosen');
+      var name = document.createElement('span');
+      name.className = 'shared-name';
+      name.textContent = entry.dir ? entry.name + '/' : entry.name;
+      row.appendChild(name);
+      if (!entry.dir) {
+        var size = document.createElement('span');
+        size.className = 'shared-size';
+        size.textContent = sizeLabel(entry.size);
+        row.appendChild(size);
+      }
+      row.addEventListener('click', function (e) {
+        e.stopPropagation();
+        if (entry.dir) return browse(entry.path);
+        if (!data.multiple) return answer([entry.path]);
+        var at = chosen.indexOf(entry.path);
+        if (at === -1) chosen.push(entry.path);
+        else chosen.splice(at, 1);
+        row.classList.toggle('chosen', at === -1);
+        choose.disabled = chosen.length === 0;
+        choose.textContent = chosen.length ? tr('Choose {0}', chosen.length) : tr('Choose');
+      });
+      list.appendChild(row);
+    });
+  }
+  // Deferred, so a card already answered in the replayed history is
+  // settled before it would fetch a listing.
+  setTimeout(function () {
+    if (!card.classList.contains('answered')) browse(data.path || '');
+  }, 0);
+  return card;
+};
+
+// showFilePickerAnswer replaces a file request's browser with how it went:
+// ev is a "filePickerAnswered" event, or the server's "filePickerClosed"
+// reply to a request that had already gone.
+function showFilePickerAnswer(ev) {
+  var id = ev.type === 'filePickerClosed' ? ev.request_id : ev.id;
+  var status = ev.type === 'filePickerClosed' ? 'cancelled' : ev.text;
+  var card = id && messages.querySelector('.file-picker[data-request-id="' + CSS.escape(id) + '"]');
+  if (!card) return;
+  var names = (ev.files || []).map(function (f) { return f.name; }).join(', ');
+  var labels = {
+    picked: '\ud83d\udcc2 ' + tr('Picked {0}', names),
+    declined: tr('Nothing picked'),
+    cancelled: tr('No longer requested'),
+  };
+  card.className = 'permission-card file-picker answered ' + status;
+  card.textContent = (labels[status] || status) + (ev.from ? ' \u00b7 ' + ev.from : '');
+}
+
+// --- Prompts answered in another tab ---
+
+// promptSeqs maps an agent session ('' = the primary agent) to the seq of
+// its event whose quick replies await an answer. Answers carry it, so the
+// server can turn away a second tab answering the same question.
+var promptSeqs = {};
+
+// trackPrompt notes the open prompt from each live event, mirroring the
+// server's bookkeeping.
+function trackPrompt(ev) {
+  var session = ev.session || '';
+  if (ev.quick_replies && ev.quick_replies.length > 0) {
+    promptSeqs[session] = ev.seq;
+  } else if ((ev.type === 'userMessage' && !ev.aside) || ev.type === 'agentDisconnected') {
+    delete promptSeqs[session];
+  }
+}
+
+// showPromptAnswer settles a prompt some tab answered: its buttons and any
+// pending draw ack go, and the prompt's bubble says what was chosen and by
+// whom.
+function showPromptAnswer(ev) {
+  var session = ev.session || '';
+  if (ev.ack_id && ev.ack_id === pendingAckId) pendingAckId = null;
+  if (ev.reply_to && promptSeqs[session] === ev.reply_to) {
+    delete promptSeqs[session];
+    freezeCurrentReplies(ev.text);
+  }
+  var target = ev.reply_to && messages.querySelector('.bubble[data-seq="' + ev.reply_to + '"]');
+  if (!target) return;
+  var note = target.querySelector('.prompt-answer');
+  if (!note) {
+    note = document.createElement('div');
+    note.className = 'prompt-answer';
+    target.appendChild(note);
+  }
+  note.dataset.answerSeq = String(ev.seq || '');
+  note.textContent = '\u2714 ' + (ev.text ? tr('Answered: {0}', ev.text) : tr('Answered')) + (ev.from ? ' \u00b7 ' + ev.from : '');
+}
+
+// showPromptClosed handles the server turning away this tab's answer: the
+// prompt was answered elsewhere first. The typed text stays in the box.
+function showPromptClosed(ev) {
+  if (ev.ack_id && ev.ack_id === pendingAckId) pendingAckId = null;
+  for (var session in promptSeqs) {
+    if (promptSeqs[session] === ev.reply_to) delete promptSeqs[session];
+  }
+  freezeCurrentReplies();
+  addSystemBubble(tr('Already answered in another tab'));
+  chatInput.readOnly = false;
+  chatInput.classList.remove('sending');
+  sendBtn.disabled = false;
+  sendBtn.classList.remove('sending');
+  updateSendButton();
+}
+
+// --- Pins ---
+
+// pinnedSeqs lists pinned message seqs in pin order. The server replays
+// "pinned"/"unpinned" events with the history, so it rebuilds on reconnect.
+var pinnedSeqs = [];
+var pinnedBar = document.getElementById('pinned-bar');
+
+// pinButton toggles a bubble's pin. The server's broadcast updates the UI.
+function pinButton(div, seq) {
+  var btn = document.createElement('button');
+  btn.type = 'button';
+  btn.className = 'bubble-pin-btn';
+  btn.title = tr('Pin or unpin this message');
+  btn.textContent = '\ud83d\udccc';
+  btn.addEventListener('click', function (e) {
+    e.stopPropagation();
+    if (activeWs && activeWs.readyState === WebSocket.OPEN) {
+      var type = div.classList.contains('pinned') ? 'unpin' : 'pin';
+      activeWs.send(JSON.stringify({ type: type, reply_to: seq }));
+    }
+  });
+  return btn;
+}
+
+// showPin applies a "pinned" or "unpinned" event.
+function showPin(ev, pinned) {
+  var i = pinnedSeqs.indexOf(ev.reply_to);
+  if (pinned && i === -1) pinnedSeqs.push(ev.reply_to);
+  if (!pinned && i !== -1) pinnedSeqs.splice(i, 1);
+  var target = messages.querySelector('.bubble[data-seq="' + ev.reply_to + '"]');
+  if (target) target.classList.toggle('pinned', pinned);
+  renderPinnedBar();
+}
+
+// renderPinnedBar lists the pins above the messages; a click jumps to one.
+function renderPinnedBar() {
+  pinnedBar.innerHTML = '';
+  pinnedSeqs.forEach(function (seq) {
+    var target = messages.querySelector('.bubble[data-seq="' + seq + '"]');
+    var row = document.createElement('div');
+    row.className = 'pinned-item';
+    row.textContent = '\ud83d\udccc ' + (target ? target.dataset.quote : '#' + seq);
+    row.addEventListener('click', function () { jumpToSeq(seq); });
+    pinnedBar.appendChild(row);
+  });
+  pinnedBar.hidden = pinnedSeqs.length === 0;
+}
+
+// showRedacted blanks a bubble redact_message scrubbed; its history replays
+// with the marker already in place.
+function showRedacted(ev) {
+  var note = messages.querySelector('.prompt-answer[data-answer-seq="' + ev.reply_to + '"]');
+  if (note) note.textContent = '\u2714 ' + tr('Answered: {0}', tr('[redacted]'));
+  var target = messages.querySelector('.bubble[data-seq="' + ev.reply_to + '"]');
+  if (!target) return;
+  target.innerHTML = '';
+  target.classList.add('redacted');
+  target.textContent = tr('[redacted]');
+  target.dataset.quote = tr('[redacted]');
+  renderPinnedBar();
+}
+
+// showHighlight puts up the agent's laser pointer (see highlight.go) for
+// ev.ttl_ms: a dot at ev.x, ev.y on a drawing, a box when ev.width and
+// ev.height are given too, or a glow around the whole bubble.
+function showHighlight(ev) {
+  var target = messages.querySelector('.bubble[data-seq="' + ev.seq + '"]');
+  if (!target) return;
+  var mark;
+  if (ev.x == null || !target.boardSpec) {
+    mark = target;
+    target.classList.add('highlighted');
+  } else {
+    var spec = target.boardSpec;
+    var vp = target.viewportRegion || { x: 0, y: 0, width: spec.width, height: spec.height };
+    mark = document.createElement('div');
+    mark.className = ev.width ? 'highlight-box' : 'highlight-dot';
+    mark.style.left = ((ev.x - vp.x) / vp.width * 100) + '%';
+    mark.style.top = ((ev.y - vp.y) / vp.height * 100) + '%';
+    if (ev.width) {
+      mark.style.width = (ev.width / vp.width * 100) + '%';
+      mark.style.height = (ev.height / vp.height * 100) + '%';
+    }
+    target.appendChild(mark);
+  }
+  var folded = target.closest('.progress-group details');
+  if (folded) folded.open = true;
+  target.scrollIntoView({ behavior: 'smooth', block: 'nearest' });
+  setTimeout(function () {
+    if (mark === target) target.classList.remove('highlighted');
+    else mark.remove();
+  }, ev.ttl_ms || 3000);
+}
+
+// --- Link previews ---
+
+// showLinkPreviews adds a card per previewed link under the message that
+// mentioned it. The server fetched them, so nothing here touches the sites
+// except the og:image.
+function showLinkPreviews(ev) {
+  var target = messages.querySelector('.bubble[data-seq="' + ev.reply_to + '"]');
+  if (!target || !ev.links || target.querySelector('.link-cards')) return;
+  var cards = document.createElement('div');
+  cards.className = 'link-cards';
+  ev.links.forEach(function (link) {
+    if (!/^https?:\/\//i.test(link.url)) return;
+    var card = document.createElement('a');
+    card.className = 'link-card';
+    card.href = link.url;
+    card.target = '_blank';
+    card.rel = 'noopener noreferrer';
+    if (link.image && /^https?:\/\//i.test(link.image)) {
+      var img = document.createElement('img');
+      img.src = link.image;
+      img.alt = '';
+      img.loading = 'lazy';
+      img.referrerPolicy = 'no-referrer';
+      card.appendChild(img);
+    }
+    var body = document.createElement('div');
+    body.className = 'link-card-body';
+    var title = document.createElement('div');
+    title.className = 'link-card-title';
+    title.textContent = link.title || link.url;
+    body.appendChild(title);
+    if (link.description) {
+      var desc = document.createElement('div');
+      desc.className = 'link-card-desc';
+      desc.textContent = link.description;
+      body.appendChild(desc);
+    }
+    card.appendChild(body);
+    cards.appendChild(card);
+  });
+  target.appendChild(cards);
+}
+
 // --- Canvas bubble ---
 
 function canvasToImg(canvas, div) {
   var img = document.createElement('img');
   img.src = canvas.toDataURL('image/png');
-  var w = div.getBoundingClientRect().width;
-  div.style.height = (w * CANVAS_H / CANVAS_W) + 'px';
+  img.style.cssText = canvas.style.cssText;
+  if (!div.classList.contains('viewport')) {
+    var w = div.getBoundingClientRect().width;
+    div.style.height = (w * canvas.height / canvas.width) + 'px';
+  }
   div.replaceChild(img, canvas);
 }
 
-function addCanvasBubble(instructions, skipAnimation, onDone) {
-  var div = document.createElement('div');
+// canvasSpec reads a drawing's canvas-level instructions (see
+// drawcanvas.go): the board's size and background from setCanvas, and the
+// drawing split into steps — runs of instructions for the board, and
+// between them the setViewport/zoomTo moves and the layer compiler's
+// animate, setOpacity and clearRegion (see drawlayers.go), which act on the
+// board itself.
+function canvasSpec(instructions) {
+  var spec = { width: CANVAS_W, height: CANVAS_H, background: '#0d1525', steps: [] };
+  var run = [];
+  for (var i = 0; i < instructions.length; i++) {
+    var ins = instructions[i];
+    var type = ins && ins.type;
+    if (type === 'setCanvas') {
+      spec.width = ins.width;
+      spec.height = ins.height;
+      if (ins.background) spec.background = ins.background;
+    } else if (type === 'setViewport' || type === 'zoomTo') {
+      spec.steps.push({ draw: run });
+      run = [];
+      spec.steps.push({ viewport: ins, duration: type === 'zoomTo' ? (ins.duration == null ? 600 : ins.duration) : 0 });
+    } else if (type === 'animate' || type === 'setOpacity' || type === 'clearRegion') {
+      spec.steps.push({ draw: run });
+      run = [];
+      spec.steps.push({ board: ins });
+    } else {
+      run.push(ins);
+    }
+  }
+  spec.steps.push({ draw: run });
+  return spec;
+}
+
+// showViewport fits the region vp of a spec-sized board into div, easing
+// there over duration ms. The board element is scaled and shifted inside
+// div, which takes the region's shape.
+function showViewport(div, el, spec, vp, duration) {
+  div.classList.add('viewport');
+  div.viewportRegion = vp;
+  div.style.height = '';
+  div.style.aspectRatio = vp.width + ' / ' + vp.height;
+  el.style.transition = duration > 0
+    ? 'width ' + duration + 'ms ease-in-out, transform ' + duration + 'ms ease-in-out'
+    : '';
+  el.style.maxWidth = 'none';
+  el.style.width = (spec.width / vp.width * 100) + '%';
+  el.style.transform = 'translate(' + (-vp.x / spec.width * 100) + '%, ' + (-vp.y / spec.height * 100) + '%)';
+}
+
+// boardStep applies one of the layer compiler's instructions to board. They
+// reach into its renderer: strokes are committed to renderer.persistCtx,
+// which is composited over the background.
+function boardStep(board, ins, skipAnimation) {
+  var ctx = board.renderer.persistCtx;
+  switch (ins.type) {
+    case 'animate':
+      board.setSkipAnimation(skipAnimation || !ins.on);
+      break;
+    case 'setOpacity':
+      ctx.globalAlpha = ins.opacity;
+      break;
+    case 'clearRegion':
+      ctx.clearRect(ins.x, ins.y, ins.width, ins.height);
+      board.renderer.compositeToDisplay();
+      break;
+  }
+}
+
+// addCanvasBubble draws instructions into a new canvas bubble, or into
+// placeholder (already in the chat) when given. A drawing that moves the
+// viewport ends on its last region; clicking it then toggles the whole
+// board.
+function addCanvasBubble(instructions, skipAnimation, onDone, placeholder) {
+  var div = placeholder || document.createElement('div');
   div.className = 'bubble agent canvas-bubble';
+  div.textContent = '';
 
+  var spec = canvasSpec(instructions);
+  div.boardSpec = spec;
+  // Keep big boards under the canvas area mobile browsers allow.
+  var dpr = Math.min(DPR, Math.sqrt(16e6 / (spec.width * spec.height)));
   var canvas = document.createElement('canvas');
-  canvas.width = CANVAS_W * DPR;
-  canvas.height = CANVAS_H * DPR;
+  canvas.width = spec.width * dpr;
+  canvas.height = spec.height * dpr;
   div.appendChild(canvas);
 
-  appendMessage(div);
+  if (!placeholder) appendMessage(div);
   scrollToBottom(false);
 
+  var lastViewport = null;
   var finalize = function () {
     // Wait two frames so the renderer composites before we snapshot
     requestAnimationFrame(function () {
       requestAnimationFrame(function () {
         canvasToImg(canvas, div);
+        if (lastViewport) {
+          div.title = tr('Click to see the whole drawing');
+          div.addEventListener('click', function () {
+            var img = div.querySelector('img');
+            var whole = div.classList.toggle('whole');
+            showViewport(div, img, spec, whole ? { x: 0, y: 0, width: spec.width, height: spec.height } : lastViewport, 300);
+          });
+        }
         scrollToBottom(false);
         if (onDone) onDone();
       });
     });
   };
 
+  var step = 0;
+  var next = function () {
+    if (step >= spec.steps.length) {
+      finalize();
+      return;
+    }
+    var s = spec.steps[step++];
+    if (s.board) {
+      boardStep(board, s.board, skipAnimation);
+      next();
+      return;
+    }
+    if (s.viewport) {
+      var ms = skipAnimation ? 0 : s.duration;
+      lastViewport = s.viewport;
+      showViewport(div, canvas, spec, s.viewport, ms);
+      setTimeout(next, ms);
+      return;
+    }
+    // Validate instructions
+    var result = CanvasBundle.validateInstructions(s.draw);
+    if (result.errors.length > 0) {
+      console.warn('Canvas instruction validation errors:', result.errors);
+    }
+    board.addInstructions(result.valid);
+  };
+
   var board = new CanvasBundle.AgentWhiteboard(canvas, {
-    width: CANVAS_W,
-    height: CANVAS_H,
-    backgroundColor: '#0d1525',
-    onQueueEmpty: finalize,
+    width: spec.width,
+    height: spec.height,
+    backgroundColor: spec.background,
+    onQueueEmpty: next,
   });
-  board.resize(CANVAS_W, CANVAS_H, DPR);
+  board.resize(spec.width, spec.height, dpr);
 
   if (skipAnimation) {
     board.setSkipAnimation(true);
   }
 
-  // Validate instructions
-  var result = CanvasBundle.validateInstructions(instructions);
-  if (result.errors.length > 0) {
-    console.warn('Canvas instruction validation errors:', result.errors);
-  }
-  board.addInstructions(result.valid);
+  next();
 
   return { div: div, board: board, canvas: canvas };
 }
 
+// addDrawEvent renders a draw event. A big drawing is logged by reference
+// (instructions_ref): its bubble holds its place in the chat while the
+// instructions are fetched.
+function addDrawEvent(ev, skipAnimation, onDone) {
+  if (!ev.instructions_ref || ev.instructions) {
+    var drawn = addCanvasBubble(ev.instructions || [], skipAnimation, onDone);
+    if (ev.seq) drawn.div.dataset.seq = String(ev.seq);
+    return drawn;
+  }
+  var div = document.createElement('div');
+  div.className = 'bubble agent canvas-bubble';
+  if (ev.seq) div.dataset.seq = String(ev.seq);
+  div.textContent = tr('Loading drawing\u2026');
+  appendMessage(div);
+  fetch('api/instructions/' + encodeURIComponent(ev.instructions_ref))
+    .then(function (resp) {
+      if (!resp.ok) throw new Error(resp.status);
+      return resp.json();
+    })
+    .then(function (instructions) {
+      addCanvasBubble(instructions, skipAnimation, onDone, div);
+    })
+    .catch(function () {
+      div.textContent = tr('Drawing unavailable');
+      if (onDone) onDone();
+    });
+}
+
 // --- Input enable/disable ---
 
 function setQuickReplies(replies) {
@@ -837,17 +2066,34 @@ function startUpload(entry, isRetry) {
   updateSendButton();
 
   var formData = new FormData();
-  formData.append('files', entry.file);
+  if (entry.folder) {
+    // A dropped folder goes up in one request, each file with its path.
+    for (var i = 0; i < entry.folder.length; i++) {
+      formData.append('files', entry.folder[i].file);
+      formData.append('paths', entry.folder[i].path);
+    }
+  } else {
+    formData.append('files', entry.file);
+  }
   var opts = { method: 'POST', body: formData };
   if (controller) opts.signal = controller.signal;
 
   fetch('upload', opts)
     .then(function(resp) {
+      if (resp.status === 422 || resp.status === 503) {
+        // Refused by the virus scan: retrying would not help.
+        return resp.json().then(function (body) {
+          var err = new Error(body.error || 'Upload refused');
+          err.refused = true;
+          throw err;
+        });
+      }
       if (!resp.ok) throw new Error('Upload failed: ' + resp.status);
       return resp.json();
     })
     .then(function(refs) {
       entry.ref = refs[0];
+      entry.moreRefs = refs.slice(1); // e.g. an unpacked zip's manifest
       entry.uploading = false;
       entry.abortController = null;
       renderStaging();
@@ -856,7 +2102,8 @@ function startUpload(entry, isRetry) {
     .catch(function(err) {
       entry.abortController = null;
       if (err.name === 'AbortError') return; // user removed chip
-      if (!isRetry) {
+      if (err.refused) entry.failReason = err.message;
+      if (!isRetry && !err.refused) {
         // Auto-retry once after 1s
         setTimeout(function() {
           if (stagedFiles.indexOf(entry) !== -1) {
@@ -920,14 +2167,14 @@ function renderStaging() {
       var icon = document.createElement('div');
       icon.className = 'file-icon';
       var ext = sf.name.split('.').pop().toUpperCase();
-      icon.textContent = ext.length <= 4 ? ext : 'FILE';
+      icon.textContent = sf.name.slice(-1) === '/' ? 'DIR' : ext.length <= 4 ? ext : 'FILE';
       chip.appendChild(icon);
     }
 
     var nameSpan = document.createElement('span');
     nameSpan.className = 'file-name';
     nameSpan.textContent = sf.name;
-    nameSpan.title = sf.uploadFailed ? 'Upload failed \u2014 remove and re-add' : sf.name;
+    nameSpan.title = sf.uploadFailed ? (sf.failReason || 'Upload failed \u2014 remove and re-add') : sf.name;
     chip.appendChild(nameSpan);
 
     var removeBtn = document.createElement('button');
@@ -984,11 +2231,89 @@ dropZone.addEventListener('dragleave', function(e) {
 dropZone.addEventListener('drop', function(e) {
   e.preventDefault();
   chatEl.classList.remove('drag-over');
-  if (e.dataTransfer.files.length > 0) {
-    addStagedFiles(e.dataTransfer.files);
+  // Dropped folders only show up as entries; files go the usual way.
+  var items = e.dataTransfer.items || [];
+  var files = [];
+  for (var i = 0; i < items.length; i++) {
+    var item = items[i].webkitGetAsEntry ? items[i].webkitGetAsEntry() : null;
+    if (item && item.isDirectory) {
+      addStagedFolder(item);
+    } else if (items[i].kind === 'file') {
+      var file = items[i].getAsFile();
+      if (file) files.push(file);
+    }
+  }
+  if (!items.length) files = e.dataTransfer.files;
+  if (files.length > 0) {
+    addStagedFiles(files);
   }
 });
 
+// readDroppedFolder collects every file under a dropped directory entry as
+// {file, path}, path starting with the folder's own name.
+function readDroppedFolder(dirEntry) {
+  return new Promise(function(resolve, reject) {
+    var out = [];
+    var pending = 0;
+    function done() { if (--pending === 0) resolve(out); }
+    function walk(entry) {
+      pending++;
+      if (entry.isFile) {
+        entry.file(function(file) {
+          out.push({ file: file, path: entry.fullPath.replace(/^\//, '') });
+          done();
+        }, reject);
+        return;
+      }
+      var reader = entry.createReader();
+      (function readBatch() {
+        // readEntries returns at most ~100 entries per call.
+        reader.readEntries(function(batch) {
+          if (batch.length === 0) return done();
+          batch.forEach(walk);
+          readBatch();
+        }, reject);
+      })();
+    }
+    walk(dirEntry);
+  });
+}
+
+function addStagedFolder(dirEntry) {
+  var entry = {
+    file: null,
+    folder: null,
+    name: dirEntry.name + '/',
+    previewUrl: null,
+    ref: null,
+    uploading: true,
+    uploadFailed: false,
+    abortController: null
+  };
+  stagedFiles.push(entry);
+  renderStaging();
+  updateSendButton();
+  readDroppedFolder(dirEntry).then(function(files) {
+    if (stagedFiles.indexOf(entry) === -1) return; // removed while reading
+    if (files.length === 0) {
+      entry.uploading = false;
+      entry.uploadFailed = true;
+      entry.failReason = tr('The folder is empty');
+      renderStaging();
+      updateSendButton();
+      return;
+    }
+    entry.folder = files;
+    startUpload(entry);
+  }, function(err) {
+    console.error('Reading dropped folder failed:', err);
+    entry.uploading = false;
+    entry.uploadFailed = true;
+    renderStaging();
+    updateSendButton();
+  });
+}
+
 // Paste to upload — reuses the drag-drop path. The clipboard often carries
 // multiple representations at once (rich text puts text/plain + text/html, and
 // apps like Excel add an image/png snapshot). We only treat a paste as a file
@@ -1102,7 +2427,7 @@ var loaderTimer = null;
 function renderLoaderElapsed(div) {
   var span = div.querySelector('.elapsed');
   if (!span) return;
-  var s = Math.floor((Date.now() - Number(div.dataset.loaderStart)) / 1000);
+  var s = Math.floor((serverNow() - Number(div.dataset.loaderStart)) / 1000);
   span.textContent = s < 60
     ? s + 's'
     : Math.floor(s / 60) + 'm ' + String(s % 60).padStart(2, '0') + 's';
@@ -1119,7 +2444,7 @@ function showLoading() {
   // That keeps the counter continuous with the elapsed-time separators and, on
   // reconnect/replay, correctly shows how long the agent has really been busy
   // instead of restarting at 0s. Falls back to now when there's no prior bubble.
-  div.dataset.loaderStart = String(lastBubbleTs || Date.now());
+  div.dataset.loaderStart = String(lastBubbleTs || serverNow());
   renderLoaderElapsed(div);
   loaderTimer = setInterval(function () { renderLoaderElapsed(div); }, 1000);
   // Insert the loader BEFORE any trailing pending user bubbles so the
@@ -1166,14 +2491,22 @@ function markMessagesConsumed(ids) {
 
 function sendMessage(text, files) {
   if (!activeWs || activeWs.readyState !== WebSocket.OPEN) return;
+  var prompt = promptSeqs[replyTarget] || 0;
   if (pendingAckId) {
-    activeWs.send(JSON.stringify({ type: 'ack', id: pendingAckId, message: text }));
+    activeWs.send(JSON.stringify({ type: 'ack', id: pendingAckId, message: text, prompt: promptSeqs[''] || 0 }));
     pendingAckId = null;
   } else {
-    var msg = { type: 'message', text: text };
+    var msg = { type: 'message', text: text, prompt: prompt };
     if (files && files.length > 0) {
       msg.files = files;
     }
+    if (replyTarget) {
+      msg.session = replyTarget;
+    }
+    if (replyToSeq) {
+      msg.reply_to = replyToSeq;
+      clearReplyTo();
+    }
     activeWs.send(JSON.stringify(msg));
   }
 }
@@ -1244,6 +2577,7 @@ function handleSend() {
   var fileRefs = [];
   for (var i = 0; i < stagedFiles.length; i++) {
     if (stagedFiles[i].ref) fileRefs.push(stagedFiles[i].ref);
+    if (stagedFiles[i].moreRefs) fileRefs = fileRefs.concat(stagedFiles[i].moreRefs);
   }
   if (!text && fileRefs.length === 0) return;
 
@@ -1283,6 +2617,31 @@ function handleSend() {
   sendMessage(text, fileRefs.length > 0 ? fileRefs : undefined);
 }
 
+// "Ask agent": a side question answered through MCP sampling by the agent's
+// model, without entering the agent's queue. Only offered when the server
+// reports a sampling-capable client (canAsk). The question and answer come
+// back as aside bubbles that leave quick replies and the loader alone.
+function setCanAsk(canAsk) {
+  askBtn.hidden = !canAsk;
+}
+
+function handleAsk() {
+  var text = chatInput.value.trim();
+  if (!text || !activeWs || activeWs.readyState !== WebSocket.OPEN) return;
+  activeWs.send(JSON.stringify({ type: 'ask', text: text }));
+  chatInput.value = '';
+  autoGrow();
+  askBtn.disabled = true;
+  askBtn.classList.add('loading');
+}
+
+function finishAsk() {
+  askBtn.disabled = false;
+  askBtn.classList.remove('loading');
+}
+
+askBtn.addEventListener('click', handleAsk);
+
 // Auto-grow textarea
 function autoGrow() {
   chatInput.style.height = 'auto';
@@ -1821,13 +3180,13 @@ function splitIntoChunks(text) {
 
 function speakText(text, onDone) {
   if (typeof speechSynthesis === 'undefined') {
-    addSystemBubble('TTS not supported in this browser');
+    addSystemBubble(tr('TTS not supported in this browser'));
     if (onDone) onDone();
     return;
   }
   var voices = speechSynthesis.getVoices();
   if (voices.length === 0) {
-    addSystemBubble('TTS: no voices available — speech output disabled');
+    addSystemBubble(tr('TTS: no voices available — speech output disabled'));
     if (onDone) onDone();
     return;
   }
@@ -1839,7 +3198,7 @@ function speakText(text, onDone) {
   if (ttsSafetyTimer) { clearTimeout(ttsSafetyTimer); ttsSafetyTimer = null; }
   isSpeaking = true;
   btnVoice.classList.add('speaking');
-  addSystemBubble('Speaking...');
+  addSystemBubble(tr('Speaking...'));
   var ttsStart = Date.now();
   var done = false;
   var keepAlive = null; // (B) periodic resume() to defeat Chrome's ~15s silent-stop bug
@@ -1867,7 +3226,7 @@ function speakText(text, onDone) {
     ttsSafetyTimer = setTimeout(function() {
       if (!done) {
         console.warn('[' + ts() + '] TTS idle watchdog on chunk ' + index + ' (no progress for ' + idleTimeout + 'ms) — speak() may have stalled');
-        addSystemBubble('TTS timed out — future replies will have a play button');
+        addSystemBubble(tr('TTS timed out — future replies will have a play button'));
         ttsUnlocked = false;
         speechSynthesis.cancel();
         finish('idle-watchdog');
@@ -1895,7 +3254,7 @@ function speakText(text, onDone) {
       if (index === 0) {
         var elapsed = Date.now() - ttsStart;
         if (elapsed < 500 && text.length > 20 && /iP(hone|ad|od)/.test(navigator.userAgent)) {
-          addSystemBubble('TTS may be muted — check your device silent/mute switch');
+          addSystemBubble(tr('TTS may be muted — check your device silent/mute switch'));
         }
       }
       if (ttsSafetyTimer) { clearTimeout(ttsSafetyTimer); ttsSafetyTimer = null; }
@@ -1903,7 +3262,7 @@ function speakText(text, onDone) {
     };
     utterance.onerror = function(e) {
       console.error('[' + ts() + '] TTS onerror on chunk ' + index + ':', e.error);
-      addSystemBubble('TTS error: ' + (e.error || 'unknown'));
+      addSystemBubble(tr('TTS error: {0}', e.error || 'unknown'));
       finish('onerror: ' + (e.error || 'unknown'));
     };
     speechSynthesis.speak(utterance);
@@ -2000,19 +3359,19 @@ function pulseLastTtsButton(onDone) {
 function setupSpeechRecognition() {
   // Use webkitSpeechRecognition directly — matches working reference implementation
   if (!('webkitSpeechRecognition' in window)) {
-    addSystemBubble('SpeechRecognition not supported in this browser');
+    addSystemBubble(tr('SpeechRecognition not supported in this browser'));
     return;
   }
   voiceRecognition = new webkitSpeechRecognition();
   voiceRecognition.continuous = true;
   voiceRecognition.interimResults = true;
-  voiceRecognition.lang = 'en-US';
+  voiceRecognition.lang = (typeof SPEECH_LANG !== 'undefined' && SPEECH_LANG) || 'en-US';
 
   voiceRecognition.onstart = function() {
     isListening = true;
     micRetryCount = 0; // reset backoff on successful start
     btnVoice.classList.add('active');
-    addSystemBubble('Listening...');
+    addSystemBubble(tr('Listening...'));
   };
 
   voiceRecognition.onaudiostart = function() {
@@ -2080,7 +3439,7 @@ function setupSpeechRecognition() {
     // Non-retryable errors — give up and disable voice mode
     var fatal = ['not-allowed', 'service-not-allowed', 'language-not-supported'];
     if (fatal.indexOf(e.error) !== -1) {
-      addSystemBubble('Voice error: ' + e.error + ' (cannot retry)');
+      addSystemBubble(tr('Voice error: {0} (cannot retry)', e.error));
       disableVoiceMode();
       return;
     }
@@ -2092,7 +3451,7 @@ function setupSpeechRecognition() {
       return;
     }
     intentionalStop = false;
-    addSystemBubble('Voice error: ' + e.error);
+    addSystemBubble(tr('Voice error: {0}', e.error));
     retryMic();
   };
 
@@ -2111,7 +3470,7 @@ function retryMic() {
   if (isSpeaking) return; // don't restart mic during TTS playback
   if (micRetryTimer) return; // a retry is already scheduled
   if (micRetryCount >= micRetryMax) {
-    addSystemBubble('Mic failed after ' + micRetryMax + ' retries — disabling voice mode');
+    addSystemBubble(tr('Mic failed after {0} retries — disabling voice mode', micRetryMax));
     disableVoiceMode();
     return;
   }
@@ -2146,7 +3505,7 @@ function startListening() {
     voiceRecognition.start();
   } catch(e) {
     console.error('[' + ts() + '] Failed to start recognition:', e);
-    addSystemBubble('Failed to start mic: ' + e.message);
+    addSystemBubble(tr('Failed to start mic: {0}', e.message));
     isListening = false;
     retryMic();
   }
@@ -2190,7 +3549,7 @@ function enableVoiceMode() {
     setTimeout(function() {
       if (!ttsUnlocked) {
         console.warn('[' + ts() + '] TTS warmup did not complete — TTS may be blocked');
-        addSystemBubble('TTS may not work — replies will have a play button');
+        addSystemBubble(tr('TTS may not work — replies will have a play button'));
       }
     }, 3000);
   }
@@ -2219,21 +3578,21 @@ function enableVoiceMode() {
       };
       fallbackWarmup.onerror = function(e) {
         console.error('[' + ts() + '] TTS fallback warmup error:', e.error);
-        addSystemBubble('TTS warmup failed: ' + (e.error || 'unknown'));
+        addSystemBubble(tr('TTS warmup failed: {0}', e.error || 'unknown'));
       };
       speechSynthesis.speak(fallbackWarmup);
       console.log('[' + ts() + '] TTS fallback warmup speak() called (post-getUserMedia)');
     }
     // Warn if TTS voices are unavailable
     if (typeof speechSynthesis !== 'undefined' && speechSynthesis.getVoices().length === 0) {
-      addSystemBubble('Warning: no TTS voices found — agent replies will not be spoken aloud');
+      addSystemBubble(tr('Warning: no TTS voices found — agent replies will not be spoken aloud'));
     }
     // Re-create recognition instance each time voice mode is enabled
     setupSpeechRecognition();
     setTimeout(startListening, 300);
   }).catch(function(err) {
     console.error('Microphone permission denied:', err);
-    addSystemBubble('Mic permission denied: ' + err.message);
+    addSystemBubble(tr('Mic permission denied: {0}', err.message));
   });
 }
 
@@ -2312,6 +3671,47 @@ function speakVerbalReply(text, quickReplies) {
 
 function setStatus(state) {}
 
+// --- Client info ---
+
+// clientInfo describes this browser for the agent's get_client_info tool:
+// its screen, preferences, and whether it can speak and listen.
+function clientInfo() {
+  var uaData = navigator.userAgentData;
+  return {
+    user_agent: navigator.userAgent,
+    platform: (uaData && uaData.platform) || navigator.platform || '',
+    language: navigator.language || '',
+    time_zone: Intl.DateTimeFormat().resolvedOptions().timeZone || '',
+    viewport_width: window.innerWidth,
+    viewport_height: window.innerHeight,
+    pixel_ratio: window.devicePixelRatio || 1,
+    touch: navigator.maxTouchPoints > 0,
+    color_scheme: window.matchMedia && window.matchMedia('(prefers-color-scheme: dark)').matches ? 'dark' : 'light',
+    theme: document.documentElement.getAttribute('data-theme') || '',
+    speech_synthesis: typeof speechSynthesis !== 'undefined',
+    speech_recognition: 'webkitSpeechRecognition' in window,
+  };
+}
+
+var clientInfoTimer = null;
+
+// reportClientInfo sends clientInfo to the server: at once on connect
+// (now), otherwise after a burst of changes settles — dragging a window
+// edge fires resize continuously.
+function reportClientInfo(now) {
+  clearTimeout(clientInfoTimer);
+  clientInfoTimer = setTimeout(function () {
+    if (activeWs && activeWs.readyState === WebSocket.OPEN) {
+      activeWs.send(JSON.stringify({ type: 'clientInfo', info: clientInfo() }));
+    }
+  }, now ? 0 : 500);
+}
+
+window.addEventListener('resize', function () { reportClientInfo(); });
+if (window.matchMedia) {
+  window.matchMedia('(prefers-color-scheme: dark)').addEventListener('change', function () { reportClientInfo(); });
+}
+
 // --- WebSocket connection with exponential backoff ---
 
 var BACKOFF_INITIAL = 1000;
@@ -2347,12 +3747,39 @@ function replayHistory(history) {
 
   for (var i = 0; i < history.length; i++) {
     var event = history[i];
-    switch (event.type) {
+    switch (eventKind(event)) {
       case 'agentMessage':
         if (event.text || (event.files && event.files.length > 0)) {
-          addBubble(event.text, 'agent', event.files, null, event.ts, undefined, event.seq, isForkableTool(event.agent_tool_name));
+          var replayed = addBubble(event.text, 'agent', event.files, event.aside ? 'aside' : null, event.ts, undefined, event.seq, isForkableTool(event.agent_tool_name));
+          decorateBubble(replayed, event);
+          replaceProgress(replayed, event);
+          groupProgress(replayed, event);
         }
-        pendingReplies = (event.quick_replies && event.quick_replies.length > 0) ? event.quick_replies : null;
+        if (!event.aside) {
+          pendingReplies = (event.quick_replies && event.quick_replies.length > 0) ? event.quick_replies : null;
+          agentSpoke(event);
+        }
+        break;
+      case 'agentDisconnected':
+        pendingReplies = null;
+        break;
+      case 'permissionAnswered':
+        showPermissionAnswer(event);
+        break;
+      case 'promptAnswered':
+        showPromptAnswer(event);
+        break;
+      case 'countdownEnded':
+        showCountdownEnded(event);
+        break;
+      case 'locationAnswered':
+        showLocationAnswer(event);
+        break;
+      case 'filePickerAnswered':
+        showFilePickerAnswer(event);
+        break;
+      case 'dateSeparator':
+        addDaySeparator(event);
         break;
       case 'userMessage':
         if (event.id && deletedIds[event.id]) {
@@ -2361,7 +3788,8 @@ function replayHistory(history) {
           break;
         }
         // Freeze unchosen quick replies from the preceding agent message
-        if (pendingReplies) {
+        // (an "Ask agent" aside leaves them live).
+        if (pendingReplies && !event.aside) {
           var chosenText = event.text || '';
           var remaining = [];
           for (var j = 0; j < pendingReplies.length; j++) {
@@ -2381,24 +3809,157 @@ function replayHistory(history) {
           // otherwise rendering as a normal (consumed) bubble matches what
           // every other tab is showing.
           var stillPending = event.id && !consumedIds[event.id];
-          addBubble(displayText, 'user', event.files, isVoiceMsg ? 'voice' : null, event.ts, stillPending ? event.id : undefined);
+          decorateBubble(addBubble(displayText, 'user', event.files, isVoiceMsg ? 'voice' : null, event.ts, stillPending ? event.id : undefined), event, true);
         }
         break;
       case 'draw':
-        if (event.instructions) {
-          addCanvasBubble(event.instructions, true, null);
+        if (event.instructions || event.instructions_ref) {
+          addDrawEvent(event, true, null);
         }
         pendingReplies = (event.quick_replies && event.quick_replies.length > 0) ? event.quick_replies : null;
+        agentSpoke(event);
         break;
       case 'verbalReply':
         if (event.text || (event.files && event.files.length > 0)) {
           var hasReplies = event.quick_replies && event.quick_replies.length > 0;
-          addBubble(event.text, 'agent', event.files, hasReplies ? 'voice lmk' : 'voice brb', event.ts, undefined, event.seq, isForkableTool(event.agent_tool_name));
+          var replayedVoice = addBubble(event.text, 'agent', event.files, hasReplies ? 'voice lmk' : 'voice brb', event.ts, undefined, event.seq, isForkableTool(event.agent_tool_name));
+          decorateBubble(replayedVoice, event);
+          replaceProgress(replayedVoice, event);
         }
         pendingReplies = (event.quick_replies && event.quick_replies.length > 0) ? event.quick_replies : null;
+        agentSpoke(event);
+        break;
+      case 'reaction':
+        showReaction(event);
+        break;
+      case 'pinned':
+      case 'unpinned':
+        showPin(event, event.type === 'pinned');
         break;
+      case 'linkPreview':
+        showLinkPreviews(event);
+        break;
+      case 'messageRedacted':
+        showRedacted(event);
+        break;
+    }
+  }
+}
+
+// --- Older history, a page at a time ---
+
+// renderLoadEarlier keeps the "Load earlier messages" button at the top of
+// the chat while older events remain on the server.
+function renderLoadEarlier() {
+  var btn = document.getElementById('load-earlier');
+  if (!earliestSeq) {
+    if (btn) btn.remove();
+    return;
+  }
+  if (!btn) {
+    btn = document.createElement('button');
+    btn.id = 'load-earlier';
+    btn.type = 'button';
+    btn.addEventListener('click', loadEarlier);
+    messages.insertBefore(btn, messages.firstChild);
+  }
+  btn.disabled = loadingEarlier;
+  btn.textContent = loadingEarlier ? tr('Loading\u2026') : tr('Load earlier messages');
+}
+
+// loadEarlier asks the server for the page of events before earliestSeq.
+function loadEarlier() {
+  if (!earliestSeq || loadingEarlier || !activeWs || activeWs.readyState !== WebSocket.OPEN) return;
+  loadingEarlier = true;
+  renderLoadEarlier();
+  activeWs.send(JSON.stringify({ type: 'history', before: earliestSeq }));
+}
+
+// showEarlierPage replays an older page in front of what is shown, keeping
+// the live state (thinking indicator, reply target, disconnect banner) and
+// the reader's place in the chat.
+function showEarlierPage(data) {
+  loadingEarlier = false;
+  var events = data.events || [];
+  earliestSeq = data.more && events.length > 0 ? events[0].seq : 0;
+  if (events.length > 0) {
+    var fromBottom = document.documentElement.scrollHeight - window.scrollY;
+    var wasLoading = !!document.getElementById('loading-bubble');
+    var target = replyTarget;
+    var disconnected = {};
+    for (var session in disconnectedAgents) disconnected[session] = true;
+    var all = events.concat(shownEvents);
+    replayHistory(all);
+    shownEvents = all;
+    disconnectedAgents = disconnected;
+    renderAgentBanner();
+    setReplyTarget(target);
+    if (wasLoading) showLoading();
+    window.scrollTo(0, document.documentElement.scrollHeight - fromBottom);
+  }
+  renderLoadEarlier();
+  var waiters = earlierWaiters;
+  earlierWaiters = [];
+  waiters.forEach(function (fn) { fn(); });
+}
+
+// loadAllEarlier pages in the whole history, for exports that walk the DOM.
+function loadAllEarlier() {
+  return new Promise(function (resolve) {
+    (function step() {
+      if (!earliestSeq || !activeWs || activeWs.readyState !== WebSocket.OPEN) return resolve();
+      earlierWaiters.push(step);
+      loadEarlier();
+    })();
+  });
+}
+
+// --- MessagePack frames ---
+// The server answers in MessagePack binary frames when the handshake offers
+// WS_PROTOCOLS[0] (smaller than JSON for drawings); it only ever sends
+// nil, booleans, numbers, strings, arrays and maps.
+var WS_PROTOCOLS = ['agent-chat.msgpack', 'agent-chat.json'];
+var utf8Decoder = new TextDecoder();
+
+function msgpackDecode(buf) {
+  var bytes = new Uint8Array(buf);
+  var view = new DataView(bytes.buffer, bytes.byteOffset, bytes.byteLength);
+  var pos = 0;
+  function str(n) { var s = utf8Decoder.decode(bytes.subarray(pos, pos + n)); pos += n; return s; }
+  function arr(n) { var a = new Array(n); for (var i = 0; i < n; i++) a[i] = read(); return a; }
+  function map(n) { var o = {}; for (var i = 0; i < n; i++) { var k = read(); o[k] = read(); } return o; }
+  function read() {
+    var b = bytes[pos++], v;
+    if (b <= 0x7f) return b;
+    if (b >= 0xe0) return b - 0x100;
+    if (b >= 0xa0 && b <= 0xbf) return str(b & 0x1f);
+    if (b >= 0x90 && b <= 0x9f) return arr(b & 0x0f);
+    if (b >= 0x80 && b <= 0x8f) return map(b & 0x0f);
+    switch (b) {
+      case 0xc0: return null;
+      case 0xc2: return false;
+      case 0xc3: return true;
+      case 0xca: v = view.getFloat32(pos); pos += 4; return v;
+      case 0xcb: v = view.getFloat64(pos); pos += 8; return v;
+      case 0xcc: return bytes[pos++];
+      case 0xcd: v = view.getUint16(pos); pos += 2; return v;
+      case 0xce: v = view.getUint32(pos); pos += 4; return v;
+      case 0xcf: v = Number(view.getBigUint64(pos)); pos += 8; return v;
+      case 0xd0: v = view.getInt8(pos); pos += 1; return v;
+      case 0xd1: v = view.getInt16(pos); pos += 2; return v;
+      case 0xd2: v = view.getInt32(pos); pos += 4; return v;
+      case 0xd3: v = Number(view.getBigInt64(pos)); pos += 8; return v;
+      case 0xd9: return str(bytes[pos++]);
+      case 0xda: v = view.getUint16(pos); pos += 2; return str(v);
+      case 0xdb: v = view.getUint32(pos); pos += 4; return str(v);
+      case 0xdc: v = view.getUint16(pos); pos += 2; return arr(v);
+      case 0xdd: v = view.getUint32(pos); pos += 4; return arr(v);
+      case 0xde: v = view.getUint16(pos); pos += 2; return map(v);
+      case 0xdf: v = view.getUint32(pos); pos += 4; return map(v);
     }
+    throw new Error('msgpack: unsupported type 0x' + b.toString(16));
   }
+  return read();
 }
 
 // --- WebSocket connection ---
@@ -2418,6 +3979,26 @@ function teardown() {
   }
 }
 
+// A phone waking up or getting its network back should not sit out the rest
+// of a 30s backoff: retry at once.
+function reconnectNow() {
+  if (activeWs && activeWs.readyState <= WebSocket.OPEN) return;
+  backoffDelay = BACKOFF_INITIAL;
+  connect();
+}
+window.addEventListener('online', reconnectNow);
+document.addEventListener('visibilitychange', function () {
+  if (document.visibilityState === 'visible' && hasConnectedBefore) reconnectNow();
+});
+
+// Installable app: the service worker caches the UI shell for offline
+// starts. Browsers only allow it in a secure context (https or localhost).
+if ('serviceWorker' in navigator && window.isSecureContext) {
+  navigator.serviceWorker.register('./sw.js').catch(function (err) {
+    console.log('[' + ts() + '] service worker registration failed: ' + err);
+  });
+}
+
 function scheduleReconnect() {
   if (reconnectTimer !== null) return;
   reconnectTimer = setTimeout(function () {
@@ -2427,14 +4008,24 @@ function scheduleReconnect() {
   backoffDelay = Math.min(backoffDelay * 2, BACKOFF_MAX);
 }
 
+// FEATURES are what this page renders, declared on connect so agents' tools
+// can fall back (e.g. a drawing sent as an image) for pages that lack one.
+var FEATURES = ['draw', 'files', 'quickReplies', 'verbalReply', 'meta', 'groups', 'replace', 'reactions', 'countdown', 'location', 'data', 'pickFile'];
+if (typeof KATEX !== 'undefined' && KATEX) FEATURES.push('math');
+
 function connect() {
   teardown();
+  streamLive = false;
   setStatus('connecting');
 
   var proto = location.protocol === 'https:' ? 'wss:' : 'ws:';
   var basePath = location.pathname.replace(/\/+$/, '');
-  var wsUrl = proto + '//' + location.host + basePath + '/ws?cursor=' + lastSeq;
-  var ws = new WebSocket(wsUrl);
+  var wsUrl = proto + '//' + location.host + basePath + '/ws?cursor=' + lastSeq + '&paged=1';
+  wsUrl += '&client=' + encodeURIComponent(clientId);
+  if (displayName) wsUrl += '&name=' + encodeURIComponent(displayName);
+  wsUrl += '&features=' + FEATURES.join(',');
+  var ws = new WebSocket(wsUrl, WS_PROTOCOLS);
+  ws.binaryType = 'arraybuffer';
   activeWs = ws;
 
   ws.onopen = function () {
@@ -2449,17 +4040,33 @@ function connect() {
 
   ws.onmessage = function (event) {
     if (ws !== activeWs) return;
-    var data = JSON.parse(event.data);
+    var data = typeof event.data === 'string' ? JSON.parse(event.data) : msgpackDecode(event.data);
 
-    // Track cursor for reconnect — events carry a seq number.
+    // Track cursor for reconnect — events carry a seq number. Once history
+    // is replayed seqs are consecutive: a repeat is a resend already shown,
+    // and a jump means frames were lost, so reconnect from lastSeq and have
+    // the server send the missing ones in order.
     if (data.seq) {
+      if (data.seq <= lastSeq) return;
+      if (streamLive && data.seq > lastSeq + 1) {
+        console.log('[' + ts() + '] Missed events ' + (lastSeq + 1) + '-' + (data.seq - 1) + ', resuming');
+        connect();
+        return;
+      }
       lastSeq = data.seq;
+      shownEvents.push(data);
+      scheduleReceipt();
+      trackPrompt(data);
     }
+    if (data.session_name) setSessionName(data.session_name);
 
-    switch (data.type) {
+    switch (eventKind(data)) {
       case 'connected':
         console.log('[' + ts() + '] Connected event received');
         setStatus('connected');
+        setCanAsk(!!data.canAsk);
+        reportClientInfo(true);
+        syncServerClock();
         var isReconnect = hasConnectedBefore;
         var label = hasConnectedBefore ? 'Reconnected' : 'Connected';
         if (!hasConnectedBefore) {
@@ -2479,6 +4086,7 @@ function connect() {
         if (data.pendingAckId) {
           pendingAckId = data.pendingAckId;
         }
+        if (data.promptSeq) promptSeqs[''] = data.promptSeq;
         // Defer quick replies until historyEnd — showing them now would
         // cause freezeCurrentReplies to freeze the wrong replies when
         // history events stream in.
@@ -2487,7 +4095,17 @@ function connect() {
         enableInput(undefined, !isReconnect);
         break;
 
+      case 'historyTruncated':
+        earliestSeq = data.before;
+        renderLoadEarlier();
+        break;
+
+      case 'historyPage':
+        showEarlierPage(data);
+        break;
+
       case 'historyEnd':
+        streamLive = true;
         // History replay complete — show deferred quick replies if the
         // event stream didn't already set them (e.g. reconnect with no
         // missed events, or last event was an agentMessage with replies).
@@ -2502,7 +4120,22 @@ function connect() {
 
       case 'agentMessage':
         console.log('[' + ts() + '] Agent message received: "' + data.text + '"');
-        addAgentMessage(data.text || '', data.files, null, data.ts, data.seq, isForkableTool(data.agent_tool_name));
+        if (data.aside) {
+          addAgentMessage(data.text || '', data.files, 'aside', data.ts, data.seq, false);
+          finishAsk();
+          break;
+        }
+        // A countdown prompt is answered through its ack, as a draw is
+        // (an open one in history arrives as the connected pendingAckId).
+        if (data.ack_id && streamLive) pendingAckId = data.ack_id;
+        var agentBubble = addAgentMessage(data.text || '', data.files, null, data.ts, data.seq, isForkableTool(data.agent_tool_name));
+        decorateBubble(agentBubble, data);
+        replaceProgress(agentBubble, data);
+        groupProgress(agentBubble, data);
+        agentSpoke(data);
+        if (data.type === 'agentError' && streamLive) {
+          notifyHidden(tr('{0} hit an error: {1}', agentLabel(data.session || ''), data.data.message));
+        }
         // With quick_replies: agent is waiting for input — show replies, hide loading
         // Without quick_replies: progress update — loading stays visible
         if (data.quick_replies && data.quick_replies.length > 0) {
@@ -2517,8 +4150,9 @@ function connect() {
         if (data.ack_id) {
           pendingAckId = data.ack_id;
         }
+        agentSpoke(data);
 
-        addCanvasBubble(data.instructions || [], false, function () {
+        addDrawEvent(data, false, function () {
           enableInput(data.quick_replies); // removes loading via mutual exclusivity
         });
         break;
@@ -2526,7 +4160,10 @@ function connect() {
       case 'verbalReply':
         console.log('[' + ts() + '] Verbal reply received: "' + data.text + '", ttsUnlocked=' + ttsUnlocked + ', isSpeaking=' + isSpeaking);
         var isProgress = !(data.quick_replies && data.quick_replies.length > 0);
-        addAgentMessage(data.text || '', data.files, isProgress ? 'voice brb' : 'voice lmk', data.ts, data.seq, isForkableTool(data.agent_tool_name));
+        var voiceBubble = addAgentMessage(data.text || '', data.files, isProgress ? 'voice brb' : 'voice lmk', data.ts, data.seq, isForkableTool(data.agent_tool_name));
+        decorateBubble(voiceBubble, data);
+        replaceProgress(voiceBubble, data);
+        agentSpoke(data);
         if (isSpeaking) {
           console.log('[' + ts() + '] TTS busy — queuing reply');
           ttsQueue.push({ text: data.text || '', quickReplies: data.quick_replies });
@@ -2536,6 +4173,12 @@ function connect() {
         break;
 
       case 'userMessage':
+        if (data.aside) {
+          // "Ask agent" question — shown, but the agent's turn is unaffected.
+          addBubble(data.text, 'user', data.files, 'aside', data.ts);
+          scrollToBottom(true);
+          break;
+        }
         // Server broadcast of a user message — display the bubble now.
         // Freeze any active quick replies (unchosen ones stay in log).
         freezeCurrentReplies(data.text);
@@ -2546,7 +4189,7 @@ function connect() {
           var displayText = isVoiceMsg ? data.text.replace('\ud83c\udfa4 ', '') : data.text;
           // Pass the server-assigned ID so addBubble can mark this bubble
           // "pending" until userMessagesConsumed clears it.
-          addBubble(displayText, 'user', data.files, isVoiceMsg ? 'voice' : null, data.ts, data.id);
+          decorateBubble(addBubble(displayText, 'user', data.files, isVoiceMsg ? 'voice' : null, data.ts, data.id), data, true);
         }
         // Re-enable input and clear the text now that the message is confirmed
         chatInput.value = '';
@@ -2569,6 +4212,90 @@ function connect() {
         markMessagesConsumed(data.ids || []);
         break;
 
+      case 'reaction':
+        showReaction(data);
+        break;
+
+      case 'pinned':
+      case 'unpinned':
+        showPin(data, data.type === 'pinned');
+        break;
+
+      case 'linkPreview':
+        showLinkPreviews(data);
+        break;
+
+      case 'messageRedacted':
+        showRedacted(data);
+        break;
+
+      case 'permissionAnswered':
+        showPermissionAnswer(data);
+        break;
+
+      case 'promptAnswered':
+        showPromptAnswer(data);
+        break;
+
+      case 'countdownEnded':
+        showCountdownEnded(data);
+        break;
+
+      case 'locationAnswered':
+      case 'locationClosed':
+        showLocationAnswer(data);
+        break;
+
+      case 'filePickerAnswered':
+      case 'filePickerClosed':
+        showFilePickerAnswer(data);
+        break;
+
+      case 'dateSeparator':
+        addDaySeparator(data);
+        break;
+
+      case 'uploadRejected':
+        addAgentMessage(data.reason === 'infected'
+          ? tr('Upload blocked: {0} is infected ({1})', data.name, data.signature)
+          : tr('Upload blocked: {0} could not be virus-scanned', data.name), null, 'warning', Date.now());
+        break;
+
+      case 'promptClosed':
+        showPromptClosed(data);
+        break;
+
+      case 'displayName':
+        displayName = data.name || '';
+        if (displayName) localStorage.setItem(DISPLAY_NAME_KEY, displayName);
+        else localStorage.removeItem(DISPLAY_NAME_KEY);
+        addSystemBubble(displayName ? tr('You are now {0}', displayName) : tr('Display name cleared'));
+        break;
+
+      case 'displayNameRejected':
+        addSystemBubble(tr('Display name not set: {0}', data.message));
+        break;
+
+      case 'viewerJoined':
+      case 'viewerLeft':
+        showViewerCount(data);
+        break;
+
+      case 'agentAlive':
+      case 'agentStalled':
+        showLiveness(data);
+        break;
+
+      case 'agentDisconnected':
+        showAgentDisconnected(data);
+        break;
+
+      case 'internalError':
+        // A handler on the server panicked and recovered (see crash.go).
+        addSystemBubble(tr('Server error: {0}', data.text || ''));
+        if (streamLive) notifyHidden(tr('Server error: {0}', data.text || ''));
+        break;
+
       case 'userMessageDeleted':
         // Some tab (or this one) unsent a pending message before the agent
         // saw it — drop the bubble everywhere.
@@ -2585,12 +4312,38 @@ function connect() {
         console.log('[' + ts() + '] unsend failed for id=' + data.id + ' (agent already read it)');
         break;
 
+      case 'toolCategories':
+        renderToolCategories(data);
+        break;
+
+      case 'highlight':
+        // The agent is pointing at part of a drawing or a message; nothing
+        // is logged, so a reload simply drops it.
+        showHighlight(data);
+        break;
+
+      case 'sessionWiped':
+        // wipe_session erased the chat: drop this tab's state (its cursor
+        // and per-tab flags) and start over from the empty session.
+        try { sessionStorage.clear(); } catch (_) { /* unavailable */ }
+        location.reload();
+        break;
+
       case 'exportRequest':
         // Server is requesting a self-contained HTML export. Build it and
         // POST back; the server writes it to the agent's target path.
         handleExportRequest(data.token, data.image_mode);
         break;
 
+      case 'capabilities':
+        if ('canAsk' in data) setCanAsk(!!data.canAsk);
+        break;
+
+      case 'askFailed':
+        finishAsk();
+        addAgentMessage('Ask failed: ' + (data.error || 'unknown error'), null, 'aside', Date.now());
+        break;
+
       case 'messageQueued':
         // Server confirmed the message is in the queue — now safe to
         // tell the parent frame so it can trigger check_messages.
@@ -2628,7 +4381,7 @@ function connect() {
   ws.onclose = function () {
     if (ws !== activeWs) return;
     console.log('[' + ts() + '] WebSocket closed, reconnecting...');
-    addSystemBubble('Disconnected');
+    addSystemBubble(tr('Disconnected'));
     teardown();
     setStatus('connecting');
     scheduleReconnect();
@@ -2718,6 +4471,7 @@ function dehrefFileLinks(root) {
 // HTML string. opts.imageMode = "fullsize" (default) | "thumbnail".
 async function buildExportHtml(opts) {
   var imageMode = (opts && opts.imageMode) || 'fullsize';
+  await loadAllEarlier();
   var children = messages.children;
   var items = [];
 
@@ -2854,6 +4608,220 @@ async function buildExportHtml(opts) {
   return html;
 }
 
+// --- Search ---
+
+var searchPanel = document.getElementById('search-panel');
+var searchInput = document.getElementById('search-input');
+var searchResults = document.getElementById('search-results');
+var searchTimer = null;
+
+document.getElementById('btn-search').addEventListener('click', function () {
+  searchPanel.hidden = !searchPanel.hidden;
+  if (!searchPanel.hidden) searchInput.focus();
+});
+
+searchInput.addEventListener('input', function () {
+  clearTimeout(searchTimer);
+  searchTimer = setTimeout(runSearch, 200);
+});
+
+searchInput.addEventListener('keydown', function (e) {
+  if (e.key === 'Escape') {
+    searchPanel.hidden = true;
+    chatInput.focus();
+  }
+});
+
+async function runSearch() {
+  var q = searchInput.value.trim();
+  searchResults.innerHTML = '';
+  if (!q) return;
+  var hits;
+  try {
+    var resp = await fetch('api/search?q=' + encodeURIComponent(q));
+    if (!resp.ok) return;
+    hits = await resp.json();
+  } catch (_) {
+    return;
+  }
+  if (q !== searchInput.value.trim()) return; // superseded by newer typing
+  if (hits.length === 0) {
+    searchResults.textContent = tr('No matches');
+    return;
+  }
+  hits.forEach(function (hit) {
+    var row = document.createElement('div');
+    row.className = 'search-hit';
+    var who = document.createElement('span');
+    who.className = 'search-who';
+    who.textContent = (hit.type === 'userMessage' ? 'You' : 'Agent') + ' #' + hit.seq;
+    row.appendChild(who);
+    row.appendChild(document.createTextNode(hit.file ? '[' + hit.file + '] ' + hit.excerpt : hit.excerpt));
+    row.addEventListener('click', function () { jumpToSeq(hit.seq); });
+    searchResults.appendChild(row);
+  });
+}
+
+// --- Shared files ---
+// With -share-dir the server shares a directory read-only: browse it here
+// and click a file to attach it, already on the server, to your message.
+
+var filesPanel = document.getElementById('files-panel');
+var filesPath = document.getElementById('files-path');
+var filesList = document.getElementById('files-list');
+var btnFiles = document.getElementById('btn-files');
+
+if (typeof SHARED_FILES !== 'undefined' && SHARED_FILES) btnFiles.hidden = false;
+
+// Past sessions: the event-log archive (-sessions-dir) as read-only
+// transcripts, in a tab of their own.
+var btnSessions = document.getElementById('btn-sessions');
+if (typeof SESSIONS_ARCHIVE !== 'undefined' && SESSIONS_ARCHIVE) btnSessions.hidden = false;
+btnSessions.addEventListener('click', function () {
+  window.open('./sessions/', '_blank', 'noopener');
+});
+
+btnFiles.addEventListener('click', function () {
+  filesPanel.hidden = !filesPanel.hidden;
+  if (!filesPanel.hidden) browseShared('');
+});
+
+function sizeLabel(bytes) {
+  if (bytes < 1024) return bytes + ' B';
+  if (bytes < 1024 * 1024) return (bytes / 1024).toFixed(1) + ' KB';
+  return (bytes / 1024 / 1024).toFixed(1) + ' MB';
+}
+
+async function browseShared(path) {
+  var listing;
+  try {
+    var resp = await fetch('api/files?path=' + encodeURIComponent(path));
+    if (!resp.ok) throw new Error(await resp.text());
+    listing = await resp.json();
+  } catch (e) {
+    filesList.textContent = String(e.message || e);
+    return;
+  }
+  filesPath.textContent = '/' + listing.path;
+  filesList.innerHTML = '';
+  var entries = listing.entries;
+  if (listing.path) {
+    var up = listing.path.split('/').slice(0, -1).join('/');
+    entries = [{ name: '..', path: up, dir: true }].concat(entries);
+  }
+  if (entries.length === 0) filesList.textContent = tr('No files');
+  entries.forEach(function (entry) {
+    var row = document.createElement('div');
+    row.className = 'shared-entry' + (entry.dir ? ' dir' : '');
+    var name = document.createElement('span');
+    name.className = 'shared-name';
+    name.textContent = entry.dir ? entry.name + '/' : entry.name;
+    row.appendChild(name);
+    if (!entry.dir) {
+      var size = document.createElement('span');
+      size.className = 'shared-size';
+      size.textContent = sizeLabel(entry.size);
+      row.appendChild(size);
+      row.title = tr('Attach {0}', entry.path);
+    }
+    row.addEventListener('click', function () {
+      if (entry.dir) browseShared(entry.path);
+      else stageSharedFile(entry.ref);
+    });
+    filesList.appendChild(row);
+  });
+  if (listing.truncated) {
+    var more = document.createElement('div');
+    more.className = 'shared-size';
+    more.textContent = tr('Only the first {0} entries are shown', listing.entries.length);
+    filesList.appendChild(more);
+  }
+}
+
+// stageSharedFile adds a shared file to the message as a chip, with nothing
+// to upload.
+function stageSharedFile(ref) {
+  if (stagedFiles.some(function (sf) { return sf.ref && sf.ref.url === ref.url; })) return;
+  var isImage = ref.type && ref.type.indexOf('image/') === 0;
+  stagedFiles.push({
+    file: null,
+    name: ref.name,
+    previewUrl: isImage ? ref.url : null,
+    ref: ref,
+    uploading: false,
+    uploadFailed: false,
+    abortController: null
+  });
+  renderStaging();
+  updateSendButton();
+}
+
+// jumpToSeq scrolls the bubble for an event seq into view and flashes it.
+function jumpToSeq(seq) {
+  var target = messages.querySelector('.bubble[data-seq="' + seq + '"]');
+  if (!target) {
+    // Not paged in yet: load older history until it is.
+    if (earliestSeq && seq < earliestSeq) {
+      earlierWaiters.push(function () { jumpToSeq(seq); });
+      loadEarlier();
+    }
+    return;
+  }
+  var folded = target.closest('.progress-group details');
+  if (folded) folded.open = true;
+  target.scrollIntoView({ behavior: 'smooth', block: 'center' });
+  target.classList.add('search-flash');
+  setTimeout(function () { target.classList.remove('search-flash'); }, 1500);
+}
+
+// --- Agent tools ---
+// The user can switch categories of the agent's tools off (see
+// toolcategories.go); the server keeps the choice for every tab and tells
+// the agent its tool list changed.
+
+var toolsPanel = document.getElementById('tools-panel');
+var toolsList = document.getElementById('tools-list');
+var TOOL_CATEGORY_LABELS = {
+  drawing: 'Drawings and highlights',
+  voice: 'Spoken replies',
+  progress: 'Progress updates'
+};
+
+document.getElementById('btn-tools').addEventListener('click', function () {
+  toolsPanel.hidden = !toolsPanel.hidden;
+});
+
+// renderToolCategories redraws the panel from a "toolCategories" event.
+function renderToolCategories(ev) {
+  toolsList.innerHTML = '';
+  (ev.categories || []).forEach(function (cat) {
+    var label = document.createElement('label');
+    label.className = 'tool-category';
+    label.title = cat.tools.join(', ');
+    var box = document.createElement('input');
+    box.type = 'checkbox';
+    box.checked = cat.on;
+    box.addEventListener('change', function () {
+      if (activeWs && activeWs.readyState === WebSocket.OPEN) {
+        activeWs.send(JSON.stringify({ type: 'toolCategory', text: cat.name, on: box.checked }));
+      }
+    });
+    label.appendChild(box);
+    label.appendChild(document.createTextNode(' ' + tr(TOOL_CATEGORY_LABELS[cat.name] || cat.name)));
+    toolsList.appendChild(label);
+  });
+}
+
+// Display name: shown on your bubbles and to the agent, so teammates sharing
+// the chat can tell who said what.
+document.getElementById('btn-name').addEventListener('click', function () {
+  var name = window.prompt(tr('Your display name (blank to clear):'), displayName);
+  if (name === null) return;
+  if (activeWs && activeWs.readyState === WebSocket.OPEN) {
+    activeWs.send(JSON.stringify({ type: 'setName', text: name.trim() }));
+  }
+});
+
 document.getElementById('btn-download').addEventListener('click', async function () {
   var btn = this;
   if (btn.disabled) return;
@@ -2862,7 +4830,8 @@ document.getElementById('btn-download').addEventListener('click', async function
     var html = await buildExportHtml();
     var blob = new Blob([html], { type: 'text/html' });
     var url = URL.createObjectURL(blob);
-    var filename = 'chat-export-' + new Date().toISOString().slice(0, 19).replace(/[T:]/g, '-') + '.html';
+    var slug = sessionSlug();
+    var filename = 'chat-export-' + (slug ? slug + '-' : '') + new Date().toISOString().slice(0, 19).replace(/[T:]/g, '-') + '.html';
     var a = document.createElement('a');
     a.href = url;
     a.download = filename;
@@ -2883,7 +4852,7 @@ async function handleExportRequest(token, imageMode) {
   if (!token) return;
   try {
     var html = await buildExportHtml({ imageMode: imageMode });
-    await fetch('/api/export?token=' + encodeURIComponent(token), {
+    await fetch('api/export?token=' + encodeURIComponent(token), {
       method: 'POST',
       headers: { 'Content-Type': 'text/html; charset=utf-8' },
       body: html,
@@ -2891,7 +4860,7 @@ async function handleExportRequest(token, imageMode) {
   } catch (e) {
     console.error('exportRequest failed', e);
     try {
-      await fetch('/api/export?token=' + encodeURIComponent(token) + '&error=1', {
+      await fetch('api/export?token=' + encodeURIComponent(token) + '&error=1', {
         method: 'POST',
         headers: { 'Content-Type': 'text/plain; charset=utf-8' },
         body: String((e && e.message) || e || 'unknown error'),
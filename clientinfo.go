@@ -0,0 +1,99 @@
+package main
+
+import "sort"
+
+// ClientInfo is what a browser tab reports about its environment when it
+// connects, and again when that changes (a resize, a theme switch), so an
+// agent can fit its output to whoever is watching: a smaller canvas for a
+// phone, no voice where the browser cannot speak. get_client_info returns
+// one per connected tab.
+type ClientInfo struct {
+	Device            string   `json:"device,omitempty"` // "mobile", "tablet" or "desktop", from the User-Agent
+	Connected         int64    `json:"connected"`        // Unix milliseconds when the tab connected
+	Reported          bool     `json:"reported"`         // false until the tab has sent its details
+	UserAgent         string   `json:"user_agent,omitempty"`
+	Platform          string   `json:"platform,omitempty"`
+	Language          string   `json:"language,omitempty"`
+	TimeZone          string   `json:"time_zone,omitempty"`       // IANA name, e.g. "Asia/Singapore"
+	ViewportWidth     int      `json:"viewport_width,omitempty"`  // CSS pixels
+	ViewportHeight    int      `json:"viewport_height,omitempty"` // CSS pixels
+	PixelRatio        float64  `json:"pixel_ratio,omitempty"`
+	Touch             bool     `json:"touch,omitempty"`
+	ColorScheme       string   `json:"color_scheme,omitempty"` // the device's preference: "dark" or "light"
+	Theme             string   `json:"theme,omitempty"`        // the chat's own theme: "dark" or "light"
+	SpeechSynthesis   bool     `json:"speech_synthesis"`       // can read replies aloud
+	SpeechRecognition bool     `json:"speech_recognition"`     // can take voice input
+	Features          []string `json:"features,omitempty"`     // what it declared it renders, on connect (see SetFeatures)
+}
+
+// clean bounds what a tab may claim: strings are clipped, sizes kept sane,
+// and the color schemes limited to "dark" and "light".
+func (c ClientInfo) clean() ClientInfo {
+	clip := func(s string, n int) string {
+		if len(s) > n {
+			return s[:n]
+		}
+		return s
+	}
+	scheme := func(s string) string {
+		if s == "dark" || s == "light" {
+			return s
+		}
+		return ""
+	}
+	c.UserAgent = clip(c.UserAgent, 512)
+	c.Platform = clip(c.Platform, 64)
+	c.Language = clip(c.Language, 35)
+	c.TimeZone = clip(c.TimeZone, 64)
+	c.ViewportWidth = min(max(c.ViewportWidth, 0), 100000)
+	c.ViewportHeight = min(max(c.ViewportHeight, 0), 100000)
+	c.PixelRatio = min(max(c.PixelRatio, 0), 16)
+	c.ColorScheme = scheme(c.ColorScheme)
+	c.Theme = scheme(c.Theme)
+	return c
+}
+
+// SetClientInfo records what the tab reading subscriber ch reported about
+// itself. It is forgotten when the tab disconnects.
+func (eb *EventBus) SetClientInfo(ch chan Event, info ClientInfo) {
+	info = info.clean()
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	if st, ok := eb.subscribers[ch]; ok {
+		st.info = &info
+	}
+}
+
+// ClientInfos describes every connected browser tab, longest connected
+// first. A tab that has not reported yet (or an old page that never will)
+// has only its device hint and connection time, with Reported false.
+func (eb *EventBus) ClientInfos() []ClientInfo {
+	eb.mu.RLock()
+	infos := []ClientInfo{}
+	for ch, device := range eb.viewers {
+		st := eb.subscribers[ch]
+		var info ClientInfo
+		if st.info != nil {
+			info = *st.info
+			info.Reported = true
+		}
+		info.Device = device
+		info.Features = st.features
+		info.Connected = st.since.UnixMilli()
+		infos = append(infos, info)
+	}
+	eb.mu.RUnlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Connected < infos[j].Connected })
+	return infos
+}
+
+// clientInfoReport is get_client_info's result.
+type clientInfoReport struct {
+	Viewers int          `json:"viewers"`
+	Clients []ClientInfo `json:"clients"`
+}
+
+func (eb *EventBus) clientInfoReport() clientInfoReport {
+	clients := eb.ClientInfos()
+	return clientInfoReport{Viewers: len(clients), Clients: clients}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientInfo(t *testing.T) {
+	eb := NewEventBus()
+	phone := eb.SubscribeViewer("mobile")
+	time.Sleep(2 * time.Millisecond)
+	laptop := eb.SubscribeViewer("desktop")
+	eb.SetClientInfo(phone, ClientInfo{
+		UserAgent:       strings.Repeat("x", 2000),
+		ViewportWidth:   390,
+		ViewportHeight:  844,
+		PixelRatio:      3,
+		Touch:           true,
+		ColorScheme:     "purple",
+		Theme:           "light",
+		SpeechSynthesis: true,
+		Device:          "desktop", // the server's hint wins
+	})
+
+	got, _ := callTool(t, eb, "get_client_info", nil)
+	var report clientInfoReport
+	if err := json.Unmarshal([]byte(got), &report); err != nil {
+		t.Fatalf("%v: %s", err, got)
+	}
+	if report.Viewers != 2 || len(report.Clients) != 2 {
+		t.Fatalf("report = %s", got)
+	}
+	p, l := report.Clients[0], report.Clients[1]
+	if !p.Reported || p.Device != "mobile" || p.ViewportWidth != 390 || !p.Touch || p.Theme != "light" || !p.SpeechSynthesis || p.SpeechRecognition {
+		t.Errorf("phone = %+v", p)
+	}
+	if len(p.UserAgent) != 512 || p.ColorScheme != "" {
+		t.Errorf("phone report not cleaned: user agent %d bytes, color scheme %q", len(p.UserAgent), p.ColorScheme)
+	}
+	if l.Reported || l.Device != "desktop" || l.Connected == 0 {
+		t.Errorf("laptop = %+v", l)
+	}
+
+	eb.Unsubscribe(phone)
+	eb.Unsubscribe(laptop)
+	if infos := eb.ClientInfos(); len(infos) != 0 {
+		t.Errorf("after disconnect: %+v", infos)
+	}
+}
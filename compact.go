@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// compactStats summarizes what compactEventLog kept and dropped.
+type compactStats struct {
+	Kept      int
+	Malformed int
+	Withdrawn int // userMessage + userMessageDeleted events removed in pairs
+	Grouped   int // progress updates folded out of the middle of a group
+}
+
+// compactEventLog rewrites the JSONL event log at src into dst (which may be
+// src itself), dropping lines that do not parse and user messages that were
+// withdrawn together with their userMessageDeleted marker — neither ever
+// reaches a replaying client — and the middle of each run of grouped
+// progress updates (see foldedProgress). Kept lines are copied byte-for-byte
+// so fields this build does not know about survive. dst is replaced
+// atomically.
+func compactEventLog(src, dst string) (compactStats, error) {
+	var stats compactStats
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return stats, err
+	}
+
+	type line struct {
+		raw []byte
+		ev  Event
+	}
+	var lines []line
+	withdrawn := map[string]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		ev, err := decodeLoggedEvent(raw)
+		if err != nil {
+			stats.Malformed++
+			continue
+		}
+		if ev.Type == "userMessageDeleted" && ev.ID != "" {
+			withdrawn[ev.ID] = true
+		}
+		lines = append(lines, line{raw: append([]byte(nil), raw...), ev: ev})
+	}
+	if err := scanner.Err(); err != nil {
+		return stats, fmt.Errorf("read %s: %w", src, err)
+	}
+
+	events := make([]Event, len(lines))
+	for i, l := range lines {
+		events[i] = l.ev
+	}
+	folded := foldedProgress(events)
+
+	var buf bytes.Buffer
+	for i, l := range lines {
+		if (l.ev.Type == "userMessage" || l.ev.Type == "userMessageDeleted") && withdrawn[l.ev.ID] {
+			stats.Withdrawn++
+			continue
+		}
+		if folded[i] {
+			stats.Grouped++
+			continue
+		}
+		buf.Write(l.raw)
+		buf.WriteByte('\n')
+		stats.Kept++
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".compact-*")
+	if err != nil {
+		return stats, err
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return stats, err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return stats, err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		os.Remove(tmp.Name())
+		return stats, err
+	}
+	return stats, nil
+}
+
+// foldedProgress picks the events compaction can drop from runs of grouped
+// progress: agentMessages of one session sharing a GroupID with no other
+// bubble of that session between them. A run keeps its first and last
+// update; one in between is dropped unless it carries files or another
+// event points at it (a reply, reaction or pin).
+func foldedProgress(events []Event) map[int]bool {
+	referenced := map[int64]bool{}
+	for _, ev := range events {
+		if ev.ReplyTo != 0 {
+			referenced[ev.ReplyTo] = true
+		}
+	}
+	folded := map[int]bool{}
+	runs := map[string][]int{} // session -> indexes of its current run
+	closeRun := func(session string) {
+		run := runs[session]
+		for j := 1; j < len(run)-1; j++ {
+			if ev := events[run[j]]; len(ev.Files) == 0 && !referenced[ev.Seq] {
+				folded[run[j]] = true
+			}
+		}
+		delete(runs, session)
+	}
+	for i, ev := range events {
+		switch eventKind(ev) {
+		case "agentMessage", "verbalReply", "draw", "userMessage":
+		default:
+			continue // not a bubble: does not break a run
+		}
+		run := runs[ev.Session]
+		if ev.Type == "agentMessage" && ev.GroupID != "" && len(run) > 0 && events[run[0]].GroupID == ev.GroupID {
+			runs[ev.Session] = append(run, i)
+			continue
+		}
+		closeRun(ev.Session)
+		if ev.Type == "agentMessage" && ev.GroupID != "" {
+			runs[ev.Session] = []int{i}
+		}
+	}
+	for session := range runs {
+		closeRun(session)
+	}
+	return folded
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCompactEventLogDropsMalformedAndWithdrawn(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "events.jsonl")
+	log := strings.Join([]string{
+		`{"type":"agentMessage","seq":1,"text":"hi","future":"kept"}`,
+		`{"type":"userMessage","seq":2,"id":"a","text":"keep me"}`,
+		`not json`,
+		`{"type":"userMessage","seq":3,"id":"b","text":"oops"}`,
+		`{"type":"userMessageDeleted","seq":4,"id":"b"}`,
+		`{"type":"userMessagesConsumed","seq":5,"ids":["a"]}`,
+		``,
+	}, "\n")
+	if err := os.WriteFile(src, []byte(log), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if code := runCompact([]string{src}, &out); code != 0 {
+		t.Fatalf("runCompact exit %d", code)
+	}
+	if !strings.Contains(out.String(), "kept 3 events, dropped 1 malformed lines and 2 withdrawn-message events") {
+		t.Errorf("summary = %q", out.String())
+	}
+
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	if strings.Contains(got, "oops") || strings.Contains(got, "userMessageDeleted") || strings.Contains(got, "not json") {
+		t.Errorf("withdrawn or malformed lines survived:\n%s", got)
+	}
+	if !strings.Contains(got, `"future":"kept"`) {
+		t.Errorf("unknown fields should be preserved byte-for-byte:\n%s", got)
+	}
+
+	events, maxSeq, _ := loadEventLog(src)
+	if len(events) != 3 || maxSeq != 5 {
+		t.Errorf("reloaded %d events (maxSeq %d), want 3 (maxSeq 5)", len(events), maxSeq)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, "*.compact-*")); len(leftovers) != 0 {
+		t.Errorf("temp files left behind: %v", leftovers)
+	}
+}
+
+func TestCompactEventLogToSeparateOutput(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "events.jsonl")
+	dst := filepath.Join(dir, "compact.jsonl")
+	orig := "{\"type\":\"agentMessage\",\"seq\":1}\nbroken\n"
+	os.WriteFile(src, []byte(orig), 0644)
+
+	if code := runCompact([]string{"-o", dst, src}, &bytes.Buffer{}); code != 0 {
+		t.Fatalf("runCompact exit %d", code)
+	}
+	if data, _ := os.ReadFile(src); string(data) != orig {
+		t.Errorf("input was modified: %q", data)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "{\"type\":\"agentMessage\",\"seq\":1}\n" {
+		t.Errorf("output = %q", data)
+	}
+}
+
+func TestRunCLIUnknownSubcommand(t *testing.T) {
+	if code := runCLI([]string{"frobnicate"}); code != 2 {
+		t.Errorf("unknown subcommand exit = %d, want 2", code)
+	}
+	if code := runCLI([]string{"compact"}); code != 2 {
+		t.Errorf("compact without a path exit = %d, want 2", code)
+	}
+}
+
+func TestCompactFoldsProgressGroups(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "events.jsonl")
+	log := strings.Join([]string{
+		`{"type":"agentMessage","seq":1,"text":"build 1/5","group_id":"build"}`,
+		`{"type":"agentMessage","seq":2,"text":"build 2/5","group_id":"build"}`,
+		`{"type":"userMessagesConsumed","seq":3,"ids":["x"]}`,
+		`{"type":"agentMessage","seq":4,"text":"build 3/5","group_id":"build"}`,
+		`{"type":"agentMessage","seq":5,"text":"other agent","session":"s2"}`,
+		`{"type":"agentMessage","seq":6,"text":"build 4/5","group_id":"build"}`,
+		`{"type":"agentMessage","seq":7,"text":"build 5/5","group_id":"build"}`,
+		`{"type":"agentMessage","seq":8,"text":"done"}`,
+		`{"type":"agentMessage","seq":9,"text":"test 1/3","group_id":"test"}`,
+		`{"type":"agentMessage","seq":10,"text":"test 2/3","group_id":"test"}`,
+		`{"type":"agentMessage","seq":11,"text":"test 3/3","group_id":"test"}`,
+		`{"type":"reaction","seq":12,"text":"👍","reply_to":10}`,
+		``,
+	}, "\n")
+	if err := os.WriteFile(src, []byte(log), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if code := runCompact([]string{src}, &out); code != 0 {
+		t.Fatalf("runCompact exit %d", code)
+	}
+	if !strings.Contains(out.String(), "folded 3 grouped progress updates") {
+		t.Errorf("summary = %q", out.String())
+	}
+	events, _, _ := loadEventLog(src)
+	var seqs []int64
+	for _, ev := range events {
+		seqs = append(seqs, ev.Seq)
+	}
+	// build keeps 1 and 7 (another session's bubble does not break the
+	// run); test keeps 10 too, since a reaction points at it.
+	want := []int64{1, 3, 5, 7, 8, 9, 10, 11, 12}
+	if !slices.Equal(seqs, want) {
+		t.Errorf("kept seqs = %v, want %v", seqs, want)
+	}
+}
+
+func TestSendProgressGroupID(t *testing.T) {
+	eb := NewEventBus()
+	callTool(t, eb, "send_progress", map[string]any{"text": "build 1/2", "group_id": " build "})
+	callTool(t, eb, "send_progress", map[string]any{"text": "unrelated"})
+	events, _ := eb.History()
+	if len(events) != 2 || events[0].GroupID != "build" || events[1].GroupID != "" {
+		t.Errorf("events = %+v", events)
+	}
+}
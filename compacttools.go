@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// -compact-tools lists each tool with just its first sentence and a
+// pointer to the rest, because the full descriptions (draw's alone runs to
+// dozens of lines) are sent to the agent's model at the start of every
+// session. The full text moves to chat://tools/{name} and the tool-guide
+// prompt, for the agent to read when it first needs a tool.
+
+// toolGuideURI is where a tool's full description is read.
+const toolGuideURI = "chat://tools/"
+
+// maxCompactDescription caps a compact description's first sentence, in
+// characters.
+const maxCompactDescription = 200
+
+// compactDescription is desc's first sentence (cut short if it is long)
+// and where to read the whole of it.
+func compactDescription(name, desc string) string {
+	first, _, _ := strings.Cut(strings.TrimSpace(desc), "\n")
+	if i := strings.Index(first, ". "); i >= 0 {
+		first = first[:i+1]
+	}
+	if utf8.RuneCountInString(first) > maxCompactDescription {
+		r := []rune(first)[:maxCompactDescription]
+		first = string(r)
+		if i := strings.LastIndexByte(first, ' '); i > 0 {
+			first = first[:i]
+		}
+		first += "…"
+	}
+	if first == strings.TrimSpace(desc) {
+		return first
+	}
+	return first + " Full usage: " + toolGuideURI + name
+}
+
+// compactTools switches server to compact tool descriptions: tools/list
+// shortens each one, and chat://tools/{name} and the tool-guide prompt
+// give them in full. Call it once every tool is registered.
+func compactTools(server *mcp.Server) error {
+	tools, err := listTools(server)
+	if err != nil {
+		return err
+	}
+	full := make(map[string]string, len(tools))
+	for _, t := range tools {
+		full[t.Name] = t.Description
+	}
+
+	server.AddResourceTemplate(&mcp.ResourceTemplate{
+		URITemplate: toolGuideURI + "{name}",
+		Name:        "tool-guide",
+		Description: "The full description of tool {name}: how to call it and what it returns. Tools are listed in short with -compact-tools.",
+		MIMEType:    "text/markdown",
+	}, func(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+		uri := req.Params.URI
+		desc, ok := full[strings.TrimPrefix(uri, toolGuideURI)]
+		if !ok || !strings.HasPrefix(uri, toolGuideURI) {
+			return nil, mcp.ResourceNotFoundError(uri)
+		}
+		return &mcp.ReadResourceResult{
+			Contents: []*mcp.ResourceContents{
+				{URI: uri, MIMEType: "text/markdown", Text: toolGuide(strings.TrimPrefix(uri, toolGuideURI), desc)},
+			},
+		}, nil
+	})
+
+	server.AddPrompt(&mcp.Prompt{
+		Name:        "tool-guide",
+		Title:       "How to use the chat tools",
+		Description: "The full descriptions of the agent-chat tools, which -compact-tools lists in short: one tool's, or all of them.",
+		Arguments:   []*mcp.PromptArgument{{Name: "tool", Description: "Only this tool (default: all)"}},
+	}, func(ctx context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		names := make([]string, 0, len(full))
+		if name := strings.TrimSpace(req.Params.Arguments["tool"]); name != "" {
+			if _, ok := full[name]; !ok {
+				return nil, fmt.Errorf("no tool %q", name)
+			}
+			names = append(names, name)
+		} else {
+			for name := range full {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+		}
+		guides := make([]string, len(names))
+		for i, name := range names {
+			guides[i] = toolGuide(name, full[name])
+		}
+		return &mcp.GetPromptResult{
+			Description: "Full descriptions of the agent-chat tools",
+			Messages: []*mcp.PromptMessage{
+				{Role: "user", Content: &mcp.TextContent{Text: strings.Join(guides, "\n")}},
+			},
+		}, nil
+	})
+
+	server.AddReceivingMiddleware(compactToolList)
+	return nil
+}
+
+// toolGuide is a tool's full description as markdown.
+func toolGuide(name, desc string) string {
+	return "# " + name + "\n\n" + strings.TrimSpace(desc) + "\n"
+}
+
+// compactToolList is middleware that shortens the descriptions in a
+// tools/list result.
+func compactToolList(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		res, err := next(ctx, method, req)
+		if list, ok := res.(*mcp.ListToolsResult); ok && err == nil {
+			tools := make([]*mcp.Tool, len(list.Tools))
+			for i, t := range list.Tools {
+				c := *t // the server's own; never changed in place
+				c.Description = compactDescription(t.Name, t.Description)
+				tools[i] = &c
+			}
+			list.Tools = tools
+		}
+		return res, err
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestCompactDescription(t *testing.T) {
+	for _, tc := range []struct{ desc, want string }{
+		{"Get pins.", "Get pins."},
+		{"Draw a diagram. Each call is a slide.", "Draw a diagram. Full usage: chat://tools/x"},
+		{"Draw a diagram\n\nMore.", "Draw a diagram Full usage: chat://tools/x"},
+		{strings.Repeat("word ", 60), strings.TrimSpace(strings.Repeat("word ", 40)) + "… Full usage: chat://tools/x"},
+	} {
+		if got := compactDescription("x", tc.desc); got != tc.want {
+			t.Errorf("compactDescription(%q) = %q, want %q", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestCompactTools(t *testing.T) {
+	server := mcp.NewServer(&mcp.Implementation{Name: "agent-chat", Version: "test"}, nil)
+	registerTools(server, NewEventBus())
+	full, err := listTools(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compactTools(server); err != nil {
+		t.Fatal(err)
+	}
+	short, err := listTools(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var before, after int
+	for i, tool := range short {
+		before += len(full[i].Description)
+		after += len(tool.Description)
+		if strings.Contains(tool.Description, "\n") || len(tool.Description) > maxCompactDescription+80 {
+			t.Errorf("%s: description not compact: %q", tool.Name, tool.Description)
+		}
+	}
+	if after*3 > before {
+		t.Errorf("compact descriptions are %d bytes, the full ones %d", after, before)
+	}
+
+	ctx := context.Background()
+	st, ct := mcp.NewInMemoryTransports()
+	ss, err := server.Connect(ctx, st, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+	cs, err := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "test"}, nil).Connect(ctx, ct, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cs.Close()
+	res, err := cs.ReadResource(ctx, &mcp.ReadResourceParams{URI: "chat://tools/draw"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := res.Contents[0].Text; !strings.HasPrefix(text, "# draw\n") || !strings.Contains(text, "whiteboard://instructions") {
+		t.Errorf("chat://tools/draw = %.200q", text)
+	}
+	if _, err := cs.ReadResource(ctx, &mcp.ReadResourceParams{URI: "chat://tools/nope"}); err == nil {
+		t.Error("read the guide of a tool that does not exist")
+	}
+	prompt, err := cs.GetPrompt(ctx, &mcp.GetPromptParams{Name: "tool-guide", Arguments: map[string]string{"tool": "send_message"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := prompt.Messages[0].Content.(*mcp.TextContent).Text; !strings.HasPrefix(text, "# send_message\n") {
+		t.Errorf("tool-guide send_message = %.200q", text)
+	}
+}
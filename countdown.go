@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A countdown (the confirm_countdown tool) is a veto window: the agent
+// announces an action with Approve/Reject buttons, and unless someone
+// answers within the window it is approved — or, for on_timeout "reject",
+// dropped — by itself. The prompt is a "countdownPrompt" event whose
+// Countdown, in Data, carries the deadline so every tab can show the time
+// left; a "countdownEnded" event records the outcome.
+
+// Bounds and default for confirm_countdown's seconds.
+const (
+	countdownMin     = 3 * time.Second
+	countdownMax     = 10 * time.Minute
+	countdownDefault = 15 * time.Second
+)
+
+// countdownReplies are the prompt's quick replies; any other answer is an
+// intervention, which rejects the action.
+var countdownReplies = []string{"Approve", "Reject"}
+
+// countdownWindow turns confirm_countdown's seconds into the window, the
+// default for 0 and clamped to [countdownMin, countdownMax].
+func countdownWindow(seconds int) time.Duration {
+	if seconds <= 0 {
+		return countdownDefault
+	}
+	return min(max(time.Duration(seconds)*time.Second, countdownMin), countdownMax)
+}
+
+// countdownResult is how a countdown settled.
+type countdownResult struct {
+	Outcome string // "approved" or "rejected"
+	By      string // "user" or "timeout"
+	Reply   string // the user's answer, when By is "user"
+}
+
+// runCountdown publishes text as a countdown prompt and waits for the user's
+// answer or the end of window, whichever is first. onTimeout ("approve" or
+// "reject") is what silence means. It returns ctx's error, after marking the
+// countdown cancelled, when the call ends first.
+func (eb *EventBus) runCountdown(ctx context.Context, text string, window time.Duration, onTimeout string, meta *ToolMeta) (countdownResult, error) {
+	ack := eb.CreateAck()
+	deadline := time.Now().Add(window)
+	prompt := Countdown{Deadline: deadline.UnixMilli(), OnTimeout: onTimeout}
+	e := mustEvent("countdownPrompt", prompt)
+	e.Text, e.QuickReplies, e.AckID, e.AgentToolName, e.Meta = text, countdownReplies, ack.ID, "confirm_countdown", meta
+	seq := eb.Publish(e)
+
+	timer := time.NewTimer(window)
+	defer timer.Stop()
+	var answer string
+	select {
+	case answer = <-ack.Ch:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	// Withdraw the ack unless the answer already took it; an answer that
+	// raced the timer or cancellation wins.
+	if answer == "" && !eb.ResolveAck(ack.ID, "") {
+		answer = <-ack.Ch
+	}
+
+	var res countdownResult
+	switch {
+	case answer != "":
+		res.By = "user"
+		res.Reply = strings.TrimPrefix(strings.TrimPrefix(answer, "ack"), ":")
+		res.Outcome = "rejected"
+		if r := countdownReply(res.Reply); r == "" || r == "approve" {
+			res.Outcome = "approved"
+		}
+	case ctx.Err() != nil:
+		prompt.By = "cancelled"
+		eb.publishCountdownEnded(seq, ack.ID, prompt)
+		return countdownResult{}, ctx.Err()
+	default:
+		res.By = "timeout"
+		res.Outcome = "rejected"
+		if onTimeout == "approve" {
+			res.Outcome = "approved"
+		}
+	}
+	prompt.Outcome, prompt.By = res.Outcome, res.By
+	eb.publishCountdownEnded(seq, ack.ID, prompt)
+	return res, nil
+}
+
+// publishCountdownEnded settles the countdown prompt with seq as c says.
+func (eb *EventBus) publishCountdownEnded(seq int64, ackID string, c Countdown) {
+	e := mustEvent("countdownEnded", c)
+	e.ReplyTo, e.AckID = seq, ackID
+	eb.Publish(e)
+}
+
+// text is the tool result telling the agent whether to go ahead.
+func (r countdownResult) text(window time.Duration) string {
+	switch {
+	case r.By == "timeout" && r.Outcome == "approved":
+		return fmt.Sprintf("Approved: nobody objected within %s. Go ahead.", window)
+	case r.By == "timeout":
+		return fmt.Sprintf("Rejected: nobody approved within %s. Do not go ahead.", window)
+	case r.Outcome == "approved":
+		return "Approved by the user. Go ahead."
+	case countdownReply(r.Reply) == "reject":
+		return "Rejected by the user. Do not go ahead."
+	default:
+		return "The user intervened instead of approving: " + r.Reply + "\n\nDo not go ahead; answer them first.\n\n" + executeNotEchoGuidance
+	}
+}
+
+// countdownReply normalizes an answer for matching against the quick
+// replies, dropping the voice-message prefix (🎤) so a spoken "approve"
+// counts.
+func countdownReply(reply string) string {
+	return strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(reply), "\U0001f3a4")))
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/choonkeat/agent-chat/pkg/wire"
+)
+
+func TestCountdownTimesOut(t *testing.T) {
+	for _, onTimeout := range []string{"approve", "reject"} {
+		eb := NewEventBus()
+		res, err := eb.runCountdown(context.Background(), "Delete merged branches", 30*time.Millisecond, onTimeout, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]string{"approve": "approved", "reject": "rejected"}[onTimeout]
+		if res.Outcome != want || res.By != "timeout" {
+			t.Errorf("%s: result = %+v", onTimeout, res)
+		}
+		events, pending := eb.History()
+		if len(events) != 2 || len(events[0].QuickReplies) != 2 {
+			t.Fatalf("%s: events = %+v", onTimeout, events)
+		}
+		if c, err := wire.DecodeData[Countdown](events[0]); err != nil || events[0].Type != "countdownPrompt" || c.OnTimeout != onTimeout {
+			t.Errorf("%s: prompt = %+v, %v", onTimeout, c, err)
+		}
+		end := events[1]
+		c, err := wire.DecodeData[Countdown](end)
+		if err != nil || end.Type != "countdownEnded" || end.ReplyTo != events[0].Seq || c.Outcome != want || c.By != "timeout" {
+			t.Errorf("%s: end = %+v, %v", onTimeout, end, err)
+		}
+		if pending != "" || eb.LastQuickReplies() != nil || eb.OpenPrompt() != 0 {
+			t.Errorf("%s: prompt still open: ack %q, replies %v", onTimeout, pending, eb.LastQuickReplies())
+		}
+	}
+}
+
+func TestCountdownUserAnswers(t *testing.T) {
+	cases := []struct {
+		answer, outcome, text string
+	}{
+		{"ack:Approve", "approved", "Approved by the user"},
+		{"ack:\U0001f3a4 approve", "approved", "Approved by the user"},
+		{"ack:Reject", "rejected", "Rejected by the user"},
+		{"ack:wait, use staging", "rejected", "intervened instead of approving: wait, use staging"},
+	}
+	for _, c := range cases {
+		eb := NewEventBus()
+		go func() {
+			for eb.PendingAckID() == "" {
+				time.Sleep(time.Millisecond)
+			}
+			eb.ResolveAck(eb.PendingAckID(), c.answer)
+		}()
+		res, err := eb.runCountdown(context.Background(), "Deploy to staging", time.Minute, "approve", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Outcome != c.outcome || res.By != "user" {
+			t.Errorf("%q: result = %+v", c.answer, res)
+		}
+		if got := res.text(time.Minute); !strings.Contains(got, c.text) {
+			t.Errorf("%q: text = %q, want it to contain %q", c.answer, got, c.text)
+		}
+	}
+}
+
+func TestCountdownCancelled(t *testing.T) {
+	eb := NewEventBus()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := eb.runCountdown(ctx, "Restart the server", time.Minute, "approve", nil); err == nil {
+		t.Fatal("want an error once the call is cancelled")
+	}
+	events, pending := eb.History()
+	if len(events) != 2 || events[1].Type != "countdownEnded" {
+		t.Fatalf("events = %+v", events)
+	}
+	if c, err := wire.DecodeData[Countdown](events[1]); err != nil || c.By != "cancelled" || c.Outcome != "" {
+		t.Errorf("end = %+v, %v", c, err)
+	}
+	if pending != "" {
+		t.Errorf("ack %q left pending", pending)
+	}
+}
+
+func TestCountdownWindow(t *testing.T) {
+	for seconds, want := range map[int]time.Duration{0: 15 * time.Second, 1: 3 * time.Second, 30: 30 * time.Second, 3600: 10 * time.Minute} {
+		if got := countdownWindow(seconds); got != want {
+			t.Errorf("countdownWindow(%d) = %s, want %s", seconds, got, want)
+		}
+	}
+}
+
+func TestConfirmCountdownRejectsBadOnTimeout(t *testing.T) {
+	eb := NewEventBus()
+	got, isErr := callTool(t, eb, "confirm_countdown", map[string]any{"text": "Prune caches", "on_timeout": "maybe"})
+	if !isErr || !strings.Contains(got, "on_timeout") {
+		t.Errorf("got %q (error %v), want an on_timeout error", got, isErr)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// A panic in a handler should cost one request, not the chat. The HTTP
+// handlers, the WebSocket goroutines and the MCP tools recover from one:
+// the stack trace goes to the log (and, with -crash-dir, a crash report
+// file), the tabs are sent an "internalError" event saying something
+// broke, and the server carries on.
+
+// crashDir is -crash-dir: where crash reports are written; "" writes none.
+var crashDir string
+
+// reportCrash records panic value v, recovered in where: it logs the stack,
+// writes a crash report when crashDir is set, and publishes an
+// "internalError" event. It returns the message the event carries.
+func reportCrash(where string, v any) string {
+	stack := debug.Stack()
+	msg := fmt.Sprintf("panic in %s: %v", where, v)
+	log.Printf("%s\n%s", msg, stack)
+	if crashDir != "" {
+		if path, err := writeCrashReport(crashDir, time.Now(), where, v, stack); err != nil {
+			log.Printf("crash report: %v", err)
+		} else {
+			log.Printf("crash report written to %s", path)
+		}
+	}
+	if bus != nil {
+		bus.Publish(Event{Type: "internalError", Text: msg})
+	}
+	return msg
+}
+
+// recoverCrash reports a panic in the calling goroutine and stops it there.
+// Defer it at the top of a goroutine: defer recoverCrash("what it does").
+func recoverCrash(where string) {
+	if v := recover(); v != nil {
+		reportCrash(where, v)
+	}
+}
+
+// writeCrashReport writes one crash report into dir and returns its path.
+func writeCrashReport(dir string, at time.Time, where string, v any, stack []byte) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("crash-%s-%d.txt", at.UTC().Format("20060102-150405.000"), os.Getpid()))
+	report := fmt.Sprintf("agent-chat %s (%s)\ntime: %s\nwhere: %s\npanic: %v\n\n%s", version, commit, at.Format(time.RFC3339Nano), where, v, stack)
+	return path, os.WriteFile(path, []byte(report), 0o600)
+}
+
+// recoverHTTP is middleware that turns a panic in h into a 500 and a crash
+// report. http.ErrAbortHandler, the standard way to abort a response, is
+// passed on.
+func recoverHTTP(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			reportCrash(r.Method+" "+r.URL.Path, v)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// recoverTools is middleware that turns a panic in an MCP request into a
+// crash report and an error: for a tool call, an error result the agent
+// can read.
+func recoverTools(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (res mcp.Result, err error) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			where := method
+			call, isCall := req.(*mcp.CallToolRequest)
+			if isCall {
+				where = "tool " + call.Params.Name
+			}
+			msg := reportCrash(where, v)
+			if !isCall {
+				res, err = nil, fmt.Errorf("internal error: %s", msg)
+				return
+			}
+			res, err = &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: "error: internal error (" + msg + "); the server is still running, so you may retry or use another tool."}},
+				IsError: true,
+			}, nil
+		}()
+		return next(ctx, method, req)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// withCrashReports points bus and crashDir at fresh ones for the test.
+func withCrashReports(t *testing.T) string {
+	t.Helper()
+	origBus, origDir := bus, crashDir
+	bus, crashDir = NewEventBus(), t.TempDir()
+	t.Cleanup(func() { bus, crashDir = origBus, origDir })
+	return crashDir
+}
+
+// internalErrors returns the Text of bus's internalError events.
+func internalErrors() []string {
+	history, _ := bus.History()
+	var out []string
+	for _, e := range history {
+		if e.Type == "internalError" {
+			out = append(out, e.Text)
+		}
+	}
+	return out
+}
+
+func TestRecoverHTTP(t *testing.T) {
+	dir := withCrashReports(t)
+	h := recoverHTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/boom" {
+			panic("boom")
+		}
+		w.Write([]byte("ok"))
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/boom", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("GET /boom = %d", rec.Code)
+	}
+	if got := internalErrors(); len(got) != 1 || got[0] != "panic in GET /boom: boom" {
+		t.Errorf("internalError events = %q", got)
+	}
+	reports, _ := filepath.Glob(filepath.Join(dir, "crash-*.txt"))
+	if len(reports) != 1 {
+		t.Fatalf("crash reports = %v", reports)
+	}
+	report, _ := os.ReadFile(reports[0])
+	for _, want := range []string{"where: GET /boom\n", "panic: boom\n", "crash_test.go"} {
+		if !strings.Contains(string(report), want) {
+			t.Errorf("crash report lacks %q:\n%s", want, report)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Body.String() != "ok" {
+		t.Errorf("GET / after a panic = %q", rec.Body)
+	}
+
+	abort := recoverHTTP(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { panic(http.ErrAbortHandler) }))
+	func() {
+		defer func() {
+			if v := recover(); v != http.ErrAbortHandler {
+				t.Errorf("ErrAbortHandler became %v", v)
+			}
+		}()
+		abort.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/abort", nil))
+	}()
+}
+
+func TestRecoverTools(t *testing.T) {
+	withCrashReports(t)
+	server := mcp.NewServer(&mcp.Implementation{Name: "agent-chat", Version: "test"}, nil)
+	server.AddTool(&mcp.Tool{Name: "crash", InputSchema: map[string]any{"type": "object"}}, func(context.Context, *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		var m map[string]int
+		m["x"]++ // nil map
+		return nil, nil
+	})
+	server.AddTool(&mcp.Tool{Name: "fine", InputSchema: map[string]any{"type": "object"}}, func(context.Context, *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "fine"}}}, nil
+	})
+	server.AddReceivingMiddleware(recoverTools)
+
+	text, isErr := callServerTool(t, server, "crash", map[string]any{})
+	if !isErr || !strings.Contains(text, "internal error (panic in tool crash: assignment to entry in nil map)") {
+		t.Errorf("crash = %q (error %v)", text, isErr)
+	}
+	if text, isErr := callServerTool(t, server, "fine", map[string]any{}); isErr || text != "fine" {
+		t.Errorf("fine after a panic = %q (error %v)", text, isErr)
+	}
+	if got := internalErrors(); len(got) != 1 {
+		t.Errorf("internalError events = %q", got)
+	}
+}
+
+func TestRecoverCrash(t *testing.T) {
+	withCrashReports(t)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer recoverCrash("worker")
+		panic("worker failed")
+	}()
+	<-done
+	if got := internalErrors(); len(got) != 1 || got[0] != "panic in worker: worker failed" {
+		t.Errorf("internalError events = %q", got)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+	"os"
+)
+
+// customCSSPath is the -custom-css stylesheet, served at /custom.css after
+// the UI's own so its rules win. Read on every request: restyling is a
+// browser reload away.
+var customCSSPath string
+
+// handleCustomCSS serves GET /custom.css: the -custom-css file, or an empty
+// stylesheet when none is configured (the page always links it).
+func handleCustomCSS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	if customCSSPath == "" {
+		return
+	}
+	css, err := os.ReadFile(customCSSPath)
+	if err != nil {
+		http.Error(w, "/* "+err.Error()+" */", http.StatusInternalServerError)
+		return
+	}
+	w.Write(css)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHandleCustomCSS(t *testing.T) {
+	old := customCSSPath
+	t.Cleanup(func() { customCSSPath = old })
+
+	customCSSPath = ""
+	rec := httptest.NewRecorder()
+	handleCustomCSS(rec, httptest.NewRequest(http.MethodGet, "/custom.css", nil))
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 || rec.Header().Get("Content-Type") != "text/css; charset=utf-8" {
+		t.Errorf("unset: status %d, %d bytes, type %q", rec.Code, rec.Body.Len(), rec.Header().Get("Content-Type"))
+	}
+
+	customCSSPath = filepath.Join(t.TempDir(), "custom.css")
+	os.WriteFile(customCSSPath, []byte(".bubble { font-size: 1rem; }"), 0644)
+	rec = httptest.NewRecorder()
+	handleCustomCSS(rec, httptest.NewRequest(http.MethodGet, "/custom.css", nil))
+	if rec.Body.String() != ".bubble { font-size: 1rem; }" {
+		t.Errorf("body = %q", rec.Body.String())
+	}
+
+	// Edits show without a restart.
+	os.WriteFile(customCSSPath, []byte(".bubble { font-size: 2rem; }"), 0644)
+	rec = httptest.NewRecorder()
+	handleCustomCSS(rec, httptest.NewRequest(http.MethodGet, "/custom.css", nil))
+	if rec.Body.String() != ".bubble { font-size: 2rem; }" {
+		t.Errorf("after edit: body = %q", rec.Body.String())
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Custom tools (-tools-file): site-specific MCP tools defined in a JSON
+// config instead of Go. Each runs a local command with the call's arguments
+// as JSON on stdin, and what it prints on stdout is published to the chat
+// and returned to the agent — "restart the staging service", "screenshot
+// the dashboard" — without recompiling agent-chat.
+//
+//	{"tools": [{
+//	  "name": "restart_staging",
+//	  "description": "Restart the staging web service.",
+//	  "command": ["systemctl", "--user", "restart", "staging-web"],
+//	  "timeout": "30s"
+//	}]}
+
+const (
+	customToolTimeout   = 60 * time.Second
+	customToolMaxOutput = 1 << 20 // stdout bytes kept; the rest is dropped
+	customToolMaxStderr = 4 << 10
+)
+
+var customToolNameRe = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// customToolsConfig is the -tools-file document.
+type customToolsConfig struct {
+	Tools     []customTool     `json:"tools"`
+	Upstreams []upstreamServer `json:"upstreams,omitempty"` // see upstream.go
+}
+
+// customTool is one config-defined tool.
+type customTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Command     []string        `json:"command"`          // argv; not run through a shell
+	Params      json.RawMessage `json:"params,omitempty"` // JSON Schema of the arguments (default: none)
+	Timeout     string          `json:"timeout,omitempty"`
+	Dir         string          `json:"dir,omitempty"` // working directory (default: the project)
+
+	// Output is how stdout reaches the chat: "code" (default, a fenced
+	// block), "markdown" (as is), "images" (one image path per line,
+	// attached) or "none" (returned to the agent only).
+	Output string `json:"output,omitempty"`
+
+	timeout time.Duration
+}
+
+// loadCustomTools reads and validates a -tools-file. Names must not
+// collide with each other or with reserved (built-in) tool names.
+func loadCustomTools(path string, reserved []string) ([]customTool, error) {
+	cfg, err := readToolsFile(path)
+	if err != nil {
+		return nil, err
+	}
+	taken := map[string]bool{}
+	for _, name := range reserved {
+		taken[name] = true
+	}
+	for i := range cfg.Tools {
+		t := &cfg.Tools[i]
+		switch {
+		case !customToolNameRe.MatchString(t.Name):
+			return nil, fmt.Errorf("tool %q: names are 1-64 letters, digits, _ or -", t.Name)
+		case taken[t.Name]:
+			return nil, fmt.Errorf("tool %q: name already in use", t.Name)
+		case len(t.Command) == 0 || t.Command[0] == "":
+			return nil, fmt.Errorf("tool %q: command is required", t.Name)
+		}
+		taken[t.Name] = true
+		switch t.Output {
+		case "":
+			t.Output = "code"
+		case "code", "markdown", "images", "none":
+		default:
+			return nil, fmt.Errorf("tool %q: output must be code, markdown, images or none", t.Name)
+		}
+		t.timeout = customToolTimeout
+		if t.Timeout != "" {
+			if t.timeout, err = time.ParseDuration(t.Timeout); err != nil || t.timeout <= 0 {
+				return nil, fmt.Errorf("tool %q: bad timeout %q", t.Name, t.Timeout)
+			}
+		}
+		if len(t.Params) == 0 {
+			t.Params = json.RawMessage(`{"type":"object"}`)
+		}
+		var schema map[string]any
+		if err := json.Unmarshal(t.Params, &schema); err != nil || schema["type"] != "object" {
+			return nil, fmt.Errorf("tool %q: params must be a JSON Schema with \"type\": \"object\"", t.Name)
+		}
+		if t.Description == "" {
+			t.Description = "Run " + t.Command[0] + " (an operator-defined tool)."
+		}
+	}
+	return cfg.Tools, nil
+}
+
+// readToolsFile decodes a -tools-file, rejecting unknown fields so a typo
+// is an error rather than a silently missing tool.
+func readToolsFile(path string) (*customToolsConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg customToolsConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// toolNames lists the names of the tools registered on server.
+func toolNames(server *mcp.Server) ([]string, error) {
+	tools, err := listTools(server)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(tools))
+	for i, t := range tools {
+		names[i] = t.Name
+	}
+	return names, nil
+}
+
+// listTools lists the tools registered on server, by asking it over an
+// in-memory session the way any client would.
+func listTools(server *mcp.Server) ([]*mcp.Tool, error) {
+	ctx := context.Background()
+	st, ct := mcp.NewInMemoryTransports()
+	ss, err := server.Connect(ctx, st, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer ss.Close()
+	cs, err := mcp.NewClient(&mcp.Implementation{Name: "agent-chat-self", Version: version}, nil).Connect(ctx, ct, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer cs.Close()
+	var tools []*mcp.Tool
+	for tool, err := range cs.Tools(ctx, nil) {
+		if err != nil {
+			return nil, err
+		}
+		tools = append(tools, tool)
+	}
+	return tools, nil
+}
+
+// registerCustomTools adds the config-defined tools to server.
+func registerCustomTools(server *mcp.Server, bus *EventBus, tools []customTool, projectDir string) {
+	for _, t := range tools {
+		t := t
+		server.AddTool(&mcp.Tool{Name: t.Name, Description: t.Description, InputSchema: t.Params}, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			bus := bus.ClientSession(mcpClientKey(req))
+			bus.CancelActiveWait()
+			bus.AckLimbo()
+			stdout, err := t.run(ctx, req.Params.Arguments, projectDir)
+			if err != nil {
+				return &mcp.CallToolResult{
+					Content: []mcp.Content{&mcp.TextContent{Text: "error: " + err.Error()}},
+					IsError: true,
+				}, nil
+			}
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: t.publish(bus, stdout)}},
+			}, nil
+		})
+	}
+}
+
+// run executes the command with args on stdin and returns its stdout.
+func (t customTool) run(ctx context.Context, args json.RawMessage, projectDir string) (string, error) {
+	if len(args) == 0 {
+		args = json.RawMessage(`{}`)
+	}
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, t.Command[0], t.Command[1:]...)
+	cmd.Dir = projectDir
+	if t.Dir != "" {
+		cmd.Dir = t.Dir
+	}
+	cmd.Stdin = bytes.NewReader(args)
+	cmd.Env = append(os.Environ(), "AGENT_CHAT_TOOL="+t.Name, "AGENT_CHAT_URL="+uiURL)
+	stdout := &cappedBuffer{max: customToolMaxOutput}
+	stderr := &cappedBuffer{max: customToolMaxStderr}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	cmd.WaitDelay = 2 * time.Second // don't hang on a grandchild holding the pipes
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("%s timed out after %s", t.Name, t.timeout)
+	}
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = strings.TrimSpace(stdout.String())
+		}
+		if msg != "" {
+			return "", fmt.Errorf("%s: %v: %s", t.Name, err, msg)
+		}
+		return "", fmt.Errorf("%s: %v", t.Name, err)
+	}
+	return strings.TrimRight(stdout.String(), "\n"), nil
+}
+
+// publish shows stdout in the chat as Output says and returns the text for
+// the agent.
+func (t customTool) publish(bus *EventBus, stdout string) string {
+	e := Event{Type: "agentMessage", AgentToolName: t.Name}
+	switch t.Output {
+	case "none":
+		if stdout == "" {
+			return "Done (no output)."
+		}
+		return stdout
+	case "markdown":
+		e.Text = stdout
+	case "images":
+		var paths []string
+		for _, line := range strings.Split(stdout, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				paths = append(paths, line)
+			}
+		}
+		e.Files = resolveImageFiles(paths)
+		if len(e.Files) == 0 {
+			return fmt.Sprintf("No images found in the output:\n%s", stdout)
+		}
+	default:
+		if stdout != "" {
+			e.Text = "```\n" + strings.ReplaceAll(stdout, "```", "` ` `") + "\n```"
+		}
+	}
+	if e.Text == "" && len(e.Files) == 0 {
+		return "Done (no output)."
+	}
+	seq := bus.Publish(e)
+	if t.Output == "images" {
+		return fmt.Sprintf("Published %d image(s) to the chat as #%d.", len(e.Files), seq)
+	}
+	return fmt.Sprintf("Published to the chat as #%d:\n%s", seq, stdout)
+}
+
+// cappedBuffer keeps the first max bytes written and silently drops the
+// rest, so a chatty command cannot balloon memory.
+type cappedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
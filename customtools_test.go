@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func writeToolsFile(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tools.json")
+	if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadCustomTools(t *testing.T) {
+	tools, err := loadCustomTools(writeToolsFile(t, `{"tools": [{"name": "restart_web", "command": ["true"]}]}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tools[0].Output != "code" || tools[0].timeout != customToolTimeout || string(tools[0].Params) != `{"type":"object"}` || tools[0].Description == "" {
+		t.Errorf("defaults = %+v", tools[0])
+	}
+
+	bad := map[string]string{
+		"reserved name":  `{"tools": [{"name": "send_message", "command": ["true"]}]}`,
+		"duplicate name": `{"tools": [{"name": "a", "command": ["true"]}, {"name": "a", "command": ["true"]}]}`,
+		"bad name":       `{"tools": [{"name": "restart web", "command": ["true"]}]}`,
+		"no command":     `{"tools": [{"name": "a"}]}`,
+		"bad output":     `{"tools": [{"name": "a", "command": ["true"], "output": "html"}]}`,
+		"bad timeout":    `{"tools": [{"name": "a", "command": ["true"], "timeout": "soon"}]}`,
+		"array schema":   `{"tools": [{"name": "a", "command": ["true"], "params": {"type": "array"}}]}`,
+		"unknown field":  `{"tools": [{"name": "a", "cmd": ["true"]}]}`,
+	}
+	for what, body := range bad {
+		if _, err := loadCustomTools(writeToolsFile(t, body), []string{"send_message"}); err == nil {
+			t.Errorf("%s: accepted", what)
+		}
+	}
+}
+
+// callCustomTool registers tools on a fresh server and calls one of them.
+func callCustomTool(t *testing.T, eb *EventBus, tools []customTool, name string, args map[string]any) (string, bool) {
+	t.Helper()
+	ctx := context.Background()
+	server := mcp.NewServer(&mcp.Implementation{Name: "agent-chat", Version: "test"}, nil)
+	registerCustomTools(server, eb, tools, t.TempDir())
+	st, ct := mcp.NewInMemoryTransports()
+	ss, err := server.Connect(ctx, st, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+	cs, err := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "test"}, nil).Connect(ctx, ct, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cs.Close()
+	res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: name, Arguments: args})
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return res.Content[0].(*mcp.TextContent).Text, res.IsError
+}
+
+func TestCustomToolRuns(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell commands")
+	}
+	path := writeToolsFile(t, `{"tools": [
+		{"name": "echo_args", "command": ["sh", "-c", "cat; echo; echo \"$AGENT_CHAT_TOOL\""],
+		 "params": {"type": "object", "properties": {"service": {"type": "string"}}}},
+		{"name": "fail", "command": ["sh", "-c", "echo 'unit not found' >&2; exit 3"]},
+		{"name": "slow", "command": ["sh", "-c", "exec /bin/sleep 5"], "timeout": "100ms"},
+		{"name": "quiet", "command": ["sh", "-c", "echo secret"], "output": "none"}
+	]}`)
+	tools, err := loadCustomTools(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eb := NewEventBus()
+
+	got, isErr := callCustomTool(t, eb, tools, "echo_args", map[string]any{"service": "web"})
+	if isErr || !strings.Contains(got, `{"service":"web"}`) || !strings.Contains(got, "echo_args") {
+		t.Errorf("echo_args = %q (error %v)", got, isErr)
+	}
+	history, _ := eb.History()
+	if len(history) != 1 || history[0].AgentToolName != "echo_args" || !strings.HasPrefix(history[0].Text, "```\n{\"service\":\"web\"}") {
+		t.Fatalf("published = %+v", history)
+	}
+
+	if got, isErr := callCustomTool(t, eb, tools, "fail", nil); !isErr || !strings.Contains(got, "unit not found") {
+		t.Errorf("fail = %q (error %v)", got, isErr)
+	}
+	if got, isErr := callCustomTool(t, eb, tools, "slow", nil); !isErr || !strings.Contains(got, "timed out") {
+		t.Errorf("slow = %q (error %v)", got, isErr)
+	}
+	if got, isErr := callCustomTool(t, eb, tools, "quiet", nil); isErr || got != "secret" {
+		t.Errorf("quiet = %q (error %v)", got, isErr)
+	}
+	if history, _ := eb.History(); len(history) != 1 {
+		t.Errorf("failed or output:none calls published: %+v", history[1:])
+	}
+}
+
+func TestCustomToolImages(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell commands")
+	}
+	origDir := uploadDir
+	uploadDir = t.TempDir()
+	t.Cleanup(func() { uploadDir = origDir })
+	shot := filepath.Join(t.TempDir(), "dashboard.png")
+	os.WriteFile(shot, []byte("png"), 0644)
+
+	tools, err := loadCustomTools(writeToolsFile(t, `{"tools": [{"name": "screenshot", "command": ["echo", "`+shot+`"], "output": "images"}]}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eb := NewEventBus()
+	if got, isErr := callCustomTool(t, eb, tools, "screenshot", nil); isErr || !strings.Contains(got, "1 image") {
+		t.Errorf("screenshot = %q (error %v)", got, isErr)
+	}
+	history, _ := eb.History()
+	if len(history) != 1 || len(history[0].Files) != 1 || history[0].Files[0].Name != "dashboard.png" {
+		t.Errorf("published = %+v", history)
+	}
+}
+
+func TestToolNamesListsBuiltins(t *testing.T) {
+	server := mcp.NewServer(&mcp.Implementation{Name: "agent-chat", Version: "test"}, nil)
+	registerTools(server, NewEventBus())
+	names, err := toolNames(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(","+strings.Join(names, ",")+",", ",send_message,") {
+		t.Errorf("toolNames = %v", names)
+	}
+}
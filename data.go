@@ -0,0 +1,26 @@
+package main
+
+import "github.com/choonkeat/agent-chat/pkg/wire"
+
+// eventKind is e's type as the exporters, search and replay treat it. An
+// event with a Data payload (a kind registered with wire.RegisterData)
+// counts as an agent message whose Text is the payload's plain-text
+// rendering, so a new kind shows up in all of them without each learning it.
+// One without Text (the record settling a prompt) keeps its own type.
+func eventKind(e Event) string {
+	if len(e.Data) > 0 && e.Text != "" {
+		return "agentMessage"
+	}
+	return e.Type
+}
+
+// mustEvent is wire.NewEvent for a payload of fixed fields, which cannot
+// fail to marshal; an error is a kind registered with another type, a
+// programming error.
+func mustEvent[T any](eventType string, data T) Event {
+	e, err := wire.NewEvent(eventType, data)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/choonkeat/agent-chat/pkg/wire"
+)
+
+type testChart struct {
+	Title  string    `json:"title"`
+	Values []float64 `json:"values"`
+}
+
+func (c testChart) Summary() string { return "Chart: " + c.Title }
+
+// An event kind nobody has taught the exporters or search still shows up in
+// them, as its plain-text rendering.
+func TestDataEventsAreAgentMessages(t *testing.T) {
+	wire.RegisterData[testChart]("testChart")
+	e, err := wire.NewEvent("testChart", testChart{Title: "Build times", Values: []float64{3, 5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eb := NewEventBus()
+	eb.Publish(e)
+	events, _ := eb.History()
+	logged := events[len(events)-1]
+
+	md := renderChatBubble(logged, &renderState{}, nil)
+	if !strings.Contains(md, "**AGENT**") || !strings.Contains(md, "Chart: Build times") {
+		t.Errorf("markdown = %q", md)
+	}
+	if hit, ok := searchEvent(logged, regexp.MustCompile("Build")); !ok || hit.Type != "testChart" {
+		t.Errorf("search hit = %+v, %v", hit, ok)
+	}
+	if r, ok := replayable(logged); !ok || len(r.Data) == 0 {
+		t.Errorf("replayable = %+v, %v", r, ok)
+	}
+}
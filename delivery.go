@@ -0,0 +1,54 @@
+package main
+
+// Delivery to browser tabs is at-least-once within a session. Publish never
+// blocks, so a tab whose buffer is full misses events; its WebSocket writer
+// notices (Lagged, or a gap in the seqs it reads) and sends the missed
+// events from the history, in order, before anything newer. A tab that
+// still sees a gap — a write cut off by a disconnect — reconnects with the
+// last seq it rendered as its cursor, and the server replays from there.
+// Tabs confirm what they have rendered with receipts, recorded by Acked.
+
+// Lagged returns a channel that is signalled after Publish skips an event
+// for subscriber ch, so its reader can catch up with Missed even when no
+// later event arrives to reveal the gap.
+func (eb *EventBus) Lagged(ch chan Event) <-chan struct{} {
+	eb.mu.RLock()
+	defer eb.mu.RUnlock()
+	if st, ok := eb.subscribers[ch]; ok {
+		return st.lag
+	}
+	return nil
+}
+
+// Missed returns the logged events after seq sent and before seq upto (0
+// for no bound), counting them as resent to subscriber ch.
+func (eb *EventBus) Missed(ch chan Event, sent, upto int64) []Event {
+	var missed []Event
+	for _, ev := range eb.EventsSince(sent) {
+		if upto > 0 && ev.Seq >= upto {
+			break
+		}
+		if ev.Seq > sent {
+			missed = append(missed, ev)
+		}
+	}
+	if len(missed) > 0 {
+		eb.mu.Lock()
+		if st, ok := eb.subscribers[ch]; ok {
+			st.resent += int64(len(missed))
+		}
+		eb.metrics.resent += int64(len(missed))
+		eb.mu.Unlock()
+	}
+	return missed
+}
+
+// Acked records that the browser tab reading ch has rendered every event up
+// to seq.
+func (eb *EventBus) Acked(ch chan Event, seq int64) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	if st, ok := eb.subscribers[ch]; ok {
+		st.acked = max(st.acked, seq)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/choonkeat/agent-chat/pkg/client"
+)
+
+func TestMissedEventsAreResent(t *testing.T) {
+	eb := NewEventBus()
+	stuck := eb.SubscribeViewer("mobile") // never read: its buffer fills up
+	defer eb.Unsubscribe(stuck)
+	n := cap(stuck) + 6
+	for i := 0; i < n; i++ {
+		eb.Publish(Event{Type: "agentMessage", Text: "hi"})
+	}
+
+	select {
+	case <-eb.Lagged(stuck):
+	default:
+		t.Fatal("no lag signal after a drop")
+	}
+	sent := int64(cap(stuck)) // what the reader will find buffered
+	missed := eb.Missed(stuck, sent, 0)
+	if len(missed) != 6 || missed[0].Seq != sent+1 || missed[5].Seq != int64(n) {
+		t.Fatalf("missed = %d events from %d", len(missed), missed[0].Seq)
+	}
+	if got := eb.Missed(stuck, sent, sent+3); len(got) != 2 {
+		t.Errorf("bounded missed = %d events, want 2", len(got))
+	}
+	eb.Acked(stuck, sent)
+	m := eb.BusMetrics()
+	if m.Resent != 8 || m.Subscribers[0].Resent != 8 || m.Subscribers[0].Acked != sent {
+		t.Errorf("metrics = %+v", m)
+	}
+}
+
+func TestWebSocketDeliversEverySeq(t *testing.T) {
+	base := startWSServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := client.Dial(ctx, base, client.Options{ClientID: "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	waitType(t, ctx, c, "historyEnd")
+
+	// A burst bigger than a subscriber's buffer: whatever Publish has to
+	// skip, the tab still gets every event, once and in order.
+	const n = 500
+	go func() {
+		for i := 0; i < n; i++ {
+			bus.Publish(Event{Type: "agentMessage", Text: "tick"})
+		}
+	}()
+	var want int64 = 1
+	for want <= n {
+		f, err := c.Next(ctx)
+		if err != nil {
+			t.Fatalf("after seq %d: %v", want-1, err)
+		}
+		if !f.Logged() {
+			continue
+		}
+		if f.Seq != want {
+			t.Fatalf("got seq %d, want %d", f.Seq, want)
+		}
+		want++
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// demoLog is the sample conversation `-demo` plays: markdown, a progress
+// update, draw slides, a voice reply and a permission prompt — one of each
+// widget, so the UI can be seen (and worked on) without an agent.
+//
+//go:embed demo.jsonl
+var demoLog []byte
+
+const (
+	demoMaxGap    = 4 * time.Second  // cap on a pause between sample events
+	demoReplyWait = 20 * time.Second // how long a quick-reply prompt waits for the viewer
+	demoPlayAgain = "Play again"
+)
+
+// demoEvents parses the embedded sample log.
+func demoEvents() ([]Event, error) {
+	var events []Event
+	scanner := bufio.NewScanner(bytes.NewReader(demoLog))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("demo.jsonl: %w", err)
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
+
+// playDemo publishes events on eb, pausing for the recorded gap between them
+// (capped at maxGap; 0 plays without pauses). Unlike replay, quick replies
+// are kept so the prompts are live: after one, playback waits up to
+// replyWait for the viewer to answer before moving on. Returns ctx's error
+// when cancelled.
+func playDemo(ctx context.Context, eb *EventBus, events []Event, maxGap, replyWait time.Duration) error {
+	var lastTs int64
+	for i, e := range events {
+		if maxGap > 0 && lastTs > 0 && e.Timestamp > lastTs {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(min(time.Duration(e.Timestamp-lastTs)*time.Millisecond, maxGap)):
+			}
+		}
+		lastTs = e.Timestamp
+		if e.Type == "userMessage" {
+			eb.PublishConsumedUserMessage(e.Text, e.Files)
+			continue
+		}
+		eb.Publish(Event{Type: e.Type, Text: e.Text, Files: e.Files, Instructions: e.Instructions, QuickReplies: e.QuickReplies, AgentToolName: e.AgentToolName})
+		// The last prompt is left to answerDemo, which acts on the answer.
+		if len(e.QuickReplies) > 0 && replyWait > 0 && i < len(events)-1 {
+			wctx, cancel := context.WithTimeout(ctx, replyWait)
+			_, err := eb.WaitForMessages(wctx)
+			cancel()
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err == nil {
+				eb.AckLimbo()
+			}
+		}
+	}
+	return nil
+}
+
+// answerDemo handles what the viewer types once playback is over: "Play
+// again" restarts it, anything else gets a reminder that nobody is
+// listening. Runs until ctx is cancelled.
+func answerDemo(ctx context.Context, eb *EventBus, events []Event, maxGap, replyWait time.Duration) error {
+	for {
+		msgs, err := eb.WaitForMessages(ctx)
+		if err != nil {
+			return err
+		}
+		eb.AckLimbo()
+		if msgs[len(msgs)-1].Text == demoPlayAgain {
+			if err := playDemo(ctx, eb, events, maxGap, replyWait); err != nil {
+				return err
+			}
+			continue
+		}
+		eb.Publish(Event{
+			Type:         "agentMessage",
+			Text:         "This is a demo, so no agent will act on that. Start agent-chat from your MCP client to chat for real.",
+			QuickReplies: []string{demoPlayAgain},
+		})
+	}
+}
+
+// runDemo implements `serve -demo`: a temporary HTTP-only server that plays
+// the bundled sample conversation once a browser connects, then stays up
+// until Ctrl+C.
+func runDemo() int {
+	events, err := demoEvents()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "agent-chat -demo: %v\n", err)
+		return 1
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer stop()
+
+	if uploadDir == "" {
+		dir, err := os.MkdirTemp("", "agent-chat-uploads-*")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "agent-chat -demo: %v\n", err)
+			return 1
+		}
+		defer os.RemoveAll(dir)
+		uploadDir = dir
+	}
+	bus = NewEventBus()
+	defer bus.Close()
+	if id, err := newAgentIdentity("Demo agent", "", "🎬"); err == nil {
+		bus.SetIdentity(id)
+	}
+	mcpServerRef = mcp.NewServer(&mcp.Implementation{Name: "agent-chat", Version: version}, nil)
+	if err := ensureHTTPServer(); err != nil {
+		fmt.Fprintf(os.Stderr, "agent-chat -demo: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "The demo starts once a browser connects; press Ctrl+C to stop.\n")
+	if err := bus.WaitForSubscriber(ctx); err != nil {
+		return 0
+	}
+	err = playDemo(ctx, bus, events, demoMaxGap, demoReplyWait)
+	if err == nil {
+		err = answerDemo(ctx, bus, events, demoMaxGap, demoReplyWait)
+	}
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Printf("agent-chat -demo: %v", err)
+		return 1
+	}
+	return 0
+}
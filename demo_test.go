@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDemoEventsCoverTheWidgets(t *testing.T) {
+	events, err := demoEvents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, e := range events {
+		seen[e.Type] = true
+		for _, r := range e.QuickReplies {
+			seen["reply:"+r] = true
+		}
+	}
+	for _, want := range []string{"userMessage", "agentMessage", "verbalReply", "draw", "reply:Allow", "reply:Deny", "reply:" + demoPlayAgain} {
+		if !seen[want] {
+			t.Errorf("sample log has no %s", want)
+		}
+	}
+}
+
+func TestPlayDemo(t *testing.T) {
+	events, err := demoEvents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	eb := NewEventBus()
+	if err := playDemo(context.Background(), eb, events, 0, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	history, _ := eb.History()
+	var users, others int
+	for _, e := range history {
+		switch e.Type {
+		case "userMessage":
+			users++
+		case "userMessagesConsumed":
+		default:
+			others++
+		}
+	}
+	if users+others != len(events) {
+		t.Errorf("published %d user + %d other events, want %d", users, others, len(events))
+	}
+	if q := eb.LastQuickReplies(); len(q) != 1 || q[0] != demoPlayAgain {
+		t.Errorf("pending quick replies = %v", q)
+	}
+
+	// The viewer asks for another run.
+	eb.PushMessage(demoPlayAgain, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- answerDemo(ctx, eb, events, 0, time.Millisecond) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if h, _ := eb.History(); len(h) >= 2*len(history) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("demo did not play again")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("answerDemo = %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+// SetDisplayName records the name a browser's user goes by, keyed by the
+// client id the browser keeps in localStorage, and returns it normalized.
+// Their messages then carry it (Event.From) so the agent, the UI and exports
+// can tell teammates sharing one chat apart. An empty name clears it.
+func (eb *EventBus) SetDisplayName(client, name string) (string, error) {
+	eb.namesMu.Lock()
+	defer eb.namesMu.Unlock()
+	if name == "" {
+		delete(eb.names, client)
+		return "", nil
+	}
+	name, err := normalizeName(name)
+	if err != nil {
+		return "", err
+	}
+	eb.names[client] = name
+	return name, nil
+}
+
+// DisplayName returns the name set for client, or "".
+func (eb *EventBus) DisplayName(client string) string {
+	eb.namesMu.Lock()
+	defer eb.namesMu.Unlock()
+	return eb.names[client]
+}
+
+// userRole is the speaker label for a user turn in exports and transcripts:
+// "USER", or "USER · {name}" when the sender had set a display name.
+func userRole(e Event) string {
+	if e.From != "" {
+		return "USER · " + e.From
+	}
+	return "USER"
+}
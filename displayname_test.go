@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetDisplayName(t *testing.T) {
+	bus := NewEventBus()
+	if name, err := bus.SetDisplayName("c1", "  Ada   L "); err != nil || name != "Ada L" {
+		t.Fatalf("SetDisplayName = %q, %v", name, err)
+	}
+	if _, err := bus.SetDisplayName("c1", "<b>x</b>"); err == nil {
+		t.Error("markup accepted as a name")
+	}
+	if got := bus.DisplayName("c1"); got != "Ada L" {
+		t.Errorf("rejected rename replaced the name: %q", got)
+	}
+	if got := bus.DisplayName("c2"); got != "" {
+		t.Errorf("unknown client named %q", got)
+	}
+	bus.SetDisplayName("c1", "")
+	if got := bus.DisplayName("c1"); got != "" {
+		t.Errorf("name not cleared: %q", got)
+	}
+}
+
+// Who said what reaches the agent, the event log and the export.
+func TestMessagesCarrySender(t *testing.T) {
+	bus := NewEventBus()
+	bus.Receive(UserMessage{Text: "ship it", From: "Ada"})
+	bus.Receive(UserMessage{Text: "wait"})
+
+	events := bus.EventsSince(0)
+	if events[0].From != "Ada" || events[1].From != "" {
+		t.Errorf("event senders = %q, %q", events[0].From, events[1].From)
+	}
+	if p := pendingUserMessages(events); len(p) != 2 || p[0].From != "Ada" {
+		t.Errorf("pending = %+v", p)
+	}
+	got := FormatMessages(bus.DrainMessages())
+	if want := "[Ada] ship it\n\nwait"; got != want {
+		t.Errorf("FormatMessages = %q, want %q", got, want)
+	}
+
+	var st renderState
+	if md := renderChatBubble(events[0], &st, nil); !strings.HasPrefix(md, "**USER · Ada**\n") {
+		t.Errorf("markdown = %q", md)
+	}
+	if md := renderChatBubble(events[1], &st, nil); !strings.HasPrefix(md, "**USER**\n") {
+		t.Errorf("unnamed user: markdown = %q", md)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// The whiteboard references the agent reads as whiteboard:// resources are
+// served to people too, at /docs/, so whoever is debugging an agent's
+// drawing reads what the agent read. The markdown is rendered on the
+// server by markdownHTML, which knows just enough markdown for these files.
+// /docs/gallery draws the example payloads in draw-examples.json, which
+// whiteboard://examples returns as JSON.
+
+//go:embed draw-examples.json
+var drawExamplesJSON string
+
+// referenceDoc is one markdown reference, served at /docs/{Slug}.
+type referenceDoc struct {
+	Slug, Title string
+	Markdown    *string
+}
+
+// referenceDocs are the references /docs/ lists, in its order.
+var referenceDocs = []referenceDoc{
+	{"diagramming-guide", "Diagramming guide", &diagrammingGuideMD},
+	{"instructions", "Instruction reference", &instructionReferenceMD},
+	{"quick-reference", "Quick reference", &quickReferenceMD},
+}
+
+// drawExample is one payload of the gallery: the draw tool's instructions
+// and, optionally, its theme.
+type drawExample struct {
+	Name         string `json:"name"`
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+	Theme        string `json:"theme,omitempty"`
+	Instructions []any  `json:"instructions"`
+}
+
+// drawExamples parses draw-examples.json.
+func drawExamples() ([]drawExample, error) {
+	var examples []drawExample
+	if err := json.Unmarshal([]byte(drawExamplesJSON), &examples); err != nil {
+		return nil, fmt.Errorf("draw-examples.json: %w", err)
+	}
+	return examples, nil
+}
+
+// drawing is the example as draw would publish it: shapes expanded, the
+// theme applied and layers compiled.
+func (ex drawExample) drawing() ([]any, error) {
+	out, err := expandShapes(ex.Instructions)
+	if err != nil {
+		return nil, err
+	}
+	if ex.Theme != "" {
+		palette, err := resolveDrawTheme(ex.Theme, nil)
+		if err != nil {
+			return nil, err
+		}
+		out = palette.apply(out, true)
+	}
+	var scenes drawScenes
+	out, _, err = scenes.compile("", out, func(out []any) error {
+		_, err := drawCanvas(out)
+		return err
+	})
+	return out, err
+}
+
+// handleDocs serves /docs/: an index, each reference rendered as HTML, the
+// gallery, and the examples as JSON at /docs/examples.json.
+func handleDocs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	slug := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/docs/"), ".md")
+	switch slug {
+	case "":
+		var b strings.Builder
+		b.WriteString("<h1>Whiteboard docs</h1>\n<p>The references the agent reads before it draws (as <code>whiteboard://</code> MCP resources), for people debugging its drawings.</p>\n<ul>\n")
+		for _, d := range referenceDocs {
+			fmt.Fprintf(&b, "<li><a href=\"%s\">%s</a></li>\n", d.Slug, html.EscapeString(d.Title))
+		}
+		b.WriteString("<li><a href=\"gallery\">Example gallery</a> (<a href=\"examples.json\">JSON</a>)</li>\n</ul>\n")
+		writeDocsPage(w, "Whiteboard docs", b.String())
+		return
+	case "gallery":
+		body, err := galleryHTML()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeDocsPage(w, "Example gallery", body)
+		return
+	case "examples.json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(drawExamplesJSON))
+		return
+	}
+	for _, d := range referenceDocs {
+		if d.Slug == slug {
+			writeDocsPage(w, d.Title, markdownHTML(*d.Markdown))
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// galleryHTML draws each example next to the payload that draws it.
+func galleryHTML() (string, error) {
+	examples, err := drawExamples()
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteString("<h1>Example gallery</h1>\n<p>Payloads for the <code>draw</code> tool, drawn as exports draw them (clean lines, not hand-drawn). Also available as <code>whiteboard://examples</code>.</p>\n")
+	for _, ex := range examples {
+		drawing, err := ex.drawing()
+		if err != nil {
+			return "", fmt.Errorf("example %s: %w", ex.Name, err)
+		}
+		payload := map[string]any{"instructions": ex.Instructions}
+		if ex.Theme != "" {
+			payload["theme"] = ex.Theme
+		}
+		data, _ := json.MarshalIndent(payload, "", "  ")
+		fmt.Fprintf(&b, "<h2 id=\"%s\">%s</h2>\n<p>%s</p>\n<div class=\"drawing\">%s</div>\n<details><summary>Payload</summary>\n<pre><code class=\"language-json\">%s</code></pre>\n</details>\n",
+			html.EscapeString(ex.Name), html.EscapeString(ex.Title), html.EscapeString(ex.Description), renderDrawSVG(drawing), html.EscapeString(string(data)))
+	}
+	return b.String(), nil
+}
+
+// writeDocsPage writes body in the docs' page layout.
+func writeDocsPage(w http.ResponseWriter, title, body string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>%s · agent-chat</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; max-width: 960px; margin: 2em auto; padding: 0 1em; color: #222; background: #fafafa; line-height: 1.5; }
+nav { font-size: 0.9em; margin-bottom: 1.5em; }
+nav a { margin-right: 1em; }
+code { background: #eef0f3; padding: 0.1em 0.3em; border-radius: 4px; font-size: 0.9em; }
+pre { background: #eef0f3; padding: 0.75em 1em; border-radius: 6px; overflow-x: auto; }
+pre code { background: none; padding: 0; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+th { background: #eef0f3; }
+.drawing svg { max-width: 100%%; height: auto; border-radius: 8px; }
+</style>
+</head>
+<body>
+<nav><a href="./">Docs</a>`, html.EscapeString(title))
+	for _, d := range referenceDocs {
+		fmt.Fprintf(w, `<a href="%s">%s</a>`, d.Slug, html.EscapeString(d.Title))
+	}
+	fmt.Fprintf(w, "<a href=\"gallery\">Gallery</a></nav>\n%s</body>\n</html>\n", body)
+}
+
+// The markdown markdownHTML understands; see also markdownpolicy.go's.
+var (
+	docHeading = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	docOrdered = regexp.MustCompile(`^\d+\.\s+`)
+	docBold    = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	docItalic  = regexp.MustCompile(`\*([^*\s][^*]*?)\*`)
+	docLink    = regexp.MustCompile(`\[([^\]]+)\]\(((?:https?://|/|\.|#)[^)\s]*)\)`)
+	docSlug    = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// markdownHTML renders the markdown the reference docs use: headings,
+// fenced code, tables, lists and paragraphs, with inline code, bold,
+// italics and links. Anything else is shown as text.
+func markdownHTML(md string) string {
+	var b strings.Builder
+	lines := strings.Split(strings.ReplaceAll(md, "\r\n", "\n"), "\n")
+	var para []string
+	flush := func() {
+		if len(para) > 0 {
+			fmt.Fprintf(&b, "<p>%s</p>\n", docInline(strings.Join(para, " ")))
+			para = nil
+		}
+	}
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t")
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flush()
+		case strings.HasPrefix(trimmed, "```"):
+			flush()
+			lang := strings.TrimPrefix(trimmed, "```")
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			class := ""
+			if lang != "" {
+				class = ` class="language-` + html.EscapeString(lang) + `"`
+			}
+			fmt.Fprintf(&b, "<pre><code%s>%s</code></pre>\n", class, html.EscapeString(strings.Join(code, "\n")))
+		case docHeading.MatchString(trimmed):
+			flush()
+			m := docHeading.FindStringSubmatch(trimmed)
+			id := strings.Trim(docSlug.ReplaceAllString(strings.ToLower(m[2]), "-"), "-")
+			fmt.Fprintf(&b, "<h%d id=\"%s\">%s</h%d>\n", len(m[1]), id, docInline(m[2]), len(m[1]))
+		case strings.HasPrefix(trimmed, "|"):
+			flush()
+			var rows [][]string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), "|"); i++ {
+				if len(rows) == 1 && mdTableSep.MatchString(lines[i]) {
+					continue // the header's separator row
+				}
+				rows = append(rows, strings.Split(strings.Trim(strings.TrimSpace(lines[i]), "|"), "|"))
+			}
+			i--
+			b.WriteString("<table>\n")
+			for r, row := range rows {
+				cell := "td"
+				if r == 0 {
+					cell = "th"
+				}
+				b.WriteString("<tr>")
+				for _, c := range row {
+					fmt.Fprintf(&b, "<%s>%s</%s>", cell, docInline(strings.TrimSpace(c)), cell)
+				}
+				b.WriteString("</tr>\n")
+			}
+			b.WriteString("</table>\n")
+		case strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* ") || docOrdered.MatchString(trimmed):
+			flush()
+			tag := "ul"
+			if docOrdered.MatchString(trimmed) {
+				tag = "ol"
+			}
+			fmt.Fprintf(&b, "<%s>\n", tag)
+		items:
+			for ; i < len(lines); i++ {
+				item := strings.TrimSpace(lines[i])
+				switch {
+				case tag == "ul" && (strings.HasPrefix(item, "- ") || strings.HasPrefix(item, "* ")):
+					item = item[2:]
+				case tag == "ol" && docOrdered.MatchString(item):
+					item = docOrdered.ReplaceAllString(item, "")
+				default:
+					i--
+					break items
+				}
+				fmt.Fprintf(&b, "<li>%s</li>\n", docInline(item))
+			}
+			fmt.Fprintf(&b, "</%s>\n", tag)
+		default:
+			para = append(para, trimmed)
+		}
+	}
+	flush()
+	return b.String()
+}
+
+// docInline renders one line's inline markdown, escaping the rest.
+func docInline(s string) string {
+	parts := strings.Split(s, "`")
+	var b strings.Builder
+	for i, p := range parts {
+		if i%2 == 1 && i < len(parts)-1 {
+			b.WriteString("<code>" + html.EscapeString(p) + "</code>")
+			continue
+		}
+		if i%2 == 1 {
+			b.WriteString("`") // an unclosed backtick
+		}
+		t := html.EscapeString(p)
+		t = docLink.ReplaceAllString(t, `<a href="$2">$1</a>`)
+		t = docBold.ReplaceAllString(t, "<strong>$1</strong>")
+		t = docItalic.ReplaceAllString(t, "<em>$1</em>")
+		b.WriteString(t)
+	}
+	return b.String()
+}
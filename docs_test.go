@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDocsPages(t *testing.T) {
+	for path, want := range map[string]string{
+		"/docs/":                  `<a href="gallery">Example gallery</a>`,
+		"/docs/instructions":      `<h2 id="layers">Layers</h2>`,
+		"/docs/quick-reference":   `<pre><code class="language-json">`,
+		"/docs/diagramming-guide": `<td><strong>Sequence diagram</strong></td>`,
+		"/docs/gallery":           `<svg`,
+		"/docs/examples.json":     `"name": "box-and-arrow"`,
+	} {
+		rec := httptest.NewRecorder()
+		handleDocs(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("%s: %d, want %q in:\n%.400s", path, rec.Code, want, rec.Body.String())
+		}
+	}
+	rec := httptest.NewRecorder()
+	handleDocs(rec, httptest.NewRequest(http.MethodGet, "/docs/nope", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("/docs/nope: %d", rec.Code)
+	}
+}
+
+func TestDrawExamplesDraw(t *testing.T) {
+	examples, err := drawExamples()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(examples) == 0 {
+		t.Fatal("no examples")
+	}
+	seen := map[string]bool{}
+	for _, ex := range examples {
+		if ex.Name == "" || ex.Title == "" || ex.Description == "" || seen[ex.Name] {
+			t.Errorf("example %+v: needs a unique name, a title and a description", ex)
+		}
+		seen[ex.Name] = true
+		drawing, err := ex.drawing()
+		if err != nil {
+			t.Errorf("%s: %v", ex.Name, err)
+			continue
+		}
+		for _, raw := range drawing {
+			m, _ := raw.(map[string]any)
+			switch m["type"] {
+			case "defineShape", "useShape", "layer", "dimLayer":
+				t.Errorf("%s: %v survived preparation", ex.Name, m["type"])
+			}
+			if s, ok := m["color"].(string); ok && !strings.HasPrefix(s, "#") {
+				t.Errorf("%s: color %q was not resolved", ex.Name, s)
+			}
+		}
+	}
+}
+
+func TestMarkdownHTML(t *testing.T) {
+	got := markdownHTML("# Title\n\nSome `<code>` and **bold** *(none)* [link](https://example.com).\nSame para.\n\n- one\n- two\n1. first\n\n| a | b |\n|---|---|\n| 1 | <2> |\n\n```json\n{\"x\": 1}\n```\n")
+	for _, want := range []string{
+		`<h1 id="title">Title</h1>`,
+		`<p>Some <code>&lt;code&gt;</code> and <strong>bold</strong> <em>(none)</em> <a href="https://example.com">link</a>. Same para.</p>`,
+		"<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n<ol>\n<li>first</li>\n</ol>",
+		"<tr><th>a</th><th>b</th></tr>\n<tr><td>1</td><td>&lt;2&gt;</td></tr>",
+		`<pre><code class="language-json">{&#34;x&#34;: 1}</code></pre>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+	if got := docInline("[x](javascript:alert(1))"); strings.Contains(got, "<a") {
+		t.Errorf("linked a javascript: URL: %s", got)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/choonkeat/agent-chat/pkg/wire"
+)
+
+// `agent-chat doctor` checks what most often stops a chat from coming up —
+// the port, the upload directory, the event log, Claude Code's transcripts,
+// the browser opener and the UI files built into the binary — and says how
+// to fix each one that fails. It exits 1 when a check fails; warnings alone
+// leave it at 0.
+
+// doctorCheck is one check's verdict.
+type doctorCheck struct {
+	Name   string
+	Status string // "ok", "warn" or "fail"
+	Detail string
+	Fix    string // what to do about a warn or fail
+}
+
+// runDoctor implements `agent-chat doctor`.
+func runDoctor(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	listen := fs.String("listen", "", "listen address to check, as for serve -listen (default: $AGENT_CHAT_PORT, $PORT or a random port)")
+	upload := fs.String("upload-dir", "", "upload directory to check (default: the temp dir, where serve makes one)")
+	eventLog := fs.String("event-log", os.Getenv("AGENT_CHAT_EVENT_LOG"), "event log to check")
+	browser := fs.String("browser", "", "browser command to check, as for serve -browser (default: the system opener)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: agent-chat doctor [flags]\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	home, _ := os.UserHomeDir()
+	embedded, err := clientFS()
+	checks := []doctorCheck{
+		checkListen(*listen),
+		checkUploadDir(*upload),
+		checkEventLog(*eventLog),
+		checkClaudeProjects(home),
+		checkBrowserOpener(currentBrowserEnv(), *browser),
+	}
+	if err != nil {
+		checks = append(checks, doctorCheck{Name: "ui assets", Status: "fail", Detail: err.Error(), Fix: "reinstall agent-chat"})
+	} else {
+		checks = append(checks, checkAssets(embedded))
+	}
+	return printDoctor(out, checks)
+}
+
+// printDoctor writes one line per check, its fix under it, and returns the
+// exit status.
+func printDoctor(out io.Writer, checks []doctorCheck) int {
+	code := 0
+	for _, c := range checks {
+		fmt.Fprintf(out, "%-4s  %-16s %s\n", c.Status, c.Name, c.Detail)
+		if c.Fix != "" && c.Status != "ok" {
+			fmt.Fprintf(out, "      %-16s → %s\n", "", c.Fix)
+		}
+		if c.Status == "fail" {
+			code = 1
+		}
+	}
+	return code
+}
+
+// checkListen tries to listen where serve would.
+func checkListen(spec string) doctorCheck {
+	c := doctorCheck{Name: "port"}
+	if path, ok := strings.CutPrefix(spec, "unix:"); ok {
+		c.Name = "socket"
+		dir := filepath.Dir(path)
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			c.Status, c.Detail, c.Fix = "fail", dir+" does not exist", "create "+dir+" or pick another socket path"
+			return c
+		}
+		if _, err := os.Stat(path); err == nil {
+			c.Status, c.Detail, c.Fix = "warn", path+" exists", "if no agent-chat is using it (`agent-chat list`), serve replaces it"
+			return c
+		}
+		c.Status, c.Detail = "ok", "can create "+path
+		return c
+	}
+	addr := spec
+	if addr == "" {
+		addr = defaultListenAddr()
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		c.Status, c.Detail = "fail", err.Error()
+		c.Fix = "stop what holds it (`agent-chat list` shows running chats), or set AGENT_CHAT_PORT or -listen to another port"
+		return c
+	}
+	ln.Close()
+	if strings.HasSuffix(addr, ":0") {
+		c.Status, c.Detail = "ok", "no fixed port; a free one is picked at startup"
+		return c
+	}
+	c.Status, c.Detail = "ok", addr+" is free"
+	return c
+}
+
+// checkUploadDir writes and removes a file where uploads would go.
+func checkUploadDir(dir string) doctorCheck {
+	c := doctorCheck{Name: "upload dir"}
+	label := dir
+	if dir == "" {
+		dir, label = os.TempDir(), "temp dir "+os.TempDir()
+	} else if err := os.MkdirAll(dir, 0o755); err != nil {
+		c.Status, c.Detail, c.Fix = "fail", err.Error(), "create it or pass a writable -upload-dir"
+		return c
+	}
+	f, err := os.CreateTemp(dir, ".agent-chat-doctor-*")
+	if err != nil {
+		c.Status, c.Detail, c.Fix = "fail", label+": "+err.Error(), "make it writable or pass another -upload-dir"
+		return c
+	}
+	f.Close()
+	os.Remove(f.Name())
+	c.Status, c.Detail = "ok", label+" is writable"
+	return c
+}
+
+// checkEventLog reads an event log the way serve restores it.
+func checkEventLog(path string) doctorCheck {
+	c := doctorCheck{Name: "event log"}
+	if path == "" {
+		c.Status, c.Detail = "ok", "none (AGENT_CHAT_EVENT_LOG unset): history lasts as long as the server"
+		return c
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		c.Status, c.Detail = "ok", path+" not created yet"
+		return c
+	}
+	if err != nil {
+		c.Status, c.Detail, c.Fix = "fail", err.Error(), "make it readable and writable by this user"
+		return c
+	}
+	defer f.Close()
+	events, malformed, newer := 0, 0, 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		ev, err := decodeLoggedEvent(scanner.Bytes())
+		if err != nil {
+			malformed++
+			continue
+		}
+		if ev.SchemaVersion > wire.SchemaVersion {
+			newer++
+		}
+		events++
+	}
+	if err := scanner.Err(); err != nil {
+		c.Status, c.Detail = "fail", fmt.Sprintf("%s: stops after %d events: %v", path, events, err)
+		c.Fix = "a line over 1MB cannot be restored; `agent-chat compact` rewrites the log without it"
+		return c
+	}
+	c.Status, c.Detail = "ok", fmt.Sprintf("%s: %d events", path, events)
+	switch {
+	case malformed > 0:
+		c.Status, c.Detail = "warn", fmt.Sprintf("%s: %d events, %d malformed lines skipped", path, events, malformed)
+		c.Fix = "`agent-chat compact " + path + "` (with no server running) drops them"
+	case newer > 0:
+		c.Status, c.Detail = "warn", fmt.Sprintf("%s: %d events written by a newer agent-chat", path, newer)
+		c.Fix = "upgrade agent-chat; fields this version does not know are ignored"
+	}
+	return c
+}
+
+// checkClaudeProjects checks that Claude Code's session transcripts, which
+// events' tool stamps point into, can be read.
+func checkClaudeProjects(home string) doctorCheck {
+	c := doctorCheck{Name: "claude projects"}
+	dir := filepath.Join(home, ".claude", "projects")
+	entries, err := os.ReadDir(dir)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		c.Status, c.Detail = "warn", dir+" not found"
+		c.Fix = "only needed with Claude Code: run it once here, or ignore this when using another MCP client"
+	case err != nil:
+		c.Status, c.Detail, c.Fix = "fail", err.Error(), "make "+dir+" readable by this user"
+	default:
+		c.Status, c.Detail = "ok", fmt.Sprintf("%s: %d projects", dir, len(entries))
+	}
+	return c
+}
+
+// checkBrowserOpener checks that the command serve opens the chat with is
+// installed.
+func checkBrowserOpener(env browserEnv, browser string) doctorCheck {
+	c := doctorCheck{Name: "browser"}
+	argv := browserCommand(env, browser, false, "http://localhost/")
+	if len(argv) > 2 && argv[0] == "open" && argv[1] == "-na" {
+		c.Status, c.Detail = "ok", "macOS application "+argv[2]
+		return c
+	}
+	path, err := env.lookPath(argv[0])
+	if err != nil {
+		c.Status, c.Detail = "warn", argv[0]+" not found"
+		c.Fix = "open the printed URL yourself, set -browser, or install " + argv[0] + " (-no-browser silences the attempt)"
+		return c
+	}
+	c.Status, c.Detail = "ok", "opens with "+path
+	return c
+}
+
+// doctorAssets are the UI files the page cannot do without.
+var doctorAssets = []string{"index.html", "app.js", "style.css", "canvas-bundle.js"}
+
+// assetRef matches the page's links to its own files.
+var assetRef = regexp.MustCompile(`(?:src|href)="\./([^"?#]+)"`)
+
+// checkAssets checks that the UI files are present and that the page links
+// only to files that exist (or that the server generates).
+func checkAssets(fsys fs.FS) doctorCheck {
+	c := doctorCheck{Name: "ui assets", Fix: "rebuild or reinstall agent-chat; with -static-dir, check that directory's files"}
+	for _, name := range doctorAssets {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil || len(data) == 0 {
+			c.Status, c.Detail = "fail", name+" is missing or empty"
+			return c
+		}
+	}
+	page, _ := fs.ReadFile(fsys, "index.html")
+	if !strings.Contains(string(page), "<!--CONFIG-->") {
+		c.Status, c.Detail = "fail", "index.html has no <!--CONFIG--> marker"
+		return c
+	}
+	generated := map[string]bool{"custom.css": true, "manifest.webmanifest": true}
+	n := 0
+	for _, m := range assetRef.FindAllStringSubmatch(string(page), -1) {
+		if generated[m[1]] {
+			continue
+		}
+		if _, err := fs.Stat(fsys, m[1]); err != nil {
+			c.Status, c.Detail = "fail", "index.html links "+m[1]+", which is missing"
+			return c
+		}
+		n++
+	}
+	c.Status, c.Detail = "ok", fmt.Sprintf("index.html and the %d files it links are present", n)
+	return c
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCheckListen(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if c := checkListen(ln.Addr().String()); c.Status != "fail" || c.Fix == "" {
+		t.Errorf("taken port = %+v", c)
+	}
+	if c := checkListen("127.0.0.1:0"); c.Status != "ok" {
+		t.Errorf("random port = %+v", c)
+	}
+	if c := checkListen("unix:" + filepath.Join(t.TempDir(), "nope", "chat.sock")); c.Status != "fail" {
+		t.Errorf("socket in missing dir = %+v", c)
+	}
+}
+
+func TestCheckUploadDirAndEventLog(t *testing.T) {
+	dir := t.TempDir()
+	if c := checkUploadDir(filepath.Join(dir, "uploads")); c.Status != "ok" {
+		t.Errorf("upload dir = %+v", c)
+	}
+
+	path := filepath.Join(dir, "events.jsonl")
+	if c := checkEventLog(path); c.Status != "ok" || !strings.Contains(c.Detail, "not created yet") {
+		t.Errorf("missing log = %+v", c)
+	}
+	os.WriteFile(path, []byte(`{"type":"agentMessage","seq":1,"text":"hi"}`+"\n{not json\n"), 0o644)
+	if c := checkEventLog(path); c.Status != "warn" || !strings.Contains(c.Detail, "1 events, 1 malformed") || !strings.Contains(c.Fix, "compact") {
+		t.Errorf("malformed log = %+v", c)
+	}
+}
+
+func TestCheckBrowserOpener(t *testing.T) {
+	missing := browserEnv{goos: "linux", lookPath: func(string) (string, error) { return "", errors.New("not found") }}
+	if c := checkBrowserOpener(missing, ""); c.Status != "warn" || !strings.Contains(c.Detail, "xdg-open") {
+		t.Errorf("no xdg-open = %+v", c)
+	}
+	found := browserEnv{goos: "linux", lookPath: func(name string) (string, error) { return "/usr/bin/" + name, nil }}
+	if c := checkBrowserOpener(found, "firefox -P work"); c.Status != "ok" || c.Detail != "opens with /usr/bin/firefox" {
+		t.Errorf("-browser firefox = %+v", c)
+	}
+}
+
+func TestCheckAssets(t *testing.T) {
+	embedded, err := clientFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := checkAssets(embedded); c.Status != "ok" {
+		t.Errorf("embedded assets = %+v", c)
+	}
+	broken := fstest.MapFS{
+		"index.html":       {Data: []byte(`<!--CONFIG--><script src="./gone.js"></script>`)},
+		"app.js":           {Data: []byte("x")},
+		"style.css":        {Data: []byte("x")},
+		"canvas-bundle.js": {Data: []byte("x")},
+	}
+	if c := checkAssets(broken); c.Status != "fail" || !strings.Contains(c.Detail, "gone.js") {
+		t.Errorf("broken link = %+v", c)
+	}
+}
+
+func TestPrintDoctor(t *testing.T) {
+	var out bytes.Buffer
+	code := printDoctor(&out, []doctorCheck{
+		{Name: "port", Status: "ok", Detail: "free"},
+		{Name: "browser", Status: "warn", Detail: "xdg-open not found", Fix: "set -browser"},
+	})
+	if code != 0 || !strings.Contains(out.String(), "→ set -browser") {
+		t.Errorf("warn only: %d\n%s", code, out.String())
+	}
+	if code := printDoctor(&out, []doctorCheck{{Name: "port", Status: "fail"}}); code != 1 {
+		t.Errorf("fail exit = %d", code)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// drawInlineMax is the largest draw payload (marshaled instructions, in
+// bytes) kept inline in the event log. Bigger ones are stored out-of-band
+// and the logged event carries an InstructionsRef instead, so a few
+// thousand-element drawings don't dominate the JSONL file and every
+// reconnect replay. Live subscribers still get the instructions inline.
+var drawInlineMax = 32 << 10
+
+// blobIDRe is what blobStore.put hands out: a truncated SHA-256, hex.
+var blobIDRe = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// blobStore holds out-of-band draw payloads, content-addressed. With a
+// directory (next to the event log) they survive restarts; without one
+// they are kept in memory, as the log itself is.
+type blobStore struct {
+	dir string
+	mu  sync.Mutex
+	mem map[string][]byte
+}
+
+func newBlobStore(dir string) *blobStore {
+	return &blobStore{dir: dir, mem: make(map[string][]byte)}
+}
+
+// logBlobs is the store beside the event log at path: path + ".draw/".
+func logBlobs(path string) *blobStore {
+	return newBlobStore(path + ".draw")
+}
+
+func (s *blobStore) put(data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	id := hex.EncodeToString(sum[:16])
+	if s.dir == "" {
+		s.mu.Lock()
+		s.mem[id] = data
+		s.mu.Unlock()
+		return id, nil
+	}
+	path := filepath.Join(s.dir, id+".json")
+	if _, err := os.Stat(path); err == nil {
+		return id, nil // same drawing already stored
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return "", err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return "", err
+	}
+	return id, os.Rename(tmp, path)
+}
+
+func (s *blobStore) get(id string) ([]byte, error) {
+	if !blobIDRe.MatchString(id) {
+		return nil, os.ErrNotExist
+	}
+	if s.dir == "" {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if data, ok := s.mem[id]; ok {
+			return data, nil
+		}
+		return nil, os.ErrNotExist
+	}
+	return os.ReadFile(filepath.Join(s.dir, id+".json"))
+}
+
+// remove shreds payload id, for a drawing that was redacted.
+func (s *blobStore) remove(id string) error {
+	if !blobIDRe.MatchString(id) {
+		return nil
+	}
+	if s.dir == "" {
+		s.mu.Lock()
+		delete(s.mem, id)
+		s.mu.Unlock()
+		return nil
+	}
+	if err := shredPath(filepath.Join(s.dir, id+".json")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// offload returns the copy of a draw event to log: e itself when its
+// instructions are small, else e with them swapped for a reference. A
+// failed write keeps them inline.
+func (s *blobStore) offload(e Event) Event {
+	if e.Type != "draw" || len(e.Instructions) == 0 {
+		return e
+	}
+	data, err := json.Marshal(e.Instructions)
+	if err != nil || len(data) <= drawInlineMax {
+		return e
+	}
+	id, err := s.put(data)
+	if err != nil {
+		log.Printf("agent-chat: storing draw instructions out of the log: %v", err)
+		return e
+	}
+	e.Instructions, e.InstructionsRef = nil, id
+	return e
+}
+
+// hydrate returns events with every InstructionsRef resolved, for exports
+// and replays that need the drawings themselves. A missing payload leaves
+// the event without instructions.
+func (s *blobStore) hydrate(events []Event) []Event {
+	out := make([]Event, len(events))
+	for i, e := range events {
+		if e.InstructionsRef != "" && e.Instructions == nil {
+			if data, err := s.get(e.InstructionsRef); err == nil {
+				json.Unmarshal(data, &e.Instructions)
+			}
+		}
+		out[i] = e
+	}
+	return out
+}
+
+// FullHistory is History with out-of-band drawings filled back in.
+func (eb *EventBus) FullHistory() []Event {
+	events, _ := eb.History()
+	return eb.blobs.hydrate(events)
+}
+
+// handleInstructions serves GET /api/instructions/<ref>: the draw
+// instructions a logged event points to.
+func handleInstructions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := bus.blobs.get(strings.TrimPrefix(r.URL.Path, "/api/instructions/"))
+	if errors.Is(err, os.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable") // content-addressed
+	w.Write(data)
+}
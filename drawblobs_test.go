@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func bigDrawing(n int) []any {
+	var instructions []any
+	for i := 0; i < n; i++ {
+		instructions = append(instructions, map[string]any{"type": "drawRect", "x": i, "y": i, "width": 10, "height": 10, "color": "#ffffff"})
+	}
+	return instructions
+}
+
+func TestDrawInstructionsOutOfBand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	eb, err := NewEventBusWithLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := eb.Observe()
+	big, small := bigDrawing(1000), bigDrawing(2)
+	eb.Publish(Event{Type: "draw", Instructions: big})
+	eb.Publish(Event{Type: "draw", Instructions: small})
+	eb.Close()
+
+	if live := <-sub; len(live.Instructions) != len(big) || live.InstructionsRef != "" {
+		t.Errorf("live broadcast lost its instructions: %d, ref %q", len(live.Instructions), live.InstructionsRef)
+	}
+	history, _ := eb.History()
+	if history[0].Instructions != nil || history[0].InstructionsRef == "" {
+		t.Fatalf("big drawing logged inline: ref %q", history[0].InstructionsRef)
+	}
+	if len(history[1].Instructions) != 2 || history[1].InstructionsRef != "" {
+		t.Errorf("small drawing not inline: %+v", history[1])
+	}
+	if data, _ := os.ReadFile(path); len(data) > drawInlineMax {
+		t.Errorf("event log is %d bytes", len(data))
+	}
+
+	// After a restart the reference still resolves, over HTTP and for exports.
+	reloaded, err := NewEventBusWithLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+	if full := reloaded.FullHistory(); len(full[0].Instructions) != len(big) {
+		t.Errorf("hydrated %d instructions", len(full[0].Instructions))
+	}
+	orig := bus
+	bus = reloaded
+	t.Cleanup(func() { bus = orig })
+	for ref, want := range map[string]int{history[0].InstructionsRef: http.StatusOK, strings.Repeat("0", 32): http.StatusNotFound, "../events.jsonl": http.StatusNotFound} {
+		rec := httptest.NewRecorder()
+		handleInstructions(rec, httptest.NewRequest(http.MethodGet, "/api/instructions/"+ref, nil))
+		if rec.Code != want {
+			t.Errorf("GET %s = %d, want %d", ref, rec.Code, want)
+		}
+		if want == http.StatusOK && !strings.HasPrefix(rec.Body.String(), `[{"color":"#ffffff"`) {
+			t.Errorf("GET %s = %.40s", ref, rec.Body)
+		}
+	}
+}
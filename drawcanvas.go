@@ -0,0 +1,107 @@
+package main
+
+import "fmt"
+
+// Canvas-level draw instructions, for diagrams bigger than one screen:
+//
+//	{"type":"setCanvas","width":1800,"height":1100,"background":"#fffef9"}
+//	{"type":"setViewport","x":0,"y":0,"width":900,"height":550}
+//	{"type":"zoomTo","x":900,"y":550,"width":900,"height":550,"duration":800}
+//
+// setCanvas sizes the board for the whole drawing (once, anywhere in it).
+// setViewport shows just a region of it from that point of the drawing on,
+// and zoomTo pans and zooms there smoothly, so an agent can walk the viewer
+// through a large diagram as it is drawn. They are checked here before the
+// drawing is published and kept in its instructions; the browser acts on
+// them, and exports show the whole board.
+
+// Bounds on a board's size and a zoomTo's duration.
+const (
+	minCanvasSize   = 100
+	maxCanvasSize   = 4000
+	maxZoomDuration = 10000
+)
+
+// canvasSpec is the board a drawing is drawn on.
+type canvasSpec struct {
+	Width, Height float64
+	Background    string
+}
+
+// drawCanvas checks instructions' canvas-level instructions and returns the
+// board they draw on: the default one unless setCanvas says otherwise.
+func drawCanvas(instructions []any) (canvasSpec, error) {
+	spec := canvasSpec{Width: drawCanvasWidth, Height: drawCanvasHeight, Background: drawBackground}
+	num := func(m map[string]any, key string) (float64, bool) {
+		v, ok := m[key].(float64)
+		return v, ok
+	}
+	set := -1
+	for i, raw := range instructions {
+		m, ok := raw.(map[string]any)
+		if !ok || m["type"] != "setCanvas" {
+			continue
+		}
+		if set >= 0 {
+			return spec, fmt.Errorf("instruction %d: setCanvas is already given at %d; a drawing has one canvas", i, set)
+		}
+		set = i
+		w, okW := num(m, "width")
+		h, okH := num(m, "height")
+		if !okW || !okH || w < minCanvasSize || h < minCanvasSize || w > maxCanvasSize || h > maxCanvasSize {
+			return spec, fmt.Errorf("instruction %d: setCanvas needs a width and height from %d to %d", i, minCanvasSize, maxCanvasSize)
+		}
+		spec.Width, spec.Height = w, h
+		if bg, ok := m["background"]; ok {
+			s, ok := bg.(string)
+			if !ok || s == "" {
+				return spec, fmt.Errorf("instruction %d: setCanvas background must be a CSS color", i)
+			}
+			spec.Background = s
+		}
+	}
+	for i, raw := range instructions {
+		m, ok := raw.(map[string]any)
+		if !ok || (m["type"] != "setViewport" && m["type"] != "zoomTo") {
+			continue
+		}
+		x, okX := num(m, "x")
+		y, okY := num(m, "y")
+		w, okW := num(m, "width")
+		h, okH := num(m, "height")
+		if !okX || !okY || !okW || !okH || w <= 0 || h <= 0 {
+			return spec, fmt.Errorf("instruction %d: %s needs x, y and a positive width and height", i, m["type"])
+		}
+		if x < 0 || y < 0 || x+w > spec.Width || y+h > spec.Height {
+			return spec, fmt.Errorf("instruction %d: %s region %gx%g at (%g, %g) is not inside the %gx%g canvas", i, m["type"], w, h, x, y, spec.Width, spec.Height)
+		}
+		if d, ok := m["duration"]; ok {
+			if d, ok := d.(float64); !ok || d < 0 || d > maxZoomDuration {
+				return spec, fmt.Errorf("instruction %d: %s duration must be 0 to %d milliseconds", i, m["type"], maxZoomDuration)
+			}
+		}
+	}
+	return spec, nil
+}
+
+// prepareDrawing runs a draw call's instructions through the server's
+// steps: shape macros, the theme, layers (kept on the canvas called canvas,
+// if named) and the canvas checks. layers describes the canvas's layers
+// after the call, bottom first; "" when the drawing has none.
+func (eb *EventBus) prepareDrawing(canvas, theme string, instructions []any) (out []any, layers string, err error) {
+	out, err = expandShapes(instructions)
+	if err != nil {
+		return nil, "", err
+	}
+	if theme != "" {
+		palette, err := resolveDrawTheme(theme, eb.ClientInfos())
+		if err != nil {
+			return nil, "", err
+		}
+		out = palette.apply(out, !eb.scenes.continues(canvas))
+	}
+	return eb.scenes.compile(canvas, out, func(out []any) error {
+		_, err := drawCanvas(out)
+		return err
+	})
+}
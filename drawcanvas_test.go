@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDrawCanvas(t *testing.T) {
+	spec, err := drawCanvas([]any{map[string]any{"type": "drawRect"}})
+	if err != nil || spec != (canvasSpec{drawCanvasWidth, drawCanvasHeight, drawBackground}) {
+		t.Errorf("default canvas = %+v, %v", spec, err)
+	}
+
+	big := []any{
+		map[string]any{"type": "setViewport", "x": 0.0, "y": 0.0, "width": 900.0, "height": 550.0},
+		map[string]any{"type": "drawRect", "x": 1500.0, "y": 900.0, "width": 100.0, "height": 50.0},
+		map[string]any{"type": "zoomTo", "x": 900.0, "y": 550.0, "width": 900.0, "height": 550.0, "duration": 800.0},
+		map[string]any{"type": "setCanvas", "width": 1800.0, "height": 1100.0, "background": "#ffffff"},
+	}
+	spec, err = drawCanvas(big)
+	if err != nil || spec != (canvasSpec{1800, 1100, "#ffffff"}) {
+		t.Errorf("setCanvas = %+v, %v", spec, err)
+	}
+	svg := renderDrawSVG(big)
+	if !strings.Contains(svg, `viewBox="0 0 1800 1100"`) || !strings.Contains(svg, "background:#ffffff") {
+		t.Errorf("svg = %.200s", svg)
+	}
+
+	cases := []struct {
+		in   map[string]any
+		want string
+	}{
+		{map[string]any{"type": "setCanvas", "width": 50.0, "height": 500.0}, "width and height from 100 to 4000"},
+		{map[string]any{"type": "setCanvas", "width": 900.0, "height": 9000.0}, "width and height from 100 to 4000"},
+		{map[string]any{"type": "setCanvas", "width": 900.0, "height": 900.0, "background": 3.0}, "background must be a CSS color"},
+		{map[string]any{"type": "setViewport", "x": 0.0, "y": 0.0, "width": 0.0, "height": 10.0}, "positive width and height"},
+		{map[string]any{"type": "zoomTo", "x": 500.0, "y": 0.0, "width": 500.0, "height": 100.0}, "is not inside the 900x550 canvas"},
+		{map[string]any{"type": "zoomTo", "x": 0.0, "y": 0.0, "width": 500.0, "height": 100.0, "duration": -1.0}, "duration must be 0 to 10000"},
+	}
+	for _, c := range cases {
+		if _, err := drawCanvas([]any{c.in}); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("drawCanvas(%v) error = %v, want %q", c.in, err, c.want)
+		}
+	}
+	twice := []any{big[3], big[3]}
+	if _, err := drawCanvas(twice); err == nil || !strings.Contains(err.Error(), "already given") {
+		t.Errorf("two setCanvas: %v", err)
+	}
+
+	themed := drawPalettes["dark"].apply(big, true)
+	if rect := themed[1].(map[string]any); rect["width"] != 1800.0 || rect["height"] != 1100.0 {
+		t.Errorf("themed background rect = %v", rect)
+	}
+	if bg := themed[len(themed)-1].(map[string]any)["background"]; bg != "#ffffff" {
+		t.Errorf("themed setCanvas background = %v", bg)
+	}
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Layers group a drawing's strokes so later steps can reveal, dim or remove
+// them without redrawing the scene by hand:
+//
+//	{"type":"layer","name":"cache"}              draw on layer cache (new ones go on top)
+//	{"type":"hideLayer","name":"cache"}          and showLayer, which also undims it
+//	{"type":"dimLayer","name":"db","opacity":0.3}
+//	{"type":"eraseLayer","name":"cache"}         remove it and what is on it
+//	{"type":"bringToFront","name":"db"}          and sendToBack
+//	{"type":"clearRegion","x":0,"y":0,"width":100,"height":50}
+//
+// The board itself is one picture, so the server keeps each layer's strokes
+// and compiles the steps into plain instructions: a layer change redraws
+// the board at once from the layers, bottom to top, skipping hidden ones
+// and fading dimmed ones. clearRegion erases a rectangle of the current
+// layer and those under it. With the draw tool's `canvas` the layers carry
+// over from one draw call to the next: each new slide starts from the scene
+// the last one left, so a step can dim or erase a part of it instead of
+// drawing everything again. Scenes live in memory, for the server's run.
+
+// layerTypes are the instructions only the layer compiler understands.
+var layerTypes = map[string]bool{
+	"layer": true, "hideLayer": true, "showLayer": true, "dimLayer": true,
+	"eraseLayer": true, "bringToFront": true, "sendToBack": true,
+}
+
+// baseLayer is the layer strokes go on before any "layer" instruction.
+const baseLayer = "base"
+
+// defaultDimOpacity is how opaque dimLayer leaves a layer by default.
+const defaultDimOpacity = 0.3
+
+// drawPen is the state instructions carry from one to the next.
+type drawPen struct {
+	color  string
+	width  float64
+	x, y   float64
+	placed bool // x and y have been set
+}
+
+// drawLayer is one layer of a scene: its strokes, self-contained (each
+// starts by setting the pen it needs).
+type drawLayer struct {
+	name    string
+	ops     []any
+	pen     drawPen // the pen its ops leave the board with
+	hidden  bool
+	opacity float64
+}
+
+// drawScene is a canvas's layers, bottom first, and what draws them.
+type drawScene struct {
+	layers   []*drawLayer
+	current  string
+	pen      drawPen
+	canvas   map[string]any // its setCanvas, if any
+	viewport map[string]any // the last setViewport or zoomTo
+}
+
+func newDrawScene() *drawScene {
+	return &drawScene{current: baseLayer, pen: drawPen{color: "#000000", width: 2}}
+}
+
+// clone copies s deeply enough that compiling into the copy leaves s alone.
+func (s *drawScene) clone() *drawScene {
+	c := *s
+	c.layers = make([]*drawLayer, len(s.layers))
+	for i, l := range s.layers {
+		cl := *l
+		cl.ops = append([]any(nil), l.ops...)
+		c.layers[i] = &cl
+	}
+	return &c
+}
+
+// layer finds the layer called name, or -1.
+func (s *drawScene) layer(name string) (int, *drawLayer) {
+	for i, l := range s.layers {
+		if l.name == name {
+			return i, l
+		}
+	}
+	return -1, nil
+}
+
+// currentLayer is the layer strokes go on, made on top when new.
+func (s *drawScene) currentLayer() *drawLayer {
+	if _, l := s.layer(s.current); l != nil {
+		return l
+	}
+	l := &drawLayer{name: s.current, opacity: 1}
+	s.layers = append(s.layers, l)
+	return l
+}
+
+// usesLayers reports whether instructions need the layer compiler.
+func usesLayers(instructions []any) bool {
+	for _, raw := range instructions {
+		if m, ok := raw.(map[string]any); ok {
+			if t, _ := m["type"].(string); layerTypes[t] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// layerCompiler turns one draw call's instructions into plain ones,
+// updating its scene.
+type layerCompiler struct {
+	scene   *drawScene
+	out     []any
+	opacity float64 // the board's current opacity
+	stale   bool    // strokes went under a layer drawn above them
+}
+
+// compileLayers compiles instructions against scene (nil: a fresh one) and
+// returns the plain instructions and the updated scene; scene itself is
+// not changed. A continued scene is redrawn first.
+func compileLayers(scene *drawScene, instructions []any) ([]any, *drawScene, error) {
+	continued := scene != nil && len(scene.layers) > 0
+	if scene == nil {
+		scene = newDrawScene()
+	}
+	c := &layerCompiler{scene: scene.clone(), opacity: 1}
+	if continued {
+		if c.scene.viewport != nil {
+			c.out = append(c.out, c.scene.viewport)
+		}
+		c.redraw()
+	}
+	for i, raw := range instructions {
+		if err := c.add(raw); err != nil {
+			return nil, nil, fmt.Errorf("instruction %d: %w", i, err)
+		}
+	}
+	if c.stale {
+		c.redraw()
+	}
+	if c.scene.canvas != nil {
+		c.out = append([]any{c.scene.canvas}, c.out...)
+	}
+	return c.out, c.scene, nil
+}
+
+// add compiles one instruction.
+func (c *layerCompiler) add(raw any) error {
+	m, ok := raw.(map[string]any)
+	if !ok {
+		c.out = append(c.out, raw)
+		return nil
+	}
+	s := c.scene
+	t, _ := m["type"].(string)
+	name, _ := m["name"].(string)
+	if layerTypes[t] && name == "" {
+		return fmt.Errorf("%s needs a layer name", t)
+	}
+	var target *drawLayer
+	idx := -1
+	if layerTypes[t] && t != "layer" {
+		if idx, target = s.layer(name); target == nil {
+			return fmt.Errorf("%s: no layer %q (layers: %s)", t, name, s.names())
+		}
+	}
+	switch t {
+	case "layer":
+		s.current = name
+		return nil
+	case "hideLayer":
+		target.hidden = true
+	case "showLayer":
+		target.hidden, target.opacity = false, 1
+	case "dimLayer":
+		target.opacity = defaultDimOpacity
+		if v, ok := m["opacity"]; ok {
+			o, ok := v.(float64)
+			if !ok || o <= 0 || o > 1 {
+				return fmt.Errorf("dimLayer opacity must be more than 0 and at most 1")
+			}
+			target.opacity = o
+		}
+	case "eraseLayer":
+		s.layers = append(s.layers[:idx], s.layers[idx+1:]...)
+		if s.current == name {
+			s.current = baseLayer
+		}
+	case "bringToFront":
+		s.layers = append(append(s.layers[:idx:idx], s.layers[idx+1:]...), target)
+	case "sendToBack":
+		s.layers = append([]*drawLayer{target}, append(s.layers[:idx:idx], s.layers[idx+1:]...)...)
+	case "setCanvas":
+		s.canvas = m
+		return nil
+	case "setViewport", "zoomTo":
+		s.viewport = map[string]any{"type": "setViewport", "x": m["x"], "y": m["y"], "width": m["width"], "height": m["height"]}
+		c.out = append(c.out, m)
+		return nil
+	case "setColor":
+		if v, ok := m["color"].(string); ok {
+			s.pen.color = v
+		}
+		c.out = append(c.out, m)
+		return nil
+	case "setStrokeWidth":
+		if v, ok := m["width"].(float64); ok {
+			s.pen.width = v
+		}
+		c.out = append(c.out, m)
+		return nil
+	case "moveTo":
+		c.movePen(m)
+		c.out = append(c.out, m)
+		return nil
+	case "clear":
+		for _, l := range s.layers {
+			l.ops, l.pen = nil, drawPen{}
+		}
+		c.out = append(c.out, m)
+		return nil
+	default:
+		c.stroke(m)
+		if t == "lineTo" {
+			c.movePen(m)
+		}
+		return nil
+	}
+	c.redraw()
+	return nil
+}
+
+// movePen follows a moveTo or lineTo.
+func (c *layerCompiler) movePen(m map[string]any) {
+	if x, ok := m["x"].(float64); ok {
+		c.scene.pen.x = x
+	}
+	if y, ok := m["y"].(float64); ok {
+		c.scene.pen.y = y
+	}
+	c.scene.pen.placed = true
+}
+
+// stroke adds a drawing instruction to the current layer and, unless the
+// layer is hidden, draws it.
+func (c *layerCompiler) stroke(m map[string]any) {
+	s := c.scene
+	l := s.currentLayer()
+	if l.pen != s.pen {
+		if l.pen.color != s.pen.color {
+			l.ops = append(l.ops, map[string]any{"type": "setColor", "color": s.pen.color})
+		}
+		if l.pen.width != s.pen.width {
+			l.ops = append(l.ops, map[string]any{"type": "setStrokeWidth", "width": s.pen.width})
+		}
+		if s.pen.placed && (l.pen.x != s.pen.x || l.pen.y != s.pen.y || !l.pen.placed) {
+			l.ops = append(l.ops, map[string]any{"type": "moveTo", "x": s.pen.x, "y": s.pen.y})
+		}
+	}
+	l.ops = append(l.ops, m)
+	l.pen = s.pen
+	if m["type"] == "lineTo" {
+		l.pen.x, l.pen.y = c.nextPen(m)
+		l.pen.placed = true
+	}
+	if l.hidden {
+		return
+	}
+	c.setOpacity(l.opacity)
+	c.out = append(c.out, m)
+	for _, above := range s.layers[c.index(l)+1:] {
+		if !above.hidden && len(above.ops) > 0 {
+			c.stale = true
+		}
+	}
+}
+
+// nextPen is where a lineTo leaves the pen.
+func (c *layerCompiler) nextPen(m map[string]any) (float64, float64) {
+	x, ok := m["x"].(float64)
+	if !ok {
+		x = c.scene.pen.x
+	}
+	y, ok := m["y"].(float64)
+	if !ok {
+		y = c.scene.pen.y
+	}
+	return x, y
+}
+
+// index is l's position, bottom first.
+func (c *layerCompiler) index(l *drawLayer) int {
+	i, _ := c.scene.layer(l.name)
+	return i
+}
+
+// setOpacity emits a setOpacity when the board's differs from o.
+func (c *layerCompiler) setOpacity(o float64) {
+	if c.opacity != o {
+		c.out = append(c.out, map[string]any{"type": "setOpacity", "opacity": o})
+		c.opacity = o
+	}
+}
+
+// redraw clears the board and draws every visible layer at once, then puts
+// the pen back where the instructions left it.
+func (c *layerCompiler) redraw() {
+	s := c.scene
+	c.out = append(c.out, map[string]any{"type": "animate", "on": false}, map[string]any{"type": "clear"})
+	for _, l := range s.layers {
+		if l.hidden || len(l.ops) == 0 {
+			continue
+		}
+		c.setOpacity(l.opacity)
+		c.out = append(c.out, l.ops...)
+	}
+	c.setOpacity(1)
+	c.out = append(c.out,
+		map[string]any{"type": "setColor", "color": s.pen.color},
+		map[string]any{"type": "setStrokeWidth", "width": s.pen.width},
+	)
+	if s.pen.placed {
+		c.out = append(c.out, map[string]any{"type": "moveTo", "x": s.pen.x, "y": s.pen.y})
+	}
+	c.out = append(c.out, map[string]any{"type": "animate", "on": true})
+	c.stale = false
+}
+
+// names lists s's layers, bottom first.
+func (s *drawScene) names() string {
+	if len(s.layers) == 0 {
+		return "none"
+	}
+	names := make([]string, len(s.layers))
+	for i, l := range s.layers {
+		names[i] = l.name
+	}
+	return strings.Join(names, ", ")
+}
+
+// describe summarizes s's layers for a tool result, bottom first.
+func (s *drawScene) describe() string {
+	parts := make([]string, len(s.layers))
+	for i, l := range s.layers {
+		parts[i] = l.name
+		switch {
+		case l.hidden:
+			parts[i] += " (hidden)"
+		case l.opacity < 1:
+			parts[i] += fmt.Sprintf(" (dimmed to %g)", l.opacity)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// drawScenes are the named canvases of the draw tool's `canvas`.
+type drawScenes struct {
+	mu     sync.Mutex
+	scenes map[string]*drawScene
+}
+
+// compile compiles instructions on the canvas called name ("" for a one-off
+// drawing) and, when they compile and pass check, keeps the scene they
+// leave. It returns the scene's layers described for the tool result.
+func (d *drawScenes) compile(name string, instructions []any, check func([]any) error) ([]any, string, error) {
+	if name == "" && !usesLayers(instructions) {
+		return instructions, "", check(instructions)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out, scene, err := compileLayers(d.scenes[name], instructions)
+	if err == nil {
+		err = check(out)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if name != "" {
+		if d.scenes == nil {
+			d.scenes = map[string]*drawScene{}
+		}
+		d.scenes[name] = scene
+	}
+	return out, scene.describe(), nil
+}
+
+// continues reports whether name is a canvas drawn on before.
+func (d *drawScenes) continues(name string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return name != "" && d.scenes[name] != nil
+}
+
+// reset forgets every canvas.
+func (d *drawScenes) reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.scenes = nil
+}
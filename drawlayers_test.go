@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// layerJSON decodes instructions written as JSON.
+func layerJSON(t *testing.T, s string) []any {
+	t.Helper()
+	var v []any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// opTypes lists the types of instructions, with the text of writeText and
+// the values of setOpacity and animate.
+func opTypes(instructions []any) string {
+	var types []string
+	for _, raw := range instructions {
+		m := raw.(map[string]any)
+		t := m["type"].(string)
+		switch t {
+		case "writeText":
+			t = "text:" + m["text"].(string)
+		case "setOpacity":
+			t = "opacity:" + jsonString(m["opacity"])
+		case "animate":
+			t = "animate:" + jsonString(m["on"])
+		}
+		types = append(types, t)
+	}
+	return strings.Join(types, " ")
+}
+
+func jsonString(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func TestCompileLayers(t *testing.T) {
+	var scenes drawScenes
+	noCheck := func([]any) error { return nil }
+
+	out, layers, err := scenes.compile("arch", layerJSON(t, `[
+		{"type":"setColor","color":"#f00"},
+		{"type":"writeText","text":"client","x":10,"y":10},
+		{"type":"layer","name":"cache"},
+		{"type":"writeText","text":"cache","x":10,"y":50},
+		{"type":"layer","name":"db"},
+		{"type":"writeText","text":"db","x":10,"y":90}
+	]`), noCheck)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := opTypes(out); got != "setColor text:client text:cache text:db" {
+		t.Errorf("first slide = %s", got)
+	}
+	if layers != "base, cache, db" {
+		t.Errorf("layers = %q", layers)
+	}
+
+	// The next slide starts from the scene: it is redrawn at once, then the
+	// step changes it.
+	out, layers, err = scenes.compile("arch", layerJSON(t, `[
+		{"type":"dimLayer","name":"db"},
+		{"type":"hideLayer","name":"cache"}
+	]`), noCheck)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redraw := "animate:false clear setColor setStrokeWidth text:client setColor setStrokeWidth text:cache setColor setStrokeWidth text:db setColor setStrokeWidth animate:true"
+	dimmed := "animate:false clear setColor setStrokeWidth text:client setColor setStrokeWidth text:cache opacity:0.3 setColor setStrokeWidth text:db opacity:1 setColor setStrokeWidth animate:true"
+	hidden := "animate:false clear setColor setStrokeWidth text:client opacity:0.3 setColor setStrokeWidth text:db opacity:1 setColor setStrokeWidth animate:true"
+	if got := opTypes(out); got != redraw+" "+dimmed+" "+hidden {
+		t.Errorf("second slide =\n%s", got)
+	}
+	if layers != "base, cache (hidden), db (dimmed to 0.3)" {
+		t.Errorf("layers = %q", layers)
+	}
+
+	// Each layer brings its own pen: the red set before "client" stays with
+	// the layers drawn after it.
+	for _, raw := range out[:5] {
+		if m := raw.(map[string]any); m["type"] == "setColor" && m["color"] != "#f00" {
+			t.Errorf("redraw pen = %v", m)
+		}
+	}
+
+	// Drawing under a layer redraws the board once the step is done, so the
+	// layers above stay on top.
+	out, _, err = scenes.compile("arch", layerJSON(t, `[
+		{"type":"showLayer","name":"db"},
+		{"type":"eraseLayer","name":"cache"},
+		{"type":"layer","name":"base"},
+		{"type":"writeText","text":"client 2","x":10,"y":20}
+	]`), noCheck)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := opTypes(out); !strings.HasSuffix(got, "text:client 2 animate:false clear setColor setStrokeWidth text:client text:client 2 setColor setStrokeWidth text:db setColor setStrokeWidth animate:true") {
+		t.Errorf("drawing under a layer =\n%s", got)
+	}
+
+	// A failed step leaves the canvas as it was.
+	if _, _, err := scenes.compile("arch", layerJSON(t, `[{"type":"sendToBack","name":"db"}]`), func([]any) error { return errTest }); err != errTest {
+		t.Errorf("check error = %v", err)
+	}
+	_, layers, _ = scenes.compile("arch", nil, noCheck)
+	if layers != "base, db" {
+		t.Errorf("layers after a failed step = %q", layers)
+	}
+	_, layers, _ = scenes.compile("arch", layerJSON(t, `[{"type":"sendToBack","name":"db"}]`), noCheck)
+	if layers != "db, base" {
+		t.Errorf("layers after sendToBack = %q", layers)
+	}
+	_, layers, _ = scenes.compile("arch", layerJSON(t, `[{"type":"bringToFront","name":"db"}]`), noCheck)
+	if layers != "base, db" {
+		t.Errorf("layers after bringToFront = %q", layers)
+	}
+}
+
+var errTest = errors.New("check failed")
+
+func TestCompileLayersErrors(t *testing.T) {
+	var scenes drawScenes
+	noCheck := func([]any) error { return nil }
+	cases := []struct{ in, want string }{
+		{`[{"type":"layer"}]`, "instruction 0: layer needs a layer name"},
+		{`[{"type":"moveTo","x":1,"y":1},{"type":"hideLayer","name":"x"}]`, `instruction 1: hideLayer: no layer "x" (layers: none)`},
+		{`[{"type":"drawRect"},{"type":"dimLayer","name":"base","opacity":2}]`, "opacity must be more than 0 and at most 1"},
+	}
+	for _, c := range cases {
+		if _, _, err := scenes.compile("", layerJSON(t, c.in), noCheck); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("compile(%s) error = %v, want %q", c.in, err, c.want)
+		}
+	}
+
+	// Without a canvas or layer instructions nothing is compiled.
+	plain := layerJSON(t, `[{"type":"drawRect"},{"type":"clearRegion","x":0,"y":0,"width":5,"height":5}]`)
+	if out, layers, _ := scenes.compile("", plain, noCheck); len(out) != 2 || layers != "" {
+		t.Errorf("plain drawing = %v, %q", out, layers)
+	}
+	if scenes.continues("") || len(scenes.scenes) != 0 {
+		t.Error("a drawing without a canvas name was kept")
+	}
+}
+
+func TestDrawToolCanvasLayers(t *testing.T) {
+	httpMu.Lock()
+	origRunning, origURL := httpRunning, uiURL
+	httpRunning, uiURL = true, ""
+	httpMu.Unlock()
+	t.Cleanup(func() {
+		httpMu.Lock()
+		httpRunning, uiURL = origRunning, origURL
+		httpMu.Unlock()
+	})
+	eb := NewEventBus()
+	sub := eb.SubscribeViewer("desktop")
+	defer eb.Unsubscribe(sub)
+	eb.SetFeatures(sub, []string{"draw"})
+
+	draw := func(instructions string) (string, bool) {
+		eb.PushMessage("next", nil) // so draw returns without waiting
+		return callTool(t, eb, "draw", map[string]any{
+			"text": "Step", "canvas": "flow", "first_quick_reply": "Continue", "theme": "dark",
+			"instructions": layerJSON(t, instructions),
+		})
+	}
+	if got, isErr := draw(`[{"type":"layer","name":"a"},{"type":"drawRect","x":1,"y":1,"width":5,"height":5,"fill":"primary"}]`); isErr || !strings.Contains(got, "Layers, bottom to top: base, a") {
+		t.Fatalf("first draw = %q", got)
+	}
+	if got, isErr := draw(`[{"type":"eraseLayer","name":"b"}]`); !isErr || !strings.Contains(got, `no layer "b" (layers: base, a)`) {
+		t.Fatalf("erase unknown layer = %q", got)
+	}
+	if got, isErr := draw(`[{"type":"dimLayer","name":"a"}]`); isErr || !strings.Contains(got, "a (dimmed to 0.3)") {
+		t.Fatalf("dim = %q", got)
+	}
+	events, _ := eb.History()
+	var last Event
+	for _, e := range events {
+		if e.Type == "draw" {
+			last = e
+		}
+	}
+	// The second slide does not paint the theme's background over the scene.
+	var rects int
+	for _, raw := range last.Instructions {
+		if m := raw.(map[string]any); m["type"] == "drawRect" && m["width"] == 900.0 {
+			rects++
+		}
+	}
+	if rects != 2 { // once in each redraw of the base layer, none on top
+		t.Errorf("second slide paints %d backgrounds: %s", rects, opTypes(last.Instructions))
+	}
+	eb.Wipe()
+	if eb.scenes.continues("flow") {
+		t.Error("wipe kept the canvas")
+	}
+}
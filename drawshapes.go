@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Shape macros let a drawing define a shape once and stamp it many times:
+//
+//	{"type":"defineShape","name":"server","instructions":[...]}
+//	{"type":"useShape","name":"server","x":100,"y":200,"args":{"label":"API"}}
+//
+// A shape's instructions are drawn relative to (0,0); each useShape shifts
+// their x and y by its own and replaces {name} in their strings with args.
+// Shapes may use shapes defined before them. The server expands the macros
+// before the drawing is published, so the browser, the log and exports only
+// ever see plain instructions.
+
+// Limits on expansion, so a small payload cannot stamp out a huge drawing.
+const (
+	maxShapeDepth           = 8
+	maxExpandedInstructions = 20000
+)
+
+// expandShapes returns instructions with defineShape dropped and each
+// useShape replaced by the shape it names. Without macros the slice is
+// returned as is.
+func expandShapes(instructions []any) ([]any, error) {
+	uses := false
+	for _, raw := range instructions {
+		if m, ok := raw.(map[string]any); ok && (m["type"] == "defineShape" || m["type"] == "useShape") {
+			uses = true
+			break
+		}
+	}
+	if !uses {
+		return instructions, nil
+	}
+	x := &shapeExpander{shapes: map[string][]any{}}
+	if err := x.expand(instructions, 0, 0, nil, 0); err != nil {
+		return nil, err
+	}
+	return x.out, nil
+}
+
+// shapeExpander holds the shapes defined so far and the expanded output.
+type shapeExpander struct {
+	shapes map[string][]any
+	out    []any
+	steps  int // instructions visited, expanded or not
+}
+
+// expand appends instructions to x.out, shifted by (dx, dy) and with args
+// filled in; depth counts the useShapes being expanded.
+func (x *shapeExpander) expand(instructions []any, dx, dy float64, args map[string]any, depth int) error {
+	for i, raw := range instructions {
+		if x.steps++; x.steps > maxExpandedInstructions {
+			return fmt.Errorf("the drawing expands to more than %d instructions", maxExpandedInstructions)
+		}
+		m, ok := raw.(map[string]any)
+		if !ok {
+			x.out = append(x.out, raw)
+			continue
+		}
+		switch m["type"] {
+		case "defineShape":
+			name, _ := m["name"].(string)
+			body, ok := m["instructions"].([]any)
+			if name == "" || !ok {
+				return fmt.Errorf("instruction %d: defineShape needs a name and an instructions array", i)
+			}
+			x.shapes[name] = body
+		case "useShape":
+			m = fillArgs(m, args).(map[string]any)
+			name, _ := m["name"].(string)
+			body, ok := x.shapes[name]
+			if !ok {
+				return fmt.Errorf("instruction %d: useShape %q is not defined before it", i, name)
+			}
+			if depth >= maxShapeDepth {
+				return fmt.Errorf("instruction %d: useShape %q nests more than %d shapes deep", i, name, maxShapeDepth)
+			}
+			useArgs, _ := m["args"].(map[string]any)
+			sx, _ := m["x"].(float64)
+			sy, _ := m["y"].(float64)
+			if err := x.expand(body, dx+sx, dy+sy, useArgs, depth+1); err != nil {
+				return err
+			}
+		default:
+			x.out = append(x.out, placeInstruction(m, dx, dy, args))
+		}
+	}
+	return nil
+}
+
+// placeInstruction copies m shifted by (dx, dy) with args filled in.
+func placeInstruction(m map[string]any, dx, dy float64, args map[string]any) map[string]any {
+	c := make(map[string]any, len(m))
+	for k, v := range m {
+		c[k] = fillArgs(v, args)
+	}
+	if v, ok := c["x"].(float64); ok {
+		c["x"] = v + dx
+	}
+	if v, ok := c["y"].(float64); ok {
+		c["y"] = v + dy
+	}
+	return c
+}
+
+// fillArgs replaces {name} with args[name] in v's strings. A string that is
+// exactly one {name} takes the arg's value whatever its type, so a number
+// can be passed for a width.
+func fillArgs(v any, args map[string]any) any {
+	if len(args) == 0 {
+		return v
+	}
+	switch v := v.(type) {
+	case string:
+		if strings.HasPrefix(v, "{") && strings.HasSuffix(v, "}") {
+			if a, ok := args[v[1:len(v)-1]]; ok {
+				return a
+			}
+		}
+		for name, a := range args {
+			v = strings.ReplaceAll(v, "{"+name+"}", fmt.Sprint(a))
+		}
+		return v
+	case map[string]any:
+		c := make(map[string]any, len(v))
+		for k, e := range v {
+			c[k] = fillArgs(e, args)
+		}
+		return c
+	case []any:
+		c := make([]any, len(v))
+		for i, e := range v {
+			c[i] = fillArgs(e, args)
+		}
+		return c
+	}
+	return v
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandShapes(t *testing.T) {
+	var in []any
+	if err := json.Unmarshal([]byte(`[
+		{"type":"defineShape","name":"box","instructions":[
+			{"type":"drawRect","x":0,"y":0,"width":"{w}","height":40},
+			{"type":"writeText","text":"{label} node","x":10,"y":20}
+		]},
+		{"type":"defineShape","name":"pair","instructions":[
+			{"type":"useShape","name":"box","args":{"label":"{left}","w":50}},
+			{"type":"useShape","name":"box","x":100,"args":{"label":"{right}","w":60}}
+		]},
+		{"type":"setColor","color":"#333"},
+		{"type":"useShape","name":"box","x":10,"y":20,"args":{"label":"API","w":120}},
+		{"type":"useShape","name":"pair","x":200,"y":300,"args":{"left":"a","right":"b"}}
+	]`), &in); err != nil {
+		t.Fatal(err)
+	}
+	got, err := expandShapes(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []any
+	json.Unmarshal([]byte(`[
+		{"type":"setColor","color":"#333"},
+		{"type":"drawRect","x":10,"y":20,"width":120,"height":40},
+		{"type":"writeText","text":"API node","x":20,"y":40},
+		{"type":"drawRect","x":200,"y":300,"width":50,"height":40},
+		{"type":"writeText","text":"a node","x":210,"y":320},
+		{"type":"drawRect","x":300,"y":300,"width":60,"height":40},
+		{"type":"writeText","text":"b node","x":310,"y":320}
+	]`), &want)
+	if !reflect.DeepEqual(got, want) {
+		a, _ := json.Marshal(got)
+		t.Errorf("expandShapes = %s", a)
+	}
+
+	plain := []any{map[string]any{"type": "moveTo", "x": 1.0, "y": 2.0}}
+	if got, _ := expandShapes(plain); &got[0] != &plain[0] {
+		t.Error("instructions without macros were copied")
+	}
+}
+
+func TestExpandShapesErrors(t *testing.T) {
+	shape := func(name string, body ...any) any {
+		return map[string]any{"type": "defineShape", "name": name, "instructions": body}
+	}
+	use := func(name string) any { return map[string]any{"type": "useShape", "name": name} }
+	many := func(name string, n int) []any {
+		var body []any
+		for i := 0; i < n; i++ {
+			body = append(body, use(name))
+		}
+		return body
+	}
+	cases := []struct {
+		in   []any
+		want string
+	}{
+		{[]any{use("box")}, `useShape "box" is not defined`},
+		{[]any{map[string]any{"type": "defineShape", "name": "box"}}, "needs a name and an instructions array"},
+		{[]any{shape("a", use("a")), use("a")}, "nests more than 8 shapes deep"},
+		{[]any{shape("a"), shape("b", many("a", 200)...), shape("c", many("b", 200)...), use("c")}, "expands to more than 20000 instructions"},
+	}
+	for _, c := range cases {
+		if _, err := expandShapes(c.in); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("expandShapes(%v) error = %v, want %q", c.in, err, c.want)
+		}
+	}
+}
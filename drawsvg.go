@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// Default whiteboard geometry and style, matching the browser canvas
+// (client-dist/canvas-bundle.js): a 900×550 board, black 2px strokes, 18px
+// handwriting-style text on an off-white background.
+const (
+	drawCanvasWidth  = 900
+	drawCanvasHeight = 550
+	drawFont         = "Segoe Print, Comic Sans MS, cursive"
+	drawFontSize     = 18
+	drawBackground   = "#fffef9"
+)
+
+// renderDrawSVG renders a draw event's instructions as a standalone <svg>
+// element on one line, so it can sit inside a markdown blockquote or an HTML
+// transcript. Shapes are drawn clean rather than hand-drawn (rough.js only
+// exists in the browser); non-solid fill styles are approximated with a
+// translucent solid fill. Unknown instruction types are ignored, the same as
+// the canvas does; a setCanvas sizes the board, and the whole of it is shown
+// whatever viewport the drawing ends on. A clearRegion is painted over in
+// the background color.
+func renderDrawSVG(instructions []any) string {
+	board, _ := drawCanvas(instructions)
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %s %s" width="%s" height="%s" style="max-width:100%%;height:auto;background:%s">`,
+		svgNum(board.Width), svgNum(board.Height), svgNum(board.Width), svgNum(board.Height), html.EscapeString(board.Background))
+
+	color, width, opacity := "#000000", 2.0, 1.0
+	curX, curY := board.Width/2, board.Height/2
+	var body strings.Builder
+	faded := func() string {
+		if opacity < 1 {
+			return ` opacity="` + svgNum(opacity) + `"`
+		}
+		return ""
+	}
+	stroke := func() string {
+		return fmt.Sprintf(`stroke="%s" stroke-width="%s"`, html.EscapeString(color), svgNum(width)) + faded()
+	}
+	fill := func(m map[string]any) string {
+		f, _ := m["fill"].(string)
+		if f == "" {
+			return `fill="none"`
+		}
+		attr := fmt.Sprintf(`fill="%s"`, html.EscapeString(f))
+		if style, _ := m["fillStyle"].(string); style != "" && style != "solid" {
+			attr += ` fill-opacity="0.5"`
+		}
+		return attr
+	}
+	text := func(s string, x, y, size float64, font string) {
+		fmt.Fprintf(&body, `<text x="%s" y="%s" font-family="%s" font-size="%s" dominant-baseline="middle" fill="%s" stroke="%s" stroke-width="3" paint-order="stroke"%s>%s</text>`,
+			svgNum(x), svgNum(y), html.EscapeString(font), svgNum(size), html.EscapeString(color), html.EscapeString(board.Background), faded(), html.EscapeString(s))
+	}
+
+	for _, raw := range instructions {
+		m, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		num := func(key string, def float64) float64 {
+			if v, ok := m[key].(float64); ok {
+				return v
+			}
+			return def
+		}
+		switch m["type"] {
+		case "moveTo":
+			curX, curY = num("x", curX), num("y", curY)
+		case "lineTo":
+			x, y := num("x", curX), num("y", curY)
+			fmt.Fprintf(&body, `<line x1="%s" y1="%s" x2="%s" y2="%s" %s stroke-linecap="round"/>`,
+				svgNum(curX), svgNum(curY), svgNum(x), svgNum(y), stroke())
+			curX, curY = x, y
+		case "setColor":
+			if c, ok := m["color"].(string); ok {
+				color = c
+			}
+		case "setStrokeWidth":
+			width = num("width", width)
+		case "drawRect":
+			fmt.Fprintf(&body, `<rect x="%s" y="%s" width="%s" height="%s" %s %s/>`,
+				svgNum(num("x", 0)), svgNum(num("y", 0)), svgNum(num("width", 0)), svgNum(num("height", 0)), stroke(), fill(m))
+		case "drawCircle":
+			fmt.Fprintf(&body, `<circle cx="%s" cy="%s" r="%s" %s %s/>`,
+				svgNum(num("x", 0)), svgNum(num("y", 0)), svgNum(num("radius", 0)), stroke(), fill(m))
+		case "drawEllipse":
+			fmt.Fprintf(&body, `<ellipse cx="%s" cy="%s" rx="%s" ry="%s" %s %s/>`,
+				svgNum(num("x", 0)), svgNum(num("y", 0)), svgNum(num("width", 0)/2), svgNum(num("height", 0)/2), stroke(), fill(m))
+		case "writeText":
+			s, _ := m["text"].(string)
+			font, _ := m["font"].(string)
+			if font == "" {
+				font = drawFont
+			}
+			text(s, num("x", 0), num("y", 0), num("fontSize", drawFontSize), font)
+		case "label":
+			s, _ := m["text"].(string)
+			text(s, curX+num("offsetX", 10), curY+num("offsetY", -20), num("fontSize", drawFontSize), drawFont)
+		case "clear":
+			body.Reset()
+		case "setOpacity":
+			opacity = num("opacity", 1)
+		case "clearRegion":
+			fmt.Fprintf(&body, `<rect x="%s" y="%s" width="%s" height="%s" fill="%s"/>`,
+				svgNum(num("x", 0)), svgNum(num("y", 0)), svgNum(num("width", 0)), svgNum(num("height", 0)), html.EscapeString(board.Background))
+		}
+	}
+	b.WriteString(body.String())
+	b.WriteString("</svg>")
+	return b.String()
+}
+
+// svgNum formats a coordinate without trailing zeros.
+func svgNum(f float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", f), "0"), ".")
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Draw themes are named palettes an agent picks with the draw tool's
+// `theme` instead of choosing hex colors itself. A themed drawing starts on
+// the palette's background with its ink as the stroke color, and the color
+// roles below (primary, success, …) may stand in for a color: in setColor
+// they mean the role's stroke, in a shape's fill its fill. The roles are
+// resolved on the server, so the logged drawing, its replays and its
+// exports all carry plain colors. "auto" picks light or dark to match the
+// chat theme of the tabs watching. whiteboard://themes lists the palettes.
+
+// drawRole is one color role of a palette: a stroke and a matching fill.
+type drawRole struct {
+	Stroke string `json:"stroke"`
+	Fill   string `json:"fill"`
+}
+
+// drawPalette is a named set of colors for drawings.
+type drawPalette struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Background  string              `json:"background"`
+	Ink         string              `json:"ink"` // the default stroke and text color
+	Roles       map[string]drawRole `json:"roles"`
+}
+
+// drawPalettes are the themes draw accepts, by name.
+var drawPalettes = map[string]drawPalette{
+	"light": {
+		Name:        "light",
+		Description: "Dark ink and pastel fills on an off-white board, for the light chat theme.",
+		Background:  "#fffef9",
+		Ink:         "#212121",
+		Roles: map[string]drawRole{
+			"primary":   {"#2196F3", "#E3F2FD"},
+			"secondary": {"#9C27B0", "#F3E5F5"},
+			"success":   {"#4CAF50", "#E8F5E9"},
+			"warning":   {"#FF9800", "#FFF3E0"},
+			"error":     {"#F44336", "#FFEBEE"},
+			"neutral":   {"#666666", "#F5F5F5"},
+		},
+	},
+	"dark": {
+		Name:        "dark",
+		Description: "Light ink and deep fills on the chat's navy board, for the dark chat theme.",
+		Background:  "#0d1525",
+		Ink:         "#E6EDF3",
+		Roles: map[string]drawRole{
+			"primary":   {"#64B5F6", "#0D2A4A"},
+			"secondary": {"#CE93D8", "#2E1A36"},
+			"success":   {"#81C784", "#12331A"},
+			"warning":   {"#FFB74D", "#3D2A0E"},
+			"error":     {"#E57373", "#3D1517"},
+			"neutral":   {"#B0BEC5", "#1E2A38"},
+		},
+	},
+	"colorblind": {
+		Name:        "colorblind",
+		Description: "The Okabe-Ito colors, told apart with any common color vision deficiency, on white.",
+		Background:  "#ffffff",
+		Ink:         "#000000",
+		Roles: map[string]drawRole{
+			"primary":   {"#0072B2", "#D6EAF5"},
+			"secondary": {"#CC79A7", "#F7E4EE"},
+			"success":   {"#009E73", "#D1F0E6"},
+			"warning":   {"#E69F00", "#FBEBCB"},
+			"error":     {"#D55E00", "#F9DCC7"},
+			"neutral":   {"#555555", "#EEEEEE"},
+		},
+	},
+}
+
+// drawThemeNames lists the themes draw accepts, "auto" first.
+func drawThemeNames() []string {
+	names := make([]string, 0, len(drawPalettes))
+	for name := range drawPalettes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{"auto"}, names...)
+}
+
+// resolveDrawTheme looks up the palette called name. "auto" is light when
+// most of the tabs in infos that report a chat theme use the light one, and
+// dark (the board's own color) otherwise.
+func resolveDrawTheme(name string, infos []ClientInfo) (drawPalette, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "auto" {
+		light, dark := 0, 0
+		for _, c := range infos {
+			switch c.Theme {
+			case "light":
+				light++
+			case "dark":
+				dark++
+			}
+		}
+		name = "dark"
+		if light > dark {
+			name = "light"
+		}
+	}
+	p, ok := drawPalettes[name]
+	if !ok {
+		return drawPalette{}, fmt.Errorf("unknown theme %q (want %s)", name, strings.Join(drawThemeNames(), ", "))
+	}
+	return p, nil
+}
+
+// color resolves a role name (or "ink", "background") to a color; fill
+// picks the role's fill over its stroke. Anything else is returned as is.
+func (p drawPalette) color(c string, fill bool) string {
+	switch c {
+	case "ink":
+		return p.Ink
+	case "background":
+		return p.Background
+	}
+	role, ok := p.Roles[c]
+	switch {
+	case !ok:
+		return c
+	case fill:
+		return role.Fill
+	default:
+		return role.Stroke
+	}
+}
+
+// apply returns instructions drawn in p: a board (its setCanvas too)
+// painted in its background unless paint is false (a canvas drawn on
+// again), the stroke set to its ink, and role names replaced by colors.
+// The instructions given are not modified.
+func (p drawPalette) apply(instructions []any, paint bool) []any {
+	out := make([]any, 0, len(instructions)+3)
+	if paint {
+		board, _ := drawCanvas(instructions)
+		out = append(out,
+			map[string]any{"type": "setColor", "color": p.Background},
+			map[string]any{"type": "drawRect", "x": 0.0, "y": 0.0, "width": board.Width, "height": board.Height, "fill": p.Background, "fillStyle": "solid"},
+		)
+	}
+	out = append(out, map[string]any{"type": "setColor", "color": p.Ink})
+	for _, raw := range instructions {
+		m, ok := raw.(map[string]any)
+		if !ok {
+			out = append(out, raw)
+			continue
+		}
+		c := make(map[string]any, len(m))
+		for k, v := range m {
+			c[k] = v
+		}
+		if s, ok := c["color"].(string); ok && c["type"] == "setColor" {
+			c["color"] = p.color(s, false)
+		}
+		if s, ok := c["fill"].(string); ok {
+			c["fill"] = p.color(s, true)
+		}
+		if c["type"] == "setCanvas" {
+			s, _ := c["background"].(string)
+			c["background"] = p.color(cmp.Or(s, "background"), true)
+		}
+		out = append(out, c)
+	}
+	return out
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveDrawTheme(t *testing.T) {
+	cases := []struct {
+		name  string
+		infos []ClientInfo
+		want  string
+	}{
+		{"light", nil, "light"},
+		{" Colorblind ", nil, "colorblind"},
+		{"auto", nil, "dark"},
+		{"auto", []ClientInfo{{Theme: "light"}, {Theme: "light"}, {Theme: "dark"}, {}}, "light"},
+		{"auto", []ClientInfo{{Theme: "light"}, {Theme: "dark"}}, "dark"},
+	}
+	for _, c := range cases {
+		p, err := resolveDrawTheme(c.name, c.infos)
+		if err != nil || p.Name != c.want {
+			t.Errorf("resolveDrawTheme(%q, %v) = %q, %v; want %q", c.name, c.infos, p.Name, err, c.want)
+		}
+	}
+	if _, err := resolveDrawTheme("neon", nil); err == nil || !strings.Contains(err.Error(), "auto, colorblind, dark, light") {
+		t.Errorf("unknown theme error = %v", err)
+	}
+}
+
+func TestDrawPaletteApply(t *testing.T) {
+	p := drawPalettes["dark"]
+	in := []any{
+		map[string]any{"type": "setColor", "color": "primary"},
+		map[string]any{"type": "drawRect", "x": 1.0, "fill": "success"},
+		map[string]any{"type": "drawCircle", "fill": "#123456"},
+		map[string]any{"type": "setColor", "color": "ink"},
+		map[string]any{"type": "writeText", "text": "error", "fill": "background"},
+		"not an instruction",
+	}
+	got := p.apply(in, true)
+	want := []any{
+		map[string]any{"type": "setColor", "color": p.Background},
+		map[string]any{"type": "drawRect", "x": 0.0, "y": 0.0, "width": 900.0, "height": 550.0, "fill": p.Background, "fillStyle": "solid"},
+		map[string]any{"type": "setColor", "color": p.Ink},
+		map[string]any{"type": "setColor", "color": p.Roles["primary"].Stroke},
+		map[string]any{"type": "drawRect", "x": 1.0, "fill": p.Roles["success"].Fill},
+		map[string]any{"type": "drawCircle", "fill": "#123456"},
+		map[string]any{"type": "setColor", "color": p.Ink},
+		map[string]any{"type": "writeText", "text": "error", "fill": p.Background},
+		"not an instruction",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("apply =\n%v\nwant\n%v", got, want)
+	}
+	if in[0].(map[string]any)["color"] != "primary" {
+		t.Error("apply modified its input")
+	}
+	for name, p := range drawPalettes {
+		if p.Name != name || len(p.Roles) != 6 {
+			t.Errorf("palette %q: name %q, %d roles", name, p.Name, len(p.Roles))
+		}
+	}
+}
+
+func TestDrawToolTheme(t *testing.T) {
+	httpMu.Lock()
+	origRunning, origURL := httpRunning, uiURL
+	httpRunning, uiURL = true, ""
+	httpMu.Unlock()
+	t.Cleanup(func() {
+		httpMu.Lock()
+		httpRunning, uiURL = origRunning, origURL
+		httpMu.Unlock()
+	})
+
+	eb := NewEventBus()
+	sub := eb.SubscribeViewer("desktop")
+	defer eb.Unsubscribe(sub)
+	eb.SetFeatures(sub, []string{"draw"})
+	eb.SetClientInfo(sub, ClientInfo{Theme: "light"})
+
+	args := map[string]any{
+		"text":              "The flow",
+		"instructions":      []any{map[string]any{"type": "drawRect", "x": 10, "y": 10, "width": 50, "height": 20, "fill": "primary"}},
+		"first_quick_reply": "Continue",
+		"theme":             "sepia",
+	}
+	if got, isErr := callTool(t, eb, "draw", args); !isErr || !strings.Contains(got, `unknown theme "sepia"`) {
+		t.Fatalf("draw with an unknown theme = %q (error %v)", got, isErr)
+	}
+
+	// A queued message makes draw return without waiting for a click.
+	eb.PushMessage("looks good", nil)
+	args["theme"] = "auto"
+	if got, isErr := callTool(t, eb, "draw", args); isErr {
+		t.Fatalf("draw = %q", got)
+	}
+	events, _ := eb.History()
+	var last Event
+	for _, e := range events {
+		if e.Type == "draw" {
+			last = e
+		}
+	}
+	if len(last.Instructions) != 4 {
+		t.Fatalf("last event = %+v", last)
+	}
+	if fill := last.Instructions[3].(map[string]any)["fill"]; fill != drawPalettes["light"].Roles["primary"].Fill {
+		t.Errorf("themed fill = %v", fill)
+	}
+}
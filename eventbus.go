@@ -5,65 +5,34 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"os"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/choonkeat/agent-chat/pkg/wire"
 	"github.com/google/uuid"
 )
 
-// FileRef describes an uploaded file.
-type FileRef struct {
-	Name string `json:"name"`           // original filename
-	Path string `json:"path"`           // absolute server path
-	URL  string `json:"url"`            // relative URL for browser to fetch thumbnail
-	Size int64  `json:"size"`           // bytes
-	Type string `json:"type,omitempty"` // MIME type
-}
-
-// UserMessage is a text message with optional file attachments from the browser.
-// ID is assigned when the message enters the system (via ReceiveUserMessage) and
-// is echoed back on the matching userMessagesConsumed event so the browser can
-// flip the bubble's "pending" state once the agent has actually drained it.
-type UserMessage struct {
-	ID    string    `json:"id,omitempty"`
-	Text  string    `json:"text"`
-	Files []FileRef `json:"files,omitempty"`
-}
-
-// Event represents a chat event sent to browser clients.
-//
-// For userMessage events, ID is the message's unique ID (so the browser can
-// tag the bubble). For userMessagesConsumed events, IDs lists the message IDs
-// the agent has just drained from the queue (or that the server consumed
-// inline via the permission/ack paths).
-type Event struct {
-	Type         string    `json:"type"`                   // "agentMessage", "userMessage", "userMessagesConsumed", "draw"
-	Seq          int64     `json:"seq"`                    // monotonic sequence number
-	ID           string    `json:"id,omitempty"`           // userMessage: the message's unique ID
-	IDs          []string  `json:"ids,omitempty"`          // userMessagesConsumed: which IDs were consumed
-	Text         string    `json:"text,omitempty"`
-	AckID        string    `json:"ack_id,omitempty"`
-	QuickReplies []string  `json:"quick_replies,omitempty"`
-	Instructions []any     `json:"instructions,omitempty"` // draw instructions
-	Files        []FileRef `json:"files,omitempty"`
-	Timestamp    int64     `json:"ts,omitempty"` // Unix milliseconds
-
-	// AgentToolSeq + AgentToolName stamp events with the per-tool ordinal of
-	// the MCP call that produced them, so consumers (e.g. swe-swe-server's
-	// /api/fork resolver) can locate the matching tool_use/function_call in
-	// the agent's own .jsonl without resorting to text correlation.
-	//
-	// For "agentMessage" events: the Nth call to AgentToolName that emitted
-	// this bubble (send_message, send_progress, send_verbal_reply, etc.).
-	// For "userMessagesConsumed" events: the Nth check_messages call that
-	// drained the listed IDs.
-	// Zero / empty means "unstamped" -- legacy events or server-side ack
-	// paths that didn't originate from an MCP tool call.
-	AgentToolSeq  int64  `json:"agent_tool_seq,omitempty"`
-	AgentToolName string `json:"agent_tool_name,omitempty"`
-}
+// The chat's wire types live in pkg/eventbus so other Go programs can
+// decode the event log and the WebSocket stream; these aliases keep their
+// short names here.
+type (
+	FileRef       = wire.FileRef
+	UserMessage   = wire.UserMessage
+	Event         = wire.Event
+	AgentIdentity = wire.AgentIdentity
+	LinkPreview   = wire.LinkPreview
+	ToolMeta      = wire.ToolMeta
+	Countdown     = wire.Countdown
+	// LocationPrompt marks a request_location prompt.
+	LocationPrompt = wire.LocationPrompt
+	// PermissionPrompt marks a relayed Claude Code permission prompt.
+	PermissionPrompt = wire.PermissionPrompt
+)
 
 // AckHandle is returned by CreateAck. Read from Ch to wait for the user's ack.
 type AckHandle struct {
@@ -87,12 +56,32 @@ type ExportHandle struct {
 
 // EventBus fans out events to WebSocket subscribers, tracks pending acks,
 // and maintains an in-memory event log for browser reconnect.
+//
+// An EventBus value is a view: the shared eventHub plus one agent session's
+// message state. NewEventBus returns the primary session's view; Session and
+// ClientSession return the view for another MCP client, so two agents sharing
+// one instance never drain each other's replies.
 type EventBus struct {
-	mu              sync.RWMutex
-	subscribers     map[chan Event]struct{}
-	eventLog        []Event  // session event log for reconnect replay
-	nextSeq         int64    // next sequence number (guarded by mu)
-	lastQuickReplies []string // last quick_replies sent to browser (nil = agent working)
+	*eventHub
+	*agentSession
+}
+
+// eventHub is the state every agent session shares: one chat, one event log,
+// one set of browsers.
+type eventHub struct {
+	mu          sync.RWMutex
+	subscribers map[chan Event]*subscriberStats
+	observers   map[chan Event]struct{} // server-side subscribers (not browsers); subset of subscribers
+	viewers     map[chan Event]string   // browser subscribers -> device hint; subset of subscribers
+
+	// viewersChanged is closed (and replaced) whenever a viewer joins or
+	// leaves, waking WaitForSubscriber. Guarded by mu.
+	viewersChanged chan struct{}
+	eventLog    []Event                 // session event log for reconnect replay
+	nextSeq     int64                   // next sequence number (guarded by mu)
+	index       *searchIndex            // trigram index over eventLog's messages, for Search
+	metrics     busCounters             // what Publish has done, for /metrics (guarded by mu)
+	lastDay     string                  // day of the latest bubble, for -date-separators (see separateDay; guarded by mu)
 
 	ackMu   sync.Mutex
 	pending map[string]chan string // ack_id -> channel
@@ -100,11 +89,61 @@ type EventBus struct {
 	exportMu        sync.Mutex
 	pendingExports  map[string]chan ExportResult // export token -> channel
 
+	locationMu       sync.Mutex
+	pendingLocations map[string]chan LocationResult // request_location id -> channel (made on first use)
+
+	pickMu       sync.Mutex
+	pendingPicks map[string]chan filePick // pick_file id -> channel (made on first use)
+
 	transientMu   sync.RWMutex
 	transientSubs map[chan any]struct{} // per-connection writeCh sinks for non-logged broadcasts
 
-	msgQueue  chan UserMessage // queued user messages from browser
-	lastVoice bool            // whether the last consumed user message was voice
+	transientDropped atomic.Int64 // transient payloads skipped on a full sink, for /metrics
+
+	receiptMu sync.Mutex
+	receipts  map[string]*viewerReceipt // browser tab (viewer id) -> what it has rendered
+
+	namesMu sync.Mutex
+	names   map[string]string // browser client id -> the user's display name
+
+	// sessions holds every agent session but the primary, keyed by MCP
+	// client key (see ClientSession). primaryKey is the client that claimed
+	// the primary session; "" until the first keyed client calls in.
+	sessionMu  sync.Mutex
+	primary    *agentSession
+	primaryKey string
+	sessions   map[string]*agentSession
+
+	logFile *os.File   // optional JSONL event log on disk
+	blobs   *blobStore // big draw payloads kept out of eventLog (see drawInlineMax)
+	logMu   sync.Mutex // guards logFile writes
+
+	chained   bool   // -hash-chain: seal each logged line into a hash chain (see integrity.go)
+	chainHead string // hash of the last logged line (guarded by logMu)
+
+	scenes drawScenes   // the draw tool's named canvases and their layers (see drawlayers.go)
+	tools  toolSwitches // tool categories the user switched off (see toolcategories.go)
+}
+
+// agentSession is the per-MCP-client half of an EventBus: the agent's own
+// reply queue, voice state and pending quick replies.
+type agentSession struct {
+	key              string           // "" for the primary session; otherwise stamped on its events
+	msgQueue         chan UserMessage // queued user messages from browser
+	lastVoice        bool             // whether the last consumed user message was voice (guarded by eventHub.mu)
+	lastQuickReplies []string         // last quick_replies sent to browser, nil = agent working (guarded by eventHub.mu)
+	promptSeq        int64            // seq of the event offering lastQuickReplies until a tab claims it (see claimPrompt; guarded by eventHub.mu)
+	identity         *AgentIdentity   // name/avatar stamped on this agent's bubbles (guarded by eventHub.mu)
+
+	// lastActive, calls, stalled and disconnected are the liveness
+	// heartbeat's view of the agent: when a tool call last started or
+	// finished, how many are in flight, and whether it was last reported
+	// stalled or gone. Guarded by eventHub.mu.
+	lastActive   time.Time
+	calls        int
+	stalled      bool
+	disconnected bool          // the MCP client has gone (see Disconnect) and not called since
+	worked       time.Duration // idle time before the current call began: how long the agent worked on it (see toolMeta)
 
 	// limbo retains the last batch of user messages handed to the agent whose
 	// receipt no later MCP call has confirmed. A blocking send_message can be
@@ -121,28 +160,42 @@ type EventBus struct {
 	// the zombie from stealing a user reply it can no longer deliver.
 	waitMu     sync.Mutex
 	activeWait *waitHandle
+}
 
-	logFile *os.File   // optional JSONL event log on disk
-	logMu   sync.Mutex // guards logFile writes
+func newAgentSession(key string) *agentSession {
+	return &agentSession{key: key, msgQueue: make(chan UserMessage, 256)}
 }
 
-// NewEventBus creates a new EventBus.
-func NewEventBus() *EventBus {
-	return &EventBus{
-		subscribers:    make(map[chan Event]struct{}),
+func newEventHub() *eventHub {
+	return &eventHub{
+		subscribers:    make(map[chan Event]*subscriberStats),
+		observers:      make(map[chan Event]struct{}),
+		viewers:        make(map[chan Event]string),
+		viewersChanged: make(chan struct{}),
+		index:          newSearchIndex(),
 		pending:        make(map[string]chan string),
 		pendingExports: make(map[string]chan ExportResult),
 		transientSubs:  make(map[chan any]struct{}),
-		msgQueue:       make(chan UserMessage, 256),
+		receipts:       make(map[string]*viewerReceipt),
+		names:          make(map[string]string),
+		primary:        newAgentSession(""),
+		sessions:       make(map[string]*agentSession),
+		blobs:          newBlobStore(""),
 	}
 }
 
+// NewEventBus creates a new EventBus.
+func NewEventBus() *EventBus {
+	hub := newEventHub()
+	return &EventBus{eventHub: hub, agentSession: hub.primary}
+}
+
 // NewEventBusWithLog creates an EventBus that also appends events to a JSONL file.
 // If the file already exists, its events are loaded into memory so browsers get
 // full history across server restarts.
 func NewEventBusWithLog(path string) (*EventBus, error) {
 	// Load existing events from the log file.
-	events, maxSeq, lastQR := loadEventLog(path)
+	events, maxSeq, _ := loadEventLog(path)
 
 	// Resume MCP tool-call counters from whatever the on-disk events already
 	// stamped so post-restart events keep counting from where they left off.
@@ -154,16 +207,19 @@ func NewEventBusWithLog(path string) (*EventBus, error) {
 	if err != nil {
 		return nil, err
 	}
-	eb := &EventBus{
-		subscribers:      make(map[chan Event]struct{}),
-		pending:          make(map[string]chan string),
-		pendingExports:   make(map[string]chan ExportResult),
-		transientSubs:    make(map[chan any]struct{}),
-		msgQueue:         make(chan UserMessage, 256),
-		logFile:          f,
-		eventLog:         events,
-		nextSeq:          maxSeq,
-		lastQuickReplies: lastQR,
+	eb := NewEventBus()
+	eb.logFile = f
+	eb.blobs = logBlobs(path)
+	eb.eventLog = events
+	eb.nextSeq = maxSeq
+	for _, e := range events {
+		eb.index.add(e)
+	}
+	for key, qr := range quickRepliesBySession(events) {
+		eb.Session(key).lastQuickReplies = qr
+	}
+	for key, seq := range openPromptsBySession(events) {
+		eb.Session(key).promptSeq = seq
 	}
 	// Re-enqueue messages that were still pending when the server stopped. The
 	// event log survives a restart but the in-memory queue does not, so without
@@ -172,9 +228,16 @@ func NewEventBusWithLog(path string) (*EventBus, error) {
 	// can never drain it and an "unsend" (Delete) finds nothing in the queue to
 	// remove and so never publishes userMessageDeleted — the bubble reappears on
 	// every reload. Rehydrating restores the queue so pending truly means pending.
+	// Each message goes back to the agent session it was sent to.
+	sessionOf := make(map[string]string)
+	for _, e := range events {
+		if e.Type == "userMessage" && e.Session != "" {
+			sessionOf[e.ID] = e.Session
+		}
+	}
 	for _, m := range pendingUserMessages(events) {
 		select {
-		case eb.msgQueue <- m:
+		case eb.Session(sessionOf[m.ID]).msgQueue <- m:
 		default:
 		}
 	}
@@ -190,7 +253,11 @@ func NewEventBusWithLog(path string) (*EventBus, error) {
 func pendingUserMessages(events []Event) []UserMessage {
 	consumed := make(map[string]bool)
 	deleted := make(map[string]bool)
+	quotes := make(map[int64]string)
 	for _, e := range events {
+		if q, ok := quoteEvent(e); ok {
+			quotes[e.Seq] = q
+		}
 		switch e.Type {
 		case "userMessagesConsumed":
 			for _, id := range e.IDs {
@@ -204,19 +271,28 @@ func pendingUserMessages(events []Event) []UserMessage {
 	}
 	var pending []UserMessage
 	for _, e := range events {
-		if e.Type != "userMessage" || e.ID == "" {
+		if (e.Type != "userMessage" && e.Type != "reaction") || e.ID == "" || e.Redacted {
 			continue
 		}
 		if consumed[e.ID] || deleted[e.ID] {
 			continue
 		}
-		pending = append(pending, UserMessage{ID: e.ID, Text: e.Text, Files: e.Files})
+		m := UserMessage{ID: e.ID, Text: e.Text, Files: e.Files, From: e.From}
+		if e.Type == "reaction" {
+			m = UserMessage{ID: e.ID, Reaction: e.Text}
+		}
+		if q, ok := quotes[e.ReplyTo]; ok && e.ReplyTo > 0 {
+			m.ReplyTo, m.Quote = e.ReplyTo, q
+		}
+		pending = append(pending, m)
 	}
 	return pending
 }
 
 // loadEventLog reads a JSONL event log file and returns the parsed events,
-// the highest sequence number found, and the reconstructed lastQuickReplies.
+// the highest sequence number found, and the primary session's reconstructed
+// lastQuickReplies. Lines written by an older agent-chat are migrated to the
+// current schema as they load.
 func loadEventLog(path string) ([]Event, int64, []string) {
 	f, err := os.Open(path)
 	if err != nil {
@@ -226,27 +302,42 @@ func loadEventLog(path string) ([]Event, int64, []string) {
 
 	var events []Event
 	var maxSeq int64
-	var lastQR []string
+	newer := 0
 	scanner := bufio.NewScanner(f)
 	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
 	for scanner.Scan() {
-		var ev Event
-		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+		ev, err := decodeLoggedEvent(scanner.Bytes())
+		if err != nil {
 			continue // skip malformed lines
 		}
+		if ev.SchemaVersion > wire.SchemaVersion {
+			newer++
+		}
 		events = append(events, ev)
 		if ev.Seq > maxSeq {
 			maxSeq = ev.Seq
 		}
-		// Reconstruct lastQuickReplies state.
+	}
+	if newer > 0 {
+		log.Printf("agent-chat: %s: %d events were written by a newer agent-chat; fields this version does not know are ignored", path, newer)
+	}
+	return events, maxSeq, quickRepliesBySession(events)[""]
+}
+
+// quickRepliesBySession reconstructs each agent session's lastQuickReplies
+// from a restored event log, keyed by Event.Session. Sessions whose agent is
+// working (no pending replies) are absent.
+func quickRepliesBySession(events []Event) map[string][]string {
+	qr := make(map[string][]string)
+	for _, ev := range events {
 		if len(ev.QuickReplies) > 0 {
-			lastQR = ev.QuickReplies
+			qr[ev.Session] = ev.QuickReplies
 		}
-		if ev.Type == "userMessage" {
-			lastQR = nil
+		if (ev.Type == "userMessage" && !ev.Aside) || ev.Type == "agentDisconnected" || ev.Type == "countdownEnded" {
+			delete(qr, ev.Session)
 		}
 	}
-	return events, maxSeq, lastQR
+	return qr
 }
 
 // writeToLog marshals an event to JSON and appends it to the log file.
@@ -256,15 +347,32 @@ func (eb *EventBus) writeToLog(event Event) {
 	if eb.logFile == nil {
 		return
 	}
+	event.SchemaVersion = wire.SchemaVersion
 	data, err := json.Marshal(event)
 	if err != nil {
 		return
 	}
+	if eb.chained {
+		data, eb.chainHead = chainLine(eb.chainHead, data)
+	}
 	data = append(data, '\n')
 	eb.logFile.Write(data)
 	eb.logFile.Sync()
 }
 
+// EnableHashChain seals every line logged from now on into a hash chain
+// continuing from the log's last chained line.
+func (eb *EventBus) EnableHashChain(path string) error {
+	head, err := lastChainHash(path)
+	if err != nil {
+		return err
+	}
+	eb.logMu.Lock()
+	defer eb.logMu.Unlock()
+	eb.chained, eb.chainHead = true, head
+	return nil
+}
+
 // Close flushes and closes the log file.
 func (eb *EventBus) Close() {
 	eb.logMu.Lock()
@@ -276,6 +384,96 @@ func (eb *EventBus) Close() {
 	}
 }
 
+// Session returns the EventBus view for the agent session key names, creating
+// the session on first use. "" and the key that claimed the primary session
+// both return the primary view. Use it to route a browser reply to the agent
+// it answers; MCP tool calls use ClientSession.
+func (eb *EventBus) Session(key string) *EventBus {
+	return eb.eventHub.session(key, false)
+}
+
+// ClientSession is Session for the MCP client behind a tool call: the first
+// keyed client to call in claims the primary session, so a lone agent behaves
+// exactly as before, and every other client gets a session of its own.
+func (eb *EventBus) ClientSession(key string) *EventBus {
+	return eb.eventHub.session(key, true)
+}
+
+func (h *eventHub) session(key string, claim bool) *EventBus {
+	h.sessionMu.Lock()
+	defer h.sessionMu.Unlock()
+	if key != "" && h.primaryKey == "" && claim {
+		h.primaryKey = key
+		// Replies queued for this key before it claimed the primary session
+		// (rehydrated after a restart) follow it there.
+		// Neither side blocks: sessionMu is held, and a full primary queue
+		// would otherwise wedge every session lookup. A reply that does not
+		// fit stays pending in the event log and is queued at the next start.
+		if s, ok := h.sessions[key]; ok {
+			delete(h.sessions, key)
+		moving:
+			for {
+				select {
+				case m := <-s.msgQueue:
+					select {
+					case h.primary.msgQueue <- m:
+					default:
+						log.Printf("session %s: primary queue full, reply %s left for the next start", key, m.ID)
+					}
+				default:
+					break moving
+				}
+			}
+		}
+	}
+	if key == "" || key == h.primaryKey {
+		return &EventBus{eventHub: h, agentSession: h.primary}
+	}
+	s, ok := h.sessions[key]
+	if !ok {
+		s = newAgentSession(key)
+		h.sessions[key] = s
+	}
+	return &EventBus{eventHub: h, agentSession: s}
+}
+
+// KnownSession is ClientSession for a client that may already have gone: it
+// never claims the primary session or creates one, so reporting that a
+// client left cannot conjure an agent that never called in.
+func (eb *EventBus) KnownSession(key string) (*EventBus, bool) {
+	h := eb.eventHub
+	h.sessionMu.Lock()
+	defer h.sessionMu.Unlock()
+	if key != "" && key == h.primaryKey {
+		return &EventBus{eventHub: h, agentSession: h.primary}, true
+	}
+	if s, ok := h.sessions[key]; ok {
+		return &EventBus{eventHub: h, agentSession: s}, true
+	}
+	return nil, false
+}
+
+// ReplySession is Session for a key a browser sent: only a session an agent
+// has opened is routed to, and any other key (stale, or made up) reaches the
+// primary session instead of creating one that no agent will ever drain.
+func (eb *EventBus) ReplySession(key string) *EventBus {
+	if s, ok := eb.KnownSession(key); ok {
+		return s
+	}
+	return &EventBus{eventHub: eb.eventHub, agentSession: eb.eventHub.primary}
+}
+
+// allSessions returns the primary session followed by every other one.
+func (h *eventHub) allSessions() []*agentSession {
+	h.sessionMu.Lock()
+	defer h.sessionMu.Unlock()
+	all := []*agentSession{h.primary}
+	for _, s := range h.sessions {
+		all = append(all, s)
+	}
+	return all
+}
+
 // PushMessage queues a user message from the browser. The ID will be assigned
 // automatically; callers that need to broadcast the userMessage event with the
 // matching ID should use ReceiveUserMessage instead.
@@ -308,10 +506,100 @@ func (eb *EventBus) pushUserMessage(msg UserMessage) {
 // agent. The returned ID is the same one carried by the userMessage event and
 // the eventual userMessagesConsumed event.
 func (eb *EventBus) ReceiveUserMessage(text string, files []FileRef) string {
+	return eb.ReceiveUserReply(text, files, 0)
+}
+
+// ReceiveUserReply is ReceiveUserMessage for a message that answers the
+// earlier message with seq replyTo. A replyTo that names no message in the
+// log is dropped rather than quoted wrong.
+func (eb *EventBus) ReceiveUserReply(text string, files []FileRef, replyTo int64) string {
+	return eb.Receive(UserMessage{Text: text, Files: files, ReplyTo: replyTo})
+}
+
+// Receive is the general form of ReceiveUserMessage, taking the message's
+// Text, Files, ReplyTo and From; its ID and Quote are filled in here.
+func (eb *EventBus) Receive(msg UserMessage) string {
+	quote, ok := eb.Quote(msg.ReplyTo)
+	if !ok {
+		msg.ReplyTo = 0
+	}
+	msg.ID, msg.Quote = uuid.New().String(), quote
+	eb.Publish(Event{Type: "userMessage", ID: msg.ID, Text: msg.Text, Files: msg.Files, ReplyTo: msg.ReplyTo, From: msg.From})
+	eb.pushUserMessage(msg)
+	return msg.ID
+}
+
+// maxQuoteLen caps the excerpt of a replied-to message, in runes.
+const maxQuoteLen = 200
+
+// Quote returns an excerpt of the chat message with the given seq, for reply
+// context. ok is false when no message has that seq.
+func (eb *EventBus) Quote(seq int64) (quote string, ok bool) {
+	if seq <= 0 {
+		return "", false
+	}
+	e, ok := eb.eventAt(seq)
+	if !ok {
+		return "", false
+	}
+	return quoteEvent(e)
+}
+
+// eventAt returns the logged event with the given seq.
+func (eb *EventBus) eventAt(seq int64) (Event, bool) {
+	eb.mu.RLock()
+	defer eb.mu.RUnlock()
+	for _, e := range eb.eventLog {
+		if e.Seq == seq {
+			return e, true
+		}
+	}
+	return Event{}, false
+}
+
+// reactionEmoji are the reactions the browser offers on a message.
+var reactionEmoji = map[string]bool{"👍": true, "👎": true, "❓": true}
+
+// React records the user's emoji reaction to the message with seq target:
+// a "reaction" event for the browsers, and a queued UserMessage so the agent
+// that wrote the message sees the feedback on its next check_messages. Like
+// a user message, it wakes a blocked send_message.
+func (eb *EventBus) React(target int64, emoji string) (string, error) {
+	if !reactionEmoji[emoji] {
+		return "", fmt.Errorf("unsupported reaction %q", emoji)
+	}
+	e, ok := eb.eventAt(target)
+	if !ok {
+		return "", fmt.Errorf("no message #%d", target)
+	}
+	quote, ok := quoteEvent(e)
+	if !ok {
+		return "", fmt.Errorf("#%d is not a message", target)
+	}
+	to := eb.Session(e.Session)
 	id := uuid.New().String()
-	eb.Publish(Event{Type: "userMessage", ID: id, Text: text, Files: files})
-	eb.pushUserMessage(UserMessage{ID: id, Text: text, Files: files})
-	return id
+	to.Publish(Event{Type: "reaction", ID: id, Text: emoji, ReplyTo: target})
+	to.pushUserMessage(UserMessage{ID: id, ReplyTo: target, Quote: quote, Reaction: emoji})
+	return id, nil
+}
+
+// quoteEvent excerpts a message event for reply context; non-message events
+// (acks, markers, consumption) can't be replied to.
+func quoteEvent(e Event) (string, bool) {
+	switch eventKind(e) {
+	case "userMessage", "agentMessage", "verbalReply":
+		text := strings.Join(strings.Fields(e.Text), " ")
+		if r := []rune(text); len(r) > maxQuoteLen {
+			text = string(r[:maxQuoteLen]) + "…"
+		}
+		if text == "" && len(e.Files) > 0 {
+			text = "[attached " + e.Files[0].Name + "]"
+		}
+		return text, true
+	case "draw":
+		return "[drawing]", true
+	}
+	return "", false
 }
 
 // PublishConsumedUserMessage is for paths where the server itself consumes a
@@ -499,6 +787,21 @@ func (eb *EventBus) LastVoice() bool {
 	return eb.lastVoice
 }
 
+// SetIdentity sets the identity stamped on this agent session's bubbles from
+// now on. nil clears it.
+func (eb *EventBus) SetIdentity(id *AgentIdentity) {
+	eb.mu.Lock()
+	eb.identity = id
+	eb.mu.Unlock()
+}
+
+// Identity returns this agent session's identity, or nil if it has none.
+func (eb *EventBus) Identity() *AgentIdentity {
+	eb.mu.RLock()
+	defer eb.mu.RUnlock()
+	return eb.identity
+}
+
 // LastQuickReplies returns the last quick_replies sent to the browser, or nil
 // if the agent is currently working (no pending quick replies).
 func (eb *EventBus) LastQuickReplies() []string {
@@ -526,16 +829,26 @@ func (eb *EventBus) HasHistory() bool {
 // true if the target ID was found and removed. Used by the "unsend" flow so
 // the agent never sees a withdrawn message. Distinct from drain: nothing is
 // "consumed" here — withdrawn messages should fire userMessageDeleted, not
-// userMessagesConsumed.
+// userMessagesConsumed. Every agent session's queue is searched: the browser
+// unsends by ID without knowing which agent the message was sent to.
 func (eb *EventBus) RemoveFromQueue(targetID string) bool {
 	if targetID == "" {
 		return false
 	}
+	for _, s := range eb.allSessions() {
+		if s.removeFromQueue(targetID) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *agentSession) removeFromQueue(targetID string) bool {
 	var keep []UserMessage
 	found := false
 	for {
 		select {
-		case msg := <-eb.msgQueue:
+		case msg := <-s.msgQueue:
 			if msg.ID == targetID {
 				found = true
 				continue
@@ -543,7 +856,7 @@ func (eb *EventBus) RemoveFromQueue(targetID string) bool {
 			keep = append(keep, msg)
 		default:
 			for _, m := range keep {
-				eb.msgQueue <- m
+				s.msgQueue <- m
 			}
 			return found
 		}
@@ -559,7 +872,7 @@ func FormatMessages(msgs []UserMessage) string {
 		if isVoice {
 			text = strings.TrimPrefix(text, "\U0001f3a4 ")
 		}
-		data.Messages = append(data.Messages, messageData{Text: text, IsVoice: isVoice})
+		data.Messages = append(data.Messages, messageData{Text: text, IsVoice: isVoice, ReplyTo: m.ReplyTo, Quote: m.Quote, Reaction: m.Reaction, From: m.From})
 		for _, f := range m.Files {
 			mime := f.Type
 			if mime == "" {
@@ -572,21 +885,31 @@ func FormatMessages(msgs []UserMessage) string {
 }
 
 // Subscribe returns a buffered channel that receives all published events.
-// Call Unsubscribe when done.
+// The subscriber counts as a viewer (see SubscribeViewer) with no device
+// hint. Call Unsubscribe when done.
 func (eb *EventBus) Subscribe() chan Event {
+	return eb.SubscribeViewer("")
+}
+
+// Observe is Subscribe for server-side consumers (the chat-log stream, MCP
+// resource notifications). Observers receive every event but are not
+// viewers, so they never satisfy WaitForSubscriber. Release with Unsubscribe.
+func (eb *EventBus) Observe() chan Event {
 	ch := make(chan Event, 64)
 	eb.mu.Lock()
-	eb.subscribers[ch] = struct{}{}
+	eb.subscribers[ch] = newSubscriberStats()
+	eb.observers[ch] = struct{}{}
 	eb.mu.Unlock()
 	return ch
 }
 
-// WaitForSubscriber polls until at least one subscriber is connected,
-// or the context is cancelled, or 30 seconds elapse.
+// WaitForSubscriber blocks until at least one viewer (a browser, not an
+// observer) is connected, or the context is cancelled. It sleeps on viewer
+// presence changes rather than polling.
 func (eb *EventBus) WaitForSubscriber(ctx context.Context) error {
 	for {
 		eb.mu.RLock()
-		n := len(eb.subscribers)
+		n, changed := len(eb.viewers), eb.viewersChanged
 		eb.mu.RUnlock()
 		if n > 0 {
 			return nil
@@ -594,54 +917,92 @@ func (eb *EventBus) WaitForSubscriber(ctx context.Context) error {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-time.After(30 * time.Second):
-			return fmt.Errorf("timed out waiting for browser to connect")
-		case <-time.After(100 * time.Millisecond):
-			// poll again
+		case <-changed:
 		}
 	}
 }
 
-// Unsubscribe removes a subscriber channel.
+// Unsubscribe removes a subscriber channel. A viewer leaving is broadcast as
+// viewerLeft.
 func (eb *EventBus) Unsubscribe(ch chan Event) {
 	eb.mu.Lock()
 	delete(eb.subscribers, ch)
+	delete(eb.observers, ch)
+	device, wasViewer := eb.viewers[ch]
+	if wasViewer {
+		delete(eb.viewers, ch)
+		eb.presenceChangedLocked()
+	}
 	eb.mu.Unlock()
+	if wasViewer {
+		eb.PublishTransient(eb.Presence("viewerLeft", device))
+	}
 }
 
 // ResetLog clears the event log.
 func (eb *EventBus) ResetLog() {
 	eb.mu.Lock()
 	eb.eventLog = nil
+	eb.index = newSearchIndex()
 	eb.mu.Unlock()
 }
 
 // Publish sends an event to all subscribers and appends to the event log.
-func (eb *EventBus) Publish(event Event) {
+// It returns the event's seq.
+func (eb *EventBus) Publish(event Event) int64 {
 	if event.Timestamp == 0 {
 		event.Timestamp = time.Now().UnixMilli()
 	}
+	if dateSeparators && isBubble(event) {
+		eb.separateDay(event.Timestamp)
+	}
+	if event.Session == "" {
+		event.Session = eb.key
+	}
+	if event.SessionName == "" {
+		event.SessionName = sessionName()
+	}
+	switch eventKind(event) {
+	case "agentMessage", "verbalReply":
+		event.Text = mdPolicy.sanitize(event.Text)
+	}
+	stored := eb.blobs.offload(event)
 	eb.mu.Lock()
+	start := time.Now()
 	eb.nextSeq++
 	event.Seq = eb.nextSeq
-	eb.eventLog = append(eb.eventLog, event)
+	if event.Agent == nil && eb.identity != nil {
+		switch eventKind(event) {
+		case "agentMessage", "verbalReply", "draw":
+			event.Agent = eb.identity
+		}
+	}
+	stored.Seq, stored.Agent = event.Seq, event.Agent
+	eb.eventLog = append(eb.eventLog, stored)
+	eb.index.add(stored)
 
-	// Track lastQuickReplies for new browser state.
+	// Track this agent session's lastQuickReplies for new browser state.
 	if len(event.QuickReplies) > 0 {
 		eb.lastQuickReplies = event.QuickReplies
+		eb.promptSeq = event.Seq
 	}
-	if event.Type == "userMessage" {
+	if (event.Type == "userMessage" && !event.Aside) || event.Type == "agentDisconnected" || event.Type == "countdownEnded" {
 		eb.lastQuickReplies = nil
+		eb.promptSeq = 0
 	}
 
-	for ch := range eb.subscribers {
+	for ch, st := range eb.subscribers {
 		select {
 		case ch <- event:
+			st.delivered++
 		default:
+			eb.droppedLocked(ch, st)
 		}
 	}
+	eb.metrics.observe(time.Since(start))
 	eb.mu.Unlock()
-	eb.writeToLog(event)
+	eb.writeToLog(stored)
+	return event.Seq
 }
 
 // LogUserMessage appends a user message event to the log for reconnect replay.
@@ -677,6 +1038,19 @@ func (eb *EventBus) EventsSince(cursor int64) []Event {
 	return result
 }
 
+// EventsBefore returns up to limit events with Seq < before, oldest first,
+// and whether older ones remain. A page of history for a tab that was sent
+// only the recent end of a long chat.
+func (eb *EventBus) EventsBefore(before int64, limit int) ([]Event, bool) {
+	eb.mu.RLock()
+	defer eb.mu.RUnlock()
+	end := sort.Search(len(eb.eventLog), func(i int) bool { return eb.eventLog[i].Seq >= before })
+	start := max(end-limit, 0)
+	result := make([]Event, end-start)
+	copy(result, eb.eventLog[start:end])
+	return result, start > 0
+}
+
 // PendingAckID returns the first pending ack ID, if any.
 func (eb *EventBus) PendingAckID() string {
 	eb.ackMu.Lock()
@@ -758,6 +1132,7 @@ func (eb *EventBus) PublishTransient(payload any) int {
 		case ch <- payload:
 			delivered++
 		default:
+			eb.transientDropped.Add(1)
 		}
 	}
 	return delivered
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -365,3 +366,184 @@ func TestEndBlockingWaitClearsOnlyItself(t *testing.T) {
 	default:
 	}
 }
+
+// Two MCP clients on one instance each get their own reply queue: the first
+// keyed client keeps the primary session, the second gets a session whose
+// events are stamped with its key.
+func TestClientSessionsIsolateQueues(t *testing.T) {
+	bus := NewEventBus()
+	a := bus.ClientSession("client-a")
+	b := bus.ClientSession("client-b")
+	if a.agentSession != bus.agentSession {
+		t.Fatalf("first client should claim the primary session")
+	}
+	if b.agentSession == a.agentSession {
+		t.Fatalf("second client should get a session of its own")
+	}
+
+	b.Publish(Event{Type: "agentMessage", Text: "from b", QuickReplies: []string{"ok"}})
+	if qr := a.LastQuickReplies(); qr != nil {
+		t.Errorf("b's quick replies leaked into a: %v", qr)
+	}
+	if qr := b.LastQuickReplies(); len(qr) != 1 {
+		t.Errorf("b's quick replies = %v", qr)
+	}
+	bus.Session("client-b").ReceiveUserMessage("for b", nil)
+	bus.ReceiveUserMessage("for a", nil)
+
+	if got := a.DrainMessages(); len(got) != 1 || got[0].Text != "for a" {
+		t.Fatalf("a drained %+v", got)
+	}
+	if got := b.DrainMessages(); len(got) != 1 || got[0].Text != "for b" {
+		t.Fatalf("b drained %+v", got)
+	}
+	for _, e := range bus.EventsSince(0) {
+		if e.Type == "userMessagesConsumed" {
+			continue
+		}
+		want := ""
+		if strings.HasSuffix(e.Text, " b") {
+			want = "client-b"
+		}
+		if e.Session != want {
+			t.Errorf("%s %q: session %q, want %q", e.Type, e.Text, e.Session, want)
+		}
+	}
+}
+
+func TestRemoveFromQueueSearchesAllSessions(t *testing.T) {
+	bus := NewEventBus()
+	bus.ClientSession("client-a")
+	id := bus.Session("client-b").ReceiveUserMessage("withdraw me", nil)
+	if !bus.RemoveFromQueue(id) {
+		t.Fatalf("message queued for another session was not found")
+	}
+	if bus.Session("client-b").HasQueuedMessages() {
+		t.Errorf("message still queued after RemoveFromQueue")
+	}
+}
+
+// After a restart, a pending reply goes back to the session it was sent to,
+// and follows that client if it is the first to call in (claiming primary).
+func TestEventBusRehydratesPendingQueuePerSession(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	bus1, err := NewEventBusWithLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus1.ClientSession("client-a")
+	bus1.Session("client-b").ReceiveUserMessage("for b", nil)
+	bus1.Close()
+
+	bus2, err := NewEventBusWithLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus2.Close()
+	if bus2.HasQueuedMessages() {
+		t.Fatalf("b's reply leaked into the primary queue")
+	}
+	b := bus2.ClientSession("client-b")
+	if got := b.DrainMessages(); len(got) != 1 || got[0].Text != "for b" {
+		t.Fatalf("b drained %+v after restart", got)
+	}
+}
+
+// Claiming the primary session must not block on a full primary queue:
+// the move happens under sessionMu, which every session lookup takes.
+func TestClaimPrimaryWithFullQueue(t *testing.T) {
+	bus := NewEventBus()
+	bus.Session("client-b").ReceiveUserMessage("for b", nil)
+	for len(bus.msgQueue) < cap(bus.msgQueue) {
+		bus.ReceiveUserMessage("backlog", nil)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		bus.ClientSession("client-b")
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("claiming the primary session blocked on its full queue")
+	}
+	if got := bus.Session("client-c"); got.agentSession == bus.agentSession {
+		t.Error("session lookups after the claim still reach the primary")
+	}
+}
+
+// A session key from a browser is only routed to if an agent opened it.
+func TestReplySessionOnlyKnown(t *testing.T) {
+	bus := NewEventBus()
+	bus.ClientSession("client-a")
+	b := bus.ClientSession("client-b")
+	if got := bus.ReplySession("client-b"); got.agentSession != b.agentSession {
+		t.Error("reply to a known session went elsewhere")
+	}
+	for _, key := range []string{"", "client-a", "made-up"} {
+		if got := bus.ReplySession(key); got.agentSession != bus.agentSession {
+			t.Errorf("ReplySession(%q) did not reach the primary session", key)
+		}
+	}
+	if _, ok := bus.KnownSession("made-up"); ok {
+		t.Error("an unknown key from a browser created a session")
+	}
+}
+
+func TestReceiveUserReplyQuotesTarget(t *testing.T) {
+	bus := NewEventBus()
+	bus.Publish(Event{Type: "agentMessage", Text: "Delete the\nold branch?"})
+	bus.Publish(Event{Type: "toolMarker"})
+	bus.ReceiveUserReply("yes", nil, 1)
+	bus.ReceiveUserReply("no", nil, 2) // a marker is not a message
+	events := bus.EventsSince(0)
+
+	// Rehydration after a restart keeps the reply context.
+	if p := pendingUserMessages(events); len(p) != 2 || p[0].Quote != "Delete the old branch?" {
+		t.Errorf("pending = %+v", p)
+	}
+	if events[2].ReplyTo != 1 || events[3].ReplyTo != 0 {
+		t.Errorf("event reply_to = %d, %d", events[2].ReplyTo, events[3].ReplyTo)
+	}
+
+	msgs := bus.DrainMessages()
+	if msgs[0].ReplyTo != 1 || msgs[0].Quote != "Delete the old branch?" {
+		t.Errorf("reply = %+v", msgs[0])
+	}
+	if msgs[1].ReplyTo != 0 || msgs[1].Quote != "" {
+		t.Errorf("reply to a non-message kept its target: %+v", msgs[1])
+	}
+}
+
+func TestReactQueuesFeedbackForAuthor(t *testing.T) {
+	bus := NewEventBus()
+	bus.ClientSession("a")
+	b := bus.ClientSession("b")
+	b.Publish(Event{Type: "agentMessage", Text: "Deploy now?"})
+	bus.Publish(Event{Type: "toolMarker"})
+
+	if _, err := bus.React(1, "👍"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bus.React(1, "🎉"); err == nil {
+		t.Error("unsupported emoji accepted")
+	}
+	if _, err := bus.React(2, "👍"); err == nil {
+		t.Error("reaction to a marker accepted")
+	}
+	if bus.HasQueuedMessages() {
+		t.Error("reaction queued for the wrong agent")
+	}
+
+	events := bus.EventsSince(2)
+	if len(events) != 1 || events[0].Type != "reaction" || events[0].Text != "👍" || events[0].ReplyTo != 1 || events[0].Session != "b" {
+		t.Fatalf("events = %+v", events)
+	}
+	if p := pendingUserMessages(bus.EventsSince(0)); len(p) != 1 || p[0].Reaction != "👍" || p[0].Quote != "Deploy now?" {
+		t.Errorf("pending = %+v", p)
+	}
+	msgs := b.DrainMessages()
+	if len(msgs) != 1 || msgs[0].Reaction != "👍" || msgs[0].ReplyTo != 1 || msgs[0].Quote != "Deploy now?" {
+		t.Errorf("b drained %+v", msgs)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// eventMigrations[v] upgrades one logged event, as raw JSON fields, from
+// schema version v to v+1, so a log written by an older agent-chat loads
+// with its fields moved to where this build reads them instead of being
+// silently dropped. A change to Event that older lines cannot decode into
+// — a field that becomes an object, a renamed key — bumps
+// wire.SchemaVersion and appends its migration here; nil is a version
+// bump that needs no rewriting.
+var eventMigrations = []func(fields map[string]json.RawMessage) error{
+	nil,               // 0 → 1: versioning introduced; the layout itself did not change
+	migratePromptData, // 1 → 2: prompt payloads moved to Data
+}
+
+// promptFields are the Event fields that carried a prompt's payload before
+// schema 2, and the kind its bubble became.
+var promptFields = []struct{ field, kind string }{
+	{"permission", "permissionPrompt"},
+	{"countdown", "countdownPrompt"},
+	{"location", "locationPrompt"},
+}
+
+// migratePromptData moves a permission, countdown or location payload from
+// its own field to "data". The prompt bubble, logged as an agentMessage (or
+// a verbalReply, for a permission prompt in voice mode), takes the type of
+// its kind; the event settling it already had one.
+func migratePromptData(fields map[string]json.RawMessage) error {
+	for _, p := range promptFields {
+		raw, ok := fields[p.field]
+		if !ok {
+			continue
+		}
+		delete(fields, p.field)
+		var typ string
+		if err := json.Unmarshal(fields["type"], &typ); err != nil {
+			return fmt.Errorf("type: %w", err)
+		}
+		switch typ {
+		case "verbalReply":
+			var data map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &data); err != nil {
+				return fmt.Errorf("%s: %w", p.field, err)
+			}
+			data["voice"] = json.RawMessage("true")
+			var err error
+			if raw, err = json.Marshal(data); err != nil {
+				return err
+			}
+			fallthrough
+		case "agentMessage":
+			fields["type"] = json.RawMessage(strconv.Quote(p.kind))
+		}
+		fields["data"] = raw
+	}
+	return nil
+}
+
+// decodeLoggedEvent parses one line of the event log, migrating it up to
+// the current schema first when it was written by an older build. A line
+// from a newer build is decoded as far as this one understands it, and
+// keeps its SchemaVersion so the caller can tell.
+func decodeLoggedEvent(line []byte) (Event, error) {
+	current := len(eventMigrations)
+	var ev Event
+	err := json.Unmarshal(line, &ev)
+	if err == nil && ev.SchemaVersion >= current {
+		return ev, nil
+	}
+	if err == nil && noRewrite(ev.SchemaVersion, current) {
+		ev.SchemaVersion = current
+		return ev, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return Event{}, err
+	}
+	version := 0
+	if raw, ok := fields["schema_version"]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return Event{}, fmt.Errorf("schema_version: %w", err)
+		}
+	}
+	if version >= current {
+		return Event{}, err // a newer line this build cannot decode at all
+	}
+	for v := version; v < current; v++ {
+		if eventMigrations[v] == nil {
+			continue
+		}
+		if err := eventMigrations[v](fields); err != nil {
+			return Event{}, fmt.Errorf("migrate event from schema %d: %w", v, err)
+		}
+	}
+	fields["schema_version"] = json.RawMessage(strconv.Itoa(current))
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return Event{}, err
+	}
+	ev = Event{}
+	if err := json.Unmarshal(data, &ev); err != nil {
+		return Event{}, fmt.Errorf("event migrated from schema %d: %w", version, err)
+	}
+	return ev, nil
+}
+
+// noRewrite reports whether every migration from version from up to to is
+// a plain version bump.
+func noRewrite(from, to int) bool {
+	for v := from; v < to; v++ {
+		if eventMigrations[v] != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/choonkeat/agent-chat/pkg/wire"
+)
+
+func TestSchemaVersionMatchesMigrations(t *testing.T) {
+	if len(eventMigrations) != wire.SchemaVersion {
+		t.Fatalf("%d migrations for schema version %d", len(eventMigrations), wire.SchemaVersion)
+	}
+}
+
+func TestDecodeLoggedEvent(t *testing.T) {
+	tests := []struct {
+		line    string
+		text    string
+		version int
+	}{
+		{`{"type":"agentMessage","seq":1,"text":"before versioning"}`, "before versioning", wire.SchemaVersion},
+		{`{"type":"agentMessage","seq":2,"text":"current","schema_version":1}`, "current", wire.SchemaVersion},
+		{`{"type":"agentMessage","seq":3,"text":"from the future","mood":{"x":1},"schema_version":99}`, "from the future", 99},
+	}
+	for _, tt := range tests {
+		ev, err := decodeLoggedEvent([]byte(tt.line))
+		if err != nil {
+			t.Errorf("%s: %v", tt.line, err)
+			continue
+		}
+		if ev.Text != tt.text || ev.SchemaVersion != tt.version {
+			t.Errorf("%s: got text %q, schema %d", tt.line, ev.Text, ev.SchemaVersion)
+		}
+	}
+	for _, line := range []string{`{"type":`, `{"type":"x","schema_version":"one"}`} {
+		if _, err := decodeLoggedEvent([]byte(line)); err == nil {
+			t.Errorf("%s: decoded without error", line)
+		}
+	}
+}
+
+func TestEventMigrationRewritesOldLines(t *testing.T) {
+	orig := eventMigrations
+	t.Cleanup(func() { eventMigrations = orig })
+	// A pretend next schema where quick replies became objects.
+	next := wire.SchemaVersion + 1
+	eventMigrations = append(append([]func(map[string]json.RawMessage) error{}, orig...), func(f map[string]json.RawMessage) error {
+		var labels []string
+		if err := json.Unmarshal(f["quick_replies"], &labels); err != nil {
+			return err
+		}
+		f["text"] = json.RawMessage(`"` + strings.Join(labels, "/") + `"`)
+		return nil
+	})
+
+	ev, err := decodeLoggedEvent([]byte(`{"type":"agentMessage","quick_replies":["Yes","No"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Text != "Yes/No" || ev.SchemaVersion != next {
+		t.Errorf("got text %q, schema %d", ev.Text, ev.SchemaVersion)
+	}
+	ev, err = decodeLoggedEvent(fmt.Appendf(nil, `{"type":"agentMessage","text":"kept","quick_replies":["Yes"],"schema_version":%d}`, next))
+	if err != nil || ev.Text != "kept" {
+		t.Errorf("current line rewritten: %q, %v", ev.Text, err)
+	}
+}
+
+// Schema 2 moved the permission, countdown and location payloads from
+// fields of their own into Data.
+func TestMigratePromptData(t *testing.T) {
+	tests := []struct {
+		line, typ, data string
+	}{
+		{`{"type":"agentMessage","text":"Deploy?","countdown":{"deadline":5,"on_timeout":"approve"},"schema_version":1}`, "countdownPrompt", `{"deadline":5,"on_timeout":"approve"}`},
+		{`{"type":"countdownEnded","reply_to":1,"countdown":{"deadline":5,"on_timeout":"approve","outcome":"approved","by":"timeout"}}`, "countdownEnded", `{"deadline":5,"on_timeout":"approve","outcome":"approved","by":"timeout"}`},
+		{`{"type":"agentMessage","text":"📍","location":{"request_id":"l1","reason":"coffee"},"schema_version":1}`, "locationPrompt", `{"request_id":"l1","reason":"coffee"}`},
+		{`{"type":"verbalReply","text":"Allow?","permission":{"request_id":"p1","tool":"Bash"},"schema_version":1}`, "permissionPrompt", `{"request_id":"p1","tool":"Bash","voice":true}`},
+		{`{"type":"permissionAnswered","permission":{"request_id":"p1","tool":"Bash","verdict":"allow"},"schema_version":1}`, "permissionAnswered", `{"request_id":"p1","tool":"Bash","verdict":"allow"}`},
+	}
+	for _, tt := range tests {
+		ev, err := decodeLoggedEvent([]byte(tt.line))
+		if err != nil {
+			t.Errorf("%s: %v", tt.line, err)
+			continue
+		}
+		var got, want any
+		json.Unmarshal(ev.Data, &got)
+		json.Unmarshal([]byte(tt.data), &want)
+		if ev.Type != tt.typ || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %s %s", tt.line, ev.Type, ev.Data)
+		}
+	}
+
+	ev, err := decodeLoggedEvent([]byte(`{"type":"agentMessage","seq":9,"text":"📍","location":{"request_id":"l2"},"schema_version":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc, err := wire.DecodeData[LocationPrompt](ev); err != nil || loc.RequestID != "l2" || eventKind(ev) != "agentMessage" {
+		t.Errorf("location = %+v, %v, kind %s", loc, err, eventKind(ev))
+	}
+}
+
+func TestEventLogSchemaVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	legacy := `{"type":"agentMessage","seq":7,"text":"old","quick_replies":["Go on"]}` + "\n"
+	if err := os.WriteFile(path, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	eb, err := NewEventBusWithLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eb.Publish(Event{Type: "agentMessage", Text: "new"})
+	eb.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if lines[0]+"\n" != legacy {
+		t.Errorf("legacy line rewritten: %s", lines[0])
+	}
+	if !strings.Contains(lines[1], fmt.Sprintf(`"schema_version":%d`, wire.SchemaVersion)) {
+		t.Errorf("new line not stamped: %s", lines[1])
+	}
+	events, maxSeq, qr := loadEventLog(path)
+	if len(events) != 2 || maxSeq != 8 || !slices.Equal(qr, []string{"Go on"}) {
+		t.Fatalf("reloaded %d events, max seq %d, quick replies %v", len(events), maxSeq, qr)
+	}
+	for _, e := range events {
+		if e.SchemaVersion != wire.SchemaVersion {
+			t.Errorf("seq %d: schema %d", e.Seq, e.SchemaVersion)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// runExport implements `agent-chat export`: turn a JSONL event log into a
+// readable transcript for archiving outside the repo. Markdown uses the same
+// script-style layout as the chat-log exports; HTML is a standalone page.
+// Either way the file is self-contained — attachments are inlined as data:
+// URIs and drawings as SVG — so it survives the upload dir being cleaned up.
+func runExport(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "", "md or html (default: from -o's extension, else md)")
+	output := fs.String("o", "", "output file (default: stdout)")
+	uploads := fs.String("upload-dir", "", "where to look for attachments whose recorded path no longer exists")
+	title := fs.String("title", "", "transcript title (default: derived from the log file name)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: agent-chat export [-format md|html] [-o file] [-upload-dir dir] <events.jsonl>\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	src := fs.Arg(0)
+	if *format == "" {
+		*format = "md"
+		if ext := strings.ToLower(filepath.Ext(*output)); ext == ".html" || ext == ".htm" {
+			*format = "html"
+		}
+	}
+	if *format != "md" && *format != "html" {
+		fmt.Fprintf(os.Stderr, "agent-chat export: -format must be md or html, got %q\n", *format)
+		return 2
+	}
+	if _, err := os.Stat(src); err != nil {
+		fmt.Fprintf(os.Stderr, "agent-chat export: %v\n", err)
+		return 1
+	}
+
+	if *title == "" {
+		base := strings.TrimSuffix(filepath.Base(src), filepath.Ext(src))
+		*title = humanTitle(strings.ReplaceAll(base, "_", "-"))
+	}
+	events, _, _ := loadEventLog(src)
+	events = logBlobs(src).hydrate(events)
+	doc, warnings := renderTranscript(events, *format, *title, *uploads)
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "agent-chat export: %s\n", w)
+	}
+
+	if *output == "" {
+		io.WriteString(out, doc)
+		return 0
+	}
+	if err := os.WriteFile(*output, []byte(doc), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "agent-chat export: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(out, "wrote %s\n", *output)
+	return 0
+}
+
+// renderTranscript renders events as a self-contained "md" or "html"
+// transcript titled title, inlining attachments (see inlineAttachments).
+// Unsent messages, and progress updates a later one replaced, are left
+// out. Shared by `agent-chat export` and the
+// export_transcript tool; returns the document and any attachment warnings.
+func renderTranscript(events []Event, format, title, uploadDir string) (string, []string) {
+	events = withoutReplaced(withoutWithdrawn(events))
+	imageMap, warnings := inlineAttachments(events, uploadDir)
+	date := time.Now()
+	for _, e := range events {
+		if e.Timestamp > 0 {
+			date = time.UnixMilli(e.Timestamp)
+			break
+		}
+	}
+	if format == "html" {
+		return renderTranscriptHTML(events, title, date, imageMap), warnings
+	}
+	return renderTranscriptMarkdown(events, chatExportMeta{
+		Title:   title,
+		Date:    date.Format("2006-01-02"),
+		Index:   "01",
+		Slug:    slugifyTitle(title),
+		Version: version + " (" + commit + ")",
+	}, imageMap), warnings
+}
+
+// withoutWithdrawn drops user messages the user unsent, along with their
+// userMessageDeleted markers — the same bubbles replayHistory never shows.
+func withoutWithdrawn(events []Event) []Event {
+	withdrawn := map[string]bool{}
+	for _, e := range events {
+		if e.Type == "userMessageDeleted" && e.ID != "" {
+			withdrawn[e.ID] = true
+		}
+	}
+	if len(withdrawn) == 0 {
+		return events
+	}
+	var out []Event
+	for _, e := range events {
+		if (e.Type == "userMessage" || e.Type == "userMessageDeleted") && withdrawn[e.ID] {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// withoutReplaced drops progress bubbles that the next bubble overwrote
+// (a progress update sent with replace), as the UI does.
+func withoutReplaced(events []Event) []Event {
+	var out []Event
+	last := -1 // index in out of the latest bubble
+	for _, e := range events {
+		switch eventKind(e) {
+		case "agentMessage", "verbalReply", "draw", "userMessage":
+		default:
+			out = append(out, e)
+			continue
+		}
+		if e.Replace && last >= 0 && isProgressEvent(out[last]) && out[last].Session == e.Session {
+			out = append(out[:last], out[last+1:]...)
+		}
+		out = append(out, e)
+		last = len(out) - 1
+	}
+	return out
+}
+
+// isProgressEvent reports whether e came from send_progress or
+// send_verbal_progress.
+func isProgressEvent(e Event) bool {
+	return e.AgentToolName == "send_progress" || e.AgentToolName == "send_verbal_progress"
+}
+
+// inlineAttachments reads every attachment referenced by a chat turn and
+// maps its recorded path to a data: URI. A file that has moved is looked up
+// by name in uploadDir (uploads live in a temp dir by default, so the recorded
+// path is often stale by the time anyone exports); one that cannot be found
+// is skipped with a warning, and the renderers then leave it out. Only files
+// inside uploadDir or shareDir are read: a ref's Path may have come from a
+// browser, and must not turn an export into a way to read any file.
+func inlineAttachments(events []Event, uploadDir string) (map[string]string, []string) {
+	out := map[string]string{}
+	var warnings []string
+	for _, e := range events {
+		switch eventKind(e) {
+		case "userMessage", "agentMessage", "verbalReply":
+		default:
+			continue
+		}
+		for _, f := range e.Files {
+			if f.Path == "" {
+				continue
+			}
+			if _, ok := out[f.Path]; ok {
+				continue
+			}
+			path, ok := withinDir(f.Path, uploadDir, shareDir)
+			if !ok && uploadDir != "" {
+				path, ok = withinDir(filepath.Join(uploadDir, filepath.Base(f.Path)), uploadDir)
+			}
+			if !ok {
+				warnings = append(warnings, fmt.Sprintf("skipped attachment %q (%s): missing, or outside the upload and shared directories", f.Name, f.Path))
+				continue
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("skipped missing attachment %q (%s)", f.Name, f.Path))
+				continue
+			}
+			out[f.Path] = "data:" + attachmentType(f) + ";base64," + base64.StdEncoding.EncodeToString(data)
+		}
+	}
+	return out, warnings
+}
+
+// attachmentType is f's media type for a data: URL. f.Type comes from the
+// uploader (a Content-Type header, a browser's FileRef), so only a type that
+// parses is used, without its parameters; anything else is guessed from the
+// name, or application/octet-stream.
+func attachmentType(f FileRef) string {
+	for _, typ := range []string{f.Type, mime.TypeByExtension(filepath.Ext(f.Name))} {
+		if mt, _, err := mime.ParseMediaType(typ); err == nil {
+			return mt
+		}
+	}
+	return "application/octet-stream"
+}
+
+// renderTranscriptMarkdown is renderChatMarkdown with drawings included:
+// draw events render as inline SVG agent turns.
+func renderTranscriptMarkdown(events []Event, meta chatExportMeta, imageMap map[string]string) string {
+	var b strings.Builder
+	b.WriteString(renderChatMarkdown(nil, meta, nil))
+	b.WriteString(pinsMarkdown(events))
+	st := renderState{drawSVG: true}
+	for _, e := range events {
+		b.WriteString(renderChatBubble(e, &st, imageMap))
+	}
+	return b.String()
+}
+
+// renderTranscriptHTML renders events as a standalone HTML page. Message text
+// is shown as written (markdown source, whitespace preserved) rather than
+// rendered, which keeps the page dependency-free and faithful to what was sent.
+func renderTranscriptHTML(events []Event, title string, date time.Time, imageMap map[string]string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>%s</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; max-width: 960px; margin: 2em auto; padding: 0 1em; color: #222; background: #fafafa; }
+.turn { margin: 1em 0; padding: 0.75em 1em; border-radius: 10px; background: #fff; box-shadow: 0 1px 2px rgba(0,0,0,0.08); }
+.turn.user { background: #e8f0fe; margin-left: 15%%; }
+.who { font-size: 0.75em; font-weight: 600; letter-spacing: 0.05em; color: #666; margin-bottom: 0.35em; }
+.text { white-space: pre-wrap; overflow-wrap: anywhere; }
+.files { display: flex; flex-wrap: wrap; gap: 8px; margin-top: 0.5em; }
+.files img { max-width: calc(33%% - 8px); height: auto; border-radius: 6px; }
+.took { color: #888; font-size: 0.8em; }
+.replies { color: #555; font-size: 0.9em; margin: 0.5em 0 0; }
+.meta { color: #777; font-size: 0.8em; margin: 0.5em 0 0; }
+.day { text-align: center; color: #888; font-size: 0.8em; margin: 1.5em 0 0.5em; }
+.pins { margin: 1em 0; padding: 0.5em 1em; border-left: 3px solid #f5b400; background: #fffbea; }
+.pins ul { margin: 0; padding-left: 1.2em; }
+</style>
+</head>
+<body>
+<h1>%s</h1>
+<p class="took">%s · agent-chat %s</p>
+`, html.EscapeString(title), html.EscapeString(title), date.Format("2006-01-02"), html.EscapeString(version))
+	b.WriteString(pinsHTML(events))
+
+	var lastTs int64
+	for _, e := range events {
+		var who, class string
+		switch eventKind(e) {
+		case "userMessage":
+			who, class = userRole(e), "user"
+		case "agentMessage", "verbalReply", "draw":
+			who, class = agentRole(e), "agent"
+		case "dateSeparator":
+			fmt.Fprintf(&b, "<div class=\"day\">%s</div>\n", html.EscapeString(dayLabel(e.Text)))
+			continue
+		default:
+			continue
+		}
+		text := strings.TrimSpace(e.Text)
+		files := transcriptFilesHTML(e.Files, imageMap)
+		if text == "" && files == "" && (e.Type != "draw" || len(e.Instructions) == 0) {
+			continue
+		}
+		if class == "agent" && lastTs > 0 && e.Timestamp > lastTs {
+			fmt.Fprintf(&b, "<div class=\"took\">took %s</div>\n", formatElapsed(e.Timestamp-lastTs))
+		}
+		fmt.Fprintf(&b, "<div class=\"turn %s\">\n<div class=\"who\">%s</div>\n", class, html.EscapeString(who))
+		if text != "" {
+			fmt.Fprintf(&b, "<div class=\"text\">%s</div>\n", html.EscapeString(text))
+		}
+		if e.Type == "draw" {
+			b.WriteString(renderDrawSVG(e.Instructions))
+			b.WriteString("\n")
+		}
+		b.WriteString(files)
+		if labels := metaLabels(e.Meta); class == "agent" && len(labels) > 0 {
+			for i, l := range labels {
+				labels[i] = html.EscapeString(l)
+			}
+			fmt.Fprintf(&b, "<p class=\"meta\">%s</p>\n", strings.Join(labels, " · "))
+		}
+		if class == "agent" && len(e.QuickReplies) > 0 {
+			var replies []string
+			for _, r := range e.QuickReplies {
+				if strings.TrimSpace(r) != "" {
+					replies = append(replies, html.EscapeString(r))
+				}
+			}
+			if len(replies) > 0 {
+				fmt.Fprintf(&b, "<p class=\"replies\">Quick replies: %s</p>\n", strings.Join(replies, " · "))
+			}
+		}
+		b.WriteString("</div>\n")
+		if e.Timestamp > 0 {
+			lastTs = e.Timestamp
+		}
+	}
+	b.WriteString("</body>\n</html>\n")
+	return b.String()
+}
+
+// transcriptFilesHTML renders a turn's inlined attachments: images as <img>,
+// everything else as a download link.
+func transcriptFilesHTML(files []FileRef, imageMap map[string]string) string {
+	var items []string
+	for _, f := range files {
+		src := imageMap[f.Path]
+		if src == "" {
+			continue
+		}
+		if isImage(f) {
+			items = append(items, fmt.Sprintf(`<img src="%s" alt="%s">`, html.EscapeString(src), html.EscapeString(f.Name)))
+		} else {
+			items = append(items, fmt.Sprintf(`<a href="%s" download="%s">%s</a>`, html.EscapeString(src), html.EscapeString(f.Name), html.EscapeString(f.Name)))
+		}
+	}
+	if len(items) == 0 {
+		return ""
+	}
+	return "<div class=\"files\">" + strings.Join(items, "") + "</div>\n"
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeExportFixture(t *testing.T) (logPath, uploadDir string) {
+	t.Helper()
+	dir := t.TempDir()
+	uploadDir = filepath.Join(dir, "uploads")
+	os.MkdirAll(uploadDir, 0755)
+	os.WriteFile(filepath.Join(uploadDir, "shot.png"), []byte("PNGDATA"), 0644)
+	logPath = filepath.Join(dir, "my_session.jsonl")
+	log := strings.Join([]string{
+		`{"type":"userMessage","seq":1,"id":"a","text":"look <here>","files":[{"name":"shot.png","path":"/gone/shot.png","type":"image/png"}],"ts":1000}`,
+		`{"type":"userMessage","seq":2,"id":"b","text":"unsent","ts":1500}`,
+		`{"type":"userMessageDeleted","seq":3,"id":"b"}`,
+		`{"type":"agentMessage","seq":4,"text":"Here's a sketch","ts":2000,"quick_replies":["Thanks"]}`,
+		`{"type":"draw","seq":5,"instructions":[{"type":"setColor","color":"#f00"},{"type":"drawRect","x":10,"y":20,"width":100,"height":50,"fill":"#0f0","fillStyle":"hachure"},{"type":"moveTo","x":1,"y":2},{"type":"lineTo","x":3.5,"y":4},{"type":"writeText","text":"a&b","x":5,"y":6}],"ts":4500}`,
+		``,
+	}, "\n")
+	os.WriteFile(logPath, []byte(log), 0644)
+	return logPath, uploadDir
+}
+
+func TestExportMarkdownInlinesImagesAndDraws(t *testing.T) {
+	logPath, uploadDir := writeExportFixture(t)
+	var out bytes.Buffer
+	if code := runExport([]string{"-upload-dir", uploadDir, logPath}, &out); code != 0 {
+		t.Fatalf("runExport exit %d", code)
+	}
+	md := out.String()
+	for _, want := range []string{
+		"# My Session",
+		"**USER**\n\n> look <here>",
+		`src="data:image/png;base64,UE5HREFUQQ=="`,
+		"**AGENT**\n\n> Here's a sketch",
+		"<small>took 2.5s</small><br>\n**AGENT**\n\n> <svg ",
+		`<rect x="10" y="20" width="100" height="50" stroke="#f00" stroke-width="2" fill="#0f0" fill-opacity="0.5"/>`,
+		`<line x1="1" y1="2" x2="3.5" y2="4"`,
+		`>a&amp;b</text>`,
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown missing %q\n---\n%s", want, md)
+		}
+	}
+	if strings.Contains(md, "unsent") {
+		t.Errorf("withdrawn message should not be exported:\n%s", md)
+	}
+}
+
+func TestExportHTMLToFile(t *testing.T) {
+	logPath, uploadDir := writeExportFixture(t)
+	dst := filepath.Join(t.TempDir(), "out.html")
+	if code := runExport([]string{"-upload-dir", uploadDir, "-o", dst, logPath}, &bytes.Buffer{}); code != 0 {
+		t.Fatalf("runExport exit %d", code)
+	}
+	data, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(data)
+	for _, want := range []string{
+		"<!DOCTYPE html>",
+		"<title>My Session</title>",
+		`<div class="text">look &lt;here&gt;</div>`,
+		`<img src="data:image/png;base64,UE5HREFUQQ==" alt="shot.png">`,
+		"<svg ",
+		"Quick replies: Thanks",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("html missing %q", want)
+		}
+	}
+}
+
+// An attachment's Type comes from the uploader; one that breaks out of the
+// src attribute must not reach the page.
+func TestExportHostileAttachmentType(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "shot.png"), []byte("PNGDATA"), 0o644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hi"), 0o644)
+	files := []FileRef{
+		{Name: "shot.png", Path: filepath.Join(dir, "shot.png"), Type: `image/png" onerror="alert(1)`},
+		{Name: "notes.txt", Path: filepath.Join(dir, "notes.txt"), Type: `text/plain; x="><script>alert(1)</script>`},
+	}
+	for _, format := range []string{"html", "md"} {
+		doc, _ := renderTranscript([]Event{{Type: "userMessage", Seq: 1, Text: "look", Files: files}}, format, "t", dir)
+		for _, bad := range []string{"onerror", "<script"} {
+			if strings.Contains(doc, bad) {
+				t.Errorf("%s: %q reached the page:\n%s", format, bad, doc)
+			}
+		}
+		for _, want := range []string{"data:image/png;base64,", "data:text/plain;base64,"} {
+			if !strings.Contains(doc, want) {
+				t.Errorf("%s: missing %q:\n%s", format, want, doc)
+			}
+		}
+	}
+	if got := attachmentType(FileRef{Name: "x", Type: "not a type"}); got != "application/octet-stream" {
+		t.Errorf("attachmentType(garbage) = %q", got)
+	}
+}
+
+func TestExportRejectsUnknownFormat(t *testing.T) {
+	logPath, _ := writeExportFixture(t)
+	if code := runExport([]string{"-format", "pdf", logPath}, &bytes.Buffer{}); code != 2 {
+		t.Errorf("exit = %d, want 2", code)
+	}
+}
+
+func TestExportTranscriptTool(t *testing.T) {
+	origBus, origDir, origURL := bus, uploadDir, uiURL
+	bus = NewEventBus()
+	uploadDir = t.TempDir()
+	uiURL = "http://localhost:1234"
+	t.Cleanup(func() { bus, uploadDir, uiURL = origBus, origDir, origURL })
+	bus.Publish(Event{Type: "agentMessage", Text: "All done"})
+
+	text, isErr := callTool(t, bus, "export_transcript", map[string]any{"format": "html", "title": "Auth Fix"})
+	if isErr {
+		t.Fatalf("tool error: %s", text)
+	}
+	matches, _ := filepath.Glob(filepath.Join(uploadDir, "transcript-*-auth-fix.html"))
+	if len(matches) != 1 {
+		t.Fatalf("transcript not written: %v (%s)", matches, text)
+	}
+	if !strings.Contains(text, matches[0]) || !strings.Contains(text, "http://localhost:1234/uploads/"+filepath.Base(matches[0])) {
+		t.Errorf("result should name path and URL: %s", text)
+	}
+	if data, _ := os.ReadFile(matches[0]); !strings.Contains(string(data), "All done") {
+		t.Errorf("transcript missing message")
+	}
+
+	if text, isErr := callTool(t, bus, "export_transcript", map[string]any{"format": "pdf"}); !isErr || !strings.Contains(text, "html") {
+		t.Errorf("pdf should be rejected with a pointer to html: %v %s", isErr, text)
+	}
+}
+
+func TestExportLeavesOutReplacedProgress(t *testing.T) {
+	events := []Event{
+		{Seq: 1, Type: "agentMessage", Text: "Step 1/3", AgentToolName: "send_progress"},
+		{Seq: 2, Type: "userMessagesConsumed"},
+		{Seq: 3, Type: "agentMessage", Text: "Step 2/3", AgentToolName: "send_progress", Replace: true},
+		{Seq: 4, Type: "agentMessage", Text: "Step 3/3", AgentToolName: "send_progress", Replace: true},
+		{Seq: 5, Type: "agentMessage", Text: "Done?", AgentToolName: "send_message"},
+		{Seq: 6, Type: "agentMessage", Text: "Cleaning up", AgentToolName: "send_progress", Replace: true},
+	}
+	md, _ := renderTranscript(events, "md", "Build", t.TempDir())
+	for _, gone := range []string{"Step 1/3", "Step 2/3"} {
+		if strings.Contains(md, gone) {
+			t.Errorf("replaced update %q exported:\n%s", gone, md)
+		}
+	}
+	for _, kept := range []string{"Step 3/3", "Done?", "Cleaning up"} {
+		if !strings.Contains(md, kept) {
+			t.Errorf("%q missing from export:\n%s", kept, md)
+		}
+	}
+}
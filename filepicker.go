@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/choonkeat/agent-chat/pkg/wire"
+	"github.com/google/uuid"
+)
+
+// pick_file asks the person chatting to choose files from the -share-dir
+// tree rather than have the agent guess paths or the user type them. The
+// prompt is a "filePicker" event, its FilePicker in Data; the page renders
+// a browser over /api/files with Choose / Cancel. The first tab to answer
+// settles it, and a "filePickerAnswered" event (ID the request, Text its
+// status, Files what was picked) settles the card in every tab.
+
+// FilePicker is the Data of a "filePicker" event.
+type FilePicker struct {
+	RequestID string `json:"request_id"`
+	Prompt    string `json:"prompt,omitempty"`
+	Path      string `json:"path,omitempty"` // directory to open at, relative to shareDir
+	Multiple  bool   `json:"multiple,omitempty"`
+}
+
+func (p FilePicker) Summary() string {
+	text := "📂 **File request**"
+	if p.Prompt != "" {
+		text += "\n\n" + p.Prompt
+	}
+	return text
+}
+
+func init() {
+	wire.RegisterData[FilePicker]("filePicker")
+}
+
+// filePick is a tab's answer to a file request: the paths chosen, none
+// when the user cancelled, and once checked the shared files they name.
+type filePick struct {
+	Paths []string
+	Files []FileRef
+	From  string // display name of whoever answered
+}
+
+// status is the filePickerAnswered Text the pick settles its prompt with.
+func (p filePick) status() string {
+	if len(p.Files) == 0 {
+		return "declined"
+	}
+	return "picked"
+}
+
+// text is the tool result for the agent.
+func (p filePick) text() string {
+	if len(p.Files) == 0 {
+		return "The user did not pick a file."
+	}
+	paths := make([]string, len(p.Files))
+	for i, f := range p.Files {
+		paths[i] = f.Path
+	}
+	return "The user picked:\n" + strings.Join(paths, "\n")
+}
+
+// sharedFiles resolves the paths a tab picked to refs of shared files,
+// dropping any that are not one; only the first is kept unless multiple.
+func sharedFiles(paths []string, multiple bool) []FileRef {
+	var refs []FileRef
+	for _, p := range paths {
+		full, rel, err := resolveShared(p)
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(full)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		refs = append(refs, FileRef{Name: info.Name(), Path: full, URL: "/files/" + rel, Size: info.Size(), Type: sharedType(rel)})
+		if !multiple {
+			break
+		}
+	}
+	return refs
+}
+
+// createFilePick registers a pending file request and returns its id and
+// the channel its answer arrives on.
+func (eb *EventBus) createFilePick() (string, chan filePick) {
+	id := uuid.New().String()
+	ch := make(chan filePick, 1)
+	eb.pickMu.Lock()
+	if eb.pendingPicks == nil {
+		eb.pendingPicks = make(map[string]chan filePick)
+	}
+	eb.pendingPicks[id] = ch
+	eb.pickMu.Unlock()
+	return id, ch
+}
+
+// ResolveFilePick delivers a tab's answer to file request id. It reports
+// false when the request was already answered or has gone.
+func (eb *EventBus) ResolveFilePick(id string, pick filePick) bool {
+	eb.pickMu.Lock()
+	ch, ok := eb.pendingPicks[id]
+	delete(eb.pendingPicks, id)
+	eb.pickMu.Unlock()
+	if ok {
+		ch <- pick
+	}
+	return ok
+}
+
+// pickFiles publishes a file request and waits for the first tab's answer.
+// When ctx ends first the prompt is marked cancelled and ctx's error
+// returned.
+func (eb *EventBus) pickFiles(ctx context.Context, prompt, path string, multiple bool, meta *ToolMeta) (filePick, error) {
+	id, ch := eb.createFilePick()
+	e, err := wire.NewEvent("filePicker", FilePicker{RequestID: id, Prompt: strings.TrimSpace(prompt), Path: path, Multiple: multiple})
+	if err != nil {
+		eb.ResolveFilePick(id, filePick{})
+		return filePick{}, err
+	}
+	e.AgentToolName, e.Meta = "pick_file", meta
+	seq := eb.Publish(e)
+
+	var pick filePick
+	select {
+	case pick = <-ch:
+	case <-ctx.Done():
+		if eb.ResolveFilePick(id, filePick{}) {
+			eb.Publish(Event{Type: "filePickerAnswered", ID: id, ReplyTo: seq, Text: "cancelled"})
+			return filePick{}, ctx.Err()
+		}
+		pick = <-ch // answered just as the call ended
+	}
+	pick.Files = sharedFiles(pick.Paths, multiple)
+	eb.Publish(Event{Type: "filePickerAnswered", ID: id, ReplyTo: seq, Text: pick.status(), Files: pick.Files, From: pick.From})
+	return pick, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/choonkeat/agent-chat/pkg/client"
+	"github.com/choonkeat/agent-chat/pkg/wire"
+)
+
+func TestPickFileOverWebSocket(t *testing.T) {
+	shareTree(t)
+	base := startWSServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var tabs [2]*client.Client
+	for i, name := range []string{"Ana", "Bo"} {
+		c, err := client.Dial(ctx, base, client.Options{ClientID: name, Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		waitType(t, ctx, c, "historyEnd")
+		tabs[i] = c
+	}
+
+	type answer struct {
+		pick filePick
+		err  error
+	}
+	done := make(chan answer, 1)
+	go func() {
+		pick, err := bus.pickFiles(ctx, "Which notes?", "", false, nil)
+		done <- answer{pick, err}
+	}()
+
+	prompt := waitType(t, ctx, tabs[0], "filePicker")
+	picker, err := wire.DecodeData[FilePicker](prompt.Event)
+	if err != nil || picker.Prompt != "Which notes?" || picker.Multiple || !strings.Contains(prompt.Text, "Which notes?") {
+		t.Fatalf("prompt = %+v, %v", prompt.Event, err)
+	}
+	// One file was asked for: the second is dropped, as is the dotfile.
+	if err := tabs[0].PickFiles(picker.RequestID, ".env", "notes.txt", "src/main.go"); err != nil {
+		t.Fatal(err)
+	}
+	got := <-done
+	if got.err != nil || len(got.pick.Files) != 1 || filepath.Base(got.pick.Files[0].Path) != "notes.txt" || !filepath.IsAbs(got.pick.Files[0].Path) {
+		t.Fatalf("pick = %+v, %v", got.pick, got.err)
+	}
+	if text := got.pick.text(); !strings.Contains(text, got.pick.Files[0].Path) {
+		t.Errorf("tool result = %q", text)
+	}
+
+	// Every tab hears what was picked.
+	f := waitType(t, ctx, tabs[1], "filePickerAnswered")
+	if f.ReplyTo != prompt.Seq || f.ID != picker.RequestID || f.Text != "picked" || f.From != "Ana" || len(f.Files) != 1 || f.Files[0].URL != "/files/notes.txt" {
+		t.Errorf("filePickerAnswered = %+v", f.Event)
+	}
+
+	// A second answer finds the request gone.
+	if err := tabs[1].PickFiles(picker.RequestID); err != nil {
+		t.Fatal(err)
+	}
+	waitType(t, ctx, tabs[1], "filePickerClosed")
+}
+
+func TestPickFileDeclinedOrCancelled(t *testing.T) {
+	shareTree(t)
+	eb := NewEventBus()
+	go func() {
+		for !eb.ResolveFilePick(pendingPick(eb), filePick{Paths: []string{"../outside.txt"}}) {
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	pick, err := eb.pickFiles(context.Background(), "", "", true, nil)
+	if err != nil || pick.status() != "declined" || !strings.Contains(pick.text(), "did not pick") {
+		t.Errorf("declined: %+v, %v", pick, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := eb.pickFiles(ctx, "", "", false, nil); err == nil {
+		t.Error("want an error once the call is cancelled")
+	}
+	events, _ := eb.History()
+	if last := events[len(events)-1]; last.Type != "filePickerAnswered" || last.Text != "cancelled" {
+		t.Errorf("last event = %+v", last)
+	}
+	if id := pendingPick(eb); id != "" {
+		t.Errorf("request %s left pending", id)
+	}
+}
+
+func TestPickFileNeedsShareDir(t *testing.T) {
+	got, isErr := callTool(t, NewEventBus(), "pick_file", map[string]any{"prompt": "Which?"})
+	if !isErr || !strings.Contains(got, "-share-dir") {
+		t.Errorf("pick_file without -share-dir = %q", got)
+	}
+}
+
+// pendingPick returns the id of a pending file request, or "".
+func pendingPick(eb *EventBus) string {
+	eb.pickMu.Lock()
+	defer eb.pickMu.Unlock()
+	for id := range eb.pendingPicks {
+		return id
+	}
+	return ""
+}
@@ -1,4 +1,4 @@
-module agent-chat
+module github.com/choonkeat/agent-chat
 
 go 1.23.0
 
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Highlights are the agent's laser pointer: a short-lived mark on a drawing
+// (a point, a region, or a layer of a named canvas) or on a whole message,
+// to point at what it is talking about, say while it speaks in voice mode.
+// They are sent to the open tabs as a transient "highlight" event and are
+// not logged, so they are gone on a reload and never replayed or exported.
+
+// Bounds on how long a highlight stays up, in milliseconds.
+const (
+	defaultHighlightTTL = 3000
+	maxHighlightTTL     = 30000
+)
+
+// highlightPad is the margin kept around a layer's strokes when it is
+// highlighted.
+const highlightPad = 8
+
+// highlightTarget is what a highlight points at. A point sets X and Y; a
+// region sets Width and Height too. With neither, the message itself is
+// highlighted.
+type highlightTarget struct {
+	Seq           int64
+	X, Y          *float64
+	Width, Height float64
+	Canvas, Layer string
+	TTL           int
+}
+
+// Highlight publishes a highlight for t and returns the event sent. Seq 0
+// points at the latest drawing.
+func (eb *EventBus) Highlight(t highlightTarget) (map[string]any, error) {
+	ttl := t.TTL
+	switch {
+	case ttl == 0:
+		ttl = defaultHighlightTTL
+	case ttl < 0 || ttl > maxHighlightTTL:
+		return nil, fmt.Errorf("ttl_ms must be 1 to %d", maxHighlightTTL)
+	}
+	target, err := eb.highlightEvent(t.Seq)
+	if err != nil {
+		return nil, err
+	}
+	ev := map[string]any{"type": "highlight", "seq": target.Seq, "ttl_ms": ttl}
+	if t.Layer != "" {
+		if t.X != nil || t.Y != nil {
+			return nil, fmt.Errorf("give a layer or a point, not both")
+		}
+		x, y, w, h, err := eb.scenes.layerBounds(t.Canvas, t.Layer)
+		if err != nil {
+			return nil, err
+		}
+		t.X, t.Y, t.Width, t.Height = &x, &y, w, h
+	}
+	if (t.X == nil) != (t.Y == nil) {
+		return nil, fmt.Errorf("a point needs both x and y")
+	}
+	if t.X == nil {
+		if t.Width != 0 || t.Height != 0 {
+			return nil, fmt.Errorf("a region needs x and y")
+		}
+		eb.PublishTransient(ev)
+		return ev, nil
+	}
+	if eventKind(target) != "draw" {
+		return nil, fmt.Errorf("#%d is not a drawing; leave out x and y to highlight the whole message", target.Seq)
+	}
+	if t.Width < 0 || t.Height < 0 || (t.Width == 0) != (t.Height == 0) {
+		return nil, fmt.Errorf("a region needs a positive width and height")
+	}
+	ev["x"], ev["y"] = *t.X, *t.Y
+	if t.Width > 0 {
+		ev["width"], ev["height"] = t.Width, t.Height
+	}
+	eb.PublishTransient(ev)
+	return ev, nil
+}
+
+// highlightEvent finds the message a highlight goes on: the one with seq,
+// or the latest drawing when seq is 0.
+func (eb *EventBus) highlightEvent(seq int64) (Event, error) {
+	eb.mu.RLock()
+	defer eb.mu.RUnlock()
+	for i := len(eb.eventLog) - 1; i >= 0; i-- {
+		e := eb.eventLog[i]
+		switch {
+		case seq == 0 && eventKind(e) == "draw":
+			return e, nil
+		case seq != 0 && e.Seq == seq && isBubble(e):
+			return e, nil
+		}
+	}
+	if seq == 0 {
+		return Event{}, fmt.Errorf("there is no drawing to highlight; give the seq of a message")
+	}
+	return Event{}, fmt.Errorf("no message #%d", seq)
+}
+
+// layerBounds is the box around the strokes on the layer called layer of
+// the canvas called canvas, padded by highlightPad.
+func (d *drawScenes) layerBounds(canvas, layer string) (x, y, w, h float64, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.scenes[canvas]
+	if s == nil {
+		return 0, 0, 0, 0, fmt.Errorf("no canvas %q; give the canvas the layer was drawn on", canvas)
+	}
+	_, l := s.layer(layer)
+	if l == nil {
+		return 0, 0, 0, 0, fmt.Errorf("no layer %q on canvas %q (layers: %s)", layer, canvas, s.names())
+	}
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	add := func(x0, y0, x1, y1 float64) {
+		minX, minY = min(minX, x0), min(minY, y0)
+		maxX, maxY = max(maxX, x1), max(maxY, y1)
+	}
+	for _, raw := range l.ops {
+		m, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		px, okX := m["x"].(float64)
+		py, okY := m["y"].(float64)
+		if !okX || !okY {
+			continue
+		}
+		switch m["type"] {
+		case "drawRect", "drawEllipse", "clearRegion":
+			w, _ := m["width"].(float64)
+			h, _ := m["height"].(float64)
+			add(px, py, px+w, py+h)
+		case "drawCircle":
+			r, _ := m["radius"].(float64)
+			add(px-r, py-r, px+r, py+r)
+		case "writeText":
+			text, _ := m["text"].(string)
+			fs, ok := m["fontSize"].(float64)
+			if !ok || fs <= 0 {
+				fs = drawFontSize
+			}
+			half := fs * 0.8
+			add(px, py-half, px+measureTextWidth(text, fs), py+half)
+		default:
+			add(px, py, px, py)
+		}
+	}
+	if math.IsInf(minX, 1) {
+		return 0, 0, 0, 0, fmt.Errorf("layer %q has nothing drawn on it", layer)
+	}
+	return minX - highlightPad, minY - highlightPad, maxX - minX + 2*highlightPad, maxY - minY + 2*highlightPad, nil
+}
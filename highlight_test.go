@@ -0,0 +1,73 @@
+package main
+
+import "testing"
+
+func TestHighlight(t *testing.T) {
+	eb := NewEventBus()
+	sink := make(chan any, 8)
+	eb.SubscribeTransient(sink)
+	defer eb.UnsubscribeTransient(sink)
+
+	if _, isErr := callTool(t, eb, "highlight", map[string]any{"x": 10, "y": 10}); !isErr {
+		t.Error("highlighted with no drawing in the chat")
+	}
+	eb.Publish(Event{Type: "agentMessage", Text: "look"})
+	eb.Publish(Event{Type: "draw", Instructions: []any{map[string]any{"type": "drawRect", "x": 0.0, "y": 0.0, "width": 10.0, "height": 10.0}}})
+	eb.Publish(Event{Type: "agentMessage", Text: "after"})
+
+	got, isErr := callTool(t, eb, "highlight", map[string]any{"x": 100, "y": 50, "width": 200, "height": 80, "ttl_ms": 1500})
+	if isErr || got != "Highlighted #2 for 1500ms." {
+		t.Fatalf("highlight = %q (error %v)", got, isErr)
+	}
+	ev := (<-sink).(map[string]any)
+	if ev["type"] != "highlight" || ev["seq"] != int64(2) || ev["x"] != 100.0 || ev["width"] != 200.0 || ev["ttl_ms"] != 1500 {
+		t.Errorf("event = %v", ev)
+	}
+	if history, _ := eb.History(); len(history) != 3 {
+		t.Errorf("highlight was logged: %d events", len(history))
+	}
+
+	got, isErr = callTool(t, eb, "highlight", map[string]any{"seq": 1})
+	if isErr || got != "Highlighted #1 for 3000ms." {
+		t.Fatalf("highlight message = %q (error %v)", got, isErr)
+	}
+	if ev := (<-sink).(map[string]any); ev["x"] != nil {
+		t.Errorf("a whole-message highlight carried a point: %v", ev)
+	}
+
+	for name, args := range map[string]map[string]any{
+		"point on a message": {"seq": 1, "x": 1, "y": 1},
+		"unknown seq":        {"seq": 99},
+		"half a point":       {"x": 1},
+		"half a region":      {"x": 1, "y": 1, "width": 5},
+		"ttl too long":       {"ttl_ms": maxHighlightTTL + 1},
+		"unknown canvas":     {"canvas": "nope", "layer": "base"},
+	} {
+		if _, isErr := callTool(t, eb, "highlight", args); !isErr {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestHighlightLayer(t *testing.T) {
+	eb := NewEventBus()
+	_, _, err := eb.scenes.compile("arch", []any{
+		map[string]any{"type": "drawRect", "x": 0.0, "y": 0.0, "width": 900.0, "height": 550.0},
+		map[string]any{"type": "layer", "name": "cache"},
+		map[string]any{"type": "drawCircle", "x": 100.0, "y": 100.0, "radius": 20.0},
+		map[string]any{"type": "drawRect", "x": 150.0, "y": 90.0, "width": 50.0, "height": 40.0},
+	}, func([]any) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, y, w, h, err := eb.scenes.layerBounds("arch", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x != 80-highlightPad || y != 80-highlightPad || w != 120+2*highlightPad || h != 50+2*highlightPad {
+		t.Errorf("cache bounds = %g,%g %gx%g", x, y, w, h)
+	}
+	if _, _, _, _, err := eb.scenes.layerBounds("arch", "db"); err == nil {
+		t.Error("bounds of a layer that does not exist")
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// localesFS holds the translation bundles, one directory per locale: an
+// agent-reply.tmpl (and optionally session-prompts.tmpl) overriding the
+// embedded agent-facing templates, and a ui.json for the browser.
+//
+//go:embed locales
+var localesFS embed.FS
+
+// localeBundle is a locale's browser-side strings.
+type localeBundle struct {
+	Locale  string            `json:"locale"`
+	Speech  string            `json:"speech"`  // BCP 47 tag for speech recognition, e.g. "es-ES"
+	Strings map[string]string `json:"strings"` // English UI text → translation
+}
+
+// uiLocale is the bundle selected with -locale; nil means the built-in
+// English, or with no -locale, whatever each browser's Accept-Language
+// asks for (see negotiateLocale).
+var uiLocale *localeBundle
+
+// localeFlagSet records that -locale was given, so the server's language
+// also holds for every page.
+var localeFlagSet bool
+
+// availableLocales lists the bundled locales (English is implicit).
+func availableLocales() []string {
+	entries, _ := fs.ReadDir(localesFS, "locales")
+	var out []string
+	for _, e := range entries {
+		if e.IsDir() {
+			out = append(out, e.Name())
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// loadLocale selects a locale for both sides of the chat: its templates are
+// layered over the embedded ones (so FormatMessages and the reply
+// instructions speak the user's language) and its UI strings are returned
+// for the page. "" and "en" are the built-in English and return nil.
+func loadLocale(locale string) (*localeBundle, error) {
+	if locale == "" || locale == "en" {
+		return nil, nil
+	}
+	b, err := readLocaleBundle(locale)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := fs.Sub(localesFS, "locales/"+locale)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := applyTemplateOverrides(dir); err != nil {
+		return nil, fmt.Errorf("locale %s: %w", locale, err)
+	}
+	return b, nil
+}
+
+// readLocaleBundle reads a bundled locale's UI strings, leaving the
+// templates alone.
+func readLocaleBundle(locale string) (*localeBundle, error) {
+	if !fs.ValidPath(locale) || strings.Contains(locale, "/") {
+		return nil, fmt.Errorf("unknown locale %q (available: en %v)", locale, availableLocales())
+	}
+	data, err := fs.ReadFile(localesFS, "locales/"+locale+"/ui.json")
+	if err != nil {
+		return nil, fmt.Errorf("unknown locale %q (available: en %v)", locale, availableLocales())
+	}
+	b := &localeBundle{}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("locale %s: ui.json: %w", locale, err)
+	}
+	b.Locale = locale
+	return b, nil
+}
+
+// negotiateLocale picks the bundled locale an Accept-Language header
+// prefers ("es-MX,es;q=0.9,en;q=0.8" → "es"), matching on the primary
+// subtag; "en" when it names none of them.
+func negotiateLocale(header string) string {
+	available := map[string]bool{"en": true}
+	for _, l := range availableLocales() {
+		available[l] = true
+	}
+	best, bestQ := "en", 0.0
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		primary, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if available[primary] && q > bestQ {
+			best, bestQ = primary, q
+		}
+	}
+	return best
+}
+
+// pageLocale is the bundle a page requested with r is served in: the
+// -locale one when given, else its Accept-Language's pick.
+func pageLocale(r *http.Request) *localeBundle {
+	if localeFlagSet {
+		return uiLocale
+	}
+	b, _ := readLocaleBundle(negotiateLocale(r.Header.Get("Accept-Language")))
+	return b
+}
+
+// handleLocaleBundle serves GET /i18n/<locale>.json: a bundled locale's UI
+// strings and speech language, as the page gets them inline. "auto" is the
+// one the page would get: -locale's, or the request's Accept-Language pick.
+func handleLocaleBundle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/i18n/"), ".json")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	var b *localeBundle
+	switch name {
+	case "auto":
+		w.Header().Set("Vary", "Accept-Language")
+		b = pageLocale(r)
+	case "en":
+	default:
+		var err error
+		if b, err = readLocaleBundle(name); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	}
+	lang, speech, bundle := localeConfig(b)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Language", lang)
+	json.NewEncoder(w).Encode(struct {
+		Locale  string          `json:"locale"`
+		Speech  string          `json:"speech"`
+		Strings json.RawMessage `json:"strings"`
+	}{lang, speech, bundle})
+}
+
+// localeConfig is the page-config fragment for the browser: the document
+// language, the speech-recognition language and the string bundle. English
+// gets an empty bundle, so the UI's own text stands.
+func localeConfig(b *localeBundle) (lang, speech string, bundle []byte) {
+	if b == nil {
+		return "en", "en-US", []byte("{}")
+	}
+	bundle = []byte("{}")
+	if b.Strings != nil {
+		bundle, _ = json.Marshal(b.Strings)
+	}
+	return b.Locale, b.Speech, bundle
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestLoadLocale(t *testing.T) {
+	reply, sessions := agentReplyTmpl, sessionPromptsTmpl
+	notEcho, empty := executeNotEchoGuidance, emptyQueueGuidance
+	t.Cleanup(func() {
+		agentReplyTmpl, sessionPromptsTmpl = reply, sessions
+		executeNotEchoGuidance, emptyQueueGuidance = notEcho, empty
+	})
+
+	if b, err := loadLocale("en"); b != nil || err != nil {
+		t.Errorf("en = %+v, %v; want the built-in English", b, err)
+	}
+	if _, err := loadLocale("xx"); err == nil || !strings.Contains(err.Error(), "es") {
+		t.Errorf("unknown locale error = %v; want the available list", err)
+	}
+
+	b, err := loadLocale("es")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Speech != "es-ES" || b.Strings["Send"] != "Enviar" {
+		t.Errorf("bundle = %+v", b)
+	}
+	if got := FormatMessages([]UserMessage{{Text: "\U0001f3a4 hola"}}); !strings.HasPrefix(got, "Voz del usuario") {
+		t.Errorf("FormatMessages = %q", got)
+	}
+	if got := voiceSuffix(nil); !strings.Contains(got, "send_message") || !strings.Contains(got, "español") {
+		t.Errorf("voiceSuffix = %q", got)
+	}
+	if !strings.HasPrefix(emptyQueueGuidance, `{"queue":"empty"}`) {
+		t.Errorf("emptyQueueGuidance = %q", emptyQueueGuidance)
+	}
+
+	lang, speech, bundle := localeConfig(b)
+	var strs map[string]string
+	if err := json.Unmarshal(bundle, &strs); err != nil || lang != "es" || speech != "es-ES" || strs["Send"] != "Enviar" {
+		t.Errorf("localeConfig = %s, %s, %s (%v)", lang, speech, bundle, err)
+	}
+}
+
+// Every bundle must keep the placeholders its English key has (in any
+// order), or tr() would drop an argument.
+func TestLocaleBundlesKeepPlaceholders(t *testing.T) {
+	placeholder := regexp.MustCompile(`\{\d\}`)
+	for _, locale := range availableLocales() {
+		data, err := localesFS.ReadFile("locales/" + locale + "/ui.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b localeBundle
+		if err := json.Unmarshal(data, &b); err != nil {
+			t.Fatalf("%s: %v", locale, err)
+		}
+		for en, tr := range b.Strings {
+			got, want := placeholder.FindAllString(tr, -1), placeholder.FindAllString(en, -1)
+			sort.Strings(got)
+			sort.Strings(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: %q → %q: placeholders %s, want %s", locale, en, tr, got, want)
+			}
+		}
+	}
+}
+
+func TestNegotiateLocale(t *testing.T) {
+	for header, want := range map[string]string{
+		"":                        "en",
+		"es-MX,es;q=0.9,en;q=0.8": "es",
+		"en-GB,en;q=0.9,es;q=0.5": "en",
+		"fr-FR,fr;q=0.9,es;q=0.7": "es",
+		"de;q=0.9, ES-ar;q=0.95":  "es",
+		"fr, de":                  "en",
+		"en;q=0.2, es;q=bad":      "es",
+	} {
+		if got := negotiateLocale(header); got != want {
+			t.Errorf("negotiateLocale(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestHandleLocaleBundle(t *testing.T) {
+	origLocale, origSet := uiLocale, localeFlagSet
+	t.Cleanup(func() { uiLocale, localeFlagSet = origLocale, origSet })
+	uiLocale, localeFlagSet = nil, false
+
+	get := func(path, accept string) (*httptest.ResponseRecorder, localeBundle) {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept-Language", accept)
+		rec := httptest.NewRecorder()
+		handleLocaleBundle(rec, req)
+		var b localeBundle
+		json.Unmarshal(rec.Body.Bytes(), &b)
+		return rec, b
+	}
+
+	if rec, b := get("/i18n/es.json", ""); rec.Code != 200 || b.Locale != "es" || b.Speech != "es-ES" || b.Strings["Send"] != "Enviar" {
+		t.Errorf("es: %d %+v", rec.Code, b)
+	}
+	if rec, b := get("/i18n/en.json", "es"); rec.Code != 200 || b.Locale != "en" || len(b.Strings) != 0 {
+		t.Errorf("en: %d %+v", rec.Code, b)
+	}
+	if rec, _ := get("/i18n/xx.json", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown locale: %d", rec.Code)
+	}
+	if rec, _ := get("/i18n/../ui.json", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("path escape: %d", rec.Code)
+	}
+	rec, b := get("/i18n/auto.json", "es-AR,es;q=0.9")
+	if b.Locale != "es" || rec.Header().Get("Vary") != "Accept-Language" {
+		t.Errorf("auto: %+v, Vary %q", b, rec.Header().Get("Vary"))
+	}
+
+	// -locale holds for every browser.
+	localeFlagSet = true
+	if _, b := get("/i18n/auto.json", "es"); b.Locale != "en" {
+		t.Errorf("auto with -locale en: %+v", b)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxAgentNameLen   = 40 // runes
+	maxAgentAvatarLen = 8  // runes: room for a ZWJ emoji sequence, not a sentence
+)
+
+// agentColorRe accepts hex colors and plain CSS color names — enough for an
+// avatar, and nothing that can break out of a style attribute.
+var agentColorRe = regexp.MustCompile(`^(#[0-9a-fA-F]{3,8}|[a-zA-Z]{3,20})$`)
+
+// newAgentIdentity validates and normalizes an identity. Only name is
+// required.
+func newAgentIdentity(name, color, avatar string) (*AgentIdentity, error) {
+	name, err := normalizeName(name)
+	if err != nil {
+		return nil, err
+	}
+	color = strings.TrimSpace(color)
+	avatar = strings.TrimSpace(avatar)
+	if color != "" && !agentColorRe.MatchString(color) {
+		return nil, fmt.Errorf("color %q is not a hex color (#rrggbb) or CSS color name", color)
+	}
+	if utf8.RuneCountInString(avatar) > maxAgentAvatarLen {
+		return nil, fmt.Errorf("avatar is longer than %d characters; use an emoji or initials", maxAgentAvatarLen)
+	}
+	return &AgentIdentity{Name: name, Color: color, Avatar: avatar}, nil
+}
+
+// normalizeName collapses whitespace in a speaker name (an agent's or a
+// user's display name) and rejects names that would break out of the
+// **bold** export marker they land in.
+func normalizeName(name string) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		return "", fmt.Errorf("name is required")
+	}
+	if strings.ContainsAny(name, "*`<>\\") {
+		return "", fmt.Errorf("name may not contain * ` < > or \\")
+	}
+	if utf8.RuneCountInString(name) > maxAgentNameLen {
+		return "", fmt.Errorf("name is longer than %d characters", maxAgentNameLen)
+	}
+	return name, nil
+}
+
+// agentRole is the speaker label for an agent turn in exports: "AGENT", or
+// "AGENT · {name}" once the agent has an identity.
+func agentRole(e Event) string {
+	if e.Agent != nil && e.Agent.Name != "" {
+		return "AGENT · " + e.Agent.Name
+	}
+	return "AGENT"
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewAgentIdentity(t *testing.T) {
+	id, err := newAgentIdentity("  Code   Reviewer ", " #7c3aed ", "🦉")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Name != "Code Reviewer" || id.Color != "#7c3aed" || id.Avatar != "🦉" {
+		t.Errorf("got %+v", id)
+	}
+
+	for _, tc := range []struct{ name, color, avatar string }{
+		{"", "", ""},
+		{"**bold**", "", ""},
+		{strings.Repeat("x", maxAgentNameLen+1), "", ""},
+		{"ok", "red; background: url(x)", ""},
+		{"ok", "", "a whole sentence"},
+	} {
+		if _, err := newAgentIdentity(tc.name, tc.color, tc.avatar); err == nil {
+			t.Errorf("newAgentIdentity(%q, %q, %q): want error", tc.name, tc.color, tc.avatar)
+		}
+	}
+}
+
+// Identity is stamped on the agent's bubbles only, per session.
+func TestPublishStampsAgentIdentity(t *testing.T) {
+	bus := NewEventBus()
+	bus.SetIdentity(&AgentIdentity{Name: "Builder"})
+	other := bus.Session("client-b")
+
+	bus.Publish(Event{Type: "agentMessage", Text: "hi"})
+	bus.ReceiveUserMessage("yo", nil)
+	other.Publish(Event{Type: "agentMessage", Text: "from b"})
+
+	events := bus.EventsSince(0)
+	if events[0].Agent == nil || events[0].Agent.Name != "Builder" {
+		t.Errorf("agentMessage not stamped: %+v", events[0].Agent)
+	}
+	if events[1].Agent != nil {
+		t.Errorf("userMessage stamped with %+v", events[1].Agent)
+	}
+	if events[2].Agent != nil {
+		t.Errorf("another session's bubble stamped with %+v", events[2].Agent)
+	}
+}
+
+func TestChatMarkdownNamesAgent(t *testing.T) {
+	var st renderState
+	md := renderChatBubble(Event{Type: "agentMessage", Text: "done", Agent: &AgentIdentity{Name: "Builder"}}, &st, nil)
+	if !strings.HasPrefix(md, "**AGENT · Builder**\n") {
+		t.Errorf("got %q", md)
+	}
+	md = renderChatBubble(Event{Type: "agentMessage", Text: "done"}, &st, nil)
+	if !strings.HasPrefix(md, "**AGENT**\n") {
+		t.Errorf("unnamed agent: got %q", md)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+)
+
+// `agent-chat install` registers agent-chat as an MCP server in a client's
+// config file, so nobody has to hand-edit JSON: Claude Code's .mcp.json in
+// the project (-scope project) or its ~/.claude.json (-scope user), or
+// Claude Desktop's claude_desktop_config.json (-client claude-desktop,
+// always user scope). Every other key in the file is kept; an existing
+// entry of the same -name is replaced.
+
+// mcpServerEntry is one mcpServers entry.
+type mcpServerEntry struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+}
+
+// mcpConfigPath is the config file that -client and -scope select. dir is
+// the project directory, home the user's home directory.
+func mcpConfigPath(client, scope, dir, home, goos string, getenv func(string) string) (string, error) {
+	switch client {
+	case "claude-code":
+		switch scope {
+		case "project":
+			return filepath.Join(dir, ".mcp.json"), nil
+		case "user":
+			return filepath.Join(home, ".claude.json"), nil
+		}
+		return "", fmt.Errorf("-scope must be project or user, not %q", scope)
+	case "claude-desktop":
+		if scope != "user" {
+			return "", fmt.Errorf("claude-desktop has no project config; use -scope user")
+		}
+		switch goos {
+		case "darwin":
+			return filepath.Join(home, "Library", "Application Support", "Claude", "claude_desktop_config.json"), nil
+		case "windows":
+			if appData := getenv("APPDATA"); appData != "" {
+				return filepath.Join(appData, "Claude", "claude_desktop_config.json"), nil
+			}
+			return filepath.Join(home, "AppData", "Roaming", "Claude", "claude_desktop_config.json"), nil
+		default:
+			config := getenv("XDG_CONFIG_HOME")
+			if config == "" {
+				config = filepath.Join(home, ".config")
+			}
+			return filepath.Join(config, "Claude", "claude_desktop_config.json"), nil
+		}
+	}
+	return "", fmt.Errorf("-client must be claude-code or claude-desktop, not %q", client)
+}
+
+// mergeMCPConfig puts entry under mcpServers[name] in the config data (empty
+// for a new file) and reports whether that changed anything.
+func mergeMCPConfig(data []byte, name string, entry mcpServerEntry) ([]byte, bool, error) {
+	top := map[string]json.RawMessage{}
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, &top); err != nil {
+			return nil, false, fmt.Errorf("not a JSON object: %w", err)
+		}
+	}
+	servers := map[string]json.RawMessage{}
+	if raw, ok := top["mcpServers"]; ok && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &servers); err != nil {
+			return nil, false, fmt.Errorf("mcpServers is not a JSON object: %w", err)
+		}
+	}
+	if raw, ok := servers[name]; ok {
+		var old, want any
+		json.Unmarshal(raw, &old)
+		b, _ := json.Marshal(entry)
+		json.Unmarshal(b, &want)
+		if reflect.DeepEqual(old, want) {
+			return data, false, nil
+		}
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return nil, false, err
+	}
+	servers[name] = b
+	if top["mcpServers"], err = json.Marshal(servers); err != nil {
+		return nil, false, err
+	}
+	out, err := json.MarshalIndent(top, "", "  ")
+	if err != nil {
+		return nil, false, err
+	}
+	return append(out, '\n'), true, nil
+}
+
+// runInstall implements `agent-chat install`.
+func runInstall(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("install", flag.ContinueOnError)
+	client := fs.String("client", "claude-code", "MCP client to register with: claude-code or claude-desktop")
+	scope := fs.String("scope", "project", "claude-code only: project (.mcp.json in -dir, shared with the repo) or user (~/.claude.json, every project)")
+	name := fs.String("name", "agent-chat", "server name in mcpServers")
+	dir := fs.String("dir", "", "project directory for -scope project (default: current directory)")
+	npx := fs.Bool("npx", false, "run npx -y @choonkeat/agent-chat instead of this binary's path, so the client always gets the published version")
+	printOnly := fs.Bool("print", false, "print the updated config instead of writing it")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: agent-chat install [flags] [-- serve flags...]\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	fail := func(err error) int {
+		fmt.Fprintf(os.Stderr, "agent-chat install: %v\n", err)
+		return 1
+	}
+	if *client == "claude-desktop" && !flagPassed(fs, "scope") {
+		*scope = "user"
+	}
+	if *name == "" {
+		return fail(fmt.Errorf("-name must not be empty"))
+	}
+	project := *dir
+	if project == "" {
+		project, _ = os.Getwd()
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return fail(err)
+	}
+	path, err := mcpConfigPath(*client, *scope, project, home, runtime.GOOS, os.Getenv)
+	if err != nil {
+		return fail(err)
+	}
+
+	entry := mcpServerEntry{Command: "npx", Args: []string{"-y", "@choonkeat/agent-chat"}}
+	if !*npx {
+		exe, err := os.Executable()
+		if err != nil {
+			return fail(err)
+		}
+		if exe, err = filepath.EvalSymlinks(exe); err != nil {
+			return fail(err)
+		}
+		entry = mcpServerEntry{Command: exe}
+	}
+	entry.Args = append(entry.Args, fs.Args()...)
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fail(err)
+	}
+	merged, changed, err := mergeMCPConfig(data, *name, entry)
+	if err != nil {
+		return fail(fmt.Errorf("%s: %w", path, err))
+	}
+	if *printOnly {
+		fmt.Fprintf(out, "# %s\n%s", path, merged)
+		return 0
+	}
+	if !changed {
+		fmt.Fprintf(out, "%s already registers %q\n", path, *name)
+		return 0
+	}
+	if err := writeConfigFile(path, merged); err != nil {
+		return fail(err)
+	}
+	fmt.Fprintf(out, "Registered %q in %s\n", *name, path)
+	if *client == "claude-desktop" {
+		fmt.Fprintf(out, "Restart Claude Desktop to pick it up.\n")
+	} else {
+		fmt.Fprintf(out, "Start a new Claude Code session to pick it up (`claude mcp list` shows it).\n")
+	}
+	return 0
+}
+
+// flagPassed reports whether the flag called name was set on the command
+// line.
+func flagPassed(fs *flag.FlagSet, name string) bool {
+	passed := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			passed = true
+		}
+	})
+	return passed
+}
+
+// writeConfigFile atomically replaces path with data, keeping an existing
+// file's permissions (~/.claude.json is private).
+func writeConfigFile(path string, data []byte) error {
+	mode := fs.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".agent-chat-install-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
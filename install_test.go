@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMCPConfigPath(t *testing.T) {
+	env := func(vars map[string]string) func(string) string {
+		return func(k string) string { return vars[k] }
+	}
+	for _, tc := range []struct {
+		client, scope, goos string
+		vars                map[string]string
+		want                string
+	}{
+		{"claude-code", "project", "linux", nil, "/proj/.mcp.json"},
+		{"claude-code", "user", "darwin", nil, "/home/me/.claude.json"},
+		{"claude-desktop", "user", "darwin", nil, "/home/me/Library/Application Support/Claude/claude_desktop_config.json"},
+		{"claude-desktop", "user", "linux", map[string]string{"XDG_CONFIG_HOME": "/xdg"}, "/xdg/Claude/claude_desktop_config.json"},
+		{"claude-desktop", "user", "linux", nil, "/home/me/.config/Claude/claude_desktop_config.json"},
+		{"claude-desktop", "user", "windows", map[string]string{"APPDATA": "/appdata"}, "/appdata/Claude/claude_desktop_config.json"},
+	} {
+		got, err := mcpConfigPath(tc.client, tc.scope, "/proj", "/home/me", tc.goos, env(tc.vars))
+		if err != nil || filepath.ToSlash(got) != tc.want {
+			t.Errorf("%s/%s/%s: got %q, %v; want %q", tc.client, tc.scope, tc.goos, got, err, tc.want)
+		}
+	}
+	for _, bad := range [][2]string{{"claude-desktop", "project"}, {"claude-code", "global"}, {"cursor", "user"}} {
+		if _, err := mcpConfigPath(bad[0], bad[1], "/proj", "/home/me", "linux", env(nil)); err == nil {
+			t.Errorf("%s/%s: no error", bad[0], bad[1])
+		}
+	}
+}
+
+func TestMergeMCPConfig(t *testing.T) {
+	entry := mcpServerEntry{Command: "/usr/local/bin/agent-chat", Args: []string{"-theme", "dark"}}
+	existing := []byte(`{"numStartups": 3, "mcpServers": {"other": {"command": "other-mcp"}, "agent-chat": {"command": "old"}}}`)
+	merged, changed, err := mergeMCPConfig(existing, "agent-chat", entry)
+	if err != nil || !changed {
+		t.Fatalf("merge: changed=%v err=%v", changed, err)
+	}
+	var got struct {
+		NumStartups int                       `json:"numStartups"`
+		MCPServers  map[string]mcpServerEntry `json:"mcpServers"`
+	}
+	if err := json.Unmarshal(merged, &got); err != nil {
+		t.Fatalf("merged config is not JSON: %v\n%s", err, merged)
+	}
+	if got.NumStartups != 3 || got.MCPServers["other"].Command != "other-mcp" {
+		t.Errorf("other keys not kept:\n%s", merged)
+	}
+	if a := got.MCPServers["agent-chat"]; a.Command != entry.Command || strings.Join(a.Args, " ") != "-theme dark" {
+		t.Errorf("entry = %+v", a)
+	}
+
+	again, changed, err := mergeMCPConfig(merged, "agent-chat", entry)
+	if err != nil || changed || !bytes.Equal(again, merged) {
+		t.Errorf("re-merge: changed=%v err=%v", changed, err)
+	}
+	if fresh, changed, err := mergeMCPConfig(nil, "agent-chat", entry); err != nil || !changed || !strings.Contains(string(fresh), `"mcpServers"`) {
+		t.Errorf("new file: changed=%v err=%v\n%s", changed, err, fresh)
+	}
+	if _, _, err := mergeMCPConfig([]byte(`[1]`), "agent-chat", entry); err == nil {
+		t.Error("array config accepted")
+	}
+	if _, _, err := mergeMCPConfig([]byte(`{"mcpServers": "nope"}`), "agent-chat", entry); err == nil {
+		t.Error("string mcpServers accepted")
+	}
+}
+
+func TestRunInstallProject(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".mcp.json")
+	os.WriteFile(path, []byte(`{"mcpServers": {"other": {"command": "x"}}}`), 0o600)
+	var out bytes.Buffer
+	if code := runInstall([]string{"-dir", dir, "-npx", "-name", "chat", "--", "-no-browser"}, &out); code != 0 {
+		t.Fatalf("exit %d: %s", code, out.String())
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), `"npx"`) || !strings.Contains(string(data), `"-no-browser"`) || !strings.Contains(string(data), `"other"`) {
+		t.Errorf(".mcp.json:\n%s", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, want 0600 kept", info.Mode().Perm())
+	}
+	out.Reset()
+	runInstall([]string{"-dir", dir, "-npx", "-name", "chat", "--", "-no-browser"}, &out)
+	if !strings.Contains(out.String(), "already registers") {
+		t.Errorf("second install: %s", out.String())
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// instanceRecord is what a running agent-chat advertises about itself on
+// disk, so a second invocation for the same project can find it instead of
+// starting a fifth server and opening a fifth browser tab.
+//
+// The same record is used for the per-project lock (single-instance mode) and
+// for the registry of every live instance (`agent-chat list`,
+// GET /api/instances).
+type instanceRecord struct {
+	PID     int    `json:"pid"`
+	URL     string `json:"url,omitempty"`   // empty until the HTTP server is listening
+	Port    int    `json:"port,omitempty"`  // listening port, 0 until known
+	Project string `json:"project"`         // absolute working directory
+	Started int64  `json:"started"`         // Unix milliseconds
+	Title   string `json:"title,omitempty"` // chat title from set_chat_title
+	Name    string `json:"name,omitempty"`  // session name: -session-name, else Title
+}
+
+// agentChatHome returns the per-user state directory (~/.agent-chat). The
+// AGENT_CHAT_HOME env var overrides it, which is also how tests keep out of
+// the real home directory.
+func agentChatHome() (string, error) {
+	if dir := os.Getenv("AGENT_CHAT_HOME"); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".agent-chat"), nil
+}
+
+// projectLockPath is the lock file for project: one per working directory,
+// named by a hash so arbitrary paths map to a flat, filesystem-safe name.
+func projectLockPath(home, project string) string {
+	sum := sha256.Sum256([]byte(filepath.Clean(project)))
+	return filepath.Join(home, "locks", hex.EncodeToString(sum[:])[:16]+".json")
+}
+
+// instanceLock is a held per-project lock. Release removes the lock file, but
+// only while it still names this process — a stale-lock takeover by a later
+// instance must not be undone by our exit.
+type instanceLock struct {
+	path   string
+	record instanceRecord
+}
+
+// acquireInstanceLock claims project's lock for this process. When another
+// live process already holds it, the lock is NOT taken and that process's
+// record is returned instead. A lock whose owner is gone (crash, SIGKILL) is
+// stale and is taken over.
+func acquireInstanceLock(home, project string) (*instanceLock, *instanceRecord, error) {
+	path := projectLockPath(home, project)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, nil, fmt.Errorf("mkdir %s: %w", filepath.Dir(path), err)
+	}
+	rec := instanceRecord{PID: os.Getpid(), Project: project, Started: time.Now().UnixMilli()}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Two attempts: the second follows removal of a stale lock. Losing that
+	// race to another taker just means reporting the winner.
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			_, werr := f.Write(data)
+			f.Close()
+			if werr != nil {
+				os.Remove(path)
+				return nil, nil, fmt.Errorf("write %s: %w", path, werr)
+			}
+			return &instanceLock{path: path, record: rec}, nil, nil
+		}
+		if !os.IsExist(err) {
+			return nil, nil, fmt.Errorf("create %s: %w", path, err)
+		}
+		existing, rerr := readInstanceRecord(path)
+		if rerr == nil && existing.PID != os.Getpid() && processAlive(existing.PID) {
+			return nil, existing, nil
+		}
+		if rerr != nil && !errors.Is(rerr, os.ErrNotExist) {
+			// Unparseable: a holder may be mid-write. Only treat it as stale
+			// once it is clearly not fresh.
+			if fi, serr := os.Stat(path); serr == nil && time.Since(fi.ModTime()) < 5*time.Second {
+				return nil, nil, fmt.Errorf("lock %s is being written by another instance", path)
+			}
+		}
+		os.Remove(path)
+	}
+	return nil, nil, fmt.Errorf("could not acquire %s", path)
+}
+
+// readInstanceRecord parses an instance record file.
+func readInstanceRecord(path string) (*instanceRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rec instanceRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// writeInstanceRecord atomically replaces path with rec (temp file + rename)
+// so a concurrent reader never sees a half-written record.
+func writeInstanceRecord(path string, rec instanceRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// SetURL records the UI URL once the HTTP server is listening, so a second
+// invocation can forward to it or print it.
+func (l *instanceLock) SetURL(url string) error {
+	if l == nil {
+		return nil
+	}
+	l.record.URL = url
+	return writeInstanceRecord(l.path, l.record)
+}
+
+// Release removes the lock file if this process still owns it.
+func (l *instanceLock) Release() {
+	if l == nil {
+		return
+	}
+	if rec, err := readInstanceRecord(l.path); err == nil && rec.PID != l.record.PID {
+		return
+	}
+	os.Remove(l.path)
+}
+
+// waitForInstanceURL re-reads a running instance's lock until its URL is
+// published or timeout elapses: the holder takes the lock before its HTTP
+// server is up, so a second invocation racing a fresh first one can briefly
+// see an empty URL.
+func waitForInstanceURL(home string, rec *instanceRecord, timeout time.Duration) string {
+	path := projectLockPath(home, rec.Project)
+	deadline := time.Now().Add(timeout)
+	url := rec.URL
+	for url == "" && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+		if r, err := readInstanceRecord(path); err == nil && r.PID == rec.PID {
+			url = r.URL
+		}
+	}
+	return url
+}
+
+// runAgainstExistingInstance is what a second invocation does once
+// acquireInstanceLock reports a live holder: "refuse" prints the running
+// instance's URL and fails; "forward" relays this process's MCP stdio to the
+// running instance's /mcp endpoint until the client disconnects. Without a
+// stdio client (-no-stdio-mcp) there is nothing to forward, so forward mode
+// just points at the existing UI and exits cleanly. Returns the exit code.
+func runAgainstExistingInstance(home string, rec *instanceRecord, mode string, noStdio bool) int {
+	url := waitForInstanceURL(home, rec, 5*time.Second)
+	if url == "" {
+		fmt.Fprintf(os.Stderr, "agent-chat is already running for %s (pid %d) but has not published its URL yet\n", rec.Project, rec.PID)
+		return 1
+	}
+	if mode == "refuse" || noStdio {
+		fmt.Fprintf(os.Stderr, "agent-chat is already running for %s (pid %d): %s\n", rec.Project, rec.PID, url)
+		if mode == "refuse" {
+			return 1
+		}
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "agent-chat is already running for %s (pid %d); forwarding MCP stdio to %s/mcp\n", rec.Project, rec.PID, url)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer stop()
+	if err := forwardStdioMCP(ctx, url+"/mcp", os.Stdin, os.Stdout); err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintf(os.Stderr, "agent-chat forward: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// registryEntry is this process's record in the instance registry
+// (~/.agent-chat/instances/{pid}.json). Every serve process registers, so
+// tooling and humans can find the right UI URL among several instances. All
+// methods are nil-safe: a registry that could not be written is a warning,
+// never a reason to stop serving.
+type registryEntry struct {
+	mu     sync.Mutex
+	path   string
+	record instanceRecord
+}
+
+// registryDir is where live-instance records are kept.
+func registryDir(home string) string {
+	return filepath.Join(home, "instances")
+}
+
+// registerInstance writes rec (normally describing this process) into the
+// registry and returns the handle used to update and finally remove it.
+func registerInstance(home string, rec instanceRecord) (*registryEntry, error) {
+	dir := registryDir(home)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("mkdir %s: %w", dir, err)
+	}
+	e := &registryEntry{path: filepath.Join(dir, strconv.Itoa(rec.PID)+".json"), record: rec}
+	if err := writeInstanceRecord(e.path, rec); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Update applies mutate to the record and rewrites it.
+func (e *registryEntry) Update(mutate func(*instanceRecord)) error {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	mutate(&e.record)
+	return writeInstanceRecord(e.path, e.record)
+}
+
+// Record returns a copy of the current record.
+func (e *registryEntry) Record() instanceRecord {
+	if e == nil {
+		return instanceRecord{}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.record
+}
+
+// Remove deletes the record (clean shutdown).
+func (e *registryEntry) Remove() {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	os.Remove(e.path)
+}
+
+// listInstances returns every registered instance whose process is still
+// alive, oldest first. Records left behind by processes that died without
+// cleaning up are pruned as a side effect.
+func listInstances(home string) ([]instanceRecord, error) {
+	dir := registryDir(home)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var out []instanceRecord
+	for _, de := range entries {
+		if de.IsDir() || filepath.Ext(de.Name()) != ".json" {
+			continue
+		}
+		path := filepath.Join(dir, de.Name())
+		rec, err := readInstanceRecord(path)
+		if err != nil {
+			continue // mid-write or foreign file; leave it alone
+		}
+		if !processAlive(rec.PID) {
+			os.Remove(path)
+			continue
+		}
+		out = append(out, *rec)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Started != out[j].Started {
+			return out[i].Started < out[j].Started
+		}
+		return out[i].PID < out[j].PID
+	})
+	return out, nil
+}
+
+// handleInstances serves GET /api/instances: the live-instance registry as a
+// JSON array, so a UI or script attached to one instance can find the others.
+func handleInstances(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	home, err := agentChatHome()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	instances, err := listInstances(home)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if instances == nil {
+		instances = []instanceRecord{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(instances)
+}
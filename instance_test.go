@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAcquireInstanceLockFreshThenHeld(t *testing.T) {
+	home := t.TempDir()
+	project := "/some/project"
+
+	lock, running, err := acquireInstanceLock(home, project)
+	if err != nil || running != nil || lock == nil {
+		t.Fatalf("first acquire: lock=%v running=%v err=%v", lock, running, err)
+	}
+	if err := lock.SetURL("http://localhost:1234"); err != nil {
+		t.Fatalf("SetURL: %v", err)
+	}
+
+	// Pretend the lock belongs to a different live process (our parent).
+	path := projectLockPath(home, project)
+	rec, _ := readInstanceRecord(path)
+	rec.PID = os.Getppid()
+	if err := writeInstanceRecord(path, *rec); err != nil {
+		t.Fatal(err)
+	}
+
+	lock2, running, err := acquireInstanceLock(home, project)
+	if err != nil || lock2 != nil {
+		t.Fatalf("second acquire should report holder, got lock=%v err=%v", lock2, err)
+	}
+	if running == nil || running.PID != os.Getppid() || running.URL != "http://localhost:1234" {
+		t.Fatalf("running = %+v", running)
+	}
+
+	// Our Release must not remove a lock that now names someone else.
+	lock.Release()
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("Release removed a lock owned by another pid: %v", err)
+	}
+}
+
+func TestAcquireInstanceLockTakesOverStale(t *testing.T) {
+	home := t.TempDir()
+	project := "/some/project"
+
+	// A pid that has certainly exited: a child we already waited on.
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("spawn: %v", err)
+	}
+	path := projectLockPath(home, project)
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := writeInstanceRecord(path, instanceRecord{PID: cmd.Process.Pid, Project: project, URL: "http://old"}); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, running, err := acquireInstanceLock(home, project)
+	if err != nil || running != nil || lock == nil {
+		t.Fatalf("stale takeover: lock=%v running=%v err=%v", lock, running, err)
+	}
+	rec, _ := readInstanceRecord(path)
+	if rec.PID != os.Getpid() || rec.URL != "" {
+		t.Errorf("lock not rewritten for this process: %+v", rec)
+	}
+	lock.Release()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Release left the lock behind: %v", err)
+	}
+}
+
+func TestProjectLockPathPerProject(t *testing.T) {
+	a := projectLockPath("/h", "/p/one")
+	b := projectLockPath("/h", "/p/two")
+	if a == b {
+		t.Fatalf("distinct projects share a lock: %s", a)
+	}
+	if projectLockPath("/h", "/p/one/") != a {
+		t.Errorf("trailing slash should not change the lock path")
+	}
+}
+
+func TestRegistryListsLiveAndPrunesDead(t *testing.T) {
+	home := t.TempDir()
+	self, err := registerInstance(home, instanceRecord{PID: os.Getpid(), Project: "/p/self", Started: 2})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if err := self.Update(func(r *instanceRecord) { r.URL = "http://localhost:9"; r.Port = 9; r.Title = "Auth fix" }); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if _, err := registerInstance(home, instanceRecord{PID: os.Getppid(), Project: "/p/parent", Started: 1}); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Run()
+	dead, _ := registerInstance(home, instanceRecord{PID: cmd.Process.Pid, Project: "/p/dead", Started: 3})
+
+	got, err := listInstances(home)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(got) != 2 || got[0].Project != "/p/parent" || got[1].Project != "/p/self" {
+		t.Fatalf("want parent then self, got %+v", got)
+	}
+	if got[1].Title != "Auth fix" || got[1].Port != 9 {
+		t.Errorf("update not persisted: %+v", got[1])
+	}
+	if _, err := os.Stat(dead.path); !os.IsNotExist(err) {
+		t.Errorf("dead instance record not pruned")
+	}
+
+	self.Remove()
+	got, _ = listInstances(home)
+	if len(got) != 1 {
+		t.Errorf("after Remove want 1 instance, got %d", len(got))
+	}
+}
+
+func TestHandleInstancesAndListCommand(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("AGENT_CHAT_HOME", home)
+	registerInstance(home, instanceRecord{PID: os.Getpid(), Project: "/p/self", URL: "http://localhost:7", Title: "Demo"})
+
+	rec := httptest.NewRecorder()
+	handleInstances(rec, httptest.NewRequest(http.MethodGet, "/api/instances", nil))
+	var got []instanceRecord
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || len(got) != 1 || got[0].URL != "http://localhost:7" {
+		t.Fatalf("GET /api/instances = %s (%v)", rec.Body.String(), err)
+	}
+
+	var out bytes.Buffer
+	if code := runList(nil, &out); code != 0 {
+		t.Fatalf("runList exit %d", code)
+	}
+	if !strings.Contains(out.String(), "http://localhost:7") || !strings.Contains(out.String(), "Demo") {
+		t.Errorf("list output missing instance:\n%s", out.String())
+	}
+}
@@ -0,0 +1,25 @@
+//go:build windows
+
+package main
+
+import "syscall"
+
+// processAlive reports whether pid names a running process. On Windows,
+// opening a handle fails for a pid that no longer exists; an open handle whose
+// exit code is still STILL_ACTIVE (259) is running.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	const processQueryLimitedInformation = 0x1000
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(h)
+	var code uint32
+	if err := syscall.GetExitCodeProcess(h, &code); err != nil {
+		return false
+	}
+	return code == 259
+}
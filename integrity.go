@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+)
+
+// With -hash-chain every line the server appends to the event log ends in
+// "prev_hash" (the previous line's hash) and "hash": the SHA-256 of the
+// previous hash, a newline and the line's event JSON. Editing, inserting or
+// deleting a line breaks the chain from there on, which `agent-chat verify`
+// reports; it also prints the chain's head, and given the head recorded
+// earlier (-head) it catches lines cut off the end too. `agent-chat
+// compact` drops lines, so it breaks the chain where it does.
+
+// hashChainSuffix matches the fields chainLine appends to a line.
+var hashChainSuffix = regexp.MustCompile(`,"prev_hash":"([0-9a-f]*)","hash":"([0-9a-f]{64})"}$`)
+
+// chainHash is the hash of event JSON data following prev.
+func chainHash(prev string, data []byte) string {
+	h := sha256.New()
+	h.Write([]byte(prev + "\n"))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// chainLine seals data (one event's JSON object) into a chained log line
+// following prev, and returns the line (without its newline) and its hash.
+func chainLine(prev string, data []byte) ([]byte, string) {
+	hash := chainHash(prev, data)
+	line := make([]byte, 0, len(data)+100)
+	line = append(line, data[:len(data)-1]...)
+	line = append(line, `,"prev_hash":"`+prev+`","hash":"`+hash+`"}`...)
+	return line, hash
+}
+
+// unchainLine splits a chained line into its event JSON, previous hash and
+// hash; ok is false for a line without them.
+func unchainLine(line []byte) (data []byte, prev, hash string, ok bool) {
+	m := hashChainSuffix.FindSubmatchIndex(line)
+	if m == nil {
+		return nil, "", "", false
+	}
+	data = append(append([]byte{}, line[:m[0]]...), '}')
+	return data, string(line[m[2]:m[3]]), string(line[m[4]:m[5]]), true
+}
+
+// lastChainHash is the hash of the log's last chained line, which the next
+// line written continues from; "" for a missing log or one whose last line
+// is not chained.
+func lastChainHash(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	data = bytes.TrimRight(data, "\n")
+	if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+		data = data[i+1:]
+	}
+	_, _, hash, _ := unchainLine(data)
+	return hash, nil
+}
+
+// chainReport is what verifyEventLog found.
+type chainReport struct {
+	Lines     int    // non-blank lines read
+	Unchained int    // lines before the chain starts (written without -hash-chain)
+	Head      string // hash of the last chained line
+	BrokenAt  int    // 1-based line number where the chain breaks; 0 if intact
+	Reason    string
+}
+
+// verifyEventLog checks the hash chain of the event log read from r.
+func verifyEventLog(r io.Reader) (chainReport, error) {
+	var rep chainReport
+	br := bufio.NewReader(r)
+	started := false
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			if err == io.EOF {
+				return rep, nil
+			}
+			return rep, err
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		rep.Lines++
+		data, prev, hash, ok := unchainLine(line)
+		switch {
+		case !ok && !started:
+			rep.Unchained++
+			continue
+		case !ok:
+			rep.BrokenAt, rep.Reason = n, "line is not chained"
+		case prev != rep.Head:
+			rep.BrokenAt, rep.Reason = n, "prev_hash does not match the line before it (a line was removed, added or reordered)"
+			if !started {
+				rep.Reason = "the chain's first line follows a line that is missing"
+			}
+		case chainHash(prev, data) != hash:
+			rep.BrokenAt, rep.Reason = n, "hash does not match the line's content (the line was edited)"
+		}
+		if rep.BrokenAt != 0 {
+			return rep, nil
+		}
+		started = true
+		rep.Head = hash
+	}
+}
+
+// runVerify implements `agent-chat verify`.
+func runVerify(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	head := fs.String("head", "", "chain head recorded earlier (from a previous verify); fail unless the log still ends with it or continues from it")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: agent-chat verify [-head HASH] <events.jsonl>\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	path := fs.Arg(0)
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "agent-chat verify: %v\n", err)
+		return 1
+	}
+	defer f.Close()
+	rep, err := verifyEventLog(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "agent-chat verify: %s: %v\n", path, err)
+		return 1
+	}
+	switch {
+	case rep.BrokenAt != 0:
+		fmt.Fprintf(out, "%s: chain broken at line %d: %s\n", path, rep.BrokenAt, rep.Reason)
+		return 1
+	case rep.Head == "":
+		fmt.Fprintf(out, "%s: no hash chain (written without -hash-chain)\n", path)
+		return 1
+	}
+	if *head != "" && *head != rep.Head {
+		if ok, _ := chainContains(path, *head); !ok {
+			fmt.Fprintf(out, "%s: chain head %s is not in the log (lines were removed from its end)\n", path, *head)
+			return 1
+		}
+	}
+	fmt.Fprintf(out, "%s: ok, %d chained lines", path, rep.Lines-rep.Unchained)
+	if rep.Unchained > 0 {
+		fmt.Fprintf(out, " after %d unchained ones", rep.Unchained)
+	}
+	fmt.Fprintf(out, "\nhead %s\n", rep.Head)
+	return 0
+}
+
+// chainContains reports whether some line of the log at path has hash.
+func chainContains(path, hash string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Contains(data, []byte(`,"hash":"`+hash+`"}`)), nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// chainedLog writes a few events through a hash-chained bus, restarting it
+// half way, and returns the log's path.
+func chainedLog(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	os.WriteFile(path, []byte(`{"type":"userMessage","seq":1,"text":"before the chain"}`+"\n"), 0o644)
+	for i, texts := range [][]string{{"one", "two"}, {"three"}} {
+		bus, err := NewEventBusWithLog(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bus.EnableHashChain(path); err != nil {
+			t.Fatal(err)
+		}
+		for _, text := range texts {
+			bus.Publish(Event{Type: "agentMessage", Text: text})
+		}
+		bus.Close()
+		if i == 0 {
+			if head, _ := lastChainHash(path); head == "" {
+				t.Fatal("no chain head after the first run")
+			}
+		}
+	}
+	return path
+}
+
+func TestVerifyEventLog(t *testing.T) {
+	path := chainedLog(t)
+	data, _ := os.ReadFile(path)
+	rep, err := verifyEventLog(bytes.NewReader(data))
+	if err != nil || rep.BrokenAt != 0 || rep.Lines != 4 || rep.Unchained != 1 || len(rep.Head) != 64 {
+		t.Fatalf("intact log: %+v, %v", rep, err)
+	}
+	if events, _, _ := loadEventLog(path); len(events) != 4 || events[3].Text != "three" {
+		t.Errorf("chained log does not load: %+v", events)
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	tamper := map[string]string{
+		"edited":  strings.Replace(string(data), `"text":"two"`, `"text":"TWO"`, 1),
+		"removed": lines[0] + lines[1] + lines[3],
+		"swapped": lines[0] + lines[2] + lines[1] + lines[3],
+		"first":   lines[0] + lines[2] + lines[3],
+		"spliced": lines[0] + lines[1] + `{"type":"agentMessage","seq":9,"text":"inserted"}` + "\n" + lines[2] + lines[3],
+	}
+	for name, log := range tamper {
+		rep, _ := verifyEventLog(strings.NewReader(log))
+		if rep.BrokenAt == 0 {
+			t.Errorf("%s: chain reported intact", name)
+		}
+	}
+	if rep, _ := verifyEventLog(strings.NewReader(lines[0] + lines[1])); rep.BrokenAt != 0 {
+		t.Errorf("truncated log reported broken without -head: %+v", rep)
+	}
+}
+
+func TestRunVerify(t *testing.T) {
+	path := chainedLog(t)
+	var out bytes.Buffer
+	if code := runVerify([]string{path}, &out); code != 0 || !strings.Contains(out.String(), "ok, 3 chained lines after 1 unchained ones") {
+		t.Fatalf("exit %d: %s", code, out.String())
+	}
+	head := strings.TrimSpace(out.String()[strings.LastIndex(out.String(), "head ")+5:])
+
+	data, _ := os.ReadFile(path)
+	lines := strings.SplitAfter(string(data), "\n")
+	os.WriteFile(path, []byte(strings.Join(lines[:3], "")), 0o644)
+	out.Reset()
+	if code := runVerify([]string{"-head", head, path}, &out); code != 1 || !strings.Contains(out.String(), "removed from its end") {
+		t.Errorf("truncated log with -head: exit %d: %s", code, out.String())
+	}
+
+	plain := filepath.Join(t.TempDir(), "plain.jsonl")
+	os.WriteFile(plain, []byte(`{"type":"userMessage","seq":1}`+"\n"), 0o644)
+	out.Reset()
+	if code := runVerify([]string{plain}, &out); code != 1 || !strings.Contains(out.String(), "no hash chain") {
+		t.Errorf("unchained log: exit %d: %s", code, out.String())
+	}
+}
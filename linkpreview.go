@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	linkPreviewTimeout  = 5 * time.Second
+	linkPreviewMaxBody  = 512 << 10 // the <head> is all we read
+	linkPreviewMaxLinks = 3         // per message
+	linkPreviewMaxText  = 300       // runes, per title/description
+
+	// trailingPunct is sentence punctuation that ends a link in prose.
+	trailingPunct = ".,;:!?"
+)
+
+// linkPreviewer fetches previews for links in agent and user messages and
+// publishes them as "linkPreview" events (ReplyTo: the message's seq). Only
+// hosts on the operator's allowlist are fetched: the server sits on a
+// developer machine, and an arbitrary URL pasted into chat must not become a
+// request into the local network.
+type linkPreviewer struct {
+	hosts  []string // "github.com" matches exactly; "*.github.io" any subdomain
+	client *http.Client
+}
+
+// newLinkPreviewer parses the -link-previews allowlist (comma-separated
+// hosts). Returns nil, meaning previews are off, when the list is empty.
+func newLinkPreviewer(allowlist string) *linkPreviewer {
+	var hosts []string
+	for _, h := range strings.Split(allowlist, ",") {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	if len(hosts) == 0 {
+		return nil
+	}
+	p := &linkPreviewer{hosts: hosts}
+	p.client = &http.Client{
+		Timeout: linkPreviewTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return fmt.Errorf("too many redirects")
+			}
+			if !p.allowed(req.URL) {
+				return fmt.Errorf("redirect to %s is not allowlisted", req.URL.Host)
+			}
+			return nil
+		},
+	}
+	return p
+}
+
+// allowed reports whether u is an http(s) URL on an allowlisted host.
+func (p *linkPreviewer) allowed(u *url.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, h := range p.hosts {
+		if suffix, ok := strings.CutPrefix(h, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == h {
+			return true
+		}
+	}
+	return false
+}
+
+// start enriches messages as they are published, from a goroutine, until
+// ctx is cancelled. It subscribes before returning, so no message published
+// afterwards is missed. Each message is fetched in its own goroutine so a
+// slow site never delays the next one. Events replayed from the log were
+// enriched when first published.
+func (p *linkPreviewer) start(ctx context.Context, eb *EventBus) {
+	ch := eb.Observe()
+	go func() {
+		defer eb.Unsubscribe(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e := <-ch:
+				switch eventKind(e) {
+				case "agentMessage", "verbalReply", "userMessage":
+				default:
+					continue
+				}
+				var urls []string
+				for _, raw := range messageURLs(e.Text) {
+					if u, err := url.Parse(raw); err == nil && p.allowed(u) {
+						urls = append(urls, raw)
+					}
+				}
+				if len(urls) > 0 {
+					go p.enrich(ctx, eb, e.Seq, urls)
+				}
+			}
+		}
+	}()
+}
+
+// enrich fetches urls and publishes whatever previews succeeded. Failures
+// are silent: the message still shows the plain link.
+func (p *linkPreviewer) enrich(ctx context.Context, eb *EventBus, seq int64, urls []string) {
+	var previews []LinkPreview
+	for _, u := range urls {
+		if lp, err := p.fetch(ctx, u); err == nil {
+			previews = append(previews, lp)
+		}
+	}
+	if len(previews) > 0 {
+		eb.Publish(Event{Type: "linkPreview", ReplyTo: seq, Links: previews})
+	}
+}
+
+// fetch GETs an HTML page and extracts its preview. Pages with neither a
+// title nor a description are not worth a card.
+func (p *linkPreviewer) fetch(ctx context.Context, raw string) (LinkPreview, error) {
+	ctx, cancel := context.WithTimeout(ctx, linkPreviewTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, raw, nil)
+	if err != nil {
+		return LinkPreview{}, err
+	}
+	req.Header.Set("User-Agent", "agent-chat/"+version+" (link preview)")
+	req.Header.Set("Accept", "text/html")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return LinkPreview{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return LinkPreview{}, fmt.Errorf("%s: %s", raw, resp.Status)
+	}
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt != "text/html" {
+		return LinkPreview{}, fmt.Errorf("%s: not HTML (%s)", raw, mt)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, linkPreviewMaxBody))
+	if err != nil {
+		return LinkPreview{}, err
+	}
+	lp := parseLinkPreview(string(body), resp.Request.URL)
+	lp.URL = raw
+	if lp.Title == "" && lp.Description == "" {
+		return LinkPreview{}, fmt.Errorf("%s: no title or description", raw)
+	}
+	return lp, nil
+}
+
+var (
+	messageURLRe = regexp.MustCompile(`https?://[^\s<>"'()\[\]]+`)
+	htmlTitleRe  = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	htmlMetaRe   = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	htmlAttrRe   = regexp.MustCompile(`(?is)([a-z][a-z:-]*)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+)
+
+// messageURLs returns the distinct http(s) URLs in text, in order, at most
+// linkPreviewMaxLinks. Sentence punctuation after a link is not part of it.
+func messageURLs(text string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, m := range messageURLRe.FindAllString(text, -1) {
+		m = strings.TrimRight(m, trailingPunct)
+		if seen[m] {
+			continue
+		}
+		seen[m] = true
+		out = append(out, m)
+		if len(out) == linkPreviewMaxLinks {
+			break
+		}
+	}
+	return out
+}
+
+// parseLinkPreview reads Open Graph tags (falling back to <title> and the
+// description meta tag) from an HTML page fetched from base.
+func parseLinkPreview(page string, base *url.URL) LinkPreview {
+	meta := map[string]string{}
+	for _, tag := range htmlMetaRe.FindAllString(page, -1) {
+		attrs := map[string]string{}
+		for _, a := range htmlAttrRe.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(a[1])] = a[2] + a[3]
+		}
+		key := attrs["property"]
+		if key == "" {
+			key = attrs["name"]
+		}
+		key = strings.ToLower(key)
+		if _, dup := meta[key]; key != "" && !dup {
+			meta[key] = previewText(attrs["content"])
+		}
+	}
+	lp := LinkPreview{Title: meta["og:title"], Description: meta["og:description"]}
+	if lp.Title == "" {
+		if m := htmlTitleRe.FindStringSubmatch(page); m != nil {
+			lp.Title = previewText(m[1])
+		}
+	}
+	if lp.Description == "" {
+		lp.Description = meta["description"]
+	}
+	if img, err := base.Parse(meta["og:image"]); meta["og:image"] != "" && err == nil && (img.Scheme == "http" || img.Scheme == "https") {
+		lp.Image = img.String()
+	}
+	return lp
+}
+
+// previewText unescapes and tidies an attribute or title for display.
+func previewText(s string) string {
+	s = strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+	if r := []rune(s); len(r) > linkPreviewMaxText {
+		s = string(r[:linkPreviewMaxText]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMessageURLs(t *testing.T) {
+	got := messageURLs("See https://github.com/a/b/pull/1, and (https://pkg.go.dev/net/url). Again: https://github.com/a/b/pull/1")
+	want := []string{"https://github.com/a/b/pull/1", "https://pkg.go.dev/net/url"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestLinkPreviewAllowlist(t *testing.T) {
+	if newLinkPreviewer(" , ") != nil {
+		t.Error("empty allowlist enabled previews")
+	}
+	p := newLinkPreviewer("github.com, *.github.io")
+	for raw, want := range map[string]bool{
+		"https://github.com/x":        true,
+		"http://GitHub.com:8080/x":    true,
+		"https://api.github.com/x":    false,
+		"https://choonkeat.github.io": true,
+		"https://github.io/x":         false,
+		"ftp://github.com/x":          false,
+		"https://evilgithub.com/x":    false,
+	} {
+		u, _ := url.Parse(raw)
+		if got := p.allowed(u); got != want {
+			t.Errorf("allowed(%s) = %v, want %v", raw, got, want)
+		}
+	}
+}
+
+func TestParseLinkPreview(t *testing.T) {
+	base, _ := url.Parse("https://example.com/docs/page")
+	page := `<html><head><title>Fallback</title>
+<meta content="Fix the &amp; bug" property="og:title">
+<meta name='description' content='Plain description'>
+<meta property="og:image" content="/img/card.png">
+</head><body><meta property="og:title" content="ignored"></body></html>`
+	got := parseLinkPreview(page, base)
+	want := LinkPreview{Title: "Fix the & bug", Description: "Plain description", Image: "https://example.com/img/card.png"}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	got = parseLinkPreview(`<title> Just
+ a title </title><meta property="og:image" content="javascript:alert(1)">`, base)
+	if got.Title != "Just a title" || got.Image != "" {
+		t.Errorf("fallback = %+v", got)
+	}
+}
+
+func TestLinkPreviewerPublishesEnrichment(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<title>PR #42: add pins</title><meta name="description" content="Merged.">`))
+	}))
+	defer srv.Close()
+	host, _ := url.Parse(srv.URL)
+
+	eb := NewEventBus()
+	p := newLinkPreviewer(host.Hostname())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := eb.Observe()
+	defer eb.Unsubscribe(ch)
+	p.start(ctx, eb)
+
+	eb.Publish(Event{Type: "agentMessage", Text: "Opened " + srv.URL + "/pull/42 and https://elsewhere.invalid/x"})
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-ch:
+			if e.Type != "linkPreview" {
+				continue
+			}
+			want := []LinkPreview{{URL: srv.URL + "/pull/42", Title: "PR #42: add pins", Description: "Merged."}}
+			if e.ReplyTo != 1 || !reflect.DeepEqual(e.Links, want) {
+				t.Errorf("linkPreview = %+v", e)
+			}
+			return
+		case <-timeout:
+			t.Fatal("no linkPreview event")
+		}
+	}
+}
+
+func TestLinkPreviewSkipsNonHTML(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"title":"<title>x</title>"}`))
+	}))
+	defer srv.Close()
+	host, _ := url.Parse(srv.URL)
+	if _, err := newLinkPreviewer(host.Hostname()).fetch(context.Background(), srv.URL); err == nil {
+		t.Error("previewed a JSON response")
+	}
+}
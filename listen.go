@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// listenAddr is the -listen serve flag: "unix:/path.sock" serves HTTP (UI,
+// WebSocket and /mcp) on a Unix domain socket, for reverse proxies and
+// local-only setups that want no TCP port at all; "host:port" picks the TCP
+// address. Empty keeps the default: every interface, on $AGENT_CHAT_PORT,
+// $PORT or a random port.
+var listenAddr string
+
+// unixURLPrefix marks an instance URL served on a Unix socket:
+// http+unix://<path-escaped socket path>, the same spelling
+// requests-unixsocket and friends use. Registry records, `list` and tool
+// results carry it as is; httpClientFor knows how to dial it.
+const unixURLPrefix = "http+unix://"
+
+// listenHTTP opens the HTTP listener for -listen and returns it with the
+// base URL clients should use. A socket handed over by systemd socket
+// activation takes precedence over spec.
+func listenHTTP(spec string) (net.Listener, string, error) {
+	if ln, err := activationListener(); err != nil || ln != nil {
+		if err != nil {
+			return nil, "", fmt.Errorf("socket activation: %w", err)
+		}
+		return ln, listenerURL(ln), nil
+	}
+	if path, ok := strings.CutPrefix(spec, "unix:"); ok {
+		return listenUnix(path)
+	}
+	addr := spec
+	if addr == "" {
+		addr = defaultListenAddr()
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, "", fmt.Errorf("listen error: %w", err)
+	}
+	return ln, listenerURL(ln), nil
+}
+
+// defaultListenAddr is the TCP address without -listen: every interface,
+// on $AGENT_CHAT_PORT, $PORT or (port 0) a random port.
+func defaultListenAddr() string {
+	port := 0
+	if s := os.Getenv("AGENT_CHAT_PORT"); s != "" {
+		port, _ = strconv.Atoi(s)
+	} else if s := os.Getenv("PORT"); s != "" {
+		port, _ = strconv.Atoi(s)
+	}
+	if port > 0 {
+		return fmt.Sprintf("0.0.0.0:%d", port)
+	}
+	return "0.0.0.0:0"
+}
+
+// listenerURL is the base URL for a listener: localhost and its port for
+// TCP, http+unix:// for a Unix socket.
+func listenerURL(ln net.Listener) string {
+	if addr, ok := ln.Addr().(*net.UnixAddr); ok {
+		return unixURLPrefix + url.PathEscape(addr.Name)
+	}
+	if addr, ok := ln.Addr().(*net.TCPAddr); ok {
+		return fmt.Sprintf("http://localhost:%d", addr.Port)
+	}
+	return "http://" + ln.Addr().String()
+}
+
+// activationListener returns the listening socket systemd passed this
+// process (sd_listen_fds: LISTEN_PID names us, LISTEN_FDS counts the
+// sockets from fd 3 up), or nil when not socket-activated. The variables are
+// cleared so child processes do not mistake the socket for theirs; a
+// crash-restarted HTTP server then falls back to -listen.
+func activationListener() (net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if n < 1 {
+		return nil, nil
+	}
+	if n > 1 {
+		return nil, fmt.Errorf("got %d sockets, want one", n)
+	}
+	f := os.NewFile(3, "systemd-socket")
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// listenUnix listens on a Unix socket at path, replacing a stale socket
+// left by a crashed instance but never a live one or a regular file. The
+// socket is owner-only: whoever can connect can drive the chat.
+func listenUnix(path string) (net.Listener, string, error) {
+	if path == "" {
+		return nil, "", errors.New("-listen unix: needs a socket path")
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, "", err
+	}
+	if fi, err := os.Lstat(abs); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, "", fmt.Errorf("listen error: %s exists and is not a socket", abs)
+		}
+		if c, err := net.Dial("unix", abs); err == nil {
+			c.Close()
+			return nil, "", fmt.Errorf("listen error: %s is in use by another server", abs)
+		}
+		os.Remove(abs)
+	}
+	ln, err := net.Listen("unix", abs)
+	if err != nil {
+		return nil, "", fmt.Errorf("listen error: %w", err)
+	}
+	if err := os.Chmod(abs, 0600); err != nil {
+		ln.Close()
+		return nil, "", fmt.Errorf("listen error: %w", err)
+	}
+	return ln, listenerURL(ln), nil
+}
+
+// httpClientFor returns the client and plain http:// URL for reaching
+// target, an instance URL (or one under it, like .../mcp). Ordinary URLs
+// pass through with the default client; http+unix:// ones get a client
+// that dials the socket.
+func httpClientFor(target string) (*http.Client, string) {
+	rest, ok := strings.CutPrefix(target, unixURLPrefix)
+	if !ok {
+		return http.DefaultClient, target
+	}
+	escaped, path, _ := strings.Cut(rest, "/")
+	socket, err := url.PathUnescape(escaped)
+	if err != nil {
+		socket = escaped
+	}
+	if path != "" {
+		path = "/" + path
+	}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}
+	return &http.Client{Transport: transport}, "http://localhost" + path
+}
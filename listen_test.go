@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestListenUnix(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "chat.sock")
+	ln, base, err := listenHTTP("unix:" + sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if want := unixURLPrefix + strings.ReplaceAll(sock, "/", "%2F"); base != want {
+		t.Errorf("url = %q, want %q", base, want)
+	}
+	if fi, err := os.Stat(sock); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("socket mode = %v, %v; want 0600", fi.Mode(), err)
+	}
+	go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.Path)
+		if isLocalRequest(r) {
+			io.WriteString(w, " local")
+		}
+	}))
+
+	client, endpoint := httpClientFor(base + "/mcp")
+	if endpoint != "http://localhost/mcp" {
+		t.Errorf("endpoint = %q", endpoint)
+	}
+	resp, err := client.Get(endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "/mcp local" {
+		t.Errorf("response = %q, want the path, seen as a local request", body)
+	}
+
+	// A live socket is not stolen by a second server.
+	if _, _, err := listenHTTP("unix:" + sock); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("second listen on a live socket: %v", err)
+	}
+}
+
+func TestListenUnixStaleSocket(t *testing.T) {
+	dir := t.TempDir()
+	sock := filepath.Join(dir, "chat.sock")
+	// A socket file with nobody listening, as a crash leaves behind.
+	stale, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	ln, _, err := listenHTTP("unix:" + sock)
+	if err != nil {
+		t.Fatalf("stale socket not replaced: %v", err)
+	}
+	ln.Close()
+
+	file := filepath.Join(dir, "notes.txt")
+	os.WriteFile(file, []byte("keep me"), 0644)
+	if _, _, err := listenHTTP("unix:" + file); err == nil {
+		t.Error("listened over a regular file")
+	}
+	if data, _ := os.ReadFile(file); string(data) != "keep me" {
+		t.Error("regular file was clobbered")
+	}
+}
+
+func TestHTTPClientForPlainURL(t *testing.T) {
+	client, endpoint := httpClientFor("http://localhost:4321/api/message")
+	if client != http.DefaultClient || endpoint != "http://localhost:4321/api/message" {
+		t.Errorf("httpClientFor(plain) = %v, %q", client, endpoint)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// stallAfter is the -stall-after serve flag: how long an agent may go
+// without a tool call, none in flight, before it is reported stalled.
+var stallAfter = 5 * time.Minute
+
+// LivenessEvent is the transient heartbeat about one agent session: when it
+// last touched agent-chat, and whether it has been quiet past the stall
+// threshold. A dead agent otherwise looks just like a thinking one. Like
+// presence it is live state, so it is never written to the event log.
+type LivenessEvent struct {
+	Type       string `json:"type"`              // "agentAlive" or "agentStalled"
+	Session    string `json:"session,omitempty"` // agent session key; "" for the primary
+	LastActive int64  `json:"last_active"`       // Unix milliseconds of its last tool call start or finish
+	Idle       int64  `json:"idle_ms"`           // milliseconds since then, by the server's clock
+	Busy       bool   `json:"busy,omitempty"`    // a tool call is in flight, e.g. waiting for the user's reply
+}
+
+// trackToolCalls is MCP server middleware that records every tool call
+// against its agent session, for the liveness heartbeat.
+func trackToolCalls(eb *EventBus) mcp.Middleware {
+	return func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			if call, ok := req.(*mcp.CallToolRequest); ok {
+				end := eb.ClientSession(mcpClientKey(call)).BeginToolCall()
+				defer end()
+			}
+			return next(ctx, method, req)
+		}
+	}
+}
+
+// BeginToolCall marks a tool call in flight for this session and returns
+// the func that marks it finished. A session that had been reported
+// stalled or disconnected is announced alive again straight away, not at
+// the next beat.
+func (eb *EventBus) BeginToolCall() (end func()) {
+	eb.mu.Lock()
+	s := eb.agentSession
+	s.worked = 0
+	if s.calls == 0 && !s.lastActive.IsZero() {
+		s.worked = time.Since(s.lastActive)
+	}
+	s.calls++
+	s.lastActive = time.Now()
+	recovered := s.stalled || s.disconnected
+	s.stalled, s.disconnected = false, false
+	ev := s.livenessLocked(time.Now(), 0)
+	eb.mu.Unlock()
+	if recovered {
+		eb.PublishTransient(ev)
+	}
+	return func() {
+		eb.mu.Lock()
+		s.calls--
+		s.lastActive = time.Now()
+		eb.mu.Unlock()
+	}
+}
+
+// livenessLocked reports s as stalled when no call is in flight and the
+// last one ended at least stallAfter ago (never, for stallAfter 0). Caller
+// holds eventHub.mu.
+func (s *agentSession) livenessLocked(now time.Time, stallAfter time.Duration) LivenessEvent {
+	idle := now.Sub(s.lastActive)
+	ev := LivenessEvent{Type: "agentAlive", Session: s.key, LastActive: s.lastActive.UnixMilli(), Idle: idle.Milliseconds(), Busy: s.calls > 0}
+	if stallAfter > 0 && s.calls == 0 && idle >= stallAfter {
+		ev.Type = "agentStalled"
+	}
+	return ev
+}
+
+// Liveness returns a heartbeat for every connected agent session that has
+// made a tool call, recording which are stalled so BeginToolCall can
+// announce their recovery.
+func (eb *EventBus) Liveness(stallAfter time.Duration) []LivenessEvent {
+	now := time.Now()
+	var out []LivenessEvent
+	for _, s := range eb.allSessions() {
+		eb.mu.Lock()
+		if !s.lastActive.IsZero() && !s.disconnected {
+			ev := s.livenessLocked(now, stallAfter)
+			s.stalled = ev.Type == "agentStalled"
+			out = append(out, ev)
+		}
+		eb.mu.Unlock()
+	}
+	return out
+}
+
+// Disconnect records that this session's MCP client has gone — stdio hit
+// EOF, or an HTTP client ended its session — so the user stops typing
+// replies into the void. It publishes agentDisconnected, which also drops
+// the session's pending quick replies, and cancels any wait still blocked on
+// a reply nobody can receive. The next tool call reconnects the session.
+// No-op while already disconnected.
+func (eb *EventBus) Disconnect() {
+	eb.mu.Lock()
+	if eb.disconnected {
+		eb.mu.Unlock()
+		return
+	}
+	eb.disconnected = true
+	eb.mu.Unlock()
+	eb.CancelActiveWait()
+	eb.Publish(Event{Type: "agentDisconnected"})
+}
+
+// endSessionOnDelete wraps the /mcp handler to Disconnect the agent when
+// an HTTP client ends its session (DELETE with its Mcp-Session-Id). A client
+// that just dies sends nothing; the stall warning covers that.
+func endSessionOnDelete(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			if s, ok := bus.KnownSession(r.Header.Get("Mcp-Session-Id")); ok {
+				s.Disconnect()
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// runHeartbeat broadcasts Liveness every interval until ctx is done.
+func runHeartbeat(ctx context.Context, eb *EventBus, interval, stallAfter time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			for _, ev := range eb.Liveness(stallAfter) {
+				eb.PublishTransient(ev)
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestLiveness(t *testing.T) {
+	eb := NewEventBus()
+	if got := eb.Liveness(time.Minute); len(got) != 0 {
+		t.Fatalf("before any call = %+v", got)
+	}
+	transient := make(chan any, 4)
+	eb.SubscribeTransient(transient)
+	defer eb.UnsubscribeTransient(transient)
+
+	end := eb.BeginToolCall()
+	if got := eb.Liveness(time.Nanosecond); len(got) != 1 || got[0].Type != "agentAlive" || !got[0].Busy {
+		t.Errorf("during a call = %+v (a call in flight is never a stall)", got)
+	}
+	end()
+	time.Sleep(2 * time.Millisecond)
+	if got := eb.Liveness(time.Millisecond); len(got) != 1 || got[0].Type != "agentStalled" || got[0].Busy || got[0].Idle < 1 {
+		t.Errorf("quiet past the threshold = %+v", got)
+	}
+	if got := eb.Liveness(0); got[0].Type != "agentAlive" {
+		t.Errorf("stallAfter 0 = %+v", got)
+	}
+	eb.Liveness(time.Millisecond)
+	if len(transient) != 0 {
+		t.Fatalf("Liveness broadcast on its own: %d", len(transient))
+	}
+
+	// The next call announces the recovery without waiting for a beat.
+	eb.BeginToolCall()()
+	select {
+	case ev := <-transient:
+		if ev, ok := ev.(LivenessEvent); !ok || ev.Type != "agentAlive" {
+			t.Errorf("recovery = %+v", ev)
+		}
+	default:
+		t.Error("recovery not announced")
+	}
+}
+
+func TestTrackToolCallsPerSession(t *testing.T) {
+	eb := NewEventBus()
+	server := mcp.NewServer(&mcp.Implementation{Name: "agent-chat", Version: "test"}, nil)
+	server.AddReceivingMiddleware(trackToolCalls(eb))
+	registerTools(server, eb)
+	if got, isErr := callServerTool(t, server, "get_status", nil); isErr {
+		t.Fatalf("get_status: %s", got)
+	}
+	got := eb.Liveness(time.Hour)
+	if len(got) != 1 || got[0].Type != "agentAlive" || got[0].Session != "" || got[0].LastActive == 0 {
+		t.Errorf("after a tool call = %+v", got)
+	}
+}
+
+func TestDisconnect(t *testing.T) {
+	eb := NewEventBus()
+	if _, ok := eb.KnownSession("stdio"); ok {
+		t.Fatal("KnownSession found a client that never called in")
+	}
+	if _, ok := eb.KnownSession("stdio"); ok || len(eb.allSessions()) != 1 {
+		t.Fatal("KnownSession created a session")
+	}
+	agent := eb.ClientSession("stdio")
+	agent.BeginToolCall()()
+	agent.Publish(Event{Type: "agentMessage", Text: "Deploy?", QuickReplies: []string{"Yes", "No"}})
+
+	gone, ok := eb.KnownSession("stdio")
+	if !ok {
+		t.Fatal("KnownSession lost the primary client")
+	}
+	gone.Disconnect()
+	gone.Disconnect()
+	history, _ := eb.History()
+	if n := len(history); n != 2 || history[1].Type != "agentDisconnected" {
+		t.Fatalf("history = %+v", history)
+	}
+	if qr := agent.LastQuickReplies(); qr != nil {
+		t.Errorf("quick replies survived the disconnect: %v", qr)
+	}
+	if qr := quickRepliesBySession(history); len(qr) != 0 {
+		t.Errorf("restored quick replies = %v", qr)
+	}
+	if got := eb.Liveness(time.Nanosecond); len(got) != 0 {
+		t.Errorf("heartbeat for a gone agent: %+v", got)
+	}
+	if st := eb.ChatStatus(time.Hour); st.Agents[0].Connected || st.Agents[0].LastActive == 0 {
+		t.Errorf("status = %+v", st.Agents)
+	}
+
+	agent.BeginToolCall()()
+	if st := eb.ChatStatus(time.Hour); !st.Agents[0].Connected {
+		t.Errorf("a new call did not reconnect: %+v", st.Agents)
+	}
+}
+
+func TestEndSessionOnDelete(t *testing.T) {
+	orig := bus
+	bus = NewEventBus()
+	t.Cleanup(func() { bus = orig })
+	bus.ClientSession("sess-1").BeginToolCall()()
+
+	var served int
+	h := endSessionOnDelete(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { served++ }))
+	for _, sid := range []string{"sess-1", "never-seen"} {
+		req := httptest.NewRequest(http.MethodDelete, "/mcp", nil)
+		req.Header.Set("Mcp-Session-Id", sid)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if served != 2 {
+		t.Errorf("handler ran %d times", served)
+	}
+	history, _ := bus.History()
+	if len(history) != 1 || history[0].Type != "agentDisconnected" || history[0].Session != "" {
+		t.Errorf("history = %+v", history)
+	}
+}
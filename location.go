@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// request_location asks the person chatting for their position, e.g. for
+// "find coffee near me" from a phone. The prompt, a "locationPrompt" event
+// with its LocationPrompt in Data, offers Share / Don't share; sharing asks
+// the browser's Geolocation API, which shows the browser's own consent
+// dialog and needs HTTPS or localhost. The first tab to answer settles it,
+// and a "locationAnswered" event says how in every tab — without the
+// coordinates, which only the agent is given.
+
+// LocationResult is a tab's answer to a location request.
+type LocationResult struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Accuracy  float64 `json:"accuracy_m,omitempty"` // radius in metres, as the browser reports it
+	Declined  bool    `json:"declined,omitempty"`   // the user said no, here or in the browser's dialog
+	Error     string  `json:"error,omitempty"`      // the browser could not get a position
+	From      string  `json:"-"`                    // display name of whoever answered
+}
+
+// status is the LocationPrompt.Status the result settles its prompt with.
+func (r LocationResult) status() string {
+	switch {
+	case r.Declined:
+		return "declined"
+	case r.Error != "":
+		return "failed"
+	default:
+		return "shared"
+	}
+}
+
+// text is the tool result for the agent.
+func (r LocationResult) text() string {
+	switch r.status() {
+	case "declined":
+		return "The user declined to share their location. Ask them where they are instead, if you still need it."
+	case "failed":
+		return "The browser could not get a location: " + r.Error
+	}
+	data, _ := json.Marshal(r)
+	return "User's location: " + string(data)
+}
+
+// createLocationRequest registers a pending location request and returns
+// its id and the channel its answer arrives on.
+func (eb *EventBus) createLocationRequest() (string, chan LocationResult) {
+	id := uuid.New().String()
+	ch := make(chan LocationResult, 1)
+	eb.locationMu.Lock()
+	if eb.pendingLocations == nil {
+		eb.pendingLocations = make(map[string]chan LocationResult)
+	}
+	eb.pendingLocations[id] = ch
+	eb.locationMu.Unlock()
+	return id, ch
+}
+
+// ResolveLocation delivers a tab's answer to location request id. It
+// reports false when the request was already answered or has gone.
+func (eb *EventBus) ResolveLocation(id string, res LocationResult) bool {
+	eb.locationMu.Lock()
+	ch, ok := eb.pendingLocations[id]
+	delete(eb.pendingLocations, id)
+	eb.locationMu.Unlock()
+	if ok {
+		ch <- res
+	}
+	return ok
+}
+
+// requestLocation publishes a location prompt giving reason and waits for
+// the first tab's answer. When ctx ends first the prompt is marked
+// cancelled and ctx's error returned.
+func (eb *EventBus) requestLocation(ctx context.Context, reason string, highAccuracy bool, meta *ToolMeta) (LocationResult, error) {
+	id, ch := eb.createLocationRequest()
+	text := "📍 **Location request**"
+	if reason = strings.TrimSpace(reason); reason != "" {
+		text += "\n\n" + reason
+	}
+	e := mustEvent("locationPrompt", LocationPrompt{RequestID: id, Reason: reason, HighAccuracy: highAccuracy})
+	e.Text, e.AgentToolName, e.Meta = text, "request_location", meta
+	seq := eb.Publish(e)
+
+	var res LocationResult
+	select {
+	case res = <-ch:
+	case <-ctx.Done():
+		if eb.ResolveLocation(id, LocationResult{}) {
+			eb.publishLocationAnswered(seq, id, "cancelled", "")
+			return LocationResult{}, ctx.Err()
+		}
+		res = <-ch // answered just as the call ended
+	}
+	eb.publishLocationAnswered(seq, id, res.status(), res.From)
+	return res, nil
+}
+
+// publishLocationAnswered settles location request id, prompted at seq,
+// with status, answered by from.
+func (eb *EventBus) publishLocationAnswered(seq int64, id, status, from string) {
+	e := mustEvent("locationAnswered", LocationPrompt{RequestID: id, Status: status})
+	e.ReplyTo, e.From = seq, from
+	eb.Publish(e)
+}
+
+// validate rejects a shared position that is not on Earth.
+func (r LocationResult) validate() error {
+	if r.status() != "shared" {
+		return nil
+	}
+	if r.Latitude < -90 || r.Latitude > 90 || r.Longitude < -180 || r.Longitude > 180 {
+		return fmt.Errorf("location %v,%v out of range", r.Latitude, r.Longitude)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/choonkeat/agent-chat/pkg/client"
+	"github.com/choonkeat/agent-chat/pkg/wire"
+)
+
+func TestRequestLocationOverWebSocket(t *testing.T) {
+	base := startWSServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var tabs [2]*client.Client
+	for i, name := range []string{"Ana", "Bo"} {
+		c, err := client.Dial(ctx, base, client.Options{ClientID: name, Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		waitType(t, ctx, c, "historyEnd")
+		tabs[i] = c
+	}
+
+	type answer struct {
+		res LocationResult
+		err error
+	}
+	done := make(chan answer, 1)
+	go func() {
+		res, err := bus.requestLocation(ctx, "To find coffee nearby", true, nil)
+		done <- answer{res, err}
+	}()
+
+	prompt := waitType(t, ctx, tabs[0], "locationPrompt")
+	loc, err := wire.DecodeData[LocationPrompt](prompt.Event)
+	if err != nil || loc.Reason != "To find coffee nearby" || !loc.HighAccuracy || !strings.Contains(prompt.Text, "coffee") {
+		t.Fatalf("prompt = %+v, %v", prompt.Event, err)
+	}
+	id := loc.RequestID
+	if err := tabs[0].ShareLocation(id, 1.3521, 103.8198, 25); err != nil {
+		t.Fatal(err)
+	}
+	got := <-done
+	if got.err != nil || got.res.Latitude != 1.3521 || got.res.Longitude != 103.8198 || got.res.Accuracy != 25 {
+		t.Fatalf("result = %+v, %v", got.res, got.err)
+	}
+	if text := got.res.text(); !strings.Contains(text, `"latitude":1.3521`) || !strings.Contains(text, `"accuracy_m":25`) {
+		t.Errorf("tool result = %q", text)
+	}
+
+	// Every tab hears how it went, but not where the user is.
+	f := waitType(t, ctx, tabs[1], "locationAnswered")
+	if loc, err := wire.DecodeData[LocationPrompt](f.Event); err != nil || f.ReplyTo != prompt.Seq || loc.Status != "shared" || f.From != "Ana" {
+		t.Errorf("locationAnswered = %+v, %v", f.Event, err)
+	}
+	events, _ := bus.History()
+	data, _ := json.Marshal(events)
+	if strings.Contains(string(data), "103.8") {
+		t.Errorf("coordinates logged: %s", data)
+	}
+
+	// A second answer finds the request gone.
+	if err := tabs[1].DeclineLocation(id); err != nil {
+		t.Fatal(err)
+	}
+	waitType(t, ctx, tabs[1], "locationClosed")
+}
+
+func TestRequestLocationDeclinedOrCancelled(t *testing.T) {
+	eb := NewEventBus()
+	go func() {
+		for !eb.ResolveLocation(pendingLocation(eb), LocationResult{Declined: true}) {
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	res, err := eb.requestLocation(context.Background(), "", false, nil)
+	if err != nil || res.status() != "declined" || !strings.Contains(res.text(), "declined") {
+		t.Errorf("declined: %+v, %v", res, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := eb.requestLocation(ctx, "", false, nil); err == nil {
+		t.Error("want an error once the call is cancelled")
+	}
+	events, _ := eb.History()
+	last := events[len(events)-1]
+	if loc, err := wire.DecodeData[LocationPrompt](last); err != nil || last.Type != "locationAnswered" || loc.Status != "cancelled" {
+		t.Errorf("last event = %+v, %v", last, err)
+	}
+	if id := pendingLocation(eb); id != "" {
+		t.Errorf("request %s left pending", id)
+	}
+}
+
+func TestLocationResultValidate(t *testing.T) {
+	if err := (LocationResult{Latitude: 91}).validate(); err == nil {
+		t.Error("latitude 91 accepted")
+	}
+	if err := (LocationResult{Error: "timeout"}).validate(); err != nil {
+		t.Errorf("failure rejected: %v", err)
+	}
+	if got := (LocationResult{Error: "timeout"}).text(); !strings.Contains(got, "could not get a location: timeout") {
+		t.Errorf("text = %q", got)
+	}
+}
+
+// pendingLocation returns the id of a pending location request, or "".
+func pendingLocation(eb *EventBus) string {
+	eb.locationMu.Lock()
+	defer eb.locationMu.Unlock()
+	for id := range eb.pendingLocations {
+		return id
+	}
+	return ""
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"html"
 	"io"
 	"io/fs"
 	"log"
@@ -14,10 +15,8 @@ import (
 	"net"
 	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
 	"path/filepath"
-	"runtime"
 	"strconv"
 	"sort"
 	"strings"
@@ -132,6 +131,14 @@ const (
 // uiURL is set once the HTTP server starts, used in tool results.
 var uiURL string
 
+// historyPage is the -history-page serve flag: how many events a freshly
+// connected browser tab is sent before it pages for older ones.
+var historyPage = 300
+
+// noBrowser is the -no-browser serve flag: never open a browser tab, as for
+// a daemon started by install-service.
+var noBrowser bool
+
 // browserOpened tracks whether we've already opened a browser this session.
 var browserOpened bool
 
@@ -140,6 +147,14 @@ var httpMu sync.Mutex
 var httpRunning bool
 var httpListener net.Listener
 
+// singleInstanceLock is this process's per-project lock when -single-instance
+// is on (nil otherwise); ensureHTTPServer publishes the UI URL through it.
+var singleInstanceLock *instanceLock
+
+// instanceRegistry is this process's entry in the live-instance registry
+// (nil if the registry could not be written).
+var instanceRegistry *registryEntry
+
 // mcpServerRef holds a reference to the MCP server for lazy HTTP startup.
 var mcpServerRef *mcp.Server
 
@@ -166,8 +181,23 @@ func ensureHTTPServer() error {
 	uiURL = url
 	httpListener = ln
 	httpRunning = true
+	if err := singleInstanceLock.SetURL(uiURL); err != nil {
+		log.Printf("Warning: failed to publish URL to instance lock: %v", err)
+	}
+	instanceRegistry.Update(func(r *instanceRecord) {
+		r.URL = uiURL
+		if addr, ok := ln.Addr().(*net.TCPAddr); ok {
+			r.Port = addr.Port
+		}
+	})
 	fmt.Fprintf(os.Stderr, "Agent Chat UI: %s\n", uiURL)
 	fmt.Fprintf(os.Stderr, "MCP endpoint: POST %s/mcp\n", uiURL)
+	if publicURL != "" {
+		fmt.Fprintf(os.Stderr, "Public UI: %s\n", publicURL)
+	}
+	if printQR && tunnelProvider == "" && !strings.HasPrefix(uiURL, unixURLPrefix) { // with a tunnel, the QR waits for the public URL
+		printStartupQR()
+	}
 	openBrowser(uiURL)
 	browserOpened = true
 	return nil
@@ -186,24 +216,216 @@ func parseWelcomeReplies(raw string) []string {
 }
 
 func main() {
-	showVersion := flag.Bool("v", false, "print version and exit")
-	noStdio := flag.Bool("no-stdio-mcp", false, "disable stdio MCP transport (HTTP MCP is always available)")
-	flag.StringVar(&themeCookieName, "theme-cookie", "agent-chat-theme", "cookie name for light/dark theme toggle")
-	flag.StringVar(&uploadDir, "upload-dir", "", "directory for uploaded files (default: temp dir)")
-	flag.StringVar(&autocompleteURL, "autocomplete-url", "", "legacy: fallback URL for triggers without an explicit URL")
-	flag.StringVar(&autocompleteTriggers, "autocomplete-triggers", "", "trigger characters mapped to URLs (e.g. '/=http://host/api')")
+	os.Exit(runCLI(os.Args[1:]))
+}
+
+// runServe implements `agent-chat serve` (also the default when no subcommand
+// is given): the MCP server plus browser UI. Returns the exit code.
+func runServe(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	showVersion := flags.Bool("v", false, "print version and exit")
+	noStdio := flags.Bool("no-stdio-mcp", false, "disable stdio MCP transport (HTTP MCP is always available)")
+	flags.StringVar(&themeCookieName, "theme-cookie", "agent-chat-theme", "cookie name for light/dark theme toggle")
+	flags.StringVar(&uploadDir, "upload-dir", "", "directory for uploaded files (default: temp dir)")
+	flags.StringVar(&sessionNameFlag, "session-name", "", "name for this chat, shown in the page title, notifications, exports' names and agent-chat list, and stamped on every event (default: the set_chat_title title)")
+	flags.StringVar(&sessionsDir, "sessions-dir", "", "directory of past event logs (*.jsonl, rotated or in per-session subdirectories) listed at /api/sessions and viewable read-only at /sessions/; unset, those routes are not served")
+	flags.StringVar(&katexDir, "katex-dir", "", "KaTeX dist directory (katex.min.js, katex.min.css, fonts/) served at /katex/, so the chat typesets the LaTeX agents send with math; without it formulas show as source")
+	flags.StringVar(&shareDir, "share-dir", "", "serve this directory read-only at /files, for the user to browse and attach from the chat and the agent to list with list_shared_files")
+	flags.StringVar(&pageBranding.Title, "title", "", "page title and header label (default \"Agent Chat\")")
+	flags.StringVar(&pageBranding.Accent, "accent-color", "", "accent color for user bubbles and buttons (hex or CSS color name)")
+	flags.StringVar(&pageBranding.Logo, "logo", "", "image file shown in the header and as the favicon")
+	flags.StringVar(&customCSSPath, "custom-css", "", "stylesheet served at /custom.css and loaded after the UI's own, for restyling without touching client-dist")
+	jsonStartup := flags.Bool("json-startup", false, "once the server is up, print one JSON line with its url, mcp endpoint, port, pid and version (to stdout with -no-stdio-mcp, else stderr)")
+	urlFile := flags.String("url-file", "", "write the UI URL to this file once the server is up (removed on exit)")
+	heartbeat := flags.Duration("heartbeat", 30*time.Second, "how often to tell the browser when the agent last made a tool call; 0 disables")
+	flags.DurationVar(&stallAfter, "stall-after", stallAfter, "report the agent stalled after this long without a tool call")
+	flags.IntVar(&historyPage, "history-page", historyPage, "events a new browser tab is sent up front; older ones load as it scrolls up (0 sends them all)")
+	flags.IntVar(&wsDeflate, "ws-deflate", wsDeflate, "permessage-deflate level for WebSocket clients that support it, 1 (fastest) to 9 (smallest); 0 disables compression")
+	flags.StringVar(&clamdAddr, "clamd", "", "virus-scan uploads with clamd at this address ('unix:/run/clamav/clamd.ctl' or 'host:3310'); infected or unscannable files are refused")
+	flags.StringVar(&scanCommand, "scan-command", "", "virus-scan uploads by running this command with the file's path appended; exit 0 passes it, 1 means infected (e.g. 'clamdscan --no-summary --stream')")
+	flags.IntVar(&pasteLimit, "paste-limit", pasteLimit, "user messages longer than this many bytes are saved as a .txt attachment, with a short preview in the chat; 0 keeps them inline")
+	flags.BoolVar(&extractZips, "extract-zips", false, "unpack uploaded .zip files into a folder beside them, with a manifest listing its files")
+	flags.BoolVar(&dateSeparators, "date-separators", false, "mark where each new day starts in the chat and its exports (days in the server's time zone)")
+	flags.BoolVar(&wsMsgpack, "ws-msgpack", wsMsgpack, "send MessagePack binary frames to WebSocket clients that ask for them (the browser UI does); JSON otherwise")
+	flags.BoolVar(&noBrowser, "no-browser", false, "never open a browser tab (for daemons; the URL is still printed)")
+	flags.StringVar(&browserCmd, "browser", "", "command that opens the chat, with its arguments before the URL (e.g. 'firefox -P work'; on macOS an application name like 'Google Chrome'); default: the system browser")
+	flags.BoolVar(&appWindow, "app-window", false, "open the chat as a chromeless app window (Chromium's --app) instead of a browser tab")
+	flags.StringVar(&listenAddr, "listen", "", "HTTP listen address: 'host:port', or 'unix:/path.sock' for a Unix domain socket (default: all interfaces on $AGENT_CHAT_PORT, $PORT or a random port)")
+	flags.StringVar(&tunnelProvider, "tunnel", "", "publish the UI through 'tailscale' (tailnet HTTPS), 'ngrok' or 'cloudflared' and hand out that URL instead of localhost")
+	pairingFlag := flags.Bool("pairing", false, "require browsers not on this machine to enter a pairing code printed here before they can connect (implied by -tunnel)")
+	flags.Func("mcp-token", "require this bearer token (Authorization: Bearer ...) on /mcp from other machines; repeatable, and AGENT_CHAT_MCP_TOKEN adds one", func(s string) error {
+		addMCPToken(s)
+		return nil
+	})
+	flags.IntVar(&maxConnsPerIP, "max-conns-per-ip", 0, "most WebSocket connections one address (other than this machine) may hold open at once; 0 is unlimited")
+	flags.BoolVar(&allowWipe, "allow-wipe", false, "let the agent permanently delete this session (event log, uploads, chat-log export) with wipe_session when the user asks for their data to be erased")
+	hashChain := flags.Bool("hash-chain", false, "chain-hash the event log: each line carries the previous line's hash, so agent-chat verify can show it was not edited")
+	auditLogPath := flags.String("audit-log", "", "append one JSON line per connect, disconnect, upload, message post, auth failure and refused connection to this file")
+	flags.StringVar(&crashDir, "crash-dir", "", "write a crash report (panic, stack trace, version) to this directory whenever a handler or tool panics; the server recovers either way")
+	mcpTokenFile := flags.String("mcp-token-file", "", "file of bearer tokens accepted on /mcp, one per line (# comments allowed), to keep them out of the process list")
+	mdns := flags.Bool("mdns", false, "advertise the UI on the LAN over mDNS/DNS-SD as _agentchat._tcp, with the chat title")
+	flags.BoolVar(&printQR, "qr", false, "print a QR code of the UI's LAN URL at startup, for opening the chat on a phone")
+	locale := flags.String("locale", "", "language for the UI and the agent-facing text: 'en' or a bundled locale such as 'es'; unset, each browser's UI follows its Accept-Language and the agent-facing text is English")
+	demo := flags.Bool("demo", false, "serve a sample conversation (messages, draw slides, a permission prompt) instead of talking to an agent")
+	toolsFile := flags.String("tools-file", "", "JSON file of extra MCP tools backed by local commands ({\"tools\": [{\"name\", \"description\", \"command\": [...]}]}) and upstream MCP servers to proxy ({\"upstreams\": [...]})")
+	disableTools := flags.String("disable-tools", "", "comma-separated built-in tools not to offer the agent (e.g. 'draw,send_verbal_reply'), to save tokens or leave a name to another MCP server")
+	minimal := flags.Bool("minimal-tools", false, "offer only send_message and check_messages (plus any -tools-file tools)")
+	toolPrefix := flags.String("tool-prefix", "", "put this in front of every tool name the agent sees (e.g. 'chat_' gives chat_send_message), to avoid collisions with other MCP servers")
+	compact := flags.Bool("compact-tools", false, "list tools with one-line descriptions to save the agent's context; the full ones are read from chat://tools/{name} or the tool-guide prompt")
+	templatesDir := flags.String("templates-dir", "", "directory with agent-reply.tmpl and/or session-prompts.tmpl overriding the embedded agent-facing templates")
+	flags.StringVar(&staticDir, "static-dir", "", "serve the browser UI from this directory, falling back to the embedded files for anything missing")
+	flags.StringVar(&autocompleteURL, "autocomplete-url", "", "legacy: fallback URL for triggers without an explicit URL")
+	flags.StringVar(&autocompleteTriggers, "autocomplete-triggers", "", "trigger characters mapped to URLs (e.g. '/=http://host/api')")
 	defaultWelcome := "What can you help me with?,Give me an overview of this project,What's changed recently?"
-	welcomeRepliesFlag := flag.String("welcome-replies", defaultWelcome, "comma-separated quick replies shown on an empty chat ('' to disable)")
-	filepathRootsFlag := flag.String("filepath-roots", "", "comma-separated allowlist of roots for absolute (@/…) filepath autocomplete (default: cwd + /repos,/workspace,/worktrees)")
-	flag.Parse()
+	welcomeRepliesFlag := flags.String("welcome-replies", defaultWelcome, "comma-separated quick replies shown on an empty chat ('' to disable)")
+	filepathRootsFlag := flags.String("filepath-roots", "", "comma-separated allowlist of roots for absolute (@/…) filepath autocomplete (default: cwd + /repos,/workspace,/worktrees)")
+	agentName := flags.String("agent-name", "", "name shown on the agent's bubbles and in exports (the agent can change it with set_identity)")
+	linkPreviews := flags.String("link-previews", "", "comma-separated hosts whose links get preview cards, fetched server-side (e.g. 'github.com,*.github.io'); '' disables")
+	onStdioExit := flags.String("on-stdio-exit", "shutdown", "when the stdio MCP client exits: 'shutdown', 'keep' (serve the UI until Ctrl+C) or 'timeout=N' (keep it for N, e.g. 10m)")
+	var permPolicy permissionPolicy
+	flags.DurationVar(&permPolicy.Timeout, "permission-timeout", 0, "deny a permission prompt relayed to the chat if it is not answered within this long; 0 waits forever")
+	flags.Func("permission-exclude", "don't relay permission prompts matching this rule ('Tool' or 'Tool:regexp' over its description and input, '*' for any tool) to the chat; repeatable", func(s string) error {
+		r, err := parsePermissionRule(s)
+		permPolicy.Exclude = append(permPolicy.Exclude, r)
+		return err
+	})
+	flags.Func("permission-include", "relay permission prompts matching this rule to the chat even when a -permission-exclude rule matches; repeatable", func(s string) error {
+		r, err := parsePermissionRule(s)
+		permPolicy.Include = append(permPolicy.Include, r)
+		return err
+	})
+	flags.Func("base-path", "serve the whole app under this URL prefix (e.g. /agent-chat/), for a reverse proxy that forwards the path unchanged", func(s string) (err error) {
+		basePath, err = parseBasePath(s)
+		return err
+	})
+	flags.Func("public-url", "the chat's externally reachable URL, used in tool results, -qr and -json-startup instead of the listen address (e.g. https://box.example.com/agent-chat)", func(s string) (err error) {
+		publicURL, err = parsePublicURL(s)
+		return err
+	})
+	flags.Func("trusted-proxy", "IP or CIDR range of a reverse proxy whose X-Forwarded-Host/-Proto headers give the chat's public URL for tool results; repeatable", func(s string) error {
+		p, err := parseTrustedProxy(s)
+		trustedProxies = append(trustedProxies, p)
+		return err
+	})
+	flags.Func("markdown-allow", "what agent markdown may contain, comma-separated: links, images, tables, html (raw HTML), or 'none' (default 'links,images,tables'); the rest is rewritten as plain text or code", func(s string) (err error) {
+		mdPolicy, err = parseMarkdownPolicy(s)
+		return err
+	})
+	singleInstance := flags.String("single-instance", "", "when an instance is already running for this project: 'forward' (relay MCP stdio to it) or 'refuse' (print its URL and exit); '' disables the check")
+	flags.Parse(args)
 
 	welcomeReplies = parseWelcomeReplies(*welcomeRepliesFlag)
+	sessionNameFlag = cleanSessionName(sessionNameFlag)
 	cwd, _ := os.Getwd()
 	filepathRoots = parseFilepathRoots(*filepathRootsFlag, cwd)
 
 	if *showVersion {
 		fmt.Printf("agent-chat %s (%s)\n", version, commit)
-		os.Exit(0)
+		return 0
+	}
+
+	if err := pageBranding.validate(); err != nil {
+		log.Fatal(err)
+	}
+	stdioExit, err := parseStdioExitPolicy(*onStdioExit)
+	if err != nil {
+		log.Fatalf("-on-stdio-exit: %v", err)
+	}
+	if *toolPrefix != "" && !toolPrefixRe.MatchString(*toolPrefix) {
+		log.Fatalf("-tool-prefix must be 1 to 32 letters, digits, '_', '.' or '-', got %q", *toolPrefix)
+	}
+	if tunnelProvider != "" && !validTunnelProvider(tunnelProvider) {
+		log.Fatalf("-tunnel must be 'tailscale', 'ngrok' or 'cloudflared', got %q", tunnelProvider)
+	}
+	if strings.HasPrefix(listenAddr, "unix:") && (tunnelProvider != "" || *mdns) {
+		log.Fatal("-tunnel and -mdns need a TCP port; they cannot be combined with -listen unix:")
+	}
+	if *pairingFlag || tunnelProvider != "" {
+		keyPath := ""
+		if home, err := agentChatHome(); err == nil {
+			keyPath = filepath.Join(home, "pairing.key")
+		}
+		g, err := newPairingGate(keyPath)
+		if err != nil {
+			log.Fatalf("-pairing: %v", err)
+		}
+		pairing = g
+	}
+	if *auditLogPath != "" {
+		a, err := openAuditLog(*auditLogPath)
+		if err != nil {
+			log.Fatalf("-audit-log: %v", err)
+		}
+		audit = a
+	}
+	addMCPToken(os.Getenv("AGENT_CHAT_MCP_TOKEN"))
+	if *mcpTokenFile != "" {
+		if err := loadMCPTokenFile(*mcpTokenFile); err != nil {
+			log.Fatalf("-mcp-token-file: %v", err)
+		}
+	}
+	if customCSSPath != "" {
+		abs, err := filepath.Abs(customCSSPath)
+		if err != nil {
+			log.Fatalf("-custom-css: %v", err)
+		}
+		if _, err := os.Stat(abs); err != nil {
+			log.Fatalf("-custom-css: %v", err)
+		}
+		customCSSPath = abs
+	}
+
+	// The locale's templates go first so -templates-dir can still adjust them.
+	if b, err := loadLocale(*locale); err != nil {
+		log.Fatalf("-locale: %v", err)
+	} else {
+		uiLocale, localeFlagSet = b, *locale != ""
+	}
+	if *templatesDir != "" {
+		applied, err := loadTemplateOverrides(*templatesDir)
+		if err != nil {
+			log.Fatalf("-templates-dir: %v", err)
+		}
+		for _, path := range applied {
+			log.Printf("Using template overrides from %s", path)
+		}
+	}
+
+	if *demo {
+		return runDemo()
+	}
+
+	// Single-instance mode: one server per project. The lock is taken before
+	// anything else starts so a second invocation never opens its own tab.
+	switch *singleInstance {
+	case "":
+	case "forward", "refuse":
+		home, err := agentChatHome()
+		if err != nil {
+			log.Fatalf("single-instance: %v", err)
+		}
+		lock, running, err := acquireInstanceLock(home, cwd)
+		if err != nil {
+			log.Printf("Warning: single-instance lock unavailable: %v (continuing without it)", err)
+		} else if running != nil {
+			return runAgainstExistingInstance(home, running, *singleInstance, *noStdio)
+		}
+		singleInstanceLock = lock
+		defer singleInstanceLock.Release()
+	default:
+		log.Fatalf("-single-instance must be 'forward' or 'refuse', got %q", *singleInstance)
+	}
+
+	// Register in the live-instance registry (`agent-chat list`,
+	// GET /api/instances). Best effort: an unwritable home dir only warns.
+	if home, err := agentChatHome(); err == nil {
+		entry, err := registerInstance(home, instanceRecord{PID: os.Getpid(), Project: cwd, Started: time.Now().UnixMilli(), Name: sessionName()})
+		if err != nil {
+			log.Printf("Warning: instance registry unavailable: %v", err)
+		} else {
+			instanceRegistry = entry
+			defer instanceRegistry.Remove()
+		}
 	}
 
 	// Set up upload directory
@@ -222,6 +444,21 @@ func main() {
 			log.Fatalf("failed to create upload dir %s: %v", uploadDir, err)
 		}
 	}
+	if shareDir != "" {
+		abs, err := filepath.Abs(shareDir)
+		if err != nil {
+			log.Fatalf("share dir %s: %v", shareDir, err)
+		}
+		if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+			log.Fatalf("share dir %s is not a directory", shareDir)
+		}
+		shareDir = abs
+	}
+	if katexDir != "" {
+		if _, err := os.Stat(filepath.Join(katexDir, "katex.min.js")); err != nil {
+			log.Fatalf("katex dir %s: %v", katexDir, err)
+		}
+	}
 
 	// Initialize event bus, optionally with JSONL file logging.
 	if logPath := os.Getenv("AGENT_CHAT_EVENT_LOG"); logPath != "" {
@@ -230,17 +467,31 @@ func main() {
 		if err != nil {
 			log.Printf("Warning: failed to open event log %s: %v (falling back to in-memory only)", logPath, err)
 			bus = NewEventBus()
+		} else if *hashChain {
+			if err := bus.EnableHashChain(logPath); err != nil {
+				log.Fatalf("-hash-chain: %v", err)
+			}
 		}
 	} else {
+		if *hashChain {
+			log.Fatal("-hash-chain needs an event log: set AGENT_CHAT_EVENT_LOG")
+		}
 		bus = NewEventBus()
 	}
 	defer bus.Close()
+	if *agentName != "" {
+		id, err := newAgentIdentity(*agentName, "", "")
+		if err != nil {
+			log.Fatalf("-agent-name: %v", err)
+		}
+		bus.SetIdentity(id)
+	}
 
 	// Streaming chat-log export (append-as-it-goes .md twin of the JSONL log),
 	// enabled by AGENT_CHAT_EXPORT_DIR. A misconfigured dir disables the
 	// feature with a warning; it never takes the chat down.
 	{
-		history, _ := bus.History()
+		history := bus.FullHistory()
 		stream, err := initChatLogStream(
 			os.Getenv("AGENT_CHAT_EXPORT_DIR"), cwd,
 			chatLogSessionID(os.Getenv("AGENT_CHAT_EVENT_LOG")),
@@ -251,7 +502,10 @@ func main() {
 		} else if stream != nil {
 			chatStream = stream
 			defer chatStream.Close() // SIGTERM/exit: flush + final index regeneration
-			ch := bus.Subscribe()
+			if st := stream.Status(); st.Titled {
+				setChatTitle(humanTitle(st.Slug))
+			}
+			ch := bus.Observe()
 			go func() {
 				for e := range ch {
 					chatStream.HandleEvent(e)
@@ -278,6 +532,15 @@ func main() {
 		Name:    "agent-chat",
 		Version: version,
 	}, &mcp.ServerOptions{
+		SubscribeHandler:   subscribeChatHistory,
+		UnsubscribeHandler: unsubscribeChatHistory,
+		InitializedHandler: func(ctx context.Context, req *mcp.InitializedRequest) {
+			// Tabs opened before the client connected learn "Ask agent"
+			// is available now.
+			if p := req.Session.InitializeParams(); p != nil && p.Capabilities != nil && p.Capabilities.Sampling != nil {
+				bus.PublishTransient(map[string]any{"type": "capabilities", "canAsk": true})
+			}
+		},
 		Capabilities: &mcp.ServerCapabilities{
 			Experimental: map[string]any{
 				"claude/channel":            map[string]any{},
@@ -287,17 +550,99 @@ func main() {
 	})
 	mcpServerRef = server
 	if !disabled {
+		server.AddReceivingMiddleware(trackToolCalls(bus))
+		if *heartbeat > 0 {
+			go runHeartbeat(ctx, bus, *heartbeat, stallAfter)
+		}
 		registerTools(server, bus)
+		builtin, err := trimTools(server, parseToolList(*disableTools), *minimal)
+		if err != nil {
+			log.Fatalf("-disable-tools: %v", err)
+		}
+		if *toolsFile != "" {
+			custom, err := loadCustomTools(*toolsFile, builtin)
+			if err != nil {
+				log.Fatalf("-tools-file: %v", err)
+			}
+			registerCustomTools(server, bus, custom, cwd)
+			upstreams, err := loadUpstreams(*toolsFile)
+			if err != nil {
+				log.Fatalf("-tools-file: %v", err)
+			}
+			for _, t := range custom {
+				builtin = append(builtin, t.Name)
+			}
+			registerUpstreams(ctx, server, bus, upstreams, builtin, cwd)
+		}
+		server.AddReceivingMiddleware(reportToolErrors(bus))
+		server.AddReceivingMiddleware(gateTools(bus))
+		bus.OnToolsChanged(func() { notifyToolsChanged(server) })
+		if *compact {
+			if err := compactTools(server); err != nil {
+				log.Fatalf("-compact-tools: %v", err)
+			}
+		}
+		if *toolPrefix != "" {
+			server.AddReceivingMiddleware(prefixTools(*toolPrefix))
+		}
+		server.AddReceivingMiddleware(recoverTools)
 		registerResources(server)
+		registerChatHistoryResources(server, bus)
+		registerPrompts(server, bus)
+		go watchChatHistory(ctx, server, bus)
+		if previewer := newLinkPreviewer(*linkPreviews); previewer != nil {
+			previewer.start(ctx, bus)
+		}
 
 		if err := ensureHTTPServer(); err != nil {
 			log.Fatalf("failed to start HTTP server: %v", err)
 		}
+		localURL := uiURL
+		port := 0
+		if addr, ok := httpListener.Addr().(*net.TCPAddr); ok {
+			port = addr.Port
+		}
+		if *mdns {
+			startMDNS(ctx, cwd, port)
+		}
+		if tunnelProvider != "" {
+			// Tool results then link to the public URL; the instance
+			// lock and registry keep the local one.
+			if public, err := startTunnel(ctx, tunnelProvider, port); err != nil {
+				log.Printf("Warning: %v (the UI is only on %s)", err, uiURL)
+			} else {
+				httpMu.Lock()
+				uiURL = public + basePath
+				httpMu.Unlock()
+				fmt.Fprintf(os.Stderr, "Public UI (%s): %s\n", tunnelProvider, public)
+			}
+			if printQR {
+				printStartupQR()
+			}
+		}
+		if pairing != nil {
+			pairing.Code()
+		}
+		if *urlFile != "" {
+			if err := writeURLFile(*urlFile, chatURL()); err != nil {
+				log.Printf("Warning: -url-file: %v", err)
+			} else {
+				defer os.Remove(*urlFile)
+			}
+		}
+		if *jsonStartup {
+			// stdout carries MCP unless it is off.
+			out := os.Stderr
+			if *noStdio {
+				out = os.Stdout
+			}
+			writeStartupJSON(out, newStartupInfo(chatURL(), localURL, port))
+		}
 	}
 
 	// Channel interceptor sits between real stdin and the MCP SDK,
 	// handling Claude Code channel notifications (e.g. permission prompts).
-	channelInterceptorRef = newChannelInterceptor(bus)
+	channelInterceptorRef = newChannelInterceptor(bus, permPolicy)
 
 	if !*noStdio {
 		// Run MCP over intercepted stdio (blocks until client disconnects)
@@ -305,24 +650,33 @@ func main() {
 			Reader: channelInterceptorRef.pipeReader,
 			Writer: nopWriteCloser{os.Stdout},
 		}
-		if err := server.Run(ctx, transport); err != nil {
+		err := server.Run(ctx, transport)
+		if s, ok := bus.KnownSession("stdio"); ok {
+			s.Disconnect()
+		}
+		if err != nil {
 			log.Fatalf("mcp server error: %v", err)
 		}
+		if stdioExit.keep && ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "MCP client disconnected; the chat UI stays up at %s (-on-stdio-exit %s). Press Ctrl+C to stop.\n", uiURL, stdioExit)
+			stdioExit.wait(ctx)
+		}
 	} else {
 		// No stdio — block until signal cancels context
 		fmt.Fprintf(os.Stderr, "Running in HTTP-only mode (no stdio MCP). Press Ctrl+C to stop.\n")
 		<-ctx.Done()
 	}
+	return 0
 }
 
 // startHTTPServer starts the HTTP server with the browser UI, WebSocket endpoint,
 // and StreamableHTTP MCP endpoint. Returns the base URL and the listener.
 func startHTTPServer(mcpServer *mcp.Server) (string, net.Listener, error) {
-	staticSub, err := fs.Sub(staticFS, "client-dist")
+	staticSub, err := clientFS()
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to create sub filesystem: %w", err)
+		return "", nil, err
 	}
-	fileServer := http.FileServer(http.FS(staticSub))
+	assets := newStaticAssets(staticSub)
 
 	// StreamableHTTP MCP handler
 	mcpHandler := mcp.NewStreamableHTTPHandler(func(r *http.Request) *mcp.Server {
@@ -346,69 +700,99 @@ func startHTTPServer(mcpServer *mcp.Server) (string, net.Listener, error) {
 	})
 
 	mux := http.NewServeMux()
-	mux.Handle("/mcp", mcpHandler)
-	mux.Handle("/mcp/orchestrator", orchHandler)
+	mux.Handle("/mcp", requireMCPToken(endSessionOnDelete(mcpHandler)))
+	mux.Handle("/mcp/orchestrator", requireMCPToken(orchHandler))
 	mux.HandleFunc("/ws", handleWebSocket)
 	mux.HandleFunc("/upload", handleUpload)
 	mux.HandleFunc("/api/export", handleExport)
+	mux.HandleFunc("/api/instances", handleInstances)
+	mux.HandleFunc("/api/replay", handleReplay)
+	mux.HandleFunc("/api/message", handleMessage)
+	mux.HandleFunc("/api/search", handleSearch)
+	mux.HandleFunc("/api/status", handleStatus)
+	mux.HandleFunc("/api/state", handleState)
+	mux.HandleFunc("/api/time", handleTime)
+	mux.HandleFunc("/api/measure-text", handleMeasureText)
+	mux.HandleFunc("/docs/", handleDocs)
+	mux.HandleFunc("/api/files", handleSharedList)
+	mux.HandleFunc("/files/", handleSharedFile)
+	mux.HandleFunc("/katex/", handleKatex)
+	mux.HandleFunc("/i18n/", handleLocaleBundle)
+	if archiveDir() != "" {
+		mux.HandleFunc("/api/sessions", handleSessionsList)
+		mux.HandleFunc("/sessions/", handleSessionView)
+	}
+	mux.HandleFunc("/api/debug/bus", handleBusDebug)
+	mux.HandleFunc("/api/instructions/", handleInstructions)
+	mux.HandleFunc("/metrics", handleMetrics)
+	mux.HandleFunc("/branding/logo", handleLogo)
+	mux.HandleFunc("/custom.css", handleCustomCSS)
+	mux.HandleFunc("/manifest.webmanifest", handleManifest)
+	mux.HandleFunc("/sw.js", handleServiceWorker)
 	mux.HandleFunc("/autocomplete", handleAutocomplete)
 	mux.Handle("/uploads/", http.StripPrefix("/uploads/", http.FileServer(http.Dir(uploadDir))))
 	// Serve index.html with inlined config (replaces the old /config.js endpoint).
 	// This avoids relative-path resolution failures when the page is served
 	// behind a reverse proxy at a non-root path (e.g. /session/UUID).
-	indexHTML, _ := fs.ReadFile(staticSub, "index.html")
+	// With -static-dir the page is re-read per request, so edits to an
+	// overriding index.html show on reload like every other file.
 	triggerMap = buildTriggerMap(autocompleteTriggers, autocompleteURL)
 	triggerCharsJSON, _ := json.Marshal(triggerChars(triggerMap))
-	configScript := fmt.Sprintf("<script>var THEME_COOKIE_NAME=%q,SERVER_VERSION=%q,AUTOCOMPLETE_TRIGGERS=%s;</script>",
-		themeCookieName, version+" ("+commit+")", string(triggerCharsJSON))
-	indexPage := strings.Replace(string(indexHTML), "<!--CONFIG-->", configScript, 1)
+	brandTitleJSON, _ := json.Marshal(pageBranding.Title) // JSON escapes < and >, so a title cannot close the script
+	// The page's clock correction comes from /api/time; it is cached, so
+	// only the zone goes in here.
+	serverZone := currentServerTime()
+	// The page is rendered once per locale (-locale's, or with no -locale
+	// each browser's Accept-Language pick; see pageLocale) and session name.
+	renderIndex := func(b *localeBundle) string {
+		lang, speechLang, i18nJSON := localeConfig(b)
+		configScript := fmt.Sprintf("<script>var THEME_COOKIE_NAME=%q,SERVER_VERSION=%q,AUTOCOMPLETE_TRIGGERS=%s,SPEECH_LANG=%q,I18N=%s,BRAND_TITLE=%s,BRAND_LOGO=%q,SERVER_TZ=%q,SERVER_TZ_OFFSET=%d,SHARED_FILES=%t,KATEX=%t,SESSIONS_ARCHIVE=%t;</script>",
+			themeCookieName, version+" ("+commit+")", string(triggerCharsJSON), speechLang, string(i18nJSON), string(brandTitleJSON), pageBranding.logoURL(), serverZone.TimeZone, serverZone.OffsetMinutes, shareDir != "", katexDir != "", archiveDir() != "")
+		indexHTML, _ := fs.ReadFile(staticSub, "index.html")
+		page := strings.Replace(string(indexHTML), "<!--CONFIG-->", configScript, 1)
+		page = strings.Replace(page, "<title>Agent Chat</title>", "<title>"+html.EscapeString(sessionPageTitle())+"</title>", 1)
+		page = strings.Replace(page, "</head>", pageBranding.headHTML()+"</head>", 1)
+		page = strings.Replace(page, `<html lang="en">`, `<html lang="`+lang+`">`, 1)
+		return assets.versionLinks(page)
+	}
+	var pagesMu sync.Mutex
+	indexPages := map[string]string{}
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/" || r.URL.Path == "/index.html" {
+			b := pageLocale(r)
+			lang, _, _ := localeConfig(b)
+			key := lang + "\x00" + sessionName() // set_chat_title renames the page
+			pagesMu.Lock()
+			page, ok := indexPages[key]
+			if !ok || staticDir != "" {
+				page = renderIndex(b)
+				indexPages[key] = page
+			}
+			pagesMu.Unlock()
+			if !localeFlagSet {
+				w.Header().Set("Vary", "Accept-Language")
+			}
 			w.Header().Set("Content-Type", "text/html; charset=utf-8")
-			fmt.Fprint(w, indexPage)
+			w.Header().Set("Cache-Control", "no-cache") // it links assets by content hash
+			fmt.Fprint(w, page)
 			return
 		}
-		fileServer.ServeHTTP(w, r)
+		assets.ServeHTTP(w, r)
 	})
 
-	port := 0
-	if s := os.Getenv("AGENT_CHAT_PORT"); s != "" {
-		port, _ = strconv.Atoi(s)
-	} else if s := os.Getenv("PORT"); s != "" {
-		port, _ = strconv.Atoi(s)
-	}
-	addr := "0.0.0.0:0"
-	if port > 0 {
-		addr = fmt.Sprintf("0.0.0.0:%d", port)
-	}
-
-	ln, err := net.Listen("tcp", addr)
+	ln, url, err := listenHTTP(listenAddr)
 	if err != nil {
-		return "", nil, fmt.Errorf("listen error: %w", err)
+		return "", nil, err
 	}
-	actualPort := ln.Addr().(*net.TCPAddr).Port
 	go func() {
-		http.Serve(ln, mux)
+		http.Serve(ln, recoverHTTP(learnForwardedURL(mountAt(basePath, pairing.wrap(mux)))))
 		// Server stopped — mark as not running so next call restarts it
 		httpMu.Lock()
 		httpRunning = false
 		httpMu.Unlock()
 	}()
 
-	return fmt.Sprintf("http://localhost:%d", actualPort), ln, nil
-}
-
-func openBrowser(url string) {
-	var cmd *exec.Cmd
-	switch runtime.GOOS {
-	case "darwin":
-		cmd = exec.Command("open", url)
-	case "linux":
-		cmd = exec.Command("xdg-open", url)
-	default:
-		cmd = exec.Command("cmd", "/c", "start", url)
-	}
-	cmd.Start() // fire and forget
+	return url + basePath, ln, nil
 }
 
 func handleUpload(w http.ResponseWriter, r *http.Request) {
@@ -430,16 +814,43 @@ func handleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A dropped folder: its files, each with its path in the folder (see
+	// uploadfolder.go).
+	if paths := r.MultipartForm.Value["paths"]; len(paths) > 0 {
+		if len(paths) != len(files) {
+			http.Error(w, "paths must give one path per file", http.StatusBadRequest)
+			return
+		}
+		ref, err := saveUploadedFolder(r.Context(), files, paths)
+		if err != nil {
+			writeUploadError(w, err)
+			return
+		}
+		auditUpload(r, []FileRef{ref})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]FileRef{ref})
+		return
+	}
+
 	var refs []FileRef
 	for _, fh := range files {
-		ref, err := saveUploadedFile(fh)
+		ref, err := saveUploadedFile(r.Context(), fh)
 		if err != nil {
-			http.Error(w, "failed to save file: "+err.Error(), http.StatusInternalServerError)
+			writeUploadError(w, err)
 			return
 		}
 		refs = append(refs, ref)
+		if extractZips && isZip(ref) {
+			manifest, err := unpackZip(ref)
+			if err != nil {
+				log.Printf("agent-chat: keeping %s as a zip: %v", ref.Name, err)
+				continue
+			}
+			refs = append(refs, manifest)
+		}
 	}
 
+	auditUpload(r, refs)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(refs)
 }
@@ -481,43 +892,93 @@ func handleExport(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func saveUploadedFile(fh *multipart.FileHeader) (FileRef, error) {
+// saveUploadedFile stores an uploaded file under uploadDir. With scanning
+// on (see uploadscan.go) it is scanned first, outside uploadDir, and an
+// *uploadRejection returned if it fails.
+func saveUploadedFile(ctx context.Context, fh *multipart.FileHeader) (FileRef, error) {
+	prefix := uuid.New().String()[:8]
+	savedName := prefix + "-" + fh.Filename
+	destPath := filepath.Join(uploadDir, savedName)
+	if err := storeUpload(ctx, fh, fh.Filename, destPath); err != nil {
+		return FileRef{}, err
+	}
+	return FileRef{
+		Name: fh.Filename,
+		Path: destPath,
+		URL:  "/uploads/" + savedName,
+		Size: fh.Size,
+		Type: fh.Header.Get("Content-Type"),
+	}, nil
+}
+
+// storeUpload writes fh to destPath, scanning it first when scanning is on;
+// name is how a rejection refers to it.
+func storeUpload(ctx context.Context, fh *multipart.FileHeader, name, destPath string) error {
 	src, err := fh.Open()
 	if err != nil {
-		return FileRef{}, err
+		return err
 	}
 	defer src.Close()
 
-	prefix := uuid.New().String()[:8]
-	savedName := prefix + "-" + fh.Filename
-	destPath := filepath.Join(uploadDir, savedName)
+	writePath := destPath
+	if scanningUploads() {
+		tmp, err := os.CreateTemp("", "agent-chat-scan-*")
+		if err != nil {
+			return err
+		}
+		tmp.Close()
+		writePath = tmp.Name()
+		defer os.Remove(writePath) // gone once moved; removes a rejected one
+	}
 
-	dst, err := os.Create(destPath)
+	dst, err := os.Create(writePath)
 	if err != nil {
-		return FileRef{}, err
+		return err
 	}
 	defer dst.Close()
 
 	if _, err := io.Copy(dst, src); err != nil {
-		return FileRef{}, err
+		return err
 	}
 
-	return FileRef{
-		Name: fh.Filename,
-		Path: destPath,
-		URL:  "/uploads/" + savedName,
-		Size: fh.Size,
-		Type: fh.Header.Get("Content-Type"),
-	}, nil
+	if writePath != destPath {
+		dst.Close()
+		sig, err := scanUpload(ctx, writePath)
+		if err != nil {
+			return &uploadRejection{Name: name, Reason: "scan_failed", err: err}
+		}
+		if sig != "" {
+			return &uploadRejection{Name: name, Reason: "infected", Signature: sig}
+		}
+		return moveFile(writePath, destPath)
+	}
+	return nil
 }
 
 func handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	// -max-conns-per-ip: tabs on this machine are never refused.
+	ip := clientIP(r)
+	if !isLocalRequest(r) {
+		if !wsConns.acquire(ip, maxConnsPerIP) {
+			audit.Record(r, auditRecord{Event: "connRefused", Client: r.URL.Query().Get("client"), Detail: "too many connections from this address"})
+			http.Error(w, "too many connections from this address", http.StatusTooManyRequests)
+			return
+		}
+		defer wsConns.release(ip)
+	}
+	up := wsUpgrader()
+	conn, err := up.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("websocket upgrade error: %v", err)
 		return
 	}
 	defer conn.Close()
+	connected := time.Now()
+	audit.Record(r, auditRecord{Event: "connect", Client: r.URL.Query().Get("client")})
+	defer func() {
+		audit.Record(r, auditRecord{Event: "disconnect", Client: r.URL.Query().Get("client"), Detail: time.Since(connected).Round(time.Second).String()})
+	}()
+	codec := codecFor(conn)
 
 	// Read cursor from query param — client sends last seen seq number.
 	cursor := int64(0)
@@ -527,6 +988,13 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// client is the browser's persistent id; its display name (if any) comes
+	// along so a restarted server learns it again without a setName.
+	client := r.URL.Query().Get("client")
+	if name := r.URL.Query().Get("name"); client != "" && name != "" {
+		bus.SetDisplayName(client, name)
+	}
+
 	// Send connected handshake (no history array — we stream events after).
 	connectMsg := map[string]any{"type": "connected", "version": version + " (" + commit + ")"}
 	if pendingAckID := bus.PendingAckID(); pendingAckID != "" {
@@ -534,33 +1002,50 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 	if qr := bus.LastQuickReplies(); len(qr) > 0 {
 		connectMsg["quickReplies"] = qr
+		if seq := bus.OpenPrompt(); seq != 0 {
+			connectMsg["promptSeq"] = seq
+		}
 	} else if len(welcomeReplies) > 0 && !bus.HasHistory() {
 		// Genuinely empty chat: seed welcome replies so the opening state
 		// signals "your turn" instead of looking frozen. Suppressed once any
 		// history exists (including a send_progress-only opening).
 		connectMsg["quickReplies"] = welcomeReplies
 	}
-	conn.WriteJSON(connectMsg)
+	if samplingSession(mcpServerRef) != nil {
+		connectMsg["canAsk"] = true
+	}
+	codec.write(conn, connectMsg)
 
-	// Subscribe to event bus BEFORE streaming history to avoid gaps.
-	sub := bus.Subscribe()
+	// Subscribe to event bus BEFORE streaming history to avoid gaps. This
+	// also announces the tab to the others (viewerJoined).
+	device := deviceHint(r.UserAgent())
+	sub := bus.SubscribeViewer(device)
 	defer bus.Unsubscribe(sub)
+	features, declared := r.URL.Query()["features"]
+	bus.SetFeatures(sub, parseFeatures(strings.Join(features, ","), declared))
 
-	// Stream missed events (seq > cursor) to the client individually.
+	// Stream missed events (seq > cursor) to the client individually. A tab
+	// that pages (the browser UI, ?paged=1) gets only the last historyPage
+	// of a fresh connect and asks for older pages as it scrolls up.
 	missed := bus.EventsSince(cursor)
+	if cursor == 0 && historyPage > 0 && len(missed) > historyPage && r.URL.Query().Get("paged") == "1" {
+		missed = missed[len(missed)-historyPage:]
+		codec.write(conn, map[string]any{"type": "historyTruncated", "before": missed[0].Seq})
+	}
 	for _, event := range missed {
-		data, err := json.Marshal(event)
+		typ, data, err := codec.encode(event)
 		if err != nil {
 			continue
 		}
-		if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		if err := codec.send(conn, typ, data); err != nil {
 			return
 		}
 	}
 	// Signal end of history replay so the client can finalize UI state.
-	conn.WriteJSON(map[string]any{"type": "historyEnd"})
+	codec.write(conn, map[string]any{"type": "historyEnd"})
 
-	// Track the highest seq we've sent so the subscriber loop can skip duplicates.
+	// Track the highest seq we've sent so the subscriber loop can skip
+	// duplicates and notice the events Publish skipped for this tab.
 	highSeq := cursor
 	if len(missed) > 0 {
 		highSeq = missed[len(missed)-1].Seq
@@ -574,6 +1059,18 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	// (e.g. exportRequest) reach this connection.
 	bus.SubscribeTransient(writeCh)
 	defer bus.UnsubscribeTransient(writeCh)
+	// Our own viewerJoined went out before writeCh was registered; send this
+	// tab the current presence directly.
+	writeCh <- bus.Presence("viewerJoined", device)
+	writeCh <- bus.ToolCategories()
+	// Likewise the agents' liveness, rather than leaving the badge blank
+	// until the next heartbeat.
+	for _, ev := range bus.Liveness(stallAfter) {
+		select {
+		case writeCh <- ev:
+		default:
+		}
+	}
 
 	// Forward events to WebSocket client. This goroutine is the SOLE writer to
 	// conn once it starts (gorilla/websocket forbids concurrent writes), so the
@@ -581,38 +1078,55 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	done := make(chan struct{})
 	go func() {
 		defer close(done)
+		defer recoverCrash("websocket writer")
 		ping := time.NewTicker(wsPingPeriod)
 		defer ping.Stop()
-		writeMsg := func(data []byte) bool {
+		writeMsg := func(v any) bool {
+			typ, data, err := codec.encode(v)
+			if err != nil {
+				return true // skip what cannot be encoded
+			}
 			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
-			return conn.WriteMessage(websocket.TextMessage, data) == nil
+			return codec.send(conn, typ, data) == nil
 		}
+		// catchUp sends the events this tab missed, from the history, up to
+		// (not including) seq upto; 0 sends all of them.
+		catchUp := func(upto int64) bool {
+			for _, event := range bus.Missed(sub, highSeq, upto) {
+				if !writeMsg(event) {
+					return false
+				}
+				highSeq = event.Seq
+			}
+			return true
+		}
+		lagged := bus.Lagged(sub)
 		for {
 			select {
 			case event, ok := <-sub:
 				if !ok {
 					return
 				}
-				// Skip events already sent via the history stream.
+				// Skip events already sent via the history stream or catchUp.
 				if event.Seq <= highSeq {
 					continue
 				}
-				data, err := json.Marshal(event)
-				if err != nil {
-					continue
+				if event.Seq > highSeq+1 && !catchUp(event.Seq) {
+					return
+				}
+				if !writeMsg(event) {
+					return
 				}
-				if !writeMsg(data) {
+				highSeq = event.Seq
+			case <-lagged:
+				if !catchUp(0) {
 					return
 				}
 			case msg, ok := <-writeCh:
 				if !ok {
 					return
 				}
-				data, err := json.Marshal(msg)
-				if err != nil {
-					continue
-				}
-				if !writeMsg(data) {
+				if !writeMsg(msg) {
 					return
 				}
 			case <-ping.C:
@@ -638,33 +1152,59 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 			break
 		}
 		var m struct {
-			Type    string    `json:"type"`
-			Text    string    `json:"text"`
-			Files   []FileRef `json:"files"`
-			ID      string    `json:"id"`
-			Message string    `json:"message"`
+			Type     string          `json:"type"`
+			Text     string          `json:"text"`
+			Files    []FileRef       `json:"files"`
+			ID       string          `json:"id"`
+			Message  string          `json:"message"`
+			Session  string          `json:"session"`  // message: the agent session being replied to
+			ReplyTo  int64           `json:"reply_to"` // message: seq of the earlier message being answered; reaction, pin, unpin: the target message
+			Emoji    string          `json:"emoji"`    // reaction
+			Seq      int64           `json:"seq"`      // receipt: highest event seq rendered
+			Seen     bool            `json:"seen"`     // receipt: the tab was visible
+			Before   int64           `json:"before"`   // history: page of events older than this seq
+			Prompt   int64           `json:"prompt"`   // message, ack: seq of the quick replies being answered (see claimPrompt)
+			Location *LocationResult `json:"location"` // location: the answer to request_location ID
+			Info     *ClientInfo     `json:"info"`     // clientInfo: the tab's browser, screen and speech support
+			Paths    []string        `json:"paths"`    // pickFiles: the shared files picked for pick_file ID; none to cancel
+			On       bool            `json:"on"`       // toolCategory: whether the agent may use the category named Text
 		}
 		if json.Unmarshal(msg, &m) != nil {
 			continue
 		}
 		switch m.Type {
 		case "message":
+			m.Files = servedFiles(m.Files)
+			session := bus.ReplySession(m.Session)
+			if (m.Text != "" || len(m.Files) > 0) && !session.claimPrompt(m.Prompt) {
+				// Another tab answered these quick replies first.
+				select {
+				case writeCh <- map[string]any{"type": "promptClosed", "reply_to": m.Prompt}:
+				default:
+				}
+				break
+			}
 			if m.Text != "" || len(m.Files) > 0 {
 				// Check if this is a response to a pending permission prompt.
 				consumed := false
 				if channelInterceptorRef != nil && len(m.Files) == 0 {
 					consumed = channelInterceptorRef.HandleUserResponse(m.Text)
 				}
+				var msgID string // the userMessage's ID, so redact_message finds the promptAnswered copy
 				if consumed {
 					// Permission response handled — broadcast as userMessage for
 					// display, then immediately mark consumed (the message never
 					// hits the agent's queue).
-					bus.PublishConsumedUserMessage(m.Text, nil)
+					msgID = bus.PublishConsumedUserMessage(m.Text, nil)
 				} else {
-					// ReceiveUserMessage publishes the userMessage event BEFORE
+					// Receive publishes the userMessage event BEFORE
 					// queuing so browsers always see the bubble before any
-					// consumption signal that the agent may race-fire.
-					bus.ReceiveUserMessage(m.Text, m.Files)
+					// consumption signal that the agent may race-fire. The
+					// reply goes to the agent session the browser is answering,
+					// tagged with the sender's display name.
+					text, files := attachLongText(m.Text, m.Files)
+					audit.Record(r, auditRecord{Event: "message", Client: client, Bytes: int64(len(text)), Files: len(files)})
+					msgID = session.Receive(UserMessage{Text: text, Files: files, ReplyTo: m.ReplyTo, From: bus.DisplayName(client)})
 					// Notify browser that message is queued — it waits for this
 					// before telling the parent frame to call check_messages.
 					select {
@@ -672,6 +1212,14 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 					default:
 					}
 				}
+				if m.Prompt != 0 {
+					session.Publish(Event{Type: "promptAnswered", ID: msgID, ReplyTo: m.Prompt, Text: m.Text, From: bus.DisplayName(client)})
+				}
+			}
+		case "ask":
+			// "Ask agent": answered via MCP sampling, off the agent's queue.
+			if strings.TrimSpace(m.Text) != "" {
+				go askAgent(context.Background(), mcpServerRef, bus, strings.TrimSpace(m.Text))
 			}
 		case "ack":
 			if m.ID != "" {
@@ -679,11 +1227,97 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 				if m.Message != "" {
 					result = "ack:" + m.Message
 				}
-				bus.ResolveAck(m.ID, result)
+				if !bus.ResolveAck(m.ID, result) {
+					// Already acknowledged, most likely from another tab.
+					select {
+					case writeCh <- map[string]any{"type": "promptClosed", "ack_id": m.ID, "reply_to": m.Prompt}:
+					default:
+					}
+					break
+				}
+				bus.claimPrompt(m.Prompt)
 				// Broadcast ack reply as a userMessage to all browsers; the ack
 				// itself is the "agent received it" signal, so emit consumed
 				// immediately too.
-				bus.PublishConsumedUserMessage(m.Message, nil)
+				msgID := bus.PublishConsumedUserMessage(m.Message, nil)
+				bus.Publish(Event{Type: "promptAnswered", ID: msgID, AckID: m.ID, ReplyTo: m.Prompt, Text: m.Message, From: bus.DisplayName(client)})
+			}
+		case "clientInfo":
+			// The tab describing its environment, for get_client_info.
+			if m.Info != nil {
+				bus.SetClientInfo(sub, *m.Info)
+			}
+		case "location":
+			// A tab answering request_location; the first answer wins.
+			if m.ID == "" || m.Location == nil {
+				break
+			}
+			loc := *m.Location
+			if err := loc.validate(); err != nil {
+				loc = LocationResult{Error: err.Error()}
+			}
+			loc.From = bus.DisplayName(client)
+			if !bus.ResolveLocation(m.ID, loc) {
+				select {
+				case writeCh <- map[string]any{"type": "locationClosed", "request_id": m.ID}:
+				default:
+				}
+			}
+		case "pickFiles":
+			// A tab answering pick_file; the first answer wins.
+			if m.ID == "" {
+				break
+			}
+			if !bus.ResolveFilePick(m.ID, filePick{Paths: m.Paths, From: bus.DisplayName(client)}) {
+				select {
+				case writeCh <- map[string]any{"type": "filePickerClosed", "request_id": m.ID}:
+				default:
+				}
+			}
+		case "reaction":
+			// 👍/👎/❓ on a message: queued for its agent as feedback.
+			if _, err := bus.React(m.ReplyTo, m.Emoji); err != nil {
+				log.Printf("reaction: %v", err)
+			}
+		case "setName":
+			// The user named themself (Text; "" clears it). Echo the
+			// normalized name so the tab can remember it.
+			if client == "" {
+				break
+			}
+			reply := map[string]string{"type": "displayName"}
+			if name, err := bus.SetDisplayName(client, m.Text); err != nil {
+				reply = map[string]string{"type": "displayNameRejected", "message": err.Error()}
+			} else {
+				reply["name"] = name
+			}
+			select {
+			case writeCh <- reply:
+			default:
+			}
+		case "toolCategory":
+			// The user switched a category of tools on or off in the
+			// settings panel; every tab hears the new state.
+			if err := bus.SetToolCategory(m.Text, m.On); err != nil {
+				log.Printf("toolCategory: %v", err)
+			}
+		case "pin", "unpin":
+			if err := bus.Pin(m.ReplyTo, m.Type == "pin"); err != nil {
+				log.Printf("%s: %v", m.Type, err)
+			}
+		case "receipt":
+			// The tab (ID is its stable viewer id) rendered everything up to Seq.
+			if m.ID != "" {
+				bus.Receipt(m.ID, m.Seq, m.Seen)
+			}
+			bus.Acked(sub, m.Seq)
+		case "history":
+			// The tab scrolled up past the events it was sent: the page
+			// before m.Before, and whether there is more.
+			events, more := bus.EventsBefore(m.Before, historyPage)
+			select {
+			case writeCh <- map[string]any{"type": "historyPage", "events": events, "more": more}:
+			case <-done:
 			}
 		case "unsend":
 			// User clicked × on a pending bubble — withdraw it from the queue
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The server cleans the markdown of agent messages as it publishes them,
+// so what reaches the browsers, the event log and every export has already
+// been held to one policy rather than to whatever each client build does.
+// -markdown-allow picks what agent markdown may contain from links,
+// images, tables and html (raw HTML); by default all but raw HTML. Links
+// and images keep only http, https and relative URLs (links also mailto:),
+// whatever the policy. What is not allowed is kept readable, not dropped:
+// a link becomes its text, an image its alt text (or a link to it), a
+// table a code block, an HTML tag inline code. Code spans and fenced code
+// blocks are left as written.
+
+// markdownPolicy is what agent markdown may contain.
+type markdownPolicy struct {
+	Links  bool
+	Images bool
+	Tables bool
+	HTML   bool
+}
+
+// mdPolicy is the -markdown-allow serve flag.
+var mdPolicy = markdownPolicy{Links: true, Images: true, Tables: true}
+
+// parseMarkdownPolicy parses a -markdown-allow list: comma-separated
+// links, images, tables and html, or "none".
+func parseMarkdownPolicy(s string) (markdownPolicy, error) {
+	var p markdownPolicy
+	for _, part := range strings.Split(s, ",") {
+		switch strings.ToLower(strings.TrimSpace(part)) {
+		case "", "none":
+		case "links":
+			p.Links = true
+		case "images":
+			p.Images = true
+		case "tables":
+			p.Tables = true
+		case "html":
+			p.HTML = true
+		default:
+			return markdownPolicy{}, fmt.Errorf("unknown markdown feature %q (want links, images, tables, html or none)", part)
+		}
+	}
+	return p, nil
+}
+
+func (p markdownPolicy) String() string {
+	var parts []string
+	for _, f := range []struct {
+		on   bool
+		name string
+	}{{p.Links, "links"}, {p.Images, "images"}, {p.Tables, "tables"}, {p.HTML, "html"}} {
+		if f.on {
+			parts = append(parts, f.name)
+		}
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ",")
+}
+
+var (
+	mdFence    = regexp.MustCompile("^\\s*(```|~~~)")
+	mdTableSep = regexp.MustCompile(`^\s*\|[-:| ]+\|\s*$`)
+	mdLink     = regexp.MustCompile(`(!?)\[([^\]]*)\]\(([^)\s]+)\)`)
+	mdInline   = regexp.MustCompile(`<!--[\s\S]*?-->|</?[A-Za-z][A-Za-z0-9-]*(?:\s[^<>]*)?/?>|(?i)\bhttps?://[^\s<>()]+`)
+	mdScheme   = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9+.-]*):`)
+)
+
+// sanitize returns text held to p.
+func (p markdownPolicy) sanitize(text string) string {
+	if text == "" {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	out := make([]string, 0, len(lines))
+	fence := ""
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if fence != "" {
+			if m := mdFence.FindStringSubmatch(line); m != nil && m[1] == fence {
+				fence = ""
+			}
+			out = append(out, line)
+			continue
+		}
+		if m := mdFence.FindStringSubmatch(line); m != nil {
+			fence = m[1]
+			out = append(out, line)
+			continue
+		}
+		if !p.Tables && isTableStart(lines, i) {
+			out = append(out, "```")
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), "|"); i++ {
+				out = append(out, lines[i])
+			}
+			out = append(out, "```")
+			i--
+			continue
+		}
+		out = append(out, p.sanitizeLine(line))
+	}
+	return strings.Join(out, "\n")
+}
+
+// isTableStart reports whether lines[i] opens a table: a row of cells
+// followed by a |---|---| separator.
+func isTableStart(lines []string, i int) bool {
+	return i+1 < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), "|") && mdTableSep.MatchString(lines[i+1])
+}
+
+// sanitizeLine applies p to a line outside code blocks, leaving its code
+// spans alone.
+func (p markdownPolicy) sanitizeLine(line string) string {
+	parts := strings.Split(line, "`")
+	for i := 0; i < len(parts); i += 2 {
+		// Odd parts are code spans, unless the last backtick is unpaired.
+		if i == len(parts)-1 && i > 0 && len(parts)%2 == 0 {
+			break
+		}
+		parts[i] = p.sanitizeProse(parts[i])
+	}
+	return strings.Join(parts, "`")
+}
+
+// sanitizeProse applies p to text with no code in it.
+func (p markdownPolicy) sanitizeProse(s string) string {
+	s = mdLink.ReplaceAllStringFunc(s, func(m string) string {
+		g := mdLink.FindStringSubmatch(m)
+		image, label, url := g[1] == "!", g[2], g[3]
+		if image {
+			if p.Images && safeURL(url, false) {
+				return m
+			}
+			if label == "" {
+				label = "image"
+			}
+		}
+		if p.Links && safeURL(url, true) {
+			return "[" + label + "](" + url + ")"
+		}
+		return label
+	})
+	if p.HTML && p.Links {
+		return s
+	}
+	// One pass for both, so a URL inside a tag goes with the tag.
+	return mdInline.ReplaceAllStringFunc(s, func(m string) string {
+		isTag := m[0] == '<'
+		switch {
+		case isTag && p.HTML, !isTag && p.Links:
+			return m
+		case strings.Contains(m, "`"):
+			return ""
+		}
+		return "`" + m + "`"
+	})
+}
+
+// safeURL reports whether a link (or, with link false, an image) may point
+// at url: http, https, relative, and for links mailto.
+func safeURL(url string, link bool) bool {
+	m := mdScheme.FindStringSubmatch(url)
+	if m == nil {
+		return true
+	}
+	switch strings.ToLower(m[1]) {
+	case "http", "https":
+		return true
+	case "mailto":
+		return link
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package main
+
+import "testing"
+
+func TestParseMarkdownPolicy(t *testing.T) {
+	p, err := parseMarkdownPolicy("links, Tables")
+	if err != nil || p != (markdownPolicy{Links: true, Tables: true}) {
+		t.Errorf("got %+v, %v", p, err)
+	}
+	if p.String() != "links,tables" {
+		t.Errorf("String() = %q", p.String())
+	}
+	if p, err := parseMarkdownPolicy("none"); err != nil || p != (markdownPolicy{}) || p.String() != "none" {
+		t.Errorf("none: %+v, %v", p, err)
+	}
+	if _, err := parseMarkdownPolicy("links,scripts"); err == nil {
+		t.Error("unknown feature should be an error")
+	}
+}
+
+func TestMarkdownPolicySanitize(t *testing.T) {
+	def := markdownPolicy{Links: true, Images: true, Tables: true}
+	none := markdownPolicy{}
+	tests := []struct {
+		name string
+		p    markdownPolicy
+		in   string
+		want string
+	}{
+		{"plain text", none, "just **words**", "just **words**"},
+		{"link kept", def, "see [docs](https://x.dev/a)", "see [docs](https://x.dev/a)"},
+		{"javascript link", def, "[click](javascript:void)", "click"},
+		{"link off", none, "see [docs](https://x.dev/a)", "see docs"},
+		{"bare url off", none, "at https://x.dev/a now", "at `https://x.dev/a` now"},
+		{"mailto link", def, "[mail](mailto:a@b.c)", "[mail](mailto:a@b.c)"},
+		{"image kept", def, "![chart](/uploads/c.png)", "![chart](/uploads/c.png)"},
+		{"data image", def, "![x](data:image/svg+xml,abc)", "x"},
+		{"image off becomes link", markdownPolicy{Links: true}, "![chart](/uploads/c.png)", "[chart](/uploads/c.png)"},
+		{"image off no alt", none, "![](/uploads/c.png)", "image"},
+		{"html off", def, `hi <img src=x onerror=alert(1)> there`, "hi `<img src=x onerror=alert(1)>` there"},
+		{"html on", markdownPolicy{Links: true, HTML: true}, "<b>hi</b>", "<b>hi</b>"},
+		{"comment", def, "a <!-- x --> b", "a `<!-- x -->` b"},
+		{"code span", def, "use `<script>` here", "use `<script>` here"},
+		{"fenced code", none, "```\n<script>[a](javascript:x)\n```", "```\n<script>[a](javascript:x)\n```"},
+		{"table off", none, "| a | b |\n|---|---|\n| 1 | 2 |\nafter", "```\n| a | b |\n|---|---|\n| 1 | 2 |\n```\nafter"},
+		{"table on", def, "| a | b |\n|---|---|\n| 1 | 2 |", "| a | b |\n|---|---|\n| 1 | 2 |"},
+	}
+	for _, tt := range tests {
+		if got := tt.p.sanitize(tt.in); got != tt.want {
+			t.Errorf("%s: sanitize(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPublishSanitizesAgentMarkdown(t *testing.T) {
+	bus := NewEventBus()
+	bus.Publish(Event{Type: "agentMessage", Text: "<script>alert(1)</script>"})
+	bus.Publish(Event{Type: "userMessage", Text: "<b>mine</b>"})
+	events := bus.EventsSince(0)
+	if got := events[0].Text; got != "`<script>`alert(1)`</script>`" {
+		t.Errorf("agent message = %q", got)
+	}
+	if got := events[1].Text; got != "<b>mine</b>" {
+		t.Errorf("user message changed: %q", got)
+	}
+}
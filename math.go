@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Agents send formulas as LaTeX with the math parameter of send_message and
+// send_progress. Each block goes into the message text as a ```math fence,
+// so exports, search and pages that cannot typeset still show the source
+// (and GitHub renders an exported .md's fences as math). The event is
+// marked Math, and a page served with -katex-dir typesets its fences with
+// the KaTeX files in that directory, served at /katex/.
+
+// katexDir is the -katex-dir serve flag: a KaTeX dist directory
+// (katex.min.js, katex.min.css and fonts/). Empty leaves math as source.
+var katexDir string
+
+// maxMathBlocks caps the LaTeX blocks one message may carry.
+const maxMathBlocks = 20
+
+var mathFence = regexp.MustCompile("(?m)^\\s*```math\\s*$")
+
+// withMath appends blocks to text as ```math fences, and reports whether
+// the result has any for the UI to typeset.
+func withMath(text string, blocks []string) (string, bool) {
+	n := 0
+	for _, b := range blocks {
+		b = strings.Trim(b, "\n")
+		if strings.TrimSpace(b) == "" || n == maxMathBlocks {
+			continue
+		}
+		// A block cannot close its own fence early.
+		b = strings.ReplaceAll(b, "```", "` ` `")
+		if text != "" {
+			text += "\n\n"
+		}
+		text += "```math\n" + b + "\n```"
+		n++
+	}
+	return text, mathFence.MatchString(text)
+}
+
+// handleKatex serves the -katex-dir files at /katex/.
+func handleKatex(w http.ResponseWriter, r *http.Request) {
+	if katexDir == "" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	http.StripPrefix("/katex/", http.FileServer(http.Dir(katexDir))).ServeHTTP(w, r)
+}
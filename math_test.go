@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWithMath(t *testing.T) {
+	text, math := withMath("The mean:", []string{`\bar x = \frac{1}{n}\sum_i x_i`, "  ", "\nE = mc^2\n"})
+	want := "The mean:\n\n```math\n\\bar x = \\frac{1}{n}\\sum_i x_i\n```\n\n```math\nE = mc^2\n```"
+	if text != want || !math {
+		t.Errorf("got %q, %v", text, math)
+	}
+	if text, math := withMath("no formulas", nil); text != "no formulas" || math {
+		t.Errorf("plain message: %q, %v", text, math)
+	}
+	if text, math := withMath("", []string{"a ``` b"}); text != "```math\na ` ` ` b\n```" || !math {
+		t.Errorf("fence in block: %q, %v", text, math)
+	}
+	if _, math := withMath("written inline\n```math\nx^2\n```", nil); !math {
+		t.Error("a ```math fence in the text should mark the message")
+	}
+	many := make([]string, maxMathBlocks+5)
+	for i := range many {
+		many[i] = "x"
+	}
+	if text, _ := withMath("", many); strings.Count(text, "```math") != maxMathBlocks {
+		t.Errorf("kept %d blocks, want %d", strings.Count(text, "```math"), maxMathBlocks)
+	}
+}
+
+func TestHandleKatex(t *testing.T) {
+	orig := katexDir
+	t.Cleanup(func() { katexDir = orig })
+
+	katexDir = ""
+	rec := httptest.NewRecorder()
+	handleKatex(rec, httptest.NewRequest("GET", "/katex/katex.min.js", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("without -katex-dir: status %d", rec.Code)
+	}
+
+	katexDir = t.TempDir()
+	os.WriteFile(filepath.Join(katexDir, "katex.min.js"), []byte("var katex={};"), 0o644)
+	rec = httptest.NewRecorder()
+	handleKatex(rec, httptest.NewRequest("GET", "/katex/katex.min.js", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "var katex={};" {
+		t.Errorf("status %d, body %q", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Bearer tokens for the HTTP MCP endpoints (-mcp-token, -mcp-token-file or
+// AGENT_CHAT_MCP_TOKEN): once any is configured, a request to /mcp or
+// /mcp/orchestrator from beyond this machine must carry one as
+// "Authorization: Bearer <token>", the way the MCP authorization spec has
+// remote clients authenticate. This is separate from browser pairing: a
+// token lets an MCP client through the pairing gate to /mcp and nowhere
+// else, and a paired browser cookie does not open /mcp. Requests from this
+// machine itself (-single-instance forward, local agents) need no token.
+
+// mcpTokens are the accepted tokens, as SHA-256 digests so comparing them
+// takes the same time whatever the token's length.
+var mcpTokens [][sha256.Size]byte
+
+// addMCPToken accepts token on /mcp.
+func addMCPToken(token string) {
+	token = strings.TrimSpace(token)
+	if token != "" {
+		mcpTokens = append(mcpTokens, sha256.Sum256([]byte(token)))
+	}
+}
+
+// loadMCPTokenFile accepts every token in path, one per line; blank lines
+// and lines starting with # are skipped.
+func loadMCPTokenFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		addMCPToken(line)
+	}
+	return scanner.Err()
+}
+
+// isMCPPath reports whether path is one of the HTTP MCP endpoints.
+func isMCPPath(path string) bool {
+	return path == "/mcp" || strings.HasPrefix(path, "/mcp/")
+}
+
+// bearerToken is the token in r's Authorization header, if any.
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// validMCPToken reports whether token is one of mcpTokens.
+func validMCPToken(token string) bool {
+	if token == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(token))
+	ok := 0
+	for _, t := range mcpTokens {
+		ok |= subtle.ConstantTimeCompare(sum[:], t[:])
+	}
+	return ok == 1
+}
+
+// requireMCPToken gates an MCP endpoint on a bearer token when any are
+// configured.
+func requireMCPToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(mcpTokens) == 0 || isLocalRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token := bearerToken(r)
+		if validMCPToken(token) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		challenge, detail := `Bearer realm="agent-chat"`, "no bearer token"
+		if token != "" {
+			challenge, detail = challenge+`, error="invalid_token"`, "invalid bearer token"
+		}
+		audit.Record(r, auditRecord{Event: "authFailure", Detail: detail})
+		w.Header().Set("WWW-Authenticate", challenge)
+		http.Error(w, "missing or invalid bearer token", http.StatusUnauthorized)
+	})
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRequireMCPToken(t *testing.T) {
+	saved := mcpTokens
+	t.Cleanup(func() { mcpTokens = saved })
+	mcpTokens = nil
+	addMCPToken("s3cret")
+	addMCPToken("  ")
+
+	g := quietPairingGate(t, "")
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", requireMCPToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("mcp")) })))
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("chat")) })
+	h := g.wrap(mux)
+	request := func(path, remote, auth string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", path, nil)
+		r.RemoteAddr, r.Host = remote, "192.168.1.20:4321"
+		if remote == "127.0.0.1:5000" {
+			r.Host = "localhost:4321"
+		}
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	const phone = "192.168.1.9:5000"
+	if w := request("/mcp", phone, ""); w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != `Bearer realm="agent-chat"` {
+		t.Errorf("no token: %d %q", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+	if w := request("/mcp", phone, "Bearer wrong"); w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != `Bearer realm="agent-chat", error="invalid_token"` {
+		t.Errorf("wrong token: %d %q", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+	if w := request("/mcp", phone, "bearer s3cret"); w.Code != http.StatusOK || w.Body.String() != "mcp" {
+		t.Errorf("right token: %d %q", w.Code, w.Body.String())
+	}
+	if w := request("/ws", phone, "Bearer s3cret"); w.Code != http.StatusUnauthorized {
+		t.Errorf("token on the WebSocket: %d, want 401 (tokens only open /mcp)", w.Code)
+	}
+	if w := request("/mcp", "127.0.0.1:5000", ""); w.Code != http.StatusOK {
+		t.Errorf("local request: %d, want 200", w.Code)
+	}
+}
+
+func TestLoadMCPTokenFile(t *testing.T) {
+	saved := mcpTokens
+	t.Cleanup(func() { mcpTokens = saved })
+	mcpTokens = nil
+	path := filepath.Join(t.TempDir(), "tokens")
+	os.WriteFile(path, []byte("# laptop\nalpha\n\n  beta  \n"), 0o600)
+	if err := loadMCPTokenFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if len(mcpTokens) != 2 || !validMCPToken("alpha") || !validMCPToken("beta") || validMCPToken("# laptop") || validMCPToken("") {
+		t.Errorf("tokens from file: %d loaded", len(mcpTokens))
+	}
+	if err := loadMCPTokenFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("missing file accepted")
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// forwardDrainGrace is how long a forwarded client's requests may finish on
+// their own after it exits, before its session is ended.
+const forwardDrainGrace = time.Second
+
+// forwardStdioMCP relays newline-delimited JSON-RPC from in to a running
+// instance's StreamableHTTP endpoint and writes every response back to out —
+// the single-instance "forward" mode, where a second agent-chat hands its
+// stdio client to the server that already owns the project's chat.
+//
+// Each request is POSTed on its own goroutine: a blocking send_message can
+// hold its HTTP response open for hours, and later messages (notably
+// notifications/cancelled) must not queue behind it. Notifications get no
+// reply. A request whose POST fails gets a synthesized JSON-RPC error so the
+// client never waits on an id that will never answer. The Mcp-Session-Id the
+// instance returns from initialize is echoed on every later request, so the
+// forwarded client gets its own agent session instead of sharing the
+// instance owner's reply queue, and is ended with a DELETE once in hits EOF.
+// Returns when in hits EOF and every in-flight request has finished, or
+// when ctx is cancelled.
+func forwardStdioMCP(ctx context.Context, endpoint string, in io.Reader, out io.Writer) error {
+	var outMu sync.Mutex
+	writeLine := func(b []byte) {
+		outMu.Lock()
+		defer outMu.Unlock()
+		out.Write(append(bytes.TrimSpace(b), '\n'))
+	}
+	var sessionMu sync.Mutex
+	sessionID := ""
+
+	var wg sync.WaitGroup
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := append([]byte(nil), scanner.Bytes()...)
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var msg jsonrpcMessage
+		json.Unmarshal(line, &msg)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sessionMu.Lock()
+			sid := sessionID
+			sessionMu.Unlock()
+			replies, newSID, err := postMCP(ctx, endpoint, sid, line)
+			if err != nil {
+				if msg.ID != nil && msg.Method != "" {
+					writeLine(jsonrpcErrorLine(msg.ID, err))
+				}
+				return
+			}
+			if newSID != "" {
+				sessionMu.Lock()
+				sessionID = newSID
+				sessionMu.Unlock()
+			}
+			for _, r := range replies {
+				writeLine(r)
+			}
+		}()
+	}
+
+	// The client is gone. Give requests already in flight a moment to
+	// finish, then end the session: the instance reports the agent
+	// disconnected and releases any call still blocked on a reply.
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(forwardDrainGrace):
+	}
+	sessionMu.Lock()
+	sid := sessionID
+	sessionMu.Unlock()
+	if sid != "" {
+		deleteMCPSession(ctx, endpoint, sid)
+	}
+	<-finished
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// deleteMCPSession ends sessionID at endpoint, as the StreamableHTTP
+// transport specifies for a client that is done. Best effort.
+func deleteMCPSession(ctx context.Context, endpoint, sessionID string) {
+	client, endpoint := httpClientFor(endpoint)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, endpoint, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Mcp-Session-Id", sessionID)
+	if resp, err := client.Do(req); err == nil {
+		resp.Body.Close()
+	}
+}
+
+// postMCP sends one JSON-RPC message to endpoint (tagged with sessionID when
+// non-empty) and returns the messages in the response, which the
+// StreamableHTTP handler delivers either as a single application/json body or
+// as a text/event-stream of `data:` events, plus any Mcp-Session-Id the
+// response assigned.
+func postMCP(ctx context.Context, endpoint, sessionID string, body []byte) ([][]byte, string, error) {
+	client, endpoint := httpClientFor(endpoint)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	if sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", sessionID)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	newSID := resp.Header.Get("Mcp-Session-Id")
+	if resp.StatusCode == http.StatusAccepted || resp.StatusCode == http.StatusNoContent {
+		return nil, newSID, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, "", fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		replies, err := readSSEData(resp.Body)
+		return replies, newSID, err
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, newSID, nil
+	}
+	return [][]byte{data}, newSID, nil
+}
+
+// readSSEData collects the payload of each server-sent event in r. Multi-line
+// data fields are joined with newlines per the SSE spec.
+func readSSEData(r io.Reader) ([][]byte, error) {
+	var out [][]byte
+	var cur []string
+	flush := func() {
+		if len(cur) > 0 {
+			out = append(out, []byte(strings.Join(cur, "\n")))
+			cur = nil
+		}
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			flush()
+		case strings.HasPrefix(line, "data:"):
+			cur = append(cur, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	flush()
+	return out, scanner.Err()
+}
+
+// jsonrpcErrorLine builds an internal-error response for id.
+func jsonrpcErrorLine(id json.RawMessage, err error) []byte {
+	data, _ := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"error": map[string]any{
+			"code":    -32603,
+			"message": "agent-chat forward: " + err.Error(),
+		},
+	})
+	return data
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestForwardStdioMCP(t *testing.T) {
+	server := mcp.NewServer(&mcp.Implementation{Name: "fwd-test", Version: "0"}, nil)
+	type EchoParams struct {
+		Text string `json:"text"`
+	}
+	mcp.AddTool(server, &mcp.Tool{Name: "echo"}, func(ctx context.Context, req *mcp.CallToolRequest, p *EchoParams) (*mcp.CallToolResult, any, error) {
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "echo: " + p.Text}}}, nil, nil
+	})
+	ts := httptest.NewServer(mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return server }, &mcp.StreamableHTTPOptions{Stateless: true}))
+	defer ts.Close()
+
+	in := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"t","version":"0"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`,
+	}, "\n") + "\n"
+	var out bytes.Buffer
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := forwardStdioMCP(ctx, ts.URL, strings.NewReader(in), &out); err != nil {
+		t.Fatalf("forward: %v", err)
+	}
+
+	byID := map[string]map[string]any{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var m map[string]any
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("bad output line %q: %v", line, err)
+		}
+		id, _ := json.Marshal(m["id"])
+		byID[string(id)] = m
+	}
+	if len(byID) != 2 {
+		t.Fatalf("want 2 responses (notification gets none), got %d: %s", len(byID), out.String())
+	}
+	if _, ok := byID["1"]["result"]; !ok {
+		t.Errorf("initialize: no result: %v", byID["1"])
+	}
+	if !strings.Contains(out.String(), "echo: hi") {
+		t.Errorf("tools/call result not relayed: %s", out.String())
+	}
+}
+
+func TestForwardStdioMCPSynthesizesErrorWhenUnreachable(t *testing.T) {
+	ts := httptest.NewServer(nil)
+	url := ts.URL
+	ts.Close()
+
+	var out bytes.Buffer
+	in := `{"jsonrpc":"2.0","id":"a","method":"tools/list"}` + "\n"
+	forwardStdioMCP(context.Background(), url, strings.NewReader(in), &out)
+	var m struct {
+		ID    string `json:"id"`
+		Error struct {
+			Code int `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &m); err != nil {
+		t.Fatalf("want one JSON-RPC error line, got %q: %v", out.String(), err)
+	}
+	if m.ID != "a" || m.Error.Code != -32603 {
+		t.Errorf("got %+v", m)
+	}
+}
+
+// The forwarded client keeps the Mcp-Session-Id assigned at initialize, so the
+// running instance can give it an agent session of its own.
+func TestForwardStdioMCPEchoesSessionID(t *testing.T) {
+	server := mcp.NewServer(&mcp.Implementation{Name: "fwd-test", Version: "0"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "whoami"}, func(ctx context.Context, req *mcp.CallToolRequest, _ *struct{}) (*mcp.CallToolResult, any, error) {
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "key=" + mcpClientKey(req)}}}, nil, nil
+	})
+	handler := mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return server }, &mcp.StreamableHTTPOptions{Stateless: true})
+	deleted := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			deleted <- r.Header.Get("Mcp-Session-Id")
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	// Feed the tool call only after initialize has answered, as a real
+	// client does.
+	pr, pw := io.Pipe()
+	var mu sync.Mutex
+	var out bytes.Buffer
+	output := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return out.String()
+	}
+	done := make(chan error, 1)
+	go func() { done <- forwardStdioMCP(context.Background(), ts.URL, pr, lockedWriter{&mu, &out}) }()
+
+	io.WriteString(pw, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"t","version":"0"}}}`+"\n")
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(output(), `"id":1`) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	io.WriteString(pw, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"whoami","arguments":{}}}`+"\n")
+	pw.Close()
+	<-done
+	got := output()
+	if !strings.Contains(got, `"text":"key=`) {
+		t.Fatalf("no tool result: %s", got)
+	}
+	if strings.Contains(got, `"text":"key="`) {
+		t.Errorf("tool call carried no Mcp-Session-Id: %s", got)
+	}
+	// Once stdin closes, the session is ended for the instance to see.
+	select {
+	case sid := <-deleted:
+		if sid == "" {
+			t.Error("DELETE carried no Mcp-Session-Id")
+		}
+	default:
+		t.Error("session not ended after EOF")
+	}
+}
+
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (l lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
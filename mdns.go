@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// mDNS/DNS-SD advertisement (-mdns): the instance answers multicast DNS
+// queries for _agentchat._tcp.local, so other devices on the LAN can find
+// the chat — by title — without knowing its random port. This is a minimal
+// responder (RFC 6762/6763), just enough to be browsed: PTR, SRV, TXT and A
+// records, announced at startup and withdrawn at shutdown.
+
+const (
+	mdnsService  = "_agentchat._tcp.local."
+	mdnsServices = "_services._dns-sd._udp.local."
+	mdnsTTL      = 120 // seconds
+
+	dnsTypeA   = 1
+	dnsTypePTR = 12
+	dnsTypeTXT = 16
+	dnsTypeSRV = 33
+	dnsTypeANY = 255
+
+	dnsClassIN         = 1
+	dnsClassCacheFlush = 0x8000 // on a unique record: replace, don't add to, cached copies
+	dnsClassUnicast    = 0x8000 // on a question: the asker wants a unicast reply
+)
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// mdnsAdvertiser describes this instance's DNS-SD records.
+type mdnsAdvertiser struct {
+	instance string // full instance name, e.g. "agent-chat myproj (4242)._agentchat._tcp.local."
+	host     string // e.g. "laptop.local."
+	port     int
+	ips      []net.IP
+	txt      func() []string // evaluated per answer, so a retitled chat shows up
+}
+
+// newMDNSAdvertiser builds the records for an instance serving on port.
+func newMDNSAdvertiser(project string, port int, ips []net.IP, txt func() []string) *mdnsAdvertiser {
+	hostname, _ := os.Hostname()
+	hostname, _, _ = strings.Cut(hostname, ".")
+	if hostname == "" {
+		hostname = "agent-chat"
+	}
+	label := fmt.Sprintf("agent-chat %s (%d)", filepath.Base(project), os.Getpid())
+	for len(label) > 63 { // DNS label limit, trimmed on a rune boundary
+		_, size := utf8.DecodeLastRuneInString(label)
+		label = label[:len(label)-size]
+	}
+	return &mdnsAdvertiser{
+		instance: strings.ReplaceAll(label, ".", "\\.") + "." + mdnsService,
+		host:     hostname + ".local.",
+		port:     port,
+		ips:      ips,
+		txt:      txt,
+	}
+}
+
+// lanIPv4s are the addresses advertised in A records: private IPv4s, the
+// ones a LAN peer can connect to.
+func lanIPv4s(addrs []net.Addr) []net.IP {
+	var ips []net.IP
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok {
+			if ip := ipnet.IP.To4(); ip != nil && ip.IsPrivate() {
+				ips = append(ips, ip)
+			}
+		}
+	}
+	return ips
+}
+
+// run answers queries until ctx is cancelled, announcing the service on
+// start and sending a goodbye (TTL 0) on the way out.
+func (m *mdnsAdvertiser) run(ctx context.Context) error {
+	conn, err := net.ListenMulticastUDP("udp4", nil, mdnsGroup)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// Announce twice, a second apart (RFC 6762 §8.3).
+	for i := 0; i < 2; i++ {
+		conn.WriteToUDP(m.response(0, nil, true, mdnsTTL), mdnsGroup)
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+	}
+	go func() {
+		<-ctx.Done()
+		conn.WriteToUDP(m.response(0, nil, true, 0), mdnsGroup)
+		conn.Close()
+	}()
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		id, questions, ok := parseDNSQuery(buf[:n])
+		if !ok {
+			continue
+		}
+		unicast := from.Port != mdnsGroup.Port // a legacy resolver, not an mDNS peer
+		for _, q := range questions {
+			unicast = unicast || q.class&dnsClassUnicast != 0
+		}
+		resp := m.response(id, questions, false, mdnsTTL)
+		if resp == nil {
+			continue
+		}
+		if unicast {
+			conn.WriteToUDP(resp, from)
+		} else {
+			conn.WriteToUDP(resp, mdnsGroup)
+		}
+	}
+}
+
+// dnsQuestion is one entry of a query's question section.
+type dnsQuestion struct {
+	name  string // lower-cased, dot-terminated
+	qtype uint16
+	class uint16
+}
+
+// response answers questions, or announces every record when all is set.
+// Records asked about go in the answer section; the ones a browser will want
+// next (SRV, TXT and A after a PTR) ride along as additional records to save
+// it the round trips. Returns nil when nothing asked about is ours.
+func (m *mdnsAdvertiser) response(id uint16, questions []dnsQuestion, all bool, ttl uint32) []byte {
+	services := dnsRecord(mdnsServices, dnsTypePTR, dnsClassIN, ttl, dnsName(mdnsService))
+	ptr := dnsRecord(mdnsService, dnsTypePTR, dnsClassIN, ttl, dnsName(m.instance))
+	unique := uint16(dnsClassIN | dnsClassCacheFlush)
+	srvData := binary.BigEndian.AppendUint16(nil, 0)    // priority
+	srvData = binary.BigEndian.AppendUint16(srvData, 0) // weight
+	srvData = binary.BigEndian.AppendUint16(srvData, uint16(m.port))
+	srv := dnsRecord(m.instance, dnsTypeSRV, unique, ttl, append(srvData, dnsName(m.host)...))
+	var txtData []byte
+	for _, kv := range m.txt() {
+		if len(kv) > 255 {
+			kv = kv[:255]
+		}
+		txtData = append(txtData, byte(len(kv)))
+		txtData = append(txtData, kv...)
+	}
+	if len(txtData) == 0 {
+		txtData = []byte{0}
+	}
+	txt := dnsRecord(m.instance, dnsTypeTXT, unique, ttl, txtData)
+	var addrs [][]byte
+	for _, ip := range m.ips {
+		addrs = append(addrs, dnsRecord(m.host, dnsTypeA, unique, ttl, ip.To4()))
+	}
+
+	var answers, extra [][]byte
+	if all {
+		answers = append([][]byte{ptr, srv, txt}, addrs...)
+	} else {
+		if asked(questions, mdnsServices, dnsTypePTR) {
+			answers = append(answers, services)
+		}
+		if asked(questions, mdnsService, dnsTypePTR) {
+			answers = append(answers, ptr)
+			extra = append([][]byte{srv, txt}, addrs...)
+		}
+		askedSRV, askedTXT := asked(questions, m.instance, dnsTypeSRV), asked(questions, m.instance, dnsTypeTXT)
+		if askedSRV || askedTXT {
+			extra = slices.Clone(addrs)
+			if askedSRV {
+				answers = append(answers, srv)
+			} else {
+				extra = append([][]byte{srv}, extra...)
+			}
+			if askedTXT {
+				answers = append(answers, txt)
+			} else {
+				extra = append(extra, txt)
+			}
+		}
+		if asked(questions, m.host, dnsTypeA) {
+			answers = append(answers, addrs...)
+		}
+		// Nothing is repeated as additional once it is an answer.
+		extra = slices.DeleteFunc(extra, func(r []byte) bool {
+			return slices.ContainsFunc(answers, func(a []byte) bool { return bytes.Equal(a, r) })
+		})
+	}
+	if len(answers) == 0 {
+		return nil
+	}
+	msg := binary.BigEndian.AppendUint16(nil, id)
+	msg = binary.BigEndian.AppendUint16(msg, 0x8400) // response, authoritative
+	msg = binary.BigEndian.AppendUint16(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len(answers)))
+	msg = binary.BigEndian.AppendUint16(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len(extra)))
+	for _, r := range append(answers, extra...) {
+		msg = append(msg, r...)
+	}
+	return msg
+}
+
+// asked reports whether a question names this record directly.
+func asked(questions []dnsQuestion, name string, qtype uint16) bool {
+	for _, q := range questions {
+		if q.name == strings.ToLower(name) && (q.qtype == qtype || q.qtype == dnsTypeANY) {
+			return true
+		}
+	}
+	return false
+}
+
+// dnsName encodes a dot-terminated name as labels; "\." is a literal dot
+// inside a label. No compression: our messages are small.
+func dnsName(name string) []byte {
+	var out []byte
+	var label []byte
+	for i := 0; i < len(name); i++ {
+		switch {
+		case name[i] == '\\' && i+1 < len(name):
+			i++
+			label = append(label, name[i])
+		case name[i] == '.':
+			out = append(out, byte(len(label)))
+			out = append(out, label...)
+			label = label[:0]
+		default:
+			label = append(label, name[i])
+		}
+	}
+	return append(out, 0)
+}
+
+func dnsRecord(name string, rtype, class uint16, ttl uint32, rdata []byte) []byte {
+	rec := dnsName(name)
+	rec = binary.BigEndian.AppendUint16(rec, rtype)
+	rec = binary.BigEndian.AppendUint16(rec, class)
+	rec = binary.BigEndian.AppendUint32(rec, ttl)
+	rec = binary.BigEndian.AppendUint16(rec, uint16(len(rdata)))
+	return append(rec, rdata...)
+}
+
+// parseDNSQuery returns a query's id and questions; ok is false for
+// responses and malformed packets.
+func parseDNSQuery(msg []byte) (id uint16, questions []dnsQuestion, ok bool) {
+	if len(msg) < 12 || msg[2]&0x80 != 0 {
+		return 0, nil, false
+	}
+	id = binary.BigEndian.Uint16(msg)
+	qdcount := int(binary.BigEndian.Uint16(msg[4:]))
+	off := 12
+	for i := 0; i < qdcount; i++ {
+		name, next, err := readDNSName(msg, off)
+		if err != nil || next+4 > len(msg) {
+			return 0, nil, false
+		}
+		questions = append(questions, dnsQuestion{
+			name:  strings.ToLower(name),
+			qtype: binary.BigEndian.Uint16(msg[next:]),
+			class: binary.BigEndian.Uint16(msg[next+2:]),
+		})
+		off = next + 4
+	}
+	return id, questions, true
+}
+
+// readDNSName decodes the (possibly compressed) name at off and returns it
+// dot-terminated, with dots inside labels escaped, plus the offset after it.
+func readDNSName(msg []byte, off int) (string, int, error) {
+	var b strings.Builder
+	next := -1
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errors.New("name overruns message")
+		}
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			if b.Len() == 0 {
+				b.WriteByte('.')
+			}
+			return b.String(), next, nil
+		case n&0xC0 == 0xC0:
+			if off+1 >= len(msg) || jumps > 10 {
+				return "", 0, errors.New("bad compression pointer")
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3FFF)
+			jumps++
+		default:
+			if off+1+n > len(msg) {
+				return "", 0, errors.New("label overruns message")
+			}
+			b.WriteString(strings.ReplaceAll(string(msg[off+1:off+1+n]), ".", "\\."))
+			b.WriteByte('.')
+			off += 1 + n
+		}
+	}
+}
+
+// startMDNS advertises the running server on the LAN (-mdns). Failure — no
+// multicast-capable interface, port 5353 unavailable — only logs.
+func startMDNS(ctx context.Context, project string, port int) {
+	addrs, _ := net.InterfaceAddrs()
+	ips := lanIPv4s(addrs)
+	if len(ips) == 0 {
+		log.Printf("Warning: mDNS: no LAN address to advertise")
+		return
+	}
+	m := newMDNSAdvertiser(project, port, ips, func() []string {
+		txt := []string{"path=/", "version=" + version, "project=" + filepath.Base(project)}
+		if title := sessionName(); title != "" {
+			txt = append(txt, "title="+title)
+		}
+		return txt
+	})
+	go func() {
+		if err := m.run(ctx); err != nil {
+			log.Printf("Warning: mDNS advertisement stopped: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+)
+
+// dnsQuery builds a query packet with one question per name/type pair.
+func dnsQuery(id uint16, qs ...dnsQuestion) []byte {
+	msg := binary.BigEndian.AppendUint16(nil, id)
+	msg = binary.BigEndian.AppendUint16(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len(qs)))
+	msg = append(msg, 0, 0, 0, 0, 0, 0)
+	for _, q := range qs {
+		msg = append(msg, dnsName(q.name)...)
+		msg = binary.BigEndian.AppendUint16(msg, q.qtype)
+		msg = binary.BigEndian.AppendUint16(msg, q.class)
+	}
+	return msg
+}
+
+type testRR struct {
+	name  string
+	rtype uint16
+	rdata []byte
+}
+
+// parseDNSResponse returns the answer and additional records of msg.
+func parseDNSResponse(t *testing.T, msg []byte) (answers, extra []testRR) {
+	t.Helper()
+	if len(msg) < 12 || msg[2]&0x80 == 0 {
+		t.Fatalf("not a response: % x", msg)
+	}
+	an, ar := int(binary.BigEndian.Uint16(msg[6:])), int(binary.BigEndian.Uint16(msg[10:]))
+	off := 12
+	var rrs []testRR
+	for i := 0; i < an+ar; i++ {
+		name, next, err := readDNSName(msg, off)
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+		rtype := binary.BigEndian.Uint16(msg[next:])
+		rdlen := int(binary.BigEndian.Uint16(msg[next+8:]))
+		rrs = append(rrs, testRR{name, rtype, msg[next+10 : next+10+rdlen]})
+		off = next + 10 + rdlen
+	}
+	if off != len(msg) {
+		t.Fatalf("trailing bytes after %d records", an+ar)
+	}
+	return rrs[:an], rrs[an:]
+}
+
+func testAdvertiser() *mdnsAdvertiser {
+	m := newMDNSAdvertiser("/home/me/my.proj", 4321, []net.IP{net.IPv4(192, 168, 1, 20)}, func() []string {
+		return []string{"path=/", "title=Fix the build"}
+	})
+	m.host = "laptop.local."
+	return m
+}
+
+func TestMDNSBrowse(t *testing.T) {
+	m := testAdvertiser()
+	if !strings.HasPrefix(m.instance, `agent-chat my\.proj (`) || !strings.HasSuffix(m.instance, ")."+mdnsService) {
+		t.Fatalf("instance = %q", m.instance)
+	}
+	id, qs, ok := parseDNSQuery(dnsQuery(7, dnsQuestion{mdnsService, dnsTypePTR, dnsClassIN}))
+	if !ok || id != 7 || len(qs) != 1 {
+		t.Fatalf("parseDNSQuery = %d %v %v", id, qs, ok)
+	}
+	resp := m.response(id, qs, false, mdnsTTL)
+	if binary.BigEndian.Uint16(resp) != 7 {
+		t.Errorf("response id = %d, want 7", binary.BigEndian.Uint16(resp))
+	}
+	answers, extra := parseDNSResponse(t, resp)
+	if len(answers) != 1 || answers[0].rtype != dnsTypePTR {
+		t.Fatalf("answers = %+v, want one PTR", answers)
+	}
+	if target, _, _ := readDNSName(answers[0].rdata, 0); target != m.instance {
+		t.Errorf("PTR target = %q, want %q", target, m.instance)
+	}
+	var sawSRV, sawTXT, sawA bool
+	for _, rr := range extra {
+		switch rr.rtype {
+		case dnsTypeSRV:
+			sawSRV = true
+			if port := binary.BigEndian.Uint16(rr.rdata[4:]); port != 4321 {
+				t.Errorf("SRV port = %d, want 4321", port)
+			}
+			if host, _, _ := readDNSName(rr.rdata, 6); host != "laptop.local." {
+				t.Errorf("SRV target = %q", host)
+			}
+		case dnsTypeTXT:
+			sawTXT = true
+			if !strings.Contains(string(rr.rdata), "\x13title=Fix the build") {
+				t.Errorf("TXT = %q, want the chat title", rr.rdata)
+			}
+		case dnsTypeA:
+			sawA = true
+			if !net.IP(rr.rdata).Equal(net.IPv4(192, 168, 1, 20)) {
+				t.Errorf("A = %v", net.IP(rr.rdata))
+			}
+		}
+	}
+	if !sawSRV || !sawTXT || !sawA {
+		t.Errorf("additional records %+v, want SRV, TXT and A", extra)
+	}
+}
+
+func TestMDNSIgnoresOtherNames(t *testing.T) {
+	m := testAdvertiser()
+	_, qs, _ := parseDNSQuery(dnsQuery(0, dnsQuestion{"_http._tcp.local.", dnsTypePTR, dnsClassIN}))
+	if resp := m.response(0, qs, false, mdnsTTL); resp != nil {
+		t.Errorf("answered a foreign service: % x", resp)
+	}
+	// Responses (QR bit set) are never treated as queries.
+	query := dnsQuery(0, dnsQuestion{mdnsService, dnsTypePTR, dnsClassIN})
+	query[2] |= 0x80
+	if _, _, ok := parseDNSQuery(query); ok {
+		t.Error("parsed a response as a query")
+	}
+}
+
+func TestMDNSDirectQueries(t *testing.T) {
+	m := testAdvertiser()
+	// Names are matched case-insensitively; the QU bit is preserved.
+	_, qs, _ := parseDNSQuery(dnsQuery(0,
+		dnsQuestion{strings.ToUpper(m.host), dnsTypeA, dnsClassIN | dnsClassUnicast},
+		dnsQuestion{m.instance, dnsTypeSRV, dnsClassIN},
+	))
+	if qs[0].class&dnsClassUnicast == 0 {
+		t.Error("QU bit lost")
+	}
+	answers, extra := parseDNSResponse(t, m.response(0, qs, false, mdnsTTL))
+	if len(answers) != 2 || answers[0].rtype != dnsTypeSRV || answers[1].rtype != dnsTypeA {
+		t.Errorf("answers = %+v, want SRV and A", answers)
+	}
+	if len(extra) != 1 || extra[0].rtype != dnsTypeTXT {
+		t.Errorf("additional = %+v, want just TXT", extra)
+	}
+}
+
+func TestMDNSAnnounceAndGoodbye(t *testing.T) {
+	m := testAdvertiser()
+	answers, extra := parseDNSResponse(t, m.response(0, nil, true, mdnsTTL))
+	if len(answers) != 4 || len(extra) != 0 {
+		t.Fatalf("announcement has %d answers, %d additional; want 4, 0", len(answers), len(extra))
+	}
+	// A goodbye is the same records with TTL 0.
+	resp := m.response(0, nil, true, 0)
+	_, next, _ := readDNSName(resp, 12)
+	if ttl := binary.BigEndian.Uint32(resp[next+4:]); ttl != 0 {
+		t.Errorf("goodbye TTL = %d, want 0", ttl)
+	}
+}
+
+func TestReadDNSNameCompression(t *testing.T) {
+	// "local." at 12, then "_agentchat._tcp" + pointer to it.
+	msg := make([]byte, 12)
+	msg = append(msg, dnsName("local.")...)
+	msg = append(msg, 10)
+	msg = append(msg, "_agentchat"...)
+	msg = append(msg, 4)
+	msg = append(msg, "_tcp"...)
+	msg = append(msg, 0xC0, 12)
+	name, next, err := readDNSName(msg, 19)
+	if err != nil || name != mdnsService || next != len(msg) {
+		t.Errorf("readDNSName = %q, %d, %v", name, next, err)
+	}
+	// A pointer loop is an error, not a hang.
+	loop := append(make([]byte, 12), 0xC0, 12)
+	if _, _, err := readDNSName(loop, 12); err == nil {
+		t.Error("pointer loop accepted")
+	}
+}
+
+func TestLANIPv4s(t *testing.T) {
+	addrs := []net.Addr{
+		&net.IPNet{IP: net.IPv4(127, 0, 0, 1), Mask: net.CIDRMask(8, 32)},
+		&net.IPNet{IP: net.IPv4(10, 0, 0, 5), Mask: net.CIDRMask(8, 32)},
+		&net.IPNet{IP: net.ParseIP("fe80::1"), Mask: net.CIDRMask(64, 128)},
+		&net.IPNet{IP: net.IPv4(8, 8, 8, 8), Mask: net.CIDRMask(24, 32)},
+	}
+	ips := lanIPv4s(addrs)
+	if len(ips) != 1 || !ips[0].Equal(net.IPv4(10, 0, 0, 5)) {
+		t.Errorf("lanIPv4s = %v, want [10.0.0.5]", ips)
+	}
+}
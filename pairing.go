@@ -0,0 +1,254 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Pairing (-pairing, implied by -tunnel): once the UI is reachable beyond
+// localhost, a browser that has not been paired must first enter a short
+// code printed on the server's stderr (or fetched by the agent with
+// get_pairing_code). A paired browser gets a signed cookie and is not asked
+// again. Requests from this machine itself — the local browser tab, the
+// subcommands — are never gated.
+
+const (
+	pairingCookieName  = "agent-chat-paired"
+	pairingCodeTTL     = 5 * time.Minute
+	pairingMaxAttempts = 5                   // wrong codes before the current one is discarded
+	pairingCookieTTL   = 30 * 24 * time.Hour // how long a browser stays paired
+)
+
+// pairing is the active gate; nil when pairing is off.
+var pairing *pairingGate
+
+// pairingGate holds the cookie-signing key and the current pairing code.
+type pairingGate struct {
+	key []byte
+
+	mu       sync.Mutex
+	code     string
+	expires  time.Time
+	attempts int
+	announce func(code string, expires time.Time) // tells the operator about a new code
+}
+
+// newPairingGate loads (or creates) the signing key at keyPath, so paired
+// browsers survive a restart. An empty keyPath uses a key that lives only
+// as long as this process.
+func newPairingGate(keyPath string) (*pairingGate, error) {
+	g := &pairingGate{announce: func(code string, expires time.Time) {
+		fmt.Fprintf(os.Stderr, "Pairing code for new browsers: %s (valid until %s)\n", code, expires.Format("15:04"))
+	}}
+	if keyPath != "" {
+		if data, err := os.ReadFile(keyPath); err == nil && len(data) >= 32 {
+			g.key = data
+			return g, nil
+		}
+	}
+	g.key = make([]byte, 32)
+	if _, err := rand.Read(g.key); err != nil {
+		return nil, err
+	}
+	if keyPath != "" {
+		if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(keyPath, g.key, 0600); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// Code returns the current pairing code, minting (and announcing) a new
+// one when there is none or it has expired.
+func (g *pairingGate) Code() (string, time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.code == "" || time.Now().After(g.expires) {
+		n, _ := rand.Int(rand.Reader, big.NewInt(1_000_000))
+		g.code = fmt.Sprintf("%06d", n.Int64())
+		g.expires = time.Now().Add(pairingCodeTTL)
+		g.attempts = 0
+		g.announce(g.code, g.expires)
+	}
+	return g.code, g.expires
+}
+
+// redeem checks a code a browser entered. A correct code is used up; too
+// many wrong ones discard the current code so it cannot be guessed.
+func (g *pairingGate) redeem(code string) bool {
+	code = strings.TrimSpace(code)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.code == "" || time.Now().After(g.expires) {
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(code), []byte(g.code)) == 1 {
+		g.code = ""
+		return true
+	}
+	g.attempts++
+	if g.attempts >= pairingMaxAttempts {
+		g.code = ""
+	}
+	return false
+}
+
+// cookieValue is a fresh signed client token: "<id>.<hmac(id)>".
+func (g *pairingGate) cookieValue() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	idHex := hex.EncodeToString(id)
+	return idHex + "." + g.sign(idHex)
+}
+
+func (g *pairingGate) sign(id string) string {
+	mac := hmac.New(sha256.New, g.key)
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// paired reports whether r carries a cookie this gate signed.
+func (g *pairingGate) paired(r *http.Request) bool {
+	c, err := r.Cookie(pairingCookieName)
+	if err != nil {
+		return false
+	}
+	id, sig, ok := strings.Cut(c.Value, ".")
+	return ok && id != "" && hmac.Equal([]byte(sig), []byte(g.sign(id)))
+}
+
+// isLocalRequest reports whether r comes straight from this machine: a
+// loopback peer addressing a loopback host, with no proxy in between.
+// Tunnels and reverse proxies connect from loopback too, but they forward
+// the public Host or add forwarding headers.
+func isLocalRequest(r *http.Request) bool {
+	if r.RemoteAddr != "" && r.RemoteAddr != "@" { // "" or "@": a Unix socket peer, local by definition
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return false
+		}
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			return false
+		}
+	}
+	for _, h := range []string{"X-Forwarded-For", "X-Forwarded-Host", "Forwarded", "X-Real-Ip", "Cf-Connecting-Ip"} {
+		if r.Header.Get(h) != "" {
+			return false
+		}
+	}
+	name := r.Host
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		name = h
+	}
+	if name == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(name)
+	return ip != nil && ip.IsLoopback()
+}
+
+// wrap gates next: local and paired requests pass, /pair is always
+// reachable, the page itself redirects to /pair, and anything else —
+// the WebSocket, the API, /mcp — is refused. With -mcp-token, /mcp is left
+// to its bearer-token check.
+func (g *pairingGate) wrap(next http.Handler) http.Handler {
+	if g == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/pair":
+			g.handlePair(w, r)
+		case len(mcpTokens) > 0 && isMCPPath(r.URL.Path):
+			next.ServeHTTP(w, r) // requireMCPToken checks the bearer token instead
+		case isLocalRequest(r) || g.paired(r):
+			next.ServeHTTP(w, r)
+		case r.URL.Path == "/" || r.URL.Path == "/index.html":
+			relativeRedirect(w, "./pair")
+		default:
+			audit.Record(r, auditRecord{Event: "authFailure", Detail: "not paired"})
+			http.Error(w, "this browser is not paired: open /pair", http.StatusUnauthorized)
+		}
+	})
+}
+
+// handlePair serves the pairing form (GET) and checks a submitted code
+// (POST), setting the cookie and returning to the chat on success.
+func (g *pairingGate) handlePair(w http.ResponseWriter, r *http.Request) {
+	msg := "Enter the pairing code shown where agent-chat is running."
+	switch r.Method {
+	case http.MethodGet:
+		g.Code() // make sure there is a code to enter
+	case http.MethodPost:
+		if g.redeem(r.FormValue("code")) {
+			http.SetCookie(w, &http.Cookie{
+				Name:     pairingCookieName,
+				Value:    g.cookieValue(),
+				Path:     "/",
+				MaxAge:   int(pairingCookieTTL / time.Second),
+				HttpOnly: true,
+				Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+				SameSite: http.SameSiteLaxMode,
+			})
+			relativeRedirect(w, "./")
+			return
+		}
+		audit.Record(r, auditRecord{Event: "authFailure", Detail: "wrong pairing code"})
+		w.WriteHeader(http.StatusForbidden)
+		msg = "That code is wrong or has expired. Check for a new one where agent-chat is running."
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintf(w, pairPage, html.EscapeString(pageBranding.pageTitle()), html.EscapeString(msg))
+}
+
+// relativeRedirect redirects to a path relative to the current one. Unlike
+// http.Redirect it leaves the path relative, so it still resolves under a
+// reverse-proxy prefix.
+func relativeRedirect(w http.ResponseWriter, location string) {
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusSeeOther)
+}
+
+const pairPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Pair · %[1]s</title>
+<style>
+body { font-family: system-ui, sans-serif; display: flex; min-height: 100vh; margin: 0; align-items: center; justify-content: center; }
+form { display: flex; flex-direction: column; gap: 12px; max-width: 320px; padding: 24px; text-align: center; }
+input { font-size: 28px; letter-spacing: 6px; text-align: center; padding: 8px; }
+button { font-size: 16px; padding: 10px; }
+</style>
+</head>
+<body>
+<form method="post" action="./pair">
+<h1>%[1]s</h1>
+<p>%[2]s</p>
+<input name="code" inputmode="numeric" autocomplete="one-time-code" maxlength="6" autofocus required>
+<button type="submit">Pair this browser</button>
+</form>
+</body>
+</html>
+`
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func quietPairingGate(t *testing.T, keyPath string) *pairingGate {
+	t.Helper()
+	g, err := newPairingGate(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.announce = func(string, time.Time) {}
+	return g
+}
+
+func TestIsLocalRequest(t *testing.T) {
+	cases := []struct {
+		remote, host, header string
+		want                 bool
+	}{
+		{"127.0.0.1:5000", "localhost:4321", "", true},
+		{"[::1]:5000", "127.0.0.1:4321", "", true},
+		{"192.168.1.9:5000", "192.168.1.20:4321", "", false},           // a phone on the LAN
+		{"127.0.0.1:5000", "quiet-fox.trycloudflare.com", "", false},   // a tunnel keeps the public Host
+		{"127.0.0.1:5000", "localhost:4321", "X-Forwarded-For", false}, // a proxy that rewrites Host
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr, r.Host = c.remote, c.host
+		if c.header != "" {
+			r.Header.Set(c.header, "203.0.113.7")
+		}
+		if got := isLocalRequest(r); got != c.want {
+			t.Errorf("isLocalRequest(%s → %s, %q) = %v, want %v", c.remote, c.host, c.header, got, c.want)
+		}
+	}
+}
+
+func TestPairingGate(t *testing.T) {
+	g := quietPairingGate(t, "")
+	h := g.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("chat")) }))
+	remote := func(method, path string, body url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+		var r *http.Request
+		if body != nil {
+			r = httptest.NewRequest(method, path, strings.NewReader(body.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			r = httptest.NewRequest(method, path, nil)
+		}
+		r.RemoteAddr, r.Host = "192.168.1.9:5000", "192.168.1.20:4321"
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := remote("GET", "/", nil, nil); w.Code != http.StatusSeeOther || w.Header().Get("Location") != "./pair" {
+		t.Errorf("unpaired page: %d → %q, want a redirect to ./pair", w.Code, w.Header().Get("Location"))
+	}
+	if w := remote("GET", "/ws", nil, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("unpaired WebSocket: %d, want 401", w.Code)
+	}
+	if w := remote("GET", "/pair", nil, nil); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `name="code"`) {
+		t.Errorf("pair form: %d %q", w.Code, w.Body.String())
+	}
+	if w := remote("POST", "/pair", url.Values{"code": {"not-it"}}, nil); w.Code != http.StatusForbidden {
+		t.Errorf("wrong code: %d, want 403", w.Code)
+	}
+
+	code, _ := g.Code()
+	w := remote("POST", "/pair", url.Values{"code": {code}}, nil)
+	cookies := w.Result().Cookies()
+	if w.Code != http.StatusSeeOther || len(cookies) != 1 || !cookies[0].HttpOnly {
+		t.Fatalf("right code: %d, cookies %v", w.Code, cookies)
+	}
+	if w := remote("GET", "/ws", nil, cookies[0]); w.Code != http.StatusOK || w.Body.String() != "chat" {
+		t.Errorf("paired WebSocket: %d %q", w.Code, w.Body.String())
+	}
+	forged := &http.Cookie{Name: pairingCookieName, Value: "abcd." + strings.Repeat("0", 64)}
+	if w := remote("GET", "/ws", nil, forged); w.Code != http.StatusUnauthorized {
+		t.Errorf("forged cookie: %d, want 401", w.Code)
+	}
+	// Codes are single-use.
+	if g.redeem(code) {
+		t.Error("a redeemed code worked twice")
+	}
+}
+
+func TestPairingCodeGuessing(t *testing.T) {
+	g := quietPairingGate(t, "")
+	code, _ := g.Code()
+	for i := 0; i < pairingMaxAttempts; i++ {
+		g.redeem("x")
+	}
+	if g.redeem(code) {
+		t.Error("the code survived too many wrong guesses")
+	}
+	if next, _ := g.Code(); next == "" {
+		t.Error("no new code after the old one was discarded")
+	}
+}
+
+func TestPairingKeyPersists(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "pairing.key")
+	first := quietPairingGate(t, keyPath)
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: pairingCookieName, Value: first.cookieValue()})
+	if second := quietPairingGate(t, keyPath); !second.paired(r) {
+		t.Error("a browser paired before a restart is no longer paired")
+	}
+	if other := quietPairingGate(t, ""); other.paired(r) {
+		t.Error("a cookie signed with another key was accepted")
+	}
+}
+
+func TestGetPairingCodeTool(t *testing.T) {
+	eb := NewEventBus()
+	if _, isErr := callTool(t, eb, "get_pairing_code", nil); !isErr {
+		t.Error("get_pairing_code succeeded with pairing off")
+	}
+	pairing = quietPairingGate(t, "")
+	defer func() { pairing = nil }()
+	got, isErr := callTool(t, eb, "get_pairing_code", nil)
+	var res struct {
+		Code    string `json:"code"`
+		Expires int64  `json:"expires"`
+	}
+	if isErr || json.Unmarshal([]byte(got), &res) != nil || len(res.Code) != 6 || res.Expires <= time.Now().UnixMilli() {
+		t.Errorf("get_pairing_code = %q (error %v)", got, isErr)
+	}
+	if code, _ := pairing.Code(); code != res.Code {
+		t.Errorf("tool code %q != current code %q", res.Code, code)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// pasteLimit is the -paste-limit serve flag: a user message longer than this
+// many bytes (a pasted log, a stack trace) is saved as a .txt upload, and the
+// message carries a short preview and the file instead, so the event log and
+// the agent's check_messages result stay small. 0 keeps every message inline.
+var pasteLimit = 20000
+
+// pastePreviewRunes is how much of a long message stays in the chat.
+const pastePreviewRunes = 500
+
+// attachLongText moves the text of an over-long message into a .txt upload
+// and returns a preview of it, with the upload appended to files. Text
+// within pasteLimit, or that cannot be saved, is returned as is.
+func attachLongText(text string, files []FileRef) (string, []FileRef) {
+	if pasteLimit <= 0 || len(text) <= pasteLimit {
+		return text, files
+	}
+	name := "pasted-" + time.Now().Format("20060102-150405") + ".txt"
+	savedName := uuid.New().String()[:8] + "-" + name
+	path := filepath.Join(uploadDir, savedName)
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		log.Printf("agent-chat: could not save a long message as an attachment, keeping it inline: %v", err)
+		return text, files
+	}
+	ref := FileRef{Name: name, Path: path, URL: "/uploads/" + savedName, Size: int64(len(text)), Type: "text/plain"}
+	return pastePreview(text), append(files[:len(files):len(files)], ref)
+}
+
+// pastePreview is the start of text, cut at a line break where one is near,
+// and a note of how much was moved to the attachment.
+func pastePreview(text string) string {
+	preview := text
+	if r := []rune(text); len(r) > pastePreviewRunes {
+		preview = string(r[:pastePreviewRunes])
+		if i := strings.LastIndexByte(preview, '\n'); i > len(preview)/2 {
+			preview = preview[:i]
+		}
+	}
+	lines := strings.Count(strings.TrimRight(text, "\n"), "\n") + 1
+	return fmt.Sprintf("%s…\n\n📎 Long message (%d lines, %s) attached in full.", strings.TrimRight(preview, "\n"), lines, formatSize(int64(len(text))))
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/choonkeat/agent-chat/pkg/client"
+)
+
+func TestAttachLongText(t *testing.T) {
+	origDir, origLimit := uploadDir, pasteLimit
+	uploadDir, pasteLimit = t.TempDir(), 100
+	t.Cleanup(func() { uploadDir, pasteLimit = origDir, origLimit })
+
+	if text, files := attachLongText("short", nil); text != "short" || files != nil {
+		t.Errorf("short message changed: %q %v", text, files)
+	}
+
+	long := "panic: boom\n" + strings.Repeat("goroutine 1 [running]:\n", 50)
+	shot := []FileRef{{Name: "shot.png"}}
+	text, files := attachLongText(long, shot)
+	if len(files) != 2 || files[1].Type != "text/plain" || files[1].Size != int64(len(long)) || len(shot) != 1 {
+		t.Fatalf("files = %+v", files)
+	}
+	if !strings.HasPrefix(text, "panic: boom\n") || !strings.Contains(text, "(51 lines, 1KB) attached in full") || len(text) >= len(long) {
+		t.Errorf("preview = %q", text)
+	}
+	if data, err := os.ReadFile(files[1].Path); err != nil || string(data) != long {
+		t.Errorf("attachment: %v, %d bytes", err, len(data))
+	}
+
+	pasteLimit = 0
+	if text, _ := attachLongText(long, nil); text != long {
+		t.Error("-paste-limit 0 should keep messages inline")
+	}
+}
+
+func TestLongMessageOverWebSocket(t *testing.T) {
+	origDir, origLimit := uploadDir, pasteLimit
+	uploadDir, pasteLimit = t.TempDir(), 1000
+	t.Cleanup(func() { uploadDir, pasteLimit = origDir, origLimit })
+
+	base := startWSServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := client.Dial(ctx, base, client.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	waitType(t, ctx, c, "historyEnd")
+
+	if err := c.Send(strings.Repeat("log line\n", 500)); err != nil {
+		t.Fatal(err)
+	}
+	f := waitType(t, ctx, c, "userMessage")
+	if len(f.Text) > 1000 || len(f.Files) != 1 || !strings.HasSuffix(f.Files[0].Name, ".txt") {
+		t.Errorf("userMessage = %d bytes of text, files %+v", len(f.Text), f.Files)
+	}
+}
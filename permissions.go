@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// permissionPolicy decides which Claude Code permission prompts are relayed
+// to the chat and how long a relayed one waits for an answer. A prompt that
+// is not relayed is left to Claude Code's own terminal dialog.
+type permissionPolicy struct {
+	Include []permissionRule // relayed even when an Exclude rule matches
+	Exclude []permissionRule // not relayed
+	Timeout time.Duration    // deny a relayed prompt left unanswered this long; 0 waits forever
+}
+
+// permissionRule matches a permission request by tool name, and optionally
+// by a regexp over its description and input preview. Written "Tool" or
+// "Tool:regexp"; "*" matches any tool.
+type permissionRule struct {
+	tool   string
+	detail *regexp.Regexp
+}
+
+// parsePermissionRule parses one -permission-include/-exclude value.
+func parsePermissionRule(s string) (permissionRule, error) {
+	tool, pattern, hasPattern := strings.Cut(s, ":")
+	tool = strings.TrimSpace(tool)
+	if tool == "" {
+		return permissionRule{}, fmt.Errorf("rule %q: missing tool name (use * for any tool)", s)
+	}
+	r := permissionRule{tool: tool}
+	if hasPattern {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return permissionRule{}, fmt.Errorf("rule %q: %w", s, err)
+		}
+		r.detail = re
+	}
+	return r, nil
+}
+
+func (r permissionRule) matches(req PermissionRequest) bool {
+	if r.tool != "*" && !strings.EqualFold(r.tool, req.ToolName) {
+		return false
+	}
+	return r.detail == nil || r.detail.MatchString(req.Description+"\n"+req.InputPreview)
+}
+
+// relays reports whether req should be shown in the chat: yes unless an
+// Exclude rule matches it and no Include rule does.
+func (p permissionPolicy) relays(req PermissionRequest) bool {
+	for _, r := range p.Include {
+		if r.matches(req) {
+			return true
+		}
+	}
+	for _, r := range p.Exclude {
+		if r.matches(req) {
+			return false
+		}
+	}
+	return true
+}
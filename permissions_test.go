@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestPermissionPolicyRelays(t *testing.T) {
+	rule := func(s string) permissionRule {
+		t.Helper()
+		r, err := parsePermissionRule(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	p := permissionPolicy{
+		Exclude: []permissionRule{rule("read"), rule("Glob"), rule("*:^Fetch ")},
+		Include: []permissionRule{rule(`Bash:rm\s`)},
+	}
+	cases := []struct {
+		req  PermissionRequest
+		want bool
+	}{
+		{PermissionRequest{ToolName: "Read"}, false},
+		{PermissionRequest{ToolName: "Glob"}, false},
+		{PermissionRequest{ToolName: "WebFetch", Description: "Fetch https://example.com"}, false},
+		{PermissionRequest{ToolName: "Bash", InputPreview: `{"command":"ls"}`}, true},
+		{PermissionRequest{ToolName: "Write"}, true},
+	}
+	for _, c := range cases {
+		if got := p.relays(c.req); got != c.want {
+			t.Errorf("relays(%+v) = %v, want %v", c.req, got, c.want)
+		}
+	}
+
+	// Include wins over a catch-all exclude.
+	only := permissionPolicy{Exclude: []permissionRule{rule("*")}, Include: []permissionRule{rule("Bash")}}
+	if !only.relays(PermissionRequest{ToolName: "Bash"}) || only.relays(PermissionRequest{ToolName: "Edit"}) {
+		t.Error("-permission-exclude '*' -permission-include Bash should relay only Bash")
+	}
+
+	for _, bad := range []string{"", ":x", "Bash:("} {
+		if _, err := parsePermissionRule(bad); err == nil {
+			t.Errorf("parsePermissionRule(%q) accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// pinItem is one pinned message as reported by get_pins.
+type pinItem struct {
+	Seq     int64  `json:"seq"`
+	Type    string `json:"type"`
+	Ts      int64  `json:"ts,omitempty"`
+	Session string `json:"session,omitempty"`
+	Text    string `json:"text"` // excerpt, as quoted in replies
+}
+
+// Pin pins (pin=true) or unpins the message with seq target by publishing a
+// "pinned" or "unpinned" event. Pins are part of the event log, so they
+// survive restarts and replay to reconnecting browsers like everything else.
+// Pinning a pinned message (or unpinning an unpinned one) is a no-op.
+func (eb *EventBus) Pin(target int64, pin bool) error {
+	e, ok := eb.eventAt(target)
+	if !ok {
+		return fmt.Errorf("no message #%d", target)
+	}
+	if _, ok := quoteEvent(e); !ok {
+		return fmt.Errorf("#%d is not a message", target)
+	}
+	pinned := false
+	for _, p := range eb.Pins() {
+		if p.Seq == target {
+			pinned = true
+		}
+	}
+	if pinned == pin {
+		return nil
+	}
+	typ := "unpinned"
+	if pin {
+		typ = "pinned"
+	}
+	eb.Publish(Event{Type: typ, ReplyTo: target})
+	return nil
+}
+
+// Pins returns the currently pinned messages, in the order they were pinned.
+func (eb *EventBus) Pins() []Event {
+	events, _ := eb.History()
+	return pinnedEvents(events)
+}
+
+// pinnedEvents replays the pinned/unpinned events in a log and returns the
+// messages still pinned at its end, in pin order. Unsent messages drop out.
+func pinnedEvents(events []Event) []Event {
+	events = withoutWithdrawn(events)
+	bySeq := make(map[int64]Event)
+	var order []int64
+	pinned := make(map[int64]bool)
+	for _, e := range events {
+		switch e.Type {
+		case "pinned":
+			if !pinned[e.ReplyTo] {
+				pinned[e.ReplyTo] = true
+				order = append(order, e.ReplyTo)
+			}
+		case "unpinned":
+			delete(pinned, e.ReplyTo)
+		default:
+			if _, ok := quoteEvent(e); ok {
+				bySeq[e.Seq] = e
+			}
+		}
+	}
+	var out []Event
+	for _, seq := range order {
+		if e, ok := bySeq[seq]; ok && pinned[seq] {
+			out = append(out, e)
+			delete(pinned, seq) // re-pinned after an unpin: listed once
+		}
+	}
+	return out
+}
+
+// pinItems flattens pinned messages for get_pins.
+func pinItems(pins []Event) []pinItem {
+	items := []pinItem{}
+	for _, e := range pins {
+		text, _ := quoteEvent(e)
+		items = append(items, pinItem{Seq: e.Seq, Type: e.Type, Ts: e.Timestamp, Session: e.Session, Text: text})
+	}
+	return items
+}
+
+// pinRole labels a pinned message by who sent it.
+func pinRole(e Event) string {
+	if e.Type == "userMessage" {
+		return userRole(e)
+	}
+	return agentRole(e)
+}
+
+// pinsMarkdown is the "Pinned" block at the top of a markdown export, or ""
+// when nothing is pinned. The marker line starts with 📌 so the archive
+// viewer never mistakes it for a `**ROLE**` turn.
+func pinsMarkdown(events []Event) string {
+	pins := pinnedEvents(events)
+	if len(pins) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("📌 **Pinned**\n\n")
+	for _, e := range pins {
+		text, _ := quoteEvent(e)
+		fmt.Fprintf(&b, "- %s: %s\n", pinRole(e), text)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// pinsHTML is the pinned-messages box at the top of an HTML transcript.
+func pinsHTML(events []Event) string {
+	pins := pinnedEvents(events)
+	if len(pins) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("<div class=\"pins\">\n<div class=\"who\">📌 PINNED</div>\n<ul>\n")
+	for _, e := range pins {
+		text, _ := quoteEvent(e)
+		fmt.Fprintf(&b, "<li><b>%s</b>: %s</li>\n", html.EscapeString(pinRole(e)), html.EscapeString(text))
+	}
+	b.WriteString("</ul>\n</div>\n")
+	return b.String()
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPinAndUnpin(t *testing.T) {
+	eb := NewEventBus()
+	eb.Publish(Event{Type: "agentMessage", Text: "Use port 8080"})
+	eb.ReceiveUserMessage("ship it on friday", nil)
+	eb.Publish(Event{Type: "toolMarker"})
+
+	if err := eb.Pin(2, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := eb.Pin(1, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := eb.Pin(1, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := eb.Pin(3, true); err == nil {
+		t.Error("pinned a marker")
+	}
+	if err := eb.Pin(99, true); err == nil {
+		t.Error("pinned a missing message")
+	}
+	if n := len(eb.EventsSince(3)); n != 2 {
+		t.Errorf("repeat pin published an event: %d pin events", n)
+	}
+
+	pins := eb.Pins()
+	if len(pins) != 2 || pins[0].Seq != 2 || pins[1].Seq != 1 {
+		t.Fatalf("pins = %+v", pins)
+	}
+
+	if err := eb.Pin(2, false); err != nil {
+		t.Fatal(err)
+	}
+	if pins := eb.Pins(); len(pins) != 1 || pins[0].Seq != 1 {
+		t.Errorf("after unpin: %+v", pins)
+	}
+}
+
+func TestPinnedEventsDropWithdrawn(t *testing.T) {
+	eb := NewEventBus()
+	id := eb.ReceiveUserMessage("oops", nil)
+	eb.Pin(1, true)
+	eb.Publish(Event{Type: "userMessageDeleted", ID: id})
+	if pins := eb.Pins(); len(pins) != 0 {
+		t.Errorf("withdrawn message still pinned: %+v", pins)
+	}
+}
+
+func TestPinTools(t *testing.T) {
+	eb := NewEventBus()
+	eb.Publish(Event{Type: "agentMessage", Text: "Token is in .env.local"})
+
+	if got, isErr := callTool(t, eb, "pin_message", map[string]any{"seq": 1}); isErr || got != "Pinned #1." {
+		t.Fatalf("pin_message = %q (error %v)", got, isErr)
+	}
+	if _, isErr := callTool(t, eb, "pin_message", map[string]any{"seq": 5}); !isErr {
+		t.Error("pinning a missing message succeeded")
+	}
+
+	got, _ := callTool(t, eb, "get_pins", nil)
+	var items []pinItem
+	if err := json.Unmarshal([]byte(got), &items); err != nil {
+		t.Fatalf("get_pins = %q: %v", got, err)
+	}
+	if len(items) != 1 || items[0].Seq != 1 || items[0].Type != "agentMessage" || items[0].Text != "Token is in .env.local" {
+		t.Errorf("items = %+v", items)
+	}
+
+	callTool(t, eb, "pin_message", map[string]any{"seq": 1, "unpin": true})
+	if got, _ := callTool(t, eb, "get_pins", nil); got != "[]" {
+		t.Errorf("get_pins after unpin = %q", got)
+	}
+}
+
+func TestExportsLeadWithPins(t *testing.T) {
+	eb := NewEventBus()
+	eb.Publish(Event{Type: "agentMessage", Text: "Use port 8080", Agent: &AgentIdentity{Name: "Builder"}})
+	eb.Pin(1, true)
+	events, _ := eb.History()
+
+	md := renderTranscriptMarkdown(events, chatExportMeta{}, nil)
+	pinAt := strings.Index(md, "📌 **Pinned**\n\n- AGENT · Builder: Use port 8080\n")
+	turnAt := strings.Index(md, "**AGENT · Builder**")
+	if pinAt == -1 || turnAt == -1 || pinAt > turnAt {
+		t.Errorf("markdown export does not lead with pins:\n%s", md)
+	}
+
+	page := renderTranscriptHTML(events, "t", time.Now(), nil)
+	if !strings.Contains(page, `<div class="pins">`) || !strings.Contains(page, "<li><b>AGENT · Builder</b>: Use port 8080</li>") {
+		t.Errorf("HTML export has no pins section")
+	}
+
+	if got := pinsMarkdown(events[:1]); got != "" {
+		t.Errorf("pins section without pins: %q", got)
+	}
+}
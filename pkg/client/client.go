@@ -0,0 +1,355 @@
+// Package client speaks agent-chat's browser WebSocket protocol, so a Go
+// program can join a chat the way a browser tab does: read the event
+// stream, resume from a cursor after a reconnect, and send messages, acks
+// and reactions. It is meant for headless "fake users" in end-to-end tests
+// of an agent, and for bots that sit in a chat.
+//
+//	c, err := client.Dial(ctx, "http://localhost:4321", client.Options{})
+//	...
+//	c.Send("run the tests")
+//	f, err := c.WaitFor(ctx, func(f client.Frame) bool { return f.Type == "agentMessage" })
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/choonkeat/agent-chat/pkg/wire"
+	"github.com/gorilla/websocket"
+)
+
+// Options tune the connection.
+type Options struct {
+	// Cursor is the highest event seq already seen: the server replays only
+	// later events. 0 replays the whole chat. Pass a previous Client's
+	// Cursor() to resume after a reconnect without duplicates.
+	Cursor int64
+
+	// ClientID is a stable id for this participant, and Name its display
+	// name, shown on its messages. Both optional.
+	ClientID string
+	Name     string
+
+	// Header is sent with the handshake, e.g. the pairing cookie for a chat
+	// served with -pairing to a non-local client.
+	Header http.Header
+
+	// Features are the features this client renders, declared to the server
+	// (e.g. "draw", "countdown") so agents' tools can fall back for what it
+	// cannot show. Nil declares nothing: the server assumes the basics a
+	// page had before features were declared.
+	Features []string
+
+	// Msgpack asks for MessagePack binary frames, as the browser does:
+	// smaller for drawing-heavy chats. Frames decode the same either way
+	// (Raw is always JSON), and a server that declines sends JSON.
+	Msgpack bool
+}
+
+// WebSocket subprotocols, as the server names them.
+const (
+	ProtocolMsgpack = "agent-chat.msgpack"
+	ProtocolJSON    = "agent-chat.json"
+)
+
+// Connected is the server's handshake frame.
+type Connected struct {
+	Version      string   `json:"version"`
+	PendingAckID string   `json:"pendingAckId,omitempty"` // an ack the agent is blocked on
+	QuickReplies []string `json:"quickReplies,omitempty"` // the replies currently offered
+	PromptSeq    int64    `json:"promptSeq,omitempty"`    // seq of the event offering QuickReplies, while unanswered
+	CanAsk       bool     `json:"canAsk,omitempty"`       // "Ask agent" is available
+}
+
+// Frame is one message from the server. Chat events from the log (Seq > 0:
+// agentMessage, userMessage, draw, ...) decode fully into the embedded
+// Event; transient frames (historyEnd, messageQueued, viewer presence,
+// receipts, ...) carry only Type there, with the payload in Raw.
+type Frame struct {
+	wire.Event
+	Raw json.RawMessage
+}
+
+// Logged reports whether f is a chat event from the log, as opposed to a
+// transient notification.
+func (f Frame) Logged() bool { return f.Seq > 0 }
+
+// Client is one connection to a chat. Reads (Next, WaitFor) are meant for a
+// single goroutine; sends may come from any. Keep reading: a client that
+// stops draining frames also stops answering the server's keepalive pings,
+// and is dropped after a minute.
+type Client struct {
+	conn      *websocket.Conn
+	connected Connected
+
+	writeMu   sync.Mutex
+	frames    chan Frame
+	readErr   error // set before frames is closed
+	done      chan struct{}
+	closeOnce sync.Once
+
+	cursorMu sync.Mutex
+	cursor   int64
+}
+
+// Dial connects to the chat served at baseURL (an instance URL as printed
+// at startup or by `agent-chat list`: http://, https://, or http+unix://
+// for a Unix socket) and completes the handshake.
+func Dial(ctx context.Context, baseURL string, opts Options) (*Client, error) {
+	wsURL, dialer, err := wsEndpoint(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	q := url.Values{}
+	if opts.Cursor > 0 {
+		q.Set("cursor", strconv.FormatInt(opts.Cursor, 10))
+	}
+	if opts.ClientID != "" {
+		q.Set("client", opts.ClientID)
+	}
+	if opts.Name != "" {
+		q.Set("name", opts.Name)
+	}
+	if opts.Features != nil {
+		q.Set("features", strings.Join(opts.Features, ","))
+	}
+	if len(q) > 0 {
+		wsURL += "?" + q.Encode()
+	}
+	if opts.Msgpack {
+		dialer.Subprotocols = []string{ProtocolMsgpack, ProtocolJSON}
+	}
+	conn, resp, err := dialer.DialContext(ctx, wsURL, opts.Header)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("dial %s: %w (%s)", wsURL, err, resp.Status)
+		}
+		return nil, fmt.Errorf("dial %s: %w", wsURL, err)
+	}
+	c := &Client{conn: conn, frames: make(chan Frame, 64), done: make(chan struct{}), cursor: opts.Cursor}
+	typ, data, err := conn.ReadMessage()
+	if err == nil {
+		data, err = frameJSON(typ, data)
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &c.connected)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("handshake: %w", err)
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+// wsEndpoint maps an instance URL to its /ws endpoint and the dialer that
+// reaches it.
+func wsEndpoint(baseURL string) (string, *websocket.Dialer, error) {
+	base := strings.TrimRight(baseURL, "/")
+	dialer := *websocket.DefaultDialer
+	switch {
+	case strings.HasPrefix(base, "http+unix://"):
+		escaped := strings.TrimPrefix(base, "http+unix://")
+		socket, err := url.PathUnescape(escaped)
+		if err != nil {
+			return "", nil, err
+		}
+		dialer.NetDialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+		return "ws://localhost/ws", &dialer, nil
+	case strings.HasPrefix(base, "https://"):
+		return "wss://" + strings.TrimPrefix(base, "https://") + "/ws", &dialer, nil
+	case strings.HasPrefix(base, "http://"):
+		return "ws://" + strings.TrimPrefix(base, "http://") + "/ws", &dialer, nil
+	}
+	return "", nil, fmt.Errorf("unsupported chat URL %q", baseURL)
+}
+
+func (c *Client) readLoop() {
+	defer close(c.frames)
+	for {
+		typ, data, err := c.conn.ReadMessage()
+		if err != nil {
+			c.readErr = err
+			return
+		}
+		if data, err = frameJSON(typ, data); err != nil {
+			continue
+		}
+		f := Frame{Raw: json.RawMessage(data)}
+		if json.Unmarshal(data, &f.Event) != nil {
+			continue
+		}
+		if f.Seq > 0 {
+			c.cursorMu.Lock()
+			c.cursor = max(c.cursor, f.Seq)
+			c.cursorMu.Unlock()
+		}
+		select {
+		case c.frames <- f:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// frameJSON returns a server frame of message type typ as JSON,
+// transcoding a MessagePack (binary) one.
+func frameJSON(typ int, data []byte) ([]byte, error) {
+	if typ != websocket.BinaryMessage {
+		return data, nil
+	}
+	return msgpackToJSON(data)
+}
+
+// Subprotocol is the subprotocol the server chose: ProtocolMsgpack,
+// ProtocolJSON, or "" for a server that predates them (JSON).
+func (c *Client) Subprotocol() string { return c.conn.Subprotocol() }
+
+// Connected returns the handshake the server sent.
+func (c *Client) Connected() Connected { return c.connected }
+
+// Cursor is the highest event seq received so far: pass it as
+// Options.Cursor when reconnecting.
+func (c *Client) Cursor() int64 {
+	c.cursorMu.Lock()
+	defer c.cursorMu.Unlock()
+	return c.cursor
+}
+
+// ErrClosed is returned by Next once the connection is gone.
+var ErrClosed = errors.New("client: connection closed")
+
+// Next returns the next frame, in server order. History replay comes
+// first and ends with a "historyEnd" frame.
+func (c *Client) Next(ctx context.Context) (Frame, error) {
+	select {
+	case f, ok := <-c.frames:
+		if !ok {
+			if c.readErr != nil {
+				return Frame{}, fmt.Errorf("%w: %v", ErrClosed, c.readErr)
+			}
+			return Frame{}, ErrClosed
+		}
+		return f, nil
+	case <-ctx.Done():
+		return Frame{}, ctx.Err()
+	}
+}
+
+// WaitFor reads frames until match accepts one and returns it; the frames
+// it skips are dropped.
+func (c *Client) WaitFor(ctx context.Context, match func(Frame) bool) (Frame, error) {
+	for {
+		f, err := c.Next(ctx)
+		if err != nil || match(f) {
+			return f, err
+		}
+	}
+}
+
+// Message is a user message to send.
+type Message struct {
+	Text    string
+	Files   []wire.FileRef // already uploaded (POST /upload)
+	ReplyTo int64          // seq of the message being answered; 0 for none
+	Session string         // the agent session to address; "" for the primary agent
+	Prompt  int64          // seq of the quick replies this answers; 0 for none
+}
+
+// SendMessage posts a user message, as typing in the chat box does. The
+// server confirms it with a "messageQueued" frame once the agent can pick
+// it up. A message answering a Prompt that another tab answered first gets
+// a "promptClosed" frame instead, and goes nowhere.
+func (c *Client) SendMessage(m Message) error {
+	return c.write(map[string]any{"type": "message", "text": m.Text, "files": m.Files, "reply_to": m.ReplyTo, "session": m.Session, "prompt": m.Prompt})
+}
+
+// Send posts a plain text message.
+func (c *Client) Send(text string) error { return c.SendMessage(Message{Text: text}) }
+
+// Ack answers an agent message that is waiting for an ack (its AckID), with
+// an optional reply — the quick-reply buttons under such a message.
+func (c *Client) Ack(ackID, message string) error {
+	return c.write(map[string]any{"type": "ack", "id": ackID, "message": message})
+}
+
+// ShareLocation answers a request_location prompt (its Location.RequestID)
+// with a position and its accuracy radius in metres, as the Share button
+// does. A request another tab answered first gets a "locationClosed" frame.
+func (c *Client) ShareLocation(requestID string, latitude, longitude, accuracy float64) error {
+	return c.write(map[string]any{"type": "location", "id": requestID, "location": map[string]float64{"latitude": latitude, "longitude": longitude, "accuracy_m": accuracy}})
+}
+
+// DeclineLocation answers a request_location prompt with "Don't share".
+func (c *Client) DeclineLocation(requestID string) error {
+	return c.write(map[string]any{"type": "location", "id": requestID, "location": map[string]bool{"declined": true}})
+}
+
+// PickFiles answers a pick_file prompt (the request_id in its Data) with
+// paths under the shared directory; none cancels it. A request another tab
+// answered first gets a "filePickerClosed" frame.
+func (c *Client) PickFiles(requestID string, paths ...string) error {
+	if paths == nil {
+		paths = []string{}
+	}
+	return c.write(map[string]any{"type": "pickFiles", "id": requestID, "paths": paths})
+}
+
+// React puts 👍, 👎 or ❓ on message seq.
+func (c *Client) React(seq int64, emoji string) error {
+	return c.write(map[string]any{"type": "reaction", "reply_to": seq, "emoji": emoji})
+}
+
+// Pin pins (or, with pin false, unpins) message seq.
+func (c *Client) Pin(seq int64, pin bool) error {
+	typ := "unpin"
+	if pin {
+		typ = "pin"
+	}
+	return c.write(map[string]any{"type": typ, "reply_to": seq})
+}
+
+// Unsend withdraws a queued message (its userMessage ID) before the agent
+// reads it. The server answers with userMessageDeleted, or unsendFailed if
+// it was too late.
+func (c *Client) Unsend(id string) error {
+	return c.write(map[string]any{"type": "unsend", "id": id})
+}
+
+// SetName sets this client's display name ("" clears it); needs
+// Options.ClientID.
+func (c *Client) SetName(name string) error {
+	return c.write(map[string]any{"type": "setName", "text": name})
+}
+
+// Receipt reports that everything up to seq has been rendered (seen: while
+// visible), under viewer id — what feeds get_status's delivery receipts.
+func (c *Client) Receipt(id string, seq int64, seen bool) error {
+	return c.write(map[string]any{"type": "receipt", "id": id, "seq": seq, "seen": seen})
+}
+
+func (c *Client) write(v any) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteJSON(v)
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	c.writeMu.Lock()
+	c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	c.writeMu.Unlock()
+	return c.conn.Close()
+}
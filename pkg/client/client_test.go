@@ -0,0 +1,363 @@
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/choonkeat/agent-chat/pkg/wire"
+	"github.com/gorilla/websocket"
+)
+
+// fakeChat is a /ws endpoint that speaks the server's side of the protocol:
+// a connected frame, the events after the client's cursor, historyEnd, then
+// whatever the test pushes. Frames are MessagePack for a client that
+// negotiated it.
+type fakeChat struct {
+	events    []wire.Event
+	protocols []string // what the server accepts; nil accepts none, like an old server
+
+	queries chan url.Values
+	conns   chan *websocket.Conn
+	sent    chan map[string]any // what clients wrote
+}
+
+func newFakeChat(protocols []string, events ...wire.Event) *fakeChat {
+	return &fakeChat{events: events, protocols: protocols, queries: make(chan url.Values, 4), conns: make(chan *websocket.Conn, 4), sent: make(chan map[string]any, 16)}
+}
+
+func (fc *fakeChat) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/ws" {
+		http.NotFound(w, r)
+		return
+	}
+	up := websocket.Upgrader{Subprotocols: fc.protocols}
+	conn, err := up.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	fc.queries <- r.URL.Query()
+	cursor, _ := strconv.ParseInt(r.URL.Query().Get("cursor"), 10, 64)
+	write := func(v any) {
+		data, _ := json.Marshal(v)
+		if conn.Subprotocol() != ProtocolMsgpack {
+			conn.WriteMessage(websocket.TextMessage, data)
+			return
+		}
+		var generic any
+		json.Unmarshal(data, &generic)
+		conn.WriteMessage(websocket.BinaryMessage, appendTestMsgpack(nil, generic))
+	}
+	write(Connected{Version: "test", QuickReplies: []string{"yes", "no"}, PromptSeq: 1})
+	for _, e := range fc.events {
+		if e.Seq > cursor {
+			write(e)
+		}
+	}
+	write(map[string]any{"type": "historyEnd"})
+	fc.conns <- conn
+	for {
+		var m map[string]any
+		if err := conn.ReadJSON(&m); err != nil {
+			return
+		}
+		fc.sent <- m
+	}
+}
+
+// appendTestMsgpack encodes what json.Unmarshal produces into an any, in
+// the forms the server's encoder picks for them.
+func appendTestMsgpack(b []byte, v any) []byte {
+	header := func(n int, fix byte, c16 byte) {
+		if n <= 15 {
+			b = append(b, fix|byte(n))
+		} else {
+			b = append(b, c16, byte(n>>8), byte(n))
+		}
+	}
+	switch v := v.(type) {
+	case nil:
+		b = append(b, 0xc0)
+	case bool:
+		b = append(b, map[bool]byte{false: 0xc2, true: 0xc3}[v])
+	case float64:
+		if v != float64(int64(v)) || v < -32 || v > 127 {
+			panic("appendTestMsgpack: only fixints")
+		}
+		b = append(b, byte(int8(v)))
+	case string:
+		if len(v) > 31 {
+			b = append(b, 0xd9, byte(len(v)))
+		} else {
+			b = append(b, 0xa0|byte(len(v)))
+		}
+		b = append(b, v...)
+	case []any:
+		header(len(v), 0x90, 0xdc)
+		for _, e := range v {
+			b = appendTestMsgpack(b, e)
+		}
+	case map[string]any:
+		header(len(v), 0x80, 0xde)
+		for k, e := range v {
+			b = appendTestMsgpack(appendTestMsgpack(b, k), e)
+		}
+	}
+	return b
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func next(t *testing.T, ctx context.Context, c *Client) Frame {
+	t.Helper()
+	f, err := c.Next(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestMsgpackToJSON(t *testing.T) {
+	// The server's own test vectors, decoded.
+	tests := []struct{ msgpack, want string }{
+		{"81a16101", `{"a":1}`},
+		{"98ffd0dfd1012ccb3ff8000000000000a178c0c3c2", `[-1,-33,300,1.5,"x",null,true,false]`},
+		{"93d200011170d2fffeee90d3000000012a05f200", `[70000,-70000,5000000000]`},
+		{"d928" + strings.Repeat("c3a9", 20), `"` + strings.Repeat("é", 20) + `"`},
+		{"cf8000000000000000", `9223372036854775808`},
+		{"de0000dc0000", ""}, // two values
+		{"92a161", ""},       // ends mid-array
+		{"81c3c3", ""},       // non-string key
+		{"c4", ""},           // bin: not something the server sends
+	}
+	for _, tt := range tests {
+		data, _ := hex.DecodeString(tt.msgpack)
+		got, err := msgpackToJSON(data)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s decoded to %s, want an error", tt.msgpack, got)
+			}
+			continue
+		}
+		if err != nil || string(got) != tt.want {
+			t.Errorf("%s = %s (%v), want %s", tt.msgpack, got, err, tt.want)
+		}
+	}
+}
+
+func TestWSEndpoint(t *testing.T) {
+	for base, want := range map[string]string{
+		"http://localhost:4321/":         "ws://localhost:4321/ws",
+		"https://chat.example.com":       "wss://chat.example.com/ws",
+		"http+unix://%2Ftmp%2Fchat.sock": "ws://localhost/ws",
+	} {
+		if got, _, err := wsEndpoint(base); err != nil || got != want {
+			t.Errorf("wsEndpoint(%q) = %q, %v; want %q", base, got, err, want)
+		}
+	}
+	if _, _, err := wsEndpoint("ftp://localhost"); err == nil {
+		t.Error("accepted an ftp:// URL")
+	}
+}
+
+func TestDialHandshake(t *testing.T) {
+	fc := newFakeChat([]string{ProtocolMsgpack, ProtocolJSON},
+		wire.Event{Type: "agentMessage", Seq: 1, Text: "Ready?", QuickReplies: []string{"yes", "no"}},
+		wire.Event{Type: "userMessage", Seq: 2, ID: "m1", Text: "yes", Files: []wire.FileRef{{Name: "a.png", Path: "/up/a.png"}}},
+	)
+	srv := httptest.NewServer(fc)
+	defer srv.Close()
+	ctx := testContext(t)
+
+	c, err := Dial(ctx, srv.URL, Options{ClientID: "bot-1", Name: "Bot", Features: []string{"draw", "countdown"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	q := <-fc.queries
+	if q.Get("client") != "bot-1" || q.Get("name") != "Bot" || q.Get("features") != "draw,countdown" || q.Has("cursor") {
+		t.Errorf("handshake query = %v", q)
+	}
+	if c.Subprotocol() != "" {
+		t.Errorf("a client that offered nothing negotiated %q", c.Subprotocol())
+	}
+	if got := c.Connected(); got.Version != "test" || !slices.Equal(got.QuickReplies, []string{"yes", "no"}) || got.PromptSeq != 1 {
+		t.Errorf("Connected() = %+v", got)
+	}
+
+	if f := next(t, ctx, c); f.Type != "agentMessage" || !f.Logged() || !slices.Equal(f.QuickReplies, []string{"yes", "no"}) {
+		t.Errorf("first frame = %+v", f)
+	}
+	if f := next(t, ctx, c); f.ID != "m1" || len(f.Files) != 1 || f.Files[0].Name != "a.png" {
+		t.Errorf("second frame = %+v", f)
+	}
+	if f := next(t, ctx, c); f.Type != "historyEnd" || f.Logged() || !strings.Contains(string(f.Raw), `"historyEnd"`) {
+		t.Errorf("third frame = %+v (%s)", f, f.Raw)
+	}
+	if c.Cursor() != 2 {
+		t.Errorf("Cursor() = %d, want 2", c.Cursor())
+	}
+
+	if err := c.SendMessage(Message{Text: "go", ReplyTo: 1, Session: "s2", Prompt: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if m := <-fc.sent; m["type"] != "message" || m["text"] != "go" || m["reply_to"] != 1.0 || m["session"] != "s2" || m["prompt"] != 1.0 {
+		t.Errorf("server got %v", m)
+	}
+	c.Ack("ack-1", "yes")
+	if m := <-fc.sent; m["type"] != "ack" || m["id"] != "ack-1" || m["message"] != "yes" {
+		t.Errorf("server got %v", m)
+	}
+}
+
+func TestDialMsgpack(t *testing.T) {
+	events := []wire.Event{{Type: "agentMessage", Seq: 1, Text: strings.Repeat("long ", 10)}}
+	for _, tt := range []struct {
+		name      string
+		protocols []string
+		want      string
+	}{
+		{"negotiated", []string{ProtocolMsgpack, ProtocolJSON}, ProtocolMsgpack},
+		{"declined", []string{ProtocolJSON}, ProtocolJSON},
+		{"old server", nil, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(newFakeChat(tt.protocols, events...))
+			defer srv.Close()
+			ctx := testContext(t)
+			c, err := Dial(ctx, srv.URL, Options{Msgpack: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			if c.Subprotocol() != tt.want {
+				t.Errorf("negotiated %q, want %q", c.Subprotocol(), tt.want)
+			}
+			if c.Connected().Version != "test" {
+				t.Errorf("handshake = %+v", c.Connected())
+			}
+			f := next(t, ctx, c)
+			if f.Type != "agentMessage" || f.Seq != 1 || f.Text != events[0].Text {
+				t.Errorf("frame = %+v", f)
+			}
+			if !json.Valid(f.Raw) {
+				t.Errorf("Raw is not JSON: %q", f.Raw)
+			}
+		})
+	}
+}
+
+func TestReconnectAndClose(t *testing.T) {
+	fc := newFakeChat(nil,
+		wire.Event{Type: "agentMessage", Seq: 1, Text: "one"},
+		wire.Event{Type: "agentMessage", Seq: 2, Text: "two"},
+	)
+	srv := httptest.NewServer(fc)
+	defer srv.Close()
+	ctx := testContext(t)
+
+	c, err := Dial(ctx, srv.URL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-fc.queries
+	c.WaitFor(ctx, func(f Frame) bool { return f.Type == "historyEnd" })
+	// The server goes away: Next reports it once the frames are drained.
+	(<-fc.conns).Close()
+	if _, err := c.Next(ctx); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Next after the server closed = %v, want ErrClosed", err)
+	}
+	c.Close()
+
+	// Resuming from the cursor replays only what was missed.
+	fc.events = append(fc.events, wire.Event{Type: "agentMessage", Seq: 3, Text: "three"})
+	c, err = Dial(ctx, srv.URL, Options{Cursor: c.Cursor()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q := <-fc.queries; q.Get("cursor") != "2" {
+		t.Errorf("reconnect query = %v", q)
+	}
+	if f := next(t, ctx, c); f.Seq != 3 || f.Text != "three" {
+		t.Errorf("first frame after reconnect = %+v", f)
+	}
+	next(t, ctx, c) // historyEnd
+	<-fc.conns
+
+	// Closing from this side ends reads too, and sends fail.
+	if err := c.Close(); err != nil {
+		t.Errorf("Close = %v", err)
+	}
+	if _, err := c.Next(ctx); !errors.Is(err, ErrClosed) {
+		t.Errorf("Next after Close = %v, want ErrClosed", err)
+	}
+	if err := c.Send("late"); err == nil {
+		t.Error("Send after Close succeeded")
+	}
+}
+
+func TestDialErrors(t *testing.T) {
+	ctx := testContext(t)
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	if _, err := Dial(ctx, srv.URL, Options{}); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Dial to a non-chat = %v", err)
+	}
+
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteMessage(websocket.BinaryMessage, []byte{0xc4})
+		conn.ReadMessage()
+	}))
+	defer bad.Close()
+	if _, err := Dial(ctx, bad.URL, Options{}); err == nil || !strings.Contains(err.Error(), "handshake") {
+		t.Errorf("Dial with a garbled handshake = %v", err)
+	}
+}
+
+func TestDialUnixSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "chat.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip(err)
+	}
+	srv := httptest.NewUnstartedServer(newFakeChat(nil, wire.Event{Type: "agentMessage", Seq: 1, Text: "over a socket"}))
+	srv.Listener = l
+	srv.Start()
+	defer srv.Close()
+	ctx := testContext(t)
+
+	c, err := Dial(ctx, "http+unix://"+url.PathEscape(socket), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if f := next(t, ctx, c); f.Text != "over a socket" {
+		t.Errorf("frame = %+v", f)
+	}
+}
@@ -0,0 +1,149 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// errShortMsgpack is returned for a frame that ends mid-value.
+var errShortMsgpack = errors.New("msgpack: truncated frame")
+
+// msgpackToJSON transcodes one MessagePack frame, as the server sends on the
+// agent-chat.msgpack subprotocol, back to the JSON it was made from, so
+// frames decode the same way whichever subprotocol was negotiated.
+func msgpackToJSON(data []byte) ([]byte, error) {
+	v, rest, err := readMsgpack(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("msgpack: %d bytes after the value", len(rest))
+	}
+	return json.Marshal(v)
+}
+
+// readMsgpack decodes the value at the start of b and returns the bytes
+// after it. It reads what the server writes: nil, booleans, integers,
+// float64s, strings, arrays and maps with string keys.
+func readMsgpack(b []byte) (any, []byte, error) {
+	if len(b) == 0 {
+		return nil, nil, errShortMsgpack
+	}
+	c, b := b[0], b[1:]
+	switch {
+	case c <= 0x7f: // positive fixint
+		return int64(c), b, nil
+	case c >= 0xe0: // negative fixint
+		return int64(int8(c)), b, nil
+	case c&0xe0 == 0xa0: // fixstr
+		return readMsgpackString(b, int(c&0x1f))
+	case c&0xf0 == 0x90: // fixarray
+		return readMsgpackArray(b, int(c&0x0f))
+	case c&0xf0 == 0x80: // fixmap
+		return readMsgpackMap(b, int(c&0x0f))
+	}
+	switch c {
+	case 0xc0:
+		return nil, b, nil
+	case 0xc2:
+		return false, b, nil
+	case 0xc3:
+		return true, b, nil
+	case 0xcb:
+		n, b, err := readMsgpackUint(b, 8)
+		return math.Float64frombits(n), b, err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, b, err := readMsgpackUint(b, 1<<(c-0xcc))
+		if n > math.MaxInt64 {
+			return n, b, err
+		}
+		return int64(n), b, err
+	case 0xd0:
+		n, b, err := readMsgpackUint(b, 1)
+		return int64(int8(n)), b, err
+	case 0xd1:
+		n, b, err := readMsgpackUint(b, 2)
+		return int64(int16(n)), b, err
+	case 0xd2:
+		n, b, err := readMsgpackUint(b, 4)
+		return int64(int32(n)), b, err
+	case 0xd3:
+		n, b, err := readMsgpackUint(b, 8)
+		return int64(n), b, err
+	case 0xd9, 0xda, 0xdb:
+		n, b, err := readMsgpackUint(b, 1<<(c-0xd9))
+		if err != nil {
+			return nil, nil, err
+		}
+		return readMsgpackString(b, int(n))
+	case 0xdc, 0xdd:
+		n, b, err := readMsgpackUint(b, 2<<(c-0xdc))
+		if err != nil {
+			return nil, nil, err
+		}
+		return readMsgpackArray(b, int(n))
+	case 0xde, 0xdf:
+		n, b, err := readMsgpackUint(b, 2<<(c-0xde))
+		if err != nil {
+			return nil, nil, err
+		}
+		return readMsgpackMap(b, int(n))
+	}
+	return nil, nil, fmt.Errorf("msgpack: unexpected type byte %#x", c)
+}
+
+// readMsgpackUint reads a big-endian unsigned integer of size bytes.
+func readMsgpackUint(b []byte, size int) (uint64, []byte, error) {
+	if len(b) < size {
+		return 0, nil, errShortMsgpack
+	}
+	var n uint64
+	for _, x := range b[:size] {
+		n = n<<8 | uint64(x)
+	}
+	return n, b[size:], nil
+}
+
+func readMsgpackString(b []byte, n int) (any, []byte, error) {
+	if n < 0 || len(b) < n {
+		return nil, nil, errShortMsgpack
+	}
+	return string(b[:n]), b[n:], nil
+}
+
+func readMsgpackArray(b []byte, n int) (any, []byte, error) {
+	if n < 0 || n > len(b) { // every element takes at least a byte
+		return nil, nil, errShortMsgpack
+	}
+	out := make([]any, n)
+	var err error
+	for i := range out {
+		if out[i], b, err = readMsgpack(b); err != nil {
+			return nil, nil, err
+		}
+	}
+	return out, b, nil
+}
+
+func readMsgpackMap(b []byte, n int) (any, []byte, error) {
+	if n < 0 || 2*n > len(b) {
+		return nil, nil, errShortMsgpack
+	}
+	out := make(map[string]any, n)
+	for range n {
+		k, rest, err := readMsgpack(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("msgpack: map key %v is not a string", k)
+		}
+		if out[key], b, err = readMsgpack(rest); err != nil {
+			return nil, nil, err
+		}
+	}
+	return out, b, nil
+}
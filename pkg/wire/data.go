@@ -0,0 +1,94 @@
+package wire
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Kinds of event with content of their own (a prompt card, a table, an
+// error) carry it in Event.Data, typed by a payload struct registered for
+// the event type with RegisterData, rather than in fields of their own on
+// Event. NewEvent also fills Text with the payload's plain-text rendering,
+// so a consumer that does not know the kind (an export, search, an older
+// page) shows it as an agent message of that text. A payload with no
+// rendering — the record settling a prompt — leaves Text empty and is not
+// shown as a message.
+
+// Summarizer is implemented by payloads that can say what they show in
+// plain text. NewEvent puts it in Event.Text.
+type Summarizer interface {
+	Summary() string
+}
+
+var (
+	dataMu    sync.RWMutex
+	dataTypes = map[string]reflect.Type{}
+)
+
+// RegisterData declares that events of eventType carry a T in Data. It
+// panics if eventType is already registered with another type, as
+// registration happens in init and a clash is a programming error.
+func RegisterData[T any](eventType string) {
+	t := reflect.TypeFor[T]()
+	dataMu.Lock()
+	defer dataMu.Unlock()
+	if prev, ok := dataTypes[eventType]; ok && prev != t {
+		panic(fmt.Sprintf("wire: %q already carries %v, not %v", eventType, prev, t))
+	}
+	dataTypes[eventType] = t
+}
+
+// DataType returns the payload type registered for eventType.
+func DataType(eventType string) (reflect.Type, bool) {
+	dataMu.RLock()
+	defer dataMu.RUnlock()
+	t, ok := dataTypes[eventType]
+	return t, ok
+}
+
+// NewEvent returns an event of eventType carrying data, which must be of
+// the type registered for eventType.
+func NewEvent[T any](eventType string, data T) (Event, error) {
+	if err := checkDataType[T](eventType); err != nil {
+		return Event{}, err
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, fmt.Errorf("%s data: %w", eventType, err)
+	}
+	e := Event{Type: eventType, Data: raw}
+	if s, ok := any(data).(Summarizer); ok {
+		e.Text = strings.TrimSpace(s.Summary())
+	}
+	return e, nil
+}
+
+// DecodeData decodes e's payload, which must be of the type registered for
+// e.Type.
+func DecodeData[T any](e Event) (T, error) {
+	var v T
+	if err := checkDataType[T](e.Type); err != nil {
+		return v, err
+	}
+	if len(e.Data) == 0 {
+		return v, fmt.Errorf("%s event %d has no data", e.Type, e.Seq)
+	}
+	if err := json.Unmarshal(e.Data, &v); err != nil {
+		return v, fmt.Errorf("%s event %d data: %w", e.Type, e.Seq, err)
+	}
+	return v, nil
+}
+
+func checkDataType[T any](eventType string) error {
+	t, ok := DataType(eventType)
+	if !ok {
+		return fmt.Errorf("no data type registered for %q events", eventType)
+	}
+	if want := reflect.TypeFor[T](); t != want {
+		return fmt.Errorf("%q events carry %v, not %v", eventType, t, want)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package wire
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type testTable struct {
+	Columns []string   `json:"columns"`
+	Rows    [][]string `json:"rows"`
+}
+
+func (t testTable) Summary() string {
+	return fmt.Sprintf("Table: %s (%d rows)", strings.Join(t.Columns, ", "), len(t.Rows))
+}
+
+func TestDataPayload(t *testing.T) {
+	RegisterData[testTable]("testTable")
+	RegisterData[testTable]("testTable") // the same type again is fine
+
+	e, err := NewEvent("testTable", testTable{Columns: []string{"os", "share"}, Rows: [][]string{{"linux", "4%"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Text != "Table: os, share (1 rows)" {
+		t.Errorf("Text = %q", e.Text)
+	}
+
+	// Through the log and back.
+	line, _ := json.Marshal(e)
+	if !strings.Contains(string(line), `"data":{"columns":["os","share"]`) {
+		t.Errorf("logged as %s", line)
+	}
+	var logged Event
+	if err := json.Unmarshal(line, &logged); err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeData[testTable](logged)
+	if err != nil || len(got.Rows) != 1 || got.Rows[0][0] != "linux" {
+		t.Errorf("DecodeData = %+v, %v", got, err)
+	}
+
+	if _, err := DecodeData[string](logged); err == nil {
+		t.Error("decoded a testTable event as a string")
+	}
+	if _, err := NewEvent("unregistered", 1); err == nil {
+		t.Error("want an error for an unregistered type")
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("want a panic re-registering testTable with another type")
+			}
+		}()
+		RegisterData[string]("testTable")
+	}()
+}
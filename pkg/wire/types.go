@@ -0,0 +1,236 @@
+// Package wire holds agent-chat's wire types: the events written to the
+// JSONL event log and streamed to browsers over the WebSocket, and the
+// messages a user sends to the agent. Programs that read an event log,
+// script a chat, or embed the UI's protocol decode into these.
+//
+// The bus that publishes them (fan-out, message queues, agent sessions)
+// still lives in the agent-chat command.
+package wire
+
+import "encoding/json"
+
+// FileRef describes an uploaded file.
+type FileRef struct {
+	Name string `json:"name"`           // original filename
+	Path string `json:"path"`           // absolute server path
+	URL  string `json:"url"`            // relative URL for browser to fetch thumbnail
+	Size int64  `json:"size"`           // bytes
+	Type string `json:"type,omitempty"` // MIME type
+}
+
+// UserMessage is a text message with optional file attachments from the browser.
+// ID is assigned when the message enters the system and is echoed back on
+// the matching userMessagesConsumed event so the browser can flip the
+// bubble's "pending" state once the agent has actually drained it.
+//
+// ReplyTo is the seq of the earlier message the user is answering (0 for
+// none) and Quote an excerpt of it, so the agent can be told which message
+// a bare "yes" refers to.
+//
+// Reaction is set instead of Text when the user reacted to message ReplyTo
+// with an emoji. From is the sender's display name, when their browser has
+// set one.
+type UserMessage struct {
+	ID       string    `json:"id,omitempty"`
+	Text     string    `json:"text"`
+	Files    []FileRef `json:"files,omitempty"`
+	ReplyTo  int64     `json:"reply_to,omitempty"`
+	Quote    string    `json:"quote,omitempty"`
+	Reaction string    `json:"reaction,omitempty"`
+	From     string    `json:"from,omitempty"`
+}
+
+// SchemaVersion is the Event layout this build writes to the event log. It
+// goes up, with a migration in the agent-chat command that rewrites older
+// lines on load, whenever a field changes shape or meaning.
+const SchemaVersion = 2
+
+// Event represents a chat event sent to browser clients.
+//
+// For userMessage events, ID is the message's unique ID (so the browser can
+// tag the bubble). For userMessagesConsumed events, IDs lists the message IDs
+// the agent has just drained from the queue (or that the server consumed
+// inline via the permission/ack paths).
+type Event struct {
+	Type         string   `json:"type"`          // "agentMessage", "userMessage", "userMessagesConsumed", "draw"
+	Seq          int64    `json:"seq"`           // monotonic sequence number
+	ID           string   `json:"id,omitempty"`  // userMessage: the message's unique ID; promptAnswered: the ID of the message that answered
+	IDs          []string `json:"ids,omitempty"` // userMessagesConsumed: which IDs were consumed
+	Text         string   `json:"text,omitempty"`
+	AckID        string   `json:"ack_id,omitempty"`
+	QuickReplies []string `json:"quick_replies,omitempty"`
+	Instructions []any    `json:"instructions,omitempty"` // draw instructions
+	// InstructionsRef replaces Instructions on a logged draw event whose
+	// drawing was too big to keep inline: fetch them from
+	// /api/instructions/<ref>. Live broadcasts always carry them inline.
+	InstructionsRef string    `json:"instructions_ref,omitempty"`
+	Files           []FileRef `json:"files,omitempty"`
+	Timestamp       int64     `json:"ts,omitempty"` // Unix milliseconds
+
+	// AgentToolSeq + AgentToolName stamp events with the per-tool ordinal of
+	// the MCP call that produced them, so consumers (e.g. swe-swe-server's
+	// /api/fork resolver) can locate the matching tool_use/function_call in
+	// the agent's own .jsonl without resorting to text correlation.
+	//
+	// For "agentMessage" events: the Nth call to AgentToolName that emitted
+	// this bubble (send_message, send_progress, send_verbal_reply, etc.).
+	// For "userMessagesConsumed" events: the Nth check_messages call that
+	// drained the listed IDs.
+	// Zero / empty means "unstamped" -- legacy events or server-side ack
+	// paths that didn't originate from an MCP tool call.
+	AgentToolSeq  int64  `json:"agent_tool_seq,omitempty"`
+	AgentToolName string `json:"agent_tool_name,omitempty"`
+
+	// Aside marks an "Ask agent" question and its sampled answer. Asides
+	// are shown in the chat but never change the agent's turn state: an
+	// aside userMessage does not clear pending quick replies.
+	Aside bool `json:"aside,omitempty"`
+
+	// GroupID ties together the progress updates of one task (send_progress
+	// group_id): the UI folds a run of them into one expandable card, and
+	// compaction keeps only its first and last.
+	GroupID string `json:"group_id,omitempty"`
+
+	// Replace marks a progress update (send_progress, send_verbal_progress
+	// replace) that overwrites the agent's previous progress bubble in the
+	// UI, when nothing else was said in between. Both stay in the log.
+	Replace bool `json:"replace,omitempty"`
+
+	// Session is the agent session (MCP client key) an event belongs to:
+	// stamped on events published through a non-primary session
+	// so the UI can label the agent and route replies back to it. Empty for
+	// the primary session, which keeps single-agent logs unchanged.
+	Session string `json:"session,omitempty"`
+
+	// SessionName is the chat's name (-session-name, else its set_chat_title
+	// title), stamped on every event once it has one, so events from
+	// concurrent chats can be told apart.
+	SessionName string `json:"session_name,omitempty"`
+
+	// Agent is the speaking agent's identity, stamped on agent bubbles
+	// (agentMessage, verbalReply, draw) once its session has one.
+	Agent *AgentIdentity `json:"agent,omitempty"`
+
+	// ReplyTo is the Seq of the earlier message this one answers: set by the
+	// browser on a user reply, or by the agent via a tool's reply_to. For a
+	// "reaction" event (emoji in Text) it is the message reacted to; for
+	// "pinned" and "unpinned" events, the message (un)pinned; for a
+	// "linkPreview" event, the message whose links Links describes; for a
+	// "promptAnswered" event, the message whose quick replies were answered
+	// (Text is the answer, AckID set when it resolved an ack).
+	ReplyTo int64 `json:"reply_to,omitempty"`
+
+	// From is the display name of the person who sent a userMessage or
+	// answered a prompt (promptAnswered), so a chat shared with a teammate
+	// records who said what. Empty when the sender's browser has not set a
+	// name.
+	From string `json:"from,omitempty"`
+
+	// Links are the previews of a message's URLs, on a "linkPreview" event
+	// (fetched when the server runs with -link-previews).
+	Links []LinkPreview `json:"links,omitempty"`
+
+	// Meta says how an agent bubble was produced: the tool that sent it,
+	// how long the agent worked on it, and the files it concerns. The UI
+	// shows it as chips under the bubble and exports keep it.
+	Meta *ToolMeta `json:"meta,omitempty"`
+
+	// Math marks an agent message whose Text has ```math fences of LaTeX
+	// (send_message math) for the UI to typeset; without it they are code.
+	Math bool `json:"math,omitempty"`
+
+	// Redacted marks a message scrubbed by redact_message: its Text is a
+	// marker and its attachments are gone.
+	Redacted bool `json:"redacted,omitempty"`
+
+	// Data is the payload of an event kind registered with RegisterData (a
+	// prompt card, a table, an error); Text then holds its plain-text
+	// rendering. On a record settling a prompt ("countdownEnded", ...) Text
+	// is empty.
+	Data json.RawMessage `json:"data,omitempty"`
+
+	// SchemaVersion is the Event layout a line of the event log was written
+	// with; the server stamps SchemaVersion on every line it writes. Lines
+	// from before versioning have none (0). Live broadcasts leave it unset.
+	SchemaVersion int `json:"schema_version,omitempty"`
+}
+
+// AgentIdentity is how an agent presents itself in the chat: a name and a
+// colored avatar on its bubbles, carried into exports. The primary agent gets
+// one from -agent-name; any agent can set its own with the set_identity tool.
+// Once several agents (or a transcript mirror) share a chat, "AGENT" alone no
+// longer says who spoke.
+type AgentIdentity struct {
+	Name   string `json:"name"`
+	Color  string `json:"color,omitempty"`  // CSS color for the avatar; the UI derives one from Name when empty
+	Avatar string `json:"avatar,omitempty"` // emoji or short text; the UI falls back to Name's initial
+}
+
+// ToolMeta is the provenance of an agent bubble (Event.Meta).
+type ToolMeta struct {
+	Tool       string   `json:"tool"`                  // the MCP tool that published the event
+	DurationMs int64    `json:"duration_ms,omitempty"` // time the agent worked before the call, or the call itself took
+	Files      []string `json:"files,omitempty"`       // related file paths the agent named (related_files)
+}
+
+// Countdown is an action the agent will take, or drop, by itself unless
+// the user answers before Deadline: the Data of a confirm_countdown
+// "countdownPrompt" bubble, offering Approve/Reject, and of the
+// "countdownEnded" event (ReplyTo the prompt) that records how it settled.
+type Countdown struct {
+	Deadline  int64  `json:"deadline"`   // Unix milliseconds, by the server's clock
+	OnTimeout string `json:"on_timeout"` // "approve" or "reject": what silence means
+	// Outcome on "countdownEnded": "approved" or "rejected". By says who
+	// settled it: "user", "timeout", or "cancelled" when the agent's call
+	// ended first (Outcome then empty).
+	Outcome string `json:"outcome,omitempty"`
+	By      string `json:"by,omitempty"`
+}
+
+// LocationPrompt identifies a request for the browser's geolocation: the
+// Data of a request_location "locationPrompt" bubble and, with Status, of
+// the "locationAnswered" event (ReplyTo the prompt) that settles it. The
+// coordinates go to the agent alone and are never logged.
+type LocationPrompt struct {
+	RequestID    string `json:"request_id"`
+	Reason       string `json:"reason,omitempty"`
+	HighAccuracy bool   `json:"high_accuracy,omitempty"` // ask the device for GPS-grade accuracy
+	// Status on "locationAnswered": "shared", "declined", "failed" (the
+	// browser could not get a position) or "cancelled" (the agent's call
+	// ended first).
+	Status string `json:"status,omitempty"`
+}
+
+// PermissionPrompt identifies a relayed Claude Code permission request: the
+// Data of a "permissionPrompt" bubble, which the UI renders as an
+// Allow/Deny card, and, with Verdict, of the "permissionAnswered" event
+// that settles it. RequestID pairs the two.
+type PermissionPrompt struct {
+	RequestID string `json:"request_id"`
+	Tool      string `json:"tool"`
+	// Voice is set when the user was in voice mode, so the page reads the
+	// prompt aloud.
+	Voice bool `json:"voice,omitempty"`
+	// Verdict on "permissionAnswered": "allow", "deny", "expired" (denied
+	// after -permission-timeout) or "superseded" (a newer request replaced
+	// it in the chat; the terminal still answers it).
+	Verdict string `json:"verdict,omitempty"`
+}
+
+func init() {
+	RegisterData[Countdown]("countdownPrompt")
+	RegisterData[Countdown]("countdownEnded")
+	RegisterData[LocationPrompt]("locationPrompt")
+	RegisterData[LocationPrompt]("locationAnswered")
+	RegisterData[PermissionPrompt]("permissionPrompt")
+	RegisterData[PermissionPrompt]("permissionAnswered")
+}
+
+// LinkPreview is what a link renders as once enriched: the page's title,
+// description and image, as a card under the message that mentioned it.
+type LinkPreview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty"` // absolute http(s) URL
+}
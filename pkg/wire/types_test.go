@@ -0,0 +1,39 @@
+package wire
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// The JSON field names are the event log and WebSocket format; renaming one
+// breaks every stored log and connected client.
+func TestEventWireFormat(t *testing.T) {
+	e := Event{
+		Type:      "userMessage",
+		Seq:       7,
+		ID:        "m1",
+		Text:      "yes",
+		Files:     []FileRef{{Name: "a.png", Path: "/tmp/a.png", URL: "/uploads/a.png", Size: 3}},
+		Timestamp: 1700000000000,
+		Agent:     &AgentIdentity{Name: "Reviewer"},
+		ReplyTo:   5,
+		From:      "Ana",
+		Links:     []LinkPreview{{URL: "https://example.com", Title: "Example"}},
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"type":"userMessage","seq":7,"id":"m1","text":"yes","files":[{"name":"a.png","path":"/tmp/a.png","url":"/uploads/a.png","size":3}],"ts":1700000000000,"agent":{"name":"Reviewer"},"reply_to":5,"from":"Ana","links":[{"url":"https://example.com","title":"Example"}]}`
+	if string(data) != want {
+		t.Errorf("Event JSON =\n%s\nwant\n%s", data, want)
+	}
+
+	var msg UserMessage
+	if err := json.Unmarshal([]byte(`{"id":"m2","text":"hi","reply_to":3,"quote":"ok?","from":"Ana"}`), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.ID != "m2" || msg.ReplyTo != 3 || msg.Quote != "ok?" || msg.From != "Ana" {
+		t.Errorf("UserMessage = %+v", msg)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import "strings"
+
+// PresenceEvent is the transient broadcast sent whenever a browser tab
+// connects (viewerJoined) or disconnects (viewerLeft), so every open tab can
+// show how many people are watching. Presence is live state, not
+// conversation, so it is never written to the event log: a flaky connection
+// would otherwise fill it with reconnect churn.
+type PresenceEvent struct {
+	Type    string         `json:"type"`              // "viewerJoined" or "viewerLeft"
+	Viewers int            `json:"viewers"`           // connected viewers after the change
+	Device  string         `json:"device,omitempty"`  // device hint of the viewer that joined or left
+	Devices map[string]int `json:"devices,omitempty"` // connected viewers by device hint
+}
+
+// SubscribeViewer is Subscribe for a browser tab: it counts toward presence
+// (ViewerCount, WaitForSubscriber) and is announced as viewerJoined. device
+// is a hint such as "desktop" or "mobile" (see deviceHint); "" for unknown.
+func (eb *EventBus) SubscribeViewer(device string) chan Event {
+	ch := make(chan Event, 64)
+	eb.mu.Lock()
+	eb.subscribers[ch] = newSubscriberStats()
+	eb.viewers[ch] = device
+	eb.presenceChangedLocked()
+	eb.mu.Unlock()
+	eb.PublishTransient(eb.Presence("viewerJoined", device))
+	return ch
+}
+
+// presenceChangedLocked wakes everything waiting on a presence change.
+// Caller holds mu.
+func (h *eventHub) presenceChangedLocked() {
+	close(h.viewersChanged)
+	h.viewersChanged = make(chan struct{})
+}
+
+// ViewerCount returns the number of connected browser tabs.
+func (eb *EventBus) ViewerCount() int {
+	eb.mu.RLock()
+	defer eb.mu.RUnlock()
+	return len(eb.viewers)
+}
+
+// ViewerDevices counts connected viewers by device hint; viewers without a
+// hint are left out.
+func (eb *EventBus) ViewerDevices() map[string]int {
+	eb.mu.RLock()
+	defer eb.mu.RUnlock()
+	devices := make(map[string]int)
+	for _, d := range eb.viewers {
+		if d != "" {
+			devices[d]++
+		}
+	}
+	return devices
+}
+
+// Presence builds a presence event of the given type for the current set of
+// viewers.
+func (eb *EventBus) Presence(typ, device string) PresenceEvent {
+	ev := PresenceEvent{Type: typ, Viewers: eb.ViewerCount(), Device: device}
+	if devices := eb.ViewerDevices(); len(devices) > 0 {
+		ev.Devices = devices
+	}
+	return ev
+}
+
+// deviceHint classifies a browser by its User-Agent: "mobile", "tablet" or
+// "desktop". It is a label for "who is watching", not a capability check.
+func deviceHint(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case ua == "":
+		return ""
+	case strings.Contains(ua, "ipad") || strings.Contains(ua, "tablet") ||
+		(strings.Contains(ua, "android") && !strings.Contains(ua, "mobile")):
+		return "tablet"
+	case strings.Contains(ua, "mobi") || strings.Contains(ua, "iphone") || strings.Contains(ua, "android"):
+		return "mobile"
+	default:
+		return "desktop"
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPresenceBroadcastsJoinAndLeave(t *testing.T) {
+	eb := NewEventBus()
+	sink := make(chan any, 8)
+	eb.SubscribeTransient(sink)
+
+	phone := eb.SubscribeViewer("mobile")
+	laptop := eb.SubscribeViewer("desktop")
+	watcher := eb.Observe()
+	eb.Unsubscribe(phone)
+	eb.Unsubscribe(watcher) // observers come and go silently
+
+	want := []PresenceEvent{
+		{Type: "viewerJoined", Viewers: 1, Device: "mobile", Devices: map[string]int{"mobile": 1}},
+		{Type: "viewerJoined", Viewers: 2, Device: "desktop", Devices: map[string]int{"mobile": 1, "desktop": 1}},
+		{Type: "viewerLeft", Viewers: 1, Device: "mobile", Devices: map[string]int{"desktop": 1}},
+	}
+	for i, w := range want {
+		select {
+		case got := <-sink:
+			ev := got.(PresenceEvent)
+			if ev.Type != w.Type || ev.Viewers != w.Viewers || ev.Device != w.Device || len(ev.Devices) != len(w.Devices) {
+				t.Errorf("presence[%d] = %+v, want %+v", i, ev, w)
+			}
+			for d, n := range w.Devices {
+				if ev.Devices[d] != n {
+					t.Errorf("presence[%d].Devices = %v, want %v", i, ev.Devices, w.Devices)
+				}
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("presence[%d] not broadcast", i)
+		}
+	}
+	select {
+	case extra := <-sink:
+		t.Errorf("unexpected broadcast %+v", extra)
+	default:
+	}
+	if n := eb.ViewerCount(); n != 1 {
+		t.Errorf("ViewerCount = %d, want 1", n)
+	}
+	eb.Unsubscribe(laptop)
+}
+
+func TestDeviceHint(t *testing.T) {
+	for ua, want := range map[string]string{
+		"": "",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_5) AppleWebKit/605.1.15 Safari/605.1.15":                      "desktop",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148 Safari/604.1": "mobile",
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Chrome/126.0 Mobile Safari/537.36":          "mobile",
+		"Mozilla/5.0 (Linux; Android 13; SM-X710) AppleWebKit/537.36 Chrome/126.0 Safari/537.36":                 "tablet",
+		"Mozilla/5.0 (iPad; CPU OS 17_5 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148 Safari/604.1":          "tablet",
+	} {
+		if got := deviceHint(ua); got != want {
+			t.Errorf("deviceHint(%q) = %q, want %q", ua, got, want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+// A prompt is an agent event offering quick replies. Every open tab shows
+// its buttons, so two devices could both answer it; the first answer claims
+// the prompt, a "promptAnswered" event tells the other tabs to collapse the
+// buttons, and a later answer to the same prompt is turned away with a
+// "promptClosed" reply to its tab alone.
+
+// OpenPrompt returns the seq of the event whose quick replies await an
+// answer, or 0 when none does.
+func (eb *EventBus) OpenPrompt() int64 {
+	eb.mu.RLock()
+	defer eb.mu.RUnlock()
+	return eb.promptSeq
+}
+
+// claimPrompt records that a browser is answering prompt (a seq from
+// OpenPrompt, as the tab last saw it). It reports false when that prompt was
+// already answered or superseded, and true for prompt 0, a message that
+// answers nothing in particular.
+func (eb *EventBus) claimPrompt(prompt int64) bool {
+	if prompt == 0 {
+		return true
+	}
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	if prompt != eb.promptSeq {
+		return false
+	}
+	eb.promptSeq = 0
+	return true
+}
+
+// openPromptsBySession reconstructs each agent session's promptSeq from a
+// restored event log, as quickRepliesBySession does its lastQuickReplies.
+func openPromptsBySession(events []Event) map[string]int64 {
+	open := make(map[string]int64)
+	for _, ev := range events {
+		if len(ev.QuickReplies) > 0 {
+			open[ev.Session] = ev.Seq
+		}
+		if (ev.Type == "userMessage" && !ev.Aside) || ev.Type == "agentDisconnected" || ev.Type == "promptAnswered" || ev.Type == "countdownEnded" {
+			delete(open, ev.Session)
+		}
+	}
+	return open
+}
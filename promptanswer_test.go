@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/choonkeat/agent-chat/pkg/client"
+)
+
+func TestPromptAnsweredOnce(t *testing.T) {
+	base := startWSServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	prompt := bus.Publish(Event{Type: "agentMessage", Text: "Ship it?", QuickReplies: []string{"Yes", "No"}})
+
+	var tabs [2]*client.Client
+	for i, name := range []string{"Ana", "Bo"} {
+		c, err := client.Dial(ctx, base, client.Options{ClientID: name, Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		if got := c.Connected().PromptSeq; got != prompt {
+			t.Fatalf("%s: handshake promptSeq = %d, want %d", name, got, prompt)
+		}
+		waitType(t, ctx, c, "historyEnd")
+		tabs[i] = c
+	}
+
+	if err := tabs[0].SendMessage(client.Message{Text: "Yes", Prompt: prompt}); err != nil {
+		t.Fatal(err)
+	}
+	waitType(t, ctx, tabs[0], "messageQueued")
+	if f := waitType(t, ctx, tabs[1], "promptAnswered"); f.ReplyTo != prompt || f.Text != "Yes" || f.From != "Ana" {
+		t.Errorf("promptAnswered = %+v", f.Event)
+	}
+
+	// The second tab answered before it heard: turned away, not queued.
+	if err := tabs[1].SendMessage(client.Message{Text: "No", Prompt: prompt}); err != nil {
+		t.Fatal(err)
+	}
+	waitType(t, ctx, tabs[1], "promptClosed")
+	if msgs := bus.DrainMessages(); len(msgs) != 1 || msgs[0].Text != "Yes" {
+		t.Fatalf("queued = %+v", msgs)
+	}
+	if bus.OpenPrompt() != 0 {
+		t.Errorf("prompt still open: %d", bus.OpenPrompt())
+	}
+
+	// A message tied to no prompt always goes through.
+	if err := tabs[1].Send("one more thing"); err != nil {
+		t.Fatal(err)
+	}
+	waitType(t, ctx, tabs[1], "messageQueued")
+
+	// Acks: the first resolves the agent's wait, the second is refused.
+	ack := bus.CreateAck()
+	bus.Publish(Event{Type: "draw", AckID: ack.ID})
+	if err := tabs[0].Ack(ack.ID, "looks good"); err != nil {
+		t.Fatal(err)
+	}
+	if f := waitType(t, ctx, tabs[1], "promptAnswered"); f.AckID != ack.ID || f.Text != "looks good" {
+		t.Errorf("ack promptAnswered = %+v", f.Event)
+	}
+	if err := tabs[1].Ack(ack.ID, "wait"); err != nil {
+		t.Fatal(err)
+	}
+	waitType(t, ctx, tabs[1], "promptClosed")
+	if got := <-ack.Ch; got != "ack:looks good" {
+		t.Errorf("ack result = %q", got)
+	}
+}
+
+func TestOpenPromptsBySession(t *testing.T) {
+	events := []Event{
+		{Seq: 1, Type: "agentMessage", QuickReplies: []string{"A"}},
+		{Seq: 2, Type: "agentMessage", Session: "s2", QuickReplies: []string{"B"}},
+		{Seq: 3, Type: "promptAnswered", Session: "s2", ReplyTo: 2},
+		{Seq: 4, Type: "agentMessage", Session: "s3", QuickReplies: []string{"C"}},
+		{Seq: 5, Type: "userMessage", Session: "s3", Aside: true},
+	}
+	got := openPromptsBySession(events)
+	if len(got) != 2 || got[""] != 1 || got["s3"] != 4 {
+		t.Errorf("open prompts = %v", got)
+	}
+}
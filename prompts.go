@@ -2,9 +2,18 @@ package main
 
 import (
 	"bytes"
+	"context"
 	_ "embed"
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"text/template"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
 //go:embed prompts/agent-reply.tmpl
@@ -12,6 +21,62 @@ var agentReplyTmplStr string
 
 var agentReplyTmpl = template.Must(template.New("agent-reply").Parse(agentReplyTmplStr))
 
+//go:embed prompts/session-prompts.tmpl
+var sessionPromptsTmplStr string
+
+var sessionPromptsTmpl = template.Must(template.New("session-prompts").Parse(sessionPromptsTmplStr))
+
+// loadTemplateOverrides applies an operator's -templates-dir: an
+// agent-reply.tmpl or session-prompts.tmpl there is parsed on top of the
+// current template of the same name, so each {{define}} it contains
+// replaces the built-in one and anything it leaves out keeps the default.
+// That covers the reply instructions (voiceSuffix) and the check_messages
+// guidance strings as well as the message formatting. Returns the files
+// applied; a missing file is not an error, a broken one is.
+func loadTemplateOverrides(dir string) ([]string, error) {
+	applied, err := applyTemplateOverrides(os.DirFS(dir))
+	for i, name := range applied {
+		applied[i] = filepath.Join(dir, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", dir, err)
+	}
+	return applied, nil
+}
+
+// applyTemplateOverrides layers agent-reply.tmpl and session-prompts.tmpl
+// from fsys (a -templates-dir or a -locale bundle) over the current
+// templates. Nothing changes unless every present file parses.
+func applyTemplateOverrides(fsys fs.FS) ([]string, error) {
+	reply, sessions := agentReplyTmpl, sessionPromptsTmpl
+	var applied []string
+	for _, o := range []struct {
+		name string
+		tmpl **template.Template
+	}{
+		{"agent-reply.tmpl", &reply},
+		{"session-prompts.tmpl", &sessions},
+	} {
+		src, err := fs.ReadFile(fsys, o.name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		t, err := template.Must((*o.tmpl).Clone()).Parse(string(src))
+		if err != nil {
+			return nil, err
+		}
+		*o.tmpl = t
+		applied = append(applied, o.name)
+	}
+	agentReplyTmpl, sessionPromptsTmpl = reply, sessions
+	executeNotEchoGuidance = execTemplate("execute-not-echo", nil)
+	emptyQueueGuidance = execTemplate("empty-queue", nil)
+	return applied, nil
+}
+
 // formatMessagesData is the data passed to the "format-messages" template.
 type formatMessagesData struct {
 	Messages []messageData
@@ -19,8 +84,12 @@ type formatMessagesData struct {
 }
 
 type messageData struct {
-	Text    string
-	IsVoice bool
+	Text     string
+	IsVoice  bool
+	ReplyTo  int64  // seq of the message being answered; 0 = none
+	Quote    string // excerpt of that message
+	Reaction string // emoji the user reacted to ReplyTo with; Text is empty
+	From     string // sender's display name, if set
 }
 
 type fileData struct {
@@ -52,3 +121,97 @@ func formatSize(size int64) string {
 	}
 	return fmt.Sprintf("%dB", size)
 }
+
+// sessionPromptData is the data passed to the session-prompts templates.
+type sessionPromptData struct {
+	Turns []transcriptTurn
+	Focus string
+}
+
+// transcriptTurn is one chat bubble flattened to plain text for a prompt.
+type transcriptTurn struct {
+	Role string // "USER" or "AGENT", with " · {name}" for a named user
+	Text string
+}
+
+// transcriptTurns flattens the visible chat (unsent messages excluded) into
+// plain-text turns, keeping only the last maxTurns when maxTurns > 0.
+// Attachments and drawings become bracketed placeholders.
+func transcriptTurns(events []Event, maxTurns int) []transcriptTurn {
+	var turns []transcriptTurn
+	for _, e := range withoutWithdrawn(events) {
+		var role string
+		parts := []string{strings.TrimSpace(e.Text)}
+		switch eventKind(e) {
+		case "userMessage":
+			role = userRole(e)
+		case "agentMessage", "verbalReply":
+			role = "AGENT"
+		case "draw":
+			role = "AGENT"
+			parts = append(parts, "[drew a diagram]")
+		default:
+			continue
+		}
+		for _, f := range e.Files {
+			parts = append(parts, "[attached "+f.Name+"]")
+		}
+		text := strings.TrimSpace(strings.Join(parts, " "))
+		if text == "" {
+			continue
+		}
+		turns = append(turns, transcriptTurn{Role: role, Text: text})
+	}
+	if maxTurns > 0 && len(turns) > maxTurns {
+		turns = turns[len(turns)-maxTurns:]
+	}
+	return turns
+}
+
+// registerPrompts registers MCP prompts that wrap the current chat history,
+// so clients with a prompt picker can summarize a session or hand it off
+// without copy-pasting the conversation.
+func registerPrompts(server *mcp.Server, eb *EventBus) {
+	args := []*mcp.PromptArgument{
+		{Name: "focus", Description: "Optional topic or question to emphasize"},
+		{Name: "max_turns", Description: "Only include the last N chat turns (default: all)"},
+	}
+	handler := func(name, description string) mcp.PromptHandler {
+		return func(ctx context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			maxTurns := 0
+			if v := strings.TrimSpace(req.Params.Arguments["max_turns"]); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("max_turns must be a non-negative integer, got %q", v)
+				}
+				maxTurns = n
+			}
+			events, _ := eb.History()
+			var buf bytes.Buffer
+			data := sessionPromptData{Turns: transcriptTurns(events, maxTurns), Focus: strings.TrimSpace(req.Params.Arguments["focus"])}
+			if err := sessionPromptsTmpl.ExecuteTemplate(&buf, name, data); err != nil {
+				return nil, err
+			}
+			return &mcp.GetPromptResult{
+				Description: description,
+				Messages: []*mcp.PromptMessage{
+					{Role: "user", Content: &mcp.TextContent{Text: buf.String()}},
+				},
+			}, nil
+		}
+	}
+
+	server.AddPrompt(&mcp.Prompt{
+		Name:        "summarize-session",
+		Title:       "Summarize this chat session",
+		Description: "Summarize the agent-chat conversation so far: asks, decisions, work done, open items.",
+		Arguments:   args,
+	}, handler("summarize-session", "Summary of the current agent-chat session"))
+
+	server.AddPrompt(&mcp.Prompt{
+		Name:        "draft-handoff",
+		Title:       "Draft a handoff note",
+		Description: "Draft a handoff note for the next agent from the agent-chat conversation so far.",
+		Arguments:   args,
+	}, handler("draft-handoff", "Handoff note for the next agent"))
+}
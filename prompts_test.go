@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestTranscriptTurns(t *testing.T) {
+	events := []Event{
+		{Type: "userMessage", ID: "a", Text: "fix login", Files: []FileRef{{Name: "err.png"}}},
+		{Type: "userMessage", ID: "b", Text: "never mind"},
+		{Type: "userMessageDeleted", ID: "b"},
+		{Type: "toolMarker"},
+		{Type: "draw"},
+		{Type: "agentMessage", Text: "Done."},
+	}
+	got := transcriptTurns(events, 0)
+	want := []transcriptTurn{
+		{"USER", "fix login [attached err.png]"},
+		{"AGENT", "[drew a diagram]"},
+		{"AGENT", "Done."},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("turn %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if last := transcriptTurns(events, 1); len(last) != 1 || last[0].Text != "Done." {
+		t.Errorf("max_turns 1 = %+v", last)
+	}
+}
+
+func TestSessionPrompts(t *testing.T) {
+	ctx := context.Background()
+	eb := NewEventBus()
+	eb.Publish(Event{Type: "userMessage", ID: "a", Text: "add dark mode"})
+	eb.Publish(Event{Type: "agentMessage", Text: "Added a toggle."})
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "agent-chat", Version: "test"}, nil)
+	registerPrompts(server, eb)
+	st, ct := mcp.NewInMemoryTransports()
+	ss, err := server.Connect(ctx, st, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+	cs, err := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "test"}, nil).Connect(ctx, ct, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cs.Close()
+
+	for _, name := range []string{"summarize-session", "draft-handoff"} {
+		res, err := cs.GetPrompt(ctx, &mcp.GetPromptParams{Name: name, Arguments: map[string]string{"focus": "theming"}})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		text := res.Messages[0].Content.(*mcp.TextContent).Text
+		for _, want := range []string{"USER: add dark mode\n\nAGENT: Added a toggle.", "theming", "<transcript>"} {
+			if !strings.Contains(text, want) {
+				t.Errorf("%s missing %q:\n%s", name, want, text)
+			}
+		}
+	}
+	if _, err := cs.GetPrompt(ctx, &mcp.GetPromptParams{Name: "draft-handoff", Arguments: map[string]string{"max_turns": "x"}}); err == nil {
+		t.Error("bad max_turns should fail")
+	}
+}
+
+func TestLoadTemplateOverrides(t *testing.T) {
+	reply, sessions := agentReplyTmpl, sessionPromptsTmpl
+	notEcho, empty := executeNotEchoGuidance, emptyQueueGuidance
+	t.Cleanup(func() {
+		agentReplyTmpl, sessionPromptsTmpl = reply, sessions
+		executeNotEchoGuidance, emptyQueueGuidance = notEcho, empty
+	})
+
+	dir := t.TempDir()
+	override := `{{define "empty-queue"}}{"queue":"empty"} — nothing yet.{{end}}` +
+		`{{define "reply-instructions"}}Answer with send_message.{{end}}`
+	if err := os.WriteFile(filepath.Join(dir, "agent-reply.tmpl"), []byte(override), 0644); err != nil {
+		t.Fatal(err)
+	}
+	applied, err := loadTemplateOverrides(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || filepath.Base(applied[0]) != "agent-reply.tmpl" {
+		t.Errorf("applied = %q", applied)
+	}
+	if emptyQueueGuidance != `{"queue":"empty"} — nothing yet.` {
+		t.Errorf("emptyQueueGuidance = %q", emptyQueueGuidance)
+	}
+	if got := voiceSuffix(nil); got != "Answer with send_message." {
+		t.Errorf("voiceSuffix = %q", got)
+	}
+	// Templates the override leaves out keep their embedded text.
+	if executeNotEchoGuidance != notEcho {
+		t.Errorf("executeNotEchoGuidance changed to %q", executeNotEchoGuidance)
+	}
+	if got := FormatMessages([]UserMessage{{Text: "hi"}}); got != "hi" {
+		t.Errorf("FormatMessages = %q", got)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "session-prompts.tmpl"), []byte(`{{define "x"}}{{.Nope`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadTemplateOverrides(dir); err == nil {
+		t.Error("broken template accepted")
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strings"
+	"sync/atomic"
+)
+
+// basePath is the -base-path serve flag: the URL prefix the whole app is
+// mounted under, for a reverse proxy that forwards /agent-chat/… unchanged.
+// Normalized to a leading slash and no trailing one; "" serves at the root.
+var basePath string
+
+// trustedProxies is the -trusted-proxy serve flag: peers whose
+// X-Forwarded-Proto and X-Forwarded-Host headers are believed. Requests from
+// anywhere else never change the URL agent-chat hands out.
+var trustedProxies []netip.Prefix
+
+// publicURL is the -public-url serve flag: the chat's externally reachable
+// URL, for tool results and the startup QR code when the listen address
+// (http://localhost:PORT on a remote box) is no use to the person chatting.
+var publicURL string
+
+// parsePublicURL validates a -public-url value and trims its trailing slash.
+func parsePublicURL(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("public URL %q: want http(s)://host[/path]", s)
+	}
+	return strings.TrimRight(s, "/"), nil
+}
+
+// proxiedURL is the chat's URL as last seen through a trusted proxy, which
+// tool results prefer over the local listen address.
+var proxiedURL atomic.Value // string
+
+// parseBasePath normalizes a -base-path value.
+func parseBasePath(s string) (string, error) {
+	if s == "" || s == "/" {
+		return "", nil
+	}
+	if !strings.HasPrefix(s, "/") {
+		return "", fmt.Errorf("base path %q must start with /", s)
+	}
+	p := path.Clean(s)
+	if strings.ContainsAny(p, "?#") {
+		return "", fmt.Errorf("base path %q: only a path is allowed", s)
+	}
+	return p, nil
+}
+
+// parseTrustedProxy parses one -trusted-proxy value: an IP or a CIDR range.
+func parseTrustedProxy(s string) (netip.Prefix, error) {
+	if p, err := netip.ParsePrefix(s); err == nil {
+		return p.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("trusted proxy %q: not an IP address or CIDR range", s)
+	}
+	return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+}
+
+// chatURL is the chat's URL as tool results should show it: -public-url
+// when set, else the one a trusted proxy forwards to once a request has
+// come through it, else uiURL.
+func chatURL() string {
+	if publicURL != "" {
+		return publicURL
+	}
+	if u, _ := proxiedURL.Load().(string); u != "" {
+		return u
+	}
+	return uiURL
+}
+
+// mountAt serves next under prefix (from basePath): /prefix/x reaches next
+// as /x, /prefix redirects to /prefix/, and anything else is not found.
+func mountAt(prefix string, next http.Handler) http.Handler {
+	if prefix == "" {
+		return next
+	}
+	strip := http.StripPrefix(prefix, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == prefix:
+			relativeRedirect(w, path.Base(prefix)+"/")
+		case strings.HasPrefix(r.URL.Path, prefix+"/"):
+			strip.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// fromTrustedProxy reports whether r came straight from a -trusted-proxy.
+func fromTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	addr, err := netip.ParseAddr(host)
+	return err == nil && isTrustedProxy(addr)
+}
+
+// isTrustedProxy reports whether addr is in a -trusted-proxy range.
+func isTrustedProxy(addr netip.Addr) bool {
+	for _, p := range trustedProxies {
+		if p.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedBaseURL is the URL the client used to reach the chat, from a
+// trusted proxy's X-Forwarded-Host and X-Forwarded-Proto (the first hop of
+// each), plus basePath.
+func forwardedBaseURL(r *http.Request) (string, bool) {
+	if len(trustedProxies) == 0 || !fromTrustedProxy(r) {
+		return "", false
+	}
+	first := func(h string) string {
+		v, _, _ := strings.Cut(r.Header.Get(h), ",")
+		return strings.TrimSpace(v)
+	}
+	host := first("X-Forwarded-Host")
+	if host == "" || strings.ContainsAny(host, "/\\@ ") {
+		return "", false
+	}
+	proto := strings.ToLower(first("X-Forwarded-Proto"))
+	if proto != "https" {
+		proto = "http"
+	}
+	return proto + "://" + host + basePath, true
+}
+
+// learnForwardedURL wraps the HTTP handler to record the chat's URL as seen
+// through a trusted proxy, so tool results link there instead of to
+// localhost.
+func learnForwardedURL(next http.Handler) http.Handler {
+	if len(trustedProxies) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, ok := forwardedBaseURL(r); ok {
+			if old, _ := proxiedURL.Swap(u).(string); old != u {
+				log.Printf("agent-chat: reached through proxy at %s", u)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestParseBasePath(t *testing.T) {
+	for in, want := range map[string]string{"": "", "/": "", "/agent-chat/": "/agent-chat", "/a//b": "/a/b"} {
+		if got, err := parseBasePath(in); err != nil || got != want {
+			t.Errorf("parseBasePath(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"agent-chat", "/a?b"} {
+		if _, err := parseBasePath(bad); err == nil {
+			t.Errorf("parseBasePath(%q) accepted", bad)
+		}
+	}
+}
+
+func TestMountAt(t *testing.T) {
+	var seen string
+	h := mountAt("/agent-chat", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { seen = r.URL.Path }))
+	for target, want := range map[string]int{"/agent-chat/ws": http.StatusOK, "/agent-chat": http.StatusSeeOther, "/ws": http.StatusNotFound, "/agent-chatty/": http.StatusNotFound} {
+		seen = ""
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != want {
+			t.Errorf("GET %s = %d, want %d", target, rec.Code, want)
+		}
+		if want == http.StatusOK && seen != "/ws" {
+			t.Errorf("GET %s reached the app as %q", target, seen)
+		}
+		if want == http.StatusSeeOther && rec.Header().Get("Location") != "agent-chat/" {
+			t.Errorf("GET %s redirects to %q", target, rec.Header().Get("Location"))
+		}
+	}
+}
+
+func TestForwardedURL(t *testing.T) {
+	origProxies, origBase, origUI := trustedProxies, basePath, uiURL
+	t.Cleanup(func() {
+		trustedProxies, basePath, uiURL = origProxies, origBase, origUI
+		proxiedURL.Store("")
+	})
+	p, err := parseTrustedProxy("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseTrustedProxy("nginx"); err == nil {
+		t.Error("parseTrustedProxy accepted a hostname")
+	}
+	trustedProxies = []netip.Prefix{p, netip.MustParsePrefix("::1/128")}
+	basePath, uiURL = "/agent-chat", "http://localhost:4000/agent-chat"
+
+	h := learnForwardedURL(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	request := func(remote, host, proto string) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remote
+		r.Header.Set("X-Forwarded-Host", host)
+		r.Header.Set("X-Forwarded-Proto", proto)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	request("192.168.1.5:5000", "evil.example", "https")
+	if got := chatURL(); got != uiURL {
+		t.Errorf("untrusted peer changed the URL to %s", got)
+	}
+	request("10.1.2.3:5000", "chat.example.com, inner:8080", "https, http")
+	if got := chatURL(); got != "https://chat.example.com/agent-chat" {
+		t.Errorf("chatURL() = %s", got)
+	}
+	request("[::1]:5000", "chat.example.com/x", "http")
+	if got := chatURL(); got != "https://chat.example.com/agent-chat" {
+		t.Errorf("a malformed host changed the URL to %s", got)
+	}
+}
+
+func TestPublicURL(t *testing.T) {
+	origPublic, origUI := publicURL, uiURL
+	t.Cleanup(func() {
+		publicURL, uiURL = origPublic, origUI
+		proxiedURL.Store("")
+	})
+	got, err := parsePublicURL("https://box.example.com/agent-chat/")
+	if err != nil || got != "https://box.example.com/agent-chat" {
+		t.Errorf("parsePublicURL = %q, %v", got, err)
+	}
+	for _, bad := range []string{"box.example.com", "ftp://box", "https://box/?a=1"} {
+		if _, err := parsePublicURL(bad); err == nil {
+			t.Errorf("parsePublicURL(%q) accepted", bad)
+		}
+	}
+
+	uiURL = "http://localhost:4000"
+	proxiedURL.Store("https://proxied.example.com")
+	publicURL = got
+	if chatURL() != got {
+		t.Errorf("chatURL() = %s, want -public-url to win", chatURL())
+	}
+	publicURL = ""
+	if chatURL() != "https://proxied.example.com" {
+		t.Errorf("chatURL() = %s without -public-url", chatURL())
+	}
+}
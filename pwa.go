@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// The chat installs as a progressive web app: /manifest.webmanifest names
+// it after the -title branding, and /sw.js keeps the app shell cached so a
+// phone that lost the network opens to the chat (and its reconnect loop)
+// instead of a browser error page. Both are generated per instance. The
+// browser only registers service workers in a secure context: https, or
+// http://localhost.
+
+// pwaShell is what the service worker precaches, relative to its scope.
+var pwaShell = []string{"./", "./app.js", "./style.css", "./custom.css", "./canvas-bundle.js", "./icon.svg"}
+
+// handleManifest serves GET /manifest.webmanifest.
+func handleManifest(w http.ResponseWriter, r *http.Request) {
+	theme := "#2563eb"
+	if pageBranding.Accent != "" {
+		theme = pageBranding.Accent
+	}
+	icon := map[string]string{"src": "./icon.svg", "sizes": "any", "type": "image/svg+xml"}
+	if pageBranding.Logo != "" {
+		icon = map[string]string{"src": pageBranding.logoURL(), "sizes": "any"}
+	}
+	manifest := map[string]any{
+		"name":             pageBranding.pageTitle(),
+		"short_name":       pageBranding.pageTitle(),
+		"start_url":        "./",
+		"scope":            "./",
+		"display":          "standalone",
+		"background_color": "#0f172a",
+		"theme_color":      theme,
+		"icons":            []map[string]string{icon},
+	}
+	w.Header().Set("Content-Type", "application/manifest+json")
+	json.NewEncoder(w).Encode(manifest)
+}
+
+// serviceWorkerTmpl is the service worker. Its cache is named for the
+// build and the instance URL, so an upgrade or a different instance on the
+// same origin never serves a stale shell. Shell files are network-first (the
+// UI is always current while online) with the cache as the offline fallback;
+// everything live — /ws, /api, /mcp, uploads — passes straight through.
+var serviceWorkerTmpl = template.Must(template.New("sw").Parse(`// Generated by agent-chat {{.Version}} for {{.InstanceURL}}
+'use strict';
+
+var CACHE = {{.Cache}};
+var SHELL = {{.Shell}};
+
+self.addEventListener('install', function (e) {
+  e.waitUntil(caches.open(CACHE).then(function (c) { return c.addAll(SHELL); }).then(function () { return self.skipWaiting(); }));
+});
+
+self.addEventListener('activate', function (e) {
+  e.waitUntil(caches.keys().then(function (keys) {
+    return Promise.all(keys.filter(function (k) { return k.indexOf('agent-chat-') === 0 && k !== CACHE; }).map(function (k) { return caches.delete(k); }));
+  }).then(function () { return self.clients.claim(); }));
+});
+
+function isShell(url) {
+  var scope = self.registration.scope;
+  return SHELL.some(function (p) { return new URL(p, scope).href === url.split('?')[0]; });
+}
+
+self.addEventListener('fetch', function (e) {
+  var req = e.request;
+  if (req.method !== 'GET' || !isShell(req.url)) return;
+  e.respondWith(fetch(req).then(function (resp) {
+    if (resp.ok) {
+      var copy = resp.clone();
+      caches.open(CACHE).then(function (c) { c.put(req.url.split('?')[0], copy); });
+    }
+    return resp;
+  }).catch(function () {
+    return caches.match(req, { ignoreSearch: true }).then(function (hit) {
+      return hit || new Response('Agent Chat is offline: ' + {{.InstanceURL}} + ' cannot be reached.', { status: 503, headers: { 'Content-Type': 'text/plain; charset=utf-8' } });
+    });
+  }));
+});
+`))
+
+// handleServiceWorker serves GET /sw.js.
+func handleServiceWorker(w http.ResponseWriter, r *http.Request) {
+	instance := uiURL
+	if instance == "" {
+		instance = "http://" + r.Host
+	}
+	shell, _ := json.Marshal(pwaShell)
+	cache, _ := json.Marshal("agent-chat-" + version + "-" + commit + "-" + strings.TrimPrefix(strings.TrimPrefix(instance, "http://"), "https://"))
+	instanceJSON, _ := json.Marshal(instance)
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	serviceWorkerTmpl.Execute(w, map[string]string{
+		"Version":     version,
+		"InstanceURL": string(instanceJSON),
+		"Cache":       string(cache),
+		"Shell":       string(shell),
+	})
+}
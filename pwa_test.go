@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleManifest(t *testing.T) {
+	old := pageBranding
+	t.Cleanup(func() { pageBranding = old })
+	pageBranding = branding{Title: "Acme Ops", Accent: "#0a7"}
+
+	rec := httptest.NewRecorder()
+	handleManifest(rec, httptest.NewRequest(http.MethodGet, "/manifest.webmanifest", nil))
+	var m struct {
+		Name       string              `json:"name"`
+		StartURL   string              `json:"start_url"`
+		Display    string              `json:"display"`
+		ThemeColor string              `json:"theme_color"`
+		Icons      []map[string]string `json:"icons"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "Acme Ops" || m.StartURL != "./" || m.Display != "standalone" || m.ThemeColor != "#0a7" {
+		t.Errorf("manifest = %+v", m)
+	}
+	if len(m.Icons) != 1 || m.Icons[0]["src"] != "./icon.svg" {
+		t.Errorf("icons = %+v", m.Icons)
+	}
+}
+
+func TestHandleServiceWorker(t *testing.T) {
+	old := uiURL
+	t.Cleanup(func() { uiURL = old })
+	uiURL = "http://localhost:4567"
+
+	rec := httptest.NewRecorder()
+	handleServiceWorker(rec, httptest.NewRequest(http.MethodGet, "/sw.js", nil))
+	sw := rec.Body.String()
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/javascript") {
+		t.Errorf("Content-Type = %q", rec.Header().Get("Content-Type"))
+	}
+	for _, want := range []string{
+		`var CACHE = "agent-chat-` + version + `-` + commit + `-localhost:4567";`,
+		`"./app.js"`,
+		`'Agent Chat is offline: ' + "http://localhost:4567"`,
+	} {
+		if !strings.Contains(sw, want) {
+			t.Errorf("sw.js lacks %s", want)
+		}
+	}
+}
+
+// Every precached shell file must exist, or the service worker's install
+// (cache.addAll) fails as a whole.
+func TestPWAShellFilesExist(t *testing.T) {
+	client, err := fs.Sub(staticFS, "client-dist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range pwaShell {
+		name := strings.TrimPrefix(p, "./")
+		if name == "" || name == "custom.css" { // served by handlers
+			continue
+		}
+		if _, err := fs.Stat(client, name); err != nil {
+			t.Errorf("shell file %s: %v", p, err)
+		}
+	}
+}
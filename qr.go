@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+)
+
+// printQR is the -qr serve flag: print a QR code of the UI URL at startup.
+var printQR bool
+
+// lanURL rewrites a localhost UI URL to this machine's LAN address, which
+// is what a phone on the same network can reach. The server listens on all
+// interfaces, so the port is the same. URLs for other hosts, or machines
+// with no private IPv4 address, are returned unchanged.
+func lanURL(uiURL string, addrs []net.Addr) string {
+	u, err := url.Parse(uiURL)
+	if err != nil || (u.Hostname() != "localhost" && u.Hostname() != "127.0.0.1") {
+		return uiURL
+	}
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ip := ipnet.IP.To4(); ip != nil && ip.IsPrivate() {
+			u.Host = net.JoinHostPort(ip.String(), u.Port())
+			return u.String()
+		}
+	}
+	return uiURL
+}
+
+// writeQR prints target and its QR code.
+func writeQR(out io.Writer, target string) error {
+	q, err := encodeQR([]byte(target))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Scan to open %s\n%s", target, q.terminal())
+	return nil
+}
+
+// printStartupQR is -qr's output once the HTTP server is up. It goes to
+// stderr: stdout is the MCP stdio transport.
+func printStartupQR() {
+	addrs, _ := net.InterfaceAddrs()
+	if err := writeQR(os.Stderr, lanURL(chatURL(), addrs)); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: QR code: %v\n", err)
+	}
+}
+
+// runQR implements `agent-chat qr`: print a QR code of a running instance's
+// UI, at its LAN address, so a phone can pick up the session by scanning.
+func runQR(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("qr", flag.ContinueOnError)
+	target := fs.String("url", "", "base URL of the instance (default: the one running for this directory)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	base := *target
+	if base == "" {
+		home, err := agentChatHome()
+		if err == nil {
+			cwd, _ := os.Getwd()
+			base, err = resolveInstanceURL(home, cwd)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "agent-chat qr: %v\n", err)
+			return 1
+		}
+	}
+	addrs, _ := net.InterfaceAddrs()
+	if err := writeQR(out, lanURL(base, addrs)); err != nil {
+		fmt.Fprintf(os.Stderr, "agent-chat qr: %v\n", err)
+		return 1
+	}
+	return 0
+}
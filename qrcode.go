@@ -0,0 +1,414 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A minimal QR Code encoder (ISO/IEC 18004): byte mode, error correction
+// level M, versions 1–10 — up to 213 bytes, plenty for a chat URL. It exists
+// so `agent-chat qr` and -qr need no third-party dependency.
+
+// qrVersion is one symbol version's level-M block structure.
+type qrVersion struct {
+	total   int    // codewords in the symbol
+	ecc     int    // error-correction codewords per block
+	blocks  [2]int // blocks in group 1 and group 2
+	data    [2]int // data codewords per block in group 1 and group 2
+	aligned []int  // alignment pattern center coordinates
+}
+
+var qrVersions = []qrVersion{
+	1:  {26, 10, [2]int{1, 0}, [2]int{16, 0}, nil},
+	2:  {44, 16, [2]int{1, 0}, [2]int{28, 0}, []int{6, 18}},
+	3:  {70, 26, [2]int{1, 0}, [2]int{44, 0}, []int{6, 22}},
+	4:  {100, 18, [2]int{2, 0}, [2]int{32, 0}, []int{6, 26}},
+	5:  {134, 24, [2]int{2, 0}, [2]int{43, 0}, []int{6, 30}},
+	6:  {172, 16, [2]int{4, 0}, [2]int{27, 0}, []int{6, 34}},
+	7:  {196, 18, [2]int{4, 0}, [2]int{31, 0}, []int{6, 22, 38}},
+	8:  {242, 22, [2]int{2, 2}, [2]int{38, 39}, []int{6, 24, 42}},
+	9:  {292, 22, [2]int{3, 2}, [2]int{36, 37}, []int{6, 26, 46}},
+	10: {346, 26, [2]int{4, 1}, [2]int{43, 44}, []int{6, 28, 50}},
+}
+
+// dataCodewords is the symbol's data capacity in codewords.
+func (v qrVersion) dataCodewords() int {
+	return v.blocks[0]*v.data[0] + v.blocks[1]*v.data[1]
+}
+
+// qrCode is an encoded symbol: modules[y][x] is true for a dark module.
+type qrCode struct {
+	size     int
+	modules  [][]bool
+	function [][]bool // finder, timing, alignment, format and version areas
+}
+
+// encodeQR encodes data in the smallest version that fits.
+func encodeQR(data []byte) (*qrCode, error) {
+	for ver := 1; ver < len(qrVersions); ver++ {
+		v := qrVersions[ver]
+		countBits := 8
+		if ver >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) > 8*v.dataCodewords() {
+			continue
+		}
+		var bb qrBits
+		bb.append(0x4, 4) // byte mode
+		bb.append(len(data), countBits)
+		for _, b := range data {
+			bb.append(int(b), 8)
+		}
+		capacity := 8 * v.dataCodewords()
+		bb.append(0, min(4, capacity-len(bb)))
+		bb.append(0, (8-len(bb)%8)%8)
+		for pad := 0xEC; len(bb) < capacity; pad ^= 0xEC ^ 0x11 {
+			bb.append(pad, 8)
+		}
+		return newQRCode(ver, interleaveQR(v, bb.bytes())), nil
+	}
+	return nil, fmt.Errorf("%d bytes is too long for a QR code (max 213)", len(data))
+}
+
+// qrBits is a big-endian bit buffer.
+type qrBits []bool
+
+func (b *qrBits) append(val, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, (val>>i)&1 == 1)
+	}
+}
+
+func (b qrBits) bytes() []byte {
+	out := make([]byte, len(b)/8)
+	for i, bit := range b {
+		if bit {
+			out[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return out
+}
+
+// interleaveQR splits data into blocks, appends each block's Reed-Solomon
+// codewords, and interleaves the result in symbol order.
+func interleaveQR(v qrVersion, data []byte) []byte {
+	divisor := rsDivisor(v.ecc)
+	var blocks, eccs [][]byte
+	for g := 0; g < 2; g++ {
+		for i := 0; i < v.blocks[g]; i++ {
+			blk := data[:v.data[g]]
+			data = data[v.data[g]:]
+			blocks = append(blocks, blk)
+			eccs = append(eccs, rsRemainder(blk, divisor))
+		}
+	}
+	out := make([]byte, 0, v.total)
+	for i := 0; i < max(v.data[0], v.data[1]); i++ {
+		for _, blk := range blocks {
+			if i < len(blk) {
+				out = append(out, blk[i])
+			}
+		}
+	}
+	for i := 0; i < v.ecc; i++ {
+		for _, e := range eccs {
+			out = append(out, e[i])
+		}
+	}
+	return out
+}
+
+// rsMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func rsMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+// rsDivisor is the Reed-Solomon generator polynomial of the given degree
+// (leading coefficient omitted).
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = rsMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = rsMultiply(root, 0x02)
+	}
+	return result
+}
+
+// rsRemainder is data's error-correction codewords for divisor.
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= rsMultiply(d, factor)
+		}
+	}
+	return result
+}
+
+// newQRCode lays out codewords in a version ver symbol and applies the mask
+// with the lowest penalty.
+func newQRCode(ver int, codewords []byte) *qrCode {
+	size := 17 + 4*ver
+	q := &qrCode{size: size, modules: make([][]bool, size), function: make([][]bool, size)}
+	for i := range q.modules {
+		q.modules[i] = make([]bool, size)
+		q.function[i] = make([]bool, size)
+	}
+	q.drawFunctionPatterns(ver)
+	q.drawCodewords(codewords)
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormatBits(mask)
+		if p := q.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		q.applyMask(mask) // XOR again to undo
+	}
+	q.applyMask(best)
+	q.drawFormatBits(best)
+	return q
+}
+
+func (q *qrCode) setFunction(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.function[y][x] = true
+}
+
+func (q *qrCode) drawFunctionPatterns(ver int) {
+	for i := 0; i < q.size; i++ {
+		q.setFunction(6, i, i%2 == 0)
+		q.setFunction(i, 6, i%2 == 0)
+	}
+	for _, c := range [][2]int{{3, 3}, {q.size - 4, 3}, {3, q.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x < 0 || x >= q.size || y < 0 || y >= q.size {
+					continue
+				}
+				d := max(abs(dx), abs(dy))
+				q.setFunction(x, y, d != 2 && d != 4)
+			}
+		}
+	}
+	pos := qrVersions[ver].aligned
+	for i, cy := range pos {
+		for j, cx := range pos {
+			if (i == 0 && j == 0) || (i == 0 && j == len(pos)-1) || (i == len(pos)-1 && j == 0) {
+				continue // overlaps a finder
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.setFunction(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+	q.drawFormatBits(0) // reserve the area; redrawn once the mask is chosen
+	if ver >= 7 {
+		rem := ver
+		for i := 0; i < 12; i++ {
+			rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+		}
+		bits := ver<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := (bits>>i)&1 == 1
+			a, b := q.size-11+i%3, i/3
+			q.setFunction(a, b, dark)
+			q.setFunction(b, a, dark)
+		}
+	}
+}
+
+// drawFormatBits writes level M's format information for mask, both copies,
+// plus the always-dark module.
+func (q *qrCode) drawFormatBits(mask int) {
+	data := 0<<3 | mask // level M's format bits are 00
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 == 1 }
+	for i := 0; i <= 5; i++ {
+		q.setFunction(8, i, bit(i))
+	}
+	q.setFunction(8, 7, bit(6))
+	q.setFunction(8, 8, bit(7))
+	q.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.setFunction(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		q.setFunction(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.setFunction(8, q.size-15+i, bit(i))
+	}
+	q.setFunction(8, q.size-8, true)
+}
+
+// drawCodewords places the data in the two-column zigzag from the bottom
+// right, skipping function modules.
+func (q *qrCode) drawCodewords(data []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // skip the vertical timing column
+		}
+		for vert := 0; vert < q.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = q.size - 1 - vert // upward
+				}
+				if !q.function[y][x] && i < len(data)*8 {
+					q.modules[y][x] = (data[i>>3]>>(7-i&7))&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (q *qrCode) applyMask(mask int) {
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			var flip bool
+			switch mask {
+			case 0:
+				flip = (x+y)%2 == 0
+			case 1:
+				flip = y%2 == 0
+			case 2:
+				flip = x%3 == 0
+			case 3:
+				flip = (x+y)%3 == 0
+			case 4:
+				flip = (x/3+y/2)%2 == 0
+			case 5:
+				flip = x*y%2+x*y%3 == 0
+			case 6:
+				flip = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				flip = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if flip && !q.function[y][x] {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores the symbol by the standard's four rules; lower scans more
+// reliably.
+func (q *qrCode) penalty() int {
+	n := q.size
+	at := func(x, y int, transpose bool) bool {
+		if transpose {
+			return q.modules[x][y]
+		}
+		return q.modules[y][x]
+	}
+	score := 0
+	for _, transpose := range []bool{false, true} {
+		for y := 0; y < n; y++ {
+			run := 1
+			var line strings.Builder
+			for x := 0; x < n; x++ {
+				if at(x, y, transpose) {
+					line.WriteByte('1')
+				} else {
+					line.WriteByte('0')
+				}
+				if x > 0 && at(x, y, transpose) == at(x-1, y, transpose) {
+					run++
+					if run == 5 {
+						score += 3
+					} else if run > 5 {
+						score++
+					}
+				} else {
+					run = 1
+				}
+			}
+			l := "0000" + line.String() + "0000" // the quiet zone is light
+			score += 40 * (strings.Count(l, "10111010000") + strings.Count(l, "00001011101"))
+		}
+	}
+	dark := 0
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			if q.modules[y][x] {
+				dark++
+			}
+			if x+1 < n && y+1 < n {
+				c := q.modules[y][x]
+				if q.modules[y][x+1] == c && q.modules[y+1][x] == c && q.modules[y+1][x+1] == c {
+					score += 3
+				}
+			}
+		}
+	}
+	total := n * n
+	score += 10 * ((abs(dark*20-total*10)+total-1)/total - 1)
+	return score
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// terminal renders the symbol with half-block characters, two module rows
+// per line, inside a quiet zone. Light modules are drawn as blocks, so the
+// code reads right on the usual dark terminal; phone scanners also accept
+// the inverse on a light one.
+func (q *qrCode) terminal() string {
+	const quiet = 2
+	light := func(x, y int) bool {
+		if x < 0 || y < 0 || x >= q.size || y >= q.size {
+			return true
+		}
+		return !q.modules[y][x]
+	}
+	var b strings.Builder
+	for y := -quiet; y < q.size+quiet; y += 2 {
+		for x := -quiet; x < q.size+quiet; x++ {
+			top, bottom := light(x, y), light(x, y+1)
+			switch {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRSRemainder(t *testing.T) {
+	// "HELLO WORLD" as 1-M, from the worked example in the QR tutorial at
+	// thonky.com.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := rsRemainder(data, rsDivisor(10)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// qrReadFormat reads the top-left copy of the format information.
+func qrReadFormat(q *qrCode) int {
+	bits := 0
+	for _, p := range [][2]int{{0, 8}, {1, 8}, {2, 8}, {3, 8}, {4, 8}, {5, 8}, {7, 8}, {8, 8}, {8, 7}, {8, 5}, {8, 4}, {8, 3}, {8, 2}, {8, 1}, {8, 0}} {
+		bits <<= 1
+		if q.modules[p[1]][p[0]] {
+			bits |= 1
+		}
+	}
+	return bits
+}
+
+// qrDecode reads a symbol back: unmask, walk the zigzag, de-interleave, check
+// every block's Reed-Solomon syndromes, and return the byte-mode payload.
+func qrDecode(t *testing.T, q *qrCode) []byte {
+	t.Helper()
+	format := qrReadFormat(q) ^ 0x5412
+	if ecl := format >> 13; ecl != 0 {
+		t.Fatalf("error correction level bits %02b, want 00 (M)", ecl)
+	}
+	mask := (format >> 10) & 7
+	q.applyMask(mask)
+	defer q.applyMask(mask)
+
+	var bits qrBits
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < q.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = q.size - 1 - vert
+				}
+				if !q.function[y][x] {
+					bits = append(bits, q.modules[y][x])
+				}
+			}
+		}
+	}
+	codewords := bits[:len(bits)/8*8].bytes()
+
+	ver := (q.size - 17) / 4
+	v := qrVersions[ver]
+	var sizes []int
+	for g := 0; g < 2; g++ {
+		for i := 0; i < v.blocks[g]; i++ {
+			sizes = append(sizes, v.data[g])
+		}
+	}
+	blocks := make([][]byte, len(sizes))
+	k := 0
+	for i := 0; i < max(v.data[0], v.data[1]); i++ {
+		for b := range blocks {
+			if i < sizes[b] {
+				blocks[b] = append(blocks[b], codewords[k])
+				k++
+			}
+		}
+	}
+	full := make([][]byte, len(blocks))
+	for b := range blocks {
+		full[b] = append([]byte(nil), blocks[b]...)
+	}
+	for i := 0; i < v.ecc; i++ {
+		for b := range full {
+			full[b] = append(full[b], codewords[k])
+			k++
+		}
+	}
+	for b, cw := range full {
+		alpha := byte(1)
+		for i := 0; i < v.ecc; i++ {
+			var s byte
+			for _, c := range cw {
+				s = rsMultiply(s, alpha) ^ c
+			}
+			if s != 0 {
+				t.Fatalf("block %d: syndrome %d = %d", b, i, s)
+			}
+			alpha = rsMultiply(alpha, 2)
+		}
+	}
+
+	var data qrBits
+	for _, blk := range blocks {
+		for _, c := range blk {
+			data.append(int(c), 8)
+		}
+	}
+	countBits := 8
+	if ver >= 10 {
+		countBits = 16
+	}
+	read := func(pos, n int) int {
+		v := 0
+		for _, bit := range data[pos : pos+n] {
+			v <<= 1
+			if bit {
+				v |= 1
+			}
+		}
+		return v
+	}
+	if mode := read(0, 4); mode != 4 {
+		t.Fatalf("mode %04b, want 0100 (byte)", mode)
+	}
+	n := read(4, countBits)
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = byte(read(4+countBits+8*i, 8))
+	}
+	return out
+}
+
+func TestEncodeQRRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		ver  int
+	}{
+		{"http://192.168.1.23:51234/", 2},
+		{strings.Repeat("https://example.com/abc?", 6), 8}, // version information
+		{strings.Repeat("x", 213), 10},                     // 16-bit length, two block groups
+	} {
+		q, err := encodeQR([]byte(tc.text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ver := (q.size - 17) / 4; ver != tc.ver {
+			t.Errorf("%d bytes: version %d, want %d", len(tc.text), ver, tc.ver)
+		}
+		if got := string(qrDecode(t, q)); got != tc.text {
+			t.Errorf("decoded %q, want %q", got, tc.text)
+		}
+	}
+	if _, err := encodeQR(bytes.Repeat([]byte("x"), 214)); err == nil {
+		t.Error("214 bytes encoded")
+	}
+}
+
+func TestQRFormatBits(t *testing.T) {
+	// Level M format strings for masks 0–7, from the standard's table.
+	want := []int{0b101010000010010, 0b101000100100101, 0b101111001111100, 0b101101101001011,
+		0b100010111111001, 0b100000011001110, 0b100111110010111, 0b100101010100000}
+	q, _ := encodeQR([]byte("x"))
+	for mask, w := range want {
+		q.drawFormatBits(mask)
+		if got := qrReadFormat(q); got != w {
+			t.Errorf("mask %d: %015b, want %015b", mask, got, w)
+		}
+	}
+}
+
+func TestQRTerminal(t *testing.T) {
+	q, _ := encodeQR([]byte("http://localhost:1/"))
+	lines := strings.Split(strings.TrimSuffix(q.terminal(), "\n"), "\n")
+	if len(lines) != (q.size+4+1)/2 {
+		t.Errorf("%d lines for a %d-module symbol", len(lines), q.size)
+	}
+	for _, l := range lines {
+		if n := len([]rune(l)); n != q.size+4 {
+			t.Fatalf("line is %d columns, want %d", n, q.size+4)
+		}
+	}
+}
+
+func TestLanURL(t *testing.T) {
+	addrs := []net.Addr{
+		&net.IPNet{IP: net.ParseIP("127.0.0.1"), Mask: net.CIDRMask(8, 32)},
+		&net.IPNet{IP: net.ParseIP("fe80::1"), Mask: net.CIDRMask(64, 128)},
+		&net.IPNet{IP: net.ParseIP("192.168.1.23"), Mask: net.CIDRMask(24, 32)},
+	}
+	if got := lanURL("http://localhost:51234", addrs); got != "http://192.168.1.23:51234" {
+		t.Errorf("got %q", got)
+	}
+	if got := lanURL("https://chat.example.com", addrs); got != "https://chat.example.com" {
+		t.Errorf("non-local URL rewritten: %q", got)
+	}
+	if got := lanURL("http://localhost:51234", addrs[:2]); got != "http://localhost:51234" {
+		t.Errorf("no LAN address: %q", got)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// viewerReceipt is how far one browser tab has got through the event log:
+// the highest seq it has rendered, and the highest it rendered while the tab
+// was visible to someone.
+type viewerReceipt struct {
+	delivered int64
+	seen      int64
+}
+
+// receiptWait bounds how long a non-blocking tool waits for connected
+// browsers to render the event it just published before reporting.
+const receiptWait = 500 * time.Millisecond
+
+// Receipt records a browser tab's rendering ack: every event up to seq is on
+// its screen, and seen when the tab was visible. Acks are cumulative and only
+// move forward. viewer is the tab's own stable id, so a tab that reconnects
+// and replays history is not counted twice.
+func (eb *EventBus) Receipt(viewer string, seq int64, seen bool) {
+	eb.receiptMu.Lock()
+	defer eb.receiptMu.Unlock()
+	r, ok := eb.receipts[viewer]
+	if !ok {
+		r = &viewerReceipt{}
+		eb.receipts[viewer] = r
+	}
+	r.delivered = max(r.delivered, seq)
+	if seen {
+		r.seen = max(r.seen, seq)
+	}
+}
+
+// Receipts counts the tabs that have rendered (delivered) and seen the event
+// with the given seq.
+func (eb *EventBus) Receipts(seq int64) (delivered, seen int) {
+	eb.receiptMu.Lock()
+	defer eb.receiptMu.Unlock()
+	for _, r := range eb.receipts {
+		if r.delivered >= seq {
+			delivered++
+		}
+		if r.seen >= seq {
+			seen++
+		}
+	}
+	return delivered, seen
+}
+
+// awaitReceipts gives connected browsers up to receiptWait to render seq and
+// returns the counts. With no browser connected there is nothing to wait for.
+func (eb *EventBus) awaitReceipts(ctx context.Context, seq int64) (delivered, seen int) {
+	deadline := time.After(receiptWait)
+	for {
+		delivered, seen = eb.Receipts(seq)
+		if eb.ViewerCount() == 0 || delivered >= eb.ViewerCount() {
+			return delivered, seen
+		}
+		select {
+		case <-ctx.Done():
+			return delivered, seen
+		case <-deadline:
+			return delivered, seen
+		case <-time.After(25 * time.Millisecond):
+			// poll again
+		}
+	}
+}
+
+// receiptSummary is the receipt line appended to send_* tool results, so the
+// agent knows whether anyone actually saw its update.
+func receiptSummary(delivered, seen int) string {
+	switch {
+	case delivered == 0:
+		return "Receipt: not yet seen — no browser has shown it yet."
+	case seen == 0:
+		return fmt.Sprintf("Receipt: delivered to %s, not yet seen (tab in the background).", plural(delivered, "viewer"))
+	default:
+		return fmt.Sprintf("Receipt: delivered to %s, seen by %d.", plural(delivered, "viewer"), seen)
+	}
+}
+
+// plural formats n with word, pluralized with a trailing "s".
+func plural(n int, word string) string {
+	if n == 1 {
+		return "1 " + word
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
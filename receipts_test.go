@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestReceiptsCountEachTabOnce(t *testing.T) {
+	eb := NewEventBus()
+	eb.Receipt("tab-a", 5, false)
+	eb.Receipt("tab-a", 3, true) // stale ack: delivered stays at 5
+	eb.Receipt("tab-b", 4, true)
+	eb.Receipt("tab-b", 4, true) // replayed after a reconnect
+
+	for _, tc := range []struct {
+		seq             int64
+		delivered, seen int
+	}{
+		{3, 2, 2},
+		{4, 2, 1},
+		{5, 1, 0},
+		{6, 0, 0},
+	} {
+		d, s := eb.Receipts(tc.seq)
+		if d != tc.delivered || s != tc.seen {
+			t.Errorf("Receipts(%d) = %d, %d; want %d, %d", tc.seq, d, s, tc.delivered, tc.seen)
+		}
+	}
+}
+
+func TestReceiptSummary(t *testing.T) {
+	for _, tc := range []struct {
+		delivered, seen int
+		want            string
+	}{
+		{0, 0, "Receipt: not yet seen — no browser has shown it yet."},
+		{1, 0, "Receipt: delivered to 1 viewer, not yet seen (tab in the background)."},
+		{2, 1, "Receipt: delivered to 2 viewers, seen by 1."},
+	} {
+		if got := receiptSummary(tc.delivered, tc.seen); got != tc.want {
+			t.Errorf("receiptSummary(%d, %d) = %q, want %q", tc.delivered, tc.seen, got, tc.want)
+		}
+	}
+}
+
+// A connected tab that acks what it renders shows up in send_progress's
+// result and in get_status.
+func TestSendProgressReportsReceipt(t *testing.T) {
+	eb := NewEventBus()
+	ch := eb.Subscribe()
+	defer eb.Unsubscribe(ch)
+	go func() {
+		for e := range ch {
+			eb.Receipt("tab", e.Seq, true)
+		}
+	}()
+
+	got, _ := callTool(t, eb, "send_progress", map[string]any{"text": "building"})
+	if !strings.Contains(got, "Receipt: delivered to 1 viewer, seen by 1.") {
+		t.Errorf("send_progress result = %q", got)
+	}
+
+	out, _ := callTool(t, eb, "get_status", nil)
+	var st agentStatus
+	if err := json.Unmarshal([]byte(out), &st); err != nil {
+		t.Fatalf("get_status: %v: %s", err, out)
+	}
+	if st.Viewers != 1 || st.LastMessage == nil || st.LastMessage.Seq != 1 || st.LastMessage.Delivered != 1 || st.LastMessage.Seen != 1 {
+		t.Errorf("status = %+v (last %+v)", st, st.LastMessage)
+	}
+}
+
+func TestSendProgressWithoutViewer(t *testing.T) {
+	eb := NewEventBus()
+	got, _ := callTool(t, eb, "send_progress", map[string]any{"text": "building"})
+	if !strings.Contains(got, "Receipt: not yet seen") {
+		t.Errorf("send_progress result = %q", got)
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/choonkeat/agent-chat/pkg/wire"
+)
+
+// redact_message scrubs a message that should never have been sent — a
+// pasted secret, someone's personal data — after the fact: its text becomes
+// redactedText and its attachments, drawing, data and link previews are
+// dropped, in memory and in the event log, which is rewritten in place.
+// Copies go too: the promptAnswered events that quote the message as the
+// answer to quick replies; the message itself if it is still waiting in an
+// agent's queue (it is then marked consumed, so a restart does not queue it
+// again) or in its redelivery limbo; the quotes of it carried by queued
+// replies and reactions; a drawing's out-of-band payload, unless another
+// event shares it; and its lines in rotated logs (events.jsonl.1, ...)
+// beside the live one. A "messageRedacted" event (ReplyTo the message, and
+// one per scrubbed answer) tells open tabs to blank them and stays in the
+// log as the record that it happened. The streaming chat-log export is
+// re-rendered; upload files themselves are left alone, since other
+// messages may share them. On a -hash-chain log the rewritten line no
+// longer matches its hash, so verify reports it.
+
+// redactedText replaces a redacted message's text.
+const redactedText = "[redacted]"
+
+// redactEvent returns e with its content scrubbed.
+func redactEvent(e Event) Event {
+	e.Text = redactedText
+	e.Files = nil
+	e.Instructions = nil
+	e.InstructionsRef = ""
+	e.Data = nil
+	e.Links = nil
+	e.QuickReplies = nil
+	e.Math = false
+	e.Redacted = true
+	return e
+}
+
+// Redact scrubs the message with seq target (and the link previews of its
+// URLs, and the answers that repeat it), takes it and its quotes out of the
+// agents' queues, shreds its drawing payload, rewrites the event logs to
+// match and publishes messageRedacted.
+func (eb *EventBus) Redact(target int64) error {
+	e, ok := eb.eventAt(target)
+	if !ok {
+		return fmt.Errorf("no message #%d", target)
+	}
+	if !isBubble(e) {
+		return fmt.Errorf("#%d is not a message", target)
+	}
+	if e.Redacted {
+		return nil
+	}
+	changed := map[int64]Event{}
+	var answers []int64
+	eb.mu.Lock()
+	for i, ev := range eb.eventLog {
+		if ev.Seq == target || (ev.Type == "linkPreview" && ev.ReplyTo == target) || answerCopies(ev, e) {
+			eb.eventLog[i] = redactEvent(ev)
+			if ev.Type == "linkPreview" {
+				eb.eventLog[i].Text = ""
+			}
+			if ev.Type == "promptAnswered" {
+				answers = append(answers, ev.Seq)
+			}
+			changed[ev.Seq] = eb.eventLog[i]
+		}
+	}
+	eb.index = newSearchIndex()
+	shared := false
+	for _, ev := range eb.eventLog {
+		eb.index.add(ev)
+		shared = shared || (e.InstructionsRef != "" && ev.InstructionsRef == e.InstructionsRef)
+	}
+	history := make([]Event, len(eb.eventLog))
+	copy(history, eb.eventLog)
+	eb.mu.Unlock()
+
+	if e.InstructionsRef != "" && !shared && eb.blobs != nil {
+		if err := eb.blobs.remove(e.InstructionsRef); err != nil {
+			return fmt.Errorf("shred drawing: %w", err)
+		}
+	}
+	if err := eb.rewriteLogged(changed); err != nil {
+		return fmt.Errorf("rewrite event log: %w", err)
+	}
+	if err := chatStream.Rerender(history); err != nil {
+		return fmt.Errorf("re-render chat-log export: %w", err)
+	}
+	withdrawn := false
+	for _, s := range eb.allSessions() {
+		withdrawn = s.scrubQueued(e.ID, target) || withdrawn
+	}
+	if withdrawn {
+		eb.Publish(Event{Type: "userMessagesConsumed", IDs: []string{e.ID}})
+	}
+	eb.Publish(Event{Type: "messageRedacted", ReplyTo: target})
+	for _, seq := range answers {
+		eb.Publish(Event{Type: "messageRedacted", ReplyTo: seq})
+	}
+	return nil
+}
+
+// answerCopies reports whether ev is a promptAnswered event that repeats
+// msg: the message was typed while quick replies were showing, or is an
+// ack's reply. Answers carry the message's ID; older ones, logged before
+// they did, are matched on their text.
+func answerCopies(ev, msg Event) bool {
+	if ev.Type != "promptAnswered" || ev.Seq < msg.Seq || ev.Redacted {
+		return false
+	}
+	if ev.ID != "" {
+		return ev.ID == msg.ID
+	}
+	return msg.Text != "" && ev.Text == msg.Text
+}
+
+// scrubQueued drops the message with id from s's queue and limbo, and
+// replaces the quote of message target carried by replies and reactions
+// there. It reports whether the message was still queued.
+func (s *agentSession) scrubQueued(id string, target int64) bool {
+	scrub := func(msgs []UserMessage) ([]UserMessage, bool) {
+		var keep []UserMessage
+		found := false
+		for _, m := range msgs {
+			if id != "" && m.ID == id {
+				found = true
+				continue
+			}
+			if m.ReplyTo == target {
+				m.Quote = redactedText
+			}
+			keep = append(keep, m)
+		}
+		return keep, found
+	}
+	var queued []UserMessage
+drain:
+	for {
+		select {
+		case m := <-s.msgQueue:
+			queued = append(queued, m)
+		default:
+			break drain
+		}
+	}
+	queued, found := scrub(queued)
+	for _, m := range queued {
+		s.msgQueue <- m
+	}
+	s.limboMu.Lock()
+	if s.limbo != nil {
+		s.limbo, _ = scrub(s.limbo)
+	}
+	s.limboMu.Unlock()
+	return found
+}
+
+// seqOfID is the seq of the event with id (a user message's), or 0.
+func (eb *EventBus) seqOfID(id string) int64 {
+	eb.mu.RLock()
+	defer eb.mu.RUnlock()
+	for _, e := range eb.eventLog {
+		if e.ID == id && isBubble(e) {
+			return e.Seq
+		}
+	}
+	return 0
+}
+
+// rewriteLogged replaces the event log lines of the events in changed
+// (keyed by seq) and swaps the rewritten file in for the one being
+// appended to. Lines not found there were rotated out, so the rotated logs
+// beside it (events.jsonl.1, ...) are rewritten too. A chained line keeps
+// its old prev_hash and hash.
+func (eb *EventBus) rewriteLogged(changed map[int64]Event) error {
+	eb.logMu.Lock()
+	defer eb.logMu.Unlock()
+	if eb.logFile == nil || len(changed) == 0 {
+		return nil
+	}
+	path := eb.logFile.Name()
+	left, err := rewriteLogFile(path, changed)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	eb.logFile.Close()
+	eb.logFile = f
+	rotated, _ := filepath.Glob(path + ".*")
+	for _, p := range rotated {
+		if len(left) == 0 {
+			break
+		}
+		if !archiveLogName.MatchString(p) || !strings.HasPrefix(p, path+".") {
+			continue
+		}
+		if left, err = rewriteLogFile(p, left); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewriteLogFile rewrites the lines of the log at path that hold an event
+// in changed, matched on seq, type and timestamp (a rotated log from an
+// earlier run may reuse seqs), and returns the events it did not find. A
+// file with none of them is left alone.
+func rewriteLogFile(path string, changed map[int64]Event) (map[int64]Event, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	left := maps.Clone(changed)
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var head struct {
+			Seq       int64  `json:"seq"`
+			Type      string `json:"type"`
+			Timestamp int64  `json:"ts"`
+		}
+		json.Unmarshal(line, &head)
+		if e, ok := changed[head.Seq]; ok && head.Seq != 0 && head.Type == e.Type && head.Timestamp == e.Timestamp {
+			e.SchemaVersion = wire.SchemaVersion
+			redacted, err := json.Marshal(e)
+			if err != nil {
+				return nil, err
+			}
+			if m := hashChainSuffix.FindSubmatchIndex(line); m != nil {
+				redacted = append(redacted[:len(redacted)-1], line[m[0]:]...)
+			}
+			line = redacted
+			delete(left, head.Seq)
+		}
+		out.Write(line)
+		out.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(left) == len(changed) {
+		return left, nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".redact-*")
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(path); err == nil {
+		tmp.Chmod(info.Mode().Perm())
+	}
+	if _, err := tmp.Write(out.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return left, nil
+}
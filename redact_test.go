@@ -0,0 +1,183 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactMessage(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "events.jsonl")
+	eb, err := NewEventBusWithLog(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eb.Close()
+	if err := eb.EnableHashChain(logPath); err != nil {
+		t.Fatal(err)
+	}
+	eb.Publish(Event{Type: "agentMessage", Text: "before"})
+	eb.Publish(Event{Type: "userMessage", ID: "m1", Text: "my key is sk-live-123 https://example.com/?k=sk-live-123", Files: []FileRef{{Name: "key.txt", Path: "/tmp/key.txt"}}})
+	eb.Publish(Event{Type: "linkPreview", ReplyTo: 2, Links: []LinkPreview{{URL: "https://example.com/?k=sk-live-123"}}})
+	eb.Publish(Event{Type: "agentMessage", Text: "after"})
+
+	got, isErr := callTool(t, eb, "redact_message", map[string]any{"id": "m1"})
+	if isErr || got != "Redacted #2." {
+		t.Fatalf("redact_message = %q (error %v)", got, isErr)
+	}
+	if _, isErr := callTool(t, eb, "redact_message", map[string]any{"seq": 3}); !isErr {
+		t.Error("redacted a linkPreview event as if it were a message")
+	}
+	if _, isErr := callTool(t, eb, "redact_message", map[string]any{"seq": 99}); !isErr {
+		t.Error("redacted a message that does not exist")
+	}
+	if _, isErr := callTool(t, eb, "redact_message", map[string]any{}); !isErr {
+		t.Error("redacted without a seq or id")
+	}
+
+	check := func(where string, events []Event) {
+		t.Helper()
+		var redactedSeen, marker bool
+		for _, e := range events {
+			if strings.Contains(e.Text, "sk-live") || (e.Type == "linkPreview" && len(e.Links) > 0) {
+				t.Errorf("%s: secret survived in #%d: %+v", where, e.Seq, e)
+			}
+			if e.Seq == 2 {
+				redactedSeen = e.Redacted && e.Text == redactedText && len(e.Files) == 0
+			}
+			if e.Type == "messageRedacted" && e.ReplyTo == 2 {
+				marker = true
+			}
+		}
+		if !redactedSeen || !marker {
+			t.Errorf("%s: redacted=%v messageRedacted=%v", where, redactedSeen, marker)
+		}
+	}
+	history, _ := eb.History()
+	check("memory", history)
+	logged, _, _ := loadEventLog(logPath)
+	check("log", logged)
+	if hits, _ := eb.Search("sk-live", false, 10); len(hits) != 0 {
+		t.Errorf("search still finds the secret: %+v", hits)
+	}
+
+	data, _ := os.ReadFile(logPath)
+	if strings.Contains(string(data), "sk-live") {
+		t.Errorf("secret still in the log file:\n%s", data)
+	}
+	rep, _ := verifyEventLog(strings.NewReader(string(data)))
+	if rep.BrokenAt != 2 {
+		t.Errorf("verify after redaction: %+v, want the chain broken at the redacted line", rep)
+	}
+
+	// The bus keeps appending to the rewritten file.
+	eb.Publish(Event{Type: "agentMessage", Text: "still logging"})
+	if events, _, _ := loadEventLog(logPath); events[len(events)-1].Text != "still logging" {
+		t.Errorf("append after rewrite lost: %+v", events[len(events)-1])
+	}
+}
+
+func TestRedactQueuedAnswer(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "events.jsonl")
+	eb, err := NewEventBusWithLog(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eb.Publish(Event{Type: "agentMessage", Text: "Which password?", QuickReplies: []string{"the old one"}})
+	id := eb.Receive(UserMessage{Text: "it is hunter2"})
+	eb.Publish(Event{Type: "promptAnswered", ID: id, ReplyTo: 1, Text: "it is hunter2"})
+	eb.Publish(Event{Type: "promptAnswered", ReplyTo: 1, Text: "it is hunter2"}) // logged before answers carried the ID
+
+	if got, isErr := callTool(t, eb, "redact_message", map[string]any{"id": id}); isErr || got != "Redacted #2." {
+		t.Fatalf("redact_message = %q (error %v)", got, isErr)
+	}
+	if eb.HasQueuedMessages() {
+		t.Errorf("the redacted message is still queued: %+v", eb.DrainMessages())
+	}
+	history, _ := eb.History()
+	markers := map[int64]bool{}
+	for _, e := range history {
+		if strings.Contains(e.Text, "hunter2") {
+			t.Errorf("secret survived in #%d: %+v", e.Seq, e)
+		}
+		if e.Type == "messageRedacted" {
+			markers[e.ReplyTo] = true
+		}
+	}
+	if !markers[2] || !markers[3] || !markers[4] {
+		t.Errorf("messageRedacted for %v, want 2, 3 and 4", markers)
+	}
+	eb.Close()
+
+	data, _ := os.ReadFile(logPath)
+	if strings.Contains(string(data), "hunter2") {
+		t.Errorf("secret still in the log file:\n%s", data)
+	}
+	// A restart does not queue it again.
+	eb, err = NewEventBusWithLog(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eb.Close()
+	if msgs := eb.DrainMessages(); len(msgs) != 0 {
+		t.Errorf("requeued after a restart: %+v", msgs)
+	}
+}
+
+// Copies outside the live log and the message itself: quotes in queued
+// replies, reactions and limbo, a drawing's payload, and rotated logs.
+func TestRedactCopies(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "events.jsonl")
+	eb, err := NewEventBusWithLog(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eb.Close()
+	eb.Publish(Event{Type: "userMessage", ID: "m1", Text: "token ghp_abc123", Timestamp: 1000})
+	draw := eb.Publish(Event{Type: "draw", Instructions: bigDrawing(2000)})
+	history, _ := eb.History()
+	ref := history[1].InstructionsRef
+	if ref == "" {
+		t.Fatal("drawing was kept inline")
+	}
+
+	// logrotate (copytruncate) moves what was logged so far aside; an older
+	// rotation holds a different chat that reused seq 1.
+	data, _ := os.ReadFile(logPath)
+	os.WriteFile(logPath+".1", data, 0o644)
+	os.Truncate(logPath, 0)
+	older := `{"type":"userMessage","seq":1,"id":"old","text":"keep me","ts":5}` + "\n"
+	os.WriteFile(logPath+".2", []byte(older), 0o644)
+
+	eb.ReceiveUserReply("did you see it?", nil, 1)
+	if _, err := eb.React(1, "👎"); err != nil {
+		t.Fatal(err)
+	}
+	eb.SetLimbo([]UserMessage{{ID: "m1", Text: "token ghp_abc123"}, {ID: "r", ReplyTo: 1, Quote: "token ghp_abc123"}})
+
+	// Redact directly: a tool call from the agent would itself ack limbo.
+	for _, seq := range []int64{1, draw} {
+		if err := eb.Redact(seq); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	limbo := eb.Limbo()
+	if len(limbo) != 1 || limbo[0].ID != "r" {
+		t.Errorf("limbo = %+v, want only the reply", limbo)
+	}
+	if got := FormatMessages(append(limbo, eb.DrainMessages()...)); strings.Contains(got, "ghp_") || !strings.Contains(got, redactedText) {
+		t.Errorf("agent-facing copies:\n%s", got)
+	}
+	if _, err := eb.blobs.get(ref); !os.IsNotExist(err) {
+		t.Errorf("drawing payload survived: %v", err)
+	}
+	if rotated, _ := os.ReadFile(logPath + ".1"); strings.Contains(string(rotated), "ghp_") || strings.Contains(string(rotated), `"drawRect"`) {
+		t.Errorf("rotated log keeps the secret:\n%s", rotated)
+	}
+	if kept, _ := os.ReadFile(logPath + ".2"); string(kept) != older {
+		t.Errorf("unrelated rotated log changed:\n%s", kept)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// replayable reduces a logged event to what replay republishes: the visible
+// chat turns, stripped of ack ids (nobody is waiting on them) and quick
+// replies (there is no agent to answer them). Bookkeeping events — consumed
+// markers, tool markers, unsends — are not replayed. Reports false for events
+// that are skipped.
+func replayable(e Event) (Event, bool) {
+	switch eventKind(e) {
+	case "userMessage", "agentMessage", "verbalReply", "draw":
+	default:
+		return Event{}, false
+	}
+	return Event{Type: e.Type, Text: e.Text, Files: e.Files, Instructions: e.Instructions, Data: e.Data}, true
+}
+
+// publishReplayed publishes a replayable event on eb. A replayed user message
+// is published already consumed, so it never enters the live agent's queue
+// nor resurfaces as a pending bubble after a restart.
+func publishReplayed(eb *EventBus, e Event) {
+	if e.Type == "userMessage" {
+		eb.PublishConsumedUserMessage(e.Text, e.Files)
+		return
+	}
+	eb.Publish(e)
+}
+
+// replayEvents feeds the replayable events to publish, sleeping between them
+// for the originally recorded gap divided by speed and capped at maxGap (0
+// means uncapped). speed <= 0 replays without delays. Returns early with
+// ctx's error when cancelled.
+func replayEvents(ctx context.Context, events []Event, speed float64, maxGap time.Duration, publish func(Event) error) (int, error) {
+	var lastTs int64
+	n := 0
+	for _, e := range events {
+		out, ok := replayable(e)
+		if !ok {
+			continue
+		}
+		if speed > 0 && lastTs > 0 && e.Timestamp > lastTs {
+			gap := time.Duration(float64(time.Duration(e.Timestamp-lastTs)*time.Millisecond) / speed)
+			if maxGap > 0 && gap > maxGap {
+				gap = maxGap
+			}
+			select {
+			case <-ctx.Done():
+				return n, ctx.Err()
+			case <-time.After(gap):
+			}
+		}
+		if e.Timestamp > 0 {
+			lastTs = e.Timestamp
+		}
+		if err := publish(out); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// handleReplay serves POST /api/replay: publish one event sent by
+// `agent-chat replay -url` into this instance's chat. Only replayable event
+// types are accepted.
+func handleReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var e Event
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxExportBytes)).Decode(&e); err != nil {
+		http.Error(w, "invalid event: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	out, ok := replayable(e)
+	if !ok {
+		http.Error(w, fmt.Sprintf("event type %q is not replayable", e.Type), http.StatusBadRequest)
+		return
+	}
+	publishReplayed(bus, out)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// postReplayEvent sends e to a running instance's /api/replay.
+func postReplayEvent(ctx context.Context, baseURL string, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	client, endpoint := httpClientFor(strings.TrimRight(baseURL, "/") + "/api/replay")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// runReplay implements `agent-chat replay`: re-drive a JSONL event log into a
+// chat UI with its original pacing (scaled by -speed). With -url the events
+// go to that running instance; otherwise a temporary HTTP-only server is
+// started, the browser opened, and the server kept up after the replay until
+// Ctrl+C so the result can be inspected.
+func runReplay(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	target := fs.String("url", "", "base URL of a running instance (see `agent-chat list`); default: start a temporary server")
+	speed := fs.Float64("speed", 1, "playback speed multiplier; 0 replays without delays")
+	maxGap := fs.Duration("max-gap", 10*time.Second, "cap on any single pause between events; 0 keeps the original gaps")
+	fs.StringVar(&uploadDir, "upload-dir", "", "temporary server only: directory the log's attachments were uploaded to")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: agent-chat replay [-url http://host:port] [-speed 1] [-max-gap 10s] <events.jsonl>\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	if _, err := os.Stat(fs.Arg(0)); err != nil {
+		fmt.Fprintf(os.Stderr, "agent-chat replay: %v\n", err)
+		return 1
+	}
+	events, _, _ := loadEventLog(fs.Arg(0))
+	events = withoutWithdrawn(logBlobs(fs.Arg(0)).hydrate(events))
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer stop()
+
+	var publish func(Event) error
+	if *target != "" {
+		publish = func(e Event) error { return postReplayEvent(ctx, *target, e) }
+	} else {
+		if uploadDir == "" {
+			dir, err := os.MkdirTemp("", "agent-chat-uploads-*")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "agent-chat replay: %v\n", err)
+				return 1
+			}
+			defer os.RemoveAll(dir)
+			uploadDir = dir
+		}
+		bus = NewEventBus()
+		defer bus.Close()
+		mcpServerRef = mcp.NewServer(&mcp.Implementation{Name: "agent-chat", Version: version}, nil)
+		if err := ensureHTTPServer(); err != nil {
+			fmt.Fprintf(os.Stderr, "agent-chat replay: %v\n", err)
+			return 1
+		}
+		if err := bus.WaitForSubscriber(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "agent-chat replay: %v\n", err)
+			return 1
+		}
+		publish = func(e Event) error { publishReplayed(bus, e); return nil }
+	}
+
+	n, err := replayEvents(ctx, events, *speed, *maxGap, publish)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintf(os.Stderr, "agent-chat replay: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(out, "replayed %d events\n", n)
+	if *target == "" && err == nil {
+		fmt.Fprintf(os.Stderr, "Replay finished; press Ctrl+C to stop the server.\n")
+		<-ctx.Done()
+	}
+	return 0
+}
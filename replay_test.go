@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReplayEventsFiltersAndPaces(t *testing.T) {
+	events := []Event{
+		{Type: "userMessage", ID: "a", Text: "hi", Timestamp: 1000},
+		{Type: "userMessagesConsumed", IDs: []string{"a"}, Timestamp: 1100},
+		{Type: "toolMarker", AgentToolName: "check_messages", AgentToolSeq: 1},
+		{Type: "agentMessage", Text: "hello", AckID: "ack-1", QuickReplies: []string{"ok"}, Timestamp: 61000},
+		{Type: "draw", Instructions: []any{map[string]any{"type": "clear"}}, Timestamp: 61200},
+	}
+	var got []Event
+	start := time.Now()
+	n, err := replayEvents(context.Background(), events, 2, 50*time.Millisecond, func(e Event) error {
+		got = append(got, e)
+		return nil
+	})
+	if err != nil || n != 3 {
+		t.Fatalf("replayEvents = %d, %v; want 3, nil", n, err)
+	}
+	// 60s gap is capped at 50ms; 200ms gap at speed 2 is 100ms -> capped too.
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("elapsed %v, want ~100ms", elapsed)
+	}
+	if got[1].AckID != "" || got[1].QuickReplies != nil {
+		t.Errorf("ack id and quick replies should be stripped: %+v", got[1])
+	}
+	if got[2].Type != "draw" || len(got[2].Instructions) != 1 {
+		t.Errorf("draw not replayed intact: %+v", got[2])
+	}
+}
+
+func TestReplayEventsStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	events := []Event{
+		{Type: "agentMessage", Text: "one", Timestamp: 1000},
+		{Type: "agentMessage", Text: "two", Timestamp: 5000},
+	}
+	n, err := replayEvents(ctx, events, 1, 0, func(Event) error { return nil })
+	if err != context.Canceled || n != 1 {
+		t.Errorf("replayEvents = %d, %v; want 1, context.Canceled", n, err)
+	}
+}
+
+func TestHandleReplayPublishesConsumedUserMessage(t *testing.T) {
+	orig := bus
+	bus = NewEventBus()
+	t.Cleanup(func() { bus = orig })
+
+	srv := httptest.NewServer(http.HandlerFunc(handleReplay))
+	defer srv.Close()
+	ctx := context.Background()
+	srv.URL += "/" // postReplayEvent trims it
+	if err := postReplayEvent(ctx, srv.URL, Event{Type: "userMessage", ID: "x", Text: "from the log"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := postReplayEvent(ctx, srv.URL, Event{Type: "toolMarker"}); err == nil {
+		t.Error("non-replayable event should be rejected")
+	}
+
+	history, _ := bus.History()
+	if len(history) != 2 || history[0].Type != "userMessage" || history[1].Type != "userMessagesConsumed" {
+		t.Fatalf("history = %+v", history)
+	}
+	if history[0].ID == "x" {
+		t.Error("replayed message should get a fresh id")
+	}
+	if pending := pendingUserMessages(history); len(pending) != 0 {
+		t.Errorf("replayed user message must not be pending: %+v", pending)
+	}
+}
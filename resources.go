@@ -3,6 +3,10 @@ package main
 import (
 	"context"
 	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
@@ -67,4 +71,144 @@ func registerResources(server *mcp.Server) {
 			},
 		}, nil
 	})
+
+	server.AddResource(&mcp.Resource{
+		URI:         "whiteboard://themes",
+		Name:        "themes",
+		Description: "The palettes draw's theme accepts, as JSON: each one's background, ink and the stroke and fill of its color roles.",
+		MIMEType:    "application/json",
+	}, func(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+		data, err := json.MarshalIndent(drawPalettes, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return &mcp.ReadResourceResult{
+			Contents: []*mcp.ResourceContents{
+				{
+					URI:      "whiteboard://themes",
+					MIMEType: "application/json",
+					Text:     string(data),
+				},
+			},
+		}, nil
+	})
+
+	server.AddResource(&mcp.Resource{
+		URI:         "whiteboard://examples",
+		Name:        "examples",
+		Description: "Example draw payloads as JSON (box-and-arrow, sequence, flowchart, themed shapes, layers): each one's name, description, optional theme and instructions. Drawn at /docs/gallery.",
+		MIMEType:    "application/json",
+	}, func(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+		return &mcp.ReadResourceResult{
+			Contents: []*mcp.ResourceContents{
+				{
+					URI:      "whiteboard://examples",
+					MIMEType: "application/json",
+					Text:     drawExamplesJSON,
+				},
+			},
+		}, nil
+	})
+}
+
+// Chat history resources. chat://history is the whole event log,
+// chat://history/recent its tail, and chat://history/since/{seq} the events
+// after a cursor — the same cursor the browser reconnects with. Each reads as
+// a JSON array of events.
+const (
+	chatHistoryURI       = "chat://history"
+	chatHistoryRecentURI = "chat://history/recent"
+	chatHistorySinceURI  = "chat://history/since/"
+	chatHistoryRecentN   = 50
+)
+
+// registerChatHistoryResources exposes eb's event log as MCP resources.
+// Subscribing clients get notifications/resources/updated for chat://history
+// and chat://history/recent on every new event (see watchChatHistory), so they
+// can follow the conversation without polling check_messages.
+func registerChatHistoryResources(server *mcp.Server, eb *EventBus) {
+	read := func(uri string, events []Event) (*mcp.ReadResourceResult, error) {
+		if events == nil {
+			events = []Event{}
+		}
+		data, err := json.Marshal(events)
+		if err != nil {
+			return nil, err
+		}
+		return &mcp.ReadResourceResult{
+			Contents: []*mcp.ResourceContents{
+				{URI: uri, MIMEType: "application/json", Text: string(data)},
+			},
+		}, nil
+	}
+
+	server.AddResource(&mcp.Resource{
+		URI:         chatHistoryURI,
+		Name:        "chat-history",
+		Description: "The full chat event log as a JSON array (user and agent messages, drawings, consumed markers). Subscribe for updates.",
+		MIMEType:    "application/json",
+	}, func(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+		events, _ := eb.History()
+		return read(chatHistoryURI, events)
+	})
+
+	server.AddResource(&mcp.Resource{
+		URI:         chatHistoryRecentURI,
+		Name:        "chat-history-recent",
+		Description: fmt.Sprintf("The last %d chat events as a JSON array. Subscribe for updates.", chatHistoryRecentN),
+		MIMEType:    "application/json",
+	}, func(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+		events, _ := eb.History()
+		if len(events) > chatHistoryRecentN {
+			events = events[len(events)-chatHistoryRecentN:]
+		}
+		return read(chatHistoryRecentURI, events)
+	})
+
+	server.AddResourceTemplate(&mcp.ResourceTemplate{
+		URITemplate: chatHistorySinceURI + "{seq}",
+		Name:        "chat-history-since",
+		Description: "Chat events with seq greater than {seq}, as a JSON array — page through the log by passing the last seq you have.",
+		MIMEType:    "application/json",
+	}, func(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+		uri := req.Params.URI
+		seq, err := strconv.ParseInt(strings.TrimPrefix(uri, chatHistorySinceURI), 10, 64)
+		if err != nil || !strings.HasPrefix(uri, chatHistorySinceURI) {
+			return nil, mcp.ResourceNotFoundError(uri)
+		}
+		return read(uri, eb.EventsSince(seq))
+	})
+}
+
+// subscribeChatHistory and unsubscribeChatHistory are the server's resource
+// subscription hooks. The SDK tracks who subscribed to what; these only
+// restrict subscriptions to the resources that actually change.
+func subscribeChatHistory(ctx context.Context, req *mcp.SubscribeRequest) error {
+	switch req.Params.URI {
+	case chatHistoryURI, chatHistoryRecentURI:
+		return nil
+	}
+	return fmt.Errorf("resource %q does not support subscriptions", req.Params.URI)
+}
+
+func unsubscribeChatHistory(ctx context.Context, req *mcp.UnsubscribeRequest) error {
+	return nil
+}
+
+// watchChatHistory sends resources/updated for the chat history resources
+// whenever eb publishes an event, until ctx is done. The SDK only notifies
+// sessions that subscribed, so this is cheap when nobody has.
+func watchChatHistory(ctx context.Context, server *mcp.Server, eb *EventBus) {
+	ch := eb.Observe()
+	defer eb.Unsubscribe(ch)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ch:
+			for _, uri := range []string{chatHistoryURI, chatHistoryRecentURI} {
+				server.ResourceUpdated(ctx, &mcp.ResourceUpdatedNotificationParams{URI: uri})
+			}
+		}
+	}
 }
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestChatHistoryResourcesReadAndNotify(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	eb := NewEventBus()
+	for i := 0; i < chatHistoryRecentN+5; i++ {
+		eb.Publish(Event{Type: "agentMessage", Text: "m"})
+	}
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "agent-chat", Version: "test"}, &mcp.ServerOptions{
+		SubscribeHandler:   subscribeChatHistory,
+		UnsubscribeHandler: unsubscribeChatHistory,
+	})
+	registerChatHistoryResources(server, eb)
+	go watchChatHistory(ctx, server, eb)
+
+	updated := make(chan string, 16)
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "test"}, &mcp.ClientOptions{
+		ResourceUpdatedHandler: func(_ context.Context, req *mcp.ResourceUpdatedNotificationRequest) {
+			updated <- req.Params.URI
+		},
+	})
+	st, ct := mcp.NewInMemoryTransports()
+	ss, err := server.Connect(ctx, st, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+	cs, err := client.Connect(ctx, ct, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cs.Close()
+
+	count := func(uri string) int {
+		t.Helper()
+		res, err := cs.ReadResource(ctx, &mcp.ReadResourceParams{URI: uri})
+		if err != nil {
+			t.Fatalf("read %s: %v", uri, err)
+		}
+		var events []Event
+		if err := json.Unmarshal([]byte(res.Contents[0].Text), &events); err != nil {
+			t.Fatalf("decode %s: %v", uri, err)
+		}
+		return len(events)
+	}
+	if n := count(chatHistoryURI); n != chatHistoryRecentN+5 {
+		t.Errorf("history has %d events", n)
+	}
+	if n := count(chatHistoryRecentURI); n != chatHistoryRecentN {
+		t.Errorf("recent has %d events", n)
+	}
+	if n := count("chat://history/since/50"); n != 5 {
+		t.Errorf("since/50 has %d events", n)
+	}
+
+	if err := cs.Subscribe(ctx, &mcp.SubscribeParams{URI: chatHistoryRecentURI}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Subscribe(ctx, &mcp.SubscribeParams{URI: "whiteboard://instructions"}); err == nil {
+		t.Error("static resources should not accept subscriptions")
+	}
+	eb.Publish(Event{Type: "agentMessage", Text: "new"})
+	select {
+	case uri := <-updated:
+		if uri != chatHistoryRecentURI {
+			t.Errorf("updated %q, want only the subscribed URI", uri)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no resources/updated notification")
+	}
+	done, stop := context.WithCancel(context.Background())
+	stop()
+	if err := eb.WaitForSubscriber(done); err == nil {
+		t.Error("the history watcher must not count as a viewer")
+	}
+}
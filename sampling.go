@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// askContextTurns is how much recent chat an "Ask agent" question carries.
+const askContextTurns = 30
+
+// samplingSession returns a connected MCP session whose client declared the
+// sampling capability, or nil when none did.
+func samplingSession(server *mcp.Server) *mcp.ServerSession {
+	if server == nil {
+		return nil
+	}
+	for ss := range server.Sessions() {
+		if p := ss.InitializeParams(); p != nil && p.Capabilities != nil && p.Capabilities.Sampling != nil {
+			return ss
+		}
+	}
+	return nil
+}
+
+// askAgent answers an "Ask agent" question from the UI through MCP sampling
+// instead of the agent's message queue: the question is published as an
+// aside user message (consumed at once, so check_messages never sees it),
+// the client's model is asked with recent chat as context, and the reply is
+// published as an aside agentMessage. Asides leave the agent's turn state —
+// pending quick replies, the loading indicator — untouched. Failures are
+// reported to the browsers as a transient askFailed message.
+func askAgent(ctx context.Context, server *mcp.Server, eb *EventBus, question string) {
+	defer recoverCrash("ask agent")
+	fail := func(err error) {
+		eb.PublishTransient(map[string]string{"type": "askFailed", "error": err.Error()})
+	}
+	ss := samplingSession(server)
+	if ss == nil {
+		fail(fmt.Errorf("the connected MCP client does not support sampling"))
+		return
+	}
+
+	history, _ := eb.History()
+	var prompt bytes.Buffer
+	data := sessionPromptData{Turns: transcriptTurns(history, askContextTurns), Focus: question}
+	if err := sessionPromptsTmpl.ExecuteTemplate(&prompt, "ask-agent", data); err != nil {
+		fail(err)
+		return
+	}
+
+	id := uuid.New().String()
+	eb.Publish(Event{Type: "userMessage", ID: id, Text: question, Aside: true})
+	eb.Publish(Event{Type: "userMessagesConsumed", IDs: []string{id}})
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+	res, err := ss.CreateMessage(ctx, &mcp.CreateMessageParams{
+		MaxTokens: 1024,
+		Messages: []*mcp.SamplingMessage{
+			{Role: "user", Content: &mcp.TextContent{Text: prompt.String()}},
+		},
+	})
+	if err != nil {
+		fail(fmt.Errorf("sampling request failed: %w", err))
+		return
+	}
+	text, ok := res.Content.(*mcp.TextContent)
+	if !ok || strings.TrimSpace(text.Text) == "" {
+		fail(fmt.Errorf("the model returned no text"))
+		return
+	}
+	eb.Publish(Event{Type: "agentMessage", Text: text.Text, Aside: true})
+}
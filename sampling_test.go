@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// connectSamplingClient connects an in-memory client to server; when answer
+// is non-nil the client supports sampling and replies with it.
+func connectSamplingClient(t *testing.T, server *mcp.Server, answer func(prompt string) string) {
+	t.Helper()
+	ctx := context.Background()
+	opts := &mcp.ClientOptions{}
+	if answer != nil {
+		opts.CreateMessageHandler = func(_ context.Context, req *mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+			prompt := req.Params.Messages[0].Content.(*mcp.TextContent).Text
+			return &mcp.CreateMessageResult{Role: "assistant", Model: "test", Content: &mcp.TextContent{Text: answer(prompt)}}, nil
+		}
+	}
+	st, ct := mcp.NewInMemoryTransports()
+	ss, err := server.Connect(ctx, st, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ss.Close() })
+	cs, err := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "test"}, opts).Connect(ctx, ct, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cs.Close() })
+}
+
+func TestAskAgentPublishesAsides(t *testing.T) {
+	eb := NewEventBus()
+	eb.Publish(Event{Type: "agentMessage", Text: "Pick one", QuickReplies: []string{"A", "B"}})
+	server := mcp.NewServer(&mcp.Implementation{Name: "agent-chat", Version: "test"}, nil)
+	var sawPrompt string
+	connectSamplingClient(t, server, func(prompt string) string {
+		sawPrompt = prompt
+		return "It's the retry loop."
+	})
+	if samplingSession(server) == nil {
+		t.Fatal("sampling-capable session not found")
+	}
+
+	askAgent(context.Background(), server, eb, "what broke?")
+
+	if !strings.Contains(sawPrompt, "AGENT: Pick one") || !strings.Contains(sawPrompt, "Question: what broke?") {
+		t.Errorf("prompt lacks context or question:\n%s", sawPrompt)
+	}
+	history, _ := eb.History()
+	last := history[len(history)-1]
+	if last.Type != "agentMessage" || !last.Aside || last.Text != "It's the retry loop." {
+		t.Errorf("answer = %+v", last)
+	}
+	if q := history[1]; q.Type != "userMessage" || !q.Aside {
+		t.Errorf("question = %+v", q)
+	}
+	if len(pendingUserMessages(history)) != 0 || eb.HasQueuedMessages() {
+		t.Error("an aside must never reach the agent's queue")
+	}
+	if qr := eb.LastQuickReplies(); len(qr) != 2 {
+		t.Errorf("aside cleared the agent's pending quick replies: %v", qr)
+	}
+}
+
+func TestAskAgentWithoutSamplingFails(t *testing.T) {
+	eb := NewEventBus()
+	sink := make(chan any, 4)
+	eb.SubscribeTransient(sink)
+	server := mcp.NewServer(&mcp.Implementation{Name: "agent-chat", Version: "test"}, nil)
+	connectSamplingClient(t, server, nil)
+
+	askAgent(context.Background(), server, eb, "hello?")
+
+	msg := (<-sink).(map[string]string)
+	if msg["type"] != "askFailed" {
+		t.Errorf("got %v, want askFailed", msg)
+	}
+	if history, _ := eb.History(); len(history) != 0 {
+		t.Errorf("nothing should be published: %+v", history)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 200
+	searchExcerptLen   = 80 // runes of context on each side of a match
+)
+
+// searchHit is one message matching a search: its seq (the anchor the UI
+// scrolls to, and what reply_to takes) and an excerpt around the match.
+type searchHit struct {
+	Seq     int64  `json:"seq"`
+	Type    string `json:"type"`
+	Ts      int64  `json:"ts,omitempty"`
+	Session string `json:"session,omitempty"`
+	Excerpt string `json:"excerpt"`
+	File    string `json:"file,omitempty"` // the attachment whose name matched
+}
+
+// compileSearch turns a query into a matcher: a case-insensitive substring
+// match, or a regular expression when regex is set.
+func compileSearch(query string, regex bool) (*regexp.Regexp, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	if !regex {
+		return regexp.MustCompile("(?i)" + regexp.QuoteMeta(query)), nil
+	}
+	re, err := regexp.Compile(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex: %w", err)
+	}
+	return re, nil
+}
+
+// Search looks through the chat's messages (text and attachment names;
+// unsent messages excluded) and returns up to limit hits, newest first.
+// Plain-text queries of three or more characters go through the trigram
+// index; regexes and shorter queries scan the log.
+func (eb *EventBus) Search(query string, regex bool, limit int) ([]searchHit, error) {
+	re, err := compileSearch(query, regex)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	limit = min(limit, maxSearchLimit)
+	if !regex {
+		eb.mu.RLock()
+		index := eb.index
+		eb.mu.RUnlock()
+		if seqs, ok := index.candidates(query); ok {
+			return eb.searchSeqs(seqs, re, limit), nil
+		}
+	}
+	events, _ := eb.History()
+	events = withoutWithdrawn(events)
+	var hits []searchHit
+	for i := len(events) - 1; i >= 0 && len(hits) < limit; i-- {
+		if hit, ok := searchEvent(events[i], re); ok {
+			hits = append(hits, hit)
+		}
+	}
+	return hits, nil
+}
+
+// searchSeqs matches the events with the given seqs (newest first) until
+// limit hits are found.
+func (eb *EventBus) searchSeqs(seqs []int64, re *regexp.Regexp, limit int) []searchHit {
+	eb.mu.RLock()
+	defer eb.mu.RUnlock()
+	var hits []searchHit
+	for _, seq := range seqs {
+		if len(hits) == limit {
+			break
+		}
+		i := sort.Search(len(eb.eventLog), func(i int) bool { return eb.eventLog[i].Seq >= seq })
+		if i == len(eb.eventLog) || eb.eventLog[i].Seq != seq {
+			continue
+		}
+		if hit, ok := searchEvent(eb.eventLog[i], re); ok {
+			hits = append(hits, hit)
+		}
+	}
+	return hits
+}
+
+// searchEvent matches one event, if it is a chat message.
+func searchEvent(e Event, re *regexp.Regexp) (searchHit, bool) {
+	switch eventKind(e) {
+	case "userMessage", "agentMessage", "verbalReply", "draw":
+	default:
+		return searchHit{}, false
+	}
+	hit := searchHit{Seq: e.Seq, Type: e.Type, Ts: e.Timestamp, Session: e.Session}
+	if loc := re.FindStringIndex(e.Text); loc != nil {
+		hit.Excerpt = excerpt(e.Text, loc[0], loc[1])
+		return hit, true
+	}
+	for _, f := range e.Files {
+		if re.MatchString(f.Name) {
+			hit.File = f.Name
+			hit.Excerpt = excerpt(e.Text, 0, 0)
+			return hit, true
+		}
+	}
+	return searchHit{}, false
+}
+
+// excerpt returns text around the byte range [start, end), whitespace
+// collapsed and trimmed to searchExcerptLen runes either side.
+func excerpt(text string, start, end int) string {
+	before := []rune(text[:start])
+	after := []rune(text[end:])
+	prefix, suffix := "", ""
+	if len(before) > searchExcerptLen {
+		before, prefix = before[len(before)-searchExcerptLen:], "…"
+	}
+	if len(after) > searchExcerptLen {
+		after, suffix = after[:searchExcerptLen], "…"
+	}
+	s := prefix + string(before) + text[start:end] + string(after) + suffix
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// handleSearch serves GET /api/search?q=...[&regex=1][&limit=N]: the same
+// search as the search_messages tool, as a JSON array of hits.
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	regex, _ := strconv.ParseBool(q.Get("regex"))
+	hits, err := bus.Search(q.Get("q"), regex, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if hits == nil {
+		hits = []searchHit{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hits)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSearchMessages(t *testing.T) {
+	eb := NewEventBus()
+	eb.Publish(Event{Type: "agentMessage", Text: "Run `make deploy` when ready"})
+	eb.Receive(UserMessage{Text: "see the log", Files: []FileRef{{Name: "deploy-errors.txt"}}})
+	id := eb.ReceiveUserMessage("deploy to prod now", nil)
+	eb.Publish(Event{Type: "userMessageDeleted", ID: id})
+	eb.Publish(Event{Type: "toolMarker", AgentToolName: "deploy"})
+
+	hits, err := eb.Search("DEPLOY", false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 2 {
+		t.Fatalf("hits = %+v", hits)
+	}
+	// Newest first; the unsent message and the marker are not hits.
+	if hits[0].Seq != 2 || hits[0].File != "deploy-errors.txt" || hits[0].Excerpt != "see the log" {
+		t.Errorf("file hit = %+v", hits[0])
+	}
+	if hits[1].Seq != 1 || hits[1].Excerpt != "Run `make deploy` when ready" {
+		t.Errorf("text hit = %+v", hits[1])
+	}
+
+	if hits, _ := eb.Search("DEPLOY", false, 1); len(hits) != 1 || hits[0].Seq != 2 {
+		t.Errorf("limit 1: %+v", hits)
+	}
+	if hits, _ := eb.Search(`make \w+`, true, 0); len(hits) != 1 || hits[0].Seq != 1 {
+		t.Errorf("regex: %+v", hits)
+	}
+	if _, err := eb.Search("(", true, 0); err == nil {
+		t.Error("invalid regex accepted")
+	}
+	if _, err := eb.Search("  ", false, 0); err == nil {
+		t.Error("empty query accepted")
+	}
+}
+
+func TestExcerptTrimsLongText(t *testing.T) {
+	text := strings.Repeat("a", 200) + " needle\n\nhere " + strings.Repeat("b", 200)
+	start := strings.Index(text, "needle")
+	got := excerpt(text, start, start+len("needle"))
+	want := "…" + strings.Repeat("a", searchExcerptLen-1) + " needle here " + strings.Repeat("b", searchExcerptLen-7) + "…"
+	if got != want {
+		t.Errorf("excerpt = %q, want %q", got, want)
+	}
+}
+
+func TestHandleSearch(t *testing.T) {
+	origBus := bus
+	bus = NewEventBus()
+	t.Cleanup(func() { bus = origBus })
+	bus.Publish(Event{Type: "agentMessage", Text: "the command is make deploy"})
+
+	srv := httptest.NewServer(http.HandlerFunc(handleSearch))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "?q=deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var hits []searchHit
+	if err := json.NewDecoder(resp.Body).Decode(&hits); err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].Seq != 1 {
+		t.Errorf("hits = %+v", hits)
+	}
+
+	bad, err := http.Get(srv.URL + "?q=(&regex=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad.Body.Close()
+	if bad.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid regex status = %d", bad.StatusCode)
+	}
+}
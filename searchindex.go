@@ -0,0 +1,121 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// searchIndex is a trigram index over the chat's messages, kept up to date
+// on every Publish, so a plain-text search over a multi-week event log looks
+// at a handful of candidate events instead of scanning them all. It only
+// narrows: every candidate is still matched for real (searchEvent), so
+// results are identical to a full scan.
+//
+// A dependency-free trigram index fits the substring semantics of search
+// better than a word index would: "deplo" and "ploy" both find "deploy".
+type searchIndex struct {
+	mu        sync.RWMutex
+	postings  map[string][]int64 // lowercased trigram -> seqs of messages containing it, ascending
+	withdrawn map[int64]bool     // seqs of unsent messages, never hits
+	idSeq     map[string]int64   // userMessage id -> seq, to resolve userMessageDeleted
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		postings:  make(map[string][]int64),
+		withdrawn: make(map[int64]bool),
+		idSeq:     make(map[string]int64),
+	}
+}
+
+// add indexes one event. Events must arrive in seq order.
+func (ix *searchIndex) add(e Event) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	switch eventKind(e) {
+	case "userMessageDeleted":
+		if seq, ok := ix.idSeq[e.ID]; ok {
+			ix.withdrawn[seq] = true
+		}
+		return
+	case "userMessage":
+		if e.ID != "" {
+			ix.idSeq[e.ID] = e.Seq
+		}
+	case "agentMessage", "verbalReply", "draw":
+	default:
+		return
+	}
+	text := e.Text
+	for _, f := range e.Files {
+		text += "\n" + f.Name
+	}
+	for g := range trigrams(text) {
+		ix.postings[g] = append(ix.postings[g], e.Seq)
+	}
+}
+
+// candidates returns, newest first, the seqs of messages that may contain
+// query as a case-insensitive substring. ok is false when the query is
+// shorter than a trigram and the index cannot help.
+func (ix *searchIndex) candidates(query string) (seqs []int64, ok bool) {
+	grams := trigrams(query)
+	if len(grams) == 0 {
+		return nil, false
+	}
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	var lists [][]int64
+	for g := range grams {
+		list := ix.postings[g]
+		if len(list) == 0 {
+			return nil, true
+		}
+		lists = append(lists, list)
+	}
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+	seqs = append([]int64(nil), lists[0]...)
+	for _, list := range lists[1:] {
+		seqs = intersectSorted(seqs, list)
+	}
+	out := seqs[:0]
+	for _, seq := range seqs {
+		if !ix.withdrawn[seq] {
+			out = append(out, seq)
+		}
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, true
+}
+
+// trigrams returns the set of lowercased three-rune substrings of s.
+func trigrams(s string) map[string]struct{} {
+	r := []rune(strings.ToLower(s))
+	grams := make(map[string]struct{})
+	for i := 0; i+3 <= len(r); i++ {
+		grams[string(r[i:i+3])] = struct{}{}
+	}
+	return grams
+}
+
+// intersectSorted returns the seqs present in both ascending lists.
+func intersectSorted(a, b []int64) []int64 {
+	out := a[:0]
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSearchIndexCandidates(t *testing.T) {
+	ix := newSearchIndex()
+	ix.add(Event{Type: "agentMessage", Seq: 1, Text: "Run make deploy"})
+	ix.add(Event{Type: "toolMarker", Seq: 2, Text: "deploy"})
+	ix.add(Event{Type: "userMessage", Seq: 3, ID: "u1", Files: []FileRef{{Name: "Deploy.log"}}})
+	ix.add(Event{Type: "userMessage", Seq: 4, ID: "u2", Text: "deploy now"})
+	ix.add(Event{Type: "userMessageDeleted", Seq: 5, ID: "u2"})
+
+	if seqs, ok := ix.candidates("PLOY"); !ok || !reflect.DeepEqual(seqs, []int64{3, 1}) {
+		t.Errorf("candidates(PLOY) = %v, %v", seqs, ok)
+	}
+	if seqs, ok := ix.candidates("zebra"); !ok || len(seqs) != 0 {
+		t.Errorf("candidates(zebra) = %v, %v", seqs, ok)
+	}
+	if _, ok := ix.candidates("de"); ok {
+		t.Error("a two-letter query cannot use the index")
+	}
+}
+
+// The index only narrows the scan: indexed and scanning searches agree.
+func TestSearchIndexMatchesScan(t *testing.T) {
+	eb := NewEventBus()
+	for _, text := range []string{"alpha beta", "Beta gamma", "gamma délta", "ALPHABET soup", "betamax"} {
+		eb.Publish(Event{Type: "agentMessage", Text: text})
+	}
+	for _, q := range []string{"beta", "alpha", "ta ga", "délta", "soup", "amma", "xyz"} {
+		indexed, err := eb.Search(q, false, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		re, _ := compileSearch(q, false)
+		events, _ := eb.History()
+		var scanned []searchHit
+		for i := len(events) - 1; i >= 0; i-- {
+			if hit, ok := searchEvent(events[i], re); ok {
+				scanned = append(scanned, hit)
+			}
+		}
+		if !reflect.DeepEqual(indexed, scanned) {
+			t.Errorf("%q: indexed %+v, scanned %+v", q, indexed, scanned)
+		}
+	}
+}
+
+func TestSearchIndexRebuiltFromLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	bus1, err := NewEventBusWithLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus1.Publish(Event{Type: "agentMessage", Text: "the command is make deploy"})
+	bus1.Close()
+
+	bus2, err := NewEventBusWithLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus2.Close()
+	if hits, _ := bus2.Search("make deploy", false, 0); len(hits) != 1 || hits[0].Seq != 1 {
+		t.Errorf("hits after restart = %+v", hits)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// handleMessage serves POST /api/message: leave a user message for the agent
+// from outside the browser (shell scripts, cron, `agent-chat send`). It takes
+// either a JSON body {"text": "..."} or a multipart form with a "text" field
+// and any number of "files". The message is published and queued exactly like
+// one typed in the UI, so the agent picks it up on its next check_messages.
+func handleMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var text string
+	var refs []FileRef
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		r.Body = http.MaxBytesReader(w, r.Body, 50<<20)
+		if err := r.ParseMultipartForm(50 << 20); err != nil {
+			http.Error(w, "file too large or invalid multipart form", http.StatusBadRequest)
+			return
+		}
+		text = r.FormValue("text")
+		for _, fh := range r.MultipartForm.File["files"] {
+			ref, err := saveUploadedFile(r.Context(), fh)
+			if err != nil {
+				writeUploadError(w, err)
+				return
+			}
+			refs = append(refs, ref)
+		}
+	} else {
+		var body struct {
+			Text string `json:"text"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&body); err != nil {
+			http.Error(w, "invalid JSON body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		text = body.Text
+	}
+	if strings.TrimSpace(text) == "" && len(refs) == 0 {
+		http.Error(w, "empty message", http.StatusBadRequest)
+		return
+	}
+	text, refs = attachLongText(text, refs)
+	audit.Record(r, auditRecord{Event: "message", Bytes: int64(len(text)), Files: len(refs)})
+	id := bus.ReceiveUserMessage(text, refs)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"id": id, "files": refs})
+}
+
+// stringList is a repeatable string flag (-f a -f b).
+type stringList []string
+
+func (s *stringList) String() string     { return strings.Join(*s, ",") }
+func (s *stringList) Set(v string) error { *s = append(*s, v); return nil }
+
+// resolveInstanceURL picks the instance `send` talks to when -url is not
+// given: the newest one serving project, else the only one running.
+func resolveInstanceURL(home, project string) (string, error) {
+	instances, err := listInstances(home)
+	if err != nil {
+		return "", err
+	}
+	var live []instanceRecord
+	for _, in := range instances {
+		if in.URL != "" {
+			live = append(live, in)
+		}
+	}
+	for i := len(live) - 1; i >= 0; i-- {
+		if filepath.Clean(live[i].Project) == filepath.Clean(project) {
+			return live[i].URL, nil
+		}
+	}
+	switch len(live) {
+	case 0:
+		return "", fmt.Errorf("no running agent-chat instance found")
+	case 1:
+		return live[0].URL, nil
+	}
+	return "", fmt.Errorf("%d instances are running and none is for %s; pick one with -url (see `agent-chat list`)", len(live), project)
+}
+
+// runSend implements `agent-chat send`: post text (the arguments, or stdin
+// when the only argument is "-") and -f files to a running instance's
+// /api/message.
+func runSend(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("send", flag.ContinueOnError)
+	target := fs.String("url", "", "base URL of the instance (default: the one running for this directory)")
+	var files stringList
+	fs.Var(&files, "f", "attach a file (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: agent-chat send [-url http://host:port] [-f file]... <text...|->\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	text := strings.Join(fs.Args(), " ")
+	if text == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "agent-chat send: %v\n", err)
+			return 1
+		}
+		text = strings.TrimRight(string(data), "\n")
+	}
+	if strings.TrimSpace(text) == "" && len(files) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	base := *target
+	if base == "" {
+		home, err := agentChatHome()
+		if err == nil {
+			cwd, _ := os.Getwd()
+			base, err = resolveInstanceURL(home, cwd)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "agent-chat send: %v\n", err)
+			return 1
+		}
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("text", text)
+	for _, path := range files {
+		if err := addFormFile(mw, path); err != nil {
+			fmt.Fprintf(os.Stderr, "agent-chat send: %v\n", err)
+			return 1
+		}
+	}
+	mw.Close()
+
+	client, endpoint := httpClientFor(strings.TrimRight(base, "/") + "/api/message")
+	resp, err := client.Post(endpoint, mw.FormDataContentType(), &body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "agent-chat send: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		fmt.Fprintf(os.Stderr, "agent-chat send: %s: %s\n", resp.Status, strings.TrimSpace(string(msg)))
+		return 1
+	}
+	var result struct {
+		ID string `json:"id"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	fmt.Fprintf(out, "queued %s\n", result.ID)
+	return 0
+}
+
+// addFormFile streams the file at path into mw as a "files" part, typed by
+// extension so the UI can show images as thumbnails.
+func addFormFile(mw *multipart.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	typ := mime.TypeByExtension(filepath.Ext(path))
+	if typ == "" {
+		typ = "application/octet-stream"
+	}
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="files"; filename=%q`, filepath.Base(path)))
+	h.Set("Content-Type", typ)
+	part, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, f)
+	return err
+}
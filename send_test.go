@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSendQueuesMessageWithFiles(t *testing.T) {
+	origBus, origDir := bus, uploadDir
+	bus = NewEventBus()
+	uploadDir = t.TempDir()
+	t.Cleanup(func() { bus, uploadDir = origBus, origDir })
+
+	srv := httptest.NewServer(http.HandlerFunc(handleMessage))
+	defer srv.Close()
+
+	attachment := filepath.Join(t.TempDir(), "report.png")
+	os.WriteFile(attachment, []byte("png"), 0644)
+
+	var out bytes.Buffer
+	if code := runSend([]string{"-url", srv.URL, "-f", attachment, "nightly", "build", "failed"}, &out); code != 0 {
+		t.Fatalf("runSend exit %d", code)
+	}
+	if !strings.HasPrefix(out.String(), "queued ") {
+		t.Errorf("output = %q", out.String())
+	}
+	msgs := bus.DrainMessages()
+	if len(msgs) != 1 || msgs[0].Text != "nightly build failed" {
+		t.Fatalf("queued = %+v", msgs)
+	}
+	if len(msgs[0].Files) != 1 || msgs[0].Files[0].Name != "report.png" || msgs[0].Files[0].Type != "image/png" {
+		t.Fatalf("files = %+v", msgs[0].Files)
+	}
+	if data, _ := os.ReadFile(msgs[0].Files[0].Path); string(data) != "png" {
+		t.Errorf("uploaded content = %q", data)
+	}
+}
+
+func TestHandleMessageJSONAndEmpty(t *testing.T) {
+	origBus := bus
+	bus = NewEventBus()
+	t.Cleanup(func() { bus = origBus })
+
+	rr := httptest.NewRecorder()
+	handleMessage(rr, httptest.NewRequest(http.MethodPost, "/api/message", strings.NewReader(`{"text":"hello"}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rr.Code, rr.Body)
+	}
+	if !bus.HasQueuedMessages() {
+		t.Error("message not queued")
+	}
+
+	rr = httptest.NewRecorder()
+	handleMessage(rr, httptest.NewRequest(http.MethodPost, "/api/message", strings.NewReader(`{"text":"  "}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("empty message status = %d, want 400", rr.Code)
+	}
+}
+
+func TestResolveInstanceURL(t *testing.T) {
+	home := t.TempDir()
+	if _, err := resolveInstanceURL(home, "/p/a"); err == nil {
+		t.Error("want error with no instances")
+	}
+	e, _ := registerInstance(home, instanceRecord{PID: os.Getpid(), Project: "/p/other", URL: "http://localhost:1"})
+	if url, err := resolveInstanceURL(home, "/p/a"); err != nil || url != "http://localhost:1" {
+		t.Errorf("single instance: %q, %v", url, err)
+	}
+	e.Update(func(r *instanceRecord) { r.Project = "/p/a" })
+	if url, err := resolveInstanceURL(home, "/p/a/"); err != nil || url != "http://localhost:1" {
+		t.Errorf("project match: %q, %v", url, err)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// serviceSpec describes the always-on, HTTP-only instance that
+// `agent-chat install-service` sets up under the user's service manager.
+type serviceSpec struct {
+	Name   string   // unit / launchd label suffix
+	Exe    string   // absolute path of the agent-chat binary
+	Dir    string   // working directory: the project the instance serves
+	Listen string   // -listen value ("host:port" or "unix:/path.sock")
+	Socket bool     // systemd socket activation: the .socket unit owns Listen
+	Args   []string // extra serve flags
+	Log    string   // launchd stdout/stderr file (systemd uses the journal)
+}
+
+// serveArgs is the serve command line the service runs. Under socket
+// activation the listener comes from systemd, so -listen is left out.
+func (s serviceSpec) serveArgs() []string {
+	argv := []string{s.Exe, "serve", "-no-stdio-mcp", "-no-browser"}
+	if !s.Socket {
+		argv = append(argv, "-listen", s.Listen)
+	}
+	return append(argv, s.Args...)
+}
+
+// systemdQuote quotes one ExecStart word: double quotes, with the
+// characters systemd would otherwise expand (specifiers, variables)
+// escaped.
+func systemdQuote(arg string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `%`, `%%`, `$`, `$$`)
+	return `"` + r.Replace(arg) + `"`
+}
+
+// systemdUnits renders the user service and, with Socket, its .socket unit
+// ("" otherwise).
+func systemdUnits(s serviceSpec) (service, socket string) {
+	var exec []string
+	for _, a := range s.serveArgs() {
+		exec = append(exec, systemdQuote(a))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "[Unit]\nDescription=Agent Chat (%s)\n", s.Name)
+	if s.Socket {
+		fmt.Fprintf(&b, "Requires=%s.socket\n", s.Name)
+	}
+	fmt.Fprintf(&b, "\n[Service]\nExecStart=%s\nWorkingDirectory=%s\nRestart=on-failure\n", strings.Join(exec, " "), strings.ReplaceAll(s.Dir, "%", "%%"))
+	if !s.Socket {
+		b.WriteString("\n[Install]\nWantedBy=default.target\n")
+		return b.String(), ""
+	}
+	listen := s.Listen
+	if path, ok := strings.CutPrefix(listen, "unix:"); ok {
+		listen = path + "\nSocketMode=0600"
+	}
+	socket = fmt.Sprintf("[Unit]\nDescription=Agent Chat (%s) socket\n\n[Socket]\nListenStream=%s\n\n[Install]\nWantedBy=sockets.target\n", s.Name, listen)
+	return b.String(), socket
+}
+
+// launchdPlist renders a LaunchAgent that keeps the instance running.
+func launchdPlist(s serviceSpec) string {
+	var args strings.Builder
+	for _, a := range s.serveArgs() {
+		fmt.Fprintf(&args, "\t\t<string>%s</string>\n", html.EscapeString(a))
+	}
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>%s</string>
+	<key>ProgramArguments</key>
+	<array>
+%s	</array>
+	<key>WorkingDirectory</key>
+	<string>%s</string>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<true/>
+	<key>StandardOutPath</key>
+	<string>%s</string>
+	<key>StandardErrorPath</key>
+	<string>%s</string>
+</dict>
+</plist>
+`, html.EscapeString(launchdLabel(s.Name)), args.String(), html.EscapeString(s.Dir), html.EscapeString(s.Log), html.EscapeString(s.Log))
+}
+
+func launchdLabel(name string) string {
+	return "com.github.choonkeat." + name
+}
+
+// runInstallService implements `agent-chat install-service`: write a user
+// systemd unit (Linux) or LaunchAgent (macOS) that runs an HTTP-only
+// instance for a project, and print the commands that start it. Nothing is
+// enabled behind the user's back.
+func runInstallService(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("install-service", flag.ContinueOnError)
+	name := fs.String("name", "agent-chat", "unit name (launchd label suffix); use one per project to run several")
+	listen := fs.String("listen", "127.0.0.1:8765", "address to serve on: 'host:port' or 'unix:/path.sock'")
+	dir := fs.String("dir", "", "project directory the instance serves (default: current directory)")
+	socket := fs.Bool("socket", false, "systemd only: socket activation — a .socket unit holds the address and starts the service on first connection")
+	printOnly := fs.Bool("print", false, "print the unit files instead of writing them")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: agent-chat install-service [flags] [-- serve flags...]\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	fail := func(err error) int {
+		fmt.Fprintf(os.Stderr, "agent-chat install-service: %v\n", err)
+		return 1
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fail(err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return fail(err)
+	}
+	project := *dir
+	if project == "" {
+		project, _ = os.Getwd()
+	}
+	if project, err = filepath.Abs(project); err != nil {
+		return fail(err)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return fail(err)
+	}
+	spec := serviceSpec{Name: *name, Exe: exe, Dir: project, Listen: *listen, Socket: *socket, Args: fs.Args()}
+
+	type unitFile struct{ path, content string }
+	var files []unitFile
+	var next []string
+	switch runtime.GOOS {
+	case "linux":
+		unitDir := filepath.Join(home, ".config", "systemd", "user")
+		service, socketUnit := systemdUnits(spec)
+		files = append(files, unitFile{filepath.Join(unitDir, spec.Name+".service"), service})
+		enable := spec.Name + ".service"
+		if socketUnit != "" {
+			files = append(files, unitFile{filepath.Join(unitDir, spec.Name+".socket"), socketUnit})
+			enable = spec.Name + ".socket"
+		}
+		next = []string{"systemctl --user daemon-reload", "systemctl --user enable --now " + enable, "journalctl --user -u " + spec.Name + ".service -f"}
+	case "darwin":
+		if spec.Socket {
+			return fail(fmt.Errorf("-socket is systemd-only"))
+		}
+		chatHome, err := agentChatHome()
+		if err != nil {
+			return fail(err)
+		}
+		spec.Log = filepath.Join(chatHome, spec.Name+".log")
+		path := filepath.Join(home, "Library", "LaunchAgents", launchdLabel(spec.Name)+".plist")
+		files = append(files, unitFile{path, launchdPlist(spec)})
+		next = []string{"launchctl load -w " + path, "tail -f " + spec.Log}
+	default:
+		return fail(fmt.Errorf("no service manager support on %s", runtime.GOOS))
+	}
+
+	for _, f := range files {
+		if *printOnly {
+			fmt.Fprintf(out, "# %s\n%s\n", f.path, f.content)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+			return fail(err)
+		}
+		if err := os.WriteFile(f.path, []byte(f.content), 0644); err != nil {
+			return fail(err)
+		}
+		fmt.Fprintf(out, "Wrote %s\n", f.path)
+	}
+	if spec.Log != "" && !*printOnly {
+		os.MkdirAll(filepath.Dir(spec.Log), 0755)
+	}
+	fmt.Fprintf(out, "Start it and follow its log with:\n")
+	for _, cmd := range next {
+		fmt.Fprintf(out, "  %s\n", cmd)
+	}
+	return 0
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSystemdUnits(t *testing.T) {
+	spec := serviceSpec{Name: "chat", Exe: "/usr/local/bin/agent-chat", Dir: "/home/me/100% proj", Listen: "127.0.0.1:8765", Args: []string{"-title", `My "chat" $HOME`}}
+	service, socket := systemdUnits(spec)
+	if socket != "" {
+		t.Errorf("socket unit without -socket:\n%s", socket)
+	}
+	for _, want := range []string{
+		`ExecStart="/usr/local/bin/agent-chat" "serve" "-no-stdio-mcp" "-no-browser" "-listen" "127.0.0.1:8765" "-title" "My \"chat\" $$HOME"`,
+		"WorkingDirectory=/home/me/100%% proj\n",
+		"WantedBy=default.target",
+	} {
+		if !strings.Contains(service, want) {
+			t.Errorf("service unit missing %q:\n%s", want, service)
+		}
+	}
+
+	spec.Socket, spec.Listen = true, "unix:/run/user/1000/chat.sock"
+	service, socket = systemdUnits(spec)
+	if strings.Contains(service, "-listen") || !strings.Contains(service, "Requires=chat.socket") || strings.Contains(service, "[Install]") {
+		t.Errorf("socket-activated service unit:\n%s", service)
+	}
+	if !strings.Contains(socket, "ListenStream=/run/user/1000/chat.sock\nSocketMode=0600\n") || !strings.Contains(socket, "WantedBy=sockets.target") {
+		t.Errorf("socket unit:\n%s", socket)
+	}
+}
+
+func TestLaunchdPlist(t *testing.T) {
+	plist := launchdPlist(serviceSpec{Name: "chat", Exe: "/opt/agent-chat", Dir: "/Users/me/R&D", Listen: "127.0.0.1:8765", Log: "/Users/me/.agent-chat/chat.log"})
+	for _, want := range []string{
+		"<string>com.github.choonkeat.chat</string>",
+		"<string>-no-browser</string>\n\t\t<string>-listen</string>\n\t\t<string>127.0.0.1:8765</string>",
+		"<string>/Users/me/R&amp;D</string>",
+		"<key>KeepAlive</key>",
+	} {
+		if !strings.Contains(plist, want) {
+			t.Errorf("plist missing %q:\n%s", want, plist)
+		}
+	}
+}
+
+func TestInstallServicePrint(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("no service manager support")
+	}
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("AGENT_CHAT_HOME", t.TempDir())
+	var out bytes.Buffer
+	if code := runInstallService([]string{"-print", "-name", "proj-chat", "-dir", "/srv/proj"}, &out); code != 0 {
+		t.Fatalf("exit %d: %s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "/srv/proj") || !strings.Contains(out.String(), "proj-chat") {
+		t.Errorf("output:\n%s", out.String())
+	}
+	// -print writes nothing.
+	if entries, _ := os.ReadDir(os.Getenv("HOME")); len(entries) != 0 {
+		t.Errorf("-print wrote files: %v", entries)
+	}
+}
+
+func TestActivationListenerNotOurs(t *testing.T) {
+	// Socket-activation variables meant for another process are ignored.
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	t.Setenv("LISTEN_FDS", "1")
+	if ln, err := activationListener(); ln != nil || err != nil {
+		t.Errorf("activationListener = %v, %v; want nil", ln, err)
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Past conversations are browsable from the chat's own server: GET
+// /api/sessions lists the event logs in the session archive, and
+// /sessions/<id> shows one as a read-only transcript (/sessions/ is an
+// index page linking them). The archive is -sessions-dir: every .jsonl log
+// in it (rotated ones, events.jsonl.1, included) and in its immediate
+// subdirectories, one per session. It is opt-in, since a directory of logs
+// usually holds other chats' too: without the flag neither route is
+// served. Like /api/search and /api/export, they are behind -pairing.
+
+// sessionsDir is the -sessions-dir serve flag; "" means no archive.
+var sessionsDir string
+
+// maxArchivedSessions caps how many logs one listing returns, newest first.
+const maxArchivedSessions = 500
+
+// archiveLogName matches an event log's file name, rotated or not.
+var archiveLogName = regexp.MustCompile(`\.jsonl(\.\d+)?$`)
+
+// archivedSession is one event log in the archive.
+type archivedSession struct {
+	ID       string `json:"id"`   // stable for the log's path; /sessions/<id>
+	Path     string `json:"path"` // slash-separated, relative to the archive
+	Name     string `json:"name,omitempty"`
+	Current  bool   `json:"current,omitempty"` // this server's own log
+	Size     int64  `json:"size"`
+	Modified int64  `json:"modified"` // Unix milliseconds
+	Events   int    `json:"events"`
+	Messages int    `json:"messages"`        // user and agent turns
+	First    int64  `json:"first,omitempty"` // first event, Unix milliseconds
+	Last     int64  `json:"last,omitempty"`  // last event, Unix milliseconds
+}
+
+// archiveDir is where archived event logs are looked for; "" when there is
+// no archive.
+func archiveDir() string {
+	return sessionsDir
+}
+
+// archiveID names the log at rel (slash-separated, relative to the
+// archive) in URLs.
+func archiveID(rel string) string {
+	sum := sha256.Sum256([]byte(rel))
+	return hex.EncodeToString(sum[:8])
+}
+
+// archiveLogs finds the event logs in dir and its immediate
+// subdirectories, as paths relative to dir.
+func archiveLogs(dir string) ([]string, error) {
+	var rels []string
+	err := fs.WalkDir(os.DirFS(dir), ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == "." {
+				return err
+			}
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") && p != "." {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if strings.Count(p, "/") >= 1 {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && archiveLogName.MatchString(d.Name()) {
+			rels = append(rels, p)
+		}
+		return nil
+	})
+	return rels, err
+}
+
+// listArchivedSessions summarizes the newest maxArchivedSessions logs in
+// the archive, newest first. Logs are ordered by mtime before any is read,
+// and a log's summary is cached until its size or mtime changes, so a
+// listing reads little more than the live log.
+func listArchivedSessions() ([]archivedSession, error) {
+	dir := archiveDir()
+	if dir == "" {
+		return nil, nil
+	}
+	rels, err := archiveLogs(dir)
+	if err != nil {
+		return nil, err
+	}
+	current, _ := filepath.Abs(os.Getenv("AGENT_CHAT_EVENT_LOG"))
+	var out []archivedSession
+	infos := map[string]os.FileInfo{}
+	for _, rel := range rels {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		infos[rel] = info
+		s := archivedSession{ID: archiveID(rel), Path: rel, Size: info.Size(), Modified: info.ModTime().UnixMilli()}
+		if abs, _ := filepath.Abs(path); abs == current {
+			s.Current = true
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Modified != out[j].Modified {
+			return out[i].Modified > out[j].Modified
+		}
+		return out[i].Path < out[j].Path
+	})
+	if len(out) > maxArchivedSessions {
+		out = out[:maxArchivedSessions]
+	}
+
+	logSummaries.Lock()
+	defer logSummaries.Unlock()
+	seen := map[string]logSummary{}
+	for i := range out {
+		path := filepath.Join(dir, filepath.FromSlash(out[i].Path))
+		info := infos[out[i].Path]
+		sum, ok := logSummaries.byPath[path]
+		if !ok || sum.size != info.Size() || !sum.modTime.Equal(info.ModTime()) {
+			sum = summarizeLog(path, info)
+		}
+		seen[path] = sum
+		out[i].Name, out[i].Events, out[i].Messages, out[i].First, out[i].Last = sum.name, sum.events, sum.messages, sum.first, sum.last
+	}
+	logSummaries.byPath = seen // forget logs that are gone or no longer listed
+	return out, nil
+}
+
+// logSummary is what a listing reads out of one log, with the size and
+// mtime it was read at.
+type logSummary struct {
+	size     int64
+	modTime  time.Time
+	name     string
+	events   int
+	messages int
+	first    int64
+	last     int64
+}
+
+// logSummaries caches the summaries of the logs last listed, by path.
+var logSummaries struct {
+	sync.Mutex
+	byPath map[string]logSummary
+}
+
+// summarizeLog reads the log at path, whose stat is info.
+func summarizeLog(path string, info os.FileInfo) logSummary {
+	sum := logSummary{size: info.Size(), modTime: info.ModTime()}
+	events, _, _ := loadEventLog(path)
+	sum.events = len(events)
+	for _, e := range events {
+		if e.Timestamp > 0 {
+			if sum.first == 0 {
+				sum.first = e.Timestamp
+			}
+			sum.last = e.Timestamp
+		}
+		if isBubble(e) {
+			sum.messages++
+		}
+		if e.SessionName != "" {
+			sum.name = e.SessionName
+		}
+	}
+	return sum
+}
+
+// findArchivedLog returns the path of the archived log named id.
+func findArchivedLog(id string) (string, string, bool) {
+	dir := archiveDir()
+	if dir == "" {
+		return "", "", false
+	}
+	rels, _ := archiveLogs(dir)
+	for _, rel := range rels {
+		if archiveID(rel) == id {
+			return filepath.Join(dir, filepath.FromSlash(rel)), rel, true
+		}
+	}
+	return "", "", false
+}
+
+func handleSessionsList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sessions, err := listArchivedSessions()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if sessions == nil {
+		sessions = []archivedSession{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// handleSessionView serves /sessions/ (an index of the archive) and
+// /sessions/<id> (one log as a read-only HTML transcript).
+func handleSessionView(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/sessions/")
+	w.Header().Set("Cache-Control", "no-store")
+	if id == "" {
+		sessions, err := listArchivedSessions()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, renderSessionIndex(sessions))
+		return
+	}
+	path, rel, ok := findArchivedLog(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	events, _, _ := loadEventLog(path)
+	events = logBlobs(path).hydrate(events)
+	title := rel
+	for _, e := range events {
+		if e.SessionName != "" {
+			title = e.SessionName
+		}
+	}
+	doc, _ := renderTranscript(events, "html", title, uploadDir)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, doc)
+}
+
+// renderSessionIndex is the /sessions/ page: the archive, newest first,
+// each log linking to its transcript.
+func renderSessionIndex(sessions []archivedSession) string {
+	var b strings.Builder
+	b.WriteString(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Past sessions</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; max-width: 960px; margin: 2em auto; padding: 0 1em; color: #222; background: #fafafa; }
+li { margin: 0.5em 0; }
+.info { color: #777; font-size: 0.85em; }
+</style>
+</head>
+<body>
+<h1>Past sessions</h1>
+`)
+	if len(sessions) == 0 {
+		b.WriteString("<p>No archived event logs.</p>\n")
+	} else {
+		b.WriteString("<ul>\n")
+		for _, s := range sessions {
+			name := s.Name
+			if name == "" {
+				name = s.Path
+			}
+			when := time.UnixMilli(s.Modified).Format("2006-01-02 15:04")
+			if s.Last > 0 {
+				when = time.UnixMilli(s.Last).Format("2006-01-02 15:04")
+			}
+			current := ""
+			if s.Current {
+				current = " · this session"
+			}
+			fmt.Fprintf(&b, "<li><a href=\"%s\">%s</a> <span class=\"info\">%s · %d messages · %s%s</span></li>\n",
+				html.EscapeString(s.ID), html.EscapeString(name), html.EscapeString(s.Path), s.Messages, when, current)
+		}
+		b.WriteString("</ul>\n")
+	}
+	b.WriteString("</body>\n</html>\n")
+	return b.String()
+}
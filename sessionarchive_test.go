@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestLog(t *testing.T, path string, events ...Event) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	for _, e := range events {
+		line, _ := json.Marshal(e)
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionArchive(t *testing.T) {
+	orig := sessionsDir
+	t.Cleanup(func() { sessionsDir = orig })
+	sessionsDir = t.TempDir()
+	t.Setenv("AGENT_CHAT_EVENT_LOG", filepath.Join(sessionsDir, "events.jsonl"))
+
+	writeTestLog(t, filepath.Join(sessionsDir, "events.jsonl"),
+		Event{Type: "userMessage", Seq: 1, Text: "hello", Timestamp: 1000},
+		Event{Type: "agentMessage", Seq: 2, Text: "hi <there>", Timestamp: 2000, SessionName: "Auth fix"})
+	writeTestLog(t, filepath.Join(sessionsDir, "events.jsonl.1"),
+		Event{Type: "agentMessage", Seq: 1, Text: "older"})
+	writeTestLog(t, filepath.Join(sessionsDir, "proj-b", "events.jsonl"),
+		Event{Type: "agentMessage", Seq: 1, Text: "other project"})
+	writeTestLog(t, filepath.Join(sessionsDir, "proj-b", "deep", "events.jsonl"),
+		Event{Type: "agentMessage", Seq: 1, Text: "too deep"})
+	os.WriteFile(filepath.Join(sessionsDir, "notes.txt"), []byte("x"), 0o644)
+
+	rec := httptest.NewRecorder()
+	handleSessionsList(rec, httptest.NewRequest("GET", "/api/sessions", nil))
+	var got []archivedSession
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	byPath := map[string]archivedSession{}
+	for _, s := range got {
+		byPath[s.Path] = s
+	}
+	if len(got) != 3 || byPath["events.jsonl.1"].ID == "" || byPath["proj-b/events.jsonl"].ID == "" {
+		t.Fatalf("listing = %+v", got)
+	}
+	cur := byPath["events.jsonl"]
+	if !cur.Current || cur.Name != "Auth fix" || cur.Messages != 2 || cur.First != 1000 || cur.Last != 2000 {
+		t.Errorf("current log = %+v", cur)
+	}
+
+	rec = httptest.NewRecorder()
+	handleSessionView(rec, httptest.NewRequest("GET", "/sessions/"+cur.ID, nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<title>Auth fix</title>") || !strings.Contains(rec.Body.String(), "hi &lt;there&gt;") {
+		t.Errorf("view: %d\n%s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handleSessionView(rec, httptest.NewRequest("GET", "/sessions/", nil))
+	if !strings.Contains(rec.Body.String(), `href="`+cur.ID+`"`) || !strings.Contains(rec.Body.String(), "proj-b/events.jsonl") {
+		t.Errorf("index:\n%s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handleSessionView(rec, httptest.NewRequest("GET", "/sessions/nope", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown id: %d", rec.Code)
+	}
+}
+
+// A listing reads a log again only once its size or mtime changes.
+func TestSessionArchiveCachesSummaries(t *testing.T) {
+	orig := sessionsDir
+	t.Cleanup(func() { sessionsDir = orig })
+	sessionsDir = t.TempDir()
+	path := filepath.Join(sessionsDir, "events.jsonl")
+	writeTestLog(t, path, Event{Type: "agentMessage", Seq: 1, Text: "one", SessionName: "First"})
+	list := func() archivedSession {
+		t.Helper()
+		got, err := listArchivedSessions()
+		if err != nil || len(got) != 1 {
+			t.Fatalf("listing = %+v, %v", got, err)
+		}
+		return got[0]
+	}
+	if s := list(); s.Name != "First" || s.Events != 1 {
+		t.Fatalf("listing = %+v", s)
+	}
+
+	// Same size and mtime: the cached summary stands.
+	info, _ := os.Stat(path)
+	writeTestLog(t, path, Event{Type: "agentMessage", Seq: 1, Text: "one", SessionName: "Other"})
+	os.Chtimes(path, info.ModTime(), info.ModTime())
+	if s := list(); s.Name != "First" {
+		t.Errorf("unchanged log was read again: %+v", s)
+	}
+
+	writeTestLog(t, path, Event{Type: "agentMessage", Seq: 1, Text: "one", SessionName: "Second"},
+		Event{Type: "userMessage", Seq: 2, Text: "two"})
+	if s := list(); s.Name != "Second" || s.Events != 2 || s.Messages != 2 {
+		t.Errorf("grown log = %+v", s)
+	}
+
+	os.Remove(path)
+	list2, _ := listArchivedSessions()
+	if len(list2) != 0 || len(logSummaries.byPath) != 0 {
+		t.Errorf("removed log still listed or cached: %+v, %v", list2, logSummaries.byPath)
+	}
+}
+
+func TestSessionArchiveWithoutLog(t *testing.T) {
+	orig := sessionsDir
+	t.Cleanup(func() { sessionsDir = orig })
+	sessionsDir = ""
+	// The event log's directory is not an archive unless -sessions-dir says so.
+	logDir := t.TempDir()
+	writeTestLog(t, filepath.Join(logDir, "other-chat.jsonl"), Event{Type: "userMessage", Seq: 1, Text: "private"})
+	t.Setenv("AGENT_CHAT_EVENT_LOG", filepath.Join(logDir, "events.jsonl"))
+
+	rec := httptest.NewRecorder()
+	handleSessionsList(rec, httptest.NewRequest("GET", "/api/sessions", nil))
+	if strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Errorf("no archive = %s", rec.Body.String())
+	}
+}
+
+// A ref's Path can come from a browser, so a session view must not read a
+// file outside the upload and shared directories into the page.
+func TestSessionViewAttachmentsStayInUploads(t *testing.T) {
+	origSessions, origUploads := sessionsDir, uploadDir
+	t.Cleanup(func() { sessionsDir, uploadDir = origSessions, origUploads })
+	sessionsDir, uploadDir = t.TempDir(), t.TempDir()
+	t.Setenv("AGENT_CHAT_EVENT_LOG", filepath.Join(sessionsDir, "events.jsonl"))
+
+	secret := filepath.Join(t.TempDir(), "id_rsa")
+	os.WriteFile(secret, []byte("SECRETKEY"), 0o600)
+	link := filepath.Join(uploadDir, "innocent.png")
+	os.Symlink(secret, link)
+	shot := filepath.Join(uploadDir, "shot.png")
+	os.WriteFile(shot, []byte("PNGDATA"), 0o644)
+	writeTestLog(t, filepath.Join(sessionsDir, "events.jsonl"),
+		Event{Type: "userMessage", Seq: 1, Text: "look", Files: []FileRef{
+			{Name: "id_rsa", Path: secret},
+			{Name: "innocent.png", Path: link},
+			{Name: "shot.png", Path: shot, Type: "image/png"},
+		}})
+
+	rec := httptest.NewRecorder()
+	handleSessionsList(rec, httptest.NewRequest("GET", "/api/sessions", nil))
+	var got []archivedSession
+	json.Unmarshal(rec.Body.Bytes(), &got)
+	if len(got) != 1 {
+		t.Fatalf("listing = %+v", got)
+	}
+	rec = httptest.NewRecorder()
+	handleSessionView(rec, httptest.NewRequest("GET", "/sessions/"+got[0].ID, nil))
+	page := rec.Body.String()
+	if leaked := base64.StdEncoding.EncodeToString([]byte("SECRETKEY")); strings.Contains(page, leaked) {
+		t.Error("the session view inlined a file outside the upload directory")
+	}
+	if !strings.Contains(page, base64.StdEncoding.EncodeToString([]byte("PNGDATA"))) {
+		t.Error("the session view left out an upload")
+	}
+
+	if refs := servedFiles([]FileRef{{Path: secret}, {Path: link}, {Path: shot}}); len(refs) != 1 || refs[0].Path != shot {
+		t.Errorf("servedFiles kept %+v", refs)
+	}
+}
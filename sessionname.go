@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"sync"
+)
+
+// A session's name tells concurrent chats apart: it is stamped on every
+// event (Event.SessionName), leads the page title (and so the browser's
+// notifications), names exports and shows in the instance registry.
+// -session-name sets it; without one it is the title set_chat_title gave
+// the chat, and empty until then.
+
+// sessionNameFlag is the -session-name serve flag.
+var sessionNameFlag string
+
+var (
+	chatTitleMu sync.Mutex
+	chatTitle   string // the latest set_chat_title title (or a resumed export's)
+)
+
+// maxSessionName caps -session-name and the titles it falls back to.
+const maxSessionName = 80
+
+// sessionName is the name of this chat: -session-name, else its title.
+func sessionName() string {
+	if sessionNameFlag != "" {
+		return sessionNameFlag
+	}
+	chatTitleMu.Lock()
+	defer chatTitleMu.Unlock()
+	return chatTitle
+}
+
+// setChatTitle records the chat's title, the session name's fallback, and
+// puts both in the instance registry.
+func setChatTitle(title string) {
+	title = cleanSessionName(title)
+	chatTitleMu.Lock()
+	chatTitle = title
+	chatTitleMu.Unlock()
+	instanceRegistry.Update(func(r *instanceRecord) { r.Title, r.Name = title, sessionName() })
+}
+
+// cleanSessionName folds whitespace (a name is one line in a title bar)
+// and caps the length.
+func cleanSessionName(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > maxSessionName {
+		s = strings.TrimSpace(string(r[:maxSessionName]))
+	}
+	return s
+}
+
+// sessionPageTitle is the page's <title>: the session name, if any, before
+// the branded title.
+func sessionPageTitle() string {
+	if name := sessionName(); name != "" {
+		return name + " · " + pageBranding.pageTitle()
+	}
+	return pageBranding.pageTitle()
+}
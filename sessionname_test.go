@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSessionName(t *testing.T) {
+	origFlag, origTitle, origReg, origBrand := sessionNameFlag, chatTitle, instanceRegistry, pageBranding
+	t.Cleanup(func() {
+		sessionNameFlag, chatTitle, instanceRegistry, pageBranding = origFlag, origTitle, origReg, origBrand
+	})
+	home := t.TempDir()
+	entry, err := registerInstance(home, instanceRecord{PID: 1, Project: "/p"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	instanceRegistry, sessionNameFlag, chatTitle, pageBranding = entry, "", "", branding{}
+
+	if sessionName() != "" || sessionPageTitle() != "Agent Chat" {
+		t.Errorf("unnamed: %q, %q", sessionName(), sessionPageTitle())
+	}
+
+	// set_chat_title is the fallback.
+	setChatTitle("  Auth\n bug fix ")
+	if sessionName() != "Auth bug fix" || sessionPageTitle() != "Auth bug fix · Agent Chat" {
+		t.Errorf("titled: %q, %q", sessionName(), sessionPageTitle())
+	}
+	if r := entry.Record(); r.Title != "Auth bug fix" || r.Name != "Auth bug fix" {
+		t.Errorf("registry = %+v", r)
+	}
+
+	// -session-name wins over the title.
+	sessionNameFlag = "billing-api"
+	setChatTitle("Refund flow")
+	if r := entry.Record(); sessionName() != "billing-api" || r.Title != "Refund flow" || r.Name != "billing-api" {
+		t.Errorf("flag: %q, registry %+v", sessionName(), r)
+	}
+
+	bus := NewEventBus()
+	bus.Publish(Event{Type: "agentMessage", Text: "hi"})
+	if got := bus.EventsSince(0)[0].SessionName; got != "billing-api" {
+		t.Errorf("event session_name = %q", got)
+	}
+}
+
+func TestCleanSessionName(t *testing.T) {
+	if got := cleanSessionName(strings.Repeat("ab ", 50)); len([]rune(got)) > maxSessionName || strings.HasSuffix(got, " ") {
+		t.Errorf("long name = %q", got)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// shareDir is the -share-dir serve flag: a directory (say, the agent's
+// workspace) served read-only at /files, listed at GET /api/files?path=sub
+// and by the list_shared_files tool, so the user can browse what the agent
+// made and attach it to a message without uploading it again. Dotfiles are
+// neither listed nor served, and nothing outside shareDir is, symlinks
+// included.
+var shareDir string
+
+// maxSharedListing caps how many entries one listing returns.
+const maxSharedListing = 1000
+
+// sharedEntry is one file or directory in a shared-files listing. A file's
+// ref can be attached to a message as is.
+type sharedEntry struct {
+	Name     string   `json:"name"`
+	Path     string   `json:"path"` // slash-separated, relative to shareDir
+	Dir      bool     `json:"dir,omitempty"`
+	Size     int64    `json:"size,omitempty"`
+	Modified int64    `json:"modified"` // Unix milliseconds
+	Ref      *FileRef `json:"ref,omitempty"`
+}
+
+// sharedListing is a directory of the shared tree.
+type sharedListing struct {
+	Path      string        `json:"path"`
+	Entries   []sharedEntry `json:"entries"`
+	Truncated bool          `json:"truncated,omitempty"`
+}
+
+var errNotShared = errors.New("no such shared file")
+
+// resolveShared maps a slash-separated path under shareDir to a file path,
+// refusing dotfiles and anything whose real location is outside shareDir.
+func resolveShared(rel string) (string, string, error) {
+	if shareDir == "" {
+		return "", "", errors.New("file sharing is off; start agent-chat with -share-dir")
+	}
+	rel = strings.TrimPrefix(path.Clean("/"+rel), "/")
+	for _, part := range strings.Split(rel, "/") {
+		if strings.HasPrefix(part, ".") {
+			return "", "", errNotShared
+		}
+	}
+	if _, err := filepath.EvalSymlinks(shareDir); err != nil {
+		return "", "", err
+	}
+	real, ok := withinDir(filepath.Join(shareDir, filepath.FromSlash(rel)), shareDir)
+	if !ok {
+		return "", "", errNotShared
+	}
+	return real, rel, nil
+}
+
+// withinDir resolves the symlinks in p and reports whether the result lies
+// inside one of dirs (resolved the same way). A path that does not exist
+// is inside none of them, and an empty dir is skipped.
+func withinDir(p string, dirs ...string) (string, bool) {
+	real, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", false
+	}
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		root, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			continue
+		}
+		if inside, err := filepath.Rel(root, real); err == nil && (inside == "." || filepath.IsLocal(inside)) {
+			return real, true
+		}
+	}
+	return "", false
+}
+
+// servedFiles keeps the refs a tab sent that name files this server gave
+// it: uploads and shared files. Anything else is dropped, as a ref's Path
+// is read back when the chat is exported or archived.
+func servedFiles(refs []FileRef) []FileRef {
+	var out []FileRef
+	for _, f := range refs {
+		if _, ok := withinDir(f.Path, uploadDir, shareDir); !ok {
+			log.Printf("agent-chat: dropped an attachment outside the upload and shared directories: %q", f.Path)
+			continue
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// listShared lists the directory at rel under shareDir, directories first.
+func listShared(rel string) (sharedListing, error) {
+	dir, rel, err := resolveShared(rel)
+	if err != nil {
+		return sharedListing{}, err
+	}
+	dirents, err := os.ReadDir(dir)
+	if err != nil {
+		return sharedListing{}, err
+	}
+	out := sharedListing{Path: rel, Entries: []sharedEntry{}}
+	for _, d := range dirents {
+		if strings.HasPrefix(d.Name(), ".") {
+			continue
+		}
+		if len(out.Entries) == maxSharedListing {
+			out.Truncated = true
+			break
+		}
+		full := filepath.Join(dir, d.Name())
+		info, err := os.Stat(full) // follows symlinks
+		if err != nil {
+			continue
+		}
+		e := sharedEntry{Name: d.Name(), Path: path.Join(rel, d.Name()), Dir: info.IsDir(), Modified: info.ModTime().UnixMilli()}
+		if !e.Dir {
+			e.Size = info.Size()
+			e.Ref = &FileRef{Name: e.Name, Path: full, URL: "/files/" + e.Path, Size: e.Size, Type: sharedType(e.Name)}
+		}
+		out.Entries = append(out.Entries, e)
+	}
+	sort.SliceStable(out.Entries, func(i, j int) bool {
+		a, b := out.Entries[i], out.Entries[j]
+		if a.Dir != b.Dir {
+			return a.Dir
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+	return out, nil
+}
+
+// sharedType guesses a shared file's MIME type from its extension.
+func sharedType(name string) string {
+	if t := mime.TypeByExtension(filepath.Ext(name)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// handleSharedList is GET /api/files?path=sub.
+func handleSharedList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	listing, err := listShared(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, sharedError(err), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(listing)
+}
+
+// handleSharedFile serves GET /files/<path>, files only.
+func handleSharedFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	full, _, err := resolveShared(strings.TrimPrefix(r.URL.Path, "/files/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if info, err := os.Stat(full); err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	// Shared HTML is shown, not run: it is on the chat's origin.
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeFile(w, r, full)
+}
+
+// sharedError is err as shown to the browser or the agent.
+func sharedError(err error) string {
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, errNotShared) {
+		return errNotShared.Error()
+	}
+	return err.Error()
+}
+
+// formatSharedListing renders a listing for the agent: one line per entry,
+// with the path it would use to list a directory or reference a file.
+func formatSharedListing(l sharedListing) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "/%s in %s\n", l.Path, shareDir)
+	if len(l.Entries) == 0 {
+		b.WriteString("(empty)\n")
+	}
+	for _, e := range l.Entries {
+		if e.Dir {
+			fmt.Fprintf(&b, "%8s  %s/\n", "dir", e.Path)
+		} else {
+			fmt.Fprintf(&b, "%8s  %s\n", formatSize(e.Size), e.Path)
+		}
+	}
+	if l.Truncated {
+		fmt.Fprintf(&b, "… only the first %d entries are listed\n", maxSharedListing)
+	}
+	return b.String()
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// shareTree shares a temp directory holding src/main.go, notes.txt, a .env,
+// and a symlink to a file outside it.
+func shareTree(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "src"), 0o755)
+	os.WriteFile(filepath.Join(dir, "src", "main.go"), []byte("package main"), 0o644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes"), 0o644)
+	os.WriteFile(filepath.Join(dir, ".env"), []byte("SECRET=1"), 0o644)
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	os.WriteFile(outside, []byte("secret"), 0o644)
+	if err := os.Symlink(outside, filepath.Join(dir, "escape.txt")); err != nil {
+		t.Skip("symlinks unsupported:", err)
+	}
+
+	orig := shareDir
+	shareDir = dir
+	t.Cleanup(func() { shareDir = orig })
+}
+
+func TestListShared(t *testing.T) {
+	shareTree(t)
+	l, err := listShared("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range l.Entries {
+		names = append(names, e.Name)
+	}
+	// Directories first; no dotfiles; the symlink out is listed but cannot be read.
+	if got := strings.Join(names, ","); got != "src,escape.txt,notes.txt" {
+		t.Errorf("entries = %s", got)
+	}
+	if ref := l.Entries[2].Ref; ref == nil || ref.URL != "/files/notes.txt" || ref.Type != "text/plain; charset=utf-8" {
+		t.Errorf("notes.txt ref = %+v", ref)
+	}
+
+	sub, err := listShared("src")
+	if err != nil || len(sub.Entries) != 1 || sub.Entries[0].Path != "src/main.go" {
+		t.Errorf("src = %+v, %v", sub, err)
+	}
+	if _, err := listShared("../.."); err != nil {
+		t.Errorf("../.. should list the top, got %v", err)
+	}
+}
+
+func TestSharedFileServing(t *testing.T) {
+	shareTree(t)
+	for path, want := range map[string]int{
+		"/files/notes.txt":       http.StatusOK,
+		"/files/src/main.go":     http.StatusOK,
+		"/files/.env":            http.StatusNotFound,
+		"/files/escape.txt":      http.StatusNotFound,
+		"/files/src":             http.StatusNotFound,
+		"/files/src/../../x.txt": http.StatusNotFound,
+	} {
+		rr := httptest.NewRecorder()
+		handleSharedFile(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != want {
+			t.Errorf("GET %s = %d, want %d", path, rr.Code, want)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	handleSharedList(rr, httptest.NewRequest(http.MethodGet, "/api/files?path=src", nil))
+	var l sharedListing
+	if err := json.Unmarshal(rr.Body.Bytes(), &l); err != nil || l.Path != "src" || len(l.Entries) != 1 {
+		t.Errorf("listing = %s", rr.Body)
+	}
+}
+
+func TestListSharedFilesTool(t *testing.T) {
+	eb := NewEventBus()
+	if got, isErr := callTool(t, eb, "list_shared_files", map[string]any{}); !isErr || !strings.Contains(got, "-share-dir") {
+		t.Errorf("sharing off: %q", got)
+	}
+	shareTree(t)
+	got, isErr := callTool(t, eb, "list_shared_files", map[string]any{"path": "src"})
+	if isErr || !strings.Contains(got, "src/main.go") {
+		t.Errorf("src listing: %q", got)
+	}
+}
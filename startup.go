@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// startupInfo is the -json-startup line: where the UI landed, for wrapper
+// scripts and editors that start agent-chat on a random port.
+type startupInfo struct {
+	URL      string `json:"url"`                 // the UI URL handed out (a -tunnel URL when there is one)
+	LocalURL string `json:"local_url,omitempty"` // the listener's own URL, when it differs from url
+	MCP      string `json:"mcp"`                 // the MCP endpoint (POST)
+	Port     int    `json:"port,omitempty"`      // TCP port; absent for a Unix socket
+	PID      int    `json:"pid"`
+	Version  string `json:"version"`
+}
+
+func newStartupInfo(url, localURL string, port int) startupInfo {
+	info := startupInfo{URL: url, MCP: localURL + "/mcp", Port: port, PID: os.Getpid(), Version: version}
+	if localURL != url {
+		info.LocalURL = localURL
+	}
+	return info
+}
+
+// writeStartupJSON writes info as one line of JSON.
+func writeStartupJSON(out io.Writer, info startupInfo) error {
+	return json.NewEncoder(out).Encode(info)
+}
+
+// writeURLFile atomically writes url (and a newline) to path for -url-file,
+// so a script polling for it never reads half a URL.
+func writeURLFile(path, url string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".agent-chat-url-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.WriteString(url + "\n"); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStartupJSON(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeStartupJSON(&out, newStartupInfo("http://localhost:4321", "http://localhost:4321", 4321)); err != nil {
+		t.Fatal(err)
+	}
+	line := out.String()
+	if strings.Count(line, "\n") != 1 || !strings.HasSuffix(line, "\n") {
+		t.Errorf("want exactly one line, got %q", line)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["url"] != "http://localhost:4321" || got["mcp"] != "http://localhost:4321/mcp" || got["port"] != 4321.0 || got["pid"] != float64(os.Getpid()) {
+		t.Errorf("startup info = %v", got)
+	}
+	if _, ok := got["local_url"]; ok {
+		t.Error("local_url present though it equals url")
+	}
+
+	// Behind a tunnel, url is the public one and MCP stays local.
+	info := newStartupInfo("https://quiet-fox.trycloudflare.com", "http://localhost:4321", 4321)
+	if info.LocalURL != "http://localhost:4321" || info.MCP != "http://localhost:4321/mcp" {
+		t.Errorf("tunnel startup info = %+v", info)
+	}
+}
+
+func TestWriteURLFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "url")
+	os.WriteFile(path, []byte("http://localhost:1111\n"), 0644)
+	if err := writeURLFile(path, "http://localhost:4321"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "http://localhost:4321\n" {
+		t.Errorf("url file = %q", data)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("temp files left behind: %v", entries)
+	}
+}
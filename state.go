@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// uiState is GET /api/state: what the chat's tabs are showing right now —
+// the quick replies on offer, the approvals waiting, each agent's queue and
+// voice mode, and who is watching — for dashboards and bridges that cannot
+// hold a WebSocket open to piece it together.
+type uiState struct {
+	Viewers       int              `json:"viewers"`           // connected browser tabs
+	Devices       map[string]int   `json:"devices,omitempty"` // connected tabs by device hint
+	PendingAckIDs []string         `json:"pending_ack_ids"`   // approvals waiting on the user, sorted
+	Sessions      []sessionUIState `json:"sessions"`          // the primary session first
+}
+
+// sessionUIState is one agent session in uiState.
+type sessionUIState struct {
+	Session        string   `json:"session"` // "" for the primary session
+	Name           string   `json:"name,omitempty"`
+	QuickReplies   []string `json:"quick_replies"`        // nil while the agent works
+	PromptSeq      int64    `json:"prompt_seq,omitempty"` // the event offering QuickReplies, until a tab answers it
+	QueuedMessages int      `json:"queued_messages"`
+	VoiceMode      bool     `json:"voice_mode"` // the user's last message to this agent was spoken
+}
+
+// UIState reports the live state every tab is rendering.
+func (eb *EventBus) UIState() uiState {
+	st := uiState{
+		Viewers:       eb.ViewerCount(),
+		Devices:       eb.ViewerDevices(),
+		PendingAckIDs: eb.PendingAckIDs(),
+		Sessions:      []sessionUIState{},
+	}
+	for _, s := range eb.allSessions() {
+		eb.mu.RLock()
+		ss := sessionUIState{
+			Session:        s.key,
+			QuickReplies:   s.lastQuickReplies,
+			PromptSeq:      s.promptSeq,
+			QueuedMessages: len(s.msgQueue),
+			VoiceMode:      s.lastVoice,
+		}
+		if s.identity != nil {
+			ss.Name = s.identity.Name
+		}
+		eb.mu.RUnlock()
+		st.Sessions = append(st.Sessions, ss)
+	}
+	return st
+}
+
+// PendingAckIDs returns every pending ack ID, sorted.
+func (eb *EventBus) PendingAckIDs() []string {
+	eb.ackMu.Lock()
+	ids := make([]string, 0, len(eb.pending))
+	for id := range eb.pending {
+		ids = append(ids, id)
+	}
+	eb.ackMu.Unlock()
+	sort.Strings(ids)
+	return ids
+}
+
+// handleState serves GET /api/state.
+func handleState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bus.UIState())
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestStateEndpoint(t *testing.T) {
+	orig := bus
+	bus = NewEventBus()
+	t.Cleanup(func() { bus = orig })
+
+	primary := bus.ClientSession("stdio")
+	primary.Publish(Event{Type: "agentMessage", Text: "Deploy?", QuickReplies: []string{"Yes", "No"}})
+	primary.SetLastVoice(true)
+	second := bus.ClientSession("http-2")
+	second.SetIdentity(&AgentIdentity{Name: "Reviewer"})
+	second.PushMessage("look at this", nil)
+	ack := bus.CreateAck()
+
+	rec := httptest.NewRecorder()
+	handleState(rec, httptest.NewRequest(http.MethodGet, "/api/state", nil))
+	var st uiState
+	if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil {
+		t.Fatalf("/api/state = %s (%v)", rec.Body, err)
+	}
+	if !slices.Equal(st.PendingAckIDs, []string{ack.ID}) || st.Viewers != 0 || len(st.Sessions) != 2 {
+		t.Fatalf("/api/state = %s", rec.Body)
+	}
+	if s := st.Sessions[0]; s.Session != "" || !slices.Equal(s.QuickReplies, []string{"Yes", "No"}) || s.PromptSeq == 0 || !s.VoiceMode || s.QueuedMessages != 0 {
+		t.Errorf("primary session = %+v", s)
+	}
+	if s := st.Sessions[1]; s.Session != "http-2" || s.Name != "Reviewer" || s.QuickReplies != nil || s.QueuedMessages != 1 || s.VoiceMode {
+		t.Errorf("second session = %+v", s)
+	}
+
+	rec = httptest.NewRecorder()
+	handleState(rec, httptest.NewRequest(http.MethodPost, "/api/state", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /api/state = %d", rec.Code)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// staticAsset is one UI file as served: its bytes, a gzipped copy when that
+// is worth sending, and the content hash used for its ETag and for the
+// ?v= URLs the page links it by.
+type staticAsset struct {
+	body, gz []byte
+	hash     string
+	ctype    string
+}
+
+// staticAssets serves the UI's files with caching hints. A request carrying
+// the file's current hash (?v=…, as the page links them) may be cached for a
+// year; any other is revalidated by ETag, so a phone reloading the chat
+// gets 304s instead of the whole bundle again. Compressible files go out
+// gzipped to clients that accept it. The embedded files are read and
+// compressed once; with -static-dir every request re-reads, so edits still
+// show on reload.
+type staticAssets struct {
+	fsys  fs.FS
+	next  http.Handler // directories and anything else not a plain file
+	mu    sync.Mutex
+	cache map[string]*staticAsset
+}
+
+func newStaticAssets(fsys fs.FS) *staticAssets {
+	return &staticAssets{fsys: fsys, next: http.FileServer(http.FS(fsys)), cache: make(map[string]*staticAsset)}
+}
+
+// gzipMin is the smallest file worth gzipping.
+const gzipMin = 1024
+
+// load returns the asset at name (no leading slash), or nil when name is
+// not a regular file.
+func (s *staticAssets) load(name string) *staticAsset {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a, ok := s.cache[name]; ok && staticDir == "" {
+		return a
+	}
+	body, err := fs.ReadFile(s.fsys, name)
+	if err != nil {
+		return nil
+	}
+	sum := sha256.Sum256(body)
+	a := &staticAsset{body: body, hash: hex.EncodeToString(sum[:6]), ctype: mime.TypeByExtension(path.Ext(name))}
+	if a.ctype == "" {
+		a.ctype = http.DetectContentType(body)
+	}
+	if old, ok := s.cache[name]; ok && old.hash == a.hash {
+		return old // unchanged under -static-dir: keep its gzip
+	}
+	if len(body) >= gzipMin && compressible(a.ctype) {
+		var buf bytes.Buffer
+		zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		zw.Write(body)
+		zw.Close()
+		if buf.Len() < len(body) {
+			a.gz = buf.Bytes()
+		}
+	}
+	s.cache[name] = a
+	return a
+}
+
+func compressible(ctype string) bool {
+	return strings.HasPrefix(ctype, "text/") || strings.Contains(ctype, "javascript") ||
+		strings.Contains(ctype, "json") || strings.Contains(ctype, "svg")
+}
+
+func (s *staticAssets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a := s.load(strings.TrimPrefix(path.Clean(r.URL.Path), "/"))
+	if a == nil || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		s.next.ServeHTTP(w, r)
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", a.ctype)
+	h.Set("Vary", "Accept-Encoding")
+	if r.URL.Query().Get("v") == a.hash {
+		h.Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		h.Set("Cache-Control", "no-cache")
+	}
+	body, etag := a.body, `"`+a.hash+`"`
+	if a.gz != nil && acceptsGzip(r) {
+		body, etag = a.gz, `"`+a.hash+`-gz"`
+		h.Set("Content-Encoding", "gzip")
+	}
+	h.Set("ETag", etag)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body))
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		enc, params, _ := strings.Cut(enc, ";")
+		if strings.TrimSpace(enc) != "gzip" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(q, 64); err == nil && f == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// assetRefRe matches the page's links to its own files: src="./x" or
+// href="./x".
+var assetRefRe = regexp.MustCompile(`(src|href)="\./([^"?#]+)"`)
+
+// versionLinks points the page's links to files served from s at their
+// current ?v=hash, which the browser may then cache for good. Links to
+// anything else (custom.css, the manifest) are left alone.
+func (s *staticAssets) versionLinks(page string) string {
+	return assetRefRe.ReplaceAllStringFunc(page, func(m string) string {
+		sub := assetRefRe.FindStringSubmatch(m)
+		a := s.load(sub[2])
+		if a == nil {
+			return m
+		}
+		return sub[1] + `="./` + sub[2] + `?v=` + a.hash + `"`
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestStaticAssetCaching(t *testing.T) {
+	js := strings.Repeat("console.log('agent-chat');\n", 100)
+	assets := newStaticAssets(fstest.MapFS{
+		"app.js":   {Data: []byte(js)},
+		"icon.svg": {Data: []byte(`<svg/>`)},
+	})
+	get := func(target string, header ...string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		assets.ServeHTTP(rec, req)
+		return rec
+	}
+
+	plain := get("/app.js")
+	etag := plain.Header().Get("ETag")
+	if plain.Code != http.StatusOK || plain.Body.String() != js || etag == "" {
+		t.Fatalf("GET /app.js = %d, ETag %q", plain.Code, etag)
+	}
+	if cc := plain.Header().Get("Cache-Control"); cc != "no-cache" {
+		t.Errorf("unversioned Cache-Control %q", cc)
+	}
+	if rec := get("/app.js", "If-None-Match", etag); rec.Code != http.StatusNotModified {
+		t.Errorf("revalidation = %d, want 304", rec.Code)
+	}
+
+	gz := get("/app.js", "Accept-Encoding", "br, gzip")
+	if gz.Header().Get("Content-Encoding") != "gzip" || gz.Header().Get("ETag") == etag || gz.Body.Len() >= len(js) {
+		t.Fatalf("gzip response: encoding %q, ETag %q, %d bytes", gz.Header().Get("Content-Encoding"), gz.Header().Get("ETag"), gz.Body.Len())
+	}
+	zr, err := gzip.NewReader(gz.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(zr); string(body) != js {
+		t.Error("gzipped body differs")
+	}
+	if rec := get("/app.js", "Accept-Encoding", "gzip;q=0"); rec.Header().Get("Content-Encoding") != "" {
+		t.Error("gzip sent despite q=0")
+	}
+	if rec := get("/icon.svg", "Accept-Encoding", "gzip"); rec.Header().Get("Content-Encoding") != "" || rec.Header().Get("Content-Type") != "image/svg+xml" {
+		t.Errorf("small file: encoding %q, type %q", rec.Header().Get("Content-Encoding"), rec.Header().Get("Content-Type"))
+	}
+
+	page := assets.versionLinks(`<link href="./custom.css" /><script src="./app.js"></script>`)
+	hash := strings.Trim(etag, `"`)
+	if page != `<link href="./custom.css" /><script src="./app.js?v=`+hash+`"></script>` {
+		t.Fatalf("versionLinks = %s", page)
+	}
+	if cc := get("/app.js?v=" + hash).Header().Get("Cache-Control"); !strings.Contains(cc, "immutable") {
+		t.Errorf("versioned Cache-Control %q", cc)
+	}
+	if cc := get("/app.js?v=stale").Header().Get("Cache-Control"); cc != "no-cache" {
+		t.Errorf("stale version Cache-Control %q", cc)
+	}
+	if rec := get("/missing.js"); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /missing.js = %d", rec.Code)
+	}
+}
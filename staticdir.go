@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// staticDir, when set (-static-dir), is a directory served in front of the
+// embedded client-dist: a file there replaces the embedded one of the same
+// path, and anything missing falls back to the embed. UI work (or a
+// customized frontend) then needs a browser reload, not a Go rebuild.
+var staticDir string
+
+// overlayFS serves files from top, falling back to base for names top does
+// not have. Directories are not merged: a directory present in top hides
+// base's listing of it, which only matters to directory listings.
+type overlayFS struct {
+	top, base fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	f, err := o.top.Open(name)
+	if err == nil {
+		return f, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return o.base.Open(name)
+}
+
+// clientFS is the filesystem the browser UI is served from: the embedded
+// client-dist, overlaid by staticDir when one is configured.
+func clientFS() (fs.FS, error) {
+	embedded, err := fs.Sub(staticFS, "client-dist")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sub filesystem: %w", err)
+	}
+	if staticDir == "" {
+		return embedded, nil
+	}
+	fi, err := os.Stat(staticDir)
+	if err != nil {
+		return nil, fmt.Errorf("static dir: %w", err)
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("static dir %s is not a directory", staticDir)
+	}
+	return overlayFS{top: os.DirFS(staticDir), base: embedded}, nil
+}
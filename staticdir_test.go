@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestClientFSOverlaysStaticDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "style.css"), []byte("body{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := staticDir
+	t.Cleanup(func() { staticDir = old })
+
+	staticDir = dir
+	fsys, err := clientFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := fs.ReadFile(fsys, "style.css"); err != nil || string(b) != "body{}" {
+		t.Errorf("style.css = %q, %v; want the override", b, err)
+	}
+	if b, err := fs.ReadFile(fsys, "app.js"); err != nil || !strings.Contains(string(b), "WebSocket") {
+		t.Errorf("app.js did not fall back to the embed: %v", err)
+	}
+	if _, err := fs.ReadFile(fsys, "missing.js"); err == nil {
+		t.Error("missing file found")
+	}
+
+	staticDir = filepath.Join(dir, "nope")
+	if _, err := clientFS(); err == nil {
+		t.Error("nonexistent static dir accepted")
+	}
+}
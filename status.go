@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// agentStatus is what get_status reports to an agent: who is watching and
+// whether its last message got through.
+type agentStatus struct {
+	Viewers        int             `json:"viewers"`           // connected browser tabs
+	Devices        map[string]int  `json:"devices,omitempty"` // connected tabs by device hint ("desktop", "mobile", "tablet")
+	QueuedMessages int             `json:"queued_messages"`   // user messages waiting for this agent
+	VoiceMode      bool            `json:"voice_mode"`
+	Features       map[string]int  `json:"features,omitempty"`       // connected tabs able to render each feature
+	LegacyViewers  int             `json:"legacy_viewers,omitempty"` // tabs that declared no features: assumed to render only the basics
+	LastMessage    *messageReceipt `json:"last_message,omitempty"`   // absent until the agent has said something
+}
+
+// messageReceipt is the delivery state of one agent message.
+type messageReceipt struct {
+	Seq       int64 `json:"seq"`
+	Delivered int   `json:"delivered"` // tabs that have rendered it
+	Seen      int   `json:"seen"`      // tabs that rendered it while visible
+}
+
+// Status reports this agent session's view of the chat.
+func (eb *EventBus) Status() agentStatus {
+	st := agentStatus{
+		Viewers:        eb.ViewerCount(),
+		Devices:        eb.ViewerDevices(),
+		QueuedMessages: len(eb.msgQueue),
+		VoiceMode:      eb.LastVoice(),
+	}
+	st.Features, st.LegacyViewers = eb.FeatureSupport()
+	if seq := eb.lastAgentSeq(); seq > 0 {
+		delivered, seen := eb.Receipts(seq)
+		st.LastMessage = &messageReceipt{Seq: seq, Delivered: delivered, Seen: seen}
+	}
+	return st
+}
+
+// lastAgentSeq returns the seq of this session's latest agent bubble, or 0.
+func (eb *EventBus) lastAgentSeq() int64 {
+	eb.mu.RLock()
+	defer eb.mu.RUnlock()
+	for i := len(eb.eventLog) - 1; i >= 0; i-- {
+		e := eb.eventLog[i]
+		if e.Session != eb.key || e.Aside {
+			continue
+		}
+		switch eventKind(e) {
+		case "agentMessage", "verbalReply", "draw":
+			return e.Seq
+		}
+	}
+	return 0
+}
+
+// chatStatus is GET /api/status: the chat's live state for scripts and
+// dashboards — who is watching, and what each agent session is doing.
+type chatStatus struct {
+	Version string       `json:"version"`
+	Viewers int          `json:"viewers"`
+	Agents  []agentState `json:"agents"` // the primary session first
+}
+
+// agentState is one agent session in chatStatus.
+type agentState struct {
+	Session        string `json:"session"` // "" for the primary session
+	Name           string `json:"name,omitempty"`
+	Connected      bool   `json:"connected"`             // has made a tool call and not disconnected since
+	LastActive     int64  `json:"last_active,omitempty"` // Unix milliseconds
+	Busy           bool   `json:"busy"`                  // a tool call is in flight
+	Stalled        bool   `json:"stalled"`               // quiet past -stall-after
+	QueuedMessages int    `json:"queued_messages"`
+}
+
+// ChatStatus reports every agent session's state.
+func (eb *EventBus) ChatStatus(stallAfter time.Duration) chatStatus {
+	st := chatStatus{Version: version, Viewers: eb.ViewerCount(), Agents: []agentState{}}
+	now := time.Now()
+	for _, s := range eb.allSessions() {
+		eb.mu.RLock()
+		a := agentState{Session: s.key, QueuedMessages: len(s.msgQueue)}
+		if s.identity != nil {
+			a.Name = s.identity.Name
+		}
+		if !s.lastActive.IsZero() {
+			ev := s.livenessLocked(now, stallAfter)
+			a.LastActive, a.Busy = ev.LastActive, ev.Busy
+			a.Connected = !s.disconnected
+			a.Stalled = a.Connected && ev.Type == "agentStalled"
+		}
+		eb.mu.RUnlock()
+		st.Agents = append(st.Agents, a)
+	}
+	return st
+}
+
+// handleStatus serves GET /api/status.
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bus.ChatStatus(stallAfter))
+}
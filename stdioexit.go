@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stdioExitPolicy is the -on-stdio-exit serve flag: what happens to the
+// HTTP UI once the stdio MCP client has gone. "shutdown" exits at once (the
+// default, and the old behavior); "keep" serves the chat, history and all,
+// until a signal; "timeout=N" keeps it for N (a duration, or seconds) and
+// then exits.
+type stdioExitPolicy struct {
+	keep  bool
+	after time.Duration // with keep: exit after this long; 0 = never
+}
+
+// parseStdioExitPolicy parses an -on-stdio-exit value.
+func parseStdioExitPolicy(s string) (stdioExitPolicy, error) {
+	switch {
+	case s == "shutdown":
+		return stdioExitPolicy{}, nil
+	case s == "keep":
+		return stdioExitPolicy{keep: true}, nil
+	case strings.HasPrefix(s, "timeout="):
+		v := strings.TrimPrefix(s, "timeout=")
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			secs, serr := strconv.Atoi(v)
+			if serr != nil {
+				return stdioExitPolicy{}, fmt.Errorf("bad timeout %q (want a duration like 10m, or seconds)", v)
+			}
+			d = time.Duration(secs) * time.Second
+		}
+		if d <= 0 {
+			return stdioExitPolicy{}, fmt.Errorf("timeout must be positive, got %q", v)
+		}
+		return stdioExitPolicy{keep: true, after: d}, nil
+	}
+	return stdioExitPolicy{}, fmt.Errorf("must be keep, shutdown or timeout=N, got %q", s)
+}
+
+// wait blocks for as long as the policy keeps the UI up after the stdio
+// client exits, or until ctx is done.
+func (p stdioExitPolicy) wait(ctx context.Context) {
+	if !p.keep {
+		return
+	}
+	if p.after == 0 {
+		<-ctx.Done()
+		return
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(p.after):
+	}
+}
+
+// String describes the policy for the startup log.
+func (p stdioExitPolicy) String() string {
+	switch {
+	case !p.keep:
+		return "shutdown"
+	case p.after == 0:
+		return "keep"
+	}
+	return "timeout=" + p.after.String()
+}
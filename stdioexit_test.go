@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseStdioExitPolicy(t *testing.T) {
+	good := map[string]stdioExitPolicy{
+		"shutdown":    {},
+		"keep":        {keep: true},
+		"timeout=10m": {keep: true, after: 10 * time.Minute},
+		"timeout=90":  {keep: true, after: 90 * time.Second},
+	}
+	for in, want := range good {
+		got, err := parseStdioExitPolicy(in)
+		if err != nil || got != want {
+			t.Errorf("%q = %+v, %v; want %+v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "stay", "timeout=", "timeout=soon", "timeout=0", "timeout=-5s"} {
+		if _, err := parseStdioExitPolicy(in); err == nil {
+			t.Errorf("%q accepted", in)
+		}
+	}
+}
+
+func TestStdioExitPolicyWait(t *testing.T) {
+	start := time.Now()
+	stdioExitPolicy{}.wait(context.Background())
+	stdioExitPolicy{keep: true, after: 20 * time.Millisecond}.wait(context.Background())
+	if d := time.Since(start); d < 20*time.Millisecond || d > 2*time.Second {
+		t.Errorf("waited %v", d)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		stdioExitPolicy{keep: true}.wait(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("keep returned before the signal")
+	case <-time.After(20 * time.Millisecond):
+	}
+	cancel()
+	<-done
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Text measurement for the whiteboard, so a label can be wrapped and its
+// box sized before it is drawn. The board draws writeText in its
+// handwriting font (drawFont), which on most machines ends up as Comic
+// Sans MS, on one line, over a background padded by a fifth of the font
+// size. Widths here approximate Comic Sans MS's advance widths, erring
+// wide so text measured to fit does; other fonts are measured as if they
+// were it.
+// measure_text and GET /api/measure-text return the same JSON.
+
+// glyphWidthsASCII are the advance widths of ' ' through '~' in ems.
+var glyphWidthsASCII = [95]float64{
+	0.30, 0.25, 0.44, 0.82, 0.62, 0.72, 0.65, 0.34, 0.38, 0.38, 0.52, 0.52, 0.31, 0.52, 0.28, 0.53, // space … /
+	0.60, 0.48, 0.60, 0.60, 0.60, 0.60, 0.60, 0.60, 0.60, 0.60, // 0 … 9
+	0.31, 0.31, 0.42, 0.58, 0.42, 0.50, 0.90, // : … @
+	0.71, 0.62, 0.60, 0.69, 0.62, 0.60, 0.68, 0.75, 0.50, 0.63, 0.59, 0.56, 0.86, 0.79, 0.78, 0.54, // A … P
+	0.83, 0.60, 0.65, 0.68, 0.72, 0.63, 0.97, 0.67, 0.61, 0.67, // Q … Z
+	0.36, 0.60, 0.36, 0.56, 0.65, 0.55, // [ … `
+	0.53, 0.56, 0.50, 0.56, 0.54, 0.48, 0.52, 0.56, 0.26, 0.40, 0.51, 0.25, 0.75, 0.52, 0.51, 0.53, // a … p
+	0.51, 0.48, 0.49, 0.47, 0.52, 0.48, 0.70, 0.51, 0.50, 0.50, // q … z
+	0.40, 0.44, 0.40, 0.59, // { … ~
+}
+
+// glyphWidth is r's advance width in ems: from the table for ASCII, a full
+// em for the wide scripts and emoji, and a wide letter's for the rest.
+func glyphWidth(r rune) float64 {
+	switch {
+	case r >= ' ' && r <= '~':
+		return glyphWidthsASCII[r-' ']
+	case r == '\t':
+		return 4 * glyphWidthsASCII[0]
+	case unicode.Is(unicode.Mn, r) || r == '\u200d' || unicode.Is(unicode.Variation_Selector, r):
+		return 0
+	case unicode.In(r, unicode.Han, unicode.Hangul, unicode.Hiragana, unicode.Katakana),
+		r >= 0xff00 && r <= 0xff60, r >= 0x1f300 && r <= 0x1faff, r >= 0x2600 && r <= 0x27bf:
+		return 1
+	}
+	return 0.65
+}
+
+// measureTextWidth is the width of s drawn at fontSize.
+func measureTextWidth(s string, fontSize float64) float64 {
+	var em float64
+	for _, r := range s {
+		em += glyphWidth(r)
+	}
+	return em * fontSize
+}
+
+// textLine is one wrapped line, placed for a writeText instruction.
+type textLine struct {
+	Text  string  `json:"text"`
+	Width float64 `json:"width"`
+	X     float64 `json:"x"`
+	Y     float64 `json:"y"` // vertical center, as writeText takes it
+}
+
+// textMeasurement is the wrapped text and the box it fills.
+type textMeasurement struct {
+	FontSize     float64          `json:"font_size"`
+	LineHeight   float64          `json:"line_height"`
+	Width        float64          `json:"width"`  // including the board's background padding
+	Height       float64          `json:"height"` // including the board's background padding
+	Overflow     bool             `json:"overflow,omitempty"`
+	Lines        []textLine       `json:"lines"`
+	Instructions []map[string]any `json:"instructions"` // writeText per line
+}
+
+// measureText wraps text at word boundaries to fit maxWidth (0: no limit)
+// at fontSize and places its lines in a block whose top-left corner is
+// (x, y), centered within maxWidth when center is set. Explicit newlines
+// are kept; a word wider than maxWidth is broken between letters, and one
+// letter that does not fit sets Overflow.
+func measureText(text string, fontSize, maxWidth, x, y float64, center bool) textMeasurement {
+	if fontSize <= 0 {
+		fontSize = drawFontSize
+	}
+	pad := fontSize * 0.2
+	m := textMeasurement{FontSize: fontSize, LineHeight: fontSize*1.2 + 2*pad, Instructions: []map[string]any{}}
+	room := math.Inf(1)
+	if maxWidth > 0 {
+		room = maxWidth - 2*pad
+	}
+	var lines []string
+	for _, para := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		lines = append(lines, wrapLine(para, fontSize, room, &m.Overflow)...)
+	}
+	var widest float64
+	widths := make([]float64, len(lines))
+	for i, l := range lines {
+		widths[i] = roundUp(measureTextWidth(l, fontSize))
+		widest = max(widest, widths[i])
+	}
+	m.Width = roundUp(widest + 2*pad)
+	m.Height = roundUp(float64(len(lines)) * m.LineHeight)
+	block := m.Width
+	if center && maxWidth > 0 {
+		block = maxWidth
+	}
+	for i, l := range lines {
+		lx := x + pad
+		if center {
+			lx = x + (block-widths[i])/2
+		}
+		ly := y + (float64(i)+0.5)*m.LineHeight
+		m.Lines = append(m.Lines, textLine{Text: l, Width: widths[i], X: roundUp(lx), Y: roundUp(ly)})
+		if l != "" {
+			m.Instructions = append(m.Instructions, map[string]any{"type": "writeText", "text": l, "x": roundUp(lx), "y": roundUp(ly), "fontSize": fontSize})
+		}
+	}
+	return m
+}
+
+// wrapLine greedily wraps one paragraph to room, setting *overflow when a
+// single letter is wider than room.
+func wrapLine(para string, fontSize, room float64, overflow *bool) []string {
+	words := strings.Fields(para)
+	if len(words) == 0 {
+		return []string{""}
+	}
+	space := glyphWidth(' ') * fontSize
+	var lines []string
+	var cur string
+	var curW float64
+	for _, w := range words {
+		ww := measureTextWidth(w, fontSize)
+		switch {
+		case cur != "" && curW+space+ww <= room:
+			cur, curW = cur+" "+w, curW+space+ww
+			continue
+		case cur != "":
+			lines = append(lines, cur)
+		}
+		cur, curW = "", 0
+		for ww > room && utf8.RuneCountInString(w) > 1 {
+			cut, cutW := breakWord(w, fontSize, room)
+			if cut == 0 {
+				*overflow = true
+				_, cut = utf8.DecodeRuneInString(w)
+				cutW = measureTextWidth(w[:cut], fontSize)
+			}
+			lines = append(lines, w[:cut])
+			w, ww = w[cut:], ww-cutW
+		}
+		if ww > room {
+			*overflow = true
+		}
+		cur, curW = w, ww
+	}
+	return append(lines, cur)
+}
+
+// breakWord is how many bytes of w fit in room, and their width.
+func breakWord(w string, fontSize, room float64) (int, float64) {
+	var width float64
+	for i, r := range w {
+		rw := glyphWidth(r) * fontSize
+		if width+rw > room {
+			return i, width
+		}
+		width += rw
+	}
+	return len(w), width
+}
+
+// roundUp rounds up to a tenth of a pixel.
+func roundUp(v float64) float64 {
+	return math.Ceil(v*10-1e-9) / 10
+}
+
+// handleMeasureText serves GET /api/measure-text?text=…&font_size=…&max_width=…
+// (and optional x, y and align=center).
+func handleMeasureText(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	num := func(key string) float64 {
+		v, _ := strconv.ParseFloat(q.Get(key), 64)
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return 0
+		}
+		return v
+	}
+	m := measureText(q.Get("text"), num("font_size"), num("max_width"), num("x"), num("y"), q.Get("align") == "center")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMeasureTextWraps(t *testing.T) {
+	m := measureText("Authentication service handles tokens", 20, 200, 100, 50, false)
+	if len(m.Lines) < 2 {
+		t.Fatalf("lines = %+v, want wrapped", m.Lines)
+	}
+	var words []string
+	for i, l := range m.Lines {
+		if l.Width+2*4 > 200 {
+			t.Errorf("line %q is %.1fpx wide, more than the box", l.Text, l.Width)
+		}
+		if l.X != 104 || l.Y != 50+(float64(i)+0.5)*m.LineHeight {
+			t.Errorf("line %d at (%.1f, %.1f)", i, l.X, l.Y)
+		}
+		words = append(words, l.Text)
+	}
+	if strings.Join(words, " ") != "Authentication service handles tokens" {
+		t.Errorf("wrapped text = %q", words)
+	}
+	if m.LineHeight != 32 || m.Height != float64(len(m.Lines))*32 || m.Width > 200 || m.Overflow {
+		t.Errorf("measurement = %+v", m)
+	}
+	if len(m.Instructions) != len(m.Lines) || m.Instructions[0]["type"] != "writeText" || m.Instructions[0]["fontSize"] != 20.0 {
+		t.Errorf("instructions = %v", m.Instructions)
+	}
+}
+
+func TestMeasureTextEdges(t *testing.T) {
+	m := measureText("one\n\ntwo", 0, 0, 0, 0, false)
+	if m.FontSize != drawFontSize || len(m.Lines) != 3 || m.Lines[1].Text != "" || len(m.Instructions) != 2 {
+		t.Errorf("newlines: %+v", m)
+	}
+	if w := measureText("iii", 10, 0, 0, 0, false).Lines[0].Width; w >= measureText("WWW", 10, 0, 0, 0, false).Lines[0].Width {
+		t.Errorf("iii (%.1f) is not narrower than WWW", w)
+	}
+
+	m = measureText("supercalifragilistic", 18, 80, 0, 0, false)
+	if len(m.Lines) < 2 || m.Overflow || strings.Join(linesText(m), "") != "supercalifragilistic" {
+		t.Errorf("long word: %v overflow=%v", linesText(m), m.Overflow)
+	}
+	if m := measureText("WW", 40, 20, 0, 0, false); !m.Overflow || len(m.Lines) != 2 {
+		t.Errorf("letters wider than the box: %v overflow=%v", linesText(m), m.Overflow)
+	}
+
+	c := measureText("hi", 18, 300, 10, 0, true)
+	if got := c.Lines[0].X; got != roundUp(10+(300-c.Lines[0].Width)/2) {
+		t.Errorf("centered x = %.1f", got)
+	}
+}
+
+func linesText(m textMeasurement) []string {
+	var out []string
+	for _, l := range m.Lines {
+		out = append(out, l.Text)
+	}
+	return out
+}
+
+func TestHandleMeasureText(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleMeasureText(rec, httptest.NewRequest(http.MethodGet, "/api/measure-text?text=Load+balancer&font_size=16&max_width=90&align=center", nil))
+	var m textMeasurement
+	if err := json.Unmarshal(rec.Body.Bytes(), &m); err != nil || rec.Code != 200 {
+		t.Fatalf("%d %s", rec.Code, rec.Body)
+	}
+	if m.FontSize != 16 || len(m.Lines) != 2 {
+		t.Errorf("measurement = %+v", m)
+	}
+	rec = httptest.NewRecorder()
+	handleMeasureText(rec, httptest.NewRequest(http.MethodPost, "/api/measure-text", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: %d", rec.Code)
+	}
+
+	got, isErr := callTool(t, NewEventBus(), "measure_text", map[string]any{"text": "Load balancer", "font_size": 16, "max_width": 90})
+	if isErr || !strings.Contains(got, `"text":"balancer"`) {
+		t.Errorf("measure_text = %s", got)
+	}
+}
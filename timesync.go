@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// dateSeparators is the -date-separators serve flag: publish a
+// "dateSeparator" event before the first chat bubble of each new day.
+var dateSeparators bool
+
+// serverTime is GET /api/time: the server's clock and time zone, so the UI
+// can correct for a browser whose clock is off and show times in the zone
+// the exports use. The page is also given the zone as SERVER_TZ and
+// SERVER_TZ_OFFSET.
+type serverTime struct {
+	Now           int64  `json:"now"`                 // Unix milliseconds
+	TimeZone      string `json:"time_zone,omitempty"` // IANA name, when the server knows it
+	Zone          string `json:"zone"`                // abbreviation, e.g. "SGT" or "+08"
+	OffsetMinutes int    `json:"offset_minutes"`      // east of UTC, at Now
+}
+
+func currentServerTime() serverTime {
+	now := time.Now()
+	zone, offset := now.Zone()
+	return serverTime{Now: now.UnixMilli(), TimeZone: serverTimeZone(), Zone: zone, OffsetMinutes: offset / 60}
+}
+
+// serverTimeZone is the IANA name of the server's local time zone: from
+// $TZ, else the /etc/localtime link. "" when neither says (e.g. Windows).
+func serverTimeZone() string {
+	if name := time.Local.String(); name != "Local" && name != "" {
+		return name
+	}
+	if tz := strings.TrimPrefix(os.Getenv("TZ"), ":"); tz != "" && !filepath.IsAbs(tz) {
+		return tz
+	}
+	if target, err := os.Readlink("/etc/localtime"); err == nil {
+		if _, name, ok := strings.Cut(target, "zoneinfo/"); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+func handleTime(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(currentServerTime())
+}
+
+// isBubble reports whether e shows as a chat bubble.
+func isBubble(e Event) bool {
+	switch eventKind(e) {
+	case "userMessage", "agentMessage", "verbalReply", "draw":
+		return true
+	}
+	return false
+}
+
+// eventDay is the date of a Unix-millisecond timestamp in the server's
+// time zone, as YYYY-MM-DD.
+func eventDay(ts int64) string {
+	return time.UnixMilli(ts).Format(time.DateOnly)
+}
+
+// separateDay publishes a "dateSeparator" (Text the new day, YYYY-MM-DD)
+// when a bubble stamped ts starts a day later than the chat's previous
+// bubble. The first bubble of a chat gets none.
+func (eb *EventBus) separateDay(ts int64) {
+	day := eventDay(ts)
+	eb.mu.Lock()
+	prev := eb.lastDay
+	if prev == "" {
+		for i := len(eb.eventLog) - 1; i >= 0; i-- {
+			if e := eb.eventLog[i]; isBubble(e) && e.Timestamp > 0 {
+				prev = eventDay(e.Timestamp)
+				break
+			}
+		}
+	}
+	if day > prev {
+		eb.lastDay = day
+	}
+	eb.mu.Unlock()
+	if prev != "" && day > prev {
+		eb.Publish(Event{Type: "dateSeparator", Text: day, Timestamp: ts})
+	}
+}
+
+// dayLabel renders a dateSeparator's day for exports, e.g. "Friday, 16
+// October 2026"; a malformed day is returned as is.
+func dayLabel(day string) string {
+	t, err := time.Parse(time.DateOnly, day)
+	if err != nil {
+		return day
+	}
+	return t.Format("Monday, 2 January 2006")
+}
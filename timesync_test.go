@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleTime(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleTime(rec, httptest.NewRequest("GET", "/api/time", nil))
+	var got serverTime
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("%v: %s", err, rec.Body)
+	}
+	if d := time.Since(time.UnixMilli(got.Now)); d < 0 || d > 5*time.Second {
+		t.Errorf("now is %s off", d)
+	}
+	if _, offset := time.Now().Zone(); got.OffsetMinutes != offset/60 || got.Zone == "" {
+		t.Errorf("zone = %q %+d min, want offset %+d", got.Zone, got.OffsetMinutes, offset/60)
+	}
+	if rec.Header().Get("Cache-Control") != "no-store" {
+		t.Error("the time must not be cached")
+	}
+}
+
+func TestDateSeparators(t *testing.T) {
+	dateSeparators = true
+	t.Cleanup(func() { dateSeparators = false })
+
+	eb := NewEventBus()
+	day1 := time.Date(2026, 10, 15, 22, 0, 0, 0, time.Local)
+	day2 := day1.Add(4 * time.Hour)
+	eb.Publish(Event{Type: "userMessage", Text: "late one", Timestamp: day1.UnixMilli()})
+	eb.Publish(Event{Type: "agentMessage", Text: "on it", Timestamp: day1.Add(time.Hour).UnixMilli()})
+	eb.Publish(Event{Type: "reaction", Text: "👍", Timestamp: day2.UnixMilli()}) // not a bubble
+	eb.Publish(Event{Type: "agentMessage", Text: "done", Timestamp: day2.UnixMilli()})
+	eb.Publish(Event{Type: "userMessage", Text: "thanks", Timestamp: day2.Add(time.Minute).UnixMilli()})
+
+	events, _ := eb.History()
+	var types []string
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	want := "userMessage agentMessage reaction dateSeparator agentMessage userMessage"
+	if strings.Join(types, " ") != want {
+		t.Fatalf("events = %v, want %s", types, want)
+	}
+	sep := events[3]
+	if sep.Text != "2026-10-16" || sep.Timestamp != day2.UnixMilli() {
+		t.Errorf("separator = %+v", sep)
+	}
+	if md := renderChatBubble(sep, &renderState{}, nil); md != "### Friday, 16 October 2026\n\n" {
+		t.Errorf("markdown = %q", md)
+	}
+}
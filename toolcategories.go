@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// The user can switch categories of tools off from the chat's settings
+// panel, to tune how the agent talks to them: no drawings, no speech, no
+// progress chatter. A category that is off is left out of tools/list, the
+// agent's client is sent tools/list_changed, and a call to one of its tools
+// is refused with a message saying why. The choice lasts for the server's
+// run and is the same for every tab.
+
+// toolCategory is a set of tools the user can switch off together.
+type toolCategory struct {
+	Name  string   `json:"name"`
+	Tools []string `json:"tools"`
+}
+
+// toolCategories are the categories the settings panel offers, in its
+// order. A tool in two categories is off when either is.
+var toolCategories = []toolCategory{
+	{"drawing", []string{"draw", "highlight", "measure_text"}},
+	{"voice", []string{"send_verbal_reply", "send_verbal_progress"}},
+	{"progress", []string{"send_progress", "send_verbal_progress"}},
+}
+
+// toolSwitches holds which categories are off.
+type toolSwitches struct {
+	mu       sync.Mutex
+	off      map[string]bool
+	onChange func() // called after a category is switched, e.g. to tell MCP clients
+}
+
+// SetToolCategory switches category name on or off and tells the tabs and,
+// through OnToolsChanged's func, the agent.
+func (eb *EventBus) SetToolCategory(name string, on bool) error {
+	if !slices.ContainsFunc(toolCategories, func(c toolCategory) bool { return c.Name == name }) {
+		return fmt.Errorf("no tool category %q", name)
+	}
+	s := &eb.tools
+	s.mu.Lock()
+	changed := s.off[name] == on
+	if s.off == nil {
+		s.off = map[string]bool{}
+	}
+	s.off[name] = !on
+	notify := s.onChange
+	s.mu.Unlock()
+	if !changed {
+		return nil
+	}
+	eb.PublishTransient(eb.ToolCategories())
+	if notify != nil {
+		notify()
+	}
+	return nil
+}
+
+// OnToolsChanged sets the func called after a category is switched.
+func (eb *EventBus) OnToolsChanged(f func()) {
+	eb.tools.mu.Lock()
+	eb.tools.onChange = f
+	eb.tools.mu.Unlock()
+}
+
+// ToolCategories is the "toolCategories" event the tabs render the
+// settings panel from: each category, its tools and whether it is on.
+func (eb *EventBus) ToolCategories() map[string]any {
+	eb.tools.mu.Lock()
+	defer eb.tools.mu.Unlock()
+	cats := make([]map[string]any, len(toolCategories))
+	for i, c := range toolCategories {
+		cats[i] = map[string]any{"name": c.Name, "tools": c.Tools, "on": !eb.tools.off[c.Name]}
+	}
+	return map[string]any{"type": "toolCategories", "categories": cats}
+}
+
+// toolOffBy is the category that has switched tool off, or "".
+func (eb *EventBus) toolOffBy(tool string) string {
+	eb.tools.mu.Lock()
+	defer eb.tools.mu.Unlock()
+	for _, c := range toolCategories {
+		if eb.tools.off[c.Name] && slices.Contains(c.Tools, tool) {
+			return c.Name
+		}
+	}
+	return ""
+}
+
+// toolsChangedSentinel is a tool added and removed at once to make the SDK
+// send tools/list_changed, which it only does when its tool set changes.
+// gateTools hides it from any list that races with it.
+const toolsChangedSentinel = "agent_chat_tools_changed"
+
+// notifyToolsChanged sends every MCP client tools/list_changed. The SDK
+// debounces the add and the remove into one notification.
+func notifyToolsChanged(server *mcp.Server) {
+	server.AddTool(&mcp.Tool{Name: toolsChangedSentinel, InputSchema: map[string]any{"type": "object"}}, func(context.Context, *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return nil, fmt.Errorf("unknown tool %q", toolsChangedSentinel)
+	})
+	server.RemoveTools(toolsChangedSentinel)
+}
+
+// gateTools is middleware that leaves the tools the user switched off out
+// of tools/list and refuses calls to them.
+func gateTools(eb *EventBus) mcp.Middleware {
+	return func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			if call, ok := req.(*mcp.CallToolRequest); ok {
+				if cat := eb.toolOffBy(call.Params.Name); cat != "" {
+					return &mcp.CallToolResult{
+						Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("error: the user switched off %s tools in the chat's settings, so %s is unavailable; use send_message instead.", cat, call.Params.Name)}},
+						IsError: true,
+					}, nil
+				}
+			}
+			res, err := next(ctx, method, req)
+			if list, ok := res.(*mcp.ListToolsResult); ok && err == nil {
+				list.Tools = slices.DeleteFunc(slices.Clone(list.Tools), func(t *mcp.Tool) bool {
+					return t.Name == toolsChangedSentinel || eb.toolOffBy(t.Name) != ""
+				})
+			}
+			return res, err
+		}
+	}
+}
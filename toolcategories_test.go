@@ -0,0 +1,80 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestSetToolCategory(t *testing.T) {
+	eb := NewEventBus()
+	sink := make(chan any, 8)
+	eb.SubscribeTransient(sink)
+	defer eb.UnsubscribeTransient(sink)
+	changes := 0
+	eb.OnToolsChanged(func() { changes++ })
+
+	if err := eb.SetToolCategory("drawing", true); err != nil {
+		t.Fatal(err)
+	}
+	if changes != 0 || len(sink) != 0 {
+		t.Errorf("switching on a category that is on: %d changes, %d events", changes, len(sink))
+	}
+	if err := eb.SetToolCategory("drawing", false); err != nil {
+		t.Fatal(err)
+	}
+	if changes != 1 || len(sink) != 1 {
+		t.Fatalf("switching drawing off: %d changes, %d events", changes, len(sink))
+	}
+	ev := (<-sink).(map[string]any)
+	cats := ev["categories"].([]map[string]any)
+	if cats[0]["name"] != "drawing" || cats[0]["on"] != false || cats[1]["on"] != true {
+		t.Errorf("categories = %v", cats)
+	}
+	if got := eb.toolOffBy("highlight"); got != "drawing" {
+		t.Errorf("toolOffBy(highlight) = %q", got)
+	}
+	if got := eb.toolOffBy("send_message"); got != "" {
+		t.Errorf("toolOffBy(send_message) = %q", got)
+	}
+	if err := eb.SetToolCategory("drwaing", false); err == nil {
+		t.Error("switched off a category that does not exist")
+	}
+}
+
+func TestGateTools(t *testing.T) {
+	eb := NewEventBus()
+	server := mcp.NewServer(&mcp.Implementation{Name: "agent-chat", Version: "test"}, nil)
+	registerTools(server, eb)
+	server.AddReceivingMiddleware(gateTools(eb))
+	eb.OnToolsChanged(func() { notifyToolsChanged(server) })
+
+	if err := eb.SetToolCategory("drawing", false); err != nil {
+		t.Fatal(err)
+	}
+	names, err := toolNames(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"draw", "highlight", "measure_text", toolsChangedSentinel} {
+		if slices.Contains(names, name) {
+			t.Errorf("%s listed with drawing off", name)
+		}
+	}
+	if !slices.Contains(names, "send_message") {
+		t.Errorf("tools: %v", names)
+	}
+	text, isErr := callServerTool(t, server, "draw", map[string]any{"instructions": []any{}})
+	if !isErr || !strings.Contains(text, "switched off drawing tools") {
+		t.Errorf("draw with drawing off = %q (error %v)", text, isErr)
+	}
+
+	if err := eb.SetToolCategory("drawing", true); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := toolNames(server); !slices.Contains(names, "draw") {
+		t.Errorf("draw not listed once drawing is back on: %v", names)
+	}
+}
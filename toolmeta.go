@@ -0,0 +1,59 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// maxRelatedFiles caps the file chips one bubble carries.
+const maxRelatedFiles = 10
+
+// toolMeta is the Meta for a bubble published by tool call req: the tool,
+// how long the agent had been working since its previous call ended (known
+// when the trackToolCalls middleware saw this call begin), and the related
+// files it named.
+func (eb *EventBus) toolMeta(req *mcp.CallToolRequest, files []string) *ToolMeta {
+	eb.mu.Lock()
+	worked := eb.agentSession.worked
+	eb.mu.Unlock()
+	return &ToolMeta{Tool: req.Params.Name, DurationMs: worked.Milliseconds(), Files: cleanRelatedFiles(files)}
+}
+
+// cleanRelatedFiles trims, de-duplicates and caps a related_files list.
+func cleanRelatedFiles(files []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, f := range files {
+		f = strings.TrimSpace(f)
+		if f == "" || seen[filepath.Clean(f)] {
+			continue
+		}
+		seen[filepath.Clean(f)] = true
+		out = append(out, f)
+		if len(out) == maxRelatedFiles {
+			break
+		}
+	}
+	return out
+}
+
+// metaLabels are an event's Meta as the chips exports show: the tool, the
+// time worked, then each related file.
+func metaLabels(m *ToolMeta) []string {
+	if m == nil {
+		return nil
+	}
+	var labels []string
+	if m.Tool != "" {
+		labels = append(labels, "🔧 "+m.Tool)
+	}
+	if m.DurationMs > 0 {
+		labels = append(labels, "⏱ "+formatElapsed(m.DurationMs))
+	}
+	for _, f := range m.Files {
+		labels = append(labels, "📄 "+f)
+	}
+	return labels
+}
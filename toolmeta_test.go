@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestToolMetaOnProgress(t *testing.T) {
+	eb := NewEventBus()
+	server := mcp.NewServer(&mcp.Implementation{Name: "agent-chat", Version: "test"}, nil)
+	server.AddReceivingMiddleware(trackToolCalls(eb))
+	registerTools(server, eb)
+
+	callServerTool(t, server, "send_progress", map[string]any{"text": "editing", "related_files": []string{" main.go ", "main.go", "", "./main.go", "pkg/x.go"}})
+	time.Sleep(20 * time.Millisecond)
+	callServerTool(t, server, "send_progress", map[string]any{"text": "done"})
+
+	events, _ := eb.History()
+	if len(events) != 2 {
+		t.Fatalf("events = %+v", events)
+	}
+	first, second := events[0].Meta, events[1].Meta
+	if first == nil || first.Tool != "send_progress" || first.DurationMs != 0 || strings.Join(first.Files, ",") != "main.go,pkg/x.go" {
+		t.Errorf("first meta = %+v", first)
+	}
+	if second == nil || second.DurationMs < 20 || second.Files != nil {
+		t.Errorf("second meta = %+v, want the time worked since the first call", second)
+	}
+}
+
+func TestExportShowsToolMeta(t *testing.T) {
+	events := []Event{
+		{Seq: 1, Type: "agentMessage", Text: "Fixed it", Meta: &ToolMeta{Tool: "send_message", DurationMs: 1500, Files: []string{"a<b>.go"}}},
+		{Seq: 2, Type: "userMessage", Text: "thanks"},
+	}
+	md, _ := renderTranscript(events, "md", "Fix", t.TempDir())
+	if want := "<small>🔧 send_message · ⏱ 1.5s · 📄 a&lt;b&gt;.go</small>"; !strings.Contains(md, want) {
+		t.Errorf("markdown export missing %q:\n%s", want, md)
+	}
+	page, _ := renderTranscript(events, "html", "Fix", t.TempDir())
+	if want := `<p class="meta">🔧 send_message · ⏱ 1.5s · 📄 a&lt;b&gt;.go</p>`; !strings.Contains(page, want) {
+		t.Errorf("HTML export missing %q:\n%s", want, page)
+	}
+}
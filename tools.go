@@ -90,14 +90,18 @@ func voiceSuffix(msgs []UserMessage) string {
 // wording was added after observing the agent reply "OK." to substantive user
 // requests; uniform delivery prevents the bypass where a path-specific wrapper
 // is missing.
-const executeNotEchoGuidance = "This IS the user's message — execute the request, do not echo it back as an acknowledgment. When the requested work is done, call send_message (or send_verbal_reply in voice mode) to deliver the result — never end your turn without sending a user-visible message."
+//
+// The wording lives in prompts/agent-reply.tmpl ("execute-not-echo") so
+// -templates-dir can override it.
+var executeNotEchoGuidance = execTemplate("execute-not-echo", nil)
 
 // emptyQueueGuidance is returned from check_messages when the queue is empty.
 // The literal `{"queue":"empty"}` shape is kept so any programmatic check still
 // works, but extra guidance is appended to stop the agent from sending a
 // vacuous "Queue is empty." reply to the user — which was observed when an
 // agent treated the empty-queue payload as the body of a send_message reply.
-const emptyQueueGuidance = `{"queue":"empty"} — no user message is pending. Do NOT call send_message just to report this; the user did not ask anything. Return to your previous task, or stay silent and wait for the next user message.`
+// The wording is the "empty-queue" template.
+var emptyQueueGuidance = execTemplate("empty-queue", nil)
 
 // composeCheckMessagesResult builds the check_messages result from the fresh
 // queue drain plus any un-acked limbo batch (see EventBus.SetLimbo). A limbo
@@ -179,6 +183,28 @@ func keepaliveForRequest(ctx context.Context, req *mcp.CallToolRequest, message
 	return startProgressKeepalive(ctx, req.Session, token, progressKeepaliveInterval, message)
 }
 
+// mcpClientKey identifies the MCP client behind a tool call, for
+// EventBus.ClientSession. HTTP clients are told an Mcp-Session-Id at
+// initialize and echo it on every request — even to the stateless /mcp
+// endpoint — so it tells concurrent agents apart. The process's own stdio
+// client carries no HTTP headers and is "stdio"; a header-less HTTP call is ""
+// and shares the primary session.
+func mcpClientKey(req *mcp.CallToolRequest) string {
+	if req == nil || req.Extra == nil || req.Extra.Header == nil {
+		return "stdio"
+	}
+	return req.Extra.Header.Get("Mcp-Session-Id")
+}
+
+// replyToSeq validates a tool's reply_to: the seq when it names a chat
+// message, else 0 (an unknown seq is dropped, not quoted wrong).
+func replyToSeq(bus *EventBus, seq int64) int64 {
+	if _, ok := bus.Quote(seq); !ok {
+		return 0
+	}
+	return seq
+}
+
 // appendBargeIn drains any queued user messages and appends them to text with a
 // sentinel header so the agent reads them as a fresh user instruction without
 // having to poll via check_messages. Returns text unchanged when the queue is
@@ -198,6 +224,9 @@ type MessageParams struct {
 	QuickReply       string   `json:"first_quick_reply"`
 	MoreQuickReplies []string `json:"more_quick_replies,omitempty"`
 	ImageURLs        []string `json:"image_urls,omitempty"`
+	ReplyTo          int64    `json:"reply_to,omitempty" jsonschema:"Optional seq of the earlier chat message this answers (the #N of a 'replying to #N' note, or a seq from chat://history); the UI quotes it above your message."`
+	RelatedFiles     []string `json:"related_files,omitempty" jsonschema:"Optional paths of the files this message is about (e.g. the ones you just edited); shown as chips under your message and kept in exports."`
+	Math             []string `json:"math,omitempty" jsonschema:"Optional LaTeX formulas (no $$ delimiters), each shown as a typeset display block after your text — for explaining algorithms, proofs and statistics."`
 }
 
 // VerbalReplyParams are the parameters for the send_verbal_reply tool.
@@ -206,6 +235,8 @@ type VerbalReplyParams struct {
 	QuickReply       string   `json:"first_quick_reply"`
 	MoreQuickReplies []string `json:"more_quick_replies,omitempty"`
 	ImageURLs        []string `json:"image_urls,omitempty"`
+	ReplyTo          int64    `json:"reply_to,omitempty" jsonschema:"Optional seq of the earlier chat message this answers (the #N of a 'replying to #N' note, or a seq from chat://history); the UI quotes it above your message."`
+	RelatedFiles     []string `json:"related_files,omitempty" jsonschema:"Optional paths of the files this message is about (e.g. the ones you just edited); shown as chips under your message and kept in exports."`
 }
 
 // resolveImageFiles copies local image files into the upload directory and returns FileRefs.
@@ -331,6 +362,7 @@ func registerTools(server *mcp.Server, bus *EventBus) {
 		Name:        "send_message",
 		Description: "The ONLY channel the user sees in text mode. Use it for EVERY user-visible message: questions, status, final answers, errors, acknowledgments. Plain text in your response is invisible to the user — if you don't call send_message, the user sees nothing. Blocks until the user responds; the user's reply is RETURNED by this call as `User responded: …` — that IS the message. This tool is TERMINAL: call it when the task is COMPLETE, when you need a decision only the user can make, or to confirm before a risky/destructive step. But if you have promised an artifact and can safely continue, you are NOT blocked — do not finalize and do not ask permission to keep going; keep the same turn alive, execute the work, and send non-blocking send_progress updates at least every 60 seconds. Ending your turn SUSPENDS execution — there is no background worker, so a premature send_message silently pauses unfinished work. Always end a *completed* task by calling send_message with the result and waiting; never end your turn silently. You do NOT need to poll for user messages — any barge-in the user sends while you are working will be appended to the next send_progress (or draw) return after a `---BARGE-IN---` sentinel.\n\n`first_quick_reply` is a SINGLE plain string — the primary suggested reply shown to the user (e.g. \"Yes, proceed\"). `more_quick_replies` is an array of additional option strings (e.g. [\"Wait\", \"Cancel\"]). Do NOT pass a JSON-encoded array as `first_quick_reply`; it must be a plain string.\n\nOptionally pass `image_urls` with an array of absolute paths to local image files (e.g., screenshots) to include them inline in the message.",
 	}, func(ctx context.Context, req *mcp.CallToolRequest, params *MessageParams) (*mcp.CallToolResult, any, error) {
+		bus := bus.ClientSession(mcpClientKey(req))
 		// Tick the ordinal regardless of whether we actually publish a bubble:
 		// the corresponding tool_use entry IS written to the agent's .jsonl
 		// even for the voice-mode-rejection branch, so the .jsonl-side count
@@ -377,6 +409,7 @@ func registerTools(server *mcp.Server, bus *EventBus) {
 
 		replies := append([]string{params.QuickReply}, params.MoreQuickReplies...)
 		files := resolveImageFiles(params.ImageURLs)
+		body, math := withMath(params.Text, params.Math)
 
 		// If user already sent messages, strip quick_replies and return
 		// queued messages immediately — the replies would be stale.
@@ -388,15 +421,16 @@ func registerTools(server *mcp.Server, bus *EventBus) {
 		defer stopKeepalive()
 
 		if bus.HasQueuedMessages() {
-			bus.Publish(Event{Type: "agentMessage", Text: params.Text, Files: files, AgentToolSeq: toolSeq, AgentToolName: "send_message"})
+			seq := bus.Publish(Event{Type: "agentMessage", Text: body, Math: math, Files: files, AgentToolSeq: toolSeq, AgentToolName: "send_message", ReplyTo: replyToSeq(bus, params.ReplyTo), Meta: bus.toolMeta(req, params.RelatedFiles)})
 			msgs, err := bus.WaitForMessagesStamped(waitCtx, "send_message", toolSeq)
 			if err != nil {
 				return nil, nil, fmt.Errorf("waiting for user message: %w", err)
 			}
 			bus.SetLastVoice(isVoiceMessage(msgs))
 			text := "User responded: " + FormatMessages(msgs) + "\n\n" + executeNotEchoGuidance + "\n\n" + voiceSuffix(msgs)
-			if uiURL != "" {
-				text += "\nChat UI: " + uiURL
+			text += "\n" + receiptSummary(bus.Receipts(seq))
+			if u := chatURL(); u != "" {
+				text += "\nChat UI: " + u
 			}
 			return &mcp.CallToolResult{
 				Content: []mcp.Content{
@@ -405,7 +439,7 @@ func registerTools(server *mcp.Server, bus *EventBus) {
 			}, nil, nil
 		}
 
-		bus.Publish(Event{Type: "agentMessage", Text: params.Text, QuickReplies: replies, Files: files, AgentToolSeq: toolSeq, AgentToolName: "send_message"})
+		seq := bus.Publish(Event{Type: "agentMessage", Text: body, Math: math, QuickReplies: replies, Files: files, AgentToolSeq: toolSeq, AgentToolName: "send_message", ReplyTo: replyToSeq(bus, params.ReplyTo), Meta: bus.toolMeta(req, params.RelatedFiles)})
 
 		msgs, err := bus.WaitForMessagesStamped(waitCtx, "send_message", toolSeq)
 		if err != nil {
@@ -414,8 +448,9 @@ func registerTools(server *mcp.Server, bus *EventBus) {
 
 		bus.SetLastVoice(isVoiceMessage(msgs))
 		text := "User responded: " + FormatMessages(msgs) + "\n\n" + executeNotEchoGuidance + "\n\n" + voiceSuffix(msgs)
-		if uiURL != "" {
-			text += "\nChat UI: " + uiURL
+		text += "\n" + receiptSummary(bus.Receipts(seq))
+		if u := chatURL(); u != "" {
+			text += "\nChat UI: " + u
 		}
 
 		return &mcp.CallToolResult{
@@ -429,6 +464,7 @@ func registerTools(server *mcp.Server, bus *EventBus) {
 		Name:        "send_verbal_reply",
 		Description: "Send a spoken reply to the user in voice mode. Use this tool when the user's message starts with 🎙 (microphone emoji), indicating they are using voice input. Keep replies conversational, concise, and plain text only — no markdown, no code blocks, no links. The text will be spoken aloud via browser text-to-speech. After speaking, the browser automatically listens for the user's next voice input.\n\nThis tool is TERMINAL: call it when the task is COMPLETE, when you need a decision only the user can make, or to confirm before a risky/destructive step. But if you can safely continue the work, you are NOT blocked — keep the same turn alive and send non-blocking send_verbal_progress updates at least every 60 seconds instead. Ending your turn SUSPENDS execution; there is no background worker.\n\n`first_quick_reply` is a SINGLE plain string — the primary suggested reply shown to the user (e.g. \"Yes, proceed\"). `more_quick_replies` is an array of additional option strings. Do NOT pass a JSON-encoded array as `first_quick_reply`; it must be a plain string.\n\nOptionally pass `image_urls` with an array of absolute paths to local image files (e.g., screenshots) to include them inline in the message.",
 	}, func(ctx context.Context, req *mcp.CallToolRequest, params *VerbalReplyParams) (*mcp.CallToolResult, any, error) {
+		bus := bus.ClientSession(mcpClientKey(req))
 		toolSeq := sendVerbalReplyCount.Add(1)
 		bus.CancelActiveWait()
 
@@ -459,15 +495,16 @@ func registerTools(server *mcp.Server, bus *EventBus) {
 		// If user already sent messages, strip quick_replies and return
 		// queued messages immediately — the replies would be stale.
 		if bus.HasQueuedMessages() {
-			bus.Publish(Event{Type: "verbalReply", Text: params.Text, Files: files, AgentToolSeq: toolSeq, AgentToolName: "send_verbal_reply"})
+			seq := bus.Publish(Event{Type: "verbalReply", Text: params.Text, Files: files, AgentToolSeq: toolSeq, AgentToolName: "send_verbal_reply", ReplyTo: replyToSeq(bus, params.ReplyTo), Meta: bus.toolMeta(req, params.RelatedFiles)})
 			msgs, err := bus.WaitForMessagesStamped(waitCtx, "send_verbal_reply", toolSeq)
 			if err != nil {
 				return nil, nil, fmt.Errorf("waiting for user message: %w", err)
 			}
 			bus.SetLastVoice(isVoiceMessage(msgs))
 			text := "User responded: " + FormatMessages(msgs) + "\n\n" + executeNotEchoGuidance + "\n\n" + voiceSuffix(msgs)
-			if uiURL != "" {
-				text += "\nChat UI: " + uiURL
+			text += "\n" + receiptSummary(bus.Receipts(seq))
+			if u := chatURL(); u != "" {
+				text += "\nChat UI: " + u
 			}
 			return &mcp.CallToolResult{
 				Content: []mcp.Content{
@@ -476,7 +513,7 @@ func registerTools(server *mcp.Server, bus *EventBus) {
 			}, nil, nil
 		}
 
-		bus.Publish(Event{Type: "verbalReply", Text: params.Text, QuickReplies: replies, Files: files, AgentToolSeq: toolSeq, AgentToolName: "send_verbal_reply"})
+		seq := bus.Publish(Event{Type: "verbalReply", Text: params.Text, QuickReplies: replies, Files: files, AgentToolSeq: toolSeq, AgentToolName: "send_verbal_reply", ReplyTo: replyToSeq(bus, params.ReplyTo), Meta: bus.toolMeta(req, params.RelatedFiles)})
 
 		msgs, err := bus.WaitForMessagesStamped(waitCtx, "send_verbal_reply", toolSeq)
 		if err != nil {
@@ -485,8 +522,9 @@ func registerTools(server *mcp.Server, bus *EventBus) {
 
 		bus.SetLastVoice(isVoiceMessage(msgs))
 		text := "User responded: " + FormatMessages(msgs) + "\n\n" + executeNotEchoGuidance + "\n\n" + voiceSuffix(msgs)
-		if uiURL != "" {
-			text += "\nChat UI: " + uiURL
+		text += "\n" + receiptSummary(bus.Receipts(seq))
+		if u := chatURL(); u != "" {
+			text += "\nChat UI: " + u
 		}
 
 		return &mcp.CallToolResult{
@@ -502,6 +540,9 @@ func registerTools(server *mcp.Server, bus *EventBus) {
 		Instructions     []any    `json:"instructions"`
 		QuickReply       string   `json:"first_quick_reply"`
 		MoreQuickReplies []string `json:"more_quick_replies,omitempty"`
+		RelatedFiles     []string `json:"related_files,omitempty" jsonschema:"Optional paths of the files this drawing is about; shown as chips under it and kept in exports."`
+		Theme            string   `json:"theme,omitempty" jsonschema:"Optional palette: auto (match the chat theme), light, dark or colorblind. Paints the board and sets the default ink, and lets setColor and fill name a role (primary, secondary, success, warning, error, neutral, ink, background) instead of a hex color. See whiteboard://themes."`
+		Canvas           string   `json:"canvas,omitempty" jsonschema:"Optional name of a canvas to keep drawing on: its layers carry over between draw calls with the same name, so the next slide can hide, dim or erase parts of this one."`
 	}
 
 	mcp.AddTool(server, &mcp.Tool{
@@ -526,13 +567,37 @@ COMMON TYPES: moveTo, lineTo, drawRect, drawCircle, writeText, setColor
 Read whiteboard://instructions for all instruction types with parameters.
 Read whiteboard://diagramming-guide for layout rules and cognitive principles.
 
+SHAPES: define a repeated shape once, drawn around (0,0), and stamp it where needed —
+  {"type":"defineShape","name":"box","instructions":[{"type":"drawRect","x":0,"y":0,"width":120,"height":50},{"type":"writeText","text":"{label}","x":15,"y":25}]},
+  {"type":"useShape","name":"box","x":100,"y":100,"args":{"label":"API"}}
+useShape shifts the shape's x and y by its own and fills {name} placeholders from args.
+
+BIG DIAGRAMS: {"type":"setCanvas","width":1800,"height":1100} enlarges the board (100–4000px each way). {"type":"setViewport","x":0,"y":0,"width":900,"height":550} shows only that region from then on, and zoomTo (same fields plus duration ms) pans there smoothly — walk the viewer through the diagram as you draw it.
+
+LAYERS: {"type":"layer","name":"cache"} puts what follows on layer "cache" (new layers go on top). hideLayer/showLayer, dimLayer (opacity, default 0.3), eraseLayer, bringToFront and sendToBack (all take name) change the picture at once; clearRegion (x, y, width, height) erases a rectangle. Give the same "canvas" name on the next draw call to start from this scene and change only what moves on.
+
+THEMES: pass "theme":"auto" (or light, dark, colorblind) and use role names as colors — {"type":"setColor","color":"primary"}, "fill":"success" — to match the chat without picking hex values. Read whiteboard://themes for the palettes.
+
 ` + "`first_quick_reply`" + ` is a SINGLE plain string — the primary reply option shown to the viewer. ` + "`more_quick_replies`" + ` is an array of additional option strings. Do NOT pass a JSON-encoded array as ` + "`first_quick_reply`" + `; it must be a plain string.`,
 	}, func(ctx context.Context, req *mcp.CallToolRequest, params *DrawParams) (*mcp.CallToolResult, any, error) {
+		bus := bus.ClientSession(mcpClientKey(req))
 		// Kill any orphaned blocking wait, and ack limbo: a draw call means
 		// the agent is actively working, so the previous delivery arrived.
 		bus.CancelActiveWait()
 		bus.AckLimbo()
 
+		instructions, layers, err := bus.prepareDrawing(params.Canvas, params.Theme, params.Instructions)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: "error: " + err.Error()}},
+				IsError: true,
+			}, nil, nil
+		}
+		params.Instructions = instructions
+		if layers != "" {
+			layers = "\nLayers, bottom to top: " + layers
+		}
+
 		if err := ensureHTTPServer(); err != nil {
 			return nil, nil, fmt.Errorf("failed to start chat server: %w", err)
 		}
@@ -550,18 +615,36 @@ Read whiteboard://diagramming-guide for layout rules and cognitive principles.
 		}
 
 		// Publish text as a chat bubble before the canvas
-		bus.Publish(Event{Type: "agentMessage", Text: params.Text})
+		meta := bus.toolMeta(req, params.RelatedFiles)
+		bus.Publish(Event{Type: "agentMessage", Text: params.Text, Meta: meta})
+
+		// A chat open only in pages that cannot draw gets the drawing as an
+		// image instead.
+		asImage := ""
+		drawEvent := func(e Event) Event {
+			if bus.ViewersSupport("draw") {
+				return e
+			}
+			img, err := drawImage(e.Instructions)
+			if err != nil {
+				return e
+			}
+			asImage = "\n(Shown as an image: the open chat tabs cannot draw.)"
+			e.Type, e.Instructions, e.Files = "agentMessage", nil, []FileRef{img}
+			return e
+		}
 
 		// If user already sent messages, show the draw without quick_replies
 		// and return immediately — the replies would be stale.
 		if bus.HasQueuedMessages() {
-			bus.Publish(Event{
+			bus.Publish(drawEvent(Event{
 				Type:         "draw",
 				Instructions: params.Instructions,
-			})
-			text := appendBargeIn(bus, "Draw displayed.")
-			if uiURL != "" {
-				text += "\nChat UI: " + uiURL
+				Meta:         meta,
+			}))
+			text := appendBargeIn(bus, "Draw displayed."+layers+asImage)
+			if u := chatURL(); u != "" {
+				text += "\nChat UI: " + u
 			}
 			return &mcp.CallToolResult{
 				Content: []mcp.Content{
@@ -572,12 +655,13 @@ Read whiteboard://diagramming-guide for layout rules and cognitive principles.
 
 		replies := append([]string{params.QuickReply}, params.MoreQuickReplies...)
 		ack := bus.CreateAck()
-		bus.Publish(Event{
+		bus.Publish(drawEvent(Event{
 			Type:         "draw",
 			Instructions: params.Instructions,
 			QuickReplies: replies,
 			AckID:        ack.ID,
-		})
+			Meta:         meta,
+		}))
 
 		waitCtx, endWait := bus.BeginBlockingWait(ctx)
 		defer endWait()
@@ -596,9 +680,10 @@ Read whiteboard://diagramming-guide for layout rules and cognitive principles.
 			msg := result[4:] // strip "ack:" prefix
 			text = "Viewer responded: " + msg + "\n\n(Reply to user in chat when done)"
 		}
+		text += layers + asImage
 
-		if uiURL != "" {
-			text += "\nChat UI: " + uiURL
+		if u := chatURL(); u != "" {
+			text += "\nChat UI: " + u
 		}
 
 		return &mcp.CallToolResult{
@@ -608,16 +693,234 @@ Read whiteboard://diagramming-guide for layout rules and cognitive principles.
 		}, nil, nil
 	})
 
+	// MeasureTextParams are the parameters for the measure_text tool.
+	type MeasureTextParams struct {
+		Text     string  `json:"text" jsonschema:"The label; newlines start new lines."`
+		FontSize float64 `json:"font_size,omitempty" jsonschema:"writeText fontSize; default 18."`
+		MaxWidth float64 `json:"max_width,omitempty" jsonschema:"Width of the box the text must fit, in canvas pixels; 0 for no wrapping."`
+		X        float64 `json:"x,omitempty" jsonschema:"Left edge of the box, to place the lines."`
+		Y        float64 `json:"y,omitempty" jsonschema:"Top edge of the box, to place the lines."`
+		Align    string  `json:"align,omitempty" jsonschema:"left (the default) or center within max_width."`
+	}
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "measure_text",
+		Description: "Measure a whiteboard label before drawing it: wraps text to max_width at font_size with the board's handwriting-font metrics and returns JSON with the wrapped lines, each line's width and writeText x/y, the block's width and height (including the background the board draws behind text), overflow if a single letter cannot fit, and ready writeText instructions. Size rectangles from width/height so labels stay inside.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, params *MeasureTextParams) (*mcp.CallToolResult, any, error) {
+		data, err := json.Marshal(measureText(params.Text, params.FontSize, params.MaxWidth, params.X, params.Y, params.Align == "center"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("marshal measurement: %w", err)
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: string(data)}},
+		}, nil, nil
+	})
+
+	// CountdownParams are the parameters for the confirm_countdown tool.
+	type CountdownParams struct {
+		Text         string   `json:"text" jsonschema:"The action you are about to take, specific enough to veto (e.g. 'Delete the 3 merged branches: a, b, c')."`
+		Seconds      int      `json:"seconds,omitempty" jsonschema:"How long the user has to intervene: default 15, at least 3, at most 600."`
+		OnTimeout    string   `json:"on_timeout,omitempty" jsonschema:"What silence means: 'approve' (the default) or 'reject'."`
+		RelatedFiles []string `json:"related_files,omitempty" jsonschema:"Optional paths of the files the action touches; shown as chips under the prompt and kept in exports."`
+	}
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "confirm_countdown",
+		Description: "Announce an action and give the user a veto window: the chat shows it with Approve and Reject buttons and a countdown of `seconds`, and blocks until someone answers or time runs out. Silence approves it (or rejects it, with on_timeout 'reject'). Use it for low-risk actions you would otherwise just do — the result says whether to go ahead. Anything the user types instead of Approve rejects the action and is returned to you as their message. Use send_message for decisions that need a real answer.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, params *CountdownParams) (*mcp.CallToolResult, any, error) {
+		bus := bus.ClientSession(mcpClientKey(req))
+		bus.CancelActiveWait()
+		bus.AckLimbo()
+
+		onTimeout := strings.ToLower(strings.TrimSpace(params.OnTimeout))
+		if onTimeout == "" {
+			onTimeout = "approve"
+		}
+		if onTimeout != "approve" && onTimeout != "reject" {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("error: on_timeout %q: want approve or reject", params.OnTimeout)}},
+				IsError: true,
+			}, nil, nil
+		}
+
+		if err := ensureHTTPServer(); err != nil {
+			return nil, nil, fmt.Errorf("failed to start chat server: %w", err)
+		}
+
+		httpMu.Lock()
+		shouldOpen := uiURL != "" && !browserOpened
+		if shouldOpen {
+			openBrowser(uiURL)
+			browserOpened = true
+		}
+		httpMu.Unlock()
+
+		// Nobody can veto in a chat nobody has open.
+		if err := bus.WaitForSubscriber(ctx); err != nil {
+			return nil, nil, fmt.Errorf("waiting for browser: %w", err)
+		}
+
+		// A message already waiting is the user intervening: read it first.
+		if bus.HasQueuedMessages() {
+			text := appendBargeIn(bus, "Not started: the user has sent messages since your last call. Do not go ahead yet.")
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: text}},
+			}, nil, nil
+		}
+
+		waitCtx, endWait := bus.BeginBlockingWait(ctx)
+		defer endWait()
+		stopKeepalive := keepaliveForRequest(waitCtx, req, "waiting for the countdown")
+		defer stopKeepalive()
+
+		window := countdownWindow(params.Seconds)
+		text := params.Text
+		if !bus.ViewersSupport("countdown") {
+			// Older pages show the buttons but no timer: say it in words.
+			text += fmt.Sprintf("\n\n_%s automatically in %d seconds unless you answer._", map[string]string{"approve": "Approving", "reject": "Rejecting"}[onTimeout], int(window.Seconds()))
+		}
+		res, err := bus.runCountdown(waitCtx, text, window, onTimeout, bus.toolMeta(req, params.RelatedFiles))
+		if err != nil {
+			return nil, nil, fmt.Errorf("confirm_countdown cancelled: %w", err)
+		}
+		text = res.text(window)
+		if u := chatURL(); u != "" {
+			text += "\nChat UI: " + u
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: text}},
+		}, nil, nil
+	})
+
+	// LocationParams are the parameters for the request_location tool.
+	type LocationParams struct {
+		Reason       string `json:"reason" jsonschema:"Why you need the user's location, shown on the request (e.g. 'To find coffee shops within walking distance')."`
+		HighAccuracy bool   `json:"high_accuracy,omitempty" jsonschema:"Ask the device for GPS-grade accuracy: slower and more battery, for street-level tasks."`
+	}
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "request_location",
+		Description: "Ask the user for their current location and wait for the answer. The chat shows your reason with Share / Don't share buttons; sharing goes through the browser's own permission dialog. Returns latitude, longitude and accuracy_m (metres) as JSON, or says the user declined or the browser could not locate them (it needs HTTPS or localhost). Use it for nearby searches, directions or local time and weather; never ask for a location you do not need.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, params *LocationParams) (*mcp.CallToolResult, any, error) {
+		bus := bus.ClientSession(mcpClientKey(req))
+		bus.CancelActiveWait()
+		bus.AckLimbo()
+
+		if err := ensureHTTPServer(); err != nil {
+			return nil, nil, fmt.Errorf("failed to start chat server: %w", err)
+		}
+
+		httpMu.Lock()
+		shouldOpen := uiURL != "" && !browserOpened
+		if shouldOpen {
+			openBrowser(uiURL)
+			browserOpened = true
+		}
+		httpMu.Unlock()
+
+		if err := bus.WaitForSubscriber(ctx); err != nil {
+			return nil, nil, fmt.Errorf("waiting for browser: %w", err)
+		}
+
+		// An older page has no Share button: nobody could answer.
+		if !bus.ViewersSupport("location") {
+			text := appendBargeIn(bus, "No open chat tab can share a location: the page predates request_location. Ask the user to reload the chat, or ask where they are with send_message.")
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: text}},
+			}, nil, nil
+		}
+
+		waitCtx, endWait := bus.BeginBlockingWait(ctx)
+		defer endWait()
+		stopKeepalive := keepaliveForRequest(waitCtx, req, "waiting for the user's location")
+		defer stopKeepalive()
+
+		res, err := bus.requestLocation(waitCtx, params.Reason, params.HighAccuracy, bus.toolMeta(req, nil))
+		if err != nil {
+			return nil, nil, fmt.Errorf("request_location cancelled: %w", err)
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: appendBargeIn(bus, res.text())}},
+		}, nil, nil
+	})
+
+	// PickFileParams are the parameters for the pick_file tool.
+	type PickFileParams struct {
+		Prompt   string `json:"prompt" jsonschema:"What the user should pick, shown on the request (e.g. 'Which log shows the crash?')."`
+		Path     string `json:"path,omitempty" jsonschema:"Directory to open the picker at, relative to the shared directory; empty for its top."`
+		Multiple bool   `json:"multiple,omitempty" jsonschema:"Let the user pick more than one file."`
+	}
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "pick_file",
+		Description: "Ask the user to choose one file (or several, with multiple=true) from the directory shared with -share-dir, and wait for the choice. The chat shows your prompt over a browser of that tree with Choose / Cancel. Returns the absolute paths picked, one per line, or says the user picked nothing. Use it instead of guessing which file the user means or asking them to type a path.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, params *PickFileParams) (*mcp.CallToolResult, any, error) {
+		bus := bus.ClientSession(mcpClientKey(req))
+		bus.CancelActiveWait()
+		bus.AckLimbo()
+
+		start, err := listShared(params.Path)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: "error: " + sharedError(err)}},
+				IsError: true,
+			}, nil, nil
+		}
+
+		if err := ensureHTTPServer(); err != nil {
+			return nil, nil, fmt.Errorf("failed to start chat server: %w", err)
+		}
+
+		httpMu.Lock()
+		shouldOpen := uiURL != "" && !browserOpened
+		if shouldOpen {
+			openBrowser(uiURL)
+			browserOpened = true
+		}
+		httpMu.Unlock()
+
+		if err := bus.WaitForSubscriber(ctx); err != nil {
+			return nil, nil, fmt.Errorf("waiting for browser: %w", err)
+		}
+
+		// An older page has no picker: nobody could answer.
+		if !bus.ViewersSupport("pickFile") {
+			text := appendBargeIn(bus, "No open chat tab can show a file picker: the page predates pick_file. Ask the user to reload the chat, or ask which file with send_message.")
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: text}},
+			}, nil, nil
+		}
+
+		waitCtx, endWait := bus.BeginBlockingWait(ctx)
+		defer endWait()
+		stopKeepalive := keepaliveForRequest(waitCtx, req, "waiting for the user to pick a file")
+		defer stopKeepalive()
+
+		pick, err := bus.pickFiles(waitCtx, params.Prompt, start.Path, params.Multiple, bus.toolMeta(req, nil))
+		if err != nil {
+			return nil, nil, fmt.Errorf("pick_file cancelled: %w", err)
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: appendBargeIn(bus, pick.text())}},
+		}, nil, nil
+	})
+
 	// ProgressParams are the parameters for the send_progress tool.
 	type ProgressParams struct {
-		Text      string   `json:"text"`
-		ImageURLs []string `json:"image_urls,omitempty"`
+		Text         string   `json:"text"`
+		ImageURLs    []string `json:"image_urls,omitempty"`
+		ReplyTo      int64    `json:"reply_to,omitempty" jsonschema:"Optional seq of the earlier chat message this answers (the #N of a 'replying to #N' note, or a seq from chat://history); the UI quotes it above your message."`
+		GroupID      string   `json:"group_id,omitempty" jsonschema:"Optional id for one long task (e.g. 'build'). Consecutive updates with the same group_id fold into a single expandable card showing the latest, instead of a bubble each."`
+		Replace      bool     `json:"replace,omitempty" jsonschema:"Overwrite your previous progress bubble instead of adding one, if nothing else was said since — for spinner-style 'Step 3/10...' updates."`
+		RelatedFiles []string `json:"related_files,omitempty" jsonschema:"Optional paths of the files this update is about (e.g. the ones you just edited); shown as chips under your message and kept in exports."`
+		Math         []string `json:"math,omitempty" jsonschema:"Optional LaTeX formulas (no $$ delimiters), each shown as a typeset display block after your text."`
 	}
 
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "send_progress",
 		Description: "Send a progress update to the chat UI without blocking. Use this for status updates (e.g., 'Working on it...', 'Found 3 matching files') when you want to keep the user informed but don't need a response. Unlike send_message, this returns immediately and is NON-TERMINAL: it does not end your turn and does not wait for the user. This is the correct tool whenever work remains — after it returns, immediately continue making tool calls in the same turn. Use it at least every 60 seconds during long work. If the user has sent a barge-in message since your last tool call, it will be appended to this call's return value after a `---BARGE-IN---` sentinel — treat that as a new instruction.",
 	}, func(ctx context.Context, req *mcp.CallToolRequest, params *ProgressParams) (*mcp.CallToolResult, any, error) {
+		bus := bus.ClientSession(mcpClientKey(req))
 		toolSeq := sendProgressCount.Add(1)
 		// A progress update means the agent is actively working: kill any
 		// orphaned blocking wait and ack the previous delivery as received.
@@ -629,9 +932,11 @@ Read whiteboard://diagramming-guide for layout rules and cognitive principles.
 		}
 
 		files := resolveImageFiles(params.ImageURLs)
-		bus.Publish(Event{Type: "agentMessage", Text: params.Text, Files: files, AgentToolSeq: toolSeq, AgentToolName: "send_progress"})
+		body, math := withMath(params.Text, params.Math)
+		seq := bus.Publish(Event{Type: "agentMessage", Text: body, Math: math, Files: files, AgentToolSeq: toolSeq, AgentToolName: "send_progress", ReplyTo: replyToSeq(bus, params.ReplyTo), Meta: bus.toolMeta(req, params.RelatedFiles), GroupID: strings.TrimSpace(params.GroupID), Replace: params.Replace})
+		receipt := receiptSummary(bus.awaitReceipts(ctx, seq))
 
-		ack := appendBargeIn(bus, "Progress sent. If you've finished your task, use send_message to present final results and wait for the user's next request.")
+		ack := appendBargeIn(bus, "Progress sent. "+receipt+" If you've finished your task, use send_message to present final results and wait for the user's next request.")
 		return &mcp.CallToolResult{
 			Content: []mcp.Content{
 				&mcp.TextContent{Text: ack},
@@ -641,14 +946,18 @@ Read whiteboard://diagramming-guide for layout rules and cognitive principles.
 
 	// VerbalProgressParams are the parameters for the send_verbal_progress tool.
 	type VerbalProgressParams struct {
-		Text      string   `json:"text"`
-		ImageURLs []string `json:"image_urls,omitempty"`
+		Text         string   `json:"text"`
+		ImageURLs    []string `json:"image_urls,omitempty"`
+		ReplyTo      int64    `json:"reply_to,omitempty" jsonschema:"Optional seq of the earlier chat message this answers (the #N of a 'replying to #N' note, or a seq from chat://history); the UI quotes it above your message."`
+		Replace      bool     `json:"replace,omitempty" jsonschema:"Overwrite your previous progress bubble instead of adding one, if nothing else was said since. The new text is still spoken."`
+		RelatedFiles []string `json:"related_files,omitempty" jsonschema:"Optional paths of the files this update is about (e.g. the ones you just edited); shown as chips under your message and kept in exports."`
 	}
 
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "send_verbal_progress",
 		Description: "Send a spoken progress update to the user in voice mode without blocking. Use this for non-blocking status updates that should be spoken aloud (e.g., 'Looking into that now', 'Found the issue'). Unlike send_verbal_reply, this returns immediately without waiting for a response and is NON-TERMINAL: it does not end your turn. This is the correct tool whenever work remains — after it returns, immediately continue making tool calls in the same turn. The text will be spoken via browser text-to-speech. Keep it conversational, concise, and plain text only — no markdown, no code blocks, no links. If the user has sent a barge-in message since your last tool call, it will be appended to this call's return value after a `---BARGE-IN---` sentinel — treat that as a new instruction.",
 	}, func(ctx context.Context, req *mcp.CallToolRequest, params *VerbalProgressParams) (*mcp.CallToolResult, any, error) {
+		bus := bus.ClientSession(mcpClientKey(req))
 		toolSeq := sendVerbalProgressCount.Add(1)
 		bus.CancelActiveWait()
 		bus.AckLimbo()
@@ -658,9 +967,10 @@ Read whiteboard://diagramming-guide for layout rules and cognitive principles.
 		}
 
 		files := resolveImageFiles(params.ImageURLs)
-		bus.Publish(Event{Type: "verbalReply", Text: params.Text, Files: files, AgentToolSeq: toolSeq, AgentToolName: "send_verbal_progress"})
+		seq := bus.Publish(Event{Type: "verbalReply", Text: params.Text, Files: files, AgentToolSeq: toolSeq, AgentToolName: "send_verbal_progress", ReplyTo: replyToSeq(bus, params.ReplyTo), Meta: bus.toolMeta(req, params.RelatedFiles), Replace: params.Replace})
+		receipt := receiptSummary(bus.awaitReceipts(ctx, seq))
 
-		ack := appendBargeIn(bus, "Verbal progress sent. If you've finished your task, use send_verbal_reply to present final results and wait for the user's next request.")
+		ack := appendBargeIn(bus, "Verbal progress sent. "+receipt+" If you've finished your task, use send_verbal_reply to present final results and wait for the user's next request.")
 		return &mcp.CallToolResult{
 			Content: []mcp.Content{
 				&mcp.TextContent{Text: ack},
@@ -668,12 +978,50 @@ Read whiteboard://diagramming-guide for layout rules and cognitive principles.
 		}, nil, nil
 	})
 
+	// ReportErrorParams are the parameters for the report_error tool.
+	type ReportErrorParams struct {
+		Message      string   `json:"message" jsonschema:"What went wrong, in a sentence the user can act on."`
+		Tool         string   `json:"tool,omitempty" jsonschema:"Optional name of the tool or command that failed (e.g. 'Bash', 'go test')."`
+		Detail       string   `json:"detail,omitempty" jsonschema:"Optional output, log lines or stack trace; shown folded under the message (cut at 8KB)."`
+		RelatedFiles []string `json:"related_files,omitempty" jsonschema:"Optional paths of the files the error is about; shown as chips under it."`
+	}
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "report_error",
+		Description: "Tell the user something failed, without blocking. The error shows in the chat as a red card (and as a desktop notification when the chat's tab is in the background), so use it for failures the user should know about — a build that broke, a command you could not run, a file you could not read — rather than mentioning them in passing or not at all. Failed agent-chat tool calls are reported this way automatically. Like send_progress this is NON-TERMINAL: keep working afterwards, or use send_message to ask the user how to proceed.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, params *ReportErrorParams) (*mcp.CallToolResult, any, error) {
+		bus := bus.ClientSession(mcpClientKey(req))
+		bus.CancelActiveWait()
+		bus.AckLimbo()
+
+		if strings.TrimSpace(params.Message) == "" {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: "error: message is required"}},
+				IsError: true,
+			}, nil, nil
+		}
+		if err := ensureHTTPServer(); err != nil {
+			return nil, nil, fmt.Errorf("failed to start chat server: %w", err)
+		}
+		seq, err := bus.ReportError(AgentError{Message: params.Message, Tool: strings.TrimSpace(params.Tool), Detail: params.Detail}, bus.toolMeta(req, params.RelatedFiles))
+		if err != nil {
+			return nil, nil, err
+		}
+		receipt := receiptSummary(bus.awaitReceipts(ctx, seq))
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: appendBargeIn(bus, "Error reported. "+receipt)},
+			},
+		}, nil, nil
+	})
+
 	type EmptyParams struct{}
 
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "check_messages",
-		Description: "Drain pending user messages from the queue. Returns user messages prefixed with `User said: …` when present. When the queue is empty, returns `{\"queue\":\"empty\"}` followed by guidance NOT to send a user-visible reply just to report the empty state — return to your previous task or wait silently. The result may also carry a `---REDELIVERY---` section repeating earlier message(s) whose delivery to you may have been lost (e.g. a timed-out send_message) — ignore any you have already handled.",
+		Description: "Drain pending user messages from the queue. Returns user messages prefixed with `User said: …` when present, including emoji reactions to your messages (`User reacted 👎 to message #N: \"…\"`) — treat 👎 as \"that's wrong\" and ❓ as \"explain\". When the queue is empty, returns `{\"queue\":\"empty\"}` followed by guidance NOT to send a user-visible reply just to report the empty state — return to your previous task or wait silently. The result may also carry a `---REDELIVERY---` section repeating earlier message(s) whose delivery to you may have been lost (e.g. a timed-out send_message) — ignore any you have already handled.",
 	}, func(ctx context.Context, req *mcp.CallToolRequest, params *EmptyParams) (*mcp.CallToolResult, any, error) {
+		bus := bus.ClientSession(mcpClientKey(req))
 		// Tick per call (empty or not) so the ordinal stays aligned with the
 		// .jsonl-side count of check_messages tool_use entries.
 		toolSeq := checkMessagesCount.Add(1)
@@ -709,17 +1057,25 @@ Read whiteboard://diagramming-guide for layout rules and cognitive principles.
 
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "set_chat_title",
-		Description: "Name the streaming chat-log export (enabled when AGENT_CHAT_EXPORT_DIR is set). Call it once the task at hand is clear — the auto-written ./agent-chats/YYYY-MM-DD-NN-untitled.md is renamed to …-{slugified-title}.md and its header rewritten; call again anytime to rename. Titles are per-session; keep them short and descriptive (e.g. 'Auth bug fix').",
+		Description: "Name the streaming chat-log export (enabled when AGENT_CHAT_EXPORT_DIR is set). Call it once the task at hand is clear — the auto-written ./agent-chats/YYYY-MM-DD-NN-untitled.md is renamed to …-{slugified-title}.md and its header rewritten; call again anytime to rename. Titles are per-session; keep them short and descriptive (e.g. 'Auth bug fix'). Unless the server has a -session-name, the title also names the session: the browser tab, notifications, exports and `agent-chat list`.",
 	}, func(ctx context.Context, req *mcp.CallToolRequest, params *SetChatTitleParams) (*mcp.CallToolResult, any, error) {
+		bus := bus.ClientSession(mcpClientKey(req))
 		bus.CancelActiveWait()
 		bus.AckLimbo()
 		if chatStream == nil {
+			// The title still names the session (page title, registry).
+			if strings.TrimSpace(params.Title) == "" {
+				return &mcp.CallToolResult{
+					Content: []mcp.Content{&mcp.TextContent{Text: "error: title is required"}},
+					IsError: true,
+				}, nil, nil
+			}
+			setChatTitle(params.Title)
 			return &mcp.CallToolResult{
-				Content: []mcp.Content{&mcp.TextContent{Text: "error: streaming chat-log export is disabled — set AGENT_CHAT_EXPORT_DIR to enable it (export_chat_md still works for manual exports)"}},
-				IsError: true,
+				Content: []mcp.Content{&mcp.TextContent{Text: "Chat titled " + strconv.Quote(cleanSessionName(params.Title)) + ". No chat-log file was named: streaming export is disabled — set AGENT_CHAT_EXPORT_DIR to enable it (export_chat_md still works for manual exports)"}},
 			}, nil, nil
 		}
-		events, _ := bus.History()
+		events := bus.FullHistory()
 		// Whether the index needs rewriting is decided against the name the
 		// file had BEFORE the rename: only an export already in the manifest
 		// (i.e. previously closed out, and probably committed) would be left
@@ -733,6 +1089,7 @@ Read whiteboard://diagramming-guide for layout rules and cognitive principles.
 				IsError: true,
 			}, nil, nil
 		}
+		setChatTitle(params.Title)
 		if published {
 			if err := regenerateIndexHTML(chatStream.Dir()); err != nil {
 				return nil, nil, err
@@ -751,6 +1108,7 @@ Read whiteboard://diagramming-guide for layout rules and cognitive principles.
 		Name:        "chatlog_close",
 		Description: "Close out the streaming chat-log export so the archive can be git-committed cleanly: freezes this session's .md (no further appends — later messages are backfilled from history if set_chat_title re-opens it; the JSONL event log keeps recording regardless), regenerates index.html one last time, and returns the exact paths to `git add`. If the export is still untitled, `title` is REQUIRED and names it in the same call; an already-titled export is never renamed here. Idempotent. Typical close-out: deliver the final answer → chatlog_close → git add the returned paths → commit.",
 	}, func(ctx context.Context, req *mcp.CallToolRequest, params *ChatlogCloseParams) (*mcp.CallToolResult, any, error) {
+		bus := bus.ClientSession(mcpClientKey(req))
 		bus.CancelActiveWait()
 		bus.AckLimbo()
 		if chatStream == nil {
@@ -759,7 +1117,7 @@ Read whiteboard://diagramming-guide for layout rules and cognitive principles.
 				IsError: true,
 			}, nil, nil
 		}
-		events, _ := bus.History()
+		events := bus.FullHistory()
 		paths, err := chatStream.CloseOut(params.Title, events)
 		if err != nil {
 			return &mcp.CallToolResult{
@@ -767,6 +1125,9 @@ Read whiteboard://diagramming-guide for layout rules and cognitive principles.
 				IsError: true,
 			}, nil, nil
 		}
+		if strings.TrimSpace(params.Title) != "" {
+			setChatTitle(params.Title)
+		}
 		// Relative paths are friendlier for git add; fall back to absolute.
 		if cwd, err := os.Getwd(); err == nil {
 			for i, p := range paths {
@@ -784,6 +1145,7 @@ Read whiteboard://diagramming-guide for layout rules and cognitive principles.
 		Name:        "chatlog_optout",
 		Description: "Stop the streaming chat-log export for this session and delete its .md file (assets are left alone — their content-sha names may be shared by other sessions; index.html is regenerated). Use when the user asks not to archive this conversation. Re-enable later by calling set_chat_title.",
 	}, func(ctx context.Context, req *mcp.CallToolRequest, params *EmptyParams) (*mcp.CallToolResult, any, error) {
+		bus := bus.ClientSession(mcpClientKey(req))
 		bus.CancelActiveWait()
 		bus.AckLimbo()
 		if chatStream == nil {
@@ -801,7 +1163,7 @@ Read whiteboard://diagramming-guide for layout rules and cognitive principles.
 	})
 
 	type ExportChatMDParams struct {
-		Title      string `json:"title" jsonschema:"Short kebab-case slug describing the chat (e.g. 'auth-bug-fix'). Used to name the output file."`
+		Title      string `json:"title,omitempty" jsonschema:"Short kebab-case slug describing the chat (e.g. 'auth-bug-fix'). Used to name the output file. Defaults to the session name (-session-name or set_chat_title)."`
 		TargetDir  string `json:"target_dir,omitempty" jsonschema:"Optional override directory. If set, must resolve inside the current working directory. Defaults to ./agent-chats."`
 	}
 
@@ -809,6 +1171,7 @@ Read whiteboard://diagramming-guide for layout rules and cognitive principles.
 		Name:        "export_chat_md",
 		Description: "Manually export the current chat as a markdown file (script-style: `**USER**` / `**AGENT**` markers with `> ` blockquoted bodies, elapsed-time annotations, and trailing `[Quick replies]` blocks) for review on GitHub/GitLab and viewing in a sibling bubble UI. NOTE: when AGENT_CHAT_EXPORT_DIR is set the chat log auto-exports continuously (see set_chat_title) — this tool is the manual escape hatch for a custom target_dir or a forced full export. Writes ./agent-chats/YYYY-MM-DD-NN-{title}.md, copies attachments into ./agent-chats/assets/ (content-sha filenames, relative-path links from the .md), refreshes viewer.css/viewer.js, and regenerates ./agent-chats/index.html — the chat-archive landing page — from the .md files on disk (newest first). Path safety: target_dir cannot escape cwd.",
 	}, func(ctx context.Context, req *mcp.CallToolRequest, params *ExportChatMDParams) (*mcp.CallToolResult, any, error) {
+		bus := bus.ClientSession(mcpClientKey(req))
 		bus.CancelActiveWait()
 		bus.AckLimbo()
 		cwd, err := os.Getwd()
@@ -817,7 +1180,11 @@ Read whiteboard://diagramming-guide for layout rules and cognitive principles.
 		}
 		cwdClean := filepath.Clean(cwd)
 
-		slug := slugifyTitle(params.Title)
+		title := params.Title
+		if strings.TrimSpace(title) == "" {
+			title = sessionName()
+		}
+		slug := slugifyTitle(title)
 		if slug == "" {
 			return &mcp.CallToolResult{
 				Content: []mcp.Content{&mcp.TextContent{Text: "error: title is required (a short kebab-case slug, e.g. 'auth-bug-fix')"}},
@@ -843,7 +1210,7 @@ Read whiteboard://diagramming-guide for layout rules and cognitive principles.
 			rootDir = filepath.Join(cwd, "agent-chats")
 		}
 
-		events, _ := bus.History()
+		events := bus.FullHistory()
 		mdPath, warnings, err := runChatMarkdownExport(rootDir, slug, events, "claude", version+" ("+commit+")", time.Now())
 		if err != nil {
 			return nil, nil, err
@@ -858,6 +1225,350 @@ Read whiteboard://diagramming-guide for layout rules and cognitive principles.
 			Content: []mcp.Content{&mcp.TextContent{Text: summary}},
 		}, nil, nil
 	})
+
+	type ExportTranscriptParams struct {
+		Format string `json:"format,omitempty" jsonschema:"'md' (default) or 'html'. 'pdf' is not available: export html and print it to PDF from a browser."`
+		Title  string `json:"title,omitempty" jsonschema:"Transcript title; also names the file. Defaults to the session name, else 'Chat transcript'."`
+	}
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "export_transcript",
+		Description: "Write a self-contained transcript of the session so far (attachments inlined, drawings as SVG, unsent messages omitted) into the upload directory and return its path and URL — e.g. to write up what was done and attach it with send_message. Unlike export_chat_md this touches nothing in the repo.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, params *ExportTranscriptParams) (*mcp.CallToolResult, any, error) {
+		bus := bus.ClientSession(mcpClientKey(req))
+		bus.CancelActiveWait()
+		bus.AckLimbo()
+		format := strings.ToLower(strings.TrimSpace(params.Format))
+		switch format {
+		case "":
+			format = "md"
+		case "md", "html":
+		case "pdf":
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: "error: pdf export is not supported — export format 'html' and print it to PDF from a browser"}},
+				IsError: true,
+			}, nil, nil
+		default:
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("error: format must be 'md' or 'html', got %q", params.Format)}},
+				IsError: true,
+			}, nil, nil
+		}
+		title := strings.TrimSpace(params.Title)
+		if title == "" {
+			title = sessionName()
+		}
+		if title == "" {
+			title = "Chat transcript"
+		}
+
+		events := bus.FullHistory()
+		doc, warnings := renderTranscript(events, format, title, uploadDir)
+		name := fmt.Sprintf("transcript-%s-%s.%s", time.Now().Format("20060102-150405"), slugifyTitle(title), format)
+		path := filepath.Join(uploadDir, name)
+		if err := os.WriteFile(path, []byte(doc), 0644); err != nil {
+			return nil, nil, fmt.Errorf("write transcript: %w", err)
+		}
+
+		text := "Transcript written to " + path
+		if u := chatURL(); u != "" {
+			text += "\nURL: " + u + "/uploads/" + name
+		}
+		if len(warnings) > 0 {
+			text += fmt.Sprintf("\n\n%d warning(s):\n- %s", len(warnings), strings.Join(warnings, "\n- "))
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: text}},
+		}, nil, nil
+	})
+
+	type SetIdentityParams struct {
+		Name   string `json:"name" jsonschema:"Name shown on your messages and in exports (e.g. 'Reviewer'). At most 40 characters."`
+		Color  string `json:"color,omitempty" jsonschema:"Avatar color: a hex color like '#7c3aed' or a CSS color name. Derived from the name when omitted."`
+		Avatar string `json:"avatar,omitempty" jsonschema:"An emoji or initials for the avatar. The name's initial when omitted."`
+	}
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "set_identity",
+		Description: "Set the name, color and avatar shown on your messages in the chat UI and in exports. Useful when several agents share one chat. Applies to messages sent from now on; call again to change it.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, params *SetIdentityParams) (*mcp.CallToolResult, any, error) {
+		bus := bus.ClientSession(mcpClientKey(req))
+		bus.CancelActiveWait()
+		bus.AckLimbo()
+		id, err := newAgentIdentity(params.Name, params.Color, params.Avatar)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: "error: " + err.Error()}},
+				IsError: true,
+			}, nil, nil
+		}
+		bus.SetIdentity(id)
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: "Identity set: your messages now show as " + id.Name + "."}},
+		}, nil, nil
+	})
+
+	type SearchMessagesParams struct {
+		Query string `json:"query" jsonschema:"Text to find (case-insensitive substring), or a Go regular expression when regex is true. Also matches attachment file names."`
+		Regex bool   `json:"regex,omitempty" jsonschema:"Treat query as a regular expression."`
+		Limit int    `json:"limit,omitempty" jsonschema:"Maximum hits to return (default 20, at most 200)."`
+	}
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "search_messages",
+		Description: "Search the chat history (message text and attachment names; unsent messages excluded) and return matching messages as JSON, newest first: seq, type, timestamp and an excerpt around the match. Use it to find an earlier decision or command instead of asking the user to repeat it; a hit's seq can be passed as reply_to.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, params *SearchMessagesParams) (*mcp.CallToolResult, any, error) {
+		bus := bus.ClientSession(mcpClientKey(req))
+		bus.CancelActiveWait()
+		bus.AckLimbo()
+		hits, err := bus.Search(params.Query, params.Regex, params.Limit)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: "error: " + err.Error()}},
+				IsError: true,
+			}, nil, nil
+		}
+		if hits == nil {
+			hits = []searchHit{}
+		}
+		data, err := json.Marshal(hits)
+		if err != nil {
+			return nil, nil, fmt.Errorf("marshal hits: %w", err)
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: string(data)}},
+		}, nil, nil
+	})
+
+	type PinMessageParams struct {
+		Seq   int64 `json:"seq" jsonschema:"Seq of the message to pin (as in reply_to, search_messages or get_pins)."`
+		Unpin bool  `json:"unpin,omitempty" jsonschema:"Unpin the message instead."`
+	}
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "pin_message",
+		Description: "Pin a message (yours or the user's) to the top of the chat, or unpin it with unpin=true. Pins are shown to every viewer, listed by get_pins, and lead exported transcripts — use them for decisions, commands or links worth keeping in view.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, params *PinMessageParams) (*mcp.CallToolResult, any, error) {
+		bus := bus.ClientSession(mcpClientKey(req))
+		bus.CancelActiveWait()
+		bus.AckLimbo()
+		if err := bus.Pin(params.Seq, !params.Unpin); err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: "error: " + err.Error()}},
+				IsError: true,
+			}, nil, nil
+		}
+		text := fmt.Sprintf("Pinned #%d.", params.Seq)
+		if params.Unpin {
+			text = fmt.Sprintf("Unpinned #%d.", params.Seq)
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: text}},
+		}, nil, nil
+	})
+
+	type RedactMessageParams struct {
+		Seq int64  `json:"seq,omitempty" jsonschema:"Seq of the message to redact (as in reply_to, search_messages or get_pins)."`
+		ID  string `json:"id,omitempty" jsonschema:"Or the id of a user message, as get_history shows it."`
+	}
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "redact_message",
+		Description: "Scrub a message (yours or the user's) that exposed a secret or personal data: its text becomes [redacted] and its attachments, drawing and link previews are dropped, in every open tab, the event log on disk and the chat-log export. Give seq, or id for a user message. The redaction itself is recorded, not the content. Uploaded files are not deleted.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, params *RedactMessageParams) (*mcp.CallToolResult, any, error) {
+		bus := bus.ClientSession(mcpClientKey(req))
+		bus.CancelActiveWait()
+		bus.AckLimbo()
+		seq := params.Seq
+		if seq == 0 && params.ID != "" {
+			seq = bus.seqOfID(params.ID)
+		}
+		err := fmt.Errorf("give the seq (or id) of the message to redact")
+		if seq != 0 {
+			err = bus.Redact(seq)
+		}
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: "error: " + err.Error()}},
+				IsError: true,
+			}, nil, nil
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Redacted #%d.", seq)}},
+		}, nil, nil
+	})
+
+	type HighlightParams struct {
+		Seq    int64    `json:"seq,omitempty" jsonschema:"Seq of the message or drawing to point at; defaults to the latest drawing."`
+		X      *float64 `json:"x,omitempty" jsonschema:"With y, a point on the drawing in its canvas coordinates."`
+		Y      *float64 `json:"y,omitempty"`
+		Width  float64  `json:"width,omitempty" jsonschema:"With height, makes (x, y) the top-left corner of a region to box."`
+		Height float64  `json:"height,omitempty"`
+		Canvas string   `json:"canvas,omitempty" jsonschema:"The draw canvas name the layer is on."`
+		Layer  string   `json:"layer,omitempty" jsonschema:"Instead of x and y, box everything on this layer of the canvas."`
+		TTLMs  int      `json:"ttl_ms,omitempty" jsonschema:"How long the highlight stays up, in milliseconds (default 3000, at most 30000)."`
+	}
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "highlight",
+		Description: "Point at something while you explain it, like a laser pointer: a pulsing dot at a point of a drawing, a box around a region or a layer of it, or a glow around a whole message when no x and y are given. It fades after ttl_ms and is not kept in the chat history. Returns at once; use it between send_verbal_reply or draw calls to guide the user's eye.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, params *HighlightParams) (*mcp.CallToolResult, any, error) {
+		bus := bus.ClientSession(mcpClientKey(req))
+		bus.CancelActiveWait()
+		bus.AckLimbo()
+		ev, err := bus.Highlight(highlightTarget{
+			Seq: params.Seq, X: params.X, Y: params.Y, Width: params.Width, Height: params.Height,
+			Canvas: params.Canvas, Layer: params.Layer, TTL: params.TTLMs,
+		})
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: "error: " + err.Error()}},
+				IsError: true,
+			}, nil, nil
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Highlighted #%d for %dms.", ev["seq"], ev["ttl_ms"])}},
+		}, nil, nil
+	})
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_pins",
+		Description: "List the pinned messages as JSON, in the order they were pinned: seq, type, timestamp and text excerpt. The user can pin messages from the chat UI too, so check here for what they flagged as important.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, params *EmptyParams) (*mcp.CallToolResult, any, error) {
+		bus := bus.ClientSession(mcpClientKey(req))
+		bus.CancelActiveWait()
+		bus.AckLimbo()
+		data, err := json.Marshal(pinItems(bus.Pins()))
+		if err != nil {
+			return nil, nil, fmt.Errorf("marshal pins: %w", err)
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: string(data)}},
+		}, nil, nil
+	})
+
+	type WipeSessionParams struct {
+		Confirm string `json:"confirm" jsonschema:"Must be exactly 'wipe': the deletion cannot be undone."`
+	}
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "wipe_session",
+		Description: "Permanently delete this chat session when the user asks for their data to be erased: the event log, the uploads and pastes its messages reference, its streaming chat-log export, and the history, read receipts, display names, title and undelivered user messages held in memory. Connected tabs are told (sessionWiped) and start over empty. Allowed only when the server runs with -allow-wipe. Confirm with the user first; pass confirm: 'wipe'.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, params *WipeSessionParams) (*mcp.CallToolResult, any, error) {
+		session := bus.ClientSession(mcpClientKey(req))
+		session.CancelActiveWait()
+		session.AckLimbo()
+		if !allowWipe {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: "error: wiping is off; start agent-chat with -allow-wipe"}},
+				IsError: true,
+			}, nil, nil
+		}
+		if params.Confirm != "wipe" {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: "error: confirm must be 'wipe' (this cannot be undone)"}},
+				IsError: true,
+			}, nil, nil
+		}
+		if st := chatStream.Status(); st.Exists {
+			zeroFile(st.Path)
+			if err := chatStream.Optout(); err != nil {
+				return nil, nil, fmt.Errorf("delete chat-log export: %w", err)
+			}
+		}
+		events, err := bus.Wipe()
+		if err != nil {
+			return nil, nil, fmt.Errorf("wipe event log: %w", err)
+		}
+		n, err := shredAll(uploadsToWipe(events, uploadDir))
+		if err != nil {
+			return nil, nil, fmt.Errorf("wipe uploads: %w", err)
+		}
+		setChatTitle("")
+		audit.Record(nil, auditRecord{Event: "sessionWiped", Files: n})
+		bus.PublishTransient(map[string]any{"type": "sessionWiped"})
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Session wiped: %d events and %d uploads deleted.", len(events), n)}},
+		}, nil, nil
+	})
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_pairing_code",
+		Description: "Get the code a new browser must enter to pair with this chat when it is opened from another device (the server runs with -pairing or -tunnel). Codes are short-lived and single-use; give it to the user through your own terminal, never in the chat.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, params *EmptyParams) (*mcp.CallToolResult, any, error) {
+		bus := bus.ClientSession(mcpClientKey(req))
+		bus.CancelActiveWait()
+		bus.AckLimbo()
+		if pairing == nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: "error: pairing is off; start agent-chat with -pairing or -tunnel"}},
+				IsError: true,
+			}, nil, nil
+		}
+		code, expires := pairing.Code()
+		data, err := json.Marshal(map[string]any{"code": code, "expires": expires.UnixMilli()})
+		if err != nil {
+			return nil, nil, fmt.Errorf("marshal pairing code: %w", err)
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: string(data)}},
+		}, nil, nil
+	})
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_status",
+		Description: "Report, as JSON, how many browser tabs are viewing the chat, how many user messages are queued for you, whether the user is in voice mode, the delivery receipt of your last message (`delivered`: tabs that rendered it, `seen`: tabs that rendered it while visible), and `features`: how many tabs can render each feature (e.g. draw, countdown, location), with `legacy_viewers` counting older pages that only render the basics. Use it to tell whether anyone saw an update before you wait on a reply.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, params *EmptyParams) (*mcp.CallToolResult, any, error) {
+		bus := bus.ClientSession(mcpClientKey(req))
+		bus.CancelActiveWait()
+		bus.AckLimbo()
+		data, err := json.Marshal(bus.Status())
+		if err != nil {
+			return nil, nil, fmt.Errorf("marshal status: %w", err)
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: string(data)}},
+		}, nil, nil
+	})
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_client_info",
+		Description: "Describe, as JSON, each browser tab viewing the chat: device (mobile, tablet, desktop), user agent, platform, language, time zone, viewport size in CSS pixels, pixel ratio, touch, color-scheme preference and the chat's theme, and whether it can speak replies (speech_synthesis) and take voice input (speech_recognition). Use it to fit your output to the screen — e.g. narrower draw canvases for a phone, no verbal replies where speech is unsupported. A tab with reported=false has not sent its details.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, params *EmptyParams) (*mcp.CallToolResult, any, error) {
+		bus := bus.ClientSession(mcpClientKey(req))
+		bus.CancelActiveWait()
+		bus.AckLimbo()
+		data, err := json.Marshal(bus.clientInfoReport())
+		if err != nil {
+			return nil, nil, fmt.Errorf("marshal client info: %w", err)
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: string(data)}},
+		}, nil, nil
+	})
+
+	type ListSharedFilesParams struct {
+		Path string `json:"path,omitempty" jsonschema:"Directory to list, relative to the shared directory; empty for its top."`
+	}
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "list_shared_files",
+		Description: "List a directory of the tree the server shares read-only with the user (-share-dir): one line per entry with its size (or dir) and path. The user can browse the same tree from the chat and attach its files to messages; those arrive with their path on disk, so there is nothing to download.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, params *ListSharedFilesParams) (*mcp.CallToolResult, any, error) {
+		bus := bus.ClientSession(mcpClientKey(req))
+		bus.CancelActiveWait()
+		bus.AckLimbo()
+		listing, err := listShared(params.Path)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: "error: " + sharedError(err)}},
+				IsError: true,
+			}, nil, nil
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: formatSharedListing(listing)}},
+		}, nil, nil
+	})
 }
 
 // registerOrchestratorTools registers tools on a separate MCP server for
@@ -4,6 +4,8 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
@@ -60,6 +62,27 @@ func TestFormatMessagesVoice(t *testing.T) {
 	}
 }
 
+func TestFormatMessagesReplyTo(t *testing.T) {
+	msgs := []UserMessage{{Text: "yes", ReplyTo: 42, Quote: "Delete the old branch?"}}
+	got := FormatMessages(msgs)
+	want := "(replying to #42: \"Delete the old branch?\")\nyes"
+	if got != want {
+		t.Errorf("FormatMessages reply:\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestFormatMessagesReaction(t *testing.T) {
+	msgs := []UserMessage{
+		{ReplyTo: 42, Quote: "Delete the old branch?", Reaction: "👎"},
+		{Text: "keep it"},
+	}
+	got := FormatMessages(msgs)
+	want := "User reacted 👎 to message #42: \"Delete the old branch?\"\n\nkeep it"
+	if got != want {
+		t.Errorf("FormatMessages reaction:\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
 func TestFormatMessagesWithFileAttachment(t *testing.T) {
 	msgs := []UserMessage{{
 		Text: "check this file",
@@ -739,3 +762,120 @@ func TestKeepaliveForRequestNoTokenNoOp(t *testing.T) {
 	stop := keepaliveForRequest(context.Background(), &mcp.CallToolRequest{}, "waiting")
 	stop()
 }
+
+// callTool runs one tools/call against a server with registerTools over an
+// in-memory transport and returns the result's text.
+func callTool(t *testing.T, eb *EventBus, name string, args map[string]any) (string, bool) {
+	t.Helper()
+	server := mcp.NewServer(&mcp.Implementation{Name: "agent-chat", Version: "test"}, nil)
+	registerTools(server, eb)
+	return callServerTool(t, server, name, args)
+}
+
+// callServerTool is callTool against an already configured server.
+func callServerTool(t *testing.T, server *mcp.Server, name string, args map[string]any) (string, bool) {
+	t.Helper()
+	ctx := context.Background()
+	st, ct := mcp.NewInMemoryTransports()
+	ss, err := server.Connect(ctx, st, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "test"}, nil)
+	cs, err := client.Connect(ctx, ct, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cs.Close()
+	res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: name, Arguments: args})
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	var text []string
+	for _, c := range res.Content {
+		if tc, ok := c.(*mcp.TextContent); ok {
+			text = append(text, tc.Text)
+		}
+	}
+	return strings.Join(text, "\n"), res.IsError
+}
+
+// Two agents on the stateless /mcp endpoint are told apart by the
+// Mcp-Session-Id they echo: a reply the browser sends to the second agent is
+// invisible to the first agent's check_messages.
+func TestToolsIsolateHTTPClients(t *testing.T) {
+	eb := NewEventBus()
+	server := mcp.NewServer(&mcp.Implementation{Name: "agent-chat", Version: "test"}, nil)
+	registerTools(server, eb)
+	ts := httptest.NewServer(mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return server }, &mcp.StreamableHTTPOptions{Stateless: true}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	connect := func() *mcp.ClientSession {
+		client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "test"}, nil)
+		cs, err := client.Connect(ctx, &mcp.StreamableClientTransport{Endpoint: ts.URL}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { cs.Close() })
+		return cs
+	}
+	checkMessages := func(cs *mcp.ClientSession) string {
+		res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: "check_messages", Arguments: map[string]any{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Content[0].(*mcp.TextContent).Text
+	}
+	a, b := connect(), connect()
+	checkMessages(a) // a claims the primary session
+	checkMessages(b)
+	if a.ID() == "" || a.ID() == b.ID() {
+		t.Fatalf("clients should have distinct session IDs, got %q and %q", a.ID(), b.ID())
+	}
+
+	eb.Session(b.ID()).ReceiveUserMessage("hello b", nil)
+	if got := checkMessages(a); !strings.Contains(got, `{"queue":"empty"}`) {
+		t.Errorf("a saw b's reply: %s", got)
+	}
+	if got := checkMessages(b); !strings.Contains(got, "hello b") {
+		t.Errorf("b did not get its reply: %s", got)
+	}
+}
+
+func TestSetIdentityTool(t *testing.T) {
+	eb := NewEventBus()
+	if text, isErr := callTool(t, eb, "set_identity", map[string]any{"name": "Reviewer", "color": "teal"}); isErr {
+		t.Fatalf("set_identity failed: %s", text)
+	}
+	if id := eb.Identity(); id == nil || id.Name != "Reviewer" || id.Color != "teal" {
+		t.Fatalf("identity = %+v", id)
+	}
+	if text, isErr := callTool(t, eb, "set_identity", map[string]any{"name": ""}); !isErr {
+		t.Errorf("empty name accepted: %s", text)
+	}
+}
+
+func TestSendProgressReplyTo(t *testing.T) {
+	eb := NewEventBus()
+	id := eb.ReceiveUserMessage("which file?", nil)
+	eb.DrainMessages()
+	var seq int64
+	for _, e := range eb.EventsSince(0) {
+		if e.ID == id {
+			seq = e.Seq
+		}
+	}
+	callTool(t, eb, "send_progress", map[string]any{"text": "main.go", "reply_to": seq})
+	callTool(t, eb, "send_progress", map[string]any{"text": "bogus", "reply_to": 9999})
+	var got []int64
+	for _, e := range eb.EventsSince(0) {
+		if e.Type == "agentMessage" {
+			got = append(got, e.ReplyTo)
+		}
+	}
+	if len(got) != 2 || got[0] != seq || got[1] != 0 {
+		t.Errorf("agentMessage reply_to = %v, want [%d 0]", got, seq)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Operators can trim the tools agent-chat offers, to save the tokens their
+// descriptions cost or to keep out of another MCP server's way:
+// -disable-tools drops built-in tools by name, -minimal-tools keeps only
+// send_message and check_messages, and -tool-prefix renames every tool
+// (built-in, -tools-file and upstream alike) as the client sees it, so
+// "send_message" becomes, say, "chat_send_message".
+
+// minimalTools are the tools -minimal-tools keeps.
+var minimalTools = []string{"send_message", "check_messages"}
+
+// toolPrefixRe is what a -tool-prefix may contain: characters tool names
+// may have, short enough to leave room for the names.
+var toolPrefixRe = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,32}$`)
+
+// parseToolList splits a comma-separated list of tool names.
+func parseToolList(raw string) []string {
+	var out []string
+	for _, part := range strings.Split(raw, ",") {
+		if s := strings.TrimSpace(part); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// trimTools removes the built-in tools in disable from server and, when
+// minimal is set, every one but minimalTools. A name server does not have
+// is an error, so a typo is not silently ignored. It returns the tools
+// left.
+func trimTools(server *mcp.Server, disable []string, minimal bool) ([]string, error) {
+	names, err := toolNames(server)
+	if err != nil {
+		return nil, err
+	}
+	drop := map[string]bool{}
+	for _, name := range disable {
+		if !slices.Contains(names, name) {
+			return nil, fmt.Errorf("no tool %q to disable", name)
+		}
+		drop[name] = true
+	}
+	if minimal {
+		for _, name := range names {
+			if !slices.Contains(minimalTools, name) {
+				drop[name] = true
+			}
+		}
+	}
+	var kept, dropped []string
+	for _, name := range names {
+		if drop[name] {
+			dropped = append(dropped, name)
+		} else {
+			kept = append(kept, name)
+		}
+	}
+	server.RemoveTools(dropped...)
+	return kept, nil
+}
+
+// prefixTools is middleware that shows the client every tool's name with
+// prefix in front, and takes it off again when a tool is called. A call
+// without the prefix is refused as an unknown tool.
+func prefixTools(prefix string) mcp.Middleware {
+	return func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			if call, ok := req.(*mcp.CallToolRequest); ok {
+				name, ok := strings.CutPrefix(call.Params.Name, prefix)
+				if !ok {
+					return nil, fmt.Errorf("unknown tool %q", call.Params.Name)
+				}
+				call.Params.Name = name
+			}
+			res, err := next(ctx, method, req)
+			if list, ok := res.(*mcp.ListToolsResult); ok && err == nil {
+				tools := make([]*mcp.Tool, len(list.Tools))
+				for i, t := range list.Tools {
+					c := *t // the server's own; never renamed in place
+					c.Name = prefix + t.Name
+					tools[i] = &c
+				}
+				list.Tools = tools
+			}
+			return res, err
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestTrimTools(t *testing.T) {
+	server := mcp.NewServer(&mcp.Implementation{Name: "agent-chat", Version: "test"}, nil)
+	registerTools(server, NewEventBus())
+	kept, err := trimTools(server, parseToolList(" draw, send_verbal_reply ,"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := toolNames(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slices.Contains(names, "draw") || slices.Contains(names, "send_verbal_reply") || !slices.Contains(names, "send_message") {
+		t.Errorf("tools after -disable-tools draw,send_verbal_reply: %v", names)
+	}
+	if !slices.Equal(kept, names) {
+		t.Errorf("trimTools kept %v, server has %v", kept, names)
+	}
+	if _, err := trimTools(server, []string{"drwa"}, false); err == nil || !strings.Contains(err.Error(), `"drwa"`) {
+		t.Errorf("disabling an unknown tool: %v", err)
+	}
+
+	kept, err = trimTools(server, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(kept, []string{"check_messages", "send_message"}) {
+		t.Errorf("-minimal-tools kept %v", kept)
+	}
+}
+
+func TestPrefixTools(t *testing.T) {
+	server := mcp.NewServer(&mcp.Implementation{Name: "agent-chat", Version: "test"}, nil)
+	registerTools(server, NewEventBus())
+	server.AddReceivingMiddleware(prefixTools("chat_"))
+
+	names, err := toolNames(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if !strings.HasPrefix(name, "chat_") {
+			t.Errorf("tool %q listed without the prefix", name)
+		}
+	}
+	if !slices.Contains(names, "chat_check_messages") {
+		t.Errorf("tools: %v", names)
+	}
+	if _, isErr := callServerTool(t, server, "chat_check_messages", map[string]any{}); isErr {
+		t.Error("chat_check_messages failed")
+	}
+
+	ctx := context.Background()
+	st, ct := mcp.NewInMemoryTransports()
+	ss, err := server.Connect(ctx, st, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+	cs, err := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "test"}, nil).Connect(ctx, ct, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cs.Close()
+	if _, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: "check_messages", Arguments: map[string]any{}}); err == nil {
+		t.Error("called a tool by its unprefixed name")
+	}
+	// The server's own tools keep their names for the next session.
+	if names, _ := toolNames(server); slices.Contains(names, "chat_chat_check_messages") {
+		t.Error("prefix applied twice: tools were renamed in place")
+	}
+}
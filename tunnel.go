@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// tunnelProvider is the -tunnel serve flag: expose the UI beyond this
+// machine through tailscale, ngrok or cloudflared, so prompts can be
+// answered from a phone off the LAN without port forwarding.
+var tunnelProvider string
+
+// tunnelStartTimeout bounds how long a provider may take to report its URL.
+const tunnelStartTimeout = 30 * time.Second
+
+// tunnelProviders maps each supported provider to the command that
+// publishes a local port and the pattern that finds the resulting URL in
+// the command's output. Every command runs in the foreground, so the
+// tunnel lives exactly as long as this process.
+var tunnelProviders = map[string]struct {
+	args  func(port int) []string
+	urlRe *regexp.Regexp
+}{
+	// Tailnet-only HTTPS at https://<machine>.<tailnet>.ts.net.
+	"tailscale": {
+		args:  func(port int) []string { return []string{"tailscale", "serve", strconv.Itoa(port)} },
+		urlRe: regexp.MustCompile(`https://[a-zA-Z0-9.-]+\.ts\.net[^\s]*`),
+	},
+	"ngrok": {
+		args: func(port int) []string {
+			return []string{"ngrok", "http", strconv.Itoa(port), "--log", "stdout", "--log-format", "logfmt"}
+		},
+		urlRe: regexp.MustCompile(`url=(https://[^\s"]+)`),
+	},
+	// A quick tunnel: no account, a random https://*.trycloudflare.com URL.
+	"cloudflared": {
+		args: func(port int) []string {
+			return []string{"cloudflared", "tunnel", "--no-autoupdate", "--url", "http://localhost:" + strconv.Itoa(port)}
+		},
+		urlRe: regexp.MustCompile(`https://[a-zA-Z0-9-]+\.trycloudflare\.com`),
+	},
+}
+
+// validTunnelProvider reports whether name is a provider -tunnel accepts.
+func validTunnelProvider(name string) bool {
+	_, ok := tunnelProviders[name]
+	return ok
+}
+
+// tunnelURL extracts the public URL from one line of provider output, or
+// returns "" when the line has none.
+func tunnelURL(provider, line string) string {
+	m := tunnelProviders[provider].urlRe.FindStringSubmatch(line)
+	switch {
+	case m == nil:
+		return ""
+	case len(m) > 1:
+		return trimURLSlash(m[1])
+	default:
+		return trimURLSlash(m[0])
+	}
+}
+
+func trimURLSlash(u string) string {
+	for len(u) > len("https://") && u[len(u)-1] == '/' {
+		u = u[:len(u)-1]
+	}
+	return u
+}
+
+// startTunnel runs provider's command for port and waits for it to print
+// its public URL. The command is killed when ctx is cancelled. Output
+// after the URL is drained and discarded so the provider never blocks on a
+// full pipe.
+func startTunnel(ctx context.Context, provider string, port int) (string, error) {
+	p, ok := tunnelProviders[provider]
+	if !ok {
+		return "", fmt.Errorf("unknown tunnel provider %q (want tailscale, ngrok or cloudflared)", provider)
+	}
+	argv := p.args(port)
+	if _, err := exec.LookPath(argv[0]); err != nil {
+		return "", fmt.Errorf("-tunnel %s: %s is not installed or not on PATH", provider, argv[0])
+	}
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	pr, pw := io.Pipe()
+	cmd.Stdout, cmd.Stderr = pw, pw
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("-tunnel %s: %w", provider, err)
+	}
+	exited := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		pw.Close()
+		exited <- err
+	}()
+
+	found := make(chan string, 1)
+	go func() {
+		scanner := bufio.NewScanner(pr)
+		reported := false
+		for scanner.Scan() {
+			if u := tunnelURL(provider, scanner.Text()); u != "" && !reported {
+				reported = true
+				found <- u
+			}
+		}
+		io.Copy(io.Discard, pr)
+	}()
+
+	select {
+	case u := <-found:
+		return u, nil
+	case err := <-exited:
+		return "", fmt.Errorf("-tunnel %s exited before reporting a URL: %v", provider, err)
+	case <-time.After(tunnelStartTimeout):
+		cmd.Process.Kill()
+		return "", fmt.Errorf("-tunnel %s did not report a URL within %s", provider, tunnelStartTimeout)
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
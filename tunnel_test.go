@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestTunnelURL(t *testing.T) {
+	cases := []struct{ provider, line, want string }{
+		{"cloudflared", "2026-10-16T10:00:00Z INF |  https://quiet-fox-lamp.trycloudflare.com                 |", "https://quiet-fox-lamp.trycloudflare.com"},
+		{"cloudflared", "2026-10-16T10:00:00Z INF Requesting new quick Tunnel on trycloudflare.com...", ""},
+		{"ngrok", `t=2026-10-16T10:00:00+0000 lvl=info msg="started tunnel" obj=tunnels name=command_line addr=http://localhost:4321 url=https://ab12-34.ngrok-free.app`, "https://ab12-34.ngrok-free.app"},
+		{"ngrok", `t=2026-10-16T10:00:00+0000 lvl=info msg="client session established" addr=http://localhost:4321`, ""},
+		{"tailscale", "https://laptop.tail1234.ts.net/", "https://laptop.tail1234.ts.net"},
+		{"tailscale", "|-- proxy http://127.0.0.1:4321", ""},
+	}
+	for _, c := range cases {
+		if got := tunnelURL(c.provider, c.line); got != c.want {
+			t.Errorf("tunnelURL(%s, %q) = %q, want %q", c.provider, c.line, got, c.want)
+		}
+	}
+}
+
+// fakeProvider puts an executable named name on PATH that runs script.
+func fakeProvider(t *testing.T, name, script string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script providers")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+}
+
+func TestStartTunnel(t *testing.T) {
+	fakeProvider(t, "cloudflared", `echo "starting on $5" >&2
+echo "INF |  https://quiet-fox-lamp.trycloudflare.com  |" >&2
+exec /bin/sleep 60
+`)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	got, err := startTunnel(ctx, "cloudflared", 4321)
+	if err != nil || got != "https://quiet-fox-lamp.trycloudflare.com" {
+		t.Errorf("startTunnel = %q, %v", got, err)
+	}
+}
+
+func TestStartTunnelFailures(t *testing.T) {
+	fakeProvider(t, "ngrok", "echo 'ERROR: authentication failed' >&2\nexit 1\n")
+	if _, err := startTunnel(context.Background(), "ngrok", 4321); err == nil || !strings.Contains(err.Error(), "exited before reporting a URL") {
+		t.Errorf("exiting provider: err = %v", err)
+	}
+	if _, err := startTunnel(context.Background(), "tailscale", 4321); err == nil || !strings.Contains(err.Error(), "not installed") {
+		t.Errorf("missing provider: err = %v", err)
+	}
+	if _, err := startTunnel(context.Background(), "frp", 4321); err == nil {
+		t.Error("unknown provider accepted")
+	}
+}
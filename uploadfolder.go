@@ -0,0 +1,190 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// A whole folder can be handed to the agent at once: dropped on the chat
+// (the browser uploads its files together, each with a "paths" field giving
+// its place in the folder) or, with -extract-zips, uploaded as a .zip that
+// is unpacked beside it. Either way the files land in one directory under
+// uploadDir and the message gets a manifest FileRef: a text file naming the
+// directory and listing every file in it, which the agent can read first.
+
+// extractZips is the -extract-zips serve flag.
+var extractZips bool
+
+// Limits on one folder or archive, against zip bombs and runaway drops.
+const (
+	maxFolderFiles = 5000
+	maxFolderBytes = 500 << 20
+)
+
+// folderEntry is one file of an unpacked folder, for its manifest.
+type folderEntry struct {
+	Path string // slash-separated, relative to the folder
+	Size int64
+}
+
+// folderPath turns an archive or drop path into a slash-separated path under
+// the folder: it is cleaned as if rooted there, so "../x" and "/x" both
+// become "x". Paths that name the folder itself are refused.
+func folderPath(name string) (string, error) {
+	name = strings.TrimLeft(path.Clean("/"+strings.ReplaceAll(name, `\`, "/")), "/")
+	if name == "" || name == "." || !filepath.IsLocal(filepath.FromSlash(name)) {
+		return "", fmt.Errorf("%q is not a path inside the folder", name)
+	}
+	return name, nil
+}
+
+// extractZip unpacks the archive at zipPath into dir, skipping symlinks and
+// stopping at maxFolderFiles or maxFolderBytes.
+func extractZip(zipPath, dir string) ([]folderEntry, error) {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var entries []folderEntry
+	var total int64
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || f.Mode()&fs.ModeSymlink != 0 {
+			continue
+		}
+		rel, err := folderPath(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == maxFolderFiles {
+			return nil, fmt.Errorf("more than %d files", maxFolderFiles)
+		}
+		n, err := extractZipFile(f, filepath.Join(dir, filepath.FromSlash(rel)), maxFolderBytes-total)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", rel, err)
+		}
+		total += n
+		entries = append(entries, folderEntry{Path: rel, Size: n})
+	}
+	return entries, nil
+}
+
+// extractZipFile writes one archive member to dest, failing once it passes
+// budget bytes (the header's size can lie).
+func extractZipFile(f *zip.File, dest string, budget int64) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return 0, err
+	}
+	src, err := f.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	dst, err := os.Create(dest)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(dst, io.LimitReader(src, budget+1))
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n > budget {
+		err = fmt.Errorf("unpacks to more than %s", formatSize(maxFolderBytes))
+	}
+	return n, err
+}
+
+// unpackZip extracts an uploaded archive beside itself and returns its
+// manifest. The directory is removed again if extraction fails.
+func unpackZip(zipRef FileRef) (FileRef, error) {
+	dir := strings.TrimSuffix(zipRef.Path, filepath.Ext(zipRef.Path))
+	entries, err := extractZip(zipRef.Path, dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return FileRef{}, fmt.Errorf("extract %s: %w", zipRef.Name, err)
+	}
+	return writeManifest(dir, zipRef.Name, entries)
+}
+
+// isZip reports whether an upload is a zip archive worth unpacking.
+func isZip(ref FileRef) bool {
+	return strings.EqualFold(filepath.Ext(ref.Name), ".zip")
+}
+
+// saveUploadedFolder stores a dropped folder's files, each at its paths[i]
+// (the first segment, the folder's own name, is dropped), in a new
+// directory, and returns the folder's manifest.
+func saveUploadedFolder(ctx context.Context, files []*multipart.FileHeader, paths []string) (FileRef, error) {
+	if len(files) > maxFolderFiles {
+		return FileRef{}, fmt.Errorf("more than %d files", maxFolderFiles)
+	}
+	name := "folder"
+	if first, _, ok := strings.Cut(strings.TrimLeft(strings.ReplaceAll(paths[0], `\`, "/"), "/"), "/"); ok && first != "" && first != ".." {
+		name = first
+	}
+	dir := filepath.Join(uploadDir, uuid.New().String()[:8]+"-"+filepath.Base(name))
+	var entries []folderEntry
+	for i, fh := range files {
+		rel, err := folderPath(paths[i])
+		if err != nil {
+			os.RemoveAll(dir)
+			return FileRef{}, err
+		}
+		if inner, ok := strings.CutPrefix(rel, name+"/"); ok {
+			rel = inner
+		}
+		dest := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			os.RemoveAll(dir)
+			return FileRef{}, err
+		}
+		if err := storeUpload(ctx, fh, paths[i], dest); err != nil {
+			os.RemoveAll(dir)
+			return FileRef{}, err
+		}
+		entries = append(entries, folderEntry{Path: rel, Size: fh.Size})
+	}
+	return writeManifest(dir, name+"/", entries)
+}
+
+// writeManifest writes dir's manifest beside it, as <dir>.manifest.txt, and
+// returns it as the FileRef that stands for the folder in a message.
+func writeManifest(dir, source string, entries []folderEntry) (FileRef, error) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Folder: %s\nFrom: %s\nFiles: %d (%s)\n\n", dir, source, len(entries), formatSize(total))
+	for _, e := range entries {
+		fmt.Fprintf(&b, "%8s  %s\n", formatSize(e.Size), e.Path)
+	}
+	manifest := dir + ".manifest.txt"
+	if err := os.WriteFile(manifest, []byte(b.String()), 0o644); err != nil {
+		return FileRef{}, err
+	}
+	rel, err := filepath.Rel(uploadDir, manifest)
+	if err != nil {
+		return FileRef{}, err
+	}
+	return FileRef{
+		Name: fmt.Sprintf("%s (%d files)", strings.TrimSuffix(source, "/")+"/", len(entries)),
+		Path: manifest,
+		URL:  "/uploads/" + filepath.ToSlash(rel),
+		Size: int64(b.Len()),
+		Type: "text/plain",
+	}, nil
+}
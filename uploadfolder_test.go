@@ -0,0 +1,139 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// makeZip returns a zip archive of files, name to content.
+func makeZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractZip(t *testing.T) {
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "proj.zip")
+	os.WriteFile(zipPath, makeZip(t, map[string]string{"proj/main.go": "package main", "proj/docs/README": "hi"}), 0o644)
+
+	entries, err := extractZip(zipPath, filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("entries = %v", entries)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "out", "proj", "docs", "README")); string(b) != "hi" {
+		t.Errorf("README = %q", b)
+	}
+
+	// An entry that climbs out of the folder is kept inside it.
+	evil := filepath.Join(dir, "evil.zip")
+	os.WriteFile(evil, makeZip(t, map[string]string{"../../escaped.txt": "x"}), 0o644)
+	if _, err := extractZip(evil, filepath.Join(dir, "evil")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escaped.txt")); err == nil {
+		t.Error("escaped.txt was written outside the folder")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "evil", "escaped.txt")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFolderPath(t *testing.T) {
+	for name, want := range map[string]string{
+		"a/b.txt":     "a/b.txt",
+		`a\b.txt`:     "a/b.txt",
+		"/etc/passwd": "etc/passwd",
+		"a/../b":      "b",
+		"":            "",
+		"..":          "",
+		"a/../..":     "",
+	} {
+		got, err := folderPath(name)
+		if got != want || (err != nil) != (want == "") {
+			t.Errorf("folderPath(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+}
+
+func TestUploadFolder(t *testing.T) {
+	origDir := uploadDir
+	uploadDir = t.TempDir()
+	t.Cleanup(func() { uploadDir = origDir })
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for path, content := range map[string]string{"proj/main.go": "package main", "proj/lib/util.go": "package lib"} {
+		part, _ := writer.CreateFormFile("files", filepath.Base(path))
+		part.Write([]byte(content))
+		writer.WriteField("paths", path)
+	}
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/upload", &buf)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rr := httptest.NewRecorder()
+	handleUpload(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rr.Code, rr.Body)
+	}
+
+	var refs []FileRef
+	json.Unmarshal(rr.Body.Bytes(), &refs)
+	if len(refs) != 1 || refs[0].Name != "proj/ (2 files)" || !strings.HasSuffix(refs[0].URL, "-proj.manifest.txt") {
+		t.Fatalf("refs = %+v", refs)
+	}
+	manifest, _ := os.ReadFile(refs[0].Path)
+	folder := strings.TrimSuffix(refs[0].Path, ".manifest.txt")
+	if !strings.Contains(string(manifest), "Folder: "+folder) || !strings.Contains(string(manifest), "lib/util.go") {
+		t.Errorf("manifest:\n%s", manifest)
+	}
+	if b, _ := os.ReadFile(filepath.Join(folder, "lib", "util.go")); string(b) != "package lib" {
+		t.Errorf("lib/util.go = %q", b)
+	}
+}
+
+func TestUploadZipExtract(t *testing.T) {
+	origDir, origExtract := uploadDir, extractZips
+	uploadDir = t.TempDir()
+	t.Cleanup(func() { uploadDir, extractZips = origDir, origExtract })
+	zipped := string(makeZip(t, map[string]string{"a.txt": "A", "b/c.txt": "C"}))
+
+	extractZips = false
+	if rr := postUpload(t, "sample.zip", zipped); !strings.Contains(rr.Body.String(), `"sample.zip"`) || strings.Contains(rr.Body.String(), "manifest") {
+		t.Errorf("extraction off: %s", rr.Body)
+	}
+
+	extractZips = true
+	rr := postUpload(t, "sample.zip", zipped)
+	var refs []FileRef
+	json.Unmarshal(rr.Body.Bytes(), &refs)
+	if len(refs) != 2 || refs[0].Name != "sample.zip" || refs[1].Name != "sample.zip/ (2 files)" {
+		t.Fatalf("refs = %+v", refs)
+	}
+	folder := strings.TrimSuffix(refs[1].Path, ".manifest.txt")
+	if b, _ := os.ReadFile(filepath.Join(folder, "b", "c.txt")); string(b) != "C" {
+		t.Errorf("b/c.txt = %q", b)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Uploads can be virus-scanned before anyone can fetch them, with -clamd
+// (a clamd socket: "unix:/path" or "host:port") and/or -scan-command (a
+// program given the file's path, exiting 0 when it is clean and 1 when it
+// is infected, as clamscan and clamdscan do). The file is written outside
+// uploadDir, scanned, and moved under /uploads only when clean. An infected
+// one is deleted, the uploader gets the reason, and every tab is sent an
+// "uploadRejected" notice. A scanner that fails rejects the upload too: a
+// shared chat should not let files through unscanned.
+
+var (
+	clamdAddr   string // -clamd
+	scanCommand string // -scan-command
+)
+
+const (
+	scanTimeout  = 2 * time.Minute
+	clamdChunk   = 32 << 10
+	maxScanReply = 4 << 10
+)
+
+// scanningUploads reports whether uploads are scanned.
+func scanningUploads() bool {
+	return clamdAddr != "" || scanCommand != ""
+}
+
+// uploadRejection is why an upload was refused.
+type uploadRejection struct {
+	Name      string `json:"name"`
+	Reason    string `json:"reason"`              // "infected" or "scan_failed"
+	Signature string `json:"signature,omitempty"` // what the scanner found, when infected
+	err       error  // the scanner's failure, when it failed
+}
+
+func (r *uploadRejection) Error() string {
+	if r.Reason == "infected" {
+		return fmt.Sprintf("%s is infected (%s)", r.Name, r.Signature)
+	}
+	return fmt.Sprintf("could not scan %s: %v", r.Name, r.err)
+}
+
+// scanUpload runs the configured scanners over path and returns the first
+// signature found, or "" when every scanner passed it.
+func scanUpload(ctx context.Context, path string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, scanTimeout)
+	defer cancel()
+	if clamdAddr != "" {
+		if sig, err := clamdScan(ctx, clamdAddr, path); sig != "" || err != nil {
+			return sig, err
+		}
+	}
+	if scanCommand != "" {
+		return commandScan(ctx, scanCommand, path)
+	}
+	return "", nil
+}
+
+// clamdScan streams path to clamd with INSTREAM and returns the signature
+// it reports, or "" for a clean file.
+func clamdScan(ctx context.Context, addr, path string) (string, error) {
+	network, address := "tcp", addr
+	if p, ok := strings.CutPrefix(addr, "unix:"); ok {
+		network, address = "unix", p
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return "", fmt.Errorf("clamd: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(conn)
+	w.WriteString("zINSTREAM\x00")
+	buf := make([]byte, clamdChunk)
+	var size [4]byte
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size[:], uint32(n))
+			w.Write(size[:])
+			w.Write(buf[:n])
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	w.Write([]byte{0, 0, 0, 0})
+	if err := w.Flush(); err != nil {
+		return "", fmt.Errorf("clamd: %w", err)
+	}
+
+	reply, err := bufio.NewReader(io.LimitReader(conn, maxScanReply)).ReadString(0)
+	if err != nil && reply == "" {
+		return "", fmt.Errorf("clamd: %w", err)
+	}
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	switch {
+	case strings.HasSuffix(reply, " OK"):
+		return "", nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return strings.TrimSuffix(strings.TrimPrefix(reply, "stream: "), " FOUND"), nil
+	default:
+		return "", fmt.Errorf("clamd: %s", reply)
+	}
+}
+
+// commandScan runs command with path appended. Exit status 1 means
+// infected, with the first line of its output as the signature.
+func commandScan(ctx context.Context, command, path string) (string, error) {
+	argv := append(strings.Fields(command), path)
+	out, err := exec.CommandContext(ctx, argv[0], argv[1:]...).CombinedOutput()
+	var exit *exec.ExitError
+	switch {
+	case err == nil:
+		return "", nil
+	case errors.As(err, &exit) && exit.ExitCode() == 1:
+		sig, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+		sig = strings.TrimSpace(strings.TrimPrefix(sig, path+":"))
+		if len(sig) > 200 {
+			sig = sig[:200]
+		}
+		if sig == "" {
+			sig = "infected"
+		}
+		return sig, nil
+	default:
+		return "", fmt.Errorf("%s: %w", argv[0], err)
+	}
+}
+
+// writeUploadError answers a failed upload: a scanner's rejection as JSON
+// (422 when infected, 503 when the scan failed), announced to every tab;
+// anything else as a plain 500.
+func writeUploadError(w http.ResponseWriter, err error) {
+	var rej *uploadRejection
+	if !errors.As(err, &rej) {
+		http.Error(w, "failed to save file: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("agent-chat: upload rejected: %v", rej)
+	bus.PublishTransient(map[string]any{"type": "uploadRejected", "name": rej.Name, "reason": rej.Reason, "signature": rej.Signature})
+	status := http.StatusUnprocessableEntity
+	if rej.Reason != "infected" {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"error": rej.Error(), "rejected": rej})
+}
+
+// moveFile moves a scanned upload into place, copying when src is on
+// another filesystem.
+func moveFile(src, dst string) error {
+	os.Chmod(src, 0o644) // CreateTemp makes it owner-only
+	if os.Rename(src, dst) == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeClamd answers INSTREAM scans like clamd, flagging any stream that
+// contains "EICAR".
+func fakeClamd(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				if cmd, err := r.ReadString(0); err != nil || cmd != "zINSTREAM\x00" {
+					return
+				}
+				var data bytes.Buffer
+				for {
+					var size uint32
+					if binary.Read(r, binary.BigEndian, &size) != nil {
+						return
+					}
+					if size == 0 {
+						break
+					}
+					io.CopyN(&data, r, int64(size))
+				}
+				if strings.Contains(data.String(), "EICAR") {
+					conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+				} else {
+					conn.Write([]byte("stream: OK\x00"))
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func postUpload(t *testing.T, name, content string) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	part, err := writer.CreateFormFile("files", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(content))
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/upload", &buf)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rr := httptest.NewRecorder()
+	handleUpload(rr, req)
+	return rr
+}
+
+func TestUploadScanning(t *testing.T) {
+	origDir, origClamd, origBus := uploadDir, clamdAddr, bus
+	uploadDir = t.TempDir()
+	clamdAddr = fakeClamd(t)
+	bus = NewEventBus()
+	t.Cleanup(func() { uploadDir, clamdAddr, bus = origDir, origClamd, origBus })
+	notices := make(chan any, 4)
+	bus.SubscribeTransient(notices)
+
+	if rr := postUpload(t, "notes.txt", "hello"); rr.Code != http.StatusOK {
+		t.Fatalf("clean file: %d %s", rr.Code, rr.Body)
+	}
+
+	// Not the real EICAR string: that would trip scanners reading the repo.
+	rr := postUpload(t, "eicar.com", "pretend EICAR test file")
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("infected file: %d %s", rr.Code, rr.Body)
+	}
+	var body struct {
+		Rejected uploadRejection `json:"rejected"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if body.Rejected.Reason != "infected" || body.Rejected.Signature != "Eicar-Test-Signature" || body.Rejected.Name != "eicar.com" {
+		t.Errorf("rejection = %s", rr.Body)
+	}
+	if n := (<-notices).(map[string]any); n["type"] != "uploadRejected" || n["name"] != "eicar.com" {
+		t.Errorf("notice = %v", n)
+	}
+	files, _ := filepath.Glob(filepath.Join(uploadDir, "*"))
+	if len(files) != 1 || !strings.HasSuffix(files[0], "-notes.txt") {
+		t.Errorf("uploadDir holds %v, want only the clean file", files)
+	}
+
+	// A scanner that is down refuses uploads rather than waving them through.
+	clamdAddr = "127.0.0.1:1"
+	if rr := postUpload(t, "notes.txt", "hello"); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("scanner down: %d %s", rr.Code, rr.Body)
+	}
+}
+
+func TestCommandScan(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script")
+	}
+	script := filepath.Join(t.TempDir(), "scan")
+	os.WriteFile(script, []byte("#!/bin/sh\nif grep -q EICAR \"$1\"; then echo \"$1: Eicar-Test-Signature FOUND\"; exit 1; fi\nexit 0\n"), 0o755)
+	dir := t.TempDir()
+	clean, infected := filepath.Join(dir, "clean"), filepath.Join(dir, "infected")
+	os.WriteFile(clean, []byte("hello"), 0o644)
+	os.WriteFile(infected, []byte("EICAR"), 0o644)
+
+	ctx := context.Background()
+	if sig, err := commandScan(ctx, script, clean); sig != "" || err != nil {
+		t.Errorf("clean: %q, %v", sig, err)
+	}
+	if sig, err := commandScan(ctx, script, infected); sig != "Eicar-Test-Signature FOUND" || err != nil {
+		t.Errorf("infected: %q, %v", sig, err)
+	}
+	if _, err := commandScan(ctx, "/nonexistent/scanner", clean); err == nil {
+		t.Error("want an error when the scanner cannot run")
+	}
+}
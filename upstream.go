@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Upstream MCP servers (the -tools-file "upstreams" section): agent-chat
+// connects to other MCP servers as a client and re-exposes their tools on
+// its own endpoint under a prefix, posting every call and its result to the
+// chat — a gateway the human can watch.
+//
+//	{"upstreams": [
+//	  {"name": "github", "command": ["github-mcp-server", "stdio"]},
+//	  {"name": "docs", "url": "http://127.0.0.1:9000/mcp"}
+//	]}
+
+const (
+	upstreamConnectTimeout = 30 * time.Second
+	upstreamMaxShown       = 2000 // runes of a call's result shown in the chat
+	upstreamMaxShownArgs   = 200  // runes of its arguments
+)
+
+// upstreamToolNameRe is what the MCP spec allows in a tool name.
+var upstreamToolNameRe = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,128}$`)
+
+// upstreamServer is one MCP server whose tools agent-chat proxies: a
+// command speaking MCP over stdio, or a streamable HTTP endpoint.
+type upstreamServer struct {
+	Name    string            `json:"name"`
+	Command []string          `json:"command,omitempty"` // argv of a stdio server; not run through a shell
+	Env     map[string]string `json:"env,omitempty"`     // added to the command's environment
+	URL     string            `json:"url,omitempty"`     // streamable HTTP endpoint
+	Headers map[string]string `json:"headers,omitempty"` // sent with every request to URL (e.g. Authorization)
+	Prefix  *string           `json:"prefix,omitempty"`  // tool name prefix (default: name + "_")
+	Quiet   bool              `json:"quiet,omitempty"`   // proxy without posting calls to the chat
+}
+
+// loadUpstreams reads and validates the upstreams of a -tools-file.
+func loadUpstreams(path string) ([]upstreamServer, error) {
+	cfg, err := readToolsFile(path)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for i := range cfg.Upstreams {
+		u := &cfg.Upstreams[i]
+		switch {
+		case !customToolNameRe.MatchString(u.Name):
+			return nil, fmt.Errorf("upstream %q: names are 1-64 letters, digits, _ or -", u.Name)
+		case seen[u.Name]:
+			return nil, fmt.Errorf("upstream %q: duplicate name", u.Name)
+		case (len(u.Command) == 0) == (u.URL == ""):
+			return nil, fmt.Errorf("upstream %q: set exactly one of command or url", u.Name)
+		case len(u.Command) > 0 && u.Command[0] == "":
+			return nil, fmt.Errorf("upstream %q: command is empty", u.Name)
+		case len(u.Headers) > 0 && u.URL == "":
+			return nil, fmt.Errorf("upstream %q: headers need a url", u.Name)
+		case len(u.Env) > 0 && u.URL != "":
+			return nil, fmt.Errorf("upstream %q: env needs a command", u.Name)
+		}
+		if u.URL != "" {
+			if parsed, err := url.Parse(u.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				return nil, fmt.Errorf("upstream %q: url must be an http(s) URL", u.Name)
+			}
+		}
+		if u.Prefix == nil {
+			prefix := u.Name + "_"
+			u.Prefix = &prefix
+		}
+		seen[u.Name] = true
+	}
+	return cfg.Upstreams, nil
+}
+
+// registerUpstreams connects to each upstream and adds its tools to server.
+// An upstream that cannot be reached, or a tool whose name is taken, is
+// logged and skipped: one broken server should not take the chat down.
+// Connections close when ctx ends.
+func registerUpstreams(ctx context.Context, server *mcp.Server, bus *EventBus, upstreams []upstreamServer, reserved []string, projectDir string) {
+	taken := map[string]bool{}
+	for _, name := range reserved {
+		taken[name] = true
+	}
+	for _, u := range upstreams {
+		cs, err := u.connect(ctx, projectDir)
+		if err != nil {
+			log.Printf("agent-chat: upstream %s: %v", u.Name, err)
+			continue
+		}
+		go func() {
+			<-ctx.Done()
+			cs.Close()
+		}()
+		n, err := u.proxyTools(ctx, server, bus, cs, taken)
+		if err != nil {
+			log.Printf("agent-chat: upstream %s: list tools: %v", u.Name, err)
+			continue
+		}
+		log.Printf("agent-chat: upstream %s: proxying %d tool(s)", u.Name, n)
+	}
+}
+
+// connect starts or dials the upstream and completes the MCP handshake.
+func (u upstreamServer) connect(ctx context.Context, projectDir string) (*mcp.ClientSession, error) {
+	var transport mcp.Transport
+	if u.URL != "" {
+		client := http.DefaultClient
+		if len(u.Headers) > 0 {
+			client = &http.Client{Transport: headerTransport{headers: u.Headers, base: http.DefaultTransport}}
+		}
+		transport = &mcp.StreamableClientTransport{Endpoint: u.URL, HTTPClient: client}
+	} else {
+		cmd := exec.Command(u.Command[0], u.Command[1:]...)
+		cmd.Dir = projectDir
+		cmd.Stderr = os.Stderr // its logs go where ours do; stdout is the protocol
+		cmd.Env = os.Environ()
+		for k, v := range u.Env {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+		transport = &mcp.CommandTransport{Command: cmd}
+	}
+	ctx, cancel := context.WithTimeout(ctx, upstreamConnectTimeout)
+	defer cancel()
+	client := mcp.NewClient(&mcp.Implementation{Name: "agent-chat", Version: version}, nil)
+	return client.Connect(ctx, transport, nil)
+}
+
+// proxyTools registers a forwarding tool on server for each tool cs
+// offers, skipping (and recording in taken) names already in use. Returns
+// how many were registered.
+func (u upstreamServer) proxyTools(ctx context.Context, server *mcp.Server, bus *EventBus, cs *mcp.ClientSession, taken map[string]bool) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, upstreamConnectTimeout)
+	defer cancel()
+	var tools []*mcp.Tool
+	for tool, err := range cs.Tools(ctx, nil) {
+		if err != nil {
+			return 0, err
+		}
+		tools = append(tools, tool)
+	}
+	n := 0
+	for _, tool := range tools {
+		name := *u.Prefix + tool.Name
+		if !upstreamToolNameRe.MatchString(name) || taken[name] {
+			log.Printf("agent-chat: upstream %s: skipping tool %q: name invalid or already in use", u.Name, name)
+			continue
+		}
+		taken[name] = true
+		n++
+		schema := tool.InputSchema
+		if m, ok := schema.(map[string]any); !ok || m["type"] != "object" {
+			schema = json.RawMessage(`{"type":"object"}`)
+		}
+		proxy := &mcp.Tool{
+			Name:        name,
+			Title:       tool.Title,
+			Description: tool.Description,
+			InputSchema: schema,
+			Annotations: tool.Annotations,
+		}
+		remote := tool.Name
+		server.AddTool(proxy, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			bus := bus.ClientSession(mcpClientKey(req))
+			bus.CancelActiveWait()
+			bus.AckLimbo()
+			var args any
+			if len(req.Params.Arguments) > 0 {
+				args = req.Params.Arguments
+			}
+			started := time.Now()
+			res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: remote, Arguments: args})
+			if err != nil {
+				res = &mcp.CallToolResult{
+					Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("error: upstream %s: %v", u.Name, err)}},
+					IsError: true,
+				}
+			}
+			if !u.Quiet {
+				meta := &ToolMeta{Tool: name, DurationMs: time.Since(started).Milliseconds()}
+				bus.Publish(Event{Type: "agentMessage", AgentToolName: name, Text: upstreamCallText(name, req.Params.Arguments, res), Meta: meta})
+			}
+			return res, nil
+		})
+	}
+	return n, nil
+}
+
+// upstreamCallText is the chat bubble for a proxied call: the tool, an
+// excerpt of its arguments, and an excerpt of its result.
+func upstreamCallText(name string, args json.RawMessage, res *mcp.CallToolResult) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "🔌 `%s`", name)
+	if a := strings.TrimSpace(string(args)); a != "" && a != "{}" && a != "null" {
+		fmt.Fprintf(&b, " `%s`", strings.ReplaceAll(clipText(a, upstreamMaxShownArgs), "`", "'"))
+	}
+	if res.IsError {
+		b.WriteString(" failed")
+	}
+	var parts []string
+	for _, c := range res.Content {
+		switch c := c.(type) {
+		case *mcp.TextContent:
+			parts = append(parts, c.Text)
+		case *mcp.ImageContent:
+			parts = append(parts, "[image "+c.MIMEType+"]")
+		case *mcp.AudioContent:
+			parts = append(parts, "[audio "+c.MIMEType+"]")
+		case *mcp.ResourceLink:
+			parts = append(parts, "[resource "+c.URI+"]")
+		case *mcp.EmbeddedResource:
+			if c.Resource != nil {
+				parts = append(parts, "[resource "+c.Resource.URI+"]")
+			}
+		}
+	}
+	if out := strings.TrimSpace(strings.Join(parts, "\n")); out != "" {
+		b.WriteString("\n```\n" + strings.ReplaceAll(clipText(out, upstreamMaxShown), "```", "` ` `") + "\n```")
+	}
+	return b.String()
+}
+
+// clipText cuts s to at most max runes, marking the cut.
+func clipText(s string, max int) string {
+	if r := []rune(s); len(r) > max {
+		return string(r[:max]) + "…"
+	}
+	return s
+}
+
+// headerTransport adds fixed headers to every request.
+type headerTransport struct {
+	headers map[string]string
+	base    http.RoundTripper
+}
+
+func (t headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestLoadUpstreams(t *testing.T) {
+	ups, err := loadUpstreams(writeToolsFile(t, `{"upstreams": [
+		{"name": "github", "command": ["github-mcp-server", "stdio"]},
+		{"name": "docs", "url": "http://127.0.0.1:9000/mcp", "prefix": ""}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *ups[0].Prefix != "github_" || *ups[1].Prefix != "" {
+		t.Errorf("prefixes = %q, %q", *ups[0].Prefix, *ups[1].Prefix)
+	}
+
+	bad := map[string]string{
+		"both":        `{"upstreams": [{"name": "a", "command": ["x"], "url": "http://h/mcp"}]}`,
+		"neither":     `{"upstreams": [{"name": "a"}]}`,
+		"duplicate":   `{"upstreams": [{"name": "a", "command": ["x"]}, {"name": "a", "command": ["y"]}]}`,
+		"bad name":    `{"upstreams": [{"name": "a b", "command": ["x"]}]}`,
+		"bad url":     `{"upstreams": [{"name": "a", "url": "ftp://h/mcp"}]}`,
+		"env on url":  `{"upstreams": [{"name": "a", "url": "http://h/mcp", "env": {"K": "v"}}]}`,
+		"headers cmd": `{"upstreams": [{"name": "a", "command": ["x"], "headers": {"K": "v"}}]}`,
+	}
+	for what, body := range bad {
+		if _, err := loadUpstreams(writeToolsFile(t, body)); err == nil {
+			t.Errorf("%s: accepted", what)
+		}
+	}
+}
+
+type searchArgs struct {
+	Query string `json:"query"`
+}
+
+// newTestUpstream serves an MCP server with a "search" tool and a tool
+// named like a built-in over streamable HTTP, recording the Authorization
+// header it was called with.
+func newTestUpstream(t *testing.T, auth *atomic.Value) string {
+	t.Helper()
+	up := mcp.NewServer(&mcp.Implementation{Name: "upstream", Version: "test"}, nil)
+	mcp.AddTool(up, &mcp.Tool{Name: "search", Description: "Search the docs."}, func(ctx context.Context, req *mcp.CallToolRequest, args searchArgs) (*mcp.CallToolResult, any, error) {
+		if args.Query == "" {
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "query is required"}}, IsError: true}, nil, nil
+		}
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "3 hits for " + args.Query}}}, nil, nil
+	})
+	mcp.AddTool(up, &mcp.Tool{Name: "send_message"}, func(ctx context.Context, req *mcp.CallToolRequest, args struct{}) (*mcp.CallToolResult, any, error) {
+		return nil, nil, nil
+	})
+	handler := mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return up }, nil)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth.Store(r.Header.Get("Authorization"))
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestUpstreamProxy(t *testing.T) {
+	var auth, clashAuth atomic.Value
+	ups, err := loadUpstreams(writeToolsFile(t, `{"upstreams": [
+		{"name": "docs", "url": "`+newTestUpstream(t, &auth)+`", "headers": {"Authorization": "Bearer s3cret"}},
+		{"name": "clash", "url": "`+newTestUpstream(t, &clashAuth)+`", "prefix": ""}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	eb := NewEventBus()
+	server := mcp.NewServer(&mcp.Implementation{Name: "agent-chat", Version: "test"}, nil)
+	registerUpstreams(ctx, server, eb, ups, []string{"send_message"}, t.TempDir())
+	if auth.Load() != "Bearer s3cret" || clashAuth.Load() != "" {
+		t.Errorf("Authorization = %q, %q", auth.Load(), clashAuth.Load())
+	}
+
+	names, err := toolNames(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(names, ","); got != "docs_search,docs_send_message,search" {
+		t.Errorf("proxied tools = %s", got)
+	}
+
+	st, ct := mcp.NewInMemoryTransports()
+	ss, err := server.Connect(ctx, st, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+	cs, err := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "test"}, nil).Connect(ctx, ct, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cs.Close()
+
+	res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: "docs_search", Arguments: map[string]any{"query": "flaky"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.IsError || res.Content[0].(*mcp.TextContent).Text != "3 hits for flaky" {
+		t.Errorf("docs_search = %+v", res.Content[0])
+	}
+	history, _ := eb.History()
+	if len(history) != 1 || history[0].AgentToolName != "docs_search" ||
+		history[0].Text != "🔌 `docs_search` `{\"query\":\"flaky\"}`\n```\n3 hits for flaky\n```" {
+		t.Fatalf("published = %+v", history)
+	}
+
+	res, err = cs.CallTool(ctx, &mcp.CallToolParams{Name: "docs_search", Arguments: map[string]any{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.IsError {
+		t.Errorf("upstream error not passed through: %+v", res)
+	}
+	if history, _ := eb.History(); len(history) != 2 || !strings.HasPrefix(history[1].Text, "🔌 `docs_search` failed") {
+		t.Errorf("published = %+v", history[1:])
+	}
+}
+
+func TestRegisterUpstreamsSkipsUnreachable(t *testing.T) {
+	ups, err := loadUpstreams(writeToolsFile(t, `{"upstreams": [{"name": "gone", "command": ["/nonexistent/mcp-server"]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := mcp.NewServer(&mcp.Implementation{Name: "agent-chat", Version: "test"}, nil)
+	registerUpstreams(context.Background(), server, NewEventBus(), ups, nil, t.TempDir())
+	if names, _ := toolNames(server); len(names) != 0 {
+		t.Errorf("tools = %v", names)
+	}
+}
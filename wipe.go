@@ -0,0 +1,238 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Wiping erases a session for good, for a user who asks for their data to
+// be deleted: its event log (and the drawings kept beside it), the uploads
+// and pastes its messages reference, and its streaming chat-log export.
+// Files are overwritten with zeros before they are removed. A running chat
+// does it with the wipe_session tool, allowed only with -allow-wipe: it
+// also forgets the history, read receipts and chat title it holds in
+// memory and the name in the instance registry, and sends connected tabs a
+// final sessionWiped, on which they drop what they show and start over.
+// `agent-chat wipe` does the same to a log no server is using.
+
+// allowWipe is the -allow-wipe serve flag.
+var allowWipe bool
+
+// uploadsToWipe lists the uploads events reference that live in root (or,
+// with no root, in an agent-chat-uploads-* temp dir), sorted and without
+// repeats. Only those are the session's own: other paths may be shared.
+func uploadsToWipe(events []Event, root string) []string {
+	seen := map[string]bool{}
+	var paths []string
+	for _, e := range events {
+		for _, f := range e.Files {
+			p := filepath.Clean(f.Path)
+			if f.Path == "" || seen[p] || !inUploadDir(p, root) {
+				continue
+			}
+			if _, err := os.Lstat(p); err != nil {
+				continue
+			}
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// inUploadDir reports whether path is inside root, or with no root inside
+// a temp upload dir serve made.
+func inUploadDir(path, root string) bool {
+	if root != "" {
+		rel, err := filepath.Rel(root, path)
+		return err == nil && rel != "." && !strings.HasPrefix(rel, "..")
+	}
+	for dir := filepath.Dir(path); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if strings.HasPrefix(filepath.Base(dir), "agent-chat-uploads-") {
+			return true
+		}
+	}
+	return false
+}
+
+// shredPath overwrites path with zeros and removes it; a directory has each
+// of its files shredded first. Zeroing is best effort: on copy-on-write and
+// flash storage the old blocks may survive until reused.
+func shredPath(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err == nil && d.Type().IsRegular() {
+				zeroFile(p)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return os.RemoveAll(path)
+	}
+	if info.Mode().IsRegular() {
+		zeroFile(path)
+	}
+	return os.Remove(path)
+}
+
+// zeroFile overwrites path's contents with zeros in place.
+func zeroFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	zeros := make([]byte, 64*1024)
+	for left := info.Size(); left > 0; {
+		n := int64(len(zeros))
+		if left < n {
+			n = left
+		}
+		if _, err := f.Write(zeros[:n]); err != nil {
+			return err
+		}
+		left -= n
+	}
+	return f.Sync()
+}
+
+// shredAll shreds each path, returning how many went and the first error.
+func shredAll(paths []string) (int, error) {
+	n := 0
+	var first error
+	for _, p := range paths {
+		if err := shredPath(p); err != nil {
+			if first == nil && !os.IsNotExist(err) {
+				first = err
+			}
+			continue
+		}
+		n++
+	}
+	return n, first
+}
+
+// Wipe forgets the session's history, read receipts and display names,
+// empties every agent session's queue and redelivery limbo (so nothing said
+// before the wipe reaches an agent after it) along with its pending quick
+// replies and identity, shreds its event log (starting an empty one in its
+// place) and the drawings kept beside it, and returns the events it held so
+// their uploads can go too.
+func (eb *EventBus) Wipe() ([]Event, error) {
+	sessions := eb.allSessions()
+	eb.mu.Lock()
+	events := eb.eventLog
+	eb.eventLog = nil
+	eb.index = newSearchIndex()
+	for _, s := range sessions {
+	drain:
+		for {
+			select {
+			case <-s.msgQueue:
+			default:
+				break drain
+			}
+		}
+		s.limboMu.Lock()
+		s.limbo = nil
+		s.limboMu.Unlock()
+		s.lastQuickReplies, s.promptSeq, s.identity, s.lastVoice = nil, 0, nil, false
+	}
+	eb.mu.Unlock()
+	eb.receiptMu.Lock()
+	eb.receipts = make(map[string]*viewerReceipt)
+	eb.receiptMu.Unlock()
+	eb.namesMu.Lock()
+	eb.names = make(map[string]string)
+	eb.namesMu.Unlock()
+	eb.scenes.reset()
+
+	if eb.blobs != nil && eb.blobs.dir != "" {
+		if err := shredPath(eb.blobs.dir); err != nil && !os.IsNotExist(err) {
+			return events, err
+		}
+	}
+	eb.logMu.Lock()
+	defer eb.logMu.Unlock()
+	if eb.logFile == nil {
+		return events, nil
+	}
+	path := eb.logFile.Name()
+	eb.logFile.Close()
+	eb.logFile = nil
+	eb.chainHead = ""
+	if err := shredPath(path); err != nil && !os.IsNotExist(err) {
+		return events, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return events, err
+	}
+	eb.logFile = f
+	return events, nil
+}
+
+// runWipe implements `agent-chat wipe`: shred an event log, the drawings
+// beside it and the uploads it references. Run it while no server is using
+// the log.
+func runWipe(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("wipe", flag.ContinueOnError)
+	upload := fs.String("upload-dir", "", "the session's -upload-dir; uploads referenced from elsewhere are left alone (default: serve's agent-chat-uploads-* temp dirs)")
+	dryRun := fs.Bool("dry-run", false, "list what would be removed without removing it")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: agent-chat wipe [flags] <events.jsonl>\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	path := fs.Arg(0)
+	if _, err := os.Stat(path); err != nil {
+		fmt.Fprintf(os.Stderr, "agent-chat wipe: %v\n", err)
+		return 1
+	}
+	root := *upload
+	if root != "" {
+		root, _ = filepath.Abs(root)
+	}
+	events, _, _ := loadEventLog(path)
+	targets := uploadsToWipe(events, root)
+	if _, err := os.Stat(path + ".draw"); err == nil {
+		targets = append(targets, path+".draw")
+	}
+	targets = append(targets, path) // last, so a failure above can be retried
+	if *dryRun {
+		for _, p := range targets {
+			fmt.Fprintln(out, p)
+		}
+		return 0
+	}
+	n, err := shredAll(targets)
+	fmt.Fprintf(out, "Wiped %d of %d files and folders\n", n, len(targets))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "agent-chat wipe: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInUploadDir(t *testing.T) {
+	tmp := filepath.Join(os.TempDir(), "agent-chat-uploads-123")
+	cases := []struct {
+		path, root string
+		want       bool
+	}{
+		{"/srv/uploads/a.png", "/srv/uploads", true},
+		{"/srv/uploads", "/srv/uploads", false},
+		{"/srv/other/a.png", "/srv/uploads", false},
+		{"/srv/uploads/../secrets", "/srv/uploads", false},
+		{filepath.Join(tmp, "folder", "a.png"), "", true},
+		{"/home/me/screenshot.png", "", false},
+	}
+	for _, c := range cases {
+		if got := inUploadDir(filepath.Clean(c.path), c.root); got != c.want {
+			t.Errorf("inUploadDir(%q, %q) = %v, want %v", c.path, c.root, got, c.want)
+		}
+	}
+}
+
+func TestWipeSessionTool(t *testing.T) {
+	dir := t.TempDir()
+	savedUpload, savedAllow := uploadDir, allowWipe
+	t.Cleanup(func() { uploadDir, allowWipe = savedUpload, savedAllow })
+	uploadDir = filepath.Join(dir, "uploads")
+	os.MkdirAll(uploadDir, 0o755)
+	upload := filepath.Join(uploadDir, "photo.png")
+	os.WriteFile(upload, []byte("secret pixels"), 0o644)
+	outside := filepath.Join(dir, "shared.png")
+	os.WriteFile(outside, []byte("not the session's"), 0o644)
+
+	logPath := filepath.Join(dir, "events.jsonl")
+	eb, err := NewEventBusWithLog(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eb.Close()
+	eb.Publish(Event{Type: "userMessage", Text: "my address is 1 Main St", Files: []FileRef{{Name: "photo.png", Path: upload}}})
+	eb.Publish(Event{Type: "agentMessage", Text: "noted", Files: []FileRef{{Name: "shared.png", Path: outside}}})
+
+	if got, isErr := callTool(t, eb, "wipe_session", map[string]any{"confirm": "wipe"}); !isErr || !strings.Contains(got, "-allow-wipe") {
+		t.Fatalf("without -allow-wipe: %q (error %v)", got, isErr)
+	}
+	allowWipe = true
+	if _, isErr := callTool(t, eb, "wipe_session", map[string]any{"confirm": "yes"}); !isErr {
+		t.Fatal("wiped without confirm: 'wipe'")
+	}
+
+	sink := make(chan any, 8)
+	eb.SubscribeTransient(sink)
+	defer eb.UnsubscribeTransient(sink)
+	got, isErr := callTool(t, eb, "wipe_session", map[string]any{"confirm": "wipe"})
+	if isErr || !strings.Contains(got, "2 events and 1 uploads") {
+		t.Fatalf("wipe_session = %q (error %v)", got, isErr)
+	}
+	if eb.HasHistory() {
+		t.Error("history survived the wipe")
+	}
+	if _, err := os.Stat(upload); !os.IsNotExist(err) {
+		t.Errorf("upload survived: %v", err)
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("file outside the upload dir was removed: %v", err)
+	}
+	if data, _ := os.ReadFile(logPath); len(data) != 0 {
+		t.Errorf("event log not emptied: %q", data)
+	}
+	wiped := false
+	for len(sink) > 0 {
+		if m, ok := (<-sink).(map[string]any); ok && m["type"] == "sessionWiped" {
+			wiped = true
+		}
+	}
+	if !wiped {
+		t.Error("no sessionWiped sent to the tabs")
+	}
+
+	eb.Publish(Event{Type: "agentMessage", Text: "fresh start"})
+	if events, _, _ := loadEventLog(logPath); len(events) != 1 || events[0].Text != "fresh start" {
+		t.Errorf("log after the wipe: %+v", events)
+	}
+}
+
+// Nothing said before a wipe reaches an agent after it: not from a queue,
+// not from limbo, not from another agent's session.
+func TestWipeEmptiesQueues(t *testing.T) {
+	saved := allowWipe
+	t.Cleanup(func() { allowWipe = saved })
+	allowWipe = true
+	eb := NewEventBus()
+	other := eb.Session("client-b")
+	eb.Publish(Event{Type: "agentMessage", Text: "Which card?", QuickReplies: []string{"Visa"}})
+	eb.ReceiveUserMessage("card 4111 1111 1111 1111", nil)
+	other.ReceiveUserMessage("pin 1234", nil)
+	eb.SetLimbo([]UserMessage{{ID: "x", Text: "cvv 999"}})
+	other.SetLimbo([]UserMessage{{ID: "y", Text: "cvv 999"}})
+	eb.SetIdentity(&AgentIdentity{Name: "Billing bot"})
+
+	if _, isErr := callTool(t, eb, "wipe_session", map[string]any{"confirm": "wipe"}); isErr {
+		t.Fatal("wipe_session failed")
+	}
+	for _, s := range []*EventBus{eb, other} {
+		if s.HasQueuedMessages() || s.Limbo() != nil {
+			t.Errorf("session %q kept its queue %v or limbo %v", s.key, s.HasQueuedMessages(), s.Limbo())
+		}
+	}
+	if eb.LastQuickReplies() != nil || eb.Identity() != nil {
+		t.Errorf("quick replies %v or identity %+v survived", eb.LastQuickReplies(), eb.Identity())
+	}
+	got, _ := callTool(t, eb, "check_messages", map[string]any{})
+	if strings.Contains(got, "4111") || strings.Contains(got, "cvv") || !strings.Contains(got, `"queue":"empty"`) {
+		t.Errorf("check_messages after the wipe = %q", got)
+	}
+}
+
+func TestRunWipe(t *testing.T) {
+	dir := t.TempDir()
+	uploads := filepath.Join(dir, "uploads")
+	os.MkdirAll(filepath.Join(uploads, "folder"), 0o755)
+	file := filepath.Join(uploads, "a.txt")
+	folder := filepath.Join(uploads, "folder")
+	os.WriteFile(file, []byte("a"), 0o644)
+	os.WriteFile(filepath.Join(folder, "b.txt"), []byte("b"), 0o644)
+	logPath := filepath.Join(dir, "events.jsonl")
+	eb, err := NewEventBusWithLog(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eb.Publish(Event{Type: "userMessage", Text: "files", Files: []FileRef{{Path: file}, {Path: folder}, {Path: file}}})
+	eb.Close()
+	os.MkdirAll(logPath+".draw", 0o755)
+
+	var out bytes.Buffer
+	if code := runWipe([]string{"-dry-run", "-upload-dir", uploads, logPath}, &out); code != 0 {
+		t.Fatalf("dry run: exit %d", code)
+	}
+	want := strings.Join([]string{file, folder, logPath + ".draw", logPath}, "\n") + "\n"
+	if out.String() != want {
+		t.Errorf("dry run listed:\n%s\nwant:\n%s", out.String(), want)
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Fatal("dry run removed a file")
+	}
+	out.Reset()
+	if code := runWipe([]string{"-upload-dir", uploads, logPath}, &out); code != 0 || !strings.Contains(out.String(), "Wiped 4 of 4") {
+		t.Fatalf("wipe: exit %d: %s", code, out.String())
+	}
+	for _, p := range []string{file, folder, logPath, logPath + ".draw"} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s survived: %v", p, err)
+		}
+	}
+}
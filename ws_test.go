@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/choonkeat/agent-chat/pkg/client"
+	"github.com/gorilla/websocket"
+)
+
+// startWSServer serves /ws on a fresh primary bus.
+func startWSServer(t *testing.T) string {
+	t.Helper()
+	origBus := bus
+	bus = NewEventBus()
+	srv := httptest.NewServer(http.HandlerFunc(handleWebSocket))
+	t.Cleanup(func() {
+		srv.Close()
+		// Hijacked connections outlive Close: let their handlers unsubscribe
+		// from this bus before putting the old one back.
+		for deadline := time.Now().Add(2 * time.Second); bus.ViewerCount() > 0 && time.Now().Before(deadline); {
+			time.Sleep(5 * time.Millisecond)
+		}
+		bus = origBus
+	})
+	return srv.URL
+}
+
+func waitType(t *testing.T, ctx context.Context, c *client.Client, typ string) client.Frame {
+	t.Helper()
+	f, err := c.WaitFor(ctx, func(f client.Frame) bool { return f.Type == typ })
+	if err != nil {
+		t.Fatalf("waiting for %s: %v", typ, err)
+	}
+	return f
+}
+
+func TestWebSocketClientRoundTrip(t *testing.T) {
+	base := startWSServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	bus.Publish(Event{Type: "agentMessage", Text: "What should I work on?"})
+
+	c, err := client.Dial(ctx, base, client.Options{ClientID: "tester", Name: "Ana"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.Connected().Version == "" {
+		t.Error("handshake has no version")
+	}
+	if f := waitType(t, ctx, c, "agentMessage"); f.Text != "What should I work on?" || !f.Logged() {
+		t.Errorf("replayed frame = %+v", f)
+	}
+	waitType(t, ctx, c, "historyEnd")
+
+	// A message from the fake user reaches the agent's queue, with its name.
+	if err := c.SendMessage(client.Message{Text: "fix the flaky test", ReplyTo: 1}); err != nil {
+		t.Fatal(err)
+	}
+	waitType(t, ctx, c, "messageQueued")
+	msgs := bus.DrainMessages()
+	if len(msgs) != 1 || msgs[0].Text != "fix the flaky test" || msgs[0].ReplyTo != 1 || msgs[0].From != "Ana" {
+		t.Fatalf("queued = %+v", msgs)
+	}
+
+	// Acks resolve the agent's pending wait.
+	ack := bus.CreateAck()
+	bus.Publish(Event{Type: "agentMessage", Text: "Deploy?", AckID: ack.ID})
+	if f := waitType(t, ctx, c, "agentMessage"); f.AckID != ack.ID {
+		t.Fatalf("ack frame = %+v", f)
+	}
+	if err := c.Ack(ack.ID, "yes"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-ack.Ch:
+		if got != "ack:yes" {
+			t.Errorf("ack result = %q", got)
+		}
+	case <-ctx.Done():
+		t.Fatal("ack never resolved")
+	}
+}
+
+func TestWebSocketClientResume(t *testing.T) {
+	base := startWSServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	bus.Publish(Event{Type: "agentMessage", Text: "one"})
+
+	first, err := client.Dial(ctx, base, client.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitType(t, ctx, first, "historyEnd")
+	cursor := first.Cursor()
+	first.Close()
+	if cursor != 1 {
+		t.Fatalf("cursor = %d, want 1", cursor)
+	}
+
+	bus.Publish(Event{Type: "agentMessage", Text: "two"})
+	second, err := client.Dial(ctx, base, client.Options{Cursor: cursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	var replayed []string
+	for {
+		f, err := second.Next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Type == "historyEnd" {
+			break
+		}
+		if f.Logged() {
+			replayed = append(replayed, f.Text)
+		}
+	}
+	if len(replayed) != 1 || replayed[0] != "two" {
+		t.Errorf("resumed replay = %v, want only [two]", replayed)
+	}
+}
+
+func TestWebSocketClientMsgpack(t *testing.T) {
+	base := startWSServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	bus.Publish(Event{Type: "draw", Instructions: bigDrawing(3)})
+
+	c, err := client.Dial(ctx, base, client.Options{Msgpack: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.Subprotocol() != client.ProtocolMsgpack || c.Connected().Version == "" {
+		t.Errorf("negotiated %q, handshake %+v", c.Subprotocol(), c.Connected())
+	}
+	if f := waitType(t, ctx, c, "draw"); len(f.Instructions) != 3 || f.Seq != 1 {
+		t.Errorf("draw frame = %+v", f)
+	}
+}
+
+func TestWebSocketHistoryPaging(t *testing.T) {
+	base := startWSServer(t)
+	orig := historyPage
+	historyPage = 3
+	t.Cleanup(func() { historyPage = orig })
+	for i := 0; i < 7; i++ {
+		bus.Publish(Event{Type: "agentMessage", Text: "update"})
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(base, "http")+"/ws?paged=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var frame struct {
+		Type   string  `json:"type"`
+		Seq    int64   `json:"seq"`
+		Before int64   `json:"before"`
+		Events []Event `json:"events"`
+		More   bool    `json:"more"`
+	}
+	next := func() {
+		t.Helper()
+		frame.Events = nil
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []string
+	for next(); frame.Type != "historyEnd"; next() {
+		if frame.Type == "historyTruncated" {
+			got = append(got, fmt.Sprintf("before %d", frame.Before))
+		} else if frame.Seq > 0 {
+			got = append(got, fmt.Sprint(frame.Seq))
+		}
+	}
+	if strings.Join(got, ",") != "before 5,5,6,7" {
+		t.Errorf("fresh connect got %v", got)
+	}
+
+	for _, want := range []struct {
+		before   int64
+		first, n int64
+		more     bool
+	}{{5, 2, 3, true}, {2, 1, 1, false}} {
+		conn.WriteJSON(map[string]any{"type": "history", "before": want.before})
+		for next(); frame.Type != "historyPage"; next() {
+		}
+		if int64(len(frame.Events)) != want.n || frame.Events[0].Seq != want.first || frame.More != want.more {
+			t.Errorf("page before %d = %d events from %d, more %v", want.before, len(frame.Events), frame.Events[0].Seq, frame.More)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket subprotocols a client may offer in its handshake. The browser
+// UI offers MessagePack first: binary frames are markedly smaller for
+// draw-heavy chats on mobile connections. A client that offers neither
+// (curl, older tabs, pkg/client without Options.Msgpack) gets JSON text
+// frames, as before.
+const (
+	wsProtoMsgpack = "agent-chat.msgpack"
+	wsProtoJSON    = "agent-chat.json"
+)
+
+// wsMsgpack is the -ws-msgpack serve flag: accept the MessagePack
+// subprotocol. Off, every client is answered in JSON.
+var wsMsgpack = true
+
+// wsDeflate is the -ws-deflate serve flag: the permessage-deflate level
+// (1 fastest – 9 smallest) for clients that negotiate compression, as
+// browsers do; 0 disables it. Replayed history and drawings are repetitive
+// JSON and shrink several-fold even at level 1.
+var wsDeflate = 1
+
+// wsDeflateMin is the smallest frame worth compressing; below it the deflate
+// overhead outweighs the saving.
+const wsDeflateMin = 256
+
+// wsSubprotocols is what the upgrader accepts, in the server's preference
+// order; gorilla picks the first one the client offered.
+func wsSubprotocols() []string {
+	if wsMsgpack {
+		return []string{wsProtoMsgpack, wsProtoJSON}
+	}
+	return []string{wsProtoJSON}
+}
+
+// wsCodec frames server messages for one connection. Messages from the
+// client are always JSON text.
+type wsCodec struct {
+	msgpack bool
+	deflate bool // compress big frames; gorilla only does when the client negotiated permessage-deflate
+}
+
+// wsUpgrader is upgrader with the subprotocols and compression the serve
+// flags allow.
+func wsUpgrader() websocket.Upgrader {
+	up := upgrader
+	up.Subprotocols = wsSubprotocols()
+	up.EnableCompression = wsDeflate > 0
+	return up
+}
+
+// codecFor returns conn's codec, setting its compression level.
+func codecFor(conn *websocket.Conn) wsCodec {
+	c := wsCodec{msgpack: conn.Subprotocol() == wsProtoMsgpack}
+	if wsDeflate > 0 && conn.SetCompressionLevel(wsDeflate) == nil {
+		c.deflate = true
+	}
+	return c
+}
+
+// encode returns v as a frame: JSON text, or its MessagePack transcoding.
+// Going through JSON keeps field names and omitempty exactly as JSON
+// clients see them.
+func (c wsCodec) encode(v any) (int, []byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || !c.msgpack {
+		return websocket.TextMessage, data, err
+	}
+	data, err = jsonToMsgpack(data)
+	return websocket.BinaryMessage, data, err
+}
+
+// write encodes v and sends it on conn.
+func (c wsCodec) write(conn *websocket.Conn, v any) error {
+	typ, data, err := c.encode(v)
+	if err != nil {
+		return err
+	}
+	return c.send(conn, typ, data)
+}
+
+// send writes one encoded frame, compressed when it is big enough to gain.
+func (c wsCodec) send(conn *websocket.Conn, typ int, data []byte) error {
+	if c.deflate {
+		conn.EnableWriteCompression(len(data) >= wsDeflateMin)
+	}
+	return conn.WriteMessage(typ, data)
+}
+
+// jsonToMsgpack transcodes one JSON value to MessagePack. Integers keep
+// their smallest encoding; other numbers become float64.
+func jsonToMsgpack(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return appendMsgpack(make([]byte, 0, len(data)), v)
+}
+
+func appendMsgpack(b []byte, v any) ([]byte, error) {
+	var err error
+	switch v := v.(type) {
+	case nil:
+		b = append(b, 0xc0)
+	case bool:
+		if v {
+			b = append(b, 0xc3)
+		} else {
+			b = append(b, 0xc2)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return appendMsgpackInt(b, n), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		b = binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(f))
+	case string:
+		b = append(appendMsgpackHeader(b, len(v), 0xa0, 31, 0xd9, 0xda, 0xdb), v...)
+	case []any:
+		b = appendMsgpackHeader(b, len(v), 0x90, 15, 0, 0xdc, 0xdd)
+		for _, e := range v {
+			if b, err = appendMsgpack(b, e); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]any:
+		// Sorted keys make repeated shapes byte-identical, which is what
+		// permessage-deflate feeds on.
+		b = appendMsgpackHeader(b, len(v), 0x80, 15, 0, 0xde, 0xdf)
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			b = append(appendMsgpackHeader(b, len(k), 0xa0, 31, 0xd9, 0xda, 0xdb), k...)
+			if b, err = appendMsgpack(b, v[k]); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("msgpack: unexpected %T", v)
+	}
+	return b, nil
+}
+
+// appendMsgpackHeader appends a string, array or map header for n elements:
+// the fix form (fix|n) up to fixMax, else the 8-, 16- or 32-bit form. Arrays
+// and maps have no 8-bit form (pass 0).
+func appendMsgpackHeader(b []byte, n int, fix byte, fixMax int, c8, c16, c32 byte) []byte {
+	switch {
+	case n <= fixMax:
+		return append(b, fix|byte(n))
+	case c8 != 0 && n <= math.MaxUint8:
+		return append(b, c8, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, c16), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, c32), uint32(n))
+	}
+}
+
+func appendMsgpackInt(b []byte, n int64) []byte {
+	switch {
+	case n >= -32 && n <= 127:
+		return append(b, byte(int8(n))) // positive or negative fixint
+	case n >= math.MinInt8 && n <= math.MaxInt8:
+		return append(b, 0xd0, byte(int8(n)))
+	case n >= math.MinInt16 && n <= math.MaxInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(int16(n)))
+	case n >= math.MinInt32 && n <= math.MaxInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(int32(n)))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(n))
+	}
+}
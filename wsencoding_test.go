@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestJSONToMsgpack(t *testing.T) {
+	tests := []struct{ json, want string }{
+		{`{"a":1}`, "81a16101"},
+		{`[-1,-33,300,1.5,"x",null,true,false]`, "98ffd0dfd1012ccb3ff8000000000000a178c0c3c2"},
+		{`[70000,-70000,5000000000]`, "93d200011170d2fffeee90d3000000012a05f200"},
+		{`"` + strings.Repeat("é", 20) + `"`, "d928" + strings.Repeat("c3a9", 20)},
+	}
+	for _, tt := range tests {
+		got, err := jsonToMsgpack([]byte(tt.json))
+		if err != nil {
+			t.Errorf("%s: %v", tt.json, err)
+			continue
+		}
+		if hex.EncodeToString(got) != tt.want {
+			t.Errorf("%s = %x, want %s", tt.json, got, tt.want)
+		}
+	}
+}
+
+func TestWebSocketSubprotocol(t *testing.T) {
+	base := startWSServer(t)
+	dial := func(protocols ...string) *websocket.Conn {
+		t.Helper()
+		d := *websocket.DefaultDialer
+		d.Subprotocols = protocols
+		conn, _, err := d.Dial("ws"+strings.TrimPrefix(base, "http")+"/ws", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	}
+	firstFrame := func(conn *websocket.Conn) (int, []byte) {
+		t.Helper()
+		typ, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return typ, data
+	}
+
+	conn := dial(wsProtoMsgpack, wsProtoJSON)
+	if conn.Subprotocol() != wsProtoMsgpack {
+		t.Errorf("negotiated %q", conn.Subprotocol())
+	}
+	// {"type":"connected", ...}: a map whose keys include "connected".
+	if typ, data := firstFrame(conn); typ != websocket.BinaryMessage || !strings.Contains(string(data), "\xa9connected") {
+		t.Errorf("msgpack client got frame type %d: %q", typ, data)
+	}
+	if typ, data := firstFrame(dial()); typ != websocket.TextMessage || !strings.HasPrefix(string(data), "{") {
+		t.Errorf("plain client got frame type %d: %q", typ, data)
+	}
+
+	orig := wsMsgpack
+	wsMsgpack = false
+	t.Cleanup(func() { wsMsgpack = orig })
+	conn = dial(wsProtoMsgpack, wsProtoJSON)
+	if typ, _ := firstFrame(conn); conn.Subprotocol() != wsProtoJSON || typ != websocket.TextMessage {
+		t.Errorf("with -ws-msgpack=false negotiated %q, frame type %d", conn.Subprotocol(), typ)
+	}
+}
+
+func TestWebSocketDeflate(t *testing.T) {
+	base := startWSServer(t)
+	d := *websocket.DefaultDialer
+	d.EnableCompression = true
+	conn, resp, err := d.Dial("ws"+strings.TrimPrefix(base, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if ext := resp.Header.Get("Sec-Websocket-Extensions"); !strings.Contains(ext, "permessage-deflate") {
+		t.Errorf("extensions %q", ext)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	bus.Publish(Event{Type: "draw", Instructions: bigDrawing(200)})
+	var frame Event
+	for frame.Type != "draw" {
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(frame.Instructions) != 200 {
+		t.Errorf("got %d instructions", len(frame.Instructions))
+	}
+}
+
+// BenchmarkDrawFrame encodes a 1000-shape drawing each way the server can
+// send it, reporting the bytes that go over the wire.
+func BenchmarkDrawFrame(b *testing.B) {
+	ev := Event{Type: "draw", Seq: 4242, Instructions: bigDrawing(1000), Timestamp: time.Now().UnixMilli()}
+	for _, bc := range []struct {
+		name    string
+		msgpack bool
+		level   int
+	}{
+		{"json", false, 0},
+		{"msgpack", true, 0},
+		{"json+deflate", false, wsDeflate},
+		{"msgpack+deflate", true, wsDeflate},
+		{"json+deflate9", false, flate.BestCompression},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			var size int
+			for i := 0; i < b.N; i++ {
+				_, data, err := wsCodec{msgpack: bc.msgpack}.encode(ev)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if bc.level > 0 {
+					var buf bytes.Buffer
+					w, _ := flate.NewWriter(&buf, bc.level)
+					w.Write(data)
+					w.Close()
+					data = buf.Bytes()
+				}
+				size = len(data)
+			}
+			b.ReportMetric(float64(size), "wire-bytes")
+		})
+	}
+}